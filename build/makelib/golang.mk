@@ -132,6 +132,11 @@ go.test.unit: $(GOJUNIT)
 	@CGO_ENABLED=0 $(GOHOST) test -v -cover $(GO_TEST_FLAGS) $(GO_STATIC_FLAGS) $(GO_PACKAGES) 2>&1 | tee $(GO_TEST_OUTPUT)/unit-tests.log
 	@cat $(GO_TEST_OUTPUT)/unit-tests.log | $(GOJUNIT) -set-exit-code > $(GO_TEST_OUTPUT)/unit-tests.xml
 
+.PHONY: go.test.race
+go.test.race:
+	@echo === go test race
+	@CGO_ENABLED=1 $(GOHOST) test -race $(GO_TEST_FLAGS) $(GO_COMMON_FLAGS) $(GO_PACKAGES)
+
 .PHONY:
 go.test.integration: $(GOJUNIT)
 	@echo === go test integration-tests
@@ -17,6 +17,7 @@ package ceph
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/rook/rook/cmd/rook/rook"
 	"github.com/rook/rook/pkg/clusterd"
@@ -24,6 +25,7 @@ import (
 	"github.com/rook/rook/pkg/operator/k8sutil"
 	"github.com/rook/rook/pkg/util/exec"
 	"github.com/rook/rook/pkg/util/flags"
+	"github.com/rook/rook/pkg/util/metrics"
 	"github.com/spf13/cobra"
 )
 
@@ -33,7 +35,11 @@ var agentCmd = &cobra.Command{
 	Hidden: true,
 }
 
+var agentOfflineWindow time.Duration
+
 func init() {
+	agentCmd.Flags().DurationVar(&agentOfflineWindow, "offline-window", 10*time.Minute, "how long volumes are still detached while the kubernetes api is unreachable, after which the agent is read-only until the api is back")
+	addMetricsFlags(agentCmd, "agent")
 	flags.SetFlagsFromEnv(agentCmd.Flags(), rook.RookEnvVarPrefix)
 	agentCmd.RunE = startAgent
 }
@@ -43,6 +49,15 @@ func startAgent(cmd *cobra.Command, args []string) error {
 	rook.SetLogLevel()
 
 	rook.LogStartupInfo(agentCmd.Flags())
+	if err := metrics.VerifyCORS(); err != nil {
+		rook.TerminateFatal(err)
+	}
+	k8sutil.RegisterRequestMetrics()
+	metricsServer, err := metrics.Serve(metricsPort)
+	if err != nil {
+		rook.TerminateFatal(err)
+	}
+	defer metricsServer.Stop()
 
 	clientset, apiExtClientset, rookClientset, err := rook.GetClientset()
 	if err != nil {
@@ -59,7 +74,7 @@ func startAgent(cmd *cobra.Command, args []string) error {
 		RookClientset:         rookClientset,
 	}
 
-	agent := agent.New(context)
+	agent := agent.New(context, agentOfflineWindow)
 	err = agent.Run()
 	if err != nil {
 		rook.TerminateFatal(fmt.Errorf("failed to run rook ceph agent. %+v\n", err))
@@ -0,0 +1,118 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ceph
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"github.com/rook/rook/cmd/rook/rook"
+	"github.com/rook/rook/pkg/clusterd"
+	"github.com/rook/rook/pkg/operator/ceph/cluster/backup"
+	"github.com/rook/rook/pkg/util/flags"
+	"github.com/spf13/cobra"
+)
+
+var backupCmd = &cobra.Command{
+	Use:    "backup",
+	Short:  "Exports or imports the identity and desired state of a Ceph cluster for disaster recovery",
+	Hidden: true,
+}
+
+var backupExportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Exports the cluster identity and the specs of the cluster resources to an encrypted archive",
+}
+
+var backupImportCmd = &cobra.Command{
+	Use:   "import",
+	Short: "Imports an encrypted archive to re-create a cluster before it is started by the operator",
+}
+
+var (
+	backupNamespace  string
+	backupFile       string
+	backupPassphrase string
+)
+
+func init() {
+	for _, cmd := range []*cobra.Command{backupExportCmd, backupImportCmd} {
+		cmd.Flags().StringVar(&backupNamespace, "namespace", "rook-ceph", "namespace of the cluster")
+		cmd.Flags().StringVar(&backupFile, "archive", "", "path to the archive file")
+		cmd.Flags().StringVar(&backupPassphrase, "archive-passphrase", "", "passphrase to encrypt or decrypt the archive")
+		flags.SetFlagsFromEnv(cmd.Flags(), rook.RookEnvVarPrefix)
+	}
+
+	backupExportCmd.RunE = exportCluster
+	backupImportCmd.RunE = importCluster
+	backupCmd.AddCommand(backupExportCmd, backupImportCmd)
+}
+
+func exportCluster(cmd *cobra.Command, args []string) error {
+	if err := flags.VerifyRequiredFlags(cmd, []string{"archive", "archive-passphrase"}); err != nil {
+		return err
+	}
+	rook.SetLogLevel()
+
+	context, err := createBackupContext()
+	if err != nil {
+		return err
+	}
+	archive, err := backup.Export(context, backupNamespace)
+	if err != nil {
+		return err
+	}
+	data, err := backup.Marshal(archive, backupPassphrase)
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(backupFile, data, 0600); err != nil {
+		return fmt.Errorf("failed to write archive %s. %+v", backupFile, err)
+	}
+
+	logger.Infof("exported cluster %s to %s", backupNamespace, backupFile)
+	return nil
+}
+
+func importCluster(cmd *cobra.Command, args []string) error {
+	if err := flags.VerifyRequiredFlags(cmd, []string{"archive", "archive-passphrase"}); err != nil {
+		return err
+	}
+	rook.SetLogLevel()
+
+	data, err := ioutil.ReadFile(backupFile)
+	if err != nil {
+		return fmt.Errorf("failed to read archive %s. %+v", backupFile, err)
+	}
+	archive, err := backup.Unmarshal(data, backupPassphrase)
+	if err != nil {
+		return err
+	}
+	context, err := createBackupContext()
+	if err != nil {
+		return err
+	}
+	return backup.Import(context, backupNamespace, archive)
+}
+
+func createBackupContext() (*clusterd.Context, error) {
+	clientset, _, rookClientset, err := rook.GetClientset()
+	if err != nil {
+		return nil, rook.ConnectionError(fmt.Errorf("failed to get k8s client. %+v", err))
+	}
+	return &clusterd.Context{Clientset: clientset, RookClientset: rookClientset}, nil
+}
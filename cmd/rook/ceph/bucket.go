@@ -0,0 +1,210 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ceph
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/rook/rook/cmd/rook/rook"
+	"github.com/rook/rook/pkg/daemon/ceph/rgw"
+	"github.com/rook/rook/pkg/operator/k8sutil"
+	"github.com/rook/rook/pkg/util/flags"
+	"github.com/spf13/cobra"
+)
+
+var bucketCmd = &cobra.Command{
+	Use:    "bucket",
+	Short:  "Manages the website, policy and cors rules of the buckets of an object store",
+	Hidden: true,
+}
+
+var bucketWebsiteCmd = &cobra.Command{
+	Use:   "website",
+	Short: "Manages the static website hosting of a bucket",
+}
+
+var bucketPolicyCmd = &cobra.Command{
+	Use:   "policy",
+	Short: "Manages the access policy of a bucket",
+}
+
+var bucketCORSCmd = &cobra.Command{
+	Use:   "cors",
+	Short: "Manages the cross-origin resource sharing rules of a bucket",
+}
+
+var (
+	bucketNamespace     string
+	bucketStore         string
+	bucketName          string
+	bucketEndpoint      string
+	bucketIndexDocument string
+	bucketErrorDocument string
+	bucketFile          string
+)
+
+func init() {
+	subcommands := map[*cobra.Command][]*cobra.Command{
+		bucketWebsiteCmd: {
+			{Use: "set", Short: "Serves the bucket as a static website", RunE: setBucketWebsite},
+			{Use: "rm", Short: "Stops serving the bucket as a static website", RunE: deleteBucketWebsite},
+		},
+		bucketPolicyCmd: {
+			{Use: "get", Short: "Prints the policy of the bucket", RunE: getBucketPolicy},
+			{Use: "set", Short: "Replaces the policy of the bucket with a json policy document", RunE: setBucketPolicy},
+			{Use: "rm", Short: "Removes the policy of the bucket", RunE: deleteBucketPolicy},
+		},
+		bucketCORSCmd: {
+			{Use: "get", Short: "Prints the cors rules of the bucket", RunE: getBucketCORS},
+			{Use: "set", Short: "Replaces the cors rules of the bucket with a json list of rules", RunE: setBucketCORS},
+			{Use: "rm", Short: "Removes the cors rules of the bucket", RunE: deleteBucketCORS},
+		},
+	}
+	for parent, children := range subcommands {
+		for _, cmd := range children {
+			cmd.Flags().StringVar(&bucketNamespace, "namespace", "rook-ceph", "namespace of the cluster")
+			cmd.Flags().StringVar(&bucketStore, "store", "", "name of the object store")
+			cmd.Flags().StringVar(&bucketName, "bucket", "", "name of the bucket")
+			cmd.Flags().StringVar(&bucketEndpoint, "endpoint", "", "s3 endpoint of the object store, such as http://rook-ceph-rgw-my-store.rook-ceph:80")
+			switch {
+			case parent == bucketWebsiteCmd && cmd.Use == "set":
+				cmd.Flags().StringVar(&bucketIndexDocument, "index-document", "index.html", "object returned for the requests to a directory of the website")
+				cmd.Flags().StringVar(&bucketErrorDocument, "error-document", "", "object returned when a request to the website fails")
+			case parent == bucketPolicyCmd && cmd.Use == "set":
+				cmd.Flags().StringVar(&bucketFile, "policy-file", "", "path to the json policy document")
+			case parent == bucketCORSCmd && cmd.Use == "set":
+				cmd.Flags().StringVar(&bucketFile, "cors-file", "", "path to the json list of cors rules")
+			}
+			flags.SetFlagsFromEnv(cmd.Flags(), rook.RookEnvVarPrefix)
+			parent.AddCommand(cmd)
+		}
+		bucketCmd.AddCommand(parent)
+	}
+}
+
+// bucketContext verifies the flags of the command and returns the admin context of the object store
+func bucketContext(cmd *cobra.Command, required ...string) (*rgw.Context, error) {
+	if err := flags.VerifyRequiredFlags(cmd, append([]string{"store", "bucket", "endpoint"}, required...)); err != nil {
+		return nil, err
+	}
+	rook.SetLogLevel()
+
+	context := createContext()
+	context.ConfigDir = k8sutil.DataDir
+	return rgw.NewContext(context, bucketStore, bucketNamespace), nil
+}
+
+func setBucketWebsite(cmd *cobra.Command, args []string) error {
+	c, err := bucketContext(cmd)
+	if err != nil {
+		return err
+	}
+	website := rgw.BucketWebsite{IndexDocument: bucketIndexDocument, ErrorDocument: bucketErrorDocument}
+	if err := rgw.SetBucketWebsite(c, bucketEndpoint, bucketName, website); err != nil {
+		return err
+	}
+	logger.Infof("bucket %s is served as a static website", bucketName)
+	return nil
+}
+
+func deleteBucketWebsite(cmd *cobra.Command, args []string) error {
+	c, err := bucketContext(cmd)
+	if err != nil {
+		return err
+	}
+	return rgw.DeleteBucketWebsite(c, bucketEndpoint, bucketName)
+}
+
+func getBucketPolicy(cmd *cobra.Command, args []string) error {
+	c, err := bucketContext(cmd)
+	if err != nil {
+		return err
+	}
+	policy, err := rgw.GetBucketPolicy(c, bucketEndpoint, bucketName)
+	if err != nil {
+		return err
+	}
+	fmt.Println(policy)
+	return nil
+}
+
+func setBucketPolicy(cmd *cobra.Command, args []string) error {
+	c, err := bucketContext(cmd, "policy-file")
+	if err != nil {
+		return err
+	}
+	policy, err := ioutil.ReadFile(bucketFile)
+	if err != nil {
+		return fmt.Errorf("failed to read policy file %s. %+v", bucketFile, err)
+	}
+	var document map[string]interface{}
+	if err := json.Unmarshal(policy, &document); err != nil {
+		return fmt.Errorf("policy file %s is not a json document. %+v", bucketFile, err)
+	}
+	return rgw.SetBucketPolicy(c, bucketEndpoint, bucketName, string(policy))
+}
+
+func deleteBucketPolicy(cmd *cobra.Command, args []string) error {
+	c, err := bucketContext(cmd)
+	if err != nil {
+		return err
+	}
+	return rgw.DeleteBucketPolicy(c, bucketEndpoint, bucketName)
+}
+
+func getBucketCORS(cmd *cobra.Command, args []string) error {
+	c, err := bucketContext(cmd)
+	if err != nil {
+		return err
+	}
+	rules, err := rgw.GetBucketCORS(c, bucketEndpoint, bucketName)
+	if err != nil {
+		return err
+	}
+	output, err := json.MarshalIndent(rules, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal the cors rules. %+v", err)
+	}
+	fmt.Println(string(output))
+	return nil
+}
+
+func setBucketCORS(cmd *cobra.Command, args []string) error {
+	c, err := bucketContext(cmd, "cors-file")
+	if err != nil {
+		return err
+	}
+	data, err := ioutil.ReadFile(bucketFile)
+	if err != nil {
+		return fmt.Errorf("failed to read cors file %s. %+v", bucketFile, err)
+	}
+	var rules []rgw.CORSRule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return fmt.Errorf("failed to parse the cors rules in %s. %+v", bucketFile, err)
+	}
+	return rgw.SetBucketCORS(c, bucketEndpoint, bucketName, rules)
+}
+
+func deleteBucketCORS(cmd *cobra.Command, args []string) error {
+	c, err := bucketContext(cmd)
+	if err != nil {
+		return err
+	}
+	return rgw.DeleteBucketCORS(c, bucketEndpoint, bucketName)
+}
@@ -21,10 +21,12 @@ import (
 
 	"github.com/rook/rook/cmd/rook/rook"
 	"github.com/rook/rook/pkg/clusterd"
+	"github.com/rook/rook/pkg/daemon/ceph/client"
 	"github.com/rook/rook/pkg/daemon/ceph/mon"
 	osdconfig "github.com/rook/rook/pkg/operator/ceph/cluster/osd/config"
 	"github.com/rook/rook/pkg/util/exec"
 	"github.com/rook/rook/pkg/util/flags"
+	"github.com/rook/rook/pkg/util/metrics"
 )
 
 var Cmd = &cobra.Command{
@@ -37,12 +39,14 @@ var (
 	cfg         = &config{}
 	clusterInfo mon.ClusterInfo
 	logger      = capnslog.NewPackageLogger("github.com/rook/rook", "cephcmd")
+	metricsPort int
 )
 
 type config struct {
 	devices            string
 	directories        string
 	metadataDevice     string
+	protectedOverride  string
 	dataDir            string
 	forceFormat        bool
 	location           string
@@ -55,6 +59,10 @@ type config struct {
 
 func init() {
 	AddCommands(Cmd)
+
+	// the admin commands can run ceph in the toolbox when rook runs outside of the cluster, such as on a workstation
+	rook.RootCmd.PersistentFlags().BoolVar(&client.RunAllCephCommandsInToolbox, "toolbox", false, "run the ceph tools in the rook-ceph-tools pod of the cluster")
+	rook.ServerOnly(operatorCmd, agentCmd, monCmd, osdCmd, mgrCmd, rgwCmd, mdsCmd, logRotateCmd, networkCheckCmd)
 }
 
 func AddCommands(command *cobra.Command) {
@@ -65,6 +73,17 @@ func AddCommands(command *cobra.Command) {
 	command.AddCommand(mgrCmd)
 	command.AddCommand(rgwCmd)
 	command.AddCommand(mdsCmd)
+	command.AddCommand(backupCmd)
+	command.AddCommand(poolCmd)
+	command.AddCommand(nodeCmd)
+	command.AddCommand(imageCmd)
+	command.AddCommand(bucketCmd)
+	command.AddCommand(objectUserCmd)
+	command.AddCommand(objectUsageCmd)
+	command.AddCommand(filesystemClientCmd)
+	command.AddCommand(clientConfigCmd)
+	command.AddCommand(logRotateCmd)
+	command.AddCommand(networkCheckCmd)
 }
 
 func createContext() *clusterd.Context {
@@ -97,6 +116,18 @@ func addCephFlags(command *cobra.Command) {
 	command.Flags().MarkDeprecated("private-ipv4", "Use --private-ip instead. Will be removed in a future version.")
 }
 
+func addMetricsFlags(command *cobra.Command, daemon string) {
+	command.Flags().IntVar(&metricsPort, "metrics-port", 0, "port to serve the prometheus metrics of the "+daemon+" at /metrics. not served if 0")
+	command.Flags().DurationVar(&metrics.ReadTimeout, "metrics-read-timeout", metrics.ReadTimeout, "time to read a request of the metrics, after which the connection is closed. also the time the idle connections are kept (duration)")
+	command.Flags().DurationVar(&metrics.WriteTimeout, "metrics-write-timeout", metrics.WriteTimeout, "time to write the response of a request of the metrics (duration)")
+	command.Flags().IntVar(&metrics.MaxHeaderBytes, "metrics-max-header-bytes", metrics.MaxHeaderBytes, "max size of the headers of a request of the metrics")
+	command.Flags().Int64Var(&metrics.MaxRequestBytes, "metrics-max-request-bytes", metrics.MaxRequestBytes, "max size of the body of a request of the metrics")
+	flags.StringSliceVar(command.Flags(), &metrics.CORSAllowedOrigins, "metrics-cors-origins", metrics.CORSAllowedOrigins, "origins of the web pages that can read the metrics from a browser, or * for all the origins. no cross origin reads if empty")
+	flags.StringSliceVar(command.Flags(), &metrics.CORSAllowedMethods, "metrics-cors-methods", metrics.CORSAllowedMethods, "methods the cors origins of the metrics can send")
+	flags.StringSliceVar(command.Flags(), &metrics.CORSAllowedHeaders, "metrics-cors-headers", metrics.CORSAllowedHeaders, "headers the cors origins of the metrics can send")
+	command.Flags().BoolVar(&metrics.CORSAllowCredentials, "metrics-cors-credentials", metrics.CORSAllowCredentials, "allow the browsers to send the cookies and the authorization of the cors origins of the metrics. not allowed with the * origin")
+}
+
 func verifyRenamedFlags(cmd *cobra.Command) error {
 	renamed := []flags.RenamedFlag{
 		{NewFlagName: "public-ip", OldFlagName: "public-ipv4"},
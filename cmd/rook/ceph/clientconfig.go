@@ -0,0 +1,77 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ceph
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/rook/rook/cmd/rook/rook"
+	"github.com/rook/rook/pkg/daemon/ceph/client"
+	"github.com/rook/rook/pkg/operator/k8sutil"
+	"github.com/rook/rook/pkg/util/flags"
+	"github.com/spf13/cobra"
+)
+
+var clientConfigCmd = &cobra.Command{
+	Use:    "client-config",
+	Short:  "Prints the ceph.conf and keyring for a host outside of the cluster to connect as a ceph user",
+	Hidden: true,
+}
+
+var (
+	clientConfigNamespace string
+	clientConfigName      string
+	clientConfigFormat    string
+)
+
+func init() {
+	clientConfigCmd.Flags().StringVar(&clientConfigNamespace, "namespace", "rook-ceph", "namespace of the cluster")
+	clientConfigCmd.Flags().StringVar(&clientConfigName, "client", "", "name of the existing ceph user, such as app1 for client.app1")
+	clientConfigCmd.Flags().StringVar(&clientConfigFormat, "format", "json", "format of the output: json, or tar to extract in /etc/ceph")
+	flags.SetFlagsFromEnv(clientConfigCmd.Flags(), rook.RookEnvVarPrefix)
+
+	clientConfigCmd.RunE = printClientConfig
+}
+
+func printClientConfig(cmd *cobra.Command, args []string) error {
+	if err := flags.VerifyRequiredFlags(cmd, []string{"client"}); err != nil {
+		return err
+	}
+	if clientConfigFormat != "json" && clientConfigFormat != "tar" {
+		return fmt.Errorf("invalid format %s. must be json or tar", clientConfigFormat)
+	}
+	rook.SetLogLevel()
+
+	context := createContext()
+	context.ConfigDir = k8sutil.DataDir
+	config, err := client.GetClientConfig(context, clientConfigNamespace, clientConfigName)
+	if err != nil {
+		return err
+	}
+	if clientConfigFormat == "tar" {
+		return config.WriteTar(os.Stdout)
+	}
+
+	output, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal the config of client %s. %+v", config.Name, err)
+	}
+	fmt.Println(string(output))
+	return nil
+}
@@ -0,0 +1,152 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ceph
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/rook/rook/pkg/daemon/ceph/client"
+	"github.com/rook/rook/pkg/operator/k8sutil"
+	"github.com/rook/rook/pkg/util/flags"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// BashCompletionFunction defines the bash functions that complete the names of the pools and images by running the
+// hidden complete command
+const BashCompletionFunction = `
+__rook_flag_value()
+{
+    local i
+    for (( i=1; i < ${#words[@]}; i++ )); do
+        if [[ ${words[i]} == "$1="* ]]; then
+            echo "${words[i]#*=}"
+            return
+        fi
+        if [[ ${words[i]} == "$1" ]]; then
+            echo "${words[i+1]}"
+            return
+        fi
+    done
+}
+
+__rook_get_pools()
+{
+    local namespace out
+    namespace=$(__rook_flag_value --namespace)
+    if out=$(rook ceph complete pools --namespace "${namespace:-rook-ceph}" 2>/dev/null); then
+        COMPREPLY=( $( compgen -W "${out}" -- "$cur" ) )
+    fi
+}
+
+__rook_get_images()
+{
+    local namespace pool out
+    namespace=$(__rook_flag_value --namespace)
+    pool=$(__rook_flag_value --pool)
+    if [[ -z ${pool} ]]; then
+        return
+    fi
+    if out=$(rook ceph complete images --namespace "${namespace:-rook-ceph}" --pool "${pool}" 2>/dev/null); then
+        COMPREPLY=( $( compgen -W "${out}" -- "$cur" ) )
+    fi
+}
+`
+
+// the flags whose values are completed with the names of the pools or of the images of the pool
+var (
+	poolFlags  = []string{"pool", "source", "target", "data-pool"}
+	imageFlags = []string{"image"}
+)
+
+var completeCmd = &cobra.Command{
+	Use:       "complete",
+	Short:     "Prints the names of the pools or of the images of a pool for the shell completion",
+	Hidden:    true,
+	ValidArgs: []string{"pools", "images"},
+}
+
+var (
+	completeNamespace string
+	completePool      string
+)
+
+func init() {
+	completeCmd.Flags().StringVar(&completeNamespace, "namespace", "rook-ceph", "namespace of the cluster")
+	completeCmd.Flags().StringVar(&completePool, "pool", "", "pool of the images")
+	completeCmd.RunE = complete
+	Cmd.AddCommand(completeCmd)
+}
+
+// AddCompletions sets the bash completion of the flags of the commands that name a pool or an image
+func AddCompletions(command *cobra.Command) {
+	command.Flags().VisitAll(func(f *pflag.Flag) {
+		for _, name := range poolFlags {
+			if f.Name == name {
+				command.Flags().SetAnnotation(f.Name, cobra.BashCompCustom, []string{"__rook_get_pools"})
+			}
+		}
+		for _, name := range imageFlags {
+			if f.Name == name {
+				command.Flags().SetAnnotation(f.Name, cobra.BashCompCustom, []string{"__rook_get_images"})
+			}
+		}
+	})
+	for _, c := range command.Commands() {
+		AddCompletions(c)
+	}
+}
+
+func complete(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("expected pools or images")
+	}
+
+	context := createContext()
+	context.ConfigDir = k8sutil.DataDir
+	var names []string
+	switch args[0] {
+	case "pools":
+		pools, err := client.GetPoolNamesByID(context, completeNamespace)
+		if err != nil {
+			return err
+		}
+		for _, name := range pools {
+			names = append(names, name)
+		}
+	case "images":
+		if err := flags.VerifyRequiredFlags(cmd, []string{"pool"}); err != nil {
+			return err
+		}
+		images, err := client.ListImages(context, completeNamespace, completePool)
+		if err != nil {
+			return err
+		}
+		for _, image := range images {
+			names = append(names, image.Name)
+		}
+	default:
+		return fmt.Errorf("unknown names %s, expected pools or images", args[0])
+	}
+
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Println(name)
+	}
+	return nil
+}
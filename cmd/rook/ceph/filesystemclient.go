@@ -0,0 +1,110 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ceph
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/rook/rook/cmd/rook/rook"
+	"github.com/rook/rook/pkg/daemon/ceph/client"
+	"github.com/rook/rook/pkg/operator/k8sutil"
+	"github.com/rook/rook/pkg/util/flags"
+	"github.com/spf13/cobra"
+)
+
+var filesystemClientCmd = &cobra.Command{
+	Use:    "filesystem-client",
+	Short:  "Manages the ceph users restricted to a path of a filesystem",
+	Hidden: true,
+}
+
+var filesystemClientCreateCmd = &cobra.Command{
+	Use:   "create",
+	Short: "Creates a ceph user that can only access a path of a filesystem and prints its key and mount info",
+}
+
+var filesystemClientRemoveCmd = &cobra.Command{
+	Use:   "rm",
+	Short: "Removes a ceph user of a filesystem",
+}
+
+var (
+	fsClientNamespace     string
+	fsClientFilesystem    string
+	fsClientName          string
+	fsClientPath          string
+	fsClientPoolNamespace string
+	fsClientReadOnly      bool
+)
+
+func init() {
+	for _, cmd := range []*cobra.Command{filesystemClientCreateCmd, filesystemClientRemoveCmd} {
+		cmd.Flags().StringVar(&fsClientNamespace, "namespace", "rook-ceph", "namespace of the cluster")
+		cmd.Flags().StringVar(&fsClientName, "client", "", "name of the ceph user, such as app1 for client.app1")
+	}
+	filesystemClientCreateCmd.Flags().StringVar(&fsClientFilesystem, "filesystem", "", "name of the filesystem")
+	filesystemClientCreateCmd.Flags().StringVar(&fsClientPath, "path", "", "path of the filesystem the user is restricted to, such as /app1")
+	filesystemClientCreateCmd.Flags().StringVar(&fsClientPoolNamespace, "pool-namespace", "",
+		"rados namespace of the data pools the user is restricted to. the pool_namespace of the directory layout must be set to the same namespace")
+	filesystemClientCreateCmd.Flags().BoolVar(&fsClientReadOnly, "read-only", false, "only allow the user to read the path")
+	flags.SetFlagsFromEnv(filesystemClientCreateCmd.Flags(), rook.RookEnvVarPrefix)
+	flags.SetFlagsFromEnv(filesystemClientRemoveCmd.Flags(), rook.RookEnvVarPrefix)
+
+	filesystemClientCreateCmd.RunE = createFilesystemClient
+	filesystemClientRemoveCmd.RunE = removeFilesystemClient
+	filesystemClientCmd.AddCommand(filesystemClientCreateCmd)
+	filesystemClientCmd.AddCommand(filesystemClientRemoveCmd)
+}
+
+func createFilesystemClient(cmd *cobra.Command, args []string) error {
+	if err := flags.VerifyRequiredFlags(cmd, []string{"filesystem", "client", "path"}); err != nil {
+		return err
+	}
+	rook.SetLogLevel()
+
+	context := createContext()
+	context.ConfigDir = k8sutil.DataDir
+	fsClient, err := client.AuthorizeFilesystemClient(context, fsClientNamespace, fsClientFilesystem, fsClientName,
+		fsClientPath, fsClientPoolNamespace, fsClientReadOnly)
+	if err != nil {
+		return err
+	}
+	output, err := json.MarshalIndent(fsClient, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal client %s. %+v", fsClient.Name, err)
+	}
+	fmt.Println(string(output))
+	return nil
+}
+
+func removeFilesystemClient(cmd *cobra.Command, args []string) error {
+	if err := flags.VerifyRequiredFlags(cmd, []string{"client"}); err != nil {
+		return err
+	}
+	rook.SetLogLevel()
+
+	context := createContext()
+	context.ConfigDir = k8sutil.DataDir
+	name := "client." + strings.TrimPrefix(fsClientName, "client.")
+	if err := client.AuthDelete(context, fsClientNamespace, name); err != nil {
+		return err
+	}
+	logger.Infof("removed %s", name)
+	return nil
+}
@@ -0,0 +1,325 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package ceph
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/rook/rook/cmd/rook/rook"
+	"github.com/rook/rook/pkg/clusterd"
+	"github.com/rook/rook/pkg/daemon/ceph/client"
+	"github.com/rook/rook/pkg/operator/k8sutil"
+	"github.com/rook/rook/pkg/util/flags"
+	"github.com/spf13/cobra"
+)
+
+var imageGroupCmd = &cobra.Command{
+	Use:   "group",
+	Short: "Manages the consistency groups of block images and their snapshots",
+}
+
+var imageGroupListCmd = &cobra.Command{
+	Use:   "ls",
+	Short: "Lists the consistency groups of a pool, or the images of a group",
+}
+
+var imageGroupCreateCmd = &cobra.Command{
+	Use:   "create",
+	Short: "Creates a consistency group with the given images",
+}
+
+var imageGroupRemoveCmd = &cobra.Command{
+	Use:   "rm",
+	Short: "Deletes a consistency group with its snapshots, keeping its images",
+}
+
+var imageGroupAddCmd = &cobra.Command{
+	Use:   "add",
+	Short: "Adds images to a consistency group",
+}
+
+var imageGroupRemoveImageCmd = &cobra.Command{
+	Use:   "remove",
+	Short: "Removes images from a consistency group",
+}
+
+var imageGroupSnapshotCmd = &cobra.Command{
+	Use:   "snapshot",
+	Short: "Takes a crash consistent snapshot of all the images of a consistency group",
+}
+
+var imageGroupSnapshotsCmd = &cobra.Command{
+	Use:   "snapshots",
+	Short: "Lists the snapshots of a consistency group",
+}
+
+var imageGroupRestoreCmd = &cobra.Command{
+	Use:   "restore",
+	Short: "Rolls back all the images of a consistency group to a snapshot",
+}
+
+var imageGroupRemoveSnapshotCmd = &cobra.Command{
+	Use:   "rm-snapshot",
+	Short: "Deletes a snapshot of a consistency group",
+}
+
+var (
+	imageGroup      string
+	imageGroupImage []string
+	imageGroupSnap  string
+	imageGroupForce bool
+)
+
+func init() {
+	allCmds := []*cobra.Command{imageGroupListCmd, imageGroupCreateCmd, imageGroupRemoveCmd, imageGroupAddCmd, imageGroupRemoveImageCmd,
+		imageGroupSnapshotCmd, imageGroupSnapshotsCmd, imageGroupRestoreCmd, imageGroupRemoveSnapshotCmd}
+	for _, cmd := range allCmds {
+		cmd.Flags().StringVar(&imageNamespace, "namespace", "rook-ceph", "namespace of the cluster")
+		cmd.Flags().StringVar(&imagePool, "pool", "", "pool of the group, or pool/namespace for a group in a pool namespace")
+		cmd.Flags().StringVar(&imageGroup, "group", "", "name of the group")
+	}
+	for _, cmd := range []*cobra.Command{imageGroupCreateCmd, imageGroupAddCmd, imageGroupRemoveImageCmd} {
+		flags.StringSliceVar(cmd.Flags(), &imageGroupImage, "image", nil,
+			"images of the group, as image for an image in the pool of the group or as pool/image or pool/namespace/image")
+	}
+	for _, cmd := range []*cobra.Command{imageGroupSnapshotCmd, imageGroupRestoreCmd, imageGroupRemoveSnapshotCmd} {
+		cmd.Flags().StringVar(&imageGroupSnap, "snapshot", "", "name of the snapshot of the group")
+	}
+	imageGroupRestoreCmd.Flags().BoolVar(&imageGroupForce, "force", false, "restore the images even if clients have them open")
+	for _, cmd := range allCmds {
+		flags.SetFlagsFromEnv(cmd.Flags(), rook.RookEnvVarPrefix)
+	}
+
+	imageGroupListCmd.RunE = listGroups
+	imageGroupCreateCmd.RunE = createGroup
+	imageGroupRemoveCmd.RunE = removeGroup
+	imageGroupAddCmd.RunE = addGroupImages
+	imageGroupRemoveImageCmd.RunE = removeGroupImages
+	imageGroupSnapshotCmd.RunE = snapshotGroup
+	imageGroupSnapshotsCmd.RunE = listGroupSnapshots
+	imageGroupRestoreCmd.RunE = restoreGroup
+	imageGroupRemoveSnapshotCmd.RunE = removeGroupSnapshot
+	for _, cmd := range allCmds {
+		imageGroupCmd.AddCommand(cmd)
+	}
+	imageCmd.AddCommand(imageGroupCmd)
+}
+
+// groupImageSpec splits an image of a group into its name and its pool, which is the pool of the group if the image
+// does not name one
+func groupImageSpec(image string) (string, string) {
+	i := strings.LastIndex(image, "/")
+	if i < 0 {
+		return image, imagePool
+	}
+	return image[i+1:], image[:i]
+}
+
+// addImagesToGroup adds the images of the flags to the group
+func addImagesToGroup(context *clusterd.Context) error {
+	for _, spec := range imageGroupImage {
+		image, pool := groupImageSpec(spec)
+		if err := client.AddGroupImage(context, imageNamespace, imageGroup, imagePool, image, pool); err != nil {
+			return err
+		}
+		logger.Infof("added image %s/%s to group %s", pool, image, imageGroup)
+	}
+	return nil
+}
+
+func listGroups(cmd *cobra.Command, args []string) error {
+	if err := flags.VerifyRequiredFlags(cmd, []string{"pool"}); err != nil {
+		return err
+	}
+	rook.SetLogLevel()
+
+	context := createContext()
+	context.ConfigDir = k8sutil.DataDir
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	if imageGroup == "" {
+		groups, err := client.ListGroups(context, imageNamespace, imagePool)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(w, "GROUP")
+		for _, group := range groups {
+			fmt.Fprintln(w, group)
+		}
+		return w.Flush()
+	}
+
+	images, err := client.ListGroupImages(context, imageNamespace, imageGroup, imagePool)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(w, "IMAGE\tPOOL\tSTATE")
+	for _, image := range images {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", image.Image, image.PoolSpec(), image.State)
+	}
+	return w.Flush()
+}
+
+func createGroup(cmd *cobra.Command, args []string) error {
+	if err := flags.VerifyRequiredFlags(cmd, []string{"pool", "group"}); err != nil {
+		return err
+	}
+	rook.SetLogLevel()
+
+	context := createContext()
+	context.ConfigDir = k8sutil.DataDir
+	if err := client.CreateGroup(context, imageNamespace, imageGroup, imagePool); err != nil {
+		return err
+	}
+	logger.Infof("created group %s in pool %s", imageGroup, imagePool)
+	return addImagesToGroup(context)
+}
+
+func removeGroup(cmd *cobra.Command, args []string) error {
+	if err := flags.VerifyRequiredFlags(cmd, []string{"pool", "group"}); err != nil {
+		return err
+	}
+	rook.SetLogLevel()
+
+	context := createContext()
+	context.ConfigDir = k8sutil.DataDir
+	if err := client.RemoveGroup(context, imageNamespace, imageGroup, imagePool); err != nil {
+		return err
+	}
+	logger.Infof("removed group %s from pool %s", imageGroup, imagePool)
+	return nil
+}
+
+func addGroupImages(cmd *cobra.Command, args []string) error {
+	if err := flags.VerifyRequiredFlags(cmd, []string{"pool", "group"}); err != nil {
+		return err
+	}
+	if len(imageGroupImage) == 0 {
+		return fmt.Errorf("%s requires at least one --image", cmd.Name())
+	}
+	rook.SetLogLevel()
+
+	context := createContext()
+	context.ConfigDir = k8sutil.DataDir
+	return addImagesToGroup(context)
+}
+
+func removeGroupImages(cmd *cobra.Command, args []string) error {
+	if err := flags.VerifyRequiredFlags(cmd, []string{"pool", "group"}); err != nil {
+		return err
+	}
+	if len(imageGroupImage) == 0 {
+		return fmt.Errorf("%s requires at least one --image", cmd.Name())
+	}
+	rook.SetLogLevel()
+
+	context := createContext()
+	context.ConfigDir = k8sutil.DataDir
+	for _, spec := range imageGroupImage {
+		image, pool := groupImageSpec(spec)
+		if err := client.RemoveGroupImage(context, imageNamespace, imageGroup, imagePool, image, pool); err != nil {
+			return err
+		}
+		logger.Infof("removed image %s/%s from group %s", pool, image, imageGroup)
+	}
+	return nil
+}
+
+func snapshotGroup(cmd *cobra.Command, args []string) error {
+	if err := flags.VerifyRequiredFlags(cmd, []string{"pool", "group", "snapshot"}); err != nil {
+		return err
+	}
+	rook.SetLogLevel()
+
+	context := createContext()
+	context.ConfigDir = k8sutil.DataDir
+	if err := client.CreateGroupSnapshot(context, imageNamespace, imageGroup, imagePool, imageGroupSnap); err != nil {
+		return err
+	}
+	logger.Infof("created snapshot %s of group %s in pool %s", imageGroupSnap, imageGroup, imagePool)
+	return nil
+}
+
+func listGroupSnapshots(cmd *cobra.Command, args []string) error {
+	if err := flags.VerifyRequiredFlags(cmd, []string{"pool", "group"}); err != nil {
+		return err
+	}
+	rook.SetLogLevel()
+
+	context := createContext()
+	context.ConfigDir = k8sutil.DataDir
+	snapshots, err := client.ListGroupSnapshots(context, imageNamespace, imageGroup, imagePool)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "SNAPSHOT\tSTATE")
+	for _, snapshot := range snapshots {
+		fmt.Fprintf(w, "%s\t%s\n", snapshot.Snapshot, snapshot.State)
+	}
+	return w.Flush()
+}
+
+func restoreGroup(cmd *cobra.Command, args []string) error {
+	if err := flags.VerifyRequiredFlags(cmd, []string{"pool", "group", "snapshot"}); err != nil {
+		return err
+	}
+	rook.SetLogLevel()
+
+	context := createContext()
+	context.ConfigDir = k8sutil.DataDir
+	if !imageGroupForce {
+		// the data of the images is replaced under the clients that have them open, which corrupts their filesystems
+		images, err := client.ListGroupImages(context, imageNamespace, imageGroup, imagePool)
+		if err != nil {
+			return err
+		}
+		for _, image := range images {
+			watchers, err := client.ListImageWatchers(context, imageNamespace, image.Image, image.PoolSpec())
+			if err != nil {
+				return err
+			}
+			if len(watchers) > 0 {
+				return fmt.Errorf("image %s/%s of group %s is open by %d clients such as %s. stop the pods of its volume, or use --force",
+					image.PoolSpec(), image.Image, imageGroup, len(watchers), watchers[0].Address)
+			}
+		}
+	}
+
+	if err := client.RollbackGroupSnapshot(context, imageNamespace, imageGroup, imagePool, imageGroupSnap); err != nil {
+		return err
+	}
+	logger.Infof("restored the images of group %s in pool %s to snapshot %s", imageGroup, imagePool, imageGroupSnap)
+	return nil
+}
+
+func removeGroupSnapshot(cmd *cobra.Command, args []string) error {
+	if err := flags.VerifyRequiredFlags(cmd, []string{"pool", "group", "snapshot"}); err != nil {
+		return err
+	}
+	rook.SetLogLevel()
+
+	context := createContext()
+	context.ConfigDir = k8sutil.DataDir
+	if err := client.RemoveGroupSnapshot(context, imageNamespace, imageGroup, imagePool, imageGroupSnap); err != nil {
+		return err
+	}
+	logger.Infof("removed snapshot %s of group %s in pool %s", imageGroupSnap, imageGroup, imagePool)
+	return nil
+}
@@ -0,0 +1,243 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ceph
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/rook/rook/cmd/rook/rook"
+	"github.com/rook/rook/pkg/daemon/ceph/client"
+	"github.com/rook/rook/pkg/operator/k8sutil"
+	"github.com/rook/rook/pkg/util/display"
+	"github.com/rook/rook/pkg/util/flags"
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+var imageCmd = &cobra.Command{
+	Use:    "image",
+	Short:  "Inspects the block images of a pool",
+	Hidden: true,
+}
+
+var imageListCmd = &cobra.Command{
+	Use:   "ls",
+	Short: "Lists the block images of a pool with their labels",
+}
+
+var imageLocksCmd = &cobra.Command{
+	Use:   "locks",
+	Short: "Lists the locks held on a block image",
+}
+
+var imageBreakLockCmd = &cobra.Command{
+	Use:   "break-lock",
+	Short: "Removes a lock held on a block image by a client that is no longer running",
+}
+
+var imageWatchersCmd = &cobra.Command{
+	Use:   "watchers",
+	Short: "Lists the clients that have the block images of a pool open",
+}
+
+var (
+	imageNamespace string
+	imagePool      string
+	imageName      string
+	imageLockID    string
+	imageLocker    string
+	imageBlacklist bool
+	imageSelector  string
+	imageOutput    string
+)
+
+const (
+	outputTable     = "table"
+	outputJSONLines = "ndjson"
+)
+
+// imageEntry is an image written on its own line when the images are listed as json lines
+type imageEntry struct {
+	Name   string            `json:"name"`
+	Size   uint64            `json:"size"`
+	Labels map[string]string `json:"labels"`
+}
+
+func init() {
+	imageListCmd.Flags().StringVar(&imageNamespace, "namespace", "rook-ceph", "namespace of the cluster")
+	imageListCmd.Flags().StringVar(&imagePool, "pool", "", "pool of the images")
+	imageListCmd.Flags().StringVar(&imageSelector, "selector", "", "only list the images with matching labels, such as owner=team-a")
+	imageListCmd.Flags().StringVar(&imageOutput, "output", outputTable, "output format, either table or ndjson to write each image as a json object on its own line")
+	for _, cmd := range []*cobra.Command{imageLocksCmd, imageBreakLockCmd, imageWatchersCmd} {
+		cmd.Flags().StringVar(&imageNamespace, "namespace", "rook-ceph", "namespace of the cluster")
+		cmd.Flags().StringVar(&imagePool, "pool", "", "pool of the image")
+		cmd.Flags().StringVar(&imageName, "image", "", "name of the image")
+	}
+	imageBreakLockCmd.Flags().StringVar(&imageLockID, "lock-id", "", "id of the lock to remove")
+	imageBreakLockCmd.Flags().StringVar(&imageLocker, "locker", "", "client holding the lock, such as client.4123")
+	imageBreakLockCmd.Flags().BoolVar(&imageBlacklist, "blacklist", true, "blacklist the client holding the lock so it cannot write to the image anymore")
+	flags.SetFlagsFromEnv(imageListCmd.Flags(), rook.RookEnvVarPrefix)
+	flags.SetFlagsFromEnv(imageLocksCmd.Flags(), rook.RookEnvVarPrefix)
+	flags.SetFlagsFromEnv(imageBreakLockCmd.Flags(), rook.RookEnvVarPrefix)
+	flags.SetFlagsFromEnv(imageWatchersCmd.Flags(), rook.RookEnvVarPrefix)
+
+	imageListCmd.RunE = listImages
+	imageLocksCmd.RunE = listImageLocks
+	imageBreakLockCmd.RunE = breakImageLock
+	imageWatchersCmd.RunE = listImageWatchers
+	imageCmd.AddCommand(imageListCmd)
+	imageCmd.AddCommand(imageLocksCmd)
+	imageCmd.AddCommand(imageBreakLockCmd)
+	imageCmd.AddCommand(imageWatchersCmd)
+}
+
+func listImages(cmd *cobra.Command, args []string) error {
+	if err := flags.VerifyRequiredFlags(cmd, []string{"pool"}); err != nil {
+		return err
+	}
+	selector, err := labels.Parse(imageSelector)
+	if err != nil {
+		return fmt.Errorf("invalid selector %s. %+v", imageSelector, err)
+	}
+	if imageOutput != outputTable && imageOutput != outputJSONLines {
+		return fmt.Errorf("invalid output %s, expected %s or %s", imageOutput, outputTable, outputJSONLines)
+	}
+	rook.SetLogLevel()
+
+	context := createContext()
+	context.ConfigDir = k8sutil.DataDir
+	images, err := client.ListImages(context, imageNamespace, imagePool)
+	if err != nil {
+		return err
+	}
+
+	// with json lines each image is written as soon as its labels are read instead of once the whole pool is listed
+	encoder := json.NewEncoder(os.Stdout)
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	if imageOutput != outputJSONLines {
+		fmt.Fprintln(w, "IMAGE\tSIZE\tLABELS")
+	}
+	for _, image := range images {
+		imageLabels, err := client.GetImageLabels(context, imageNamespace, image.Name, imagePool)
+		if err != nil {
+			return err
+		}
+		if !selector.Matches(labels.Set(imageLabels)) {
+			continue
+		}
+		if imageOutput == outputJSONLines {
+			if err := encoder.Encode(imageEntry{Name: image.Name, Size: image.Size, Labels: imageLabels}); err != nil {
+				return fmt.Errorf("failed to write image %s. %+v", image.Name, err)
+			}
+			continue
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", image.Name, display.BytesToString(image.Size), labels.Set(imageLabels).String())
+	}
+	return w.Flush()
+}
+
+func listImageLocks(cmd *cobra.Command, args []string) error {
+	if err := flags.VerifyRequiredFlags(cmd, []string{"pool", "image"}); err != nil {
+		return err
+	}
+	rook.SetLogLevel()
+
+	context := createContext()
+	context.ConfigDir = k8sutil.DataDir
+	locks, err := client.ListImageLocks(context, imageNamespace, imageName, imagePool)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "LOCK ID\tLOCKER\tADDRESS")
+	for _, lock := range locks {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", lock.ID, lock.Locker, lock.Address)
+	}
+	return w.Flush()
+}
+
+func breakImageLock(cmd *cobra.Command, args []string) error {
+	if err := flags.VerifyRequiredFlags(cmd, []string{"pool", "image", "lock-id", "locker"}); err != nil {
+		return err
+	}
+	rook.SetLogLevel()
+
+	context := createContext()
+	context.ConfigDir = k8sutil.DataDir
+	locks, err := client.ListImageLocks(context, imageNamespace, imageName, imagePool)
+	if err != nil {
+		return err
+	}
+	for _, lock := range locks {
+		if lock.ID != imageLockID || lock.Locker != imageLocker {
+			continue
+		}
+
+		if imageBlacklist {
+			logger.Infof("blacklisting client %s at %s", lock.Locker, lock.Address)
+			if err := client.BlacklistClient(context, imageNamespace, lock.Address); err != nil {
+				return err
+			}
+		}
+		if err := client.BreakImageLock(context, imageNamespace, imageName, imagePool, lock); err != nil {
+			return err
+		}
+		logger.Infof("removed lock %s of %s on image %s/%s", lock.ID, lock.Locker, imagePool, imageName)
+		return nil
+	}
+	return fmt.Errorf("lock %s of %s not found on image %s/%s", imageLockID, imageLocker, imagePool, imageName)
+}
+
+func listImageWatchers(cmd *cobra.Command, args []string) error {
+	if err := flags.VerifyRequiredFlags(cmd, []string{"pool"}); err != nil {
+		return err
+	}
+	rook.SetLogLevel()
+
+	context := createContext()
+	context.ConfigDir = k8sutil.DataDir
+
+	// list the watchers of all the images in the pool if no image is given
+	names := []string{imageName}
+	if imageName == "" {
+		images, err := client.ListImages(context, imageNamespace, imagePool)
+		if err != nil {
+			return err
+		}
+		names = []string{}
+		for _, image := range images {
+			names = append(names, image.Name)
+		}
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "IMAGE\tCLIENT\tADDRESS\tCOOKIE")
+	for _, name := range names {
+		watchers, err := client.ListImageWatchers(context, imageNamespace, name, imagePool)
+		if err != nil {
+			return err
+		}
+		for _, watcher := range watchers {
+			fmt.Fprintf(w, "%s\tclient.%d\t%s\t%d\n", name, watcher.Client, watcher.Address, watcher.Cookie)
+		}
+	}
+	return w.Flush()
+}
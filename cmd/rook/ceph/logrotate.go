@@ -0,0 +1,92 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ceph
+
+import (
+	"os"
+	"time"
+
+	"github.com/rook/rook/cmd/rook/rook"
+	"github.com/rook/rook/pkg/operator/k8sutil"
+	"github.com/rook/rook/pkg/util/flags"
+	"github.com/rook/rook/pkg/util/logrotate"
+	"github.com/spf13/cobra"
+)
+
+var logRotateCmd = &cobra.Command{
+	Use:    "log-rotate",
+	Short:  "Rotates the log file of a daemon by size and reports the log usage of the node",
+	Hidden: true,
+}
+
+var (
+	logRotateFile          string
+	logRotateDir           string
+	logRotateMaxSizeMB     int
+	logRotateMaxFiles      int
+	logRotateCompress      bool
+	logRotateInterval      time.Duration
+	logRotateUsageInterval time.Duration
+)
+
+func init() {
+	logRotateCmd.Flags().StringVar(&logRotateFile, "log-file", "", "path of the log file of the daemon")
+	logRotateCmd.Flags().StringVar(&logRotateDir, "log-dir", "", "directory of the log files of all the daemons on the node")
+	logRotateCmd.Flags().IntVar(&logRotateMaxSizeMB, "max-size-mb", 100, "size in MB at which the log file is rotated")
+	logRotateCmd.Flags().IntVar(&logRotateMaxFiles, "max-files", 5, "number of rotated log files kept")
+	logRotateCmd.Flags().BoolVar(&logRotateCompress, "compress", false, "compress the rotated log files with gzip")
+	logRotateCmd.Flags().DurationVar(&logRotateInterval, "interval", time.Minute, "interval to check the size of the log file (duration)")
+	logRotateCmd.Flags().DurationVar(&logRotateUsageInterval, "usage-interval", time.Hour, "interval to report the log usage of the node (duration)")
+	flags.SetFlagsFromEnv(logRotateCmd.Flags(), rook.RookEnvVarPrefix)
+
+	logRotateCmd.RunE = rotateLogs
+}
+
+func rotateLogs(cmd *cobra.Command, args []string) error {
+	if err := flags.VerifyRequiredFlags(cmd, []string{"log-file", "log-dir"}); err != nil {
+		return err
+	}
+	rook.SetLogLevel()
+	rook.LogStartupInfo(cmd.Flags())
+
+	config := logrotate.Config{
+		MaxSize:  int64(logRotateMaxSizeMB) * 1024 * 1024,
+		MaxFiles: logRotateMaxFiles,
+		Compress: logRotateCompress,
+	}
+	node := os.Getenv(k8sutil.NodeNameEnvVar)
+	lastReport := time.Time{}
+	for {
+		rotated, err := logrotate.Rotate(logRotateFile, config)
+		if err != nil {
+			logger.Errorf("failed to rotate log file %s. %+v", logRotateFile, err)
+		} else if rotated {
+			logger.Infof("rotated log file %s", logRotateFile)
+		}
+
+		if time.Since(lastReport) >= logRotateUsageInterval {
+			usage, err := logrotate.Usage(logRotateDir)
+			if err != nil {
+				logger.Warningf("%+v", err)
+			} else {
+				logger.Infof("log usage of the daemons on node %s is %dMB", node, usage/(1024*1024))
+			}
+			lastReport = time.Now()
+		}
+		<-time.After(logRotateInterval)
+	}
+}
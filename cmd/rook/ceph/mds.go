@@ -30,6 +30,7 @@ var (
 	podName       string
 	filesystemID  string
 	activeStandby bool
+	cacheMemoryMB int
 )
 
 var mdsCmd = &cobra.Command{
@@ -42,6 +43,7 @@ func init() {
 	mdsCmd.Flags().StringVar(&podName, "pod-name", "", "name of the pod from which the mds ID is derived")
 	mdsCmd.Flags().StringVar(&filesystemID, "filesystem-id", "", "ID of the filesystem this MDS will serve")
 	mdsCmd.Flags().BoolVar(&activeStandby, "active-standby", true, "Whether to start in active standby mode")
+	mdsCmd.Flags().IntVar(&cacheMemoryMB, "cache-memory-limit-mb", 0, "memory limit of the metadata cache in MB, or the ceph default if zero")
 	addCephFlags(mdsCmd)
 
 	flags.SetFlagsFromEnv(mdsCmd.Flags(), rook.RookEnvVarPrefix)
@@ -67,10 +69,11 @@ func startMDS(cmd *cobra.Command, args []string) error {
 
 	clusterInfo.Monitors = mon.ParseMonEndpoints(cfg.monEndpoints)
 	config := &mds.Config{
-		FilesystemID:  filesystemID,
-		ID:            id,
-		ActiveStandby: activeStandby,
-		ClusterInfo:   &clusterInfo,
+		FilesystemID:       filesystemID,
+		ID:                 id,
+		ActiveStandby:      activeStandby,
+		CacheMemoryLimitMB: cacheMemoryMB,
+		ClusterInfo:        &clusterInfo,
 	}
 
 	err := mds.Run(createContext(), config)
@@ -34,13 +34,15 @@ var monCmd = &cobra.Command{
 }
 
 var (
-	monName string
-	monPort int32
+	monName    string
+	monPort    int32
+	monLogFile string
 )
 
 func init() {
 	monCmd.Flags().StringVar(&monName, "name", "", "name of the monitor")
 	monCmd.Flags().Int32Var(&monPort, "port", 0, "port of the monitor")
+	monCmd.Flags().StringVar(&monLogFile, "log-file", "", "path of the log file of the monitor, or stdout if not set")
 	addCephFlags(monCmd)
 
 	flags.SetFlagsFromEnv(monCmd.Flags(), rook.RookEnvVarPrefix)
@@ -78,6 +80,7 @@ func startMon(cmd *cobra.Command, args []string) error {
 		Name:    monName,
 		Cluster: &clusterInfo,
 		Port:    monPort,
+		LogFile: monLogFile,
 	}
 	err := mon.Run(createContext(), monCfg)
 	if err != nil {
@@ -0,0 +1,72 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package ceph
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/rook/rook/cmd/rook/rook"
+	"github.com/rook/rook/pkg/operator/ceph/cluster/netcheck"
+	"github.com/rook/rook/pkg/operator/k8sutil"
+	"github.com/rook/rook/pkg/util/flags"
+	"github.com/spf13/cobra"
+)
+
+var networkCheckCmd = &cobra.Command{
+	Use:    "network-check",
+	Short:  "Measures the latency and throughput from this node to the other nodes of the network check",
+	Hidden: true,
+}
+
+var (
+	networkCheckNodes string
+	networkCheckAgent = netcheck.AgentConfig{}
+)
+
+func init() {
+	networkCheckCmd.Flags().StringVar(&networkCheckAgent.Node, "node-name", os.Getenv(k8sutil.NodeNameEnvVar), "the name of this node")
+	networkCheckCmd.Flags().StringVar(&networkCheckNodes, "nodes", "", "comma separated list of all the nodes of the network check")
+	networkCheckCmd.Flags().StringVar(&networkCheckAgent.IP, "public-ip", "", "the IP where the other nodes reach this node")
+	networkCheckCmd.Flags().IntVar(&networkCheckAgent.Port, "port", netcheck.DefaultPort, "the port on which this node answers the other nodes")
+	networkCheckCmd.Flags().IntVar(&networkCheckAgent.Generation, "generation", 0, "the generation of the network check")
+	networkCheckCmd.Flags().IntVar(&networkCheckAgent.SampleSize, "sample-size", 0, "the number of other nodes to measure, or 0 for all of them")
+	networkCheckCmd.Flags().IntVar(&networkCheckAgent.Pings, "pings", 20, "the number of pings to measure the latency")
+	networkCheckCmd.Flags().IntVar(&networkCheckAgent.SizeMB, "size-mb", 64, "the size in MB of the data sent to measure the throughput")
+	flags.SetFlagsFromEnv(networkCheckCmd.Flags(), rook.RookEnvVarPrefix)
+
+	networkCheckCmd.RunE = checkNetwork
+}
+
+func checkNetwork(cmd *cobra.Command, args []string) error {
+	if err := flags.VerifyRequiredFlags(cmd, []string{"node-name", "nodes", "public-ip"}); err != nil {
+		return err
+	}
+	rook.SetLogLevel()
+	rook.LogStartupInfo(cmd.Flags())
+
+	clientset, _, _, err := rook.GetClientset()
+	if err != nil {
+		rook.TerminateFatal(fmt.Errorf("failed to get k8s client. %+v", err))
+	}
+	networkCheckAgent.Namespace = os.Getenv(k8sutil.PodNamespaceEnvVar)
+	networkCheckAgent.Nodes = strings.Split(networkCheckNodes, ",")
+	if err := netcheck.RunAgent(clientset, networkCheckAgent); err != nil {
+		rook.TerminateFatal(fmt.Errorf("failed to check the network. %+v", err))
+	}
+	return nil
+}
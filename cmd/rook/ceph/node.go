@@ -0,0 +1,196 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ceph
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/rook/rook/cmd/rook/rook"
+	cephv1beta1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1beta1"
+	rookalpha "github.com/rook/rook/pkg/apis/rook.io/v1alpha2"
+	"github.com/rook/rook/pkg/operator/ceph/cluster"
+	oposd "github.com/rook/rook/pkg/operator/ceph/cluster/osd"
+	"github.com/rook/rook/pkg/util/flags"
+	"github.com/spf13/cobra"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+var nodeCmd = &cobra.Command{
+	Use:    "node",
+	Short:  "Manages the storage nodes of the cluster",
+	Hidden: true,
+}
+
+var nodeDecommissionCmd = &cobra.Command{
+	Use:   "decommission",
+	Short: "Removes a node from the storage nodes of the cluster CRD, optionally waiting until its osds are removed",
+}
+
+var nodeZapCmd = &cobra.Command{
+	Use:   "zap",
+	Short: "Wipes a device of a node that is not used by an osd, optionally waiting until it is wiped",
+}
+
+var (
+	nodeNamespace string
+	nodeName      string
+	nodeWait      bool
+	nodeTimeout   time.Duration
+	nodeDevice    string
+	nodeZapImage  string
+	// the zap has its own default timeout, since the flags of both commands set the same variables
+	nodeZapTimeout time.Duration
+)
+
+const nodeWaitInterval = 10 * time.Second
+
+func init() {
+	nodeDecommissionCmd.Flags().StringVar(&nodeNamespace, "namespace", "rook-ceph", "namespace of the cluster")
+	nodeDecommissionCmd.Flags().StringVar(&nodeName, "node", "", "name of the node to decommission")
+	nodeDecommissionCmd.Flags().BoolVar(&nodeWait, "wait", false, "wait until the osds of the node are removed and the node is cleaned up")
+	nodeDecommissionCmd.Flags().DurationVar(&nodeTimeout, "timeout", time.Hour, "how long to wait for the node to be decommissioned")
+	flags.SetFlagsFromEnv(nodeDecommissionCmd.Flags(), rook.RookEnvVarPrefix)
+
+	nodeZapCmd.Flags().StringVar(&nodeNamespace, "namespace", "rook-ceph", "namespace of the cluster")
+	nodeZapCmd.Flags().StringVar(&nodeName, "node", "", "name of the node of the device")
+	nodeZapCmd.Flags().StringVar(&nodeDevice, "device", "", "name or persistent id of the device to zap")
+	nodeZapCmd.Flags().StringVar(&nodeZapImage, "image", "", "image of the zap job (the image of the osds by default)")
+	nodeZapCmd.Flags().BoolVar(&nodeWait, "wait", false, "wait until the device is zapped")
+	nodeZapCmd.Flags().DurationVar(&nodeZapTimeout, "timeout", 10*time.Minute, "how long to wait for the device to be zapped")
+	flags.SetFlagsFromEnv(nodeZapCmd.Flags(), rook.RookEnvVarPrefix)
+
+	nodeDecommissionCmd.RunE = decommissionNode
+	nodeZapCmd.RunE = zapNodeDevice
+	nodeCmd.AddCommand(nodeDecommissionCmd)
+	nodeCmd.AddCommand(nodeZapCmd)
+}
+
+func decommissionNode(cmd *cobra.Command, args []string) error {
+	if err := flags.VerifyRequiredFlags(cmd, []string{"node"}); err != nil {
+		return err
+	}
+	rook.SetLogLevel()
+
+	clientset, _, rookClientset, err := rook.GetClientset()
+	if err != nil {
+		return rook.ConnectionError(fmt.Errorf("failed to get k8s client. %+v", err))
+	}
+	clusters, err := rookClientset.CephV1beta1().Clusters(nodeNamespace).List(metav1.ListOptions{})
+	if err != nil {
+		return rook.ServerError(fmt.Errorf("failed to list clusters. %+v", err))
+	}
+	if len(clusters.Items) != 1 {
+		return rook.ValidationError(fmt.Errorf("expected one cluster in namespace %s, found %d", nodeNamespace, len(clusters.Items)))
+	}
+
+	cluster := &clusters.Items[0]
+	if cluster.Spec.Storage.UseAllNodes {
+		return rook.ValidationError(fmt.Errorf("cluster %s uses all nodes. nodes can only be decommissioned when useAllNodes is false", cluster.Name))
+	}
+	nodes := []rookalpha.Node{}
+	for _, n := range cluster.Spec.Storage.Nodes {
+		if n.Name != nodeName {
+			nodes = append(nodes, n)
+		}
+	}
+	if len(nodes) == len(cluster.Spec.Storage.Nodes) {
+		logger.Infof("node %s is not in the storage nodes of cluster %s", nodeName, cluster.Name)
+	} else {
+		cluster.Spec.Storage.Nodes = nodes
+		if _, err := rookClientset.CephV1beta1().Clusters(nodeNamespace).Update(cluster); err != nil {
+			return rook.ServerError(fmt.Errorf("failed to remove node %s from cluster %s. %+v", nodeName, cluster.Name, err))
+		}
+		logger.Infof("removed node %s from cluster %s", nodeName, cluster.Name)
+	}
+	if !nodeWait {
+		return nil
+	}
+
+	context := createContext()
+	context.Clientset = clientset
+	err = wait.Poll(nodeWaitInterval, nodeTimeout, func() (bool, error) {
+		complete, err := oposd.NodeRemovalComplete(context, nodeNamespace, nodeName)
+		if err != nil {
+			logger.Warningf("failed to check the removal of node %s, retrying. %+v", nodeName, err)
+			return false, nil
+		}
+		return complete, nil
+	})
+	if err != nil {
+		return rook.TimeoutError(fmt.Errorf("node %s was not decommissioned after %s. see the operator log for the reason", nodeName, nodeTimeout))
+	}
+	logger.Infof("node %s is decommissioned", nodeName)
+	return nil
+}
+
+func zapNodeDevice(cmd *cobra.Command, args []string) error {
+	if err := flags.VerifyRequiredFlags(cmd, []string{"node", "device"}); err != nil {
+		return err
+	}
+	rook.SetLogLevel()
+
+	clientset, _, rookClientset, err := rook.GetClientset()
+	if err != nil {
+		return rook.ConnectionError(fmt.Errorf("failed to get k8s client. %+v", err))
+	}
+	clusters, err := rookClientset.CephV1beta1().Clusters(nodeNamespace).List(metav1.ListOptions{})
+	if err != nil {
+		return rook.ServerError(fmt.Errorf("failed to list clusters. %+v", err))
+	}
+	if len(clusters.Items) != 1 {
+		return rook.ValidationError(fmt.Errorf("expected one cluster in namespace %s, found %d", nodeNamespace, len(clusters.Items)))
+	}
+
+	c := &clusters.Items[0]
+	context := createContext()
+	context.Clientset = clientset
+	image := nodeZapImage
+	if image == "" {
+		if image, err = oposd.OSDImage(context, nodeNamespace); err != nil {
+			return rook.ValidationError(fmt.Errorf("failed to find the image of the zap job, set it with --image. %+v", err))
+		}
+	}
+	settings := oposd.ZapSettings{
+		Image:          image,
+		ServiceAccount: c.Spec.ServiceAccount,
+		Placement:      cephv1beta1.GetOSDPlacement(c.Spec.Placement),
+		OwnerRef:       cluster.ClusterOwnerRef(nodeNamespace, string(c.UID)),
+	}
+	if err := oposd.StartZap(context, nodeNamespace, nodeName, nodeDevice, settings); err != nil {
+		return rook.ServerError(err)
+	}
+	if !nodeWait {
+		return nil
+	}
+
+	err = wait.Poll(nodeWaitInterval, nodeZapTimeout, func() (bool, error) {
+		complete, err := oposd.ZapComplete(context, nodeNamespace, nodeName)
+		if err != nil {
+			return false, err
+		}
+		return complete, nil
+	})
+	if err == wait.ErrWaitTimeout {
+		return rook.TimeoutError(fmt.Errorf("device %s of node %s was not zapped after %s", nodeDevice, nodeName, nodeZapTimeout))
+	} else if err != nil {
+		return rook.ServerError(err)
+	}
+	logger.Infof("device %s of node %s is zapped", nodeDevice, nodeName)
+	return nil
+}
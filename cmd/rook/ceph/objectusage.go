@@ -0,0 +1,98 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ceph
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/rook/rook/cmd/rook/rook"
+	"github.com/rook/rook/pkg/daemon/ceph/rgw"
+	"github.com/rook/rook/pkg/operator/k8sutil"
+	"github.com/rook/rook/pkg/util/flags"
+	"github.com/spf13/cobra"
+)
+
+var objectUsageCmd = &cobra.Command{
+	Use:    "object-usage",
+	Short:  "Prints the usage of an object store by each user and bucket over a time range",
+	Hidden: true,
+}
+
+var (
+	objectUsageNamespace string
+	objectUsageStore     string
+	objectUsageStart     string
+	objectUsageEnd       string
+	objectUsageUserID    string
+)
+
+func init() {
+	objectUsageCmd.Flags().StringVar(&objectUsageNamespace, "namespace", "rook-ceph", "namespace of the cluster")
+	objectUsageCmd.Flags().StringVar(&objectUsageStore, "store", "", "name of the object store")
+	objectUsageCmd.Flags().StringVar(&objectUsageStart, "start", "", "start of the range, such as 2018-06-01 or 2018-06-01T08:00:00Z. all the usage log if not set")
+	objectUsageCmd.Flags().StringVar(&objectUsageEnd, "end", "", "end of the range, such as 2018-07-01 or 2018-07-01T08:00:00Z. until now if not set")
+	objectUsageCmd.Flags().StringVar(&objectUsageUserID, "uid", "", "only print the usage of this user")
+	flags.SetFlagsFromEnv(objectUsageCmd.Flags(), rook.RookEnvVarPrefix)
+
+	objectUsageCmd.RunE = printObjectUsage
+}
+
+// parseUsageTime parses a date or a RFC3339 time. An empty value is the zero time.
+func parseUsageTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %s. must be a date or a RFC3339 time", value)
+	}
+	return t, nil
+}
+
+func printObjectUsage(cmd *cobra.Command, args []string) error {
+	if err := flags.VerifyRequiredFlags(cmd, []string{"store"}); err != nil {
+		return err
+	}
+	rook.SetLogLevel()
+
+	start, err := parseUsageTime(objectUsageStart)
+	if err != nil {
+		return err
+	}
+	end, err := parseUsageTime(objectUsageEnd)
+	if err != nil {
+		return err
+	}
+
+	context := createContext()
+	context.ConfigDir = k8sutil.DataDir
+	usage, err := rgw.GetUsage(rgw.NewContext(context, objectUsageStore, objectUsageNamespace), start, end, objectUsageUserID)
+	if err != nil {
+		return err
+	}
+	output, err := json.MarshalIndent(usage, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal the usage. %+v", err)
+	}
+	fmt.Println(string(output))
+	return nil
+}
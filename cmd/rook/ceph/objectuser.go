@@ -0,0 +1,122 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ceph
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/rook/rook/cmd/rook/rook"
+	"github.com/rook/rook/pkg/daemon/ceph/rgw"
+	"github.com/rook/rook/pkg/operator/k8sutil"
+	"github.com/rook/rook/pkg/util/flags"
+	"github.com/spf13/cobra"
+)
+
+var objectUserCmd = &cobra.Command{
+	Use:    "object-user",
+	Short:  "Manages the users of an object store",
+	Hidden: true,
+}
+
+var objectUserCreateCmd = &cobra.Command{
+	Use:   "create",
+	Short: "Creates a user of an object store and prints its s3 and swift credentials",
+}
+
+var objectUserGetCmd = &cobra.Command{
+	Use:   "get",
+	Short: "Prints a user of an object store with its s3 and swift credentials",
+}
+
+var (
+	objectUserNamespace   string
+	objectUserStore       string
+	objectUserID          string
+	objectUserDisplayName string
+	objectUserEmail       string
+	objectUserSwift       bool
+)
+
+func init() {
+	for _, cmd := range []*cobra.Command{objectUserCreateCmd, objectUserGetCmd} {
+		cmd.Flags().StringVar(&objectUserNamespace, "namespace", "rook-ceph", "namespace of the cluster")
+		cmd.Flags().StringVar(&objectUserStore, "store", "", "name of the object store")
+		cmd.Flags().StringVar(&objectUserID, "uid", "", "id of the user")
+	}
+	objectUserCreateCmd.Flags().StringVar(&objectUserDisplayName, "display-name", "", "display name of the user")
+	objectUserCreateCmd.Flags().StringVar(&objectUserEmail, "email", "", "email of the user")
+	objectUserCreateCmd.Flags().BoolVar(&objectUserSwift, "swift", false, "also create a swift subuser and key for the clients that only support the swift api")
+	flags.SetFlagsFromEnv(objectUserCreateCmd.Flags(), rook.RookEnvVarPrefix)
+	flags.SetFlagsFromEnv(objectUserGetCmd.Flags(), rook.RookEnvVarPrefix)
+
+	objectUserCreateCmd.RunE = createObjectUser
+	objectUserGetCmd.RunE = getObjectUser
+	objectUserCmd.AddCommand(objectUserCreateCmd)
+	objectUserCmd.AddCommand(objectUserGetCmd)
+}
+
+func objectUserContext() *rgw.Context {
+	context := createContext()
+	context.ConfigDir = k8sutil.DataDir
+	return rgw.NewContext(context, objectUserStore, objectUserNamespace)
+}
+
+func createObjectUser(cmd *cobra.Command, args []string) error {
+	if err := flags.VerifyRequiredFlags(cmd, []string{"store", "uid", "display-name"}); err != nil {
+		return err
+	}
+	rook.SetLogLevel()
+
+	c := objectUserContext()
+	user := rgw.ObjectUser{UserID: objectUserID, DisplayName: &objectUserDisplayName}
+	if objectUserEmail != "" {
+		user.Email = &objectUserEmail
+	}
+	created, _, err := rgw.CreateUser(c, user)
+	if err != nil {
+		return err
+	}
+	if objectUserSwift {
+		if created, _, err = rgw.CreateSwiftKey(c, objectUserID); err != nil {
+			return err
+		}
+	}
+	return printObjectUser(created)
+}
+
+func getObjectUser(cmd *cobra.Command, args []string) error {
+	if err := flags.VerifyRequiredFlags(cmd, []string{"store", "uid"}); err != nil {
+		return err
+	}
+	rook.SetLogLevel()
+
+	user, _, err := rgw.GetUser(objectUserContext(), objectUserID)
+	if err != nil {
+		return err
+	}
+	return printObjectUser(user)
+}
+
+func printObjectUser(user *rgw.ObjectUser) error {
+	output, err := json.MarshalIndent(user, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal user %s. %+v", user.UserID, err)
+	}
+	fmt.Println(string(output))
+	return nil
+}
@@ -22,14 +22,53 @@ import (
 	"github.com/rook/rook/pkg/clusterd"
 	"github.com/rook/rook/pkg/daemon/ceph/agent/flexvolume/attachment"
 	"github.com/rook/rook/pkg/operator/ceph"
+	"github.com/rook/rook/pkg/operator/ceph/cluster"
+	"github.com/rook/rook/pkg/operator/ceph/cluster/crash"
 	"github.com/rook/rook/pkg/operator/ceph/cluster/mon"
+	oposd "github.com/rook/rook/pkg/operator/ceph/cluster/osd"
+	"github.com/rook/rook/pkg/operator/ceph/cluster/scrub"
+	"github.com/rook/rook/pkg/operator/ceph/pool"
+	"github.com/rook/rook/pkg/operator/ceph/settings"
 	"github.com/rook/rook/pkg/operator/k8sutil"
 	"github.com/rook/rook/pkg/util/flags"
+	"github.com/rook/rook/pkg/util/metrics"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 )
 
 const containerName = "rook-ceph-operator"
 
+// the flags of the operator that can be changed at runtime in the settings config map, with their validation
+var runtimeSettings = map[string]func(value string) error{
+	"mon-healthcheck-interval": settings.PositiveDuration,
+	"mon-out-timeout":          settings.PositiveDuration,
+	"orphan-check-interval":    settings.PositiveDuration,
+	"orphan-cleanup":           nil,
+	"restart-check-interval":   settings.PositiveDuration,
+	"restart-health-timeout":   settings.PositiveDuration,
+	"recovery-check-interval":  settings.PositiveDuration,
+	"trash-purge-interval":     settings.PositiveDuration,
+	"image-delete-interval":    settings.PositiveDuration,
+	"image-delete-concurrency": nil,
+	"image-delete-rate":        nil,
+	"crash-check-interval":     settings.PositiveDuration,
+	"pool-delete-delay":        settings.NonNegativeDuration,
+	"pool-delete-confirmation": nil,
+	"pg-advisor-interval":      settings.PositiveDuration,
+	"pg-auto-apply":            nil,
+	"osd-provision-timeout":    settings.PositiveDuration,
+	"osd-flap-threshold":       nil,
+	"osd-flap-window":          settings.PositiveDuration,
+	"osd-latency-interval":     settings.PositiveDuration,
+	"osd-weight-in-interval":   settings.PositiveDuration,
+	"osd-weight-in-step":       settings.Ratio,
+	"osd-weight-in-recovery":   settings.Ratio,
+	"osd-spare-timeout":        settings.NonNegativeDuration,
+	"scrub-check-interval":     settings.PositiveDuration,
+	"scrub-error-threshold":    nil,
+	"scrub-error-window":       settings.PositiveDuration,
+}
+
 var operatorCmd = &cobra.Command{
 	Use:   "operator",
 	Short: "Runs the Ceph operator for orchestrating and managing Ceph storage in a Kubernetes cluster",
@@ -39,18 +78,66 @@ https://github.com/rook/rook`,
 }
 
 func init() {
-	operatorCmd.Flags().DurationVar(&mon.HealthCheckInterval, "mon-healthcheck-interval", mon.HealthCheckInterval, "mon health check interval (duration)")
-	operatorCmd.Flags().DurationVar(&mon.MonOutTimeout, "mon-out-timeout", mon.MonOutTimeout, "mon out timeout (duration)")
+	operatorCmd.Flags().Var(mon.HealthCheckInterval, "mon-healthcheck-interval", "mon health check interval (duration)")
+	operatorCmd.Flags().Var(mon.MonOutTimeout, "mon-out-timeout", "mon out timeout (duration)")
+	operatorCmd.Flags().Var(pool.OrphanCheckInterval, "orphan-check-interval", "interval to look for resources left behind by deleted pools (duration)")
+	boolSettingVar(operatorCmd.Flags(), pool.OrphanCleanup, "orphan-cleanup", "delete the resources left behind by deleted pools instead of only reporting them")
+	operatorCmd.Flags().Var(cluster.RestartCheckInterval, "restart-check-interval", "interval to check if the daemons need a rolling restart (duration)")
+	operatorCmd.Flags().Var(cluster.RestartHealthTimeout, "restart-health-timeout", "time to wait for the cluster to be healthy after a daemon is restarted (duration)")
+	operatorCmd.Flags().Var(cluster.RecoveryCheckInterval, "recovery-check-interval", "interval to apply the recovery profile to the osds and to report the rebalance progress (duration)")
+	operatorCmd.Flags().Var(pool.TrashPurgeInterval, "trash-purge-interval", "interval to delete the expired images from the trash of the pools (duration)")
+	operatorCmd.Flags().Var(pool.ImageDeletionInterval, "image-delete-interval", "interval to look for queued images to delete (duration)")
+	operatorCmd.Flags().Var(pool.ImageDeletionConcurrency, "image-delete-concurrency", "objects of an image that are deleted at the same time. the rbd default if 0")
+	operatorCmd.Flags().Var(pool.ImageDeletionRate, "image-delete-rate", "average objects per second the queued images are deleted at. not limited if 0")
+	operatorCmd.Flags().DurationVar(&pool.ImageAllocationInterval, "image-allocate-interval", pool.ImageAllocationInterval, "interval to look for queued thick provisioned images to allocate (duration)")
+	operatorCmd.Flags().IntVar(&pool.ImageAllocationRate, "image-allocate-rate", pool.ImageAllocationRate, "objects per second each queued image is allocated at. not limited if 0")
+	operatorCmd.Flags().IntVar(&pool.ImageAllocationConcurrency, "image-allocate-concurrency", pool.ImageAllocationConcurrency, "queued images that are allocated at the same time")
+	operatorCmd.Flags().Var(crash.CheckInterval, "crash-check-interval", "interval to check the daemons for crashes (duration)")
+	operatorCmd.Flags().Var(pool.DeleteDelay, "pool-delete-delay", "time to keep a pool after its crd is deleted before deleting it (duration)")
+	boolSettingVar(operatorCmd.Flags(), pool.DeleteConfirmation, "pool-delete-confirmation", "only delete a pool with its crd if the deletion was confirmed with a token")
+	operatorCmd.Flags().Var(pool.PGAdvisorInterval, "pg-advisor-interval", "interval to compare the pg counts of the pools with their share of the data (duration)")
+	boolSettingVar(operatorCmd.Flags(), pool.PGAutoApply, "pg-auto-apply", "grow the pgs of the pools towards the counts recommended by the pg advisor")
+	operatorCmd.Flags().Var(oposd.ProvisionTimeout, "osd-provision-timeout", "time the osds may take to be provisioned on a node before the provisioning of the node fails (duration)")
+	operatorCmd.Flags().Var(oposd.FlapThreshold, "osd-flap-threshold", "times an osd may be marked up again within the flap window before it is quarantined. never quarantined if 0")
+	operatorCmd.Flags().Var(oposd.FlapWindow, "osd-flap-window", "time in which the flaps of an osd are counted (duration)")
+	operatorCmd.Flags().IntVar(&oposd.MaxQuarantinedOSDs, "osd-max-quarantined", oposd.MaxQuarantinedOSDs, "osds that may be quarantined at the same time in a cluster")
+	operatorCmd.Flags().IntVar(&oposd.MaxQuarantinedOSDsPerHost, "osd-max-quarantined-per-host", oposd.MaxQuarantinedOSDsPerHost, "osds that may be quarantined at the same time on a host")
+	operatorCmd.Flags().Var(oposd.LatencyCheckInterval, "osd-latency-interval", "interval to sample the latencies of the osds to find the slow osds (duration)")
+	operatorCmd.Flags().Var(oposd.WeightInInterval, "osd-weight-in-interval", "interval to move the crush weights of the osds a step towards their target weights (duration)")
+	operatorCmd.Flags().Var(oposd.WeightInStep, "osd-weight-in-step", "share of the target weight that the crush weight of an osd is moved by at each step")
+	operatorCmd.Flags().Var(oposd.WeightInMaxRecovery, "osd-weight-in-recovery", "ratio of degraded and misplaced objects above which the crush weights of the osds are not moved")
+	operatorCmd.Flags().Var(oposd.SpareReplaceTimeout, "osd-spare-timeout", "time an osd must be down before it is replaced with a spare device. never replaced if 0 (duration)")
+	operatorCmd.Flags().Var(scrub.CheckInterval, "scrub-check-interval", "interval to add the scrubs of the pgs to the scrub history (duration)")
+	operatorCmd.Flags().Var(scrub.RecurringThreshold, "scrub-error-threshold", "scrubs that must find errors on an osd within the scrub error window to raise an alert for the osd. no alerts if 0")
+	operatorCmd.Flags().Var(scrub.RecurringWindow, "scrub-error-window", "time in which the scrubs that found errors on an osd are counted (duration)")
+	operatorCmd.Flags().DurationVar(&settings.CheckInterval, "settings-check-interval", settings.CheckInterval, "interval to apply the settings of the settings config map again, in addition to applying their changes (duration)")
+	flags.StringSliceVar(operatorCmd.Flags(), &k8sutil.SupportedArchitectures, "node-architectures", k8sutil.SupportedArchitectures, "architectures of the nodes the mons and osds can be placed on, which the rook and ceph images must be built for")
+	addMetricsFlags(operatorCmd, "operator")
 	flags.SetFlagsFromEnv(operatorCmd.Flags(), rook.RookEnvVarPrefix)
 
 	operatorCmd.RunE = startOperator
 }
 
+// boolSettingVar adds the flag of a boolean setting, which is enabled without a value like the other boolean flags
+func boolSettingVar(flagSet *pflag.FlagSet, value *settings.Bool, name, usage string) {
+	flagSet.Var(value, name, usage)
+	flagSet.Lookup(name).NoOptDefVal = "true"
+}
+
 func startOperator(cmd *cobra.Command, args []string) error {
 
 	rook.SetLogLevel()
 
 	rook.LogStartupInfo(operatorCmd.Flags())
+	if err := metrics.VerifyCORS(); err != nil {
+		rook.TerminateFatal(err)
+	}
+	k8sutil.RegisterRequestMetrics()
+	metricsServer, err := metrics.Serve(metricsPort)
+	if err != nil {
+		rook.TerminateFatal(err)
+	}
+	defer metricsServer.Stop()
 
 	clientset, apiExtClientset, rookClientset, err := rook.GetClientset()
 	if err != nil {
@@ -80,7 +167,14 @@ func startOperator(cmd *cobra.Command, args []string) error {
 		rook.TerminateFatal(fmt.Errorf("failed to get container image. %+v\n", err))
 	}
 
-	op := operator.New(context, volumeAttachment, rookImage, pod.Spec.ServiceAccountName)
+	registry := settings.NewRegistry(context)
+	for name, validate := range runtimeSettings {
+		if err := registry.Register(operatorCmd.Flags(), name, validate); err != nil {
+			rook.TerminateFatal(fmt.Errorf("failed to register setting. %+v", err))
+		}
+	}
+
+	op := operator.New(context, volumeAttachment, rookImage, pod.Spec.ServiceAccountName, registry)
 	err = op.Run()
 	if err != nil {
 		rook.TerminateFatal(fmt.Errorf("failed to run operator. %+v\n", err))
@@ -16,11 +16,13 @@ limitations under the License.
 package ceph
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
 	"strings"
 
 	"github.com/rook/rook/cmd/rook/rook"
+	rookalpha "github.com/rook/rook/pkg/apis/rook.io/v1alpha2"
 	"github.com/rook/rook/pkg/daemon/ceph/client"
 	"github.com/rook/rook/pkg/daemon/ceph/mon"
 	"github.com/rook/rook/pkg/daemon/ceph/osd"
@@ -53,12 +55,27 @@ var filestoreDeviceCmd = &cobra.Command{
 	Short:  "Runs the ceph daemon for a filestore device",
 	Hidden: true,
 }
+var osdRunCmd = &cobra.Command{
+	Use:    "run",
+	Short:  "Runs the ceph daemon of an osd to forward its output with the logs",
+	Hidden: true,
+}
+var osdZapCmd = &cobra.Command{
+	Use:    "zap",
+	Short:  "Wipes a device of the node that is not used by an osd",
+	Hidden: true,
+}
 var (
+	zapDeviceID         string
 	osdDataDeviceFilter string
+	osdDeviceAttributes string
 	ownerRefID          string
 	mountSourcePath     string
 	mountPath           string
+	mountFSType         string
+	mountOptions        string
 	osdID               int
+	osdLogDir           string
 )
 
 func addOSDFlags(command *cobra.Command) {
@@ -68,22 +85,35 @@ func addOSDFlags(command *cobra.Command) {
 	// flags specific to provisioning
 	provisionCmd.Flags().StringVar(&cfg.devices, "data-devices", "", "comma separated list of devices to use for storage")
 	provisionCmd.Flags().StringVar(&osdDataDeviceFilter, "data-device-filter", "", "a regex filter for the device names to use, or \"all\"")
+	provisionCmd.Flags().StringVar(&osdDeviceAttributes, "data-device-attributes", "",
+		"the json attributes that the devices selected by the device filter must also match, such as {\"rotational\":true}")
 	provisionCmd.Flags().StringVar(&cfg.directories, "data-directories", "", "comma separated list of directory paths to use for storage")
 	provisionCmd.Flags().StringVar(&cfg.metadataDevice, "metadata-device", "", "device to use for metadata (e.g. a high performance SSD/NVMe device)")
+	provisionCmd.Flags().StringVar(&cfg.protectedOverride, "protected-devices-override", "",
+		"comma separated list of devices to use even though they have a mounted filesystem, such as the boot disk.  BE CAREFUL!")
 	provisionCmd.Flags().BoolVar(&cfg.forceFormat, "force-format", false,
 		"true to force the format of any specified devices, even if they already have a filesystem.  BE CAREFUL!")
 
 	// flags for generating the osd config file
 	osdConfigCmd.Flags().IntVar(&osdID, "osd-id", -1, "osd id for which to generate config")
+	osdConfigCmd.Flags().StringVar(&osdLogDir, "log-dir", "", "the directory of the osd log file, which is created if the osd logs to a file")
 
 	// flags for running filestore on a device
 	filestoreDeviceCmd.Flags().StringVar(&mountSourcePath, "source-path", "", "the source path of the device to mount")
 	filestoreDeviceCmd.Flags().StringVar(&mountPath, "mount-path", "", "the path where the device should be mounted")
+	filestoreDeviceCmd.Flags().StringVar(&mountFSType, "fs-type", "", "the filesystem of the device, detected by mount if empty")
+	filestoreDeviceCmd.Flags().StringVar(&mountOptions, "mount-options", "", "the comma-separated options to mount the device with")
+
+	// flags for zapping a device
+	osdZapCmd.Flags().StringVar(&zapDeviceID, "device", "", "name or persistent id of the device to zap")
+	osdZapCmd.Flags().StringVar(&cfg.nodeName, "node-name", os.Getenv("HOSTNAME"), "the host name of the node")
 
 	// add the subcommands to the parent osd command
 	osdCmd.AddCommand(osdConfigCmd)
 	osdCmd.AddCommand(provisionCmd)
 	osdCmd.AddCommand(filestoreDeviceCmd)
+	osdCmd.AddCommand(osdRunCmd)
+	osdCmd.AddCommand(osdZapCmd)
 }
 
 func addOSDConfigFlags(command *cobra.Command) {
@@ -96,6 +126,13 @@ func addOSDConfigFlags(command *cobra.Command) {
 	command.Flags().IntVar(&cfg.storeConfig.DatabaseSizeMB, "osd-database-size", osdcfg.DBDefaultSizeMB, "default size (MB) for OSD database (bluestore)")
 	command.Flags().IntVar(&cfg.storeConfig.JournalSizeMB, "osd-journal-size", osdcfg.JournalDefaultSizeMB, "default size (MB) for OSD journal (filestore)")
 	command.Flags().StringVar(&cfg.storeConfig.StoreType, "osd-store", "", "type of backing OSD store to use (bluestore or filestore)")
+	command.Flags().BoolVar(&cfg.storeConfig.AdoptExisting, "osd-adopt", false, "adopt existing OSDs of the cluster found in the data directories")
+	command.Flags().BoolVar(&cfg.storeConfig.ReplaceSwapped, "osd-replace-swapped", false, "replace the OSDs of devices that were swapped in place with new OSDs")
+	command.Flags().Float64Var(&cfg.storeConfig.CrushWeight, "osd-crush-weight", 0, "crush weight of new OSDs instead of their size in TiB")
+	command.Flags().BoolVar(&cfg.storeConfig.GradualWeightIn, "osd-gradual-weight-in", false, "add new OSDs with a zero crush weight that the operator raises to the target weight in steps")
+	command.Flags().StringVar(&cfg.storeConfig.FilestoreFilesystem, "osd-filestore-fs", "", "filesystem created on the devices of new filestore OSDs (ext4, xfs or btrfs)")
+	command.Flags().StringVar(&cfg.storeConfig.FilestoreMkfsOptions, "osd-filestore-mkfs-options", "", "space-separated options of mkfs for the devices of new filestore OSDs")
+	command.Flags().StringVar(&cfg.storeConfig.FilestoreMountOptions, "osd-filestore-mount-options", "", "comma-separated options of mount for the devices of new filestore OSDs")
 }
 
 func init() {
@@ -105,10 +142,38 @@ func init() {
 	flags.SetFlagsFromEnv(osdConfigCmd.Flags(), rook.RookEnvVarPrefix)
 	flags.SetFlagsFromEnv(provisionCmd.Flags(), rook.RookEnvVarPrefix)
 	flags.SetFlagsFromEnv(filestoreDeviceCmd.Flags(), rook.RookEnvVarPrefix)
+	flags.SetFlagsFromEnv(osdRunCmd.Flags(), rook.RookEnvVarPrefix)
+	flags.SetFlagsFromEnv(osdZapCmd.Flags(), rook.RookEnvVarPrefix)
 
 	osdConfigCmd.RunE = writeOSDConfig
 	provisionCmd.RunE = prepareOSD
 	filestoreDeviceCmd.RunE = runFilestoreDeviceOSD
+	osdRunCmd.RunE = runOSD
+	osdZapCmd.RunE = zapOSDDevice
+}
+
+// Zap a device that is not used by an osd so it can be provisioned again
+func zapOSDDevice(cmd *cobra.Command, args []string) error {
+	if err := flags.VerifyRequiredFlags(osdZapCmd, []string{"device", "node-name"}); err != nil {
+		return err
+	}
+	if err := flags.VerifyRequiredFlags(osdCmd, []string{"cluster-name", "mon-endpoints", "admin-secret"}); err != nil {
+		return err
+	}
+	commonOSDInit(osdZapCmd)
+
+	clientset, _, _, err := rook.GetClientset()
+	if err != nil {
+		rook.TerminateFatal(fmt.Errorf("failed to init k8s client. %+v\n", err))
+	}
+
+	context := createContext()
+	context.Clientset = clientset
+	kv := k8sutil.NewConfigMapKVStore(clusterInfo.Name, clientset, metav1.OwnerReference{})
+	if err := osd.ZapDevice(context, &clusterInfo, kv, cfg.nodeName, zapDeviceID); err != nil {
+		rook.TerminateFatal(err)
+	}
+	return nil
 }
 
 // Start the osd daemon for filestore running on a device
@@ -126,13 +191,29 @@ func runFilestoreDeviceOSD(cmd *cobra.Command, args []string) error {
 	commonOSDInit(filestoreDeviceCmd)
 
 	context := createContext()
-	err := osd.RunFilestoreOnDevice(context, mountSourcePath, mountPath, args)
+	err := osd.RunFilestoreOnDevice(context, mountSourcePath, mountPath, mountFSType, mountOptions, args)
 	if err != nil {
 		rook.TerminateFatal(err)
 	}
 	return nil
 }
 
+// Start the osd daemon with the args after --
+func runOSD(cmd *cobra.Command, args []string) error {
+	args = append(args, []string{
+		fmt.Sprintf("--public-addr=%s", cfg.NetworkInfo().PublicAddr),
+		fmt.Sprintf("--cluster-addr=%s", cfg.NetworkInfo().ClusterAddr),
+	}...)
+
+	commonOSDInit(osdRunCmd)
+
+	context := createContext()
+	if err := osd.Run(context, args); err != nil {
+		rook.TerminateFatal(err)
+	}
+	return nil
+}
+
 func verifyConfigFlags(configCmd *cobra.Command) error {
 	required := []string{"cluster-id", "node-name"}
 	if err := flags.VerifyRequiredFlags(configCmd, required); err != nil {
@@ -166,6 +247,11 @@ func writeOSDConfig(cmd *cobra.Command, args []string) error {
 		rook.TerminateFatal(fmt.Errorf("invalid location %s. %+v\n", cfg.location, err))
 	}
 	crushLocation := strings.Join(locArgs, " ")
+	if osdLogDir != "" {
+		if err := os.MkdirAll(osdLogDir, 0744); err != nil {
+			logger.Warningf("failed to create osd log dir %s. %+v", osdLogDir, err)
+		}
+	}
 	kv := k8sutil.NewConfigMapKVStore(clusterInfo.Name, clientset, metav1.OwnerReference{})
 
 	if err := osd.WriteConfigFile(context, &clusterInfo, kv, osdID, cfg.storeConfig, cfg.nodeName, crushLocation); err != nil {
@@ -196,6 +282,13 @@ func prepareOSD(cmd *cobra.Command, args []string) error {
 	} else {
 		dataDevices = cfg.devices
 	}
+	var attributes *rookalpha.DeviceAttributes
+	if osdDeviceAttributes != "" {
+		attributes = &rookalpha.DeviceAttributes{}
+		if err := json.Unmarshal([]byte(osdDeviceAttributes), attributes); err != nil {
+			return fmt.Errorf("invalid device attributes %s. %+v", osdDeviceAttributes, err)
+		}
+	}
 
 	clientset, _, rookClientset, err := rook.GetClientset()
 	if err != nil {
@@ -216,7 +309,7 @@ func prepareOSD(cmd *cobra.Command, args []string) error {
 	forceFormat := false
 	ownerRef := cluster.ClusterOwnerRef(clusterInfo.Name, ownerRefID)
 	kv := k8sutil.NewConfigMapKVStore(clusterInfo.Name, clientset, ownerRef)
-	agent := osd.NewAgent(context, dataDevices, usingDeviceFilter, cfg.metadataDevice, cfg.directories, forceFormat,
+	agent := osd.NewAgent(context, dataDevices, usingDeviceFilter, attributes, cfg.metadataDevice, cfg.directories, cfg.protectedOverride, forceFormat,
 		crushLocation, cfg.storeConfig, &clusterInfo, cfg.nodeName, kv)
 
 	err = osd.Provision(context, agent)
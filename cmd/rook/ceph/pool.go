@@ -0,0 +1,243 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ceph
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/rook/rook/cmd/rook/rook"
+	cephv1beta1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1beta1"
+	"github.com/rook/rook/pkg/daemon/ceph/client"
+	"github.com/rook/rook/pkg/operator/ceph/pool"
+	"github.com/rook/rook/pkg/operator/k8sutil"
+	"github.com/rook/rook/pkg/util/display"
+	"github.com/rook/rook/pkg/util/flags"
+	"github.com/spf13/cobra"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+var poolCmd = &cobra.Command{
+	Use:    "pool",
+	Short:  "Manages the data of Ceph pools",
+	Hidden: true,
+}
+
+var poolCreateCmd = &cobra.Command{
+	Use:   "create",
+	Short: "Creates a pool CRD for the operator to create the pool, optionally waiting until the pool is created",
+}
+
+var poolMigrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Migrates the block images of a pool to another pool",
+}
+
+var poolOrphansCmd = &cobra.Command{
+	Use:   "orphans",
+	Short: "Lists the resources left behind by deleted pools",
+}
+
+var poolUsageCmd = &cobra.Command{
+	Use:   "du",
+	Short: "Lists the provisioned and used space of the block images of a pool",
+}
+
+var (
+	poolNamespace     string
+	poolSource        string
+	poolTarget        string
+	poolDataPool      string
+	poolOrphansDelete bool
+	poolName          string
+
+	poolFailureDomain string
+	poolReplicas      uint
+	poolDataChunks    uint
+	poolCodingChunks  uint
+	poolWait          bool
+	poolTimeout       time.Duration
+)
+
+const poolWaitInterval = 5 * time.Second
+
+func init() {
+	poolCreateCmd.Flags().StringVar(&poolNamespace, "namespace", "rook-ceph", "namespace of the cluster")
+	poolCreateCmd.Flags().StringVar(&poolName, "pool", "", "name of the pool")
+	poolCreateCmd.Flags().StringVar(&poolFailureDomain, "failure-domain", "host", "failure domain of the pool")
+	poolCreateCmd.Flags().UintVar(&poolReplicas, "replicas", 0, "number of replicas of a replicated pool")
+	poolCreateCmd.Flags().UintVar(&poolDataChunks, "data-chunks", 0, "number of data chunks of an erasure coded pool")
+	poolCreateCmd.Flags().UintVar(&poolCodingChunks, "coding-chunks", 0, "number of coding chunks of an erasure coded pool")
+	poolCreateCmd.Flags().BoolVar(&poolWait, "wait", false, "wait until the operator created the pool")
+	poolCreateCmd.Flags().DurationVar(&poolTimeout, "timeout", 10*time.Minute, "how long to wait for the pool to be created")
+	flags.SetFlagsFromEnv(poolCreateCmd.Flags(), rook.RookEnvVarPrefix)
+
+	poolCreateCmd.RunE = createPool
+	poolCmd.AddCommand(poolCreateCmd)
+
+	poolMigrateCmd.Flags().StringVar(&poolNamespace, "namespace", "rook-ceph", "namespace of the cluster")
+	poolMigrateCmd.Flags().StringVar(&poolSource, "source", "", "pool to migrate the images from")
+	poolMigrateCmd.Flags().StringVar(&poolTarget, "target", "", "pool to migrate the images to")
+	poolMigrateCmd.Flags().StringVar(&poolDataPool, "data-pool", "", "pool to store the data of the migrated images, such as an erasure coded pool")
+	flags.SetFlagsFromEnv(poolMigrateCmd.Flags(), rook.RookEnvVarPrefix)
+
+	poolMigrateCmd.RunE = migratePool
+	poolCmd.AddCommand(poolMigrateCmd)
+
+	poolOrphansCmd.Flags().StringVar(&poolNamespace, "namespace", "rook-ceph", "namespace of the cluster")
+	poolOrphansCmd.Flags().BoolVar(&poolOrphansDelete, "delete", false, "delete the orphaned resources")
+	flags.SetFlagsFromEnv(poolOrphansCmd.Flags(), rook.RookEnvVarPrefix)
+
+	poolOrphansCmd.RunE = listOrphans
+	poolCmd.AddCommand(poolOrphansCmd)
+
+	poolUsageCmd.Flags().StringVar(&poolNamespace, "namespace", "rook-ceph", "namespace of the cluster")
+	poolUsageCmd.Flags().StringVar(&poolName, "pool", "", "pool of the images")
+	flags.SetFlagsFromEnv(poolUsageCmd.Flags(), rook.RookEnvVarPrefix)
+
+	poolUsageCmd.RunE = listImageUsage
+	poolCmd.AddCommand(poolUsageCmd)
+}
+
+func createPool(cmd *cobra.Command, args []string) error {
+	if err := flags.VerifyRequiredFlags(cmd, []string{"pool"}); err != nil {
+		return err
+	}
+	rook.SetLogLevel()
+
+	p := &cephv1beta1.Pool{
+		ObjectMeta: metav1.ObjectMeta{Name: poolName, Namespace: poolNamespace},
+		Spec: cephv1beta1.PoolSpec{
+			FailureDomain: poolFailureDomain,
+			Replicated:    cephv1beta1.ReplicatedSpec{Size: poolReplicas},
+			ErasureCoded:  cephv1beta1.ErasureCodedSpec{DataChunks: poolDataChunks, CodingChunks: poolCodingChunks},
+		},
+	}
+	// the crush map is only validated by the operator, which reports an invalid failure domain in its log
+	spec := p.Spec
+	spec.FailureDomain = ""
+	if err := pool.ValidatePoolSpec(nil, poolNamespace, &spec); err != nil {
+		return rook.ValidationError(fmt.Errorf("invalid pool %s. %+v", poolName, err))
+	}
+
+	_, _, rookClientset, err := rook.GetClientset()
+	if err != nil {
+		return rook.ConnectionError(fmt.Errorf("failed to get k8s client. %+v", err))
+	}
+	if _, err := rookClientset.CephV1beta1().Pools(poolNamespace).Create(p); err != nil {
+		return rook.ServerError(fmt.Errorf("failed to create pool %s. %+v", poolName, err))
+	}
+	logger.Infof("created pool crd %s in namespace %s", poolName, poolNamespace)
+	if !poolWait {
+		return nil
+	}
+
+	context := createContext()
+	context.ConfigDir = k8sutil.DataDir
+	err = wait.Poll(poolWaitInterval, poolTimeout, func() (bool, error) {
+		pools, err := client.GetPoolNamesByID(context, poolNamespace)
+		if err != nil {
+			logger.Warningf("failed to list the pools, retrying. %+v", err)
+			return false, nil
+		}
+		for _, name := range pools {
+			if name == poolName {
+				return true, nil
+			}
+		}
+		return false, nil
+	})
+	if err != nil {
+		return rook.TimeoutError(fmt.Errorf("pool %s was not created after %s. see the operator log for the reason", poolName, poolTimeout))
+	}
+	logger.Infof("pool %s is created", poolName)
+	return nil
+}
+
+func migratePool(cmd *cobra.Command, args []string) error {
+	if err := flags.VerifyRequiredFlags(cmd, []string{"source", "target"}); err != nil {
+		return err
+	}
+	rook.SetLogLevel()
+
+	clientset, _, _, err := rook.GetClientset()
+	if err != nil {
+		return rook.ConnectionError(fmt.Errorf("failed to get k8s client. %+v", err))
+	}
+	context := createContext()
+	context.ConfigDir = k8sutil.DataDir
+	context.Clientset = clientset
+
+	status, err := pool.MigrateImages(context, poolNamespace, poolSource, poolTarget, poolDataPool)
+	if err != nil {
+		return err
+	}
+	if len(status.InUse) > 0 {
+		logger.Infof("images in use that were not migrated: %v. stop their consumers and run the migration again", status.InUse)
+	}
+	if len(status.Failed) > 0 {
+		return fmt.Errorf("failed to migrate %d images", len(status.Failed))
+	}
+	return nil
+}
+
+func listOrphans(cmd *cobra.Command, args []string) error {
+	rook.SetLogLevel()
+
+	clientset, _, rookClientset, err := rook.GetClientset()
+	if err != nil {
+		return rook.ConnectionError(fmt.Errorf("failed to get k8s client. %+v", err))
+	}
+	context := createContext()
+	context.ConfigDir = k8sutil.DataDir
+	context.Clientset = clientset
+	context.RookClientset = rookClientset
+
+	orphans, err := pool.FindOrphans(context, poolNamespace)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("erasure code profiles: %v\nclients: %v\nsecrets: %v\n", orphans.ErasureCodeProfiles, orphans.Clients, orphans.Secrets)
+	if !poolOrphansDelete || orphans.Empty() {
+		return nil
+	}
+	return pool.DeleteOrphans(context, poolNamespace, orphans)
+}
+
+func listImageUsage(cmd *cobra.Command, args []string) error {
+	if err := flags.VerifyRequiredFlags(cmd, []string{"pool"}); err != nil {
+		return err
+	}
+	rook.SetLogLevel()
+
+	context := createContext()
+	context.ConfigDir = k8sutil.DataDir
+	usage, err := client.ListImageUsage(context, poolNamespace, poolName)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "IMAGE\tPROVISIONED\tUSED")
+	for _, image := range usage {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", image.Name, display.BytesToString(image.ProvisionedSize), display.BytesToString(image.UsedSize))
+	}
+	return w.Flush()
+}
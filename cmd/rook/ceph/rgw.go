@@ -37,8 +37,13 @@ var (
 	rgwKeyring    string
 	rgwHost       string
 	rgwCert       string
+	rgwTLSCert    string
+	rgwTLSKey     string
+	rgwDNSName    string
 	rgwPort       int
 	rgwSecurePort int
+	rgwWebsite    bool
+	rgwWebsiteDNS string
 )
 
 func init() {
@@ -46,8 +51,13 @@ func init() {
 	rgwCmd.Flags().StringVar(&rgwKeyring, "rgw-keyring", "", "the rgw keyring")
 	rgwCmd.Flags().StringVar(&rgwHost, "rgw-host", os.Getenv("HOSTNAME"), "RGW host name. Becomes the only accepted hostname if the rgw dns name property is unset. Defaults to the pod hostname")
 	rgwCmd.Flags().StringVar(&rgwCert, "rgw-cert", "", "path to the ssl certificate in pem format")
+	rgwCmd.Flags().StringVar(&rgwTLSCert, "rgw-tls-cert", "", "path to the certificate of a tls secret, used with the tls key if the pem certificate is not found")
+	rgwCmd.Flags().StringVar(&rgwTLSKey, "rgw-tls-key", "", "path to the key of a tls secret, used with the tls certificate if the pem certificate is not found")
+	rgwCmd.Flags().StringVar(&rgwDNSName, "rgw-dns-name", "", "dns name of the object store for virtual-hosted-style bucket requests")
 	rgwCmd.Flags().IntVar(&rgwPort, "rgw-port", 0, "rgw port (http)")
 	rgwCmd.Flags().IntVar(&rgwSecurePort, "rgw-secure-port", 0, "rgw secure port number (https)")
+	rgwCmd.Flags().BoolVar(&rgwWebsite, "rgw-static-website", false, "serve the buckets with a website configuration as static websites")
+	rgwCmd.Flags().StringVar(&rgwWebsiteDNS, "rgw-website-dns-name", "", "dns name of the website endpoint for the static websites of the buckets")
 	addCephFlags(rgwCmd)
 
 	flags.SetFlagsFromEnv(rgwCmd.Flags(), rook.RookEnvVarPrefix)
@@ -82,6 +92,11 @@ func startRGW(cmd *cobra.Command, args []string) error {
 		Port:            rgwPort,
 		SecurePort:      rgwSecurePort,
 		CertificatePath: rgwCert,
+		TLSCertPath:     rgwTLSCert,
+		TLSKeyPath:      rgwTLSKey,
+		DNSName:         rgwDNSName,
+		StaticWebsite:   rgwWebsite,
+		WebsiteDNSName:  rgwWebsiteDNS,
 	}
 
 	err := rgw.Run(createContext(), config)
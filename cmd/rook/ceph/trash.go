@@ -0,0 +1,143 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ceph
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/rook/rook/cmd/rook/rook"
+	"github.com/rook/rook/pkg/daemon/ceph/client"
+	"github.com/rook/rook/pkg/operator/k8sutil"
+	"github.com/rook/rook/pkg/util/flags"
+	"github.com/spf13/cobra"
+)
+
+var imageTrashCmd = &cobra.Command{
+	Use:   "trash",
+	Short: "Manages the block images in the trash of a pool",
+}
+
+var imageTrashListCmd = &cobra.Command{
+	Use:   "ls",
+	Short: "Lists the block images in the trash of a pool",
+}
+
+var imageTrashRestoreCmd = &cobra.Command{
+	Use:   "restore",
+	Short: "Moves a block image from the trash back to its pool",
+}
+
+var imageTrashRemoveCmd = &cobra.Command{
+	Use:   "rm",
+	Short: "Deletes a block image from the trash",
+}
+
+var imageTrashPurgeCmd = &cobra.Command{
+	Use:   "purge",
+	Short: "Deletes the expired block images from the trash of a pool",
+}
+
+var (
+	imageTrashID    string
+	imageTrashForce bool
+)
+
+func init() {
+	for _, cmd := range []*cobra.Command{imageTrashListCmd, imageTrashRestoreCmd, imageTrashRemoveCmd, imageTrashPurgeCmd} {
+		cmd.Flags().StringVar(&imageNamespace, "namespace", "rook-ceph", "namespace of the cluster")
+		cmd.Flags().StringVar(&imagePool, "pool", "", "pool of the trash, or pool/namespace for the trash of a pool namespace")
+		flags.SetFlagsFromEnv(cmd.Flags(), rook.RookEnvVarPrefix)
+	}
+	for _, cmd := range []*cobra.Command{imageTrashRestoreCmd, imageTrashRemoveCmd} {
+		cmd.Flags().StringVar(&imageTrashID, "id", "", "id of the image in the trash")
+	}
+	imageTrashRemoveCmd.Flags().BoolVar(&imageTrashForce, "force", false, "delete the image even if it did not expire yet")
+
+	imageTrashListCmd.RunE = listTrash
+	imageTrashRestoreCmd.RunE = restoreTrashImage
+	imageTrashRemoveCmd.RunE = removeTrashImage
+	imageTrashPurgeCmd.RunE = purgeTrash
+	imageTrashCmd.AddCommand(imageTrashListCmd)
+	imageTrashCmd.AddCommand(imageTrashRestoreCmd)
+	imageTrashCmd.AddCommand(imageTrashRemoveCmd)
+	imageTrashCmd.AddCommand(imageTrashPurgeCmd)
+	imageCmd.AddCommand(imageTrashCmd)
+}
+
+func listTrash(cmd *cobra.Command, args []string) error {
+	if err := flags.VerifyRequiredFlags(cmd, []string{"pool"}); err != nil {
+		return err
+	}
+	rook.SetLogLevel()
+
+	context := createContext()
+	context.ConfigDir = k8sutil.DataDir
+	images, err := client.ListTrash(context, imageNamespace, imagePool)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tIMAGE\tDELETED AT\tSTATUS")
+	for _, image := range images {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", image.ID, image.Name, image.DeletedAt, image.Status)
+	}
+	return w.Flush()
+}
+
+func restoreTrashImage(cmd *cobra.Command, args []string) error {
+	if err := flags.VerifyRequiredFlags(cmd, []string{"pool", "id"}); err != nil {
+		return err
+	}
+	rook.SetLogLevel()
+
+	context := createContext()
+	context.ConfigDir = k8sutil.DataDir
+	if err := client.RestoreTrashImage(context, imageNamespace, imagePool, imageTrashID); err != nil {
+		return err
+	}
+	logger.Infof("restored image %s to pool %s", imageTrashID, imagePool)
+	return nil
+}
+
+func removeTrashImage(cmd *cobra.Command, args []string) error {
+	if err := flags.VerifyRequiredFlags(cmd, []string{"pool", "id"}); err != nil {
+		return err
+	}
+	rook.SetLogLevel()
+
+	context := createContext()
+	context.ConfigDir = k8sutil.DataDir
+	if err := client.RemoveTrashImage(context, imageNamespace, imagePool, imageTrashID, imageTrashForce); err != nil {
+		return err
+	}
+	logger.Infof("deleted image %s from the trash of pool %s", imageTrashID, imagePool)
+	return nil
+}
+
+func purgeTrash(cmd *cobra.Command, args []string) error {
+	if err := flags.VerifyRequiredFlags(cmd, []string{"pool"}); err != nil {
+		return err
+	}
+	rook.SetLogLevel()
+
+	context := createContext()
+	context.ConfigDir = k8sutil.DataDir
+	return client.PurgeTrash(context, imageNamespace, imagePool)
+}
@@ -0,0 +1,70 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/rook/rook/cmd/rook/ceph"
+	rook "github.com/rook/rook/cmd/rook/rook"
+	"github.com/spf13/cobra"
+)
+
+var completionCmd = &cobra.Command{
+	Use:   "completion [bash|zsh]",
+	Short: "Generates the shell completion of the rook commands",
+	Long: `Generates the shell completion of the rook commands. Load the completion in bash with
+
+    source <(rook completion bash)
+
+The names of the pools and images are completed in bash by listing them from the cluster.`,
+	ValidArgs: []string{"bash", "zsh"},
+}
+
+func init() {
+	completionCmd.RunE = generateCompletion
+}
+
+func generateCompletion(cmd *cobra.Command, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("expected the shell, either bash or zsh")
+	}
+
+	// the commands are hidden from the help of the container entrypoint, but are completed for the users of the cli
+	showCommands(rook.RootCmd)
+	ceph.AddCompletions(rook.RootCmd)
+
+	switch args[0] {
+	case "bash":
+		rook.RootCmd.BashCompletionFunction = ceph.BashCompletionFunction
+		return rook.RootCmd.GenBashCompletion(os.Stdout)
+	case "zsh":
+		return rook.RootCmd.GenZshCompletion(os.Stdout)
+	}
+	return fmt.Errorf("unsupported shell %s, expected bash or zsh", args[0])
+}
+
+// showCommands unhides the commands, except the helper that lists the names to complete
+func showCommands(command *cobra.Command) {
+	for _, c := range command.Commands() {
+		if c.Name() == "complete" {
+			continue
+		}
+		c.Hidden = false
+		showCommands(c)
+	}
+}
@@ -17,6 +17,7 @@ package main
 
 import (
 	"fmt"
+	"os"
 
 	"github.com/rook/rook/cmd/rook/ceph"
 	"github.com/rook/rook/cmd/rook/cockroachdb"
@@ -30,12 +31,15 @@ func main() {
 	addCommands()
 	if err := rook.RootCmd.Execute(); err != nil {
 		fmt.Printf("rook error: %+v\n", err)
+		os.Exit(rook.ExitCode(err))
 	}
 }
 
 func addCommands() {
 	rook.RootCmd.AddCommand(version.VersionCmd)
 	rook.RootCmd.AddCommand(discoverCmd)
+	rook.RootCmd.AddCommand(completionCmd)
+	rook.RootCmd.AddCommand(shellCmd)
 	rook.RootCmd.AddCommand(ceph.Cmd)
 	rook.RootCmd.AddCommand(cockroachdb.Cmd)
 	rook.RootCmd.AddCommand(minio.Cmd)
@@ -44,4 +48,7 @@ func addCommands() {
 	// add the ceph legacy commands to the main command for backwards compatibility
 	// TODO: remove these Ceph legacy commands in the future
 	ceph.AddCommands(rook.RootCmd)
+
+	// the daemons only run in the rook image, while the admin commands also run on the client platforms
+	rook.ServerOnly(discoverCmd, cockroachdb.Cmd, minio.Cmd, nfs.Cmd)
 }
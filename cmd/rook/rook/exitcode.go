@@ -0,0 +1,92 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rook
+
+import (
+	"github.com/rook/rook/pkg/util/flags"
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// The exit codes of the commands, so scripts can tell the classes of failures apart
+const (
+	// ExitCodeFailure is the exit code of the failures that are not classified
+	ExitCodeFailure = 1
+	// ExitCodeValidation is the exit code of invalid or missing arguments and flags
+	ExitCodeValidation = 2
+	// ExitCodeConnection is the exit code when the cluster or the kubernetes api cannot be reached
+	ExitCodeConnection = 3
+	// ExitCodeServer is the exit code when the kubernetes api or ceph rejected or failed a request
+	ExitCodeServer = 4
+	// ExitCodeTimeout is the exit code when a command timed out waiting for an operation to complete
+	ExitCodeTimeout = 5
+)
+
+// ExitError is the error of a command with the exit code of its class of failure
+type ExitError struct {
+	Code int
+	Err  error
+}
+
+func (e *ExitError) Error() string {
+	return e.Err.Error()
+}
+
+// ValidationError returns the error with the exit code of invalid arguments
+func ValidationError(err error) error {
+	return &ExitError{Code: ExitCodeValidation, Err: err}
+}
+
+// ConnectionError returns the error with the exit code of a failed connection
+func ConnectionError(err error) error {
+	return &ExitError{Code: ExitCodeConnection, Err: err}
+}
+
+// ServerError returns the error with the exit code of a failed request
+func ServerError(err error) error {
+	return &ExitError{Code: ExitCodeServer, Err: err}
+}
+
+// TimeoutError returns the error with the exit code of a timeout
+func TimeoutError(err error) error {
+	return &ExitError{Code: ExitCodeTimeout, Err: err}
+}
+
+// ExitCode returns the exit code of the error returned by a command
+func ExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+
+	switch e := err.(type) {
+	case *ExitError:
+		return e.Code
+	case *flags.RequiredFlagsError:
+		return ExitCodeValidation
+	}
+	if err == wait.ErrWaitTimeout {
+		return ExitCodeTimeout
+	}
+	return ExitCodeFailure
+}
+
+func init() {
+	// the unknown flags and the flags with invalid values are validation errors
+	RootCmd.SetFlagErrorFunc(func(cmd *cobra.Command, err error) error {
+		return ValidationError(err)
+	})
+}
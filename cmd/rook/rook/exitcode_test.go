@@ -0,0 +1,55 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rook
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/rook/rook/pkg/util/flags"
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+func TestExitCode(t *testing.T) {
+	assert.Equal(t, 0, ExitCode(nil))
+	assert.Equal(t, ExitCodeFailure, ExitCode(fmt.Errorf("failed")))
+	assert.Equal(t, ExitCodeValidation, ExitCode(ValidationError(fmt.Errorf("invalid"))))
+	assert.Equal(t, ExitCodeConnection, ExitCode(ConnectionError(fmt.Errorf("unreachable"))))
+	assert.Equal(t, ExitCodeServer, ExitCode(ServerError(fmt.Errorf("rejected"))))
+	assert.Equal(t, ExitCodeTimeout, ExitCode(TimeoutError(fmt.Errorf("timed out"))))
+	assert.Equal(t, ExitCodeTimeout, ExitCode(wait.ErrWaitTimeout))
+
+	// the message of the error is kept
+	assert.Equal(t, "rejected", ServerError(fmt.Errorf("rejected")).Error())
+
+	// missing required flags are validation errors
+	cmd := &cobra.Command{Use: "test"}
+	cmd.Flags().String("foo", "", "")
+	err := flags.VerifyRequiredFlags(cmd, []string{"foo"})
+	assert.Equal(t, "foo is required for test", err.Error())
+	assert.Equal(t, ExitCodeValidation, ExitCode(err))
+}
+
+func TestCheckServerOS(t *testing.T) {
+	assert.Nil(t, checkServerOS("rook ceph osd", "linux"))
+
+	err := checkServerOS("rook ceph osd", "darwin")
+	assert.Equal(t, "rook ceph osd is not supported on darwin. it only runs on linux in the rook image", err.Error())
+	assert.Equal(t, ExitCodeValidation, ExitCode(err))
+}
@@ -0,0 +1,220 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rook
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/rook/rook/pkg/util/exec"
+	"k8s.io/client-go/rest"
+)
+
+// Kubeconfig is the kubectl config file used to reach the cluster when the command does not run in a pod. The
+// default config of kubectl is used if it is empty.
+var Kubeconfig string
+
+// the connection to a secured kubernetes api, which overrides the service account of the pod and the kubectl config
+type apiConnection struct {
+	server       string
+	caFile       string
+	certFile     string
+	keyFile      string
+	tokenFile    string
+	username     string
+	passwordFile string
+}
+
+var apiFlags apiConnection
+
+// the current context of the kubectl config, as printed by 'kubectl config view --minify --raw -o json'
+type kubectlConfig struct {
+	CurrentContext string `json:"current-context"`
+	Contexts       []struct {
+		Name    string `json:"name"`
+		Context struct {
+			Cluster string `json:"cluster"`
+			User    string `json:"user"`
+		} `json:"context"`
+	} `json:"contexts"`
+	Clusters []struct {
+		Name    string `json:"name"`
+		Cluster struct {
+			Server                   string `json:"server"`
+			CertificateAuthority     string `json:"certificate-authority"`
+			CertificateAuthorityData []byte `json:"certificate-authority-data"`
+			InsecureSkipTLSVerify    bool   `json:"insecure-skip-tls-verify"`
+		} `json:"cluster"`
+	} `json:"clusters"`
+	Users []struct {
+		Name string `json:"name"`
+		User struct {
+			ClientCertificate     string `json:"client-certificate"`
+			ClientCertificateData []byte `json:"client-certificate-data"`
+			ClientKey             string `json:"client-key"`
+			ClientKeyData         []byte `json:"client-key-data"`
+			Token                 string `json:"token"`
+			Username              string `json:"username"`
+			Password              string `json:"password"`
+		} `json:"user"`
+	} `json:"users"`
+}
+
+// inCluster returns whether the command runs in a pod, where the service account of the pod is used
+func inCluster() bool {
+	return os.Getenv("KUBERNETES_SERVICE_HOST") != "" && os.Getenv("KUBERNETES_SERVICE_PORT") != ""
+}
+
+// getKubectlConfig returns the config of the current context of kubectl, so the commands can be run from a
+// workstation with the credentials of the admin
+func getKubectlConfig() (*rest.Config, error) {
+	args := []string{"config", "view", "--minify", "--raw", "-o", "json"}
+	if Kubeconfig != "" {
+		args = append(args, fmt.Sprintf("--kubeconfig=%s", Kubeconfig))
+	}
+	executor := &exec.CommandExecutor{}
+	output, err := executor.ExecuteCommandWithOutput(false, "", "kubectl", args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the kubectl config. %+v", err)
+	}
+	return parseKubectlConfig([]byte(output))
+}
+
+// getConfig returns the config to reach the kubernetes api. The api flags override the service account of the pod or
+// the kubectl config, and an api server in the flags replaces them.
+func getConfig() (*rest.Config, error) {
+	var config *rest.Config
+	var err error
+	if apiFlags.server != "" {
+		config = &rest.Config{}
+	} else if inCluster() {
+		config, err = rest.InClusterConfig()
+	} else {
+		config, err = getKubectlConfig()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := apiFlags.apply(config); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+func (a apiConnection) apply(config *rest.Config) error {
+	if a.server != "" {
+		config.Host = a.server
+	}
+	if a.caFile != "" {
+		config.TLSClientConfig.CAFile = a.caFile
+		config.TLSClientConfig.CAData = nil
+		config.Insecure = false
+	}
+	if a.certFile != "" || a.keyFile != "" {
+		if a.certFile == "" || a.keyFile == "" {
+			return fmt.Errorf("both the client certificate and the client key are required to authenticate with a certificate")
+		}
+		config.TLSClientConfig.CertFile = a.certFile
+		config.TLSClientConfig.CertData = nil
+		config.TLSClientConfig.KeyFile = a.keyFile
+		config.TLSClientConfig.KeyData = nil
+	}
+	if a.tokenFile != "" {
+		token, err := readSecretFile(a.tokenFile)
+		if err != nil {
+			return err
+		}
+		config.BearerToken = token
+	}
+	if a.username != "" || a.passwordFile != "" {
+		if a.username == "" || a.passwordFile == "" {
+			return fmt.Errorf("both the username and the password file are required to authenticate with a password")
+		}
+		password, err := readSecretFile(a.passwordFile)
+		if err != nil {
+			return err
+		}
+		config.Username = a.username
+		config.Password = password
+		// basic auth is not sent along with a token
+		config.BearerToken = ""
+	}
+	return nil
+}
+
+// readSecretFile reads a token or password from a file, so they do not show in the arguments or the logs
+func readSecretFile(path string) (string, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s. %+v", path, err)
+	}
+	secret := strings.TrimSpace(string(contents))
+	if secret == "" {
+		return "", fmt.Errorf("%s is empty", path)
+	}
+	return secret, nil
+}
+
+func parseKubectlConfig(output []byte) (*rest.Config, error) {
+	var kc kubectlConfig
+	if err := json.Unmarshal(output, &kc); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal the kubectl config. %+v", err)
+	}
+
+	var clusterName, userName string
+	found := false
+	for _, c := range kc.Contexts {
+		if c.Name == kc.CurrentContext {
+			clusterName, userName = c.Context.Cluster, c.Context.User
+			found = true
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("failed to find the current context %q in the kubectl config", kc.CurrentContext)
+	}
+
+	config := &rest.Config{}
+	found = false
+	for _, c := range kc.Clusters {
+		if c.Name == clusterName {
+			config.Host = c.Cluster.Server
+			config.TLSClientConfig.CAFile = c.Cluster.CertificateAuthority
+			config.TLSClientConfig.CAData = c.Cluster.CertificateAuthorityData
+			config.Insecure = c.Cluster.InsecureSkipTLSVerify
+			found = true
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("failed to find cluster %q in the kubectl config", clusterName)
+	}
+
+	for _, u := range kc.Users {
+		if u.Name == userName {
+			config.TLSClientConfig.CertFile = u.User.ClientCertificate
+			config.TLSClientConfig.CertData = u.User.ClientCertificateData
+			config.TLSClientConfig.KeyFile = u.User.ClientKey
+			config.TLSClientConfig.KeyData = u.User.ClientKeyData
+			config.BearerToken = u.User.Token
+			config.Username = u.User.Username
+			config.Password = u.User.Password
+		}
+	}
+	return config, nil
+}
@@ -0,0 +1,102 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rook
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/client-go/rest"
+)
+
+func TestParseKubectlConfig(t *testing.T) {
+	output := `{
+  "current-context": "admin@prod",
+  "contexts": [
+    {"name": "admin@prod", "context": {"cluster": "prod", "user": "admin"}}
+  ],
+  "clusters": [
+    {"name": "prod", "cluster": {"server": "https://10.0.0.1:6443", "certificate-authority-data": "Y2EtZGF0YQ=="}}
+  ],
+  "users": [
+    {"name": "admin", "user": {"client-certificate-data": "Y2VydA==", "client-key-data": "a2V5"}}
+  ]
+}`
+	config, err := parseKubectlConfig([]byte(output))
+	assert.Nil(t, err)
+	assert.Equal(t, "https://10.0.0.1:6443", config.Host)
+	assert.Equal(t, "ca-data", string(config.TLSClientConfig.CAData))
+	assert.Equal(t, "cert", string(config.TLSClientConfig.CertData))
+	assert.Equal(t, "key", string(config.TLSClientConfig.KeyData))
+	assert.False(t, config.Insecure)
+
+	// a token and an insecure cluster
+	output = `{
+  "current-context": "dev",
+  "contexts": [{"name": "dev", "context": {"cluster": "dev", "user": "dev"}}],
+  "clusters": [{"name": "dev", "cluster": {"server": "https://dev:6443", "insecure-skip-tls-verify": true}}],
+  "users": [{"name": "dev", "user": {"token": "abc"}}]
+}`
+	config, err = parseKubectlConfig([]byte(output))
+	assert.Nil(t, err)
+	assert.Equal(t, "https://dev:6443", config.Host)
+	assert.Equal(t, "abc", config.BearerToken)
+	assert.True(t, config.Insecure)
+
+	// the current context is not found
+	_, err = parseKubectlConfig([]byte(`{"current-context": "missing"}`))
+	assert.NotNil(t, err)
+}
+
+func TestAPIConnection(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	tokenFile := path.Join(dir, "token")
+	passwordFile := path.Join(dir, "password")
+	assert.Nil(t, ioutil.WriteFile(tokenFile, []byte("abc\n"), 0600))
+	assert.Nil(t, ioutil.WriteFile(passwordFile, []byte("secret"), 0600))
+
+	// the certificates replace the certificates of the base config
+	config := &rest.Config{Host: "https://10.0.0.1:6443", BearerToken: "sa-token"}
+	config.Insecure = true
+	config.TLSClientConfig.CAData = []byte("ca-data")
+	a := apiConnection{server: "https://api:6443", caFile: "/etc/ca.crt", certFile: "/etc/client.crt", keyFile: "/etc/client.key", tokenFile: tokenFile}
+	assert.Nil(t, a.apply(config))
+	assert.Equal(t, "https://api:6443", config.Host)
+	assert.Equal(t, "/etc/ca.crt", config.TLSClientConfig.CAFile)
+	assert.Nil(t, config.TLSClientConfig.CAData)
+	assert.False(t, config.Insecure)
+	assert.Equal(t, "/etc/client.crt", config.TLSClientConfig.CertFile)
+	assert.Equal(t, "/etc/client.key", config.TLSClientConfig.KeyFile)
+	assert.Equal(t, "abc", config.BearerToken)
+
+	// a username and password replace the token
+	config = &rest.Config{BearerToken: "sa-token"}
+	assert.Nil(t, apiConnection{username: "admin", passwordFile: passwordFile}.apply(config))
+	assert.Equal(t, "admin", config.Username)
+	assert.Equal(t, "secret", config.Password)
+	assert.Equal(t, "", config.BearerToken)
+
+	// incomplete credentials
+	assert.NotNil(t, apiConnection{certFile: "/etc/client.crt"}.apply(&rest.Config{}))
+	assert.NotNil(t, apiConnection{username: "admin"}.apply(&rest.Config{}))
+	assert.NotNil(t, apiConnection{tokenFile: path.Join(dir, "missing")}.apply(&rest.Config{}))
+}
@@ -0,0 +1,45 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rook
+
+import (
+	"fmt"
+	"runtime"
+
+	"github.com/spf13/cobra"
+)
+
+// ServerOS is the only os the daemons run on, since they depend on the kernel and on the tools in the rook image
+const ServerOS = "linux"
+
+// ServerOnly makes the commands and their subcommands fail with a not supported error on the client platforms
+func ServerOnly(cmds ...*cobra.Command) {
+	for _, cmd := range cmds {
+		cmd.PersistentPreRunE = verifyServerOS
+	}
+}
+
+func verifyServerOS(cmd *cobra.Command, args []string) error {
+	return checkServerOS(cmd.CommandPath(), runtime.GOOS)
+}
+
+func checkServerOS(command, goos string) error {
+	if goos == ServerOS {
+		return nil
+	}
+	return ValidationError(fmt.Errorf("%s is not supported on %s. it only runs on %s in the rook image", command, goos, ServerOS))
+}
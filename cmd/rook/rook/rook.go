@@ -25,10 +25,10 @@ import (
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
 	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/rest"
 
 	rookclient "github.com/rook/rook/pkg/client/clientset/versioned"
 	"github.com/rook/rook/pkg/util/flags"
+	"github.com/rook/rook/pkg/util/logforward"
 	"github.com/rook/rook/pkg/version"
 	apiextensionsclient "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
 )
@@ -45,6 +45,7 @@ var RootCmd = &cobra.Command{
 
 var (
 	logLevelRaw string
+	logForward  logForwardConfig
 	Cfg         = &Config{}
 	logger      = capnslog.NewPackageLogger("github.com/rook/rook", "rookcmd")
 )
@@ -53,12 +54,32 @@ type Config struct {
 	LogLevel capnslog.LogLevel
 }
 
+// the forwarding of the logs of the process, with the fields of the logs
+type logForwardConfig struct {
+	target   string
+	facility string
+	fields   logforward.Fields
+}
+
 // Initialize the configuration parameters. The precedence from lowest to highest is:
 //  1) default value (at compilation)
 //  2) environment variables (upper case, replace - with _, and rook prefix. For example, discovery-url is ROOK_DISCOVERY_URL)
 //  3) command line parameter
 func init() {
 	RootCmd.PersistentFlags().StringVar(&logLevelRaw, "log-level", "INFO", "logging level for logging/tracing output (valid values: CRITICAL,ERROR,WARNING,NOTICE,INFO,DEBUG,TRACE)")
+	RootCmd.PersistentFlags().StringVar(&Kubeconfig, "kubeconfig", "", "kubectl config file to reach the cluster when not running in a pod")
+	RootCmd.PersistentFlags().StringVar(&apiFlags.server, "api-server", "", "url of the kubernetes api, instead of the api of the pod or of the kubectl config")
+	RootCmd.PersistentFlags().StringVar(&apiFlags.caFile, "api-ca-file", "", "CA certificate file to verify the kubernetes api")
+	RootCmd.PersistentFlags().StringVar(&apiFlags.certFile, "api-cert-file", "", "client certificate file to authenticate with the kubernetes api")
+	RootCmd.PersistentFlags().StringVar(&apiFlags.keyFile, "api-key-file", "", "client key file of the client certificate")
+	RootCmd.PersistentFlags().StringVar(&apiFlags.tokenFile, "api-token-file", "", "file with the bearer token to authenticate with the kubernetes api")
+	RootCmd.PersistentFlags().StringVar(&apiFlags.username, "api-username", "", "username to authenticate with the kubernetes api")
+	RootCmd.PersistentFlags().StringVar(&apiFlags.passwordFile, "api-password-file", "", "file with the password of the api username")
+	RootCmd.PersistentFlags().StringVar(&logForward.target, "log-forward", "", "where the logs are also forwarded: journald, syslog, or the udp:// or tcp:// url of a syslog server")
+	RootCmd.PersistentFlags().StringVar(&logForward.facility, "log-forward-facility", "daemon", "syslog facility of the forwarded logs")
+	RootCmd.PersistentFlags().StringVar(&logForward.fields.Cluster, "log-forward-cluster", "", "cluster of the forwarded logs")
+	RootCmd.PersistentFlags().StringVar(&logForward.fields.Node, "log-forward-node", "", "node of the forwarded logs, the hostname if empty")
+	RootCmd.PersistentFlags().StringVar(&logForward.fields.Daemon, "log-forward-daemon", "", "daemon of the forwarded logs")
 
 	// load the environment variables
 	flags.SetFlagsFromEnv(RootCmd.Flags(), RookEnvVarPrefix)
@@ -73,6 +94,13 @@ func SetLogLevel() {
 	}
 	Cfg.LogLevel = ll
 	capnslog.SetGlobalLogLevel(Cfg.LogLevel)
+
+	// the logs are forwarded from here since all the commands set the log level when they start
+	if logForward.target != "" {
+		if err := logforward.Start(logForward.target, logForward.facility, logForward.fields); err != nil {
+			logger.Warningf("failed to forward the logs. %+v", err)
+		}
+	}
 }
 
 func LogStartupInfo(cmdFlags *pflag.FlagSet) {
@@ -87,8 +115,8 @@ func LogStartupInfo(cmdFlags *pflag.FlagSet) {
 }
 
 func GetClientset() (kubernetes.Interface, apiextensionsclient.Interface, rookclient.Interface, error) {
-	// create the k8s client
-	config, err := rest.InClusterConfig()
+	// create the k8s client, with the kubectl config when the command runs outside of a pod
+	config, err := getConfig()
 	if err != nil {
 		return nil, nil, nil, fmt.Errorf("failed to get k8s config. %+v", err)
 	}
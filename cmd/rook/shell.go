@@ -0,0 +1,185 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+
+	rook "github.com/rook/rook/cmd/rook/rook"
+	"github.com/rook/rook/pkg/util/flags"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+const shellPrompt = "rook> "
+
+var shellCmd = &cobra.Command{
+	Use:   "shell",
+	Short: "Runs the rook commands interactively",
+	Long: `Runs the rook commands interactively, one command per line without the leading rook, such as
+
+    rook> ceph image ls --pool replicapool
+
+The flags of a command do not carry over to the next command. Exit with exit, quit or ctrl-d.`,
+}
+
+func init() {
+	shellCmd.RunE = runShell
+}
+
+func runShell(cmd *cobra.Command, args []string) error {
+	return shell(rook.RootCmd, os.Stdin, os.Stdout)
+}
+
+// shell runs each line of the input as a command of the root command until the input ends or the user exits
+func shell(root *cobra.Command, in io.Reader, out io.Writer) error {
+	scanner := bufio.NewScanner(in)
+	for {
+		fmt.Fprint(out, shellPrompt)
+		if !scanner.Scan() {
+			fmt.Fprintln(out)
+			return scanner.Err()
+		}
+		args, err := splitArgs(scanner.Text())
+		if err != nil {
+			fmt.Fprintf(out, "rook error: %+v\n", err)
+			continue
+		}
+		if len(args) > 0 && args[0] == root.Name() {
+			args = args[1:]
+		}
+		if len(args) == 0 {
+			continue
+		}
+		if args[0] == "exit" || args[0] == "quit" {
+			return nil
+		}
+		if args[0] == shellCmd.Name() {
+			fmt.Fprintln(out, "rook error: already in the shell")
+			continue
+		}
+
+		flags := saveFlags(root)
+		root.SetArgs(args)
+		if err := root.Execute(); err != nil {
+			fmt.Fprintf(out, "rook error: %+v\n", err)
+		}
+		restoreFlags(root, flags)
+	}
+}
+
+type flagState struct {
+	flag  *pflag.Flag
+	value string
+	// the values of a slice flag, whose string form cannot be set again
+	slice   []string
+	changed bool
+}
+
+// saveFlags returns the values of the flags of all the commands, which are restored after each command of the shell
+// so the flags of a command are not set for the next commands
+func saveFlags(command *cobra.Command) []flagState {
+	var states []flagState
+	save := func(f *pflag.Flag) {
+		state := flagState{flag: f, value: f.Value.String(), changed: f.Changed}
+		if slice, ok := f.Value.(flags.SliceValue); ok {
+			state.slice = slice.GetSlice()
+		}
+		states = append(states, state)
+	}
+	command.Flags().VisitAll(save)
+	command.PersistentFlags().VisitAll(save)
+	for _, c := range command.Commands() {
+		states = append(states, saveFlags(c)...)
+	}
+	return states
+}
+
+// restoreFlags restores the saved values of the flags. The help flags, which are only added to the commands when
+// they are run, are reset as well.
+func restoreFlags(command *cobra.Command, states []flagState) {
+	for _, s := range states {
+		if slice, ok := s.flag.Value.(flags.SliceValue); ok {
+			slice.Replace(s.slice)
+		} else {
+			s.flag.Value.Set(s.value)
+		}
+		s.flag.Changed = s.changed
+	}
+	resetHelp(command)
+}
+
+func resetHelp(command *cobra.Command) {
+	if f := command.Flags().Lookup("help"); f != nil {
+		f.Value.Set("false")
+		f.Changed = false
+	}
+	for _, c := range command.Commands() {
+		resetHelp(c)
+	}
+}
+
+// splitArgs splits the line into words like a shell, with the words in single or double quotes kept together and
+// the characters escaped by a backslash taken as they are
+func splitArgs(line string) ([]string, error) {
+	var args []string
+	var word bytes.Buffer
+	inWord := false
+	var quote rune
+	escaped := false
+	for _, r := range line {
+		switch {
+		case escaped:
+			word.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped = true
+			inWord = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inWord = true
+		case r == ' ' || r == '\t':
+			if inWord {
+				args = append(args, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated quote %c", quote)
+	}
+	if escaped {
+		return nil, fmt.Errorf("unterminated escape")
+	}
+	if inWord {
+		args = append(args, word.String())
+	}
+	return args, nil
+}
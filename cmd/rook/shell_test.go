@@ -0,0 +1,88 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/rook/rook/pkg/util/flags"
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitArgs(t *testing.T) {
+	args, err := splitArgs(`ceph image ls  --pool replicapool --selector "owner=team a" 'x"y' a\ b`)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"ceph", "image", "ls", "--pool", "replicapool", "--selector", "owner=team a", `x"y`, "a b"}, args)
+
+	args, err = splitArgs(`  `)
+	assert.Nil(t, err)
+	assert.Nil(t, args)
+
+	args, err = splitArgs(`--pool ""`)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"--pool", ""}, args)
+
+	_, err = splitArgs(`--pool "replicapool`)
+	assert.NotNil(t, err)
+	_, err = splitArgs(`ls \`)
+	assert.NotNil(t, err)
+}
+
+func TestShell(t *testing.T) {
+	var pools []string
+	pool := ""
+	root := &cobra.Command{Use: "rook"}
+	ls := &cobra.Command{Use: "ls", RunE: func(cmd *cobra.Command, args []string) error {
+		pools = append(pools, pool)
+		return nil
+	}}
+	ls.Flags().StringVar(&pool, "pool", "default", "pool")
+	root.AddCommand(ls)
+
+	out := &bytes.Buffer{}
+	in := strings.NewReader("ls --pool a\nrook ls\n\nunknown\nexit\nls\n")
+	assert.Nil(t, shell(root, in, out))
+
+	// the flags of a command are not set for the next command, and the shell stops at exit
+	assert.Equal(t, []string{"a", "default"}, pools)
+	assert.Contains(t, out.String(), "rook error")
+	assert.Equal(t, 5, strings.Count(out.String(), shellPrompt))
+}
+
+func TestShellSliceFlags(t *testing.T) {
+	var runs [][]string
+	var images []string
+	archs := []string{"amd64", "arm64"}
+	root := &cobra.Command{Use: "rook"}
+	add := &cobra.Command{Use: "add", RunE: func(cmd *cobra.Command, args []string) error {
+		runs = append(runs, append(append([]string{}, images...), archs...))
+		return nil
+	}}
+	flags.StringSliceVar(add.Flags(), &images, "image", nil, "images")
+	flags.StringSliceVar(add.Flags(), &archs, "archs", archs, "architectures")
+	root.AddCommand(add)
+
+	in := strings.NewReader("add --image a,b --archs ppc64le\nadd\nadd --image c\n")
+	assert.Nil(t, shell(root, in, &bytes.Buffer{}))
+
+	// the slice flags are restored as they were, not parsed again from their string form
+	assert.Equal(t, [][]string{{"a", "b", "ppc64le"}, {"amd64", "arm64"}, {"c", "amd64", "arm64"}}, runs)
+	assert.Nil(t, images)
+	assert.Equal(t, []string{"amd64", "arm64"}, archs)
+}
@@ -59,6 +59,7 @@ func handleMount(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("Rook: Could not parse options for mounting %s. Got %v", args[1], err)
 	}
 	opts.MountDir = args[0]
+	opts.RequestID = requestID
 
 	if opts.FsType == cephFS {
 		return mountCephFS(client, opts)
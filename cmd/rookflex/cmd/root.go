@@ -28,12 +28,17 @@ import (
 
 	"github.com/rook/rook/pkg/daemon/ceph/agent/flexvolume"
 	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/util/rand"
 )
 
 const (
 	cephFS = "ceph"
 )
 
+// each run of the driver handles a single call from the kubelet. the id of the call is sent to the agent with the
+// options and the log messages of the call.
+var requestID = rand.String(8)
+
 var RootCmd = &cobra.Command{
 	Use:           "rookflex",
 	Short:         "Rook Flex volume plugin",
@@ -77,8 +82,9 @@ func getMounter() *k8smount.SafeFormatAndMount {
 
 func log(client *rpc.Client, message string, isError bool) {
 	var log = &flexvolume.LogMessage{
-		Message: message,
-		IsError: isError,
+		Message:   message,
+		IsError:   isError,
+		RequestID: requestID,
 	}
 	client.Call("Controller.Log", log, nil)
 }
@@ -59,7 +59,8 @@ func handleUnmount(cmd *cobra.Command, args []string) error {
 	}
 
 	var opts = &flexvolume.AttachOptions{
-		MountDir: args[0],
+		MountDir:  args[0],
+		RequestID: requestID,
 	}
 
 	err = client.Call("Controller.GetAttachInfoFromMountDir", opts.MountDir, &opts)
@@ -0,0 +1,48 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package v1beta1
+
+import (
+	"fmt"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// ValidateImageProfiles checks that the image profiles have unique names and valid sizes and durations
+func ValidateImageProfiles(profiles []ImageProfileSpec) error {
+	names := map[string]bool{}
+	for _, p := range profiles {
+		if p.Name == "" {
+			return fmt.Errorf("an image profile needs a name")
+		}
+		if names[p.Name] {
+			return fmt.Errorf("image profile %s is defined more than once", p.Name)
+		}
+		names[p.Name] = true
+		if p.MinSize != "" {
+			if size, err := resource.ParseQuantity(p.MinSize); err != nil || size.Sign() < 0 {
+				return fmt.Errorf("invalid minSize %s of image profile %s", p.MinSize, p.Name)
+			}
+		}
+		if p.TrashRetention != "" {
+			if d, err := time.ParseDuration(p.TrashRetention); err != nil || d < 0 {
+				return fmt.Errorf("invalid trashRetention %s of image profile %s", p.TrashRetention, p.Name)
+			}
+		}
+	}
+	return nil
+}
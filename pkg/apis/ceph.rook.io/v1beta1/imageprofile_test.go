@@ -0,0 +1,42 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package v1beta1
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateImageProfiles(t *testing.T) {
+	assert.Nil(t, ValidateImageProfiles(nil))
+
+	profiles := []ImageProfileSpec{
+		{Name: "fast", Pool: "ssdpool", MinSize: "10Gi", TrashRetention: "72h"},
+		{Name: "slow", Pool: "hddpool"},
+	}
+	assert.Nil(t, ValidateImageProfiles(profiles))
+
+	profiles[1].Name = "fast"
+	assert.NotNil(t, ValidateImageProfiles(profiles))
+	profiles[1].Name = ""
+	assert.NotNil(t, ValidateImageProfiles(profiles))
+
+	profiles = []ImageProfileSpec{{Name: "fast", MinSize: "ten gigs"}}
+	assert.NotNil(t, ValidateImageProfiles(profiles))
+	profiles = []ImageProfileSpec{{Name: "fast", TrashRetention: "3 days"}}
+	assert.NotNil(t, ValidateImageProfiles(profiles))
+}
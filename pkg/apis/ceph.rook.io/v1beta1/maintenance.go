@@ -0,0 +1,157 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package v1beta1
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// MaintenanceActionRestart is the rolling restart of the daemons
+	MaintenanceActionRestart = "restart"
+	// MaintenanceActionMonFailover is the move of a healthy mon that shares a node with another mon or is on the wrong
+	// node. A mon that is out of quorum is always failed over right away.
+	MaintenanceActionMonFailover = "monFailover"
+	// MaintenanceActionSpareReplace is the replacement of an osd that is down with a spare device
+	MaintenanceActionSpareReplace = "spareReplace"
+	// MaintenanceActionReweight is a step of the crush weight of an osd towards its target weight
+	MaintenanceActionReweight = "reweight"
+	// MaintenanceActionPGGrowth is the increase of the pg count of a pool by the pg advisor
+	MaintenanceActionPGGrowth = "pgGrowth"
+)
+
+// the ranges of the minute, hour, day of month, month and day of week fields of a schedule
+var scheduleFieldRanges = [5][2]int{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 6}}
+
+// schedule is the parsed cron expression of a maintenance window. Each field holds the allowed values.
+type schedule struct {
+	fields [5]map[int]bool
+	// whether the day of month and day of week are restricted, in which case a day matching either is allowed
+	anyDayOfMonth, anyDayOfWeek bool
+}
+
+// Allows returns whether the disruptive action can be done at the given time. The actions are allowed at any time
+// when no windows are defined or when the action ignores the windows.
+func (s *MaintenanceSpec) Allows(action string, now time.Time) (bool, error) {
+	if len(s.Windows) == 0 {
+		return true, nil
+	}
+	for _, ignored := range s.IgnoreWindows {
+		if ignored == action {
+			return true, nil
+		}
+	}
+	return s.InWindow(now)
+}
+
+// InWindow returns whether the time is within one of the maintenance windows. The schedules are evaluated in UTC.
+func (s *MaintenanceSpec) InWindow(now time.Time) (bool, error) {
+	return WindowOpen(s.Windows, now)
+}
+
+// WindowOpen returns whether the time is within one of the recurring windows, such as the maintenance windows or the
+// business hours of the recovery settings. The schedules are evaluated in UTC.
+func WindowOpen(windows []MaintenanceWindow, now time.Time) (bool, error) {
+	now = now.UTC().Truncate(time.Minute)
+	for _, w := range windows {
+		sched, err := parseSchedule(w.Schedule)
+		if err != nil {
+			return false, err
+		}
+		duration, err := time.ParseDuration(w.Duration)
+		if err != nil || duration <= 0 {
+			return false, fmt.Errorf("invalid duration %q of window %q", w.Duration, w.Schedule)
+		}
+
+		// the window is open if it started during the last duration
+		for start := now; now.Sub(start) < duration; start = start.Add(-time.Minute) {
+			if sched.matches(start) {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// parseSchedule parses a cron expression with the minute, hour, day of month, month and day of week fields. Each
+// field is a `*` or a comma separated list of values and ranges, with an optional step such as `*/15` or `1-5/2`.
+func parseSchedule(expr string) (*schedule, error) {
+	parts := strings.Fields(expr)
+	if len(parts) != len(scheduleFieldRanges) {
+		return nil, fmt.Errorf("invalid schedule %q. expected %d fields", expr, len(scheduleFieldRanges))
+	}
+
+	sched := &schedule{anyDayOfMonth: parts[2] == "*", anyDayOfWeek: parts[4] == "*"}
+	for i, part := range parts {
+		values, err := parseScheduleField(part, scheduleFieldRanges[i][0], scheduleFieldRanges[i][1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid schedule %q. %+v", expr, err)
+		}
+		sched.fields[i] = values
+	}
+	return sched, nil
+}
+
+func parseScheduleField(field string, min, max int) (map[int]bool, error) {
+	values := map[int]bool{}
+	for _, item := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.Index(item, "/"); i >= 0 {
+			var err error
+			if step, err = strconv.Atoi(item[i+1:]); err != nil || step <= 0 {
+				return nil, fmt.Errorf("invalid step in %q", item)
+			}
+			item = item[:i]
+		}
+
+		low, high := min, max
+		if item != "*" {
+			bounds := strings.SplitN(item, "-", 2)
+			var err error
+			if low, err = strconv.Atoi(bounds[0]); err != nil {
+				return nil, fmt.Errorf("invalid value %q", item)
+			}
+			high = low
+			if len(bounds) == 2 {
+				if high, err = strconv.Atoi(bounds[1]); err != nil {
+					return nil, fmt.Errorf("invalid range %q", item)
+				}
+			}
+		}
+		if low < min || high > max || low > high {
+			return nil, fmt.Errorf("%q is out of the range %d-%d", item, min, max)
+		}
+		for v := low; v <= high; v += step {
+			values[v] = true
+		}
+	}
+	return values, nil
+}
+
+func (s *schedule) matches(t time.Time) bool {
+	if !s.fields[0][t.Minute()] || !s.fields[1][t.Hour()] || !s.fields[3][int(t.Month())] {
+		return false
+	}
+	dayOfMonth := s.fields[2][t.Day()]
+	dayOfWeek := s.fields[4][int(t.Weekday())]
+	if !s.anyDayOfMonth && !s.anyDayOfWeek {
+		return dayOfMonth || dayOfWeek
+	}
+	return dayOfMonth && dayOfWeek
+}
@@ -0,0 +1,88 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package v1beta1
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMaintenanceWindows(t *testing.T) {
+	// saturday
+	now := time.Date(2018, time.August, 4, 3, 30, 0, 0, time.UTC)
+	spec := MaintenanceSpec{}
+
+	// the actions are allowed at any time without windows
+	allowed, err := spec.Allows(MaintenanceActionRestart, now)
+	assert.Nil(t, err)
+	assert.True(t, allowed)
+
+	// every saturday from 2:00 to 6:00
+	spec.Windows = []MaintenanceWindow{{Schedule: "0 2 * * 6", Duration: "4h"}}
+	allowed, err = spec.Allows(MaintenanceActionRestart, now)
+	assert.Nil(t, err)
+	assert.True(t, allowed)
+	allowed, err = spec.Allows(MaintenanceActionRestart, now.Add(3*time.Hour))
+	assert.Nil(t, err)
+	assert.False(t, allowed)
+	allowed, err = spec.Allows(MaintenanceActionRestart, now.Add(-2*time.Hour))
+	assert.Nil(t, err)
+	assert.False(t, allowed)
+
+	// the window is open across midnight on weekdays
+	spec.Windows = []MaintenanceWindow{{Schedule: "30 22 * * 1-5", Duration: "2h"}}
+	inWindow, err := spec.InWindow(time.Date(2018, time.August, 7, 0, 15, 0, 0, time.UTC))
+	assert.Nil(t, err)
+	assert.True(t, inWindow)
+	inWindow, err = spec.InWindow(now)
+	assert.Nil(t, err)
+	assert.False(t, inWindow)
+
+	// the urgent actions ignore the windows
+	spec.IgnoreWindows = []string{MaintenanceActionMonFailover}
+	allowed, err = spec.Allows(MaintenanceActionMonFailover, now)
+	assert.Nil(t, err)
+	assert.True(t, allowed)
+	allowed, err = spec.Allows(MaintenanceActionRestart, now)
+	assert.Nil(t, err)
+	assert.False(t, allowed)
+
+	// either the day of month or the day of week matches when both are set
+	spec.Windows = []MaintenanceWindow{{Schedule: "*/15 3 1,15 * 6", Duration: "10m"}}
+	inWindow, err = spec.InWindow(now)
+	assert.Nil(t, err)
+	assert.True(t, inWindow)
+	inWindow, err = spec.InWindow(time.Date(2018, time.August, 15, 3, 5, 0, 0, time.UTC))
+	assert.Nil(t, err)
+	assert.True(t, inWindow)
+	inWindow, err = spec.InWindow(time.Date(2018, time.August, 16, 3, 5, 0, 0, time.UTC))
+	assert.Nil(t, err)
+	assert.False(t, inWindow)
+
+	for _, w := range []MaintenanceWindow{
+		{Schedule: "0 2 * *", Duration: "1h"},
+		{Schedule: "0 24 * * *", Duration: "1h"},
+		{Schedule: "0 5-2 * * *", Duration: "1h"},
+		{Schedule: "*/0 2 * * *", Duration: "1h"},
+		{Schedule: "0 2 * * *", Duration: "soon"},
+	} {
+		spec.Windows = []MaintenanceWindow{w}
+		_, err = spec.InWindow(now)
+		assert.NotNil(t, err, w.Schedule)
+	}
+}
@@ -0,0 +1,90 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package v1beta1
+
+import (
+	rook "github.com/rook/rook/pkg/apis/rook.io/v1alpha2"
+	"k8s.io/api/core/v1"
+)
+
+// NodeClassLabel is the label of the nodes with the name of their class
+const NodeClassLabel = "ceph.rook.io/node-class"
+
+// ApplyNodeClasses returns the placement of the daemons of the role restricted to the nodes of the classes with the
+// role. The placement is unchanged if no classes are defined.
+func ApplyNodeClasses(p rook.Placement, classes []NodeClassSpec, role string) rook.Placement {
+	if len(classes) == 0 {
+		return p
+	}
+	names := []string{}
+	for _, class := range classes {
+		if class.hasRole(role) {
+			names = append(names, class.Name)
+		}
+	}
+	if len(names) == 0 {
+		// the label cannot both exist and not exist, so that no node may host the role if no class has it
+		return withRequirements(p,
+			v1.NodeSelectorRequirement{Key: NodeClassLabel, Operator: v1.NodeSelectorOpExists},
+			v1.NodeSelectorRequirement{Key: NodeClassLabel, Operator: v1.NodeSelectorOpDoesNotExist})
+	}
+	return withRequirements(p, v1.NodeSelectorRequirement{Key: NodeClassLabel, Operator: v1.NodeSelectorOpIn, Values: names})
+}
+
+// GetNodeClass returns the class of the node with the labels, or nil if the node is not in a class
+func GetNodeClass(classes []NodeClassSpec, nodeLabels map[string]string) *NodeClassSpec {
+	name, ok := nodeLabels[NodeClassLabel]
+	if !ok {
+		return nil
+	}
+	for i := range classes {
+		if classes[i].Name == name {
+			return &classes[i]
+		}
+	}
+	return nil
+}
+
+func (c NodeClassSpec) hasRole(role string) bool {
+	for _, r := range c.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// withRequirements adds the requirements to each term of the required node affinity of the placement, so that
+// a node must match both the placement and the requirements
+func withRequirements(p rook.Placement, requirements ...v1.NodeSelectorRequirement) rook.Placement {
+	terms := []v1.NodeSelectorTerm{}
+	if p.NodeAffinity != nil && p.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution != nil {
+		for _, term := range p.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms {
+			expressions := append([]v1.NodeSelectorRequirement{}, term.MatchExpressions...)
+			terms = append(terms, v1.NodeSelectorTerm{MatchExpressions: append(expressions, requirements...)})
+		}
+	}
+	if len(terms) == 0 {
+		terms = append(terms, v1.NodeSelectorTerm{MatchExpressions: requirements})
+	}
+
+	affinity := &v1.NodeAffinity{RequiredDuringSchedulingIgnoredDuringExecution: &v1.NodeSelector{NodeSelectorTerms: terms}}
+	if p.NodeAffinity != nil {
+		affinity.PreferredDuringSchedulingIgnoredDuringExecution = p.NodeAffinity.PreferredDuringSchedulingIgnoredDuringExecution
+	}
+	p.NodeAffinity = affinity
+	return p
+}
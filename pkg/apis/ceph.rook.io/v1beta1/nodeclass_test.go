@@ -0,0 +1,67 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package v1beta1
+
+import (
+	"testing"
+
+	rook "github.com/rook/rook/pkg/apis/rook.io/v1alpha2"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/api/core/v1"
+)
+
+func TestApplyNodeClasses(t *testing.T) {
+	classes := []NodeClassSpec{
+		{Name: "storage", Roles: []string{PlacementKeyOSD}},
+		{Name: "control", Roles: []string{PlacementKeyMon, PlacementKeyMgr}},
+		{Name: "client"},
+	}
+
+	// the placement is unchanged without classes
+	p := ApplyNodeClasses(rook.Placement{}, nil, PlacementKeyOSD)
+	assert.Nil(t, p.NodeAffinity)
+
+	p = ApplyNodeClasses(rook.Placement{}, classes, PlacementKeyOSD)
+	terms := p.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms
+	assert.Equal(t, 1, len(terms))
+	assert.Equal(t, []v1.NodeSelectorRequirement{{Key: NodeClassLabel, Operator: v1.NodeSelectorOpIn, Values: []string{"storage"}}},
+		terms[0].MatchExpressions)
+
+	// the classes are added to each term of the placement
+	zone := v1.NodeSelectorRequirement{Key: "zone", Operator: v1.NodeSelectorOpIn, Values: []string{"a"}}
+	placement := rook.Placement{NodeAffinity: &v1.NodeAffinity{RequiredDuringSchedulingIgnoredDuringExecution: &v1.NodeSelector{
+		NodeSelectorTerms: []v1.NodeSelectorTerm{{MatchExpressions: []v1.NodeSelectorRequirement{zone}}},
+	}}}
+	p = ApplyNodeClasses(placement, classes, PlacementKeyMon)
+	terms = p.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms
+	assert.Equal(t, []v1.NodeSelectorRequirement{zone, {Key: NodeClassLabel, Operator: v1.NodeSelectorOpIn, Values: []string{"control"}}},
+		terms[0].MatchExpressions)
+	// the original placement is not modified
+	assert.Equal(t, 1, len(placement.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms[0].MatchExpressions))
+
+	// no node may host a role without a class
+	p = ApplyNodeClasses(rook.Placement{}, classes[2:], PlacementKeyMgr)
+	terms = p.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms
+	assert.Equal(t, 2, len(terms[0].MatchExpressions))
+}
+
+func TestGetNodeClass(t *testing.T) {
+	classes := []NodeClassSpec{{Name: "storage"}, {Name: "control"}}
+	class := GetNodeClass(classes, map[string]string{NodeClassLabel: "control"})
+	assert.Equal(t, "control", class.Name)
+	assert.Nil(t, GetNodeClass(classes, map[string]string{NodeClassLabel: "other"}))
+	assert.Nil(t, GetNodeClass(classes, map[string]string{}))
+}
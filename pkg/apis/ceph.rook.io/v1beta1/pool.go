@@ -22,12 +22,18 @@ func (p *PoolSpec) ToModel(name string) *model.Pool {
 	r := p.Replication()
 	if r != nil {
 		pool.ReplicatedConfig.Size = r.Size
+		pool.ReplicatedConfig.ReplicasPerFailureDomain = r.ReplicasPerFailureDomain
 		pool.Type = model.Replicated
 	} else {
 		ec := p.ErasureCode()
 		if ec != nil {
 			pool.ErasureCodedConfig.CodingChunkCount = ec.CodingChunks
 			pool.ErasureCodedConfig.DataChunkCount = ec.DataChunks
+			pool.ErasureCodedConfig.FailureDomain = ec.FailureDomain
+			pool.ErasureCodedConfig.CrushRoot = ec.CrushRoot
+			pool.ErasureCodedConfig.Plugin = ec.Plugin
+			pool.ErasureCodedConfig.Locality = ec.Locality
+			pool.ErasureCodedConfig.Durability = ec.Durability
 			pool.Type = model.ErasureCoded
 		}
 	}
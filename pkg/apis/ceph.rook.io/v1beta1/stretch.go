@@ -0,0 +1,66 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package v1beta1
+
+import "fmt"
+
+const (
+	// DefaultSiteLabel is the label of the nodes with their site if the stretch settings do not name a label
+	DefaultSiteLabel = "failure-domain.beta.kubernetes.io/zone"
+	// SiteCrushType is the type of the buckets of the sites in the crush map
+	SiteCrushType = "datacenter"
+)
+
+// Enabled returns whether the cluster is stretched over two sites
+func (s *StretchSpec) Enabled() bool {
+	return len(s.Sites) > 0
+}
+
+// GetSiteLabel returns the label of the nodes with their site
+func (s *StretchSpec) GetSiteLabel() string {
+	if s.SiteLabel == "" {
+		return DefaultSiteLabel
+	}
+	return s.SiteLabel
+}
+
+// Validate checks that there are two sites with a separate tiebreaker, and enough mons to keep the quorum when a
+// site is lost
+func (s *StretchSpec) Validate(monCount int) error {
+	if !s.Enabled() {
+		return nil
+	}
+	if len(s.Sites) != 2 || s.Sites[0] == "" || s.Sites[1] == "" || s.Sites[0] == s.Sites[1] {
+		return fmt.Errorf("a stretched cluster needs two different sites, not %v", s.Sites)
+	}
+	if s.Tiebreaker == "" {
+		return fmt.Errorf("a stretched cluster needs a tiebreaker site")
+	}
+	if s.Tiebreaker == s.Sites[0] || s.Tiebreaker == s.Sites[1] {
+		return fmt.Errorf("the tiebreaker %s cannot be one of the sites", s.Tiebreaker)
+	}
+	if monCount < 3 || monCount%2 == 0 {
+		return fmt.Errorf("a stretched cluster needs an odd number of mons of at least 3, not %d", monCount)
+	}
+	return nil
+}
+
+// MonsPerSite returns how many of the mons are placed in each site. The tiebreaker has a single mon and the other mons
+// are split evenly between the two sites.
+func (s *StretchSpec) MonsPerSite(monCount int) map[string]int {
+	perSite := (monCount - 1) / 2
+	return map[string]int{s.Sites[0]: perSite, s.Sites[1]: perSite, s.Tiebreaker: 1}
+}
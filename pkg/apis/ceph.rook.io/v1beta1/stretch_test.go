@@ -0,0 +1,46 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package v1beta1
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStretchSpec(t *testing.T) {
+	s := StretchSpec{}
+	assert.False(t, s.Enabled())
+	assert.Nil(t, s.Validate(1))
+
+	s = StretchSpec{Sites: []string{"dc1", "dc2"}, Tiebreaker: "dc3"}
+	assert.True(t, s.Enabled())
+	assert.Equal(t, DefaultSiteLabel, s.GetSiteLabel())
+	assert.Nil(t, s.Validate(5))
+	assert.Equal(t, map[string]int{"dc1": 2, "dc2": 2, "dc3": 1}, s.MonsPerSite(5))
+
+	// the quorum must survive the loss of a site
+	assert.NotNil(t, s.Validate(1))
+	assert.NotNil(t, s.Validate(4))
+
+	s.Tiebreaker = "dc2"
+	assert.NotNil(t, s.Validate(3))
+	s.Tiebreaker = ""
+	assert.NotNil(t, s.Validate(3))
+	s = StretchSpec{Sites: []string{"dc1"}, Tiebreaker: "dc3", SiteLabel: "site"}
+	assert.Equal(t, "site", s.GetSiteLabel())
+	assert.NotNil(t, s.Validate(3))
+}
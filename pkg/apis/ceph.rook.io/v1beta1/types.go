@@ -71,17 +71,262 @@ type ClusterSpec struct {
 
 	// Dashboard settings
 	Dashboard DashboardSpec `json:"dashboard,omitempty"`
+
+	// Security settings for the cluster keys and connections
+	Security SecuritySpec `json:"security,omitempty"`
+
+	// Maintenance settings to hold off changes to the cluster
+	Maintenance MaintenanceSpec `json:"maintenance,omitempty"`
+
+	// Restart settings to restart the daemons one at a time
+	Restart RestartSpec `json:"restart,omitempty"`
+
+	// Recovery settings to limit the impact of the recovery and backfill of the osds on the clients
+	Recovery RecoverySpec `json:"recovery,omitempty"`
+
+	// Logs settings to write the logs of the mons and osds to files on the hosts
+	Logs LogSpec `json:"logs,omitempty"`
+
+	// NetworkCheck settings to measure the network between the nodes of the osds
+	NetworkCheck NetworkCheckSpec `json:"networkCheck,omitempty"`
+
+	// NodeClasses are the classes of nodes with the daemons each class may host
+	NodeClasses []NodeClassSpec `json:"nodeClasses,omitempty"`
+
+	// External settings to consume a ceph cluster that is managed outside of rook
+	External ExternalSpec `json:"external,omitempty"`
+
+	// Stretch settings to spread the cluster over two sites
+	Stretch StretchSpec `json:"stretch,omitempty"`
+
+	// Notifications settings to notify the external systems of the events of the cluster
+	Notifications NotificationSpec `json:"notifications,omitempty"`
+
+	// ImageProfiles are the named defaults of the block images provisioned for the storage classes of the cluster
+	ImageProfiles []ImageProfileSpec `json:"imageProfiles,omitempty"`
+}
+
+// ImageProfileSpec represents the defaults of the block images of a storage class that references the profile by
+// name. The parameters of the storage class override the settings of its profile.
+type ImageProfileSpec struct {
+	// The name of the profile, which is the profile parameter of the storage classes
+	Name string `json:"name"`
+	// The pool the images are created in
+	Pool string `json:"pool,omitempty"`
+	// The erasure coded pool of the data of the images
+	DataPool string `json:"dataPool,omitempty"`
+	// The comma separated features of the images. Defaults to layering,exclusive-lock,object-map,fast-diff.
+	ImageFeatures string `json:"imageFeatures,omitempty"`
+	// The filesystem the images are formatted with
+	FSType string `json:"fsType,omitempty"`
+	// The smallest size of the images, such as 10Gi. The claims that request less get an image of this size.
+	MinSize string `json:"minSize,omitempty"`
+	// The IO limits of the images
+	QoS ImageQoSSpec `json:"qos,omitempty"`
+	// How long the images of deleted volumes are kept in the trash, such as 72h
+	TrashRetention string `json:"trashRetention,omitempty"`
+	// Whether all the objects of the images are written when they are provisioned
+	ThickProvision bool `json:"thickProvision,omitempty"`
+}
+
+// ImageQoSSpec represents the IO limits of a block image. A zero limit is unlimited.
+type ImageQoSSpec struct {
+	IOPSLimit uint64 `json:"iopsLimit,omitempty"`
+	BPSLimit  uint64 `json:"bpsLimit,omitempty"`
+	IOPSBurst uint64 `json:"iopsBurst,omitempty"`
+	BPSBurst  uint64 `json:"bpsBurst,omitempty"`
+}
+
+// NotificationSpec represents the external systems that are notified of the events of the cluster, such as a pool
+// created, an osd failed, a node joined or the health degraded
+type NotificationSpec struct {
+	// The webhooks the events are posted to
+	Webhooks []WebhookSpec `json:"webhooks,omitempty"`
+	// The snmp managers the events are sent to as traps
+	SNMP SNMPSpec `json:"snmp,omitempty"`
+}
+
+// SNMPSpec represents the snmp managers that get the events of the cluster as snmp v2c traps. The traps are defined in
+// the ROOK-CEPH-MIB.
+type SNMPSpec struct {
+	// The host:port of the managers the traps are sent to. The port defaults to 162.
+	Targets []string `json:"targets,omitempty"`
+	// The secret in the namespace of the cluster with the community of the traps in its community key. The community
+	// is public if empty.
+	SecretName string `json:"secretName,omitempty"`
+	// The reasons of the events sent as traps, such as HealthDegraded. All the events are sent if empty.
+	Events []string `json:"events,omitempty"`
+}
+
+// WebhookSpec represents a url the events of the cluster are posted to as json
+type WebhookSpec struct {
+	// The name of the webhook, under which its deliveries are recorded
+	Name string `json:"name"`
+	// The url the events are posted to
+	URL string `json:"url"`
+	// The secret in the namespace of the cluster with the key that signs the events. The events are not signed if empty.
+	SecretName string `json:"secretName,omitempty"`
+	// The reasons of the events posted to the webhook, such as PoolCreated or OSDFailed. All the events are posted if
+	// empty.
+	Events []string `json:"events,omitempty"`
+}
+
+// ExternalSpec represents the settings for a ceph cluster whose daemons are managed outside of rook. The mons of the
+// cluster are given in the mon endpoints configmap and its keys in the mon secret of the namespace.
+type ExternalSpec struct {
+	// Whether the cluster is external, in which case rook only connects to it and manages its pools
+	Enable bool `json:"enable,omitempty"`
+}
+
+// StretchSpec represents a cluster stretched over two sites, such as two datacenters or rooms. The mons are split
+// between the two sites with a tiebreaker mon in a third site, and the osds are placed under the datacenter of their
+// site in the crush map.
+type StretchSpec struct {
+	// The label of the nodes with the name of their site. Defaults to failure-domain.beta.kubernetes.io/zone.
+	SiteLabel string `json:"siteLabel,omitempty"`
+	// The two sites where the data is stored
+	Sites []string `json:"sites,omitempty"`
+	// The site where the tiebreaker mon runs. No data is stored in the tiebreaker site.
+	Tiebreaker string `json:"tiebreaker,omitempty"`
+}
+
+// SiteStatus represents the health of the daemons in a site of a stretched cluster
+type SiteStatus struct {
+	Name string `json:"name"`
+	// The number of mons of the site in quorum and the total number of mons in the site
+	MonsInQuorum int `json:"monsInQuorum"`
+	Mons         int `json:"mons"`
+	// The number of osds of the site that are up and the total number of osds in the site
+	OSDsUp int `json:"osdsUp"`
+	OSDs   int `json:"osds"`
+}
+
+// NodeClassSpec represents a class of nodes, such as storage-heavy, mon-only or client-only nodes. The nodes are in
+// the class with the label ceph.rook.io/node-class.
+type NodeClassSpec struct {
+	// The name of the class, which is the value of the label of its nodes
+	Name string `json:"name"`
+	// The daemons the nodes of the class may host: mon, mgr and osd. A class without roles hosts no daemons.
+	Roles []string `json:"roles,omitempty"`
+	// The resources of the osds on the nodes of the class, which override the osd resources of the cluster
+	Resources v1.ResourceRequirements `json:"resources,omitempty"`
+	// The osd config settings of the nodes of the class, which override the config of the cluster. The config of a
+	// node in the storage settings overrides the config of its class.
+	Config map[string]string `json:"config,omitempty"`
+}
+
+// LogSpec represents the settings for the log files of the mons and osds in the dataDirHostPath
+type LogSpec struct {
+	// Whether the mons and osds write their logs to files instead of stdout
+	ToFile bool `json:"toFile,omitempty"`
+	// The size in MB at which the log file of a daemon is rotated. Defaults to 100.
+	MaxSizeMB int `json:"maxSizeMB,omitempty"`
+	// The number of rotated log files kept for each daemon. Defaults to 5.
+	MaxFiles int `json:"maxFiles,omitempty"`
+	// Whether the rotated log files are compressed with gzip
+	Compress bool `json:"compress,omitempty"`
+	// The forwarding of the logs of the mons, mgrs and osds to the journal or the syslog of the nodes, or to a remote
+	// syslog server
+	Forward LogForwardSpec `json:"forward,omitempty"`
+}
+
+// LogForwardSpec represents where the logs of the rook processes and of the ceph daemons they run are forwarded. The
+// logs are forwarded with the cluster, the node and the daemon as structured fields.
+type LogForwardSpec struct {
+	// Where the logs are forwarded: journald, syslog, or the udp:// or tcp:// url of a syslog server. The logs are not
+	// forwarded if empty.
+	Target string `json:"target,omitempty"`
+	// The syslog facility of the logs, such as daemon or local0. Defaults to daemon.
+	Facility string `json:"facility,omitempty"`
+}
+
+// NetworkCheckSpec represents the settings for the diagnostic of the network between the nodes of the osds
+type NetworkCheckSpec struct {
+	// Changing the generation triggers a measurement of the latency and throughput between the nodes
+	Generation int `json:"generation,omitempty"`
+	// The number of other nodes measured from each node. All the other nodes are measured if zero.
+	SampleSize int `json:"sampleSize,omitempty"`
+}
+
+// MaintenanceSpec represents the settings for a maintenance window of the cluster
+type MaintenanceSpec struct {
+	// Whether changes to the cluster and its pools, filesystems and object stores are deferred
+	ReadOnly bool `json:"readOnly,omitempty"`
+	// The reason for the maintenance that is reported for the deferred changes
+	Reason string `json:"reason,omitempty"`
+	// The windows in which the disruptive automatic actions are done. The actions are done at any time if empty.
+	Windows []MaintenanceWindow `json:"windows,omitempty"`
+	// The disruptive actions that are urgent enough to be done outside of the windows, such as spareReplace
+	IgnoreWindows []string `json:"ignoreWindows,omitempty"`
+}
+
+// MaintenanceWindow represents a recurring time range in which disruptive actions are allowed
+type MaintenanceWindow struct {
+	// The cron expression in UTC of the start of the window, such as "0 2 * * 6" for every Saturday at 2:00
+	Schedule string `json:"schedule"`
+	// How long the window stays open after it starts, such as "4h"
+	Duration string `json:"duration"`
+}
+
+// RecoverySpec represents the settings for the recovery and backfill of the osds
+type RecoverySpec struct {
+	// The recovery profile of the osds: aggressive, balanced or low-impact. Defaults to balanced if business hours are
+	// set. The recovery settings of the osds are not changed if neither is set.
+	Profile string `json:"profile,omitempty"`
+	// The windows in which the low-impact profile is applied instead, such as the business hours
+	BusinessHours []MaintenanceWindow `json:"businessHours,omitempty"`
+}
+
+// RestartSpec represents the settings for the rolling restart of the daemons
+type RestartSpec struct {
+	// Changing the generation triggers a rolling restart of the daemons
+	Generation int `json:"generation,omitempty"`
+	// The types of daemons to restart: mon, mgr, osd, mds and rgw. All the daemons are restarted if empty.
+	Daemons []string `json:"daemons,omitempty"`
+	// Whether the daemons are restarted when the config override is changed
+	OnConfigChange bool `json:"onConfigChange,omitempty"`
+}
+
+// SecuritySpec represents the settings for the cluster keys and connections
+type SecuritySpec struct {
+	// Changing the generation triggers the rotation of the client.admin key
+	AdminKeyGeneration int `json:"adminKeyGeneration,omitempty"`
+	// Whether the daemons and clients require the messages to be signed with their cephx session key
+	RequireSignatures bool `json:"requireSignatures,omitempty"`
+	// The encryption of the connections: empty for none, "prefer" or "require"
+	Encryption string `json:"encryption,omitempty"`
 }
 
 // DashboardSpec represents the settings for the Ceph dashboard
 type DashboardSpec struct {
 	// Whether to enable the dashboard
 	Enabled bool `json:"enabled,omitempty"`
+	// The path the dashboard is served at, such as /ui. The dashboard is served at the root if empty.
+	URLPrefix string `json:"urlPrefix,omitempty"`
 }
 
 type ClusterStatus struct {
 	State   ClusterState `json:"state,omitempty"`
 	Message string       `json:"message,omitempty"`
+	// The number of distinct crashes of the daemons seen in the last two weeks
+	NewCrashes int `json:"newCrashes,omitempty"`
+	// The progress of the recovery and backfill of the objects, while the cluster is rebalancing
+	Rebalance *RebalanceStatus `json:"rebalance,omitempty"`
+	// The osds that were quarantined since they were flapping
+	QuarantinedOSDs []int `json:"quarantinedOSDs,omitempty"`
+	// The health of the sites of a stretched cluster
+	Sites []SiteStatus `json:"sites,omitempty"`
+}
+
+// RebalanceStatus represents the progress of the recovery and backfill of the objects after a change to the osds
+type RebalanceStatus struct {
+	DegradedObjects  uint64 `json:"degradedObjects"`
+	MisplacedObjects uint64 `json:"misplacedObjects"`
+	TotalObjects     uint64 `json:"totalObjects"`
+	// The rate at which the degraded and misplaced objects decreased recently
+	ObjectsPerSec string `json:"objectsPerSec"`
+	// The estimated time until the cluster is rebalanced, unknown until the objects decrease
+	TimeLeft string `json:"timeLeft,omitempty"`
 }
 
 type ClusterState string
@@ -129,12 +374,31 @@ type PoolSpec struct {
 
 	// The erasure code settings
 	ErasureCoded ErasureCodedSpec `json:"erasureCoded"`
+
+	// The rados namespaces to create in the pool for isolating the rbd images of different tenants
+	Namespaces []string `json:"namespaces,omitempty"`
+
+	// The limits of the capacity that can be provisioned from the pool
+	Quota QuotaSpec `json:"quota,omitempty"`
+}
+
+// QuotaSpec represents the limits of the total size of the block images provisioned from a pool. Since the images
+// are thin provisioned, the limits apply to the size of the images rather than to the data stored in the pool.
+type QuotaSpec struct {
+	// The total size of the images in the pool, such as "10Ti"
+	MaxProvisionedSize string `json:"maxProvisionedSize,omitempty"`
+	// The total size of the images in each rados namespace of the pool
+	MaxProvisionedSizePerNamespace string `json:"maxProvisionedSizePerNamespace,omitempty"`
 }
 
 // ReplicationSpec represents the spec for replication in a pool
 type ReplicatedSpec struct {
 	// Number of copies per object in a replicated storage pool, including the object itself (required for replicated pool type)
 	Size uint `json:"size"`
+
+	// The number of replicas placed on different hosts in each failure domain, such as two replicas in each
+	// datacenter of a stretched cluster. The replicas are placed in different failure domains if not set.
+	ReplicasPerFailureDomain uint `json:"replicasPerFailureDomain,omitempty"`
 }
 
 // ErasureCodeSpec represents the spec for erasure code in a pool
@@ -147,6 +411,24 @@ type ErasureCodedSpec struct {
 
 	// The algorithm for erasure coding
 	Algorithm string `json:"algorithm"`
+
+	// The failure domain of the chunks in the erasure code profile, such as osd, host or rack. The failure domain of
+	// the pool is used if not set.
+	FailureDomain string `json:"failureDomain,omitempty"`
+
+	// The root in the crush map where the chunks are placed. The crush root of the pool is used if not set.
+	CrushRoot string `json:"crushRoot,omitempty"`
+
+	// The erasure code plugin: jerasure, isa, lrc or shec. The plugin of the default profile is used if not set.
+	Plugin string `json:"plugin,omitempty"`
+
+	// The number of chunks in each locality group of the lrc plugin. Each group has a local parity chunk so a lost
+	// chunk can be recovered from the chunks of its group.
+	Locality uint `json:"locality,omitempty"`
+
+	// The durability estimator of the shec plugin, the number of coding chunks each data chunk is covered by. It is
+	// the number of chunks that can be lost without losing data.
+	Durability uint `json:"durability,omitempty"`
 }
 
 // +genclient
@@ -177,6 +459,10 @@ type FilesystemSpec struct {
 
 	// The mds pod info
 	MetadataServer MetadataServerSpec `json:"metadataServer"`
+
+	// Whether snapshots of the directories of the file system can be created. The setting of the file system is not
+	// changed if not set.
+	AllowSnapshots *bool `json:"allowSnapshots,omitempty"`
 }
 
 type MetadataServerSpec struct {
@@ -187,6 +473,14 @@ type MetadataServerSpec struct {
 	// If false, standbys will still be available, but will not have a warm metadata cache.
 	ActiveStandby bool `json:"activeStandby"`
 
+	// The memory limit of the metadata cache of each MDS in MB. The MDS may use up to 50% more memory than its cache limit.
+	CacheMemoryLimitMB int `json:"cacheMemoryLimitMB,omitempty"`
+
+	// The seconds without a renewal from a client before its capabilities are revoked, and the seconds before its session
+	// is closed
+	SessionTimeout   int `json:"sessionTimeout,omitempty"`
+	SessionAutoclose int `json:"sessionAutoclose,omitempty"`
+
 	// The affinity to place the mds pods (default is to place on all available node) with a daemonset
 	Placement rook.Placement `json:"placement"`
 
@@ -237,9 +531,21 @@ type GatewaySpec struct {
 	// Whether the rgw pods should be started as a daemonset on all nodes
 	AllNodes bool `json:"allNodes"`
 
-	// The name of the secret that stores the ssl certificate for secure rgw connections
+	// The name of the secret that stores the ssl certificate for secure rgw connections. The secret has either a
+	// "cert" key with the key and certificate in one pem file, or is a kubernetes tls secret.
 	SSLCertificateRef string `json:"sslCertificateRef"`
 
+	// The DNS name of the object store, such as s3.example.com, to access the buckets as subdomains with
+	// virtual-hosted-style requests
+	DNSName string `json:"dnsName,omitempty"`
+
+	// Whether the buckets with a website configuration are served as static websites
+	StaticWebsite bool `json:"staticWebsite,omitempty"`
+
+	// The DNS name of the website endpoint of the object store, such as website.example.com, to serve the static
+	// websites of the buckets at <bucket>.website.example.com
+	WebsiteDNSName string `json:"websiteDnsName,omitempty"`
+
 	// The affinity to place the rgw pods (default is to place on any available node)
 	Placement rook.Placement `json:"placement"`
 
@@ -83,10 +83,18 @@ func (s *StorageScopeSpec) resolveNodeSelection(node *Node) {
 
 	resolveString(&(node.Selection.DeviceFilter), s.Selection.DeviceFilter, "")
 
+	if node.Selection.DeviceAttributes == nil {
+		node.Selection.DeviceAttributes = s.DeviceAttributes
+	}
+
 	if len(node.Selection.Devices) == 0 {
 		node.Selection.Devices = s.Devices
 	}
 
+	if len(node.Selection.Spares) == 0 {
+		node.Selection.Spares = s.Spares
+	}
+
 	if len(node.Selection.Directories) == 0 {
 		node.Selection.Directories = s.Directories
 	}
@@ -53,6 +53,7 @@ func TestResolveNodeInherentFromCluster(t *testing.T) {
 			DeviceFilter: "^sd.",
 			Directories:  []Directory{{Path: "/rook/datadir1"}},
 			Devices:      []Device{{Name: "sda"}},
+			Spares:       []Device{{Name: "sdz"}},
 		},
 		Config: map[string]string{
 			"foo": "bar",
@@ -70,6 +71,7 @@ func TestResolveNodeInherentFromCluster(t *testing.T) {
 	assert.Equal(t, "bar", node.Config["foo"])
 	assert.Equal(t, []Directory{{Path: "/rook/datadir1"}}, node.Directories)
 	assert.Equal(t, []Device{{Name: "sda"}}, node.Devices)
+	assert.Equal(t, []Device{{Name: "sdz"}}, node.Spares)
 }
 
 func TestResolveNodeSpecificProperties(t *testing.T) {
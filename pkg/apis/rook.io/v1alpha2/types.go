@@ -64,11 +64,30 @@ type Selection struct {
 	// A regular expression to allow more fine-grained selection of devices on nodes across the cluster
 	DeviceFilter string `json:"deviceFilter,omitempty"`
 
+	// The attributes of the devices selected by useAllDevices or the deviceFilter, such as all the rotational disks of 4T or more
+	DeviceAttributes *DeviceAttributes `json:"deviceAttributes,omitempty"`
+
 	Devices []Device `json:"devices,omitempty"`
 
+	// Empty devices that are not provisioned until they replace an osd that failed permanently
+	Spares []Device `json:"spares,omitempty"`
+
 	Directories []Directory `json:"directories,omitempty"`
 }
 
+// DeviceAttributes filters the devices discovered on a node by their attributes. All the attributes that are set must match.
+type DeviceAttributes struct {
+	// Rotational selects the hdds if true, or the ssds and nvme devices if false
+	Rotational *bool `json:"rotational,omitempty"`
+	// MinSize and MaxSize are the bounds of the size of the devices, in the quantity format of kubernetes (e.g. 4T or 500Gi)
+	MinSize string `json:"minSize,omitempty"`
+	MaxSize string `json:"maxSize,omitempty"`
+	// Model is a regular expression matching the model of the devices
+	Model string `json:"model,omitempty"`
+	// Exclude is a regular expression matching the names of the devices that are not selected
+	Exclude string `json:"exclude,omitempty"`
+}
+
 type PlacementSpec map[string]Placement
 
 type Placement struct {
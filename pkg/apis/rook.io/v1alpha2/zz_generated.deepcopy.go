@@ -64,6 +64,31 @@ func (in *Device) DeepCopy() *Device {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DeviceAttributes) DeepCopyInto(out *DeviceAttributes) {
+	*out = *in
+	if in.Rotational != nil {
+		in, out := &in.Rotational, &out.Rotational
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(bool)
+			**out = **in
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DeviceAttributes.
+func (in *DeviceAttributes) DeepCopy() *DeviceAttributes {
+	if in == nil {
+		return nil
+	}
+	out := new(DeviceAttributes)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Directory) DeepCopyInto(out *Directory) {
 	*out = *in
@@ -212,6 +237,15 @@ func (in *Selection) DeepCopyInto(out *Selection) {
 			**out = **in
 		}
 	}
+	if in.DeviceAttributes != nil {
+		in, out := &in.DeviceAttributes, &out.DeviceAttributes
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(DeviceAttributes)
+			(*in).DeepCopyInto(*out)
+		}
+	}
 	if in.Devices != nil {
 		in, out := &in.Devices, &out.Devices
 		*out = make([]Device, len(*in))
@@ -219,6 +253,13 @@ func (in *Selection) DeepCopyInto(out *Selection) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.Spares != nil {
+		in, out := &in.Spares, &out.Spares
+		*out = make([]Device, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 	if in.Directories != nil {
 		in, out := &in.Directories, &out.Directories
 		*out = make([]Directory, len(*in))
@@ -28,6 +28,9 @@ import (
 var (
 	logger = capnslog.NewPackageLogger("github.com/rook/rook", "inventory")
 	isRBD  = regexp.MustCompile("^rbd[0-9]+p?[0-9]{0,}$")
+	// the boot and replay protected partitions of the emmc storage and the raw flash of the arm boards cannot hold osds
+	isEMMCHardwarePartition = regexp.MustCompile("^mmcblk[0-9]+(boot[0-9]+|rpmb)$")
+	isMTD                   = regexp.MustCompile("^mtdblock[0-9]+$")
 )
 
 func GetAvailableDevices(devices []*sys.LocalDisk) []string {
@@ -50,7 +53,7 @@ func GetDeviceEmpty(device *sys.LocalDisk) bool {
 }
 
 func ignoreDevice(d string) bool {
-	return isRBD.MatchString(d)
+	return isRBD.MatchString(d) || isEMMCHardwarePartition.MatchString(d) || isMTD.MatchString(d)
 }
 
 // Discover all the details of devices available on the local node
@@ -84,6 +84,14 @@ func TestIgnoreDevice(t *testing.T) {
 		"rbd":     false,
 		"arbd0":   false,
 		"rbd0x":   false,
+
+		"mmcblk0boot0": true,
+		"mmcblk1boot1": true,
+		"mmcblk0rpmb":  true,
+		"mtdblock0":    true,
+		"mmcblk0":      false,
+		"mmcblk0p1":    false,
+		"mtdblock":     false,
 	}
 	for dev, expected := range cases {
 		assert.Equal(t, expected, ignoreDevice(dev), dev)
@@ -31,6 +31,8 @@ import (
 	"github.com/rook/rook/pkg/daemon/ceph/agent/flexvolume"
 	"github.com/rook/rook/pkg/daemon/ceph/agent/flexvolume/attachment"
 	"github.com/rook/rook/pkg/daemon/ceph/agent/flexvolume/manager/ceph"
+	opagent "github.com/rook/rook/pkg/operator/ceph/agent"
+	"github.com/rook/rook/pkg/operator/k8sutil"
 	"k8s.io/api/core/v1"
 )
 
@@ -38,22 +40,29 @@ var logger = capnslog.NewPackageLogger("github.com/rook/rook", "rook-ceph-agent"
 
 // Agent represent all the references needed to manage a Rook agent
 type Agent struct {
-	context *clusterd.Context
+	context       *clusterd.Context
+	offlineWindow time.Duration
 }
 
-// New creates an Agent instance
-func New(context *clusterd.Context) *Agent {
-	return &Agent{context: context}
+// New creates an Agent instance. The volumes are detached for up to the offline window while the kubernetes api is unreachable.
+func New(context *clusterd.Context, offlineWindow time.Duration) *Agent {
+	return &Agent{context: context, offlineWindow: offlineWindow}
 }
 
 // Run the agent
 func (a *Agent) Run() error {
 
-	volumeAttachmentController, err := attachment.New(a.context)
+	volumeAttachmentCRD, err := attachment.New(a.context)
 	if err != nil {
 		return fmt.Errorf("failed to create volume attachment controller: %+v", err)
 	}
 
+	// keep a local copy of the volumes attached on the node, so they can still be detached while the api is unreachable
+	volumeAttachmentController, err := attachment.NewBuffer(volumeAttachmentCRD, opagent.StateDirPath, os.Getenv(k8sutil.NodeNameEnvVar), a.offlineWindow)
+	if err != nil {
+		return fmt.Errorf("failed to create volume attachment buffer: %+v", err)
+	}
+
 	volumeManager, err := ceph.NewVolumeManager(a.context)
 	if err != nil {
 		return fmt.Errorf("failed to create volume manager: %+v", err)
@@ -106,6 +115,7 @@ func (a *Agent) Run() error {
 		flexvolumeController,
 		volumeAttachmentController)
 	stopChan := make(chan struct{})
+	volumeAttachmentController.Run(stopChan)
 	clusterController.StartWatch(v1.NamespaceAll, stopChan)
 
 	sigc := make(chan os.Signal, 1)
@@ -0,0 +1,192 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package flexvolume
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/rook/rook/pkg/clusterd"
+	"github.com/rook/rook/pkg/operator/ceph/cluster/mon"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// the access info of a cluster is loaded again after this time even if no change of the mons or keys was seen
+var clientAccessInfoTTL = 10 * time.Minute
+
+// accessInfoCache keeps the access info of each cluster, so that the pods mounting volumes at the same time do not
+// all load it from the mon endpoints and the secret of the cluster. The access info is loaded once for the requests
+// that come while it is loading, and is dropped when the mon endpoints or the keys of the cluster are changed.
+type accessInfoCache struct {
+	context *clusterd.Context
+	load    func(namespace string) (ClientAccessInfo, error)
+	now     func() time.Time
+
+	sync.Mutex
+	entries map[string]*accessInfoEntry
+}
+
+type accessInfoEntry struct {
+	// closed when the access info is loaded
+	ready   chan struct{}
+	info    ClientAccessInfo
+	err     error
+	expires time.Time
+	// closed when the entry is dropped, which stops the watch of the changes
+	stop chan struct{}
+}
+
+// accessInfoVersions are the resource versions of the mon endpoints and of the secret of a cluster when its access
+// info was loaded, from which the changes are watched
+type accessInfoVersions struct {
+	endpoints string
+	secret    string
+}
+
+func newAccessInfoCache(context *clusterd.Context, load func(namespace string) (ClientAccessInfo, error)) *accessInfoCache {
+	return &accessInfoCache{context: context, load: load, now: time.Now, entries: map[string]*accessInfoEntry{}}
+}
+
+// get returns the access info of the cluster in the namespace, loading it if it is not cached
+func (c *accessInfoCache) get(namespace string) (ClientAccessInfo, error) {
+	c.Lock()
+	e, ok := c.entries[namespace]
+	if ok && e.loaded() && !c.now().Before(e.expires) {
+		c.drop(namespace)
+		ok = false
+	}
+	if ok {
+		c.Unlock()
+		<-e.ready
+		return e.info, e.err
+	}
+	e = &accessInfoEntry{ready: make(chan struct{}), stop: make(chan struct{})}
+	c.entries[namespace] = e
+	c.Unlock()
+
+	// the versions are read before the load, so a change made while the access info is loading is seen by the watch
+	watching := c.context != nil && c.context.Clientset != nil
+	var versions accessInfoVersions
+	var info ClientAccessInfo
+	var err error
+	if watching {
+		versions, err = c.versions(namespace)
+	}
+	if err == nil {
+		info, err = c.load(namespace)
+	}
+
+	c.Lock()
+	e.info, e.err = info, err
+	e.expires = c.now().Add(clientAccessInfoTTL)
+	if err != nil && c.entries[namespace] == e {
+		// the failures are not cached
+		c.drop(namespace)
+	}
+	close(e.ready)
+	c.Unlock()
+
+	if err == nil && watching {
+		go c.watchChanges(namespace, e, versions)
+	}
+	return info, err
+}
+
+// versions returns the current resource versions of the mon endpoints and of the secret of the cluster
+func (c *accessInfoCache) versions(namespace string) (accessInfoVersions, error) {
+	endpoints, err := c.context.Clientset.CoreV1().ConfigMaps(namespace).Get(mon.EndpointConfigMapName, metav1.GetOptions{})
+	if err != nil {
+		return accessInfoVersions{}, fmt.Errorf("failed to get the mon endpoints of cluster %s. %+v", namespace, err)
+	}
+	secret, err := c.context.Clientset.CoreV1().Secrets(namespace).Get(mon.SecretName, metav1.GetOptions{})
+	if err != nil {
+		return accessInfoVersions{}, fmt.Errorf("failed to get the keys of cluster %s. %+v", namespace, err)
+	}
+	return accessInfoVersions{endpoints: endpoints.ResourceVersion, secret: secret.ResourceVersion}, nil
+}
+
+// drop removes the entry of the namespace. The cache must be locked.
+func (c *accessInfoCache) drop(namespace string) {
+	if e, ok := c.entries[namespace]; ok {
+		delete(c.entries, namespace)
+		close(e.stop)
+	}
+}
+
+func (e *accessInfoEntry) loaded() bool {
+	select {
+	case <-e.ready:
+		return true
+	default:
+		return false
+	}
+}
+
+// watchChanges drops the entry when the mon endpoints or the secret of the cluster change, or when the watch fails,
+// until the entry is dropped. The watch starts from the versions that were loaded, so it sees the changes made between
+// the load and the start of the watch.
+func (c *accessInfoCache) watchChanges(namespace string, e *accessInfoEntry, versions accessInfoVersions) {
+	endpoints, err := c.context.Clientset.CoreV1().ConfigMaps(namespace).Watch(nameOptions(mon.EndpointConfigMapName, versions.endpoints))
+	if err != nil {
+		logger.Warningf("failed to watch the mon endpoints of cluster %s. %+v", namespace, err)
+		c.invalidateEntry(namespace, e)
+		return
+	}
+	defer endpoints.Stop()
+	secret, err := c.context.Clientset.CoreV1().Secrets(namespace).Watch(nameOptions(mon.SecretName, versions.secret))
+	if err != nil {
+		logger.Warningf("failed to watch the keys of cluster %s. %+v", namespace, err)
+		c.invalidateEntry(namespace, e)
+		return
+	}
+	defer secret.Stop()
+
+	for {
+		var event watch.Event
+		var ok bool
+		select {
+		case <-e.stop:
+			return
+		case event, ok = <-endpoints.ResultChan():
+		case event, ok = <-secret.ResultChan():
+		}
+		if !ok {
+			logger.Debugf("watch of the access info of cluster %s closed", namespace)
+			c.invalidateEntry(namespace, e)
+			return
+		}
+		logger.Infof("the mons or the keys of cluster %s changed, the access info will be loaded again", namespace)
+		c.invalidateEntry(namespace, e)
+		return
+	}
+}
+
+// invalidateEntry drops the entry unless it was already replaced by a new one
+func (c *accessInfoCache) invalidateEntry(namespace string, e *accessInfoEntry) {
+	c.Lock()
+	defer c.Unlock()
+	if c.entries[namespace] == e {
+		c.drop(namespace)
+	}
+}
+
+func nameOptions(name, resourceVersion string) metav1.ListOptions {
+	return metav1.ListOptions{FieldSelector: fields.OneTermEqualSelector("metadata.name", name).String(), ResourceVersion: resourceVersion}
+}
@@ -0,0 +1,154 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package flexvolume
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rook/rook/pkg/clusterd"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestAccessInfoCacheLoadsOnce(t *testing.T) {
+	var loads int
+	release := make(chan struct{})
+	cache := newAccessInfoCache(nil, func(namespace string) (ClientAccessInfo, error) {
+		loads++
+		<-release
+		return ClientAccessInfo{MonAddresses: []string{"10.0.0.1:6790"}, UserName: "admin", SecretKey: "key"}, nil
+	})
+
+	// the requests that come while the access info is loading wait for the same load
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			info, err := cache.get("rook-ceph")
+			assert.Nil(t, err)
+			assert.Equal(t, "key", info.SecretKey)
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	assert.Equal(t, 1, loads)
+
+	// the access info is loaded again after the ttl
+	now := time.Now()
+	cache.now = func() time.Time { return now }
+	_, err := cache.get("rook-ceph")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, loads)
+	now = now.Add(clientAccessInfoTTL + time.Second)
+	_, err = cache.get("rook-ceph")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, loads)
+}
+
+func TestAccessInfoCacheFailures(t *testing.T) {
+	fail := true
+	loads := 0
+	cache := newAccessInfoCache(nil, func(namespace string) (ClientAccessInfo, error) {
+		loads++
+		if fail {
+			return ClientAccessInfo{}, fmt.Errorf("secret not found")
+		}
+		return ClientAccessInfo{UserName: "admin"}, nil
+	})
+
+	// the failures are not cached
+	_, err := cache.get("rook-ceph")
+	assert.NotNil(t, err)
+	fail = false
+	info, err := cache.get("rook-ceph")
+	assert.Nil(t, err)
+	assert.Equal(t, "admin", info.UserName)
+	assert.Equal(t, 2, loads)
+}
+
+func TestAccessInfoCacheInvalidation(t *testing.T) {
+	// each load of the access info starts a watch of the mon endpoints and of the secret from their loaded versions
+	clientset := fake.NewSimpleClientset(
+		&v1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "rook-ceph-mon-endpoints", Namespace: "rook-ceph", ResourceVersion: "5"}},
+		&v1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "rook-ceph-mon", Namespace: "rook-ceph", ResourceVersion: "7"}})
+	endpointWatches := make(chan *watch.FakeWatcher, 10)
+	secretWatches := make(chan *watch.FakeWatcher, 10)
+	versions := make(chan string, 20)
+	watchReactor := func(watches chan *watch.FakeWatcher) k8stesting.WatchReactionFunc {
+		return func(action k8stesting.Action) (bool, watch.Interface, error) {
+			versions <- action.(k8stesting.WatchActionImpl).GetWatchRestrictions().ResourceVersion
+			w := watch.NewFake()
+			watches <- w
+			return true, w, nil
+		}
+	}
+	clientset.PrependWatchReactor("configmaps", watchReactor(endpointWatches))
+	clientset.PrependWatchReactor("secrets", watchReactor(secretWatches))
+
+	loads := 0
+	cache := newAccessInfoCache(&clusterd.Context{Clientset: clientset}, func(namespace string) (ClientAccessInfo, error) {
+		loads++
+		return ClientAccessInfo{SecretKey: fmt.Sprintf("key%d", loads)}, nil
+	})
+	waitDropped := func() {
+		for i := 0; i < 100; i++ {
+			cache.Lock()
+			_, ok := cache.entries["rook-ceph"]
+			cache.Unlock()
+			if !ok {
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		assert.Fail(t, "the access info was not dropped")
+	}
+
+	info, err := cache.get("rook-ceph")
+	assert.Nil(t, err)
+	assert.Equal(t, "key1", info.SecretKey)
+	endpoints, _ := <-endpointWatches, <-secretWatches
+	assert.Equal(t, "5", <-versions)
+	assert.Equal(t, "7", <-versions)
+	info, err = cache.get("rook-ceph")
+	assert.Nil(t, err)
+	assert.Equal(t, "key1", info.SecretKey)
+
+	// a mon failover drops the access info
+	endpoints.Modify(&v1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "rook-ceph-mon-endpoints"}})
+	waitDropped()
+	info, err = cache.get("rook-ceph")
+	assert.Nil(t, err)
+	assert.Equal(t, "key2", info.SecretKey)
+	_, secret := <-endpointWatches, <-secretWatches
+
+	// a key rotation drops the access info
+	secret.Modify(&v1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "rook-ceph-mon"}})
+	waitDropped()
+	info, err = cache.get("rook-ceph")
+	assert.Nil(t, err)
+	assert.Equal(t, "key3", info.SecretKey)
+	assert.Equal(t, 3, loads)
+}
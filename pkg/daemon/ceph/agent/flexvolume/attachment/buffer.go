@@ -0,0 +1,448 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attachment
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	rookalpha "github.com/rook/rook/pkg/apis/rook.io/v1alpha2"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const (
+	bufferFileName = "volumes.json"
+	syncInterval   = 30 * time.Second
+	// the number of times a queued update is applied again when the volume was changed concurrently
+	syncConflictRetries = 5
+)
+
+// the local copy of a volume with attachments on the node
+type bufferEntry struct {
+	Volume *rookalpha.Volume `json:"volume"`
+	// Pending is whether the local copy was changed while the kubernetes api was unreachable
+	Pending bool `json:"pending,omitempty"`
+	// Deleted is whether the volume was deleted while the kubernetes api was unreachable
+	Deleted bool `json:"deleted,omitempty"`
+}
+
+type bufferState struct {
+	Volumes map[string]*bufferEntry `json:"volumes"`
+	// DivergedSince is the time of the oldest update that was not sent to the kubernetes api
+	DivergedSince *time.Time `json:"divergedSince,omitempty"`
+}
+
+// Buffer is an Attachment that keeps a local copy of the volumes attached on the node, persisted on the host. While the
+// kubernetes api is unreachable, the volumes are read from the local copy and the detaches are queued until they can
+// be sent to the api again. No volume is attached while the api is unreachable, since the attachments of the other
+// nodes are unknown. Once the queued updates are older than the divergence window, the buffer is read-only and the
+// updates fail until the api can be reached.
+type Buffer struct {
+	attachment Attachment
+	filePath   string
+	node       string
+	window     time.Duration
+	state      bufferState
+	lock       sync.Mutex
+	now        func() time.Time
+}
+
+// NewBuffer creates a buffer of the volume attachments of the node, loading the updates queued before a restart of the
+// agent from the dir
+func NewBuffer(attachment Attachment, dir, node string, window time.Duration) (*Buffer, error) {
+	b := &Buffer{
+		attachment: attachment,
+		filePath:   path.Join(dir, bufferFileName),
+		node:       node,
+		window:     window,
+		state:      bufferState{Volumes: map[string]*bufferEntry{}},
+		now:        time.Now,
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create the volume buffer dir %s. %+v", dir, err)
+	}
+
+	contents, err := ioutil.ReadFile(b.filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return b, nil
+		}
+		return nil, fmt.Errorf("failed to read the volume buffer %s. %+v", b.filePath, err)
+	}
+	if err := json.Unmarshal(contents, &b.state); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal the volume buffer %s. %+v", b.filePath, err)
+	}
+	if b.state.Volumes == nil {
+		b.state.Volumes = map[string]*bufferEntry{}
+	}
+	if pending := b.pendingCount(); pending > 0 {
+		logger.Infof("loaded %d volume updates that are not sent to the kubernetes api yet", pending)
+	}
+	return b, nil
+}
+
+// Run sends the queued updates to the kubernetes api periodically until the channel is closed
+func (b *Buffer) Run(stopChan chan struct{}) {
+	go wait.Until(func() {
+		if err := b.Sync(); err != nil {
+			logger.Warningf("failed to send the queued volume updates. %+v", err)
+		}
+	}, syncInterval, stopChan)
+}
+
+// ReadOnly returns whether the queued updates are older than the divergence window, after which no more updates are
+// accepted until the kubernetes api can be reached
+func (b *Buffer) ReadOnly() bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.readOnly()
+}
+
+// Sync sends the queued updates to the kubernetes api
+func (b *Buffer) Sync() error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.sync()
+}
+
+// Get returns the volume, from the local copy if the kubernetes api is unreachable
+func (b *Buffer) Get(namespace, name string) (*rookalpha.Volume, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.trySync()
+
+	key := volumeKey(namespace, name)
+	if entry, ok := b.state.Volumes[key]; ok && entry.Pending {
+		if entry.Deleted {
+			return &rookalpha.Volume{}, errors.NewNotFound(schema.GroupResource{Group: rookalpha.CustomResourceGroup, Resource: CustomResourceNamePlural}, name)
+		}
+		return entry.Volume.DeepCopy(), nil
+	}
+
+	volume, err := b.attachment.Get(namespace, name)
+	if err != nil {
+		if entry, ok := b.state.Volumes[key]; ok && unreachable(err) {
+			logger.Warningf("kubernetes api is unreachable, using the local copy of volume %s. %+v", key, err)
+			return entry.Volume.DeepCopy(), nil
+		}
+		if _, ok := b.state.Volumes[key]; ok && errors.IsNotFound(err) {
+			b.forget(key)
+		}
+		return volume, err
+	}
+	b.remember(volume)
+	return volume, nil
+}
+
+// List lists the volumes in the namespace, from the local copy if the kubernetes api is unreachable
+func (b *Buffer) List(namespace string) (*rookalpha.VolumeList, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.trySync()
+
+	list, err := b.attachment.List(namespace)
+	if err == nil || !unreachable(err) {
+		return list, err
+	}
+
+	logger.Warningf("kubernetes api is unreachable, listing the local copy of the volumes. %+v", err)
+	list = &rookalpha.VolumeList{}
+	for _, entry := range b.state.Volumes {
+		if !entry.Deleted && entry.Volume.Namespace == namespace {
+			list.Items = append(list.Items, *entry.Volume.DeepCopy())
+		}
+	}
+	return list, nil
+}
+
+// Create creates the volume. Volumes are not created while the kubernetes api is unreachable.
+func (b *Buffer) Create(volume *rookalpha.Volume) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.trySync()
+
+	if err := b.attachment.Create(volume); err != nil {
+		return err
+	}
+	b.remember(volume)
+	return nil
+}
+
+// Update updates the volume, queuing the update if the kubernetes api is unreachable. Only the updates that remove
+// attachments are queued.
+func (b *Buffer) Update(volume *rookalpha.Volume) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.trySync()
+
+	key := volumeKey(volume.Namespace, volume.Name)
+	if entry, ok := b.state.Volumes[key]; !ok || !entry.Pending {
+		err := b.attachment.Update(volume)
+		if err == nil {
+			b.remember(volume)
+			return nil
+		}
+		if !unreachable(err) {
+			return err
+		}
+		logger.Warningf("kubernetes api is unreachable, queuing the update of volume %s. %+v", key, err)
+	}
+
+	entry, ok := b.state.Volumes[key]
+	if !ok {
+		return fmt.Errorf("cannot update volume %s while the kubernetes api is unreachable. it is not attached on node %s", key, b.node)
+	}
+	if !removesAttachments(entry.Volume, volume) {
+		return fmt.Errorf("cannot attach volume %s while the kubernetes api is unreachable", key)
+	}
+	return b.queue(key, &bufferEntry{Volume: volume.DeepCopy(), Pending: true})
+}
+
+// Delete deletes the volume, queuing the delete if the kubernetes api is unreachable
+func (b *Buffer) Delete(namespace, name string) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.trySync()
+
+	key := volumeKey(namespace, name)
+	entry, ok := b.state.Volumes[key]
+	if !ok || !entry.Pending {
+		err := b.attachment.Delete(namespace, name)
+		if err == nil || !unreachable(err) {
+			if err == nil || errors.IsNotFound(err) {
+				b.forget(key)
+			}
+			return err
+		}
+		logger.Warningf("kubernetes api is unreachable, queuing the delete of volume %s. %+v", key, err)
+	}
+
+	if !ok {
+		return fmt.Errorf("cannot delete volume %s while the kubernetes api is unreachable. it is not attached on node %s", key, b.node)
+	}
+	return b.queue(key, &bufferEntry{Volume: entry.Volume, Pending: true, Deleted: true})
+}
+
+// queue saves an update that could not be sent to the kubernetes api, unless the divergence window has passed
+func (b *Buffer) queue(key string, entry *bufferEntry) error {
+	if b.readOnly() {
+		return fmt.Errorf("cannot update volume %s. the kubernetes api has been unreachable for more than %s", key, b.window)
+	}
+	if b.state.DivergedSince == nil {
+		now := b.now()
+		b.state.DivergedSince = &now
+	}
+	b.state.Volumes[key] = entry
+	return b.save()
+}
+
+func (b *Buffer) readOnly() bool {
+	return b.state.DivergedSince != nil && b.now().Sub(*b.state.DivergedSince) > b.window
+}
+
+// trySync sends the queued updates before a request, so the requests are not made on a stale copy once the api is back
+func (b *Buffer) trySync() {
+	if b.pendingCount() == 0 {
+		return
+	}
+	if err := b.sync(); err != nil {
+		logger.Debugf("queued volume updates not sent. %+v", err)
+	}
+}
+
+func (b *Buffer) sync() error {
+	if b.pendingCount() == 0 {
+		return nil
+	}
+
+	var lastErr error
+	for key, entry := range b.state.Volumes {
+		if !entry.Pending {
+			continue
+		}
+		if err := b.syncEntry(entry); err != nil {
+			lastErr = fmt.Errorf("failed to send the queued update of volume %s. %+v", key, err)
+			continue
+		}
+		logger.Infof("sent the queued update of volume %s", key)
+		if entry.Deleted {
+			delete(b.state.Volumes, key)
+		} else {
+			entry.Pending = false
+		}
+	}
+	if b.pendingCount() == 0 {
+		b.state.DivergedSince = nil
+	}
+	if err := b.save(); err != nil {
+		return err
+	}
+	return lastErr
+}
+
+// syncEntry applies the local attachments of the node to the current volume, keeping the attachments of the other nodes.
+// The update is applied again on the latest volume if the volume was changed since it was read.
+func (b *Buffer) syncEntry(entry *bufferEntry) error {
+	var err error
+	for i := 0; i < syncConflictRetries; i++ {
+		err = b.syncEntryOnce(entry)
+		if err == nil || !errors.IsConflict(err) {
+			return err
+		}
+		logger.Infof("volume %s/%s was changed concurrently, sending the queued update again", entry.Volume.Namespace, entry.Volume.Name)
+	}
+	return err
+}
+
+func (b *Buffer) syncEntryOnce(entry *bufferEntry) error {
+	namespace, name := entry.Volume.Namespace, entry.Volume.Name
+	attachments := []rookalpha.Attachment{}
+	if !entry.Deleted {
+		attachments = b.nodeAttachments(entry.Volume)
+	}
+
+	current, err := b.attachment.Get(namespace, name)
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			return err
+		}
+		if len(attachments) == 0 {
+			return nil
+		}
+		volume := entry.Volume.DeepCopy()
+		volume.ResourceVersion = ""
+		return b.attachment.Create(volume)
+	}
+
+	for _, a := range current.Attachments {
+		if a.Node != b.node {
+			attachments = append(attachments, a)
+		}
+	}
+	if entry.Deleted && len(attachments) == 0 {
+		// the volume is only deleted if no other node attached it while the api was unreachable
+		err := b.attachment.Delete(namespace, name)
+		if err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+		return nil
+	}
+
+	// the update is rejected with a conflict if the volume changed after it was read
+	current.Attachments = attachments
+	if err := b.attachment.Update(current); err != nil {
+		return err
+	}
+	entry.Volume = current
+	return nil
+}
+
+// remember keeps the local copy of the volumes with attachments on the node
+func (b *Buffer) remember(volume *rookalpha.Volume) {
+	key := volumeKey(volume.Namespace, volume.Name)
+	_, known := b.state.Volumes[key]
+	if len(b.nodeAttachments(volume)) == 0 {
+		if known {
+			b.forget(key)
+		}
+		return
+	}
+	b.state.Volumes[key] = &bufferEntry{Volume: volume.DeepCopy()}
+	if err := b.save(); err != nil {
+		logger.Warningf("failed to save the local copy of volume %s. %+v", key, err)
+	}
+}
+
+func (b *Buffer) forget(key string) {
+	delete(b.state.Volumes, key)
+	if err := b.save(); err != nil {
+		logger.Warningf("failed to remove the local copy of volume %s. %+v", key, err)
+	}
+}
+
+// save writes the buffer to a temp file that replaces the buffer, so a crash does not leave a partial buffer
+func (b *Buffer) save() error {
+	contents, err := json.Marshal(b.state)
+	if err != nil {
+		return fmt.Errorf("failed to marshal the volume buffer. %+v", err)
+	}
+	tempPath := b.filePath + ".tmp"
+	if err := ioutil.WriteFile(tempPath, contents, 0600); err != nil {
+		return fmt.Errorf("failed to write the volume buffer %s. %+v", tempPath, err)
+	}
+	if err := os.Rename(tempPath, b.filePath); err != nil {
+		return fmt.Errorf("failed to replace the volume buffer %s. %+v", b.filePath, err)
+	}
+	return nil
+}
+
+func (b *Buffer) pendingCount() int {
+	count := 0
+	for _, entry := range b.state.Volumes {
+		if entry.Pending {
+			count++
+		}
+	}
+	return count
+}
+
+func (b *Buffer) nodeAttachments(volume *rookalpha.Volume) []rookalpha.Attachment {
+	attachments := []rookalpha.Attachment{}
+	for _, a := range volume.Attachments {
+		if a.Node == b.node {
+			attachments = append(attachments, a)
+		}
+	}
+	return attachments
+}
+
+// removesAttachments returns whether the update only removes attachments from the volume
+func removesAttachments(old, updated *rookalpha.Volume) bool {
+	for _, a := range updated.Attachments {
+		found := false
+		for _, o := range old.Attachments {
+			if a == o {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// unreachable returns whether the request failed because the kubernetes api could not be reached, rather than
+// being rejected by the api
+func unreachable(err error) bool {
+	if _, ok := err.(errors.APIStatus); ok {
+		return errors.IsServerTimeout(err) || errors.IsTimeout(err)
+	}
+	return true
+}
+
+func volumeKey(namespace, name string) string {
+	return fmt.Sprintf("%s/%s", namespace, name)
+}
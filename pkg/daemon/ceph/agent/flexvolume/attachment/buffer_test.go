@@ -0,0 +1,240 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attachment
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	rookalpha "github.com/rook/rook/pkg/apis/rook.io/v1alpha2"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+type fakeAPI struct {
+	volumes     map[string]*rookalpha.Volume
+	unreachable bool
+	// conflicts is the number of the next updates that are rejected as if the volume changed concurrently
+	conflicts int
+}
+
+func newFakeAPI() (*fakeAPI, *MockAttachment) {
+	api := &fakeAPI{volumes: map[string]*rookalpha.Volume{}}
+	offline := fmt.Errorf("dial tcp 10.0.0.1:443: connect: connection refused")
+	notFound := func(name string) error {
+		return errors.NewNotFound(schema.GroupResource{Resource: CustomResourceNamePlural}, name)
+	}
+	mock := &MockAttachment{
+		MockGet: func(namespace, name string) (*rookalpha.Volume, error) {
+			if api.unreachable {
+				return &rookalpha.Volume{}, offline
+			}
+			v, ok := api.volumes[volumeKey(namespace, name)]
+			if !ok {
+				return &rookalpha.Volume{}, notFound(name)
+			}
+			return v.DeepCopy(), nil
+		},
+		MockCreate: func(v *rookalpha.Volume) error {
+			if api.unreachable {
+				return offline
+			}
+			api.volumes[volumeKey(v.Namespace, v.Name)] = v.DeepCopy()
+			return nil
+		},
+		MockUpdate: func(v *rookalpha.Volume) error {
+			if api.unreachable {
+				return offline
+			}
+			if api.conflicts > 0 {
+				api.conflicts--
+				return errors.NewConflict(schema.GroupResource{Resource: CustomResourceNamePlural}, v.Name, fmt.Errorf("object was modified"))
+			}
+			api.volumes[volumeKey(v.Namespace, v.Name)] = v.DeepCopy()
+			return nil
+		},
+		MockDelete: func(namespace, name string) error {
+			if api.unreachable {
+				return offline
+			}
+			if _, ok := api.volumes[volumeKey(namespace, name)]; !ok {
+				return notFound(name)
+			}
+			delete(api.volumes, volumeKey(namespace, name))
+			return nil
+		},
+	}
+	return api, mock
+}
+
+func TestBufferQueuesDetaches(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	api, mock := newFakeAPI()
+	b, err := NewBuffer(mock, dir, "node1", 10*time.Minute)
+	assert.Nil(t, err)
+
+	// attach two volumes on the node while the api can be reached
+	assert.Nil(t, b.Create(rookalpha.NewVolume("pv1", "rook-system", "node1", "default", "pod1", "rook", "/mnt/1", false)))
+	assert.Nil(t, b.Create(rookalpha.NewVolume("pv2", "rook-system", "node1", "default", "pod2", "rook", "/mnt/2", false)))
+
+	// the volumes are read from the local copy while the api is unreachable
+	api.unreachable = true
+	v, err := b.Get("rook-system", "pv1")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(v.Attachments))
+
+	// no volume is attached while the api is unreachable
+	assert.NotNil(t, b.Create(rookalpha.NewVolume("pv3", "rook-system", "node1", "default", "pod3", "rook", "/mnt/3", false)))
+	added := v.DeepCopy()
+	added.Attachments = append(added.Attachments, rookalpha.Attachment{Node: "node1", PodName: "pod4", MountDir: "/mnt/4"})
+	assert.NotNil(t, b.Update(added))
+
+	// the detaches are queued
+	v.Attachments = []rookalpha.Attachment{}
+	assert.Nil(t, b.Update(v))
+	assert.Nil(t, b.Delete("rook-system", "pv2"))
+	assert.False(t, b.ReadOnly())
+	assert.NotNil(t, b.Sync())
+	_, err = b.Get("rook-system", "pv2")
+	assert.True(t, errors.IsNotFound(err))
+
+	// the queued updates survive a restart of the agent
+	b, err = NewBuffer(mock, dir, "node1", 10*time.Minute)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, b.pendingCount())
+
+	// the queued updates are sent once the api is back
+	api.unreachable = false
+	assert.Nil(t, b.Sync())
+	assert.Equal(t, 0, b.pendingCount())
+	assert.Nil(t, b.state.DivergedSince)
+	assert.Equal(t, 0, len(api.volumes["rook-system/pv1"].Attachments))
+	_, ok := api.volumes["rook-system/pv2"]
+	assert.False(t, ok)
+}
+
+func TestBufferKeepsOtherNodes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	api, mock := newFakeAPI()
+	b, err := NewBuffer(mock, dir, "node1", 10*time.Minute)
+	assert.Nil(t, err)
+
+	v := rookalpha.NewVolume("pv1", "rook-system", "node1", "default", "pod1", "rook", "/mnt/1", true)
+	assert.Nil(t, b.Create(v))
+
+	// detach on this node while the api is unreachable, and another node also attaches the volume read-only
+	api.unreachable = true
+	v.Attachments = []rookalpha.Attachment{}
+	assert.Nil(t, b.Update(v))
+	api.volumes["rook-system/pv1"].Attachments = append(api.volumes["rook-system/pv1"].Attachments,
+		rookalpha.Attachment{Node: "node2", PodName: "pod2", MountDir: "/mnt/2", ReadOnly: true})
+
+	// only the attachments of this node are replaced
+	api.unreachable = false
+	assert.Nil(t, b.Sync())
+	attachments := api.volumes["rook-system/pv1"].Attachments
+	assert.Equal(t, 1, len(attachments))
+	assert.Equal(t, "node2", attachments[0].Node)
+}
+
+func TestBufferQueuedDeleteKeepsOtherNodes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	api, mock := newFakeAPI()
+	b, err := NewBuffer(mock, dir, "node1", 10*time.Minute)
+	assert.Nil(t, err)
+	assert.Nil(t, b.Create(rookalpha.NewVolume("pv1", "rook-system", "node1", "default", "pod1", "rook", "/mnt/1", true)))
+
+	// delete on this node while the api is unreachable, and another node also attaches the volume read-only
+	api.unreachable = true
+	assert.Nil(t, b.Delete("rook-system", "pv1"))
+	api.volumes["rook-system/pv1"].Attachments = append(api.volumes["rook-system/pv1"].Attachments,
+		rookalpha.Attachment{Node: "node2", PodName: "pod2", MountDir: "/mnt/2", ReadOnly: true})
+
+	// the volume is kept with the attachments of the other node, also when it changes concurrently
+	api.unreachable = false
+	api.conflicts = 2
+	assert.Nil(t, b.Sync())
+	assert.Equal(t, 0, b.pendingCount())
+	attachments := api.volumes["rook-system/pv1"].Attachments
+	assert.Equal(t, 1, len(attachments))
+	assert.Equal(t, "node2", attachments[0].Node)
+
+	// the update is not retried forever
+	assert.Nil(t, b.Create(rookalpha.NewVolume("pv2", "rook-system", "node1", "default", "pod3", "rook", "/mnt/3", false)))
+	api.volumes["rook-system/pv2"].Attachments = append(api.volumes["rook-system/pv2"].Attachments,
+		rookalpha.Attachment{Node: "node2", PodName: "pod4", MountDir: "/mnt/4", ReadOnly: true})
+	api.unreachable = true
+	assert.Nil(t, b.Delete("rook-system", "pv2"))
+	api.unreachable = false
+	api.conflicts = syncConflictRetries
+	assert.NotNil(t, b.Sync())
+	assert.Equal(t, 1, b.pendingCount())
+}
+
+func TestBufferReadOnly(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	api, mock := newFakeAPI()
+	b, err := NewBuffer(mock, dir, "node1", 10*time.Minute)
+	assert.Nil(t, err)
+	now := time.Now()
+	b.now = func() time.Time { return now }
+
+	assert.Nil(t, b.Create(rookalpha.NewVolume("pv1", "rook-system", "node1", "default", "pod1", "rook", "/mnt/1", false)))
+	assert.Nil(t, b.Create(rookalpha.NewVolume("pv2", "rook-system", "node1", "default", "pod2", "rook", "/mnt/2", false)))
+
+	api.unreachable = true
+	assert.Nil(t, b.Delete("rook-system", "pv1"))
+
+	// the updates fail once the queued updates are older than the window
+	now = now.Add(11 * time.Minute)
+	assert.True(t, b.ReadOnly())
+	assert.NotNil(t, b.Delete("rook-system", "pv2"))
+
+	// the volumes can still be read
+	_, err = b.Get("rook-system", "pv2")
+	assert.Nil(t, err)
+
+	// the buffer can be updated again once the queued updates are sent
+	api.unreachable = false
+	assert.Nil(t, b.Sync())
+	assert.False(t, b.ReadOnly())
+	assert.Nil(t, b.Delete("rook-system", "pv2"))
+	assert.Equal(t, 0, len(api.volumes))
+}
+
+func TestUnreachable(t *testing.T) {
+	assert.True(t, unreachable(fmt.Errorf("connection refused")))
+	assert.True(t, unreachable(errors.NewServerTimeout(schema.GroupResource{Resource: "volumes"}, "get", 1)))
+	assert.False(t, unreachable(errors.NewNotFound(schema.GroupResource{Resource: "volumes"}, "pv1")))
+	assert.False(t, unreachable(errors.NewConflict(schema.GroupResource{Resource: "volumes"}, "pv1", fmt.Errorf("conflict"))))
+}
@@ -24,15 +24,19 @@ import (
 	"path"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/coreos/pkg/capnslog"
 	rookalpha "github.com/rook/rook/pkg/apis/rook.io/v1alpha2"
 	"github.com/rook/rook/pkg/clusterd"
 	"github.com/rook/rook/pkg/daemon/ceph/agent/flexvolume/attachment"
+	ceph "github.com/rook/rook/pkg/daemon/ceph/client"
 	"github.com/rook/rook/pkg/operator/ceph/agent"
 	"github.com/rook/rook/pkg/operator/ceph/cluster"
 	"github.com/rook/rook/pkg/operator/ceph/cluster/mon"
+	oppool "github.com/rook/rook/pkg/operator/ceph/pool"
 	"github.com/rook/rook/pkg/operator/k8sutil"
+	"github.com/rook/rook/pkg/util/metrics"
 	"k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -46,6 +50,7 @@ const (
 	PoolKey               = "pool"
 	ImageKey              = "image"
 	DataPoolKey           = "dataPool"
+	RadosNamespaceKey     = "radosNamespace"
 	kubeletDefaultRootDir = "/var/lib/kubelet"
 )
 
@@ -56,6 +61,7 @@ type Controller struct {
 	context          *clusterd.Context
 	volumeManager    VolumeManager
 	volumeAttachment attachment.Attachment
+	accessInfo       *accessInfoCache
 }
 
 type ClientAccessInfo struct {
@@ -66,21 +72,25 @@ type ClientAccessInfo struct {
 
 func NewController(context *clusterd.Context, volumeAttachment attachment.Attachment, manager VolumeManager) *Controller {
 
-	return &Controller{
+	c := &Controller{
 		context:          context,
 		volumeAttachment: volumeAttachment,
 		volumeManager:    manager,
 	}
+	c.accessInfo = newAccessInfoCache(context, c.loadClientAccessInfo)
+	return c
 }
 
 // Attach attaches rook volume to the node
 func (c *Controller) Attach(attachOpts AttachOptions, devicePath *string) error {
+	defer metrics.ObserveAgentTask("attach", time.Now())
 
 	namespace := os.Getenv(k8sutil.PodNamespaceEnvVar)
 	node := os.Getenv(k8sutil.NodeNameEnvVar)
 
 	// Name of CRD is the PV name. This is done so that the CRD can be use for fencing
 	crdName := attachOpts.VolumeName
+	logger.Infof("%sattaching volume %s for pod %s/%s", requestPrefix(attachOpts.RequestID), crdName, attachOpts.PodNamespace, attachOpts.Pod)
 
 	// Check if this volume has been attached
 	volumeattachObj, err := c.volumeAttachment.Get(namespace, crdName)
@@ -172,10 +182,15 @@ func (c *Controller) Attach(attachOpts AttachOptions, devicePath *string) error
 			}
 		}
 	}
-	*devicePath, err = c.volumeManager.Attach(attachOpts.Image, attachOpts.Pool, attachOpts.ClusterNamespace)
+	imagePool, err := c.imagePool(attachOpts)
 	if err != nil {
 		return fmt.Errorf("failed to attach volume %s/%s: %+v", attachOpts.Pool, attachOpts.Image, err)
 	}
+	pool := ceph.PoolNamespaceSpec(imagePool, attachOpts.RadosNamespace)
+	*devicePath, err = c.volumeManager.Attach(attachOpts.Image, pool, attachOpts.ClusterNamespace)
+	if err != nil {
+		return fmt.Errorf("failed to attach volume %s/%s: %+v", pool, attachOpts.Image, err)
+	}
 	return nil
 }
 
@@ -189,9 +204,17 @@ func (c *Controller) DetachForce(detachOpts AttachOptions, _ *struct{} /* void r
 }
 
 func (c *Controller) doDetach(detachOpts AttachOptions, force bool) error {
-	err := c.volumeManager.Detach(detachOpts.Image, detachOpts.Pool, detachOpts.ClusterNamespace, force)
+	defer metrics.ObserveAgentTask("detach", time.Now())
+	logger.Infof("%sdetaching volume %s/%s (force=%t)", requestPrefix(detachOpts.RequestID), detachOpts.Pool, detachOpts.Image, force)
+	imagePool, err := c.imagePool(detachOpts)
 	if err != nil {
-		return fmt.Errorf("Failed to detach volume %s/%s: %+v", detachOpts.Pool, detachOpts.Image, err)
+		logger.Warningf("failed to find the migrated pool of volume %s/%s, detaching from the original pool. %+v", detachOpts.Pool, detachOpts.Image, err)
+		imagePool = detachOpts.Pool
+	}
+	pool := ceph.PoolNamespaceSpec(imagePool, detachOpts.RadosNamespace)
+	err = c.volumeManager.Detach(detachOpts.Image, pool, detachOpts.ClusterNamespace, force)
+	if err != nil {
+		return fmt.Errorf("Failed to detach volume %s/%s: %+v", pool, detachOpts.Image, err)
 	}
 
 	namespace := os.Getenv(k8sutil.PodNamespaceEnvVar)
@@ -208,7 +231,7 @@ func (c *Controller) doDetach(detachOpts AttachOptions, force bool) error {
 func (c *Controller) RemoveAttachmentObject(detachOpts AttachOptions, safeToDetach *bool) error {
 	namespace := os.Getenv(k8sutil.PodNamespaceEnvVar)
 	crdName := detachOpts.VolumeName
-	logger.Infof("Deleting attachment for mountDir %s from Volume attach CRD %s/%s", detachOpts.MountDir, namespace, crdName)
+	logger.Infof("%sDeleting attachment for mountDir %s from Volume attach CRD %s/%s", requestPrefix(detachOpts.RequestID), detachOpts.MountDir, namespace, crdName)
 	volumeAttach, err := c.volumeAttachment.Get(namespace, crdName)
 	if err != nil {
 		return fmt.Errorf("failed to get Volume attach CRD %s/%s: %+v", namespace, crdName, err)
@@ -237,16 +260,35 @@ func (c *Controller) RemoveAttachmentObject(detachOpts AttachOptions, safeToDeta
 	return fmt.Errorf("Volume CRD %s found but attachment to the mountDir %s was not found", crdName, detachOpts.MountDir)
 }
 
+// imagePool returns the pool where the image of the volume is stored, which differs from the pool of the
+// volume after the image was migrated to another pool
+func (c *Controller) imagePool(opts AttachOptions) (string, error) {
+	if opts.RadosNamespace != "" {
+		// only the images in the default namespace of a pool are migrated
+		return opts.Pool, nil
+	}
+	return oppool.MigratedPool(c.context.Clientset, opts.ClusterNamespace, opts.Pool, opts.Image)
+}
+
 // Log logs messages from the driver
 func (c *Controller) Log(message LogMessage, _ *struct{} /* void reply */) error {
 	if message.IsError {
-		driverLogger.Error(message.Message)
+		driverLogger.Error(requestPrefix(message.RequestID) + message.Message)
 	} else {
-		driverLogger.Info(message.Message)
+		driverLogger.Info(requestPrefix(message.RequestID) + message.Message)
 	}
 	return nil
 }
 
+// requestPrefix returns the prefix of the log messages for a driver call, so the messages that the driver and the
+// agent log for the same call can be correlated
+func requestPrefix(requestID string) string {
+	if requestID == "" {
+		return ""
+	}
+	return fmt.Sprintf("[%s] ", requestID)
+}
+
 func (c *Controller) parseClusterNamespace(storageClassName string) (string, error) {
 	sc, err := c.context.Clientset.Storage().StorageClasses().Get(storageClassName, metav1.GetOptions{})
 	if err != nil {
@@ -314,6 +356,9 @@ func (c *Controller) GetAttachInfoFromMountDir(mountDir string, attachOptions *A
 	if attachOptions.Pool == "" {
 		attachOptions.Pool = pv.Spec.PersistentVolumeSource.FlexVolume.Options[PoolKey]
 	}
+	if attachOptions.RadosNamespace == "" {
+		attachOptions.RadosNamespace = pv.Spec.PersistentVolumeSource.FlexVolume.Options[RadosNamespaceKey]
+	}
 	if attachOptions.StorageClass == "" {
 		attachOptions.StorageClass = pv.Spec.PersistentVolumeSource.FlexVolume.Options[StorageClassKey]
 	}
@@ -336,11 +381,21 @@ func (c *Controller) GetGlobalMountPath(input GlobalMountPathInput, globalMountP
 	return nil
 }
 
-// GetClientAccessInfo obtains the cluster monitor endpoints, username and secret
+// GetClientAccessInfo obtains the cluster monitor endpoints, username and secret. They are cached until the mons or
+// the keys of the cluster change.
 func (c *Controller) GetClientAccessInfo(clusterNamespace string, clientAccessInfo *ClientAccessInfo) error {
+	info, err := c.accessInfo.get(clusterNamespace)
+	if err != nil {
+		return err
+	}
+	*clientAccessInfo = info
+	return nil
+}
+
+func (c *Controller) loadClientAccessInfo(clusterNamespace string) (ClientAccessInfo, error) {
 	clusterInfo, _, _, err := mon.LoadClusterInfo(c.context, clusterNamespace)
 	if err != nil {
-		return fmt.Errorf("failed to load cluster information from clusters namespace %s: %+v", clusterNamespace, err)
+		return ClientAccessInfo{}, fmt.Errorf("failed to load cluster information from clusters namespace %s: %+v", clusterNamespace, err)
 	}
 
 	monEndpoints := make([]string, 0, len(clusterInfo.Monitors))
@@ -348,11 +403,11 @@ func (c *Controller) GetClientAccessInfo(clusterNamespace string, clientAccessIn
 		monEndpoints = append(monEndpoints, monitor.Endpoint)
 	}
 
-	clientAccessInfo.MonAddresses = monEndpoints
-	clientAccessInfo.SecretKey = clusterInfo.AdminSecret
-	clientAccessInfo.UserName = "admin"
-
-	return nil
+	return ClientAccessInfo{
+		MonAddresses: monEndpoints,
+		SecretKey:    clusterInfo.AdminSecret,
+		UserName:     "admin",
+	}, nil
 }
 
 // GetKernelVersion returns the kernel version of the current node.
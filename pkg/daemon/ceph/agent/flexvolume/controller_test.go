@@ -827,6 +827,11 @@ func TestGetCRDNameFromMountDirInvalid(t *testing.T) {
 	assert.NotNil(t, err)
 }
 
+func TestRequestPrefix(t *testing.T) {
+	assert.Equal(t, "[x7k2p9q4] ", requestPrefix("x7k2p9q4"))
+	assert.Equal(t, "", requestPrefix(""))
+}
+
 func defaultHeader() http.Header {
 	header := http.Header{}
 	header.Set("Content-Type", runtime.ContentTypeJSON)
@@ -191,7 +191,7 @@ func getClusterInfo(context *clusterd.Context, clusterNamespace string) (string,
 	}
 
 	keyring := fmt.Sprintf(cephmon.AdminKeyringTemplate, clusterInfo.AdminSecret)
-	if err := ioutil.WriteFile(keyringFile.Name(), []byte(keyring), 0644); err != nil {
+	if err := ioutil.WriteFile(keyringFile.Name(), []byte(keyring), 0600); err != nil {
 		return "", "", fmt.Errorf("failed to write monitor keyring to %s: %+v", keyringFile.Name(), err)
 	}
 
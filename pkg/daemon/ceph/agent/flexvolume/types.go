@@ -40,6 +40,7 @@ type VolumeController interface {
 type AttachOptions struct {
 	Image            string `json:"image"`
 	Pool             string `json:"pool"`
+	RadosNamespace   string `json:"radosNamespace"`
 	ClusterNamespace string `json:"clusterNamespace"`
 	ClusterName      string `json:"clusterName"`
 	StorageClass     string `json:"storageClass"`
@@ -52,11 +53,13 @@ type AttachOptions struct {
 	Pod              string `json:"kubernetes.io/pod.name"`
 	PodID            string `json:"kubernetes.io/pod.uid"`
 	PodNamespace     string `json:"kubernetes.io/pod.namespace"`
+	RequestID        string `json:"requestID"` // id of the driver call the options were sent with
 }
 
 type LogMessage struct {
-	Message string `json:"message"`
-	IsError bool   `json:"isError"`
+	Message   string `json:"message"`
+	IsError   bool   `json:"isError"`
+	RequestID string `json:"requestID"`
 }
 
 type GlobalMountPathInput struct {
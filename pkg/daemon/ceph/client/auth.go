@@ -69,6 +69,41 @@ func AuthGetOrCreateKey(context *clusterd.Context, clusterName, name string, cap
 	return parseAuthKey(buf)
 }
 
+// AuthImport will import the users found in the keyring at the given path. The keys and capabilities
+// of users that already exist are replaced with the ones in the keyring.
+func AuthImport(context *clusterd.Context, clusterName, keyringPath string) error {
+	args := []string{"auth", "import", "-i", keyringPath}
+	_, err := ExecuteCephCommand(context, clusterName, args)
+	if err != nil {
+		return fmt.Errorf("failed to auth import from %s: %+v", keyringPath, err)
+	}
+
+	return nil
+}
+
+// AuthEntity is a user of the cluster with its capabilities
+type AuthEntity struct {
+	Name string            `json:"entity"`
+	Caps map[string]string `json:"caps"`
+}
+
+// AuthList lists the users of the cluster and their capabilities. The keys are not returned.
+func AuthList(context *clusterd.Context, clusterName string) ([]AuthEntity, error) {
+	args := []string{"auth", "ls"}
+	buf, err := ExecuteCephCommand(context, clusterName, args)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list auth entities. %+v", err)
+	}
+
+	var result struct {
+		Entities []AuthEntity `json:"auth_dump"`
+	}
+	if err := json.Unmarshal(buf, &result); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal auth entities. %+v. raw buffer response: %s", err, string(buf))
+	}
+	return result.Entities, nil
+}
+
 // AuthDelete will delete the given user.
 func AuthDelete(context *clusterd.Context, clusterName, name string) error {
 	args := []string{"auth", "del", name}
@@ -0,0 +1,100 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/rook/rook/pkg/clusterd"
+)
+
+const clientConfigTemplate = `[global]
+fsid = %s
+mon host = %s
+
+[client.%s]
+keyring = /etc/ceph/%s
+`
+
+// ClientConfig is the ceph.conf and keyring for a host outside of the cluster to connect as a ceph user
+type ClientConfig struct {
+	// The name of the user without the client. prefix
+	Name string `json:"name"`
+	// The contents of /etc/ceph/ceph.conf
+	Config string `json:"config"`
+	// The contents of the keyring, which is expected in /etc/ceph with the name of KeyringFile
+	Keyring     string `json:"keyring"`
+	KeyringFile string `json:"keyringFile"`
+}
+
+// GetClientConfig returns the config and keyring to connect to the cluster as an existing ceph user, such as a user
+// restricted to a pool or to a path of a filesystem
+func GetClientConfig(context *clusterd.Context, clusterName, name string) (*ClientConfig, error) {
+	name = strings.TrimPrefix(name, "client.")
+	key, err := AuthGetKey(context, clusterName, "client."+name)
+	if err != nil {
+		return nil, err
+	}
+
+	status, err := Status(context, clusterName)
+	if err != nil {
+		return nil, err
+	}
+	monitors := []string{}
+	for _, mon := range status.MonMap.Mons {
+		// the addr of a mon is followed by its nonce, such as 10.0.0.1:6789/0
+		monitors = append(monitors, strings.Split(mon.Address, "/")[0])
+	}
+	if len(monitors) == 0 {
+		return nil, fmt.Errorf("no mons found in cluster %s", clusterName)
+	}
+
+	keyringFile := fmt.Sprintf("ceph.client.%s.keyring", name)
+	return &ClientConfig{
+		Name:        name,
+		Config:      fmt.Sprintf(clientConfigTemplate, status.FSID, strings.Join(monitors, ","), name, keyringFile),
+		Keyring:     fmt.Sprintf("[client.%s]\n\tkey = %s\n", name, key),
+		KeyringFile: keyringFile,
+	}, nil
+}
+
+// WriteTar writes the config and the keyring to a tarball that is extracted in /etc/ceph on the host
+func (c *ClientConfig) WriteTar(w io.Writer) error {
+	tw := tar.NewWriter(w)
+	files := []struct {
+		name     string
+		mode     int64
+		contents string
+	}{
+		{"ceph.conf", 0644, c.Config},
+		{c.KeyringFile, 0600, c.Keyring},
+	}
+	for _, f := range files {
+		header := &tar.Header{Name: f.name, Mode: f.mode, Size: int64(len(f.contents)), ModTime: time.Now()}
+		if err := tw.WriteHeader(header); err != nil {
+			return fmt.Errorf("failed to write the header of %s. %+v", f.name, err)
+		}
+		if _, err := tw.Write([]byte(f.contents)); err != nil {
+			return fmt.Errorf("failed to write %s. %+v", f.name, err)
+		}
+	}
+	return tw.Close()
+}
@@ -0,0 +1,69 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"testing"
+
+	"github.com/rook/rook/pkg/clusterd"
+	exectest "github.com/rook/rook/pkg/util/exec/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetClientConfig(t *testing.T) {
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithOutputFile: func(debug bool, actionName string, command string, outFileArg string, args ...string) (string, error) {
+			switch {
+			case args[0] == "auth" && args[1] == "get-key":
+				if args[2] != "client.app1" {
+					return "", fmt.Errorf("user %s not found", args[2])
+				}
+				return `{"key":"AQBsecret=="}`, nil
+			case args[0] == "status":
+				return `{"fsid":"abc","monmap":{"mons":[{"name":"a","rank":0,"addr":"10.0.0.1:6789/0"},{"name":"b","rank":1,"addr":"10.0.0.2:6789/0"}]}}`, nil
+			}
+			return "", fmt.Errorf("unexpected ceph command '%v'", args)
+		},
+	}
+	context := &clusterd.Context{Executor: executor}
+
+	config, err := GetClientConfig(context, "rook-ceph", "client.app1")
+	assert.Nil(t, err)
+	assert.Equal(t, "app1", config.Name)
+	assert.Equal(t, "[global]\nfsid = abc\nmon host = 10.0.0.1:6789,10.0.0.2:6789\n\n[client.app1]\nkeyring = /etc/ceph/ceph.client.app1.keyring\n",
+		config.Config)
+	assert.Equal(t, "[client.app1]\n\tkey = AQBsecret==\n", config.Keyring)
+
+	// the tarball has the config and the keyring
+	var buf bytes.Buffer
+	assert.Nil(t, config.WriteTar(&buf))
+	tr := tar.NewReader(&buf)
+	files := map[string]string{}
+	for header, err := tr.Next(); err == nil; header, err = tr.Next() {
+		contents, _ := ioutil.ReadAll(tr)
+		files[header.Name] = string(contents)
+	}
+	assert.Equal(t, map[string]string{"ceph.conf": config.Config, "ceph.client.app1.keyring": config.Keyring}, files)
+
+	// the user must already exist
+	_, err = GetClientConfig(context, "rook-ceph", "app2")
+	assert.NotNil(t, err)
+}
@@ -21,6 +21,7 @@ import (
 	"time"
 
 	"github.com/rook/rook/pkg/clusterd"
+	"github.com/rook/rook/pkg/util/metrics"
 )
 
 // When running the e2e tests, all ceph commands need to be run in the toolbox.
@@ -31,6 +32,7 @@ const (
 	AdminUsername     = "client.admin"
 	CephTool          = "ceph"
 	RBDTool           = "rbd"
+	RadosTool         = "rados"
 	Kubectl           = "kubectl"
 	CrushTool         = "crushtool"
 	cmdExecuteTimeout = 1 * time.Minute
@@ -87,17 +89,25 @@ func ExecuteRBDCommand(context *clusterd.Context, clusterName string, args []str
 	return executeCommand(context, command, args)
 }
 
+func ExecuteRadosCommand(context *clusterd.Context, clusterName string, args []string) ([]byte, error) {
+	command, args := FinalizeCephCommandArgs(RadosTool, args, context.ConfigDir, clusterName)
+	args = append(args, "--format", "json")
+	return executeCommand(context, command, args)
+}
+
 func ExecuteRBDCommandNoFormat(context *clusterd.Context, clusterName string, args []string) ([]byte, error) {
 	command, args := FinalizeCephCommandArgs(RBDTool, args, context.ConfigDir, clusterName)
 	return executeCommand(context, command, args)
 }
 
 func ExecuteRBDCommandWithTimeout(context *clusterd.Context, clusterName string, args []string) (string, error) {
+	defer metrics.ObserveCommand(RBDTool, args, time.Now())
 	output, err := context.Executor.ExecuteCommandWithTimeout(false, cmdExecuteTimeout, "", RBDTool, args...)
 	return output, err
 }
 
 func executeCommand(context *clusterd.Context, command string, args []string) ([]byte, error) {
+	defer metrics.ObserveCommand(command, args, time.Now())
 	output, err := context.Executor.ExecuteCommandWithOutput(false, "", command, args...)
 	return []byte(output), err
 }
@@ -107,6 +117,7 @@ func executeCommandWithOutputFile(context *clusterd.Context, debug bool, command
 		// Kubectl commands targeting the toolbox container generate a temp file in the wrong place, so we will instead capture the output from stdout for the tests
 		return executeCommand(context, command, args)
 	}
+	defer metrics.ObserveCommand(command, args, time.Now())
 	output, err := context.Executor.ExecuteCommandWithOutputFile(debug, "", command, "--out-file", args...)
 	return []byte(output), err
 }
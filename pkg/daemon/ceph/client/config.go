@@ -0,0 +1,127 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/rook/rook/pkg/clusterd"
+)
+
+// SetConfig stores the value of the option in the config database of the mons, from where the daemons and clients
+// matching who (global, mon, osd, osd.1, client, etc) load it in addition to their config file
+func SetConfig(context *clusterd.Context, clusterName, who, option, value string) error {
+	args := []string{"config", "set", who, option, value}
+	if _, err := ExecuteCephCommand(context, clusterName, args); err != nil {
+		return fmt.Errorf("failed to set config %s for %s. %+v", option, who, err)
+	}
+	return nil
+}
+
+// RemoveConfig removes the option from the config database of the mons so the default value is used again
+func RemoveConfig(context *clusterd.Context, clusterName, who, option string) error {
+	args := []string{"config", "rm", who, option}
+	if _, err := ExecuteCephCommand(context, clusterName, args); err != nil {
+		return fmt.Errorf("failed to remove config %s for %s. %+v", option, who, err)
+	}
+	return nil
+}
+
+// GetConfig returns the value of the option that the daemons and clients matching who load from the mons
+func GetConfig(context *clusterd.Context, clusterName, who, option string) (string, error) {
+	args := []string{"config", "get", who, option}
+	buf, err := ExecuteCephCommandPlain(context, clusterName, args)
+	if err != nil {
+		return "", fmt.Errorf("failed to get config %s for %s. %+v", option, who, err)
+	}
+	return strings.TrimSpace(string(buf)), nil
+}
+
+// configEntry is an option set in the config database of the mons
+type configEntry struct {
+	Section string `json:"section"`
+	Name    string `json:"name"`
+	Value   string `json:"value"`
+}
+
+// GetStoredConfig returns the value of the option set for who in the config database of the mons, and whether it is
+// set at all. Unlike GetConfig, the options of the mgr modules that were never set are not an error.
+func GetStoredConfig(context *clusterd.Context, clusterName, who, option string) (string, bool, error) {
+	args := []string{"config", "dump"}
+	buf, err := ExecuteCephCommand(context, clusterName, args)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to dump the config. %+v", err)
+	}
+	var entries []configEntry
+	if err := json.Unmarshal(buf, &entries); err != nil {
+		return "", false, fmt.Errorf("failed to unmarshal the config dump. %+v. raw buffer response: %s", err, string(buf))
+	}
+	for _, entry := range entries {
+		if entry.Section == who && entry.Name == option {
+			return entry.Value, true, nil
+		}
+	}
+	return "", false, nil
+}
+
+// SetConfigKey stores the value of the key in the key/value store of the mons, where the mgr modules of ceph
+// releases older than mimic read their settings from
+func SetConfigKey(context *clusterd.Context, clusterName, key, value string) error {
+	args := []string{"config-key", "set", key, value}
+	if _, err := ExecuteCephCommand(context, clusterName, args); err != nil {
+		return fmt.Errorf("failed to set config key %s. %+v", key, err)
+	}
+	return nil
+}
+
+// RemoveConfigKey removes the key from the key/value store of the mons
+func RemoveConfigKey(context *clusterd.Context, clusterName, key string) error {
+	args := []string{"config-key", "rm", key}
+	if _, err := ExecuteCephCommand(context, clusterName, args); err != nil {
+		return fmt.Errorf("failed to remove config key %s. %+v", key, err)
+	}
+	return nil
+}
+
+// GetConfigKey returns the value of the key in the key/value store of the mons, and whether the key exists
+func GetConfigKey(context *clusterd.Context, clusterName, key string) (string, bool, error) {
+	buf, err := ExecuteCephCommand(context, clusterName, []string{"config-key", "ls"})
+	if err != nil {
+		return "", false, fmt.Errorf("failed to list the config keys. %+v", err)
+	}
+	var keys []string
+	if err := json.Unmarshal(buf, &keys); err != nil {
+		return "", false, fmt.Errorf("failed to unmarshal the config keys. %+v. raw buffer response: %s", err, string(buf))
+	}
+	found := false
+	for _, k := range keys {
+		if k == key {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return "", false, nil
+	}
+
+	buf, err = ExecuteCephCommandPlain(context, clusterName, []string{"config-key", "get", key})
+	if err != nil {
+		return "", false, fmt.Errorf("failed to get config key %s. %+v", key, err)
+	}
+	return strings.TrimSpace(string(buf)), true, nil
+}
@@ -27,6 +27,9 @@ import (
 	"github.com/rook/rook/pkg/clusterd"
 )
 
+// the crush map is read and set again this many times when it was changed concurrently
+const crushMapConflictRetries = 5
+
 const defaultCrushMap = `# begin crush map
 tunable choose_local_tries 0
 tunable choose_local_fallback_tries 0
@@ -151,6 +154,18 @@ func SetCrushMap(context *clusterd.Context, clusterName, compiledMap string) (st
 	return string(buf), nil
 }
 
+// SetCrushMapIfVersion sets the compiled crush map only if the crush map of the cluster has the prior version, so the
+// changes made since the crush map was read are not overwritten
+func SetCrushMapIfVersion(context *clusterd.Context, clusterName, compiledMap string, priorVersion int) (string, error) {
+	args := []string{"osd", "setcrushmap", "-i", compiledMap, strconv.Itoa(priorVersion)}
+	buf, err := ExecuteCephCommand(context, clusterName, args)
+	if err != nil {
+		return string(buf), fmt.Errorf("failed to set compiled crushmap with prior version %d. %v", priorVersion, err)
+	}
+
+	return string(buf), nil
+}
+
 func SetCrushTunables(context *clusterd.Context, clusterName, profile string) (string, error) {
 	args := []string{"osd", "crush", "tunables", profile}
 	buf, err := ExecuteCephCommandPlain(context, clusterName, args)
@@ -162,7 +177,7 @@ func SetCrushTunables(context *clusterd.Context, clusterName, profile string) (s
 }
 
 func CrushReweight(context *clusterd.Context, clusterName string, id int, weight float64) (string, error) {
-	args := []string{"osd", "crush", "reweight", fmt.Sprintf("osd.%d", id), fmt.Sprintf("%.1f", weight)}
+	args := []string{"osd", "crush", "reweight", fmt.Sprintf("osd.%d", id), fmt.Sprintf("%.4f", weight)}
 	buf, err := ExecuteCephCommand(context, clusterName, args)
 
 	return string(buf), err
@@ -214,7 +229,96 @@ func CreateDefaultCrushMap(context *clusterd.Context, clusterName string) (strin
 		logger.Infof("succeeded setting crush tunables to profile %s: %s", crushTunablesProfile, output)
 	}
 
-	// create a temp file that we will use to write the default decompiled crush map to
+	return setDecompiledCrushMap(context, clusterName, defaultCrushMap, -1)
+}
+
+// CreateSpreadCrushRule adds a replicated rule to the crush map that chooses the failure domains under the root, and
+// then places up to replicasPerFailureDomain replicas on different hosts within each failure domain. Nothing is
+// changed if the rule already exists. The rule has two choose steps, which the crush rule commands cannot create, so
+// the whole crush map is set. The crush map is only set if it was not changed since it was read, and otherwise the
+// rule is added again to the changed crush map.
+func CreateSpreadCrushRule(context *clusterd.Context, clusterName, ruleName, root, failureDomain string, replicasPerFailureDomain uint) error {
+	for i := 0; ; i++ {
+		conflict, err := addSpreadCrushRule(context, clusterName, ruleName, root, failureDomain, replicasPerFailureDomain)
+		if err == nil {
+			return nil
+		}
+		if !conflict || i == crushMapConflictRetries-1 {
+			return err
+		}
+		logger.Infof("crush map was changed while adding crush rule %s. retrying", ruleName)
+	}
+}
+
+// addSpreadCrushRule adds the rule to the crush map, and returns whether it failed because the crush map was changed
+// concurrently
+func addSpreadCrushRule(context *clusterd.Context, clusterName, ruleName, root, failureDomain string, replicasPerFailureDomain uint) (bool, error) {
+	// the version is read before the crush map so that any change after it is detected
+	dump, err := GetOSDDump(context, clusterName)
+	if err != nil {
+		return false, err
+	}
+	crush, err := GetCrushMap(context, clusterName)
+	if err != nil {
+		return false, err
+	}
+	ruleID := 0
+	for _, r := range crush.Rules {
+		if r.Name == ruleName {
+			logger.Debugf("crush rule %s already exists", ruleName)
+			return false, nil
+		}
+		if r.ID >= ruleID {
+			ruleID = r.ID + 1
+		}
+	}
+
+	compiledMap, err := ioutil.TempFile("", "")
+	if err != nil {
+		return false, fmt.Errorf("failed to open compiled crush map temp file: %+v", err)
+	}
+	defer compiledMap.Close()
+	defer os.Remove(compiledMap.Name())
+
+	buf, err := ExecuteCephCommandPlain(context, clusterName, []string{"osd", "getcrushmap"})
+	if err != nil {
+		return false, fmt.Errorf("failed to get the compiled crush map. %+v", err)
+	}
+	if _, err := compiledMap.Write(buf); err != nil {
+		return false, fmt.Errorf("failed to write compiled crush map to %s: %+v", compiledMap.Name(), err)
+	}
+	decompiled, err := context.Executor.ExecuteCommandWithOutput(false, "", CrushTool, "-d", compiledMap.Name())
+	if err != nil {
+		return false, fmt.Errorf("failed to decompile crushmap from %s: %+v", compiledMap.Name(), err)
+	}
+
+	rule := fmt.Sprintf(`
+rule %s {
+	id %d
+	type replicated
+	min_size 1
+	max_size 10
+	step take %s
+	step choose firstn 0 type %s
+	step chooseleaf firstn %d type host
+	step emit
+}
+`, ruleName, ruleID, root, failureDomain, replicasPerFailureDomain)
+	decompiled = strings.TrimSpace(strings.Replace(decompiled, "# end crush map", "", 1)) + "\n" + rule + "\n# end crush map\n"
+
+	if output, err := setDecompiledCrushMap(context, clusterName, decompiled, dump.CrushVersion); err != nil {
+		err = fmt.Errorf("failed to add crush rule %s. %s. %+v", ruleName, output, err)
+		current, dumpErr := GetOSDDump(context, clusterName)
+		return dumpErr == nil && current.CrushVersion != dump.CrushVersion, err
+	}
+	logger.Infof("created crush rule %s with %d replicas per %s under %s", ruleName, replicasPerFailureDomain, failureDomain, root)
+	return false, nil
+}
+
+// setDecompiledCrushMap compiles the crush map and sets it on the cluster. The crush map is only set if the current
+// crush map has the prior version, unless the prior version is negative.
+func setDecompiledCrushMap(context *clusterd.Context, clusterName, crushMap string, priorVersion int) (string, error) {
+	// create a temp file that we will use to write the decompiled crush map to
 	decompiledMap, err := ioutil.TempFile("", "")
 	if err != nil {
 		return "", fmt.Errorf("failed to open decompiled crush map temp file: %+v", err)
@@ -222,8 +326,8 @@ func CreateDefaultCrushMap(context *clusterd.Context, clusterName string) (strin
 	defer decompiledMap.Close()
 	defer os.Remove(decompiledMap.Name())
 
-	// write the default decompiled crush map to the temp file
-	_, err = decompiledMap.WriteString(defaultCrushMap)
+	// write the decompiled crush map to the temp file
+	_, err = decompiledMap.WriteString(crushMap)
 	if err != nil {
 		return "", fmt.Errorf("failed to write decompiled crush map to %s: %+v", decompiledMap.Name(), err)
 	}
@@ -238,13 +342,17 @@ func CreateDefaultCrushMap(context *clusterd.Context, clusterName string) (strin
 
 	// compile the crush map to an output file
 	args := []string{"-c", decompiledMap.Name(), "-o", compiledMap.Name()}
-	output, err = context.Executor.ExecuteCommandWithOutput(false, "", CrushTool, args...)
+	output, err := context.Executor.ExecuteCommandWithOutput(false, "", CrushTool, args...)
 	if err != nil {
 		return output, fmt.Errorf("failed to compile crushmap from %s: %+v", decompiledMap.Name(), err)
 	}
 
 	// set the compiled crush map on the cluster
-	output, err = SetCrushMap(context, clusterName, compiledMap.Name())
+	if priorVersion >= 0 {
+		output, err = SetCrushMapIfVersion(context, clusterName, compiledMap.Name(), priorVersion)
+	} else {
+		output, err = SetCrushMap(context, clusterName, compiledMap.Name())
+	}
 	if err != nil {
 		return output, fmt.Errorf("failed to set crushmap to %s: %+v", compiledMap.Name(), err)
 	}
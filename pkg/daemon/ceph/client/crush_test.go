@@ -17,6 +17,9 @@ package client
 
 import (
 	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/rook/rook/pkg/clusterd"
@@ -273,3 +276,69 @@ func TestCrushLocation(t *testing.T) {
 	assert.NotNil(t, err)
 	assert.Contains(t, err.Error(), "is not in a valid format")
 }
+
+func TestCreateSpreadCrushRule(t *testing.T) {
+	var compiled string
+	setMap := false
+	crushVersion := 7
+	conflicts := 0
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithOutputFile: func(debug bool, actionName, command, outputFile string, args ...string) (string, error) {
+			switch {
+			case args[0] == "osd" && args[1] == "dump":
+				return fmt.Sprintf(`{"crush_version":%d}`, crushVersion), nil
+			case args[1] == "crush" && args[2] == "dump":
+				return testCrushMap, nil
+			case args[1] == "getcrushmap":
+				return "compiled", nil
+			case args[1] == "setcrushmap":
+				// the crush map is only set if it was not changed since it was read
+				assert.Equal(t, strconv.Itoa(crushVersion), args[4])
+				if conflicts > 0 {
+					conflicts--
+					crushVersion++
+					return "", fmt.Errorf("prior_version %s != crush version %d", args[4], crushVersion)
+				}
+				setMap = true
+				return "", nil
+			}
+			return "", fmt.Errorf("unexpected ceph command '%v'", args)
+		},
+		MockExecuteCommandWithOutput: func(debug bool, actionName, command string, args ...string) (string, error) {
+			assert.Equal(t, CrushTool, command)
+			if args[0] == "-d" {
+				return "# begin crush map\n# rules\n# end crush map\n", nil
+			}
+			if args[0] == "-c" {
+				buf, err := ioutil.ReadFile(args[1])
+				assert.Nil(t, err)
+				compiled = string(buf)
+				return "", nil
+			}
+			return "", fmt.Errorf("unexpected crushtool args '%v'", args)
+		},
+	}
+	context := &clusterd.Context{Executor: executor}
+
+	// the rule is added after the existing rules
+	err := CreateSpreadCrushRule(context, "rook", "stretch", "default", "datacenter", 2)
+	assert.Nil(t, err)
+	assert.True(t, setMap)
+	assert.Contains(t, compiled, "rule stretch {\n\tid 2\n")
+	assert.Contains(t, compiled, "\tstep choose firstn 0 type datacenter\n\tstep chooseleaf firstn 2 type host\n")
+	assert.True(t, strings.HasSuffix(compiled, "}\n\n# end crush map\n"))
+
+	// the rule is added again to a crush map that was changed concurrently
+	setMap = false
+	conflicts = 1
+	err = CreateSpreadCrushRule(context, "rook", "stretch", "default", "datacenter", 2)
+	assert.Nil(t, err)
+	assert.True(t, setMap)
+	assert.Equal(t, 8, crushVersion)
+
+	// an existing rule is not changed
+	setMap = false
+	err = CreateSpreadCrushRule(context, "rook", "replicated_ruleset", "default", "datacenter", 2)
+	assert.Nil(t, err)
+	assert.False(t, setMap)
+}
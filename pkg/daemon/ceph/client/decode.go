@@ -0,0 +1,93 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/rook/rook/pkg/clusterd"
+	"github.com/rook/rook/pkg/util/metrics"
+)
+
+// executeCephCommandWithOutputReader runs the ceph command with its json output written to a file, which is passed to
+// the read function so that a large output such as a pg dump is never loaded in memory at once
+func executeCephCommandWithOutputReader(context *clusterd.Context, clusterName string, args []string, read func(io.Reader) error) error {
+	command, args := FinalizeCephCommandArgs(CephTool, args, context.ConfigDir, clusterName)
+	args = append(args, "--format", "json")
+	if command == Kubectl {
+		// the output of the commands in the toolbox is captured from stdout
+		buf, err := executeCommand(context, command, args)
+		if err != nil {
+			return err
+		}
+		return read(bytes.NewReader(buf))
+	}
+	defer metrics.ObserveCommand(command, args, time.Now())
+	return context.Executor.ExecuteCommandWithOutputFileReader(false, "", command, "--out-file", read, args...)
+}
+
+// decodeArray calls decode for each record of a json array, which decodes the next record from the decoder. The
+// array is either the whole output, or the value of the key in an object, in which case the other values of the object
+// are skipped. The records are decoded as they are read, so only one record is in memory at a time. An error returned
+// by decode stops the decoding and is returned as is.
+func decodeArray(r io.Reader, key string, decode func(*json.Decoder) error) error {
+	dec := json.NewDecoder(r)
+	t, err := dec.Token()
+	if err != nil {
+		return fmt.Errorf("failed to read the start of the output. %+v", err)
+	}
+	switch t {
+	case json.Delim('['):
+		return decodeRecords(dec, decode)
+	case json.Delim('{'):
+		for dec.More() {
+			t, err := dec.Token()
+			if err != nil {
+				return fmt.Errorf("failed to read a key of the output. %+v", err)
+			}
+			if t == key {
+				if t, err := dec.Token(); err != nil || t != json.Delim('[') {
+					return fmt.Errorf("the value of %s is not an array. %+v", key, err)
+				}
+				return decodeRecords(dec, decode)
+			}
+			// skip the values of the other keys
+			var value json.RawMessage
+			if err := dec.Decode(&value); err != nil {
+				return fmt.Errorf("failed to skip the value of %v. %+v", t, err)
+			}
+		}
+		return fmt.Errorf("key %s not found in the output", key)
+	}
+	return fmt.Errorf("unexpected output %v, expected an array or an object", t)
+}
+
+func decodeRecords(dec *json.Decoder, decode func(*json.Decoder) error) error {
+	for dec.More() {
+		if err := decode(dec); err != nil {
+			return err
+		}
+	}
+	// the closing bracket of the array
+	if _, err := dec.Token(); err != nil {
+		return fmt.Errorf("failed to read the end of the array. %+v", err)
+	}
+	return nil
+}
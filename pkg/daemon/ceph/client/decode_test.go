@@ -0,0 +1,103 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/rook/rook/pkg/clusterd"
+	exectest "github.com/rook/rook/pkg/util/exec/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func decodeIDs(output, key string) ([]int, error) {
+	var ids []int
+	err := decodeArray(strings.NewReader(output), key, func(dec *json.Decoder) error {
+		var record struct {
+			ID int `json:"id"`
+		}
+		if err := dec.Decode(&record); err != nil {
+			return err
+		}
+		ids = append(ids, record.ID)
+		return nil
+	})
+	return ids, err
+}
+
+func TestDecodeArray(t *testing.T) {
+	// the records of an array
+	ids, err := decodeIDs(`[{"id":1,"name":"a"},{"id":2}]`, "records")
+	assert.Nil(t, err)
+	assert.Equal(t, []int{1, 2}, ids)
+
+	// the records of the array of a key, skipping the other values
+	ids, err = decodeIDs(`{"version":3,"stamp":{"a":[1,2]},"records":[{"id":3}],"after":"x"}`, "records")
+	assert.Nil(t, err)
+	assert.Equal(t, []int{3}, ids)
+
+	ids, err = decodeIDs(`[]`, "records")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(ids))
+
+	// invalid outputs
+	_, err = decodeIDs(`{"version":3}`, "records")
+	assert.NotNil(t, err)
+	_, err = decodeIDs(`{"records":{"id":1}}`, "records")
+	assert.NotNil(t, err)
+	_, err = decodeIDs(`[{"id":1},{"id":`, "records")
+	assert.NotNil(t, err)
+	_, err = decodeIDs(`"records"`, "records")
+	assert.NotNil(t, err)
+	_, err = decodeIDs(``, "records")
+	assert.NotNil(t, err)
+}
+
+func TestForEachPGDumpBrief(t *testing.T) {
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithOutputFile: func(debug bool, actionName, command, outfileArg string, args ...string) (string, error) {
+			assert.Equal(t, []string{"pg", "dump", "pgs_brief"}, args[:3])
+			return `{"pg_ready":true,"pg_stats":[{"pgid":"1.0","state":"active+clean","up":[0,1],"up_primary":0,"acting":[0,1],"acting_primary":0},
+				{"pgid":"1.1","state":"active+clean","up":[1,2],"up_primary":1,"acting":[1,2],"acting_primary":1}]}`, nil
+		},
+	}
+	context := &clusterd.Context{Executor: executor}
+
+	pgs, err := GetPGDumpBrief(context, "rook")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(pgs))
+	assert.Equal(t, "1.1", pgs[1].ID)
+	assert.Equal(t, []int{1, 2}, pgs[1].ActingOsdIDs)
+
+	// the dump stops at the first error of the processing, which is returned as is
+	count := 0
+	err = ForEachPGDumpBrief(context, "rook", func(pg PGDumpBrief) error {
+		count++
+		return fmt.Errorf("pg %s is not done", pg.ID)
+	})
+	assert.Equal(t, "pg 1.0 is not done", err.Error())
+	assert.Equal(t, 1, count)
+
+	// the failures of the command are returned
+	executor.MockExecuteCommandWithOutputFile = func(debug bool, actionName, command, outfileArg string, args ...string) (string, error) {
+		return "", fmt.Errorf("timed out")
+	}
+	_, err = GetPGDumpBrief(context, "rook")
+	assert.NotNil(t, err)
+}
@@ -30,8 +30,17 @@ type CephErasureCodeProfile struct {
 	Technique        string `json:"technique"`
 	FailureDomain    string `json:"crush-failure-domain"`
 	CrushRoot        string `json:"crush-root"`
+	Locality         uint   `json:"l,string"`
+	Durability       uint   `json:"c,string"`
 }
 
+const (
+	// LRCPlugin is the erasure code plugin with locally repairable codes
+	LRCPlugin = "lrc"
+	// SHECPlugin is the erasure code plugin with shingled codes
+	SHECPlugin = "shec"
+)
+
 func ListErasureCodeProfiles(context *clusterd.Context, clusterName string) ([]string, error) {
 	args := []string{"osd", "erasure-code-profile", "ls"}
 	buf, err := ExecuteCephCommand(context, clusterName, args)
@@ -75,8 +84,29 @@ func CreateErasureCodeProfile(context *clusterd.Context, clusterName string, con
 	profilePairs := []string{
 		fmt.Sprintf("k=%d", config.DataChunkCount),
 		fmt.Sprintf("m=%d", config.CodingChunkCount),
-		fmt.Sprintf("plugin=%s", defaultProfile.Plugin),
-		fmt.Sprintf("technique=%s", defaultProfile.Technique),
+	}
+	switch {
+	case config.Plugin == "" || config.Plugin == defaultProfile.Plugin:
+		profilePairs = append(profilePairs,
+			fmt.Sprintf("plugin=%s", defaultProfile.Plugin),
+			fmt.Sprintf("technique=%s", defaultProfile.Technique))
+	case config.Plugin == LRCPlugin:
+		profilePairs = append(profilePairs, fmt.Sprintf("plugin=%s", config.Plugin), fmt.Sprintf("l=%d", config.Locality))
+	case config.Plugin == SHECPlugin:
+		profilePairs = append(profilePairs, fmt.Sprintf("plugin=%s", config.Plugin))
+		if config.Durability > 0 {
+			profilePairs = append(profilePairs, fmt.Sprintf("c=%d", config.Durability))
+		}
+	default:
+		// the other plugins use their default technique
+		profilePairs = append(profilePairs, fmt.Sprintf("plugin=%s", config.Plugin))
+	}
+	// the failure domain and crush root of the erasure coded config take precedence over those of the pool
+	if config.FailureDomain != "" {
+		failureDomain = config.FailureDomain
+	}
+	if config.CrushRoot != "" {
+		crushRoot = config.CrushRoot
 	}
 	if failureDomain != "" {
 		profilePairs = append(profilePairs, fmt.Sprintf("crush-failure-domain=%s", failureDomain))
@@ -116,6 +146,7 @@ func ModelPoolToCephPool(modelPool model.Pool) CephStoragePoolDetails {
 
 	if modelPool.Type == model.Replicated {
 		pool.Size = modelPool.ReplicatedConfig.Size
+		pool.ReplicasPerFailureDomain = modelPool.ReplicatedConfig.ReplicasPerFailureDomain
 	} else if modelPool.Type == model.ErasureCoded {
 		pool.ErasureCodeProfile = GetErasureCodeProfileForPool(modelPool.Name)
 	}
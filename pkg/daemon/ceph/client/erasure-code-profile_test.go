@@ -34,6 +34,75 @@ func TestCreateProfileWithFailureDomain(t *testing.T) {
 	testCreateProfile(t, "osd", "")
 }
 
+func TestCreateProfileWithECFailureDomain(t *testing.T) {
+	cfg := model.ErasureCodedPoolConfig{DataChunkCount: 2, CodingChunkCount: 3, FailureDomain: "rack", CrushRoot: "ecroot"}
+	var profile []string
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithOutputFile: func(debug bool, actionName, command, outputFile string, args ...string) (string, error) {
+			if args[1] == "erasure-code-profile" && args[2] == "get" {
+				return `{"plugin":"jerasure","technique":"reed_sol_van"}`, nil
+			}
+			if args[1] == "erasure-code-profile" && args[2] == "set" {
+				profile = args[4:10]
+				return "", nil
+			}
+			return "", fmt.Errorf("unexpected ceph command '%v'", args)
+		},
+	}
+
+	// the settings of the erasure coded config take precedence over the pool
+	err := CreateErasureCodeProfile(&clusterd.Context{Executor: executor}, "myns", cfg, "myapp", "host", "default")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"k=2", "m=3", "plugin=jerasure", "technique=reed_sol_van", "crush-failure-domain=rack", "crush-root=ecroot"}, profile)
+}
+
+func TestCreateProfileWithPlugin(t *testing.T) {
+	var profile []string
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithOutputFile: func(debug bool, actionName, command, outputFile string, args ...string) (string, error) {
+			if args[1] == "erasure-code-profile" && args[2] == "get" {
+				return `{"plugin":"jerasure","technique":"reed_sol_van"}`, nil
+			}
+			if args[1] == "erasure-code-profile" && args[2] == "set" {
+				profile = args[4:]
+				for i, arg := range profile {
+					if arg == "--cluster=myns" {
+						profile = profile[:i]
+						break
+					}
+				}
+				return "", nil
+			}
+			return "", fmt.Errorf("unexpected ceph command '%v'", args)
+		},
+	}
+	context := &clusterd.Context{Executor: executor}
+
+	cfg := model.ErasureCodedPoolConfig{DataChunkCount: 4, CodingChunkCount: 2, Plugin: "lrc", Locality: 3}
+	assert.Nil(t, CreateErasureCodeProfile(context, "myns", cfg, "myapp", "", ""))
+	assert.Equal(t, []string{"k=4", "m=2", "plugin=lrc", "l=3"}, profile)
+
+	cfg = model.ErasureCodedPoolConfig{DataChunkCount: 4, CodingChunkCount: 3, Plugin: "shec", Durability: 2}
+	assert.Nil(t, CreateErasureCodeProfile(context, "myns", cfg, "myapp", "host", ""))
+	assert.Equal(t, []string{"k=4", "m=3", "plugin=shec", "c=2", "crush-failure-domain=host"}, profile)
+
+	// the technique of the default plugin is kept
+	cfg = model.ErasureCodedPoolConfig{DataChunkCount: 4, CodingChunkCount: 2, Plugin: "jerasure"}
+	assert.Nil(t, CreateErasureCodeProfile(context, "myns", cfg, "myapp", "", ""))
+	assert.Equal(t, []string{"k=4", "m=2", "plugin=jerasure", "technique=reed_sol_van"}, profile)
+}
+
+func TestGetProfileWithPlugin(t *testing.T) {
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithOutputFile: func(debug bool, actionName, command, outputFile string, args ...string) (string, error) {
+			return `{"k":"4","m":"3","c":"2","plugin":"shec","technique":"multiple","crush-failure-domain":"host"}`, nil
+		},
+	}
+	profile, err := GetErasureCodeProfileDetails(&clusterd.Context{Executor: executor}, "myns", "myprofile")
+	assert.Nil(t, err)
+	assert.Equal(t, CephErasureCodeProfile{DataChunkCount: 4, CodingChunkCount: 3, Durability: 2, Plugin: "shec", Technique: "multiple", FailureDomain: "host"}, profile)
+}
+
 func testCreateProfile(t *testing.T, failureDomain, crushRoot string) {
 	cfg := model.ErasureCodedPoolConfig{DataChunkCount: 2, CodingChunkCount: 3, Algorithm: "myalg"}
 
@@ -153,6 +153,27 @@ func MarkFilesystemAsDown(context *clusterd.Context, clusterName string, fsName
 	return nil
 }
 
+// SetFilesystemProperty sets a property of the mds map of the file system, such as session_timeout
+func SetFilesystemProperty(context *clusterd.Context, clusterName, fsName, name, value string) error {
+	args := []string{"fs", "set", fsName, name, value}
+	_, err := ExecuteCephCommand(context, clusterName, args)
+	if err != nil {
+		return fmt.Errorf("failed to set %s to %s on file system %s: %+v", name, value, fsName, err)
+	}
+	return nil
+}
+
+// SetFilesystemSnapshots allows or forbids the creation of new snapshots of the directories of the file system. The
+// existing snapshots are kept when the snapshots are forbidden.
+func SetFilesystemSnapshots(context *clusterd.Context, clusterName, fsName string, allow bool) error {
+	args := []string{"fs", "set", fsName, "allow_new_snaps", strconv.FormatBool(allow), confirmFlag}
+	_, err := ExecuteCephCommand(context, clusterName, args)
+	if err != nil {
+		return fmt.Errorf("failed to set allow_new_snaps to %t on file system %s: %+v", allow, fsName, err)
+	}
+	return nil
+}
+
 func FailMDS(context *clusterd.Context, clusterName string, gid int) error {
 	args := []string{"mds", "fail", strconv.Itoa(gid)}
 	_, err := ExecuteCephCommand(context, clusterName, args)
@@ -0,0 +1,112 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/rook/rook/pkg/clusterd"
+)
+
+// FilesystemClient is a ceph user restricted to a path of a filesystem, with the info to mount the path
+type FilesystemClient struct {
+	// The name of the user without the client. prefix, as expected by the name option of the mount
+	Name       string   `json:"name"`
+	Key        string   `json:"key"`
+	Filesystem string   `json:"filesystem"`
+	Path       string   `json:"path"`
+	Monitors   []string `json:"monitors"`
+	// The options to mount the path with the kernel client, such as name=app1,secret=<key>,mds_namespace=myfs
+	MountOptions string `json:"mountOptions"`
+}
+
+// FilesystemClientCaps returns the caps of a user restricted to the path of the filesystem. The user can only write
+// the data of its files in the rados namespace of the data pools when the pool namespace is set, which requires the
+// pool_namespace of the directory layout to be set to the same namespace.
+func FilesystemClientCaps(fs CephFilesystem, fsPath, poolNamespace string, readOnly bool) []string {
+	access := "rw"
+	if readOnly {
+		access = "r"
+	}
+
+	osdCaps := []string{}
+	for _, pool := range fs.DataPools {
+		c := fmt.Sprintf("allow %s pool=%s", access, pool)
+		if poolNamespace != "" {
+			c = fmt.Sprintf("%s namespace=%s", c, poolNamespace)
+		}
+		osdCaps = append(osdCaps, c)
+	}
+
+	// the user can only mount the path itself or its subdirectories
+	return []string{
+		"mon", "allow r",
+		"mds", fmt.Sprintf("allow %s path=%s", access, fsPath),
+		"osd", strings.Join(osdCaps, ", "),
+	}
+}
+
+// AuthorizeFilesystemClient creates a ceph user that can only access the path of the filesystem and returns the info
+// to mount the path. The key of the user is returned if it already exists with the same caps.
+func AuthorizeFilesystemClient(context *clusterd.Context, clusterName, fsName, name, fsPath, poolNamespace string,
+	readOnly bool) (*FilesystemClient, error) {
+	if !strings.HasPrefix(fsPath, "/") {
+		return nil, fmt.Errorf("path %s of client %s must be absolute", fsPath, name)
+	}
+	fsPath = path.Clean(fsPath)
+
+	filesystems, err := ListFilesystems(context, clusterName)
+	if err != nil {
+		return nil, err
+	}
+	var fs *CephFilesystem
+	for i := range filesystems {
+		if filesystems[i].Name == fsName {
+			fs = &filesystems[i]
+		}
+	}
+	if fs == nil {
+		return nil, fmt.Errorf("filesystem %s not found", fsName)
+	}
+
+	name = strings.TrimPrefix(name, "client.")
+	key, err := AuthGetOrCreateKey(context, clusterName, "client."+name, FilesystemClientCaps(*fs, fsPath, poolNamespace, readOnly))
+	if err != nil {
+		return nil, fmt.Errorf("failed to authorize client %s for path %s of filesystem %s. %+v", name, fsPath, fsName, err)
+	}
+
+	status, err := GetMonStatus(context, clusterName, false)
+	if err != nil {
+		return nil, err
+	}
+	monitors := []string{}
+	for _, mon := range status.MonMap.Mons {
+		// the addr of a mon is followed by its nonce, such as 10.0.0.1:6789/0
+		monitors = append(monitors, strings.Split(mon.Address, "/")[0])
+	}
+
+	return &FilesystemClient{
+		Name:         name,
+		Key:          key,
+		Filesystem:   fsName,
+		Path:         fsPath,
+		Monitors:     monitors,
+		MountOptions: fmt.Sprintf("name=%s,secret=%s,mds_namespace=%s", name, key, fsName),
+	}, nil
+}
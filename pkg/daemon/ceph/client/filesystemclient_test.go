@@ -0,0 +1,70 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/rook/rook/pkg/clusterd"
+	exectest "github.com/rook/rook/pkg/util/exec/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFilesystemClientCaps(t *testing.T) {
+	fs := CephFilesystem{Name: "myfs", DataPools: []string{"myfs-data0", "myfs-data1"}}
+
+	caps := FilesystemClientCaps(fs, "/app1", "", false)
+	assert.Equal(t, []string{"mon", "allow r", "mds", "allow rw path=/app1", "osd", "allow rw pool=myfs-data0, allow rw pool=myfs-data1"}, caps)
+
+	caps = FilesystemClientCaps(fs, "/app1", "app1", true)
+	assert.Equal(t, []string{"mon", "allow r", "mds", "allow r path=/app1",
+		"osd", "allow r pool=myfs-data0 namespace=app1, allow r pool=myfs-data1 namespace=app1"}, caps)
+}
+
+func TestAuthorizeFilesystemClient(t *testing.T) {
+	var authArgs []string
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithOutputFile: func(debug bool, actionName string, command string, outFileArg string, args ...string) (string, error) {
+			switch {
+			case args[0] == "fs" && args[1] == "ls":
+				return cephFilesystemListResponseRaw, nil
+			case args[0] == "auth" && args[1] == "get-or-create-key":
+				authArgs = args[2:9]
+				return `{"key":"AQBsecret=="}`, nil
+			case args[0] == "mon_status":
+				return `{"quorum":[0,1],"monmap":{"mons":[{"name":"a","rank":0,"addr":"10.0.0.1:6789/0"},{"name":"b","rank":1,"addr":"10.0.0.2:6789/0"}]}}`, nil
+			}
+			return "", fmt.Errorf("unexpected ceph command '%v'", args)
+		},
+	}
+	context := &clusterd.Context{Executor: executor}
+
+	fsClient, err := AuthorizeFilesystemClient(context, "rook-ceph", "myfs1", "client.app1", "/volumes/app1/", "", false)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"client.app1", "mon", "allow r", "mds", "allow rw path=/volumes/app1", "osd", "allow rw pool=myfs1-data"}, authArgs)
+	assert.Equal(t, "app1", fsClient.Name)
+	assert.Equal(t, "AQBsecret==", fsClient.Key)
+	assert.Equal(t, "/volumes/app1", fsClient.Path)
+	assert.Equal(t, []string{"10.0.0.1:6789", "10.0.0.2:6789"}, fsClient.Monitors)
+	assert.Equal(t, "name=app1,secret=AQBsecret==,mds_namespace=myfs1", fsClient.MountOptions)
+
+	_, err = AuthorizeFilesystemClient(context, "rook-ceph", "myfs1", "app1", "volumes/app1", "", false)
+	assert.NotNil(t, err)
+	_, err = AuthorizeFilesystemClient(context, "rook-ceph", "otherfs", "app1", "/app1", "", false)
+	assert.NotNil(t, err)
+}
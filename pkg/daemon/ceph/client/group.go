@@ -0,0 +1,175 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/rook/rook/pkg/clusterd"
+)
+
+// CephGroupImage is an image in a consistency group, which may be in another pool than the group
+type CephGroupImage struct {
+	Image     string `json:"image"`
+	Pool      string `json:"pool"`
+	Namespace string `json:"namespace"`
+	State     string `json:"state"`
+}
+
+// PoolSpec returns the pool of the image, scoped to its rados namespace as "pool/namespace" if it has one
+func (i *CephGroupImage) PoolSpec() string {
+	return PoolNamespaceSpec(i.Pool, i.Namespace)
+}
+
+// CephGroupSnapshot is a snapshot of all the images of a consistency group taken at the same point in time
+type CephGroupSnapshot struct {
+	Snapshot string `json:"snapshot"`
+	// State is incomplete if the snapshot failed to be taken of all the images
+	State string `json:"state"`
+}
+
+// ListGroups returns the names of the consistency groups of the pool
+func ListGroups(context *clusterd.Context, clusterName, poolName string) ([]string, error) {
+	args := []string{"group", "ls", poolName}
+	buf, err := ExecuteRBDCommand(context, clusterName, args)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the groups of pool %s: %+v. output: %s", poolName, err, string(buf))
+	}
+
+	groups := []string{}
+	if len(strings.TrimSpace(string(buf))) == 0 {
+		return groups, nil
+	}
+	if err := json.Unmarshal(buf, &groups); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal the groups of pool %s. %+v. raw buffer response: %s", poolName, err, string(buf))
+	}
+	return groups, nil
+}
+
+// CreateGroup creates a consistency group in the pool
+func CreateGroup(context *clusterd.Context, clusterName, name, poolName string) error {
+	args := []string{"group", "create", getImageSpec(name, poolName)}
+	buf, err := ExecuteRBDCommandNoFormat(context, clusterName, args)
+	if err != nil {
+		return fmt.Errorf("failed to create group %s in pool %s: %+v. output: %s", name, poolName, err, string(buf))
+	}
+	return nil
+}
+
+// RemoveGroup deletes the consistency group with its snapshots. The images of the group are not deleted.
+func RemoveGroup(context *clusterd.Context, clusterName, name, poolName string) error {
+	args := []string{"group", "rm", getImageSpec(name, poolName)}
+	buf, err := ExecuteRBDCommandNoFormat(context, clusterName, args)
+	if err != nil {
+		return fmt.Errorf("failed to remove group %s in pool %s: %+v. output: %s", name, poolName, err, string(buf))
+	}
+	return nil
+}
+
+// AddGroupImage adds the image in the image pool to the consistency group. An image is in at most one group.
+func AddGroupImage(context *clusterd.Context, clusterName, name, poolName, image, imagePoolName string) error {
+	args := []string{"group", "image", "add", getImageSpec(name, poolName), getImageSpec(image, imagePoolName)}
+	buf, err := ExecuteRBDCommandNoFormat(context, clusterName, args)
+	if err != nil {
+		return fmt.Errorf("failed to add image %s/%s to group %s in pool %s: %+v. output: %s", imagePoolName, image, name, poolName, err, string(buf))
+	}
+	return nil
+}
+
+// RemoveGroupImage removes the image in the image pool from the consistency group
+func RemoveGroupImage(context *clusterd.Context, clusterName, name, poolName, image, imagePoolName string) error {
+	args := []string{"group", "image", "rm", getImageSpec(name, poolName), getImageSpec(image, imagePoolName)}
+	buf, err := ExecuteRBDCommandNoFormat(context, clusterName, args)
+	if err != nil {
+		return fmt.Errorf("failed to remove image %s/%s from group %s in pool %s: %+v. output: %s", imagePoolName, image, name, poolName, err, string(buf))
+	}
+	return nil
+}
+
+// ListGroupImages returns the images of the consistency group
+func ListGroupImages(context *clusterd.Context, clusterName, name, poolName string) ([]CephGroupImage, error) {
+	args := []string{"group", "image", "list", getImageSpec(name, poolName)}
+	buf, err := ExecuteRBDCommand(context, clusterName, args)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the images of group %s in pool %s: %+v. output: %s", name, poolName, err, string(buf))
+	}
+
+	images := []CephGroupImage{}
+	if len(strings.TrimSpace(string(buf))) == 0 {
+		return images, nil
+	}
+	if err := json.Unmarshal(buf, &images); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal the images of group %s in pool %s. %+v. raw buffer response: %s", name, poolName, err, string(buf))
+	}
+	return images, nil
+}
+
+// CreateGroupSnapshot takes a crash consistent snapshot of all the images of the consistency group. The writes to the
+// images are quiesced while the snapshots of the images are taken.
+func CreateGroupSnapshot(context *clusterd.Context, clusterName, name, poolName, snapshot string) error {
+	args := []string{"group", "snap", "create", groupSnapSpec(name, poolName, snapshot)}
+	buf, err := ExecuteRBDCommandNoFormat(context, clusterName, args)
+	if err != nil {
+		return fmt.Errorf("failed to create snapshot %s of group %s in pool %s: %+v. output: %s", snapshot, name, poolName, err, string(buf))
+	}
+	return nil
+}
+
+// ListGroupSnapshots returns the snapshots of the consistency group
+func ListGroupSnapshots(context *clusterd.Context, clusterName, name, poolName string) ([]CephGroupSnapshot, error) {
+	args := []string{"group", "snap", "list", getImageSpec(name, poolName)}
+	buf, err := ExecuteRBDCommand(context, clusterName, args)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the snapshots of group %s in pool %s: %+v. output: %s", name, poolName, err, string(buf))
+	}
+
+	snapshots := []CephGroupSnapshot{}
+	if len(strings.TrimSpace(string(buf))) == 0 {
+		return snapshots, nil
+	}
+	if err := json.Unmarshal(buf, &snapshots); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal the snapshots of group %s in pool %s. %+v. raw buffer response: %s", name, poolName, err, string(buf))
+	}
+	return snapshots, nil
+}
+
+// RemoveGroupSnapshot deletes the snapshot of the consistency group with the snapshots of its images
+func RemoveGroupSnapshot(context *clusterd.Context, clusterName, name, poolName, snapshot string) error {
+	args := []string{"group", "snap", "rm", groupSnapSpec(name, poolName, snapshot)}
+	buf, err := ExecuteRBDCommandNoFormat(context, clusterName, args)
+	if err != nil {
+		return fmt.Errorf("failed to remove snapshot %s of group %s in pool %s: %+v. output: %s", snapshot, name, poolName, err, string(buf))
+	}
+	return nil
+}
+
+// RollbackGroupSnapshot restores all the images of the consistency group to the snapshot. The images must not be in
+// use since their data is replaced under the clients.
+func RollbackGroupSnapshot(context *clusterd.Context, clusterName, name, poolName, snapshot string) error {
+	args := []string{"group", "snap", "rollback", groupSnapSpec(name, poolName, snapshot), "--no-progress"}
+	buf, err := ExecuteRBDCommandNoFormat(context, clusterName, args)
+	if err != nil {
+		return fmt.Errorf("failed to roll back group %s in pool %s to snapshot %s: %+v. output: %s", name, poolName, snapshot, err, string(buf))
+	}
+	return nil
+}
+
+func groupSnapSpec(name, poolName, snapshot string) string {
+	return fmt.Sprintf("%s@%s", getImageSpec(name, poolName), snapshot)
+}
@@ -0,0 +1,87 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package client
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/rook/rook/pkg/clusterd"
+	exectest "github.com/rook/rook/pkg/util/exec/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGroups(t *testing.T) {
+	commands := []string{}
+	output := map[string]string{}
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithOutput: func(debug bool, actionName string, command string, args ...string) (string, error) {
+			if command != "rbd" || args[0] != "group" {
+				return "", fmt.Errorf("unexpected rbd command '%v'", args)
+			}
+			// leave out the config and keyring args
+			end := 0
+			for end < len(args) && !strings.HasPrefix(args[end], "--cluster=") {
+				end++
+			}
+			cmd := strings.Join(args[:end], " ")
+			commands = append(commands, cmd)
+			return output[cmd], nil
+		},
+	}
+	context := &clusterd.Context{Executor: executor}
+
+	groups, err := ListGroups(context, "foocluster", "pool1")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(groups))
+	output["group ls pool1"] = `["db"]`
+	groups, err = ListGroups(context, "foocluster", "pool1")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"db"}, groups)
+
+	output["group image list pool1/db"] = `[{"image":"data","pool":"pool1","namespace":"","state":"attached"},` +
+		`{"image":"wal","pool":"ssdpool","namespace":"team-a","state":"attached"}]`
+	images, err := ListGroupImages(context, "foocluster", "db", "pool1")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(images))
+	assert.Equal(t, "pool1", images[0].PoolSpec())
+	assert.Equal(t, "wal", images[1].Image)
+	assert.Equal(t, "ssdpool/team-a", images[1].PoolSpec())
+
+	output["group snap list pool1/db"] = `[{"snapshot":"nightly","state":"ok"},{"snapshot":"broken","state":"incomplete"}]`
+	snapshots, err := ListGroupSnapshots(context, "foocluster", "db", "pool1")
+	assert.Nil(t, err)
+	assert.Equal(t, []CephGroupSnapshot{{Snapshot: "nightly", State: "ok"}, {Snapshot: "broken", State: "incomplete"}}, snapshots)
+
+	commands = []string{}
+	assert.Nil(t, CreateGroup(context, "foocluster", "db", "pool1"))
+	assert.Nil(t, AddGroupImage(context, "foocluster", "db", "pool1", "wal", "ssdpool/team-a"))
+	assert.Nil(t, CreateGroupSnapshot(context, "foocluster", "db", "pool1", "nightly"))
+	assert.Nil(t, RollbackGroupSnapshot(context, "foocluster", "db", "pool1", "nightly"))
+	assert.Nil(t, RemoveGroupSnapshot(context, "foocluster", "db", "pool1", "nightly"))
+	assert.Nil(t, RemoveGroupImage(context, "foocluster", "db", "pool1", "wal", "ssdpool/team-a"))
+	assert.Nil(t, RemoveGroup(context, "foocluster", "db", "pool1"))
+	assert.Equal(t, []string{
+		"group create pool1/db",
+		"group image add pool1/db ssdpool/team-a/wal",
+		"group snap create pool1/db@nightly",
+		"group snap rollback pool1/db@nightly --no-progress",
+		"group snap rm pool1/db@nightly",
+		"group image rm pool1/db ssdpool/team-a/wal",
+		"group rm pool1/db",
+	}, commands)
+}
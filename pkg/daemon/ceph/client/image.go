@@ -18,6 +18,8 @@ package client
 import (
 	"encoding/json"
 	"fmt"
+	"sort"
+	"strings"
 
 	"strconv"
 
@@ -28,14 +30,64 @@ import (
 
 const (
 	ImageMinSize = uint64(1048576) // 1 MB
+
+	// the prefix of the metadata keys of the labels on images and pools
+	labelMetadataPrefix = "label."
 )
 
+// the json result of rbd du, which is printed after the warnings about the images without fast-diff
+var imageUsagePattern = regexp.MustCompile(`(?s)\{.*\}`)
+
 type CephBlockImage struct {
 	Name   string `json:"image"`
 	Size   uint64 `json:"size"`
 	Format int    `json:"format"`
 }
 
+// CephImageInfo is the size and the data objects of an image
+type CephImageInfo struct {
+	Name    string `json:"name"`
+	Size    uint64 `json:"size"`
+	Objects uint64 `json:"objects"`
+	// The prefix of the names of the data objects, which ends with the id of the image
+	BlockNamePrefix string `json:"block_name_prefix"`
+	// The size of the data objects is 2^order bytes
+	Order uint `json:"order"`
+	// The pool of the data objects if they are not in the pool of the image
+	DataPool string   `json:"data_pool"`
+	Features []string `json:"features"`
+}
+
+// CephImageWatcher is a client that has an image open
+type CephImageWatcher struct {
+	Address string `json:"address"`
+	Client  int    `json:"client"`
+	Cookie  uint64 `json:"cookie"`
+}
+
+// CephImageLock is a lock held by a client on an image, such as the exclusive lock of the client writing to the image
+type CephImageLock struct {
+	ID      string `json:"id"`
+	Locker  string `json:"locker"`
+	Address string `json:"address"`
+}
+
+type imageStatus struct {
+	Watchers []CephImageWatcher `json:"watchers"`
+}
+
+// CephImageUsage is the space provisioned for an image and the space its data actually uses
+type CephImageUsage struct {
+	Name            string `json:"name"`
+	Snapshot        string `json:"snapshot"`
+	ProvisionedSize uint64 `json:"provisioned_size"`
+	UsedSize        uint64 `json:"used_size"`
+}
+
+type poolUsage struct {
+	Images []CephImageUsage `json:"images"`
+}
+
 func ListImages(context *clusterd.Context, clusterName, poolName string) ([]CephBlockImage, error) {
 	args := []string{"ls", "-l", poolName}
 	buf, err := ExecuteRBDCommand(context, clusterName, args)
@@ -63,7 +115,8 @@ func ListImages(context *clusterd.Context, clusterName, poolName string) ([]Ceph
 
 // CreateImage creates a block storage image.
 // If dataPoolName is not empty, the image will use poolName as the metadata pool and the dataPoolname for data.
-func CreateImage(context *clusterd.Context, clusterName, name, poolName, dataPoolName string, size uint64) (*CephBlockImage, error) {
+// If imageFeatures is not empty, the comma separated features are enabled instead of the default features.
+func CreateImage(context *clusterd.Context, clusterName, name, poolName, dataPoolName, imageFeatures string, size uint64) (*CephBlockImage, error) {
 	if size > 0 && size < ImageMinSize {
 		// rbd tool uses MB as the smallest unit for size input.  0 is OK but anything else smaller
 		// than 1 MB should just be rounded up to 1 MB.
@@ -82,6 +135,9 @@ func CreateImage(context *clusterd.Context, clusterName, name, poolName, dataPoo
 	if dataPoolName != "" {
 		args = append(args, fmt.Sprintf("--data-pool=%s", dataPoolName))
 	}
+	if imageFeatures != "" {
+		args = append(args, fmt.Sprintf("--image-feature=%s", imageFeatures))
+	}
 
 	buf, err := ExecuteRBDCommandNoFormat(context, clusterName, args)
 	if err != nil {
@@ -115,6 +171,287 @@ func DeleteImage(context *clusterd.Context, clusterName, name, poolName string)
 	return nil
 }
 
+// GetImageInfo returns the size and the number of data objects of the image
+func GetImageInfo(context *clusterd.Context, clusterName, name, poolName string) (*CephImageInfo, error) {
+	args := []string{"info", getImageSpec(name, poolName)}
+	buf, err := ExecuteRBDCommand(context, clusterName, args)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the info of image %s in pool %s: %+v. output: %s", name, poolName, err, string(buf))
+	}
+
+	var info CephImageInfo
+	if err := json.Unmarshal(buf, &info); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal the info of image %s in pool %s. %+v. raw buffer response: %s", name, poolName, err, string(buf))
+	}
+	return &info, nil
+}
+
+// ID returns the id of the image, which identifies the image in the trash
+func (i *CephImageInfo) ID() string {
+	parts := strings.SplitN(i.BlockNamePrefix, ".", 2)
+	if len(parts) != 2 {
+		return ""
+	}
+	return parts[1]
+}
+
+// ObjectSize returns the size in bytes of the data objects of the image
+func (i *CephImageInfo) ObjectSize() uint64 {
+	return 1 << i.Order
+}
+
+// DataObject returns the name of the data object of the image with the given number
+func (i *CephImageInfo) DataObject(number uint64) string {
+	return fmt.Sprintf("%s.%016x", i.BlockNamePrefix, number)
+}
+
+// HasFeature returns whether the feature, such as object-map, is enabled on the image
+func (i *CephImageInfo) HasFeature(feature string) bool {
+	for _, f := range i.Features {
+		if f == feature {
+			return true
+		}
+	}
+	return false
+}
+
+// AllocateImage writes all the objects of the image in sequence with rbd bench, one object per write and with the
+// default number of concurrent writes. The writes go through librbd so the object map of the image is kept up to
+// date. The writes are limited to the given number of objects per second if it is not zero.
+func AllocateImage(context *clusterd.Context, clusterName, name, poolName string, info *CephImageInfo, rate int) error {
+	args := []string{"bench", getImageSpec(name, poolName),
+		"--io-type", "write",
+		"--io-pattern", "seq",
+		"--io-size", strconv.FormatUint(info.ObjectSize(), 10),
+		"--io-total", strconv.FormatUint(info.Size, 10)}
+	if rate > 0 {
+		args = append(args, fmt.Sprintf("--rbd_qos_iops_limit=%d", rate))
+	}
+	buf, err := ExecuteRBDCommandNoFormat(context, clusterName, args)
+	if err != nil {
+		return fmt.Errorf("failed to allocate image %s in pool %s: %+v. output: %s", name, poolName, err, string(buf))
+	}
+	return nil
+}
+
+// ShrinkImage shrinks the image to the size, which is a multiple of its object size, removing the objects past the
+// size with the given number of concurrent operations, or with the rbd default if zero
+func ShrinkImage(context *clusterd.Context, clusterName, name, poolName string, size uint64, concurrentOps int) error {
+	args := []string{"resize", getImageSpec(name, poolName), "--size", fmt.Sprintf("%dK", size/1024), "--allow-shrink"}
+	if concurrentOps > 0 {
+		args = append(args, fmt.Sprintf("--rbd-concurrent-management-ops=%d", concurrentOps))
+	}
+	buf, err := ExecuteRBDCommandNoFormat(context, clusterName, args)
+	if err != nil {
+		return fmt.Errorf("failed to shrink image %s in pool %s to %d bytes: %+v. output: %s", name, poolName, size, err, string(buf))
+	}
+	return nil
+}
+
+// CopyImage copies the data of an image to a new image with the same name in the destination pool.
+// If destDataPoolName is not empty, the copy will store its data in destDataPoolName.
+func CopyImage(context *clusterd.Context, clusterName, name, poolName, destPoolName, destDataPoolName string) error {
+	args := []string{"cp", getImageSpec(name, poolName), getImageSpec(name, destPoolName)}
+	if destDataPoolName != "" {
+		args = append(args, fmt.Sprintf("--data-pool=%s", destDataPoolName))
+	}
+
+	buf, err := ExecuteRBDCommandNoFormat(context, clusterName, args)
+	if err != nil {
+		return fmt.Errorf("failed to copy image %s from pool %s to pool %s: %+v. output: %s",
+			name, poolName, destPoolName, err, string(buf))
+	}
+
+	return nil
+}
+
+// ListImageWatchers returns the clients that have the image open, such as nodes where the image is mapped
+func ListImageWatchers(context *clusterd.Context, clusterName, name, poolName string) ([]CephImageWatcher, error) {
+	args := []string{"status", getImageSpec(name, poolName)}
+	buf, err := ExecuteRBDCommand(context, clusterName, args)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get status of image %s in pool %s: %+v", name, poolName, err)
+	}
+
+	var status imageStatus
+	if err := json.Unmarshal(buf, &status); err != nil {
+		return nil, fmt.Errorf("unmarshal failed: %+v. raw buffer response: %s", err, string(buf))
+	}
+
+	return status.Watchers, nil
+}
+
+// ListImageLocks returns the locks held on the image
+func ListImageLocks(context *clusterd.Context, clusterName, name, poolName string) ([]CephImageLock, error) {
+	args := []string{"lock", "ls", getImageSpec(name, poolName)}
+	buf, err := ExecuteRBDCommand(context, clusterName, args)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list locks of image %s in pool %s: %+v", name, poolName, err)
+	}
+	if len(strings.TrimSpace(string(buf))) == 0 {
+		return []CephImageLock{}, nil
+	}
+
+	locks := []CephImageLock{}
+	if err := json.Unmarshal(buf, &locks); err == nil {
+		return locks, nil
+	}
+
+	// releases before nautilus return the locks as a map by lock id
+	var lockMap map[string]CephImageLock
+	if err := json.Unmarshal(buf, &lockMap); err != nil {
+		return nil, fmt.Errorf("unmarshal failed: %+v. raw buffer response: %s", err, string(buf))
+	}
+	for id, lock := range lockMap {
+		lock.ID = id
+		locks = append(locks, lock)
+	}
+	sort.Slice(locks, func(i, j int) bool { return locks[i].ID < locks[j].ID })
+	return locks, nil
+}
+
+// BreakImageLock removes a lock from the image. If the client holding the lock may still be running, it should be
+// blacklisted first so that it cannot write to the image after it lost the lock.
+func BreakImageLock(context *clusterd.Context, clusterName, name, poolName string, lock CephImageLock) error {
+	args := []string{"lock", "rm", getImageSpec(name, poolName), lock.ID, lock.Locker}
+	buf, err := ExecuteRBDCommandNoFormat(context, clusterName, args)
+	if err != nil {
+		return fmt.Errorf("failed to break lock %s of %s on image %s in pool %s: %+v. output: %s",
+			lock.ID, lock.Locker, name, poolName, err, string(buf))
+	}
+	return nil
+}
+
+// ListImageUsage returns the provisioned and used space of the images in the pool. The used space is computed
+// quickly for the images with the fast-diff feature, the objects of the other images are scanned.
+func ListImageUsage(context *clusterd.Context, clusterName, poolName string) ([]CephImageUsage, error) {
+	args := []string{"du", "--pool", poolName}
+	buf, err := ExecuteRBDCommand(context, clusterName, args)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get usage of images in pool %s: %+v", poolName, err)
+	}
+
+	res := imageUsagePattern.Find(buf)
+	if res == nil {
+		return []CephImageUsage{}, nil
+	}
+	var usage poolUsage
+	if err := json.Unmarshal(res, &usage); err != nil {
+		return nil, fmt.Errorf("unmarshal failed: %+v. raw buffer response: %s", err, string(buf))
+	}
+
+	// the snapshots are listed separately from their image
+	images := []CephImageUsage{}
+	for _, image := range usage.Images {
+		if image.Snapshot == "" {
+			images = append(images, image)
+		}
+	}
+	return images, nil
+}
+
+// ImageQoS are the limits of the IO to an image. A zero value leaves the limit unset.
+type ImageQoS struct {
+	IOPSLimit uint64
+	BPSLimit  uint64
+	IOPSBurst uint64
+	BPSBurst  uint64
+}
+
+// SetImageQoS stores the IO limits in the configuration of the image, where they are applied by the librbd clients
+// that open the image
+func SetImageQoS(context *clusterd.Context, clusterName, name, poolName string, qos ImageQoS) error {
+	limits := []struct {
+		key   string
+		value uint64
+	}{
+		{"rbd_qos_iops_limit", qos.IOPSLimit},
+		{"rbd_qos_bps_limit", qos.BPSLimit},
+		{"rbd_qos_iops_burst", qos.IOPSBurst},
+		{"rbd_qos_bps_burst", qos.BPSBurst},
+	}
+
+	for _, limit := range limits {
+		if limit.value == 0 {
+			continue
+		}
+		args := []string{"config", "image", "set", getImageSpec(name, poolName), limit.key, strconv.FormatUint(limit.value, 10)}
+		buf, err := ExecuteRBDCommandNoFormat(context, clusterName, args)
+		if err != nil {
+			return fmt.Errorf("failed to set %s of image %s in pool %s: %+v. output: %s", limit.key, name, poolName, err, string(buf))
+		}
+	}
+
+	return nil
+}
+
+// GetImageLabels returns the labels stored in the metadata of the image
+func GetImageLabels(context *clusterd.Context, clusterName, name, poolName string) (map[string]string, error) {
+	args := []string{"image-meta", "list", getImageSpec(name, poolName)}
+	buf, err := ExecuteRBDCommand(context, clusterName, args)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list metadata of image %s in pool %s: %+v. output: %s", name, poolName, err, string(buf))
+	}
+
+	metadata := map[string]string{}
+	if len(strings.TrimSpace(string(buf))) > 0 {
+		if err := json.Unmarshal(buf, &metadata); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal metadata of image %s. %+v. raw buffer response: %s", name, err, string(buf))
+		}
+	}
+	return labelsFromMetadata(metadata), nil
+}
+
+// SetImageLabels stores the labels in the metadata of the image and removes the labels that are not given anymore
+func SetImageLabels(context *clusterd.Context, clusterName, name, poolName string, labels map[string]string) error {
+	current, err := GetImageLabels(context, clusterName, name, poolName)
+	if err != nil {
+		return err
+	}
+
+	imageSpec := getImageSpec(name, poolName)
+	for _, key := range sortedKeys(current) {
+		if _, ok := labels[key]; ok {
+			continue
+		}
+		args := []string{"image-meta", "remove", imageSpec, labelMetadataPrefix + key}
+		if buf, err := ExecuteRBDCommandNoFormat(context, clusterName, args); err != nil {
+			return fmt.Errorf("failed to remove label %s of image %s in pool %s: %+v. output: %s", key, name, poolName, err, string(buf))
+		}
+	}
+	for _, key := range sortedKeys(labels) {
+		if value, ok := current[key]; ok && value == labels[key] {
+			continue
+		}
+		args := []string{"image-meta", "set", imageSpec, labelMetadataPrefix + key, labels[key]}
+		if buf, err := ExecuteRBDCommandNoFormat(context, clusterName, args); err != nil {
+			return fmt.Errorf("failed to set label %s of image %s in pool %s: %+v. output: %s", key, name, poolName, err, string(buf))
+		}
+	}
+	return nil
+}
+
+// labelsFromMetadata returns the labels among the metadata of an image or pool, without the other settings
+// such as the config overrides of an image
+func labelsFromMetadata(metadata map[string]string) map[string]string {
+	labels := map[string]string{}
+	for key, value := range metadata {
+		if strings.HasPrefix(key, labelMetadataPrefix) {
+			labels[strings.TrimPrefix(key, labelMetadataPrefix)] = value
+		}
+	}
+	return labels
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
 // MapImage maps an RBD image using admin cephfx and returns the device path
 func MapImage(context *clusterd.Context, imageName, poolName, clusterName, keyring, monitors string) error {
 	imageSpec := getImageSpec(imageName, poolName)
@@ -43,7 +43,7 @@ func TestCreateImage(t *testing.T) {
 		}
 		return "", fmt.Errorf("unexpected ceph command '%v'", args)
 	}
-	image, err := CreateImage(context, "foocluster", "image1", "pool1", "", uint64(sizeMB)) // 1MB
+	image, err := CreateImage(context, "foocluster", "image1", "pool1", "", "", uint64(sizeMB)) // 1MB
 	assert.NotNil(t, err)
 	assert.True(t, strings.Contains(err.Error(), "mocked detailed ceph error output stream"))
 
@@ -51,11 +51,15 @@ func TestCreateImage(t *testing.T) {
 	// (except for 0, that's OK)
 	createCalled := false
 	expectedSizeArg := ""
+	expectedFeatureArg := ""
 	executor.MockExecuteCommandWithOutput = func(debug bool, actionName string, command string, args ...string) (string, error) {
 		switch {
 		case command == "rbd" && args[0] == "create":
 			createCalled = true
 			assert.Equal(t, expectedSizeArg, args[3])
+			if expectedFeatureArg != "" {
+				assert.Equal(t, expectedFeatureArg, args[4])
+			}
 			return "", nil
 		case command == "rbd" && args[0] == "ls" && args[1] == "-l":
 			return `[{"image":"image1","size":1048576,"format":2}]`, nil
@@ -65,7 +69,7 @@ func TestCreateImage(t *testing.T) {
 
 	// 0 byte --> 0 MB
 	expectedSizeArg = "0"
-	image, err = CreateImage(context, "foocluster", "image1", "pool1", "", uint64(0))
+	image, err = CreateImage(context, "foocluster", "image1", "pool1", "", "", uint64(0))
 	assert.Nil(t, err)
 	assert.NotNil(t, image)
 	assert.True(t, createCalled)
@@ -73,7 +77,7 @@ func TestCreateImage(t *testing.T) {
 
 	// 1 byte --> 1 MB
 	expectedSizeArg = "1"
-	image, err = CreateImage(context, "foocluster", "image1", "pool1", "", uint64(1))
+	image, err = CreateImage(context, "foocluster", "image1", "pool1", "", "", uint64(1))
 	assert.Nil(t, err)
 	assert.NotNil(t, image)
 	assert.True(t, createCalled)
@@ -81,7 +85,7 @@ func TestCreateImage(t *testing.T) {
 
 	// (1 MB - 1 byte) --> 1 MB
 	expectedSizeArg = "1"
-	image, err = CreateImage(context, "foocluster", "image1", "pool1", "", uint64(sizeMB-1))
+	image, err = CreateImage(context, "foocluster", "image1", "pool1", "", "", uint64(sizeMB-1))
 	assert.Nil(t, err)
 	assert.NotNil(t, image)
 	assert.True(t, createCalled)
@@ -89,7 +93,7 @@ func TestCreateImage(t *testing.T) {
 
 	// 1 MB
 	expectedSizeArg = "1"
-	image, err = CreateImage(context, "foocluster", "image1", "pool1", "", uint64(sizeMB))
+	image, err = CreateImage(context, "foocluster", "image1", "pool1", "", "", uint64(sizeMB))
 	assert.Nil(t, err)
 	assert.NotNil(t, image)
 	assert.True(t, createCalled)
@@ -97,7 +101,7 @@ func TestCreateImage(t *testing.T) {
 
 	// (1 MB + 1 byte) --> 2 MB
 	expectedSizeArg = "2"
-	image, err = CreateImage(context, "foocluster", "image1", "pool1", "", uint64(sizeMB+1))
+	image, err = CreateImage(context, "foocluster", "image1", "pool1", "", "", uint64(sizeMB+1))
 	assert.Nil(t, err)
 	assert.NotNil(t, image)
 	assert.True(t, createCalled)
@@ -105,7 +109,7 @@ func TestCreateImage(t *testing.T) {
 
 	// (2 MB - 1 byte) --> 2 MB
 	expectedSizeArg = "2"
-	image, err = CreateImage(context, "foocluster", "image1", "pool1", "", uint64(sizeMB*2-1))
+	image, err = CreateImage(context, "foocluster", "image1", "pool1", "", "", uint64(sizeMB*2-1))
 	assert.Nil(t, err)
 	assert.NotNil(t, image)
 	assert.True(t, createCalled)
@@ -113,7 +117,7 @@ func TestCreateImage(t *testing.T) {
 
 	// 2 MB
 	expectedSizeArg = "2"
-	image, err = CreateImage(context, "foocluster", "image1", "pool1", "", uint64(sizeMB*2))
+	image, err = CreateImage(context, "foocluster", "image1", "pool1", "", "", uint64(sizeMB*2))
 	assert.Nil(t, err)
 	assert.NotNil(t, image)
 	assert.True(t, createCalled)
@@ -121,7 +125,7 @@ func TestCreateImage(t *testing.T) {
 
 	// (2 MB + 1 byte) --> 3MB
 	expectedSizeArg = "3"
-	image, err = CreateImage(context, "foocluster", "image1", "pool1", "", uint64(sizeMB*2+1))
+	image, err = CreateImage(context, "foocluster", "image1", "pool1", "", "", uint64(sizeMB*2+1))
 	assert.Nil(t, err)
 	assert.NotNil(t, image)
 	assert.True(t, createCalled)
@@ -129,12 +133,19 @@ func TestCreateImage(t *testing.T) {
 
 	// Pool with data pool
 	expectedSizeArg = "1"
-	image, err = CreateImage(context, "foocluster", "image1", "pool1", "datapool1", uint64(sizeMB))
+	image, err = CreateImage(context, "foocluster", "image1", "pool1", "datapool1", "", uint64(sizeMB))
 	assert.Nil(t, err)
 	assert.NotNil(t, image)
 	assert.True(t, createCalled)
 	createCalled = false
 
+	// Image with features
+	expectedFeatureArg = "--image-feature=layering,exclusive-lock,object-map,fast-diff"
+	image, err = CreateImage(context, "foocluster", "image1", "pool1", "", "layering,exclusive-lock,object-map,fast-diff", uint64(sizeMB))
+	assert.Nil(t, err)
+	assert.NotNil(t, image)
+	assert.True(t, createCalled)
+
 }
 
 func TestListImageLogLevelInfo(t *testing.T) {
@@ -237,3 +248,209 @@ func TestListImageLogLevelDebug(t *testing.T) {
 	assert.True(t, listCalled)
 	listCalled = false
 }
+
+func TestCopyImage(t *testing.T) {
+	executor := &exectest.MockExecutor{}
+	context := &clusterd.Context{Executor: executor}
+
+	executor.MockExecuteCommandWithOutput = func(debug bool, actionName string, command string, args ...string) (string, error) {
+		if command == "rbd" && args[0] == "cp" {
+			assert.Equal(t, "pool1/image1", args[1])
+			assert.Equal(t, "pool2/image1", args[2])
+			assert.Equal(t, "--data-pool=ecpool", args[3])
+			return "", nil
+		}
+		return "", fmt.Errorf("unexpected ceph command '%v'", args)
+	}
+	err := CopyImage(context, "foocluster", "image1", "pool1", "pool2", "ecpool")
+	assert.Nil(t, err)
+}
+
+func TestListImageWatchers(t *testing.T) {
+	executor := &exectest.MockExecutor{}
+	context := &clusterd.Context{Executor: executor}
+
+	executor.MockExecuteCommandWithOutput = func(debug bool, actionName string, command string, args ...string) (string, error) {
+		if command == "rbd" && args[0] == "status" {
+			assert.Equal(t, "pool1/image1", args[1])
+			return `{"watchers":[{"address":"10.0.0.1:0/3928","client":4157,"cookie":18446462598732840961}]}`, nil
+		}
+		return "", fmt.Errorf("unexpected ceph command '%v'", args)
+	}
+	watchers, err := ListImageWatchers(context, "foocluster", "image1", "pool1")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(watchers))
+	assert.Equal(t, "10.0.0.1:0/3928", watchers[0].Address)
+	assert.Equal(t, 4157, watchers[0].Client)
+}
+
+func TestGetImageInfo(t *testing.T) {
+	executor := &exectest.MockExecutor{}
+	context := &clusterd.Context{Executor: executor}
+
+	executor.MockExecuteCommandWithOutput = func(debug bool, actionName string, command string, args ...string) (string, error) {
+		if command == "rbd" && args[0] == "info" {
+			assert.Equal(t, "pool1/image1", args[1])
+			return `{"name":"image1","size":10737418240,"objects":2560,"order":22,"object_size":4194304,"block_name_prefix":"rbd_data.10226b8b4567","format":2,"features":["layering","exclusive-lock","object-map"]}`, nil
+		}
+		return "", fmt.Errorf("unexpected ceph command '%v'", args)
+	}
+	info, err := GetImageInfo(context, "foocluster", "image1", "pool1")
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(2560), info.Objects)
+	assert.Equal(t, "10226b8b4567", info.ID())
+	assert.Equal(t, uint64(4194304), info.ObjectSize())
+	assert.Equal(t, "rbd_data.10226b8b4567.00000000000009ff", info.DataObject(2559))
+	assert.True(t, info.HasFeature("object-map"))
+	assert.False(t, info.HasFeature("fast-diff"))
+
+	info.BlockNamePrefix = ""
+	assert.Equal(t, "", info.ID())
+}
+
+func TestAllocateImage(t *testing.T) {
+	executor := &exectest.MockExecutor{}
+	context := &clusterd.Context{Executor: executor}
+	var benchArgs []string
+	executor.MockExecuteCommandWithOutput = func(debug bool, actionName string, command string, args ...string) (string, error) {
+		if command == "rbd" && args[0] == "bench" {
+			benchArgs = args
+			return "", nil
+		}
+		return "", fmt.Errorf("unexpected ceph command '%v'", args)
+	}
+
+	info := &CephImageInfo{Size: 10485760, Order: 22}
+	assert.Nil(t, AllocateImage(context, "foocluster", "image1", "pool1", info, 0))
+	assert.Equal(t, []string{"bench", "pool1/image1", "--io-type", "write", "--io-pattern", "seq", "--io-size", "4194304", "--io-total", "10485760"}, benchArgs[:10])
+	assert.NotContains(t, benchArgs, "--rbd_qos_iops_limit=20")
+
+	// the rate limits the writes of the command
+	assert.Nil(t, AllocateImage(context, "foocluster", "image1", "pool1", info, 20))
+	assert.Contains(t, benchArgs, "--rbd_qos_iops_limit=20")
+}
+
+func TestImageLocks(t *testing.T) {
+	response := ""
+	removed := []string{}
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithOutput: func(debug bool, actionName string, command string, args ...string) (string, error) {
+			switch {
+			case command == "rbd" && args[0] == "lock" && args[1] == "ls" && args[2] == "pool1/image1":
+				return response, nil
+			case command == "rbd" && args[0] == "lock" && args[1] == "rm" && args[2] == "pool1/image1":
+				removed = append(removed, args[3], args[4])
+				return "", nil
+			}
+			return "", fmt.Errorf("unexpected rbd command '%v'", args)
+		},
+	}
+	context := &clusterd.Context{Executor: executor}
+
+	locks, err := ListImageLocks(context, "foocluster", "image1", "pool1")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(locks))
+
+	response = `[{"id":"auto 139643345791728","locker":"client.4123","address":"10.0.0.1:0/3430395571"}]`
+	locks, err = ListImageLocks(context, "foocluster", "image1", "pool1")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(locks))
+	assert.Equal(t, "auto 139643345791728", locks[0].ID)
+	assert.Equal(t, "client.4123", locks[0].Locker)
+	assert.Equal(t, "10.0.0.1:0/3430395571", locks[0].Address)
+
+	// older releases return a map of locks
+	response = `{"auto 2":{"locker":"client.2","address":"10.0.0.2:0/2"},"auto 1":{"locker":"client.1","address":"10.0.0.1:0/1"}}`
+	locks, err = ListImageLocks(context, "foocluster", "image1", "pool1")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(locks))
+	assert.Equal(t, "auto 1", locks[0].ID)
+	assert.Equal(t, "client.1", locks[0].Locker)
+
+	err = BreakImageLock(context, "foocluster", "image1", "pool1", locks[1])
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"auto 2", "client.2"}, removed)
+
+	_, err = ListImageLocks(context, "foocluster", "image2", "pool1")
+	assert.NotNil(t, err)
+}
+
+func TestListImageUsage(t *testing.T) {
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithOutput: func(debug bool, actionName string, command string, args ...string) (string, error) {
+			if command == "rbd" && args[0] == "du" && args[2] == "pool1" {
+				return `warning: fast-diff map is not enabled for image2. operation may be slow.
+{"images":[{"name":"image1","provisioned_size":1073741824,"used_size":4194304},` +
+					`{"name":"image1","snapshot":"snap1","provisioned_size":1073741824,"used_size":0},` +
+					`{"name":"image2","provisioned_size":2147483648,"used_size":0}],` +
+					`"total_provisioned_size":3221225472,"total_used_size":4194304}`, nil
+			}
+			return "", fmt.Errorf("unexpected rbd command '%v'", args)
+		},
+	}
+	context := &clusterd.Context{Executor: executor}
+
+	usage, err := ListImageUsage(context, "foocluster", "pool1")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(usage))
+	assert.Equal(t, "image1", usage[0].Name)
+	assert.Equal(t, uint64(1073741824), usage[0].ProvisionedSize)
+	assert.Equal(t, uint64(4194304), usage[0].UsedSize)
+	assert.Equal(t, "image2", usage[1].Name)
+
+	_, err = ListImageUsage(context, "foocluster", "pool2")
+	assert.NotNil(t, err)
+}
+
+func TestSetImageQoS(t *testing.T) {
+	executor := &exectest.MockExecutor{}
+	context := &clusterd.Context{Executor: executor}
+
+	settings := map[string]string{}
+	executor.MockExecuteCommandWithOutput = func(debug bool, actionName string, command string, args ...string) (string, error) {
+		if command == "rbd" && args[0] == "config" && args[1] == "image" && args[2] == "set" {
+			assert.Equal(t, "pool1/image1", args[3])
+			settings[args[4]] = args[5]
+			return "", nil
+		}
+		return "", fmt.Errorf("unexpected ceph command '%v'", args)
+	}
+
+	// only the limits that are given are set
+	err := SetImageQoS(context, "foocluster", "image1", "pool1", ImageQoS{IOPSLimit: 500, BPSLimit: 10485760})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"rbd_qos_iops_limit": "500", "rbd_qos_bps_limit": "10485760"}, settings)
+}
+
+func TestImageLabels(t *testing.T) {
+	commands := []string{}
+	metadata := `{"conf_rbd_cache":"false","label.owner":"team-a"}`
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithOutput: func(debug bool, actionName string, command string, args ...string) (string, error) {
+			if command == "rbd" && args[0] == "image-meta" {
+				assert.Equal(t, "pool1/image1", args[2])
+				if args[1] == "list" {
+					return metadata, nil
+				}
+				commands = append(commands, fmt.Sprintf("%s %s", args[1], args[3]))
+				return "", nil
+			}
+			return "", fmt.Errorf("unexpected rbd command '%v'", args)
+		},
+	}
+	context := &clusterd.Context{Executor: executor}
+
+	labels, err := GetImageLabels(context, "foocluster", "image1", "pool1")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"owner": "team-a"}, labels)
+
+	err = SetImageLabels(context, "foocluster", "image1", "pool1", map[string]string{"ticket": "123"})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"remove label.owner", "set label.ticket"}, commands)
+
+	// the image has no metadata
+	metadata = ""
+	labels, err = GetImageLabels(context, "foocluster", "image1", "pool1")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(labels))
+}
@@ -0,0 +1,155 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+const (
+	// an osd is an outlier when its p95 latency is this many times the median p95 latency of its device class
+	outlierFactor = 3
+	// latencies below this are not outliers, since the latencies of idle osds vary a lot relative to each other
+	minOutlierLatencyMs = 10
+	// the osds are only compared with a few peers in the same device class
+	minClassPeers = 3
+)
+
+// OSDLatency is the commit and apply latency of an osd in the recent samples, compared to the other osds of its
+// device class
+type OSDLatency struct {
+	ID          int     `json:"id"`
+	DeviceClass string  `json:"deviceClass"`
+	CommitP50   float64 `json:"commitP50Ms"`
+	CommitP95   float64 `json:"commitP95Ms"`
+	ApplyP50    float64 `json:"applyP50Ms"`
+	ApplyP95    float64 `json:"applyP95Ms"`
+	// The ratio of the p95 latency of the osd to the median p95 latency of its device class
+	Ratio   float64 `json:"ratio"`
+	Outlier bool    `json:"outlier"`
+}
+
+type latencySample struct {
+	time   time.Time
+	commit map[int]float64
+	apply  map[int]float64
+}
+
+// LatencyTracker keeps the samples of the latencies of the osds to find the slow osds
+type LatencyTracker struct {
+	window  time.Duration
+	samples []latencySample
+}
+
+// NewLatencyTracker creates a tracker that compares the latencies of the osds over the window
+func NewLatencyTracker(window time.Duration) *LatencyTracker {
+	return &LatencyTracker{window: window}
+}
+
+// Add records the latencies of the perf stats of the osds and drops the samples older than the window
+func (t *LatencyTracker) Add(now time.Time, stats *OSDPerfStats) {
+	sample := latencySample{time: now, commit: map[int]float64{}, apply: map[int]float64{}}
+	for _, info := range stats.PerfInfo {
+		id, err := info.ID.Int64()
+		if err != nil {
+			continue
+		}
+		commit, _ := info.Stats.CommitLatency.Float64()
+		apply, _ := info.Stats.ApplyLatency.Float64()
+		sample.commit[int(id)] = commit
+		sample.apply[int(id)] = apply
+	}
+	t.samples = append(t.samples, sample)
+	for len(t.samples) > 0 && now.Sub(t.samples[0].time) > t.window {
+		t.samples = t.samples[1:]
+	}
+}
+
+// Report returns the latencies of the osds with the outliers first, ranked from the slowest relative to their device
+// class. The classes are the device classes of the osds by id.
+func (t *LatencyTracker) Report(classes map[int]string) []OSDLatency {
+	commits := map[int][]float64{}
+	applies := map[int][]float64{}
+	for _, s := range t.samples {
+		for id, l := range s.commit {
+			commits[id] = append(commits[id], l)
+		}
+		for id, l := range s.apply {
+			applies[id] = append(applies[id], l)
+		}
+	}
+
+	report := []OSDLatency{}
+	classCommits := map[string][]float64{}
+	classApplies := map[string][]float64{}
+	for id := range commits {
+		l := OSDLatency{
+			ID:          id,
+			DeviceClass: classes[id],
+			CommitP50:   percentile(commits[id], 0.5),
+			CommitP95:   percentile(commits[id], 0.95),
+			ApplyP50:    percentile(applies[id], 0.5),
+			ApplyP95:    percentile(applies[id], 0.95),
+		}
+		report = append(report, l)
+		classCommits[l.DeviceClass] = append(classCommits[l.DeviceClass], l.CommitP95)
+		classApplies[l.DeviceClass] = append(classApplies[l.DeviceClass], l.ApplyP95)
+	}
+
+	for i := range report {
+		l := &report[i]
+		peers := classCommits[l.DeviceClass]
+		l.Ratio = math.Max(ratio(l.CommitP95, percentile(peers, 0.5)), ratio(l.ApplyP95, percentile(classApplies[l.DeviceClass], 0.5)))
+		l.Outlier = len(peers) >= minClassPeers && l.Ratio >= outlierFactor && math.Max(l.CommitP95, l.ApplyP95) >= minOutlierLatencyMs
+	}
+	sort.Slice(report, func(i, j int) bool {
+		if report[i].Outlier != report[j].Outlier {
+			return report[i].Outlier
+		}
+		if report[i].Ratio != report[j].Ratio {
+			return report[i].Ratio > report[j].Ratio
+		}
+		return report[i].ID < report[j].ID
+	})
+	return report
+}
+
+// percentile returns the nearest-rank percentile of the values, or zero if there are no values
+func percentile(values []float64, p float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := append([]float64{}, values...)
+	sort.Float64s(sorted)
+	rank := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	return sorted[rank]
+}
+
+func ratio(value, median float64) float64 {
+	if median <= 0 {
+		if value > 0 {
+			return value
+		}
+		return 0
+	}
+	return value / median
+}
@@ -0,0 +1,86 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLatencyTracker(t *testing.T) {
+	tracker := NewLatencyTracker(10 * time.Minute)
+	start := time.Date(2018, time.August, 4, 3, 0, 0, 0, time.UTC)
+	perf := func(latencies ...int) *OSDPerfStats {
+		infos := []string{}
+		for i, l := range latencies {
+			infos = append(infos, fmt.Sprintf(`{"id":%d,"perf_stats":{"commit_latency_ms":%d,"apply_latency_ms":%d}}`, i, l, l))
+		}
+		var stats OSDPerfStats
+		assert.Nil(t, json.Unmarshal([]byte(`{"osd_perf_infos":[`+strings.Join(infos, ",")+`]}`), &stats))
+		return &stats
+	}
+	classes := map[int]string{0: "hdd", 1: "hdd", 2: "hdd", 3: "hdd", 4: "ssd", 5: "ssd"}
+
+	// osd.2 is slow compared to the other hdds, while the ssds have too few peers to be compared
+	for i := 0; i < 10; i++ {
+		tracker.Add(start.Add(time.Duration(i)*time.Minute), perf(5, 6, 40, 5, 1, 30))
+	}
+	report := tracker.Report(classes)
+	assert.Equal(t, 6, len(report))
+	assert.Equal(t, 2, report[0].ID)
+	assert.Equal(t, "hdd", report[0].DeviceClass)
+	assert.Equal(t, float64(40), report[0].CommitP95)
+	assert.Equal(t, float64(40), report[0].ApplyP50)
+	assert.True(t, report[0].Outlier)
+	assert.Equal(t, 5, report[1].ID)
+	assert.False(t, report[1].Outlier)
+	for _, l := range report[2:] {
+		assert.False(t, l.Outlier)
+	}
+
+	// a single spike does not change the p50, and the old samples leave the window
+	tracker.Add(start.Add(10*time.Minute), perf(5, 6, 400, 5, 1, 30))
+	report = tracker.Report(classes)
+	assert.Equal(t, float64(400), report[0].CommitP95)
+	assert.Equal(t, float64(40), report[0].CommitP50)
+	for i := 11; i < 30; i++ {
+		tracker.Add(start.Add(time.Duration(i)*time.Minute), perf(5, 6, 7, 5, 1, 30))
+	}
+	report = tracker.Report(classes)
+	for _, l := range report {
+		assert.False(t, l.Outlier)
+	}
+
+	// idle osds are not outliers even if they differ a lot
+	tracker = NewLatencyTracker(10 * time.Minute)
+	tracker.Add(start, perf(0, 1, 9, 1))
+	report = tracker.Report(classes)
+	assert.Equal(t, 2, report[0].ID)
+	assert.Equal(t, float64(9), report[0].Ratio)
+	assert.False(t, report[0].Outlier)
+}
+
+func TestPercentile(t *testing.T) {
+	assert.Equal(t, float64(0), percentile(nil, 0.5))
+	assert.Equal(t, float64(3), percentile([]float64{5, 1, 3, 4, 2}, 0.5))
+	assert.Equal(t, float64(5), percentile([]float64{5, 1, 3, 4, 2}, 0.95))
+	assert.Equal(t, float64(1), percentile([]float64{5, 1, 3, 4, 2}, 0))
+}
@@ -0,0 +1,108 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/rook/rook/pkg/clusterd"
+)
+
+type CephRadosNamespace struct {
+	Name string `json:"name"`
+}
+
+// PoolNamespaceSpec returns the spec that the rbd tool expects to address a pool, optionally scoped
+// to a rados namespace within that pool (e.g. "pool" or "pool/namespace").
+func PoolNamespaceSpec(poolName, namespace string) string {
+	if namespace == "" {
+		return poolName
+	}
+	return fmt.Sprintf("%s/%s", poolName, namespace)
+}
+
+// ParsePoolNamespaceSpec splits a pool spec of the form "pool" or "pool/namespace" into its parts
+func ParsePoolNamespaceSpec(poolSpec string) (string, string) {
+	parts := strings.SplitN(poolSpec, "/", 2)
+	if len(parts) == 1 {
+		return parts[0], ""
+	}
+	return parts[0], parts[1]
+}
+
+// ListNamespaces lists the rados namespaces that have been created for rbd in the given pool
+func ListNamespaces(context *clusterd.Context, clusterName, poolName string) ([]CephRadosNamespace, error) {
+	args := []string{"namespace", "ls", poolName}
+	buf, err := ExecuteRBDCommand(context, clusterName, args)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list namespaces for pool %s: %+v", poolName, err)
+	}
+
+	var namespaces []CephRadosNamespace
+	if err = json.Unmarshal(buf, &namespaces); err != nil {
+		return nil, fmt.Errorf("unmarshal failed: %+v. raw buffer response: %s", err, string(buf))
+	}
+
+	return namespaces, nil
+}
+
+// CreateNamespace creates a rados namespace in the pool where rbd images can be isolated from other namespaces
+func CreateNamespace(context *clusterd.Context, clusterName, poolName, namespace string) error {
+	args := []string{"namespace", "create", PoolNamespaceSpec(poolName, namespace)}
+	buf, err := ExecuteRBDCommandNoFormat(context, clusterName, args)
+	if err != nil {
+		return fmt.Errorf("failed to create namespace %s in pool %s: %+v. output: %s", namespace, poolName, err, string(buf))
+	}
+
+	return nil
+}
+
+// DeleteNamespace removes a rados namespace from the pool. The namespace must not contain any images.
+func DeleteNamespace(context *clusterd.Context, clusterName, poolName, namespace string) error {
+	args := []string{"namespace", "remove", PoolNamespaceSpec(poolName, namespace)}
+	buf, err := ExecuteRBDCommandNoFormat(context, clusterName, args)
+	if err != nil {
+		return fmt.Errorf("failed to delete namespace %s in pool %s: %+v. output: %s", namespace, poolName, err, string(buf))
+	}
+
+	return nil
+}
+
+// NamespaceClientName returns the name of the ceph user that is granted access to a single namespace of the pool
+func NamespaceClientName(poolName, namespace string) string {
+	return fmt.Sprintf("client.%s.%s", poolName, namespace)
+}
+
+// NamespaceClientCaps returns the caps that restrict a client to the images in a single namespace of the pool
+func NamespaceClientCaps(poolName, namespace string) []string {
+	return []string{
+		"mon", "profile rbd",
+		"osd", fmt.Sprintf("profile rbd pool=%s namespace=%s", poolName, namespace),
+	}
+}
+
+// CreateNamespaceClientKey gets or creates the key for a client whose access is restricted to the namespace
+func CreateNamespaceClientKey(context *clusterd.Context, clusterName, poolName, namespace string) (string, error) {
+	name := NamespaceClientName(poolName, namespace)
+	key, err := AuthGetOrCreateKey(context, clusterName, name, NamespaceClientCaps(poolName, namespace))
+	if err != nil {
+		return "", fmt.Errorf("failed to create key for namespace %s in pool %s. %+v", namespace, poolName, err)
+	}
+
+	return key, nil
+}
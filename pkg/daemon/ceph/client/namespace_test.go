@@ -0,0 +1,92 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package client
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/rook/rook/pkg/clusterd"
+	exectest "github.com/rook/rook/pkg/util/exec/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPoolNamespaceSpec(t *testing.T) {
+	assert.Equal(t, "mypool", PoolNamespaceSpec("mypool", ""))
+	assert.Equal(t, "mypool/tenant1", PoolNamespaceSpec("mypool", "tenant1"))
+
+	pool, ns := ParsePoolNamespaceSpec("mypool")
+	assert.Equal(t, "mypool", pool)
+	assert.Equal(t, "", ns)
+
+	pool, ns = ParsePoolNamespaceSpec("mypool/tenant1")
+	assert.Equal(t, "mypool", pool)
+	assert.Equal(t, "tenant1", ns)
+}
+
+func TestCreateNamespace(t *testing.T) {
+	executor := &exectest.MockExecutor{}
+	context := &clusterd.Context{Executor: executor}
+	createCalled := false
+	executor.MockExecuteCommandWithOutput = func(debug bool, actionName string, command string, args ...string) (string, error) {
+		if command == "rbd" && args[0] == "namespace" && args[1] == "create" {
+			assert.Equal(t, "mypool/tenant1", args[2])
+			createCalled = true
+			return "", nil
+		}
+		return "", fmt.Errorf("unexpected rbd command '%v'", args)
+	}
+
+	err := CreateNamespace(context, "foocluster", "mypool", "tenant1")
+	assert.Nil(t, err)
+	assert.True(t, createCalled)
+}
+
+func TestListNamespaces(t *testing.T) {
+	executor := &exectest.MockExecutor{}
+	context := &clusterd.Context{Executor: executor}
+	executor.MockExecuteCommandWithOutput = func(debug bool, actionName string, command string, args ...string) (string, error) {
+		if command == "rbd" && args[0] == "namespace" && args[1] == "ls" {
+			assert.Equal(t, "mypool", args[2])
+			return `[{"name":"tenant1"},{"name":"tenant2"}]`, nil
+		}
+		return "", fmt.Errorf("unexpected rbd command '%v'", args)
+	}
+
+	namespaces, err := ListNamespaces(context, "foocluster", "mypool")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(namespaces))
+	assert.Equal(t, "tenant1", namespaces[0].Name)
+	assert.Equal(t, "tenant2", namespaces[1].Name)
+}
+
+func TestNamespaceClientKey(t *testing.T) {
+	executor := &exectest.MockExecutor{}
+	context := &clusterd.Context{Executor: executor}
+	executor.MockExecuteCommandWithOutputFile = func(debug bool, actionName, command, outputFile string, args ...string) (string, error) {
+		if args[0] == "auth" && args[1] == "get-or-create-key" {
+			assert.Equal(t, "client.mypool.tenant1", args[2])
+			assert.Equal(t, "osd", args[5])
+			assert.Equal(t, "profile rbd pool=mypool namespace=tenant1", args[6])
+			return `{"key":"mysecret"}`, nil
+		}
+		return "", fmt.Errorf("unexpected ceph command '%v'", args)
+	}
+
+	key, err := CreateNamespaceClientKey(context, "foocluster", "mypool", "tenant1")
+	assert.Nil(t, err)
+	assert.Equal(t, "mysecret", key)
+}
@@ -19,6 +19,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"strconv"
+	"strings"
 
 	"github.com/rook/rook/pkg/clusterd"
 )
@@ -58,11 +59,59 @@ type OSDPerfStats struct {
 }
 
 type OSDDump struct {
-	OSDs []struct {
+	// The version of the crush map, which increases each time the crush map is changed
+	CrushVersion int `json:"crush_version"`
+	OSDs         []struct {
 		OSD json.Number `json:"osd"`
 		Up  json.Number `json:"up"`
 		In  json.Number `json:"in"`
+		// The osdmap epoch since which the osd is up, which increases each time the osd is marked up again
+		UpFrom json.Number `json:"up_from"`
 	} `json:"osds"`
+	Pools []struct {
+		ID   int    `json:"pool"`
+		Name string `json:"pool_name"`
+		// The number of copies of a replicated pool, or the number of chunks of an erasure coded pool
+		Size int `json:"size"`
+		// The number of copies or chunks of a pg that must be available for the pg to accept writes
+		MinSize int `json:"min_size"`
+		PgNum   int `json:"pg_num"`
+		// The number of pgs the data is placed in, which is raised to the pg_num once the new pgs are created
+		PgpNum int `json:"pg_placement_num"`
+	} `json:"pools"`
+}
+
+// OSDMetadata is the host and devices an osd reports to the mons
+type OSDMetadata struct {
+	ID       int    `json:"id"`
+	Hostname string `json:"hostname"`
+	// The names of the devices of the osd, such as sdb or sdb,nvme0n1
+	Devices     string `json:"devices"`
+	ObjectStore string `json:"osd_objectstore"`
+	// The partitions of the data, db and wal of a bluestore osd, or of the data of a filestore osd, such as /dev/sdb2
+	BlockPartition     string `json:"bluestore_bdev_partition_path"`
+	DBPartition        string `json:"bluefs_db_partition_path"`
+	WALPartition       string `json:"bluefs_wal_partition_path"`
+	FilestorePartition string `json:"backend_filestore_partition_path"`
+}
+
+// UsesDevice returns whether the osd reported the device or one of its partitions for its data, db or wal
+func (m *OSDMetadata) UsesDevice(device string, partitions []string) bool {
+	names := map[string]bool{device: true}
+	for _, p := range partitions {
+		names[p] = true
+	}
+	for _, d := range strings.Split(m.Devices, ",") {
+		if names[strings.TrimSpace(d)] {
+			return true
+		}
+	}
+	for _, p := range []string{m.BlockPartition, m.DBPartition, m.WALPartition, m.FilestorePartition} {
+		if p != "" && names[strings.TrimPrefix(p, "/dev/")] {
+			return true
+		}
+	}
+	return false
 }
 
 // StatusByID returns status and inCluster states for given OSD id
@@ -136,6 +185,38 @@ func GetOSDDump(context *clusterd.Context, clusterName string) (*OSDDump, error)
 	return &osdDump, nil
 }
 
+// GetOSDMetadata returns the metadata of the osd
+func GetOSDMetadata(context *clusterd.Context, clusterName string, osdID int) (*OSDMetadata, error) {
+	args := []string{"osd", "metadata", strconv.Itoa(osdID)}
+	buf, err := ExecuteCephCommand(context, clusterName, args)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the metadata of osd.%d: %+v", osdID, err)
+	}
+
+	var metadata OSDMetadata
+	if err := json.Unmarshal(buf, &metadata); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal osd metadata response: %+v", err)
+	}
+
+	return &metadata, nil
+}
+
+// ListOSDMetadata returns the metadata of all the osds that reported it
+func ListOSDMetadata(context *clusterd.Context, clusterName string) ([]OSDMetadata, error) {
+	args := []string{"osd", "metadata"}
+	buf, err := ExecuteCephCommand(context, clusterName, args)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the metadata of the osds: %+v", err)
+	}
+
+	var metadata []OSDMetadata
+	if err := json.Unmarshal(buf, &metadata); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal osd metadata response: %+v", err)
+	}
+
+	return metadata, nil
+}
+
 func OSDOut(context *clusterd.Context, clusterName string, osdID int) (string, error) {
 	args := []string{"osd", "out", strconv.Itoa(osdID)}
 	buf, err := ExecuteCephCommand(context, clusterName, args)
@@ -148,6 +229,16 @@ func OSDRemove(context *clusterd.Context, clusterName string, osdID int) (string
 	return string(buf), err
 }
 
+// BlacklistClient prevents the client at the address from accessing the osds, such as a client whose lock on an image
+// is broken. The address is blacklisted until the osds expire the entry after one hour.
+func BlacklistClient(context *clusterd.Context, clusterName, address string) error {
+	args := []string{"osd", "blacklist", "add", address}
+	if _, err := ExecuteCephCommand(context, clusterName, args); err != nil {
+		return fmt.Errorf("failed to blacklist client %s. %+v", address, err)
+	}
+	return nil
+}
+
 func DisableScrubbing(context *clusterd.Context, clusterName string) (string, error) {
 	args := []string{"osd", "set", "noscrub"}
 	buf, err := ExecuteCephCommand(context, clusterName, args)
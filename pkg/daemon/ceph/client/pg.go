@@ -18,10 +18,16 @@ package client
 import (
 	"encoding/json"
 	"fmt"
+	"io"
+	"strconv"
+	"strings"
 
 	"github.com/rook/rook/pkg/clusterd"
 )
 
+// the key of the pgs in the pg dump of the ceph versions that return an object instead of an array of pgs
+const pgStatsKey = "pg_stats"
+
 type PGDumpBrief struct {
 	ID              string `json:"pgid"`
 	State           string `json:"state"`
@@ -31,17 +37,48 @@ type PGDumpBrief struct {
 	ActingPrimaryID int    `json:"acting_primary"`
 }
 
-func GetPGDumpBrief(context *clusterd.Context, clusterName string) ([]PGDumpBrief, error) {
-	args := []string{"pg", "dump", "pgs_brief"}
-	buf, err := ExecuteCephCommand(context, clusterName, args)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get pg dump: %+v", err)
+// PoolID returns the id of the pool of the pg, which is the prefix of the pg id
+func (pg PGDumpBrief) PoolID() (int, error) {
+	parts := strings.SplitN(pg.ID, ".", 2)
+	if len(parts) != 2 {
+		return 0, fmt.Errorf("invalid pg id %s", pg.ID)
 	}
+	return strconv.Atoi(parts[0])
+}
 
+func GetPGDumpBrief(context *clusterd.Context, clusterName string) ([]PGDumpBrief, error) {
 	var pgDump []PGDumpBrief
-	if err := json.Unmarshal(buf, &pgDump); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal pg dump response: %+v", err)
+	err := ForEachPGDumpBrief(context, clusterName, func(pg PGDumpBrief) error {
+		pgDump = append(pgDump, pg)
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	return pgDump, nil
 }
+
+// ForEachPGDumpBrief calls process with each pg of the brief pg dump as it is decoded, so that the dump of a large
+// cluster is not loaded in memory. The dump stops at the first error returned by process, which is returned as is.
+func ForEachPGDumpBrief(context *clusterd.Context, clusterName string, process func(PGDumpBrief) error) error {
+	args := []string{"pg", "dump", "pgs_brief"}
+	var processErr error
+	err := executeCephCommandWithOutputReader(context, clusterName, args, func(r io.Reader) error {
+		return decodeArray(r, pgStatsKey, func(dec *json.Decoder) error {
+			var pg PGDumpBrief
+			if err := dec.Decode(&pg); err != nil {
+				return err
+			}
+			processErr = process(pg)
+			return processErr
+		})
+	})
+	if processErr != nil {
+		return processErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get pg dump: %+v", err)
+	}
+	return nil
+}
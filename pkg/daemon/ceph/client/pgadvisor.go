@@ -0,0 +1,100 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"fmt"
+	"math"
+)
+
+const (
+	// TargetPGsPerOSD is the number of placement groups of all the pools that each osd should hold
+	TargetPGsPerOSD = 100
+	minPGsPerPool   = 8
+	// the pgs of a pool are only increased when the target is at least this many times the current pgs, so the pgs
+	// are not split again for every small change of the data
+	pgGrowthThreshold = 3
+)
+
+// PGRecommendation is a pool with too few placement groups for its share of the data in the cluster
+type PGRecommendation struct {
+	Pool        string `json:"pool"`
+	PgNum       int    `json:"pgNum"`
+	TargetPgNum int    `json:"targetPgNum"`
+	// The share of the data stored in the cluster that is in the pool, including the copies or chunks of the objects
+	DataShare float64 `json:"dataShare"`
+}
+
+// RecommendPGs returns the pools whose pg_num should be increased. The placement groups of the osds are divided across
+// the pools by their share of the data, like the pg autoscaler of newer ceph versions. The pg_num is never recommended
+// to be decreased, since it cannot be decreased before nautilus.
+func RecommendPGs(dump *OSDDump, stats *CephStoragePoolStats) []PGRecommendation {
+	osds := 0
+	for _, o := range dump.OSDs {
+		if in, _ := o.In.Int64(); in == 1 {
+			osds++
+		}
+	}
+	used := map[string]float64{}
+	for _, p := range stats.Pools {
+		used[p.Name] = p.Stats.BytesUsed
+	}
+	var total float64
+	for _, p := range dump.Pools {
+		total += used[p.Name] * float64(p.Size)
+	}
+	recommendations := []PGRecommendation{}
+	if osds == 0 || total == 0 {
+		return recommendations
+	}
+
+	for _, p := range dump.Pools {
+		if p.Size <= 0 {
+			continue
+		}
+		share := used[p.Name] * float64(p.Size) / total
+		target := nearestPowerOfTwo(share * float64(osds*TargetPGsPerOSD) / float64(p.Size))
+		if target < minPGsPerPool {
+			target = minPGsPerPool
+		}
+		if target < p.PgNum*pgGrowthThreshold {
+			continue
+		}
+		recommendations = append(recommendations, PGRecommendation{Pool: p.Name, PgNum: p.PgNum, TargetPgNum: target, DataShare: share})
+	}
+	return recommendations
+}
+
+// NextPgNum is the pg_num the pool is grown to in the next step towards the target. The pgs are at most doubled at
+// each step to limit the data that is moved at once.
+func (r PGRecommendation) NextPgNum() int {
+	if r.PgNum > 0 && r.TargetPgNum > 2*r.PgNum {
+		return 2 * r.PgNum
+	}
+	return r.TargetPgNum
+}
+
+func (r PGRecommendation) String() string {
+	return fmt.Sprintf("increase pg_num of pool %s from %d to %d for %.0f%% of the data", r.Pool, r.PgNum, r.TargetPgNum, r.DataShare*100)
+}
+
+func nearestPowerOfTwo(n float64) int {
+	if n < 1 {
+		return 1
+	}
+	return int(math.Pow(2, math.Floor(math.Log2(n)+0.5)))
+}
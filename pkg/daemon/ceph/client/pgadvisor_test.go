@@ -0,0 +1,53 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecommendPGs(t *testing.T) {
+	var dump OSDDump
+	err := json.Unmarshal([]byte(`{"osds":[{"osd":0,"up":1,"in":1},{"osd":1,"up":1,"in":1},{"osd":2,"up":1,"in":1},{"osd":3,"up":0,"in":0}],
+		"pools":[{"pool_name":"rbd","size":3,"pg_num":8},{"pool_name":"small","size":3,"pg_num":8},
+		{"pool_name":"empty","size":3,"pg_num":8},{"pool_name":"split","size":3,"pg_num":64}]}`), &dump)
+	assert.Nil(t, err)
+	var stats CephStoragePoolStats
+	err = json.Unmarshal([]byte(`{"pools":[{"name":"rbd","stats":{"bytes_used":1000}},{"name":"small","stats":{"bytes_used":10}},
+		{"name":"split","stats":{"bytes_used":1000}}]}`), &stats)
+	assert.Nil(t, err)
+
+	// the pools with most of the data need more pgs, but the pgs of a pool that are close to the target are kept
+	recommendations := RecommendPGs(&dump, &stats)
+	assert.Equal(t, 1, len(recommendations))
+	assert.Equal(t, "rbd", recommendations[0].Pool)
+	assert.Equal(t, 8, recommendations[0].PgNum)
+	assert.Equal(t, 64, recommendations[0].TargetPgNum)
+	assert.Equal(t, 16, recommendations[0].NextPgNum())
+	assert.Equal(t, "increase pg_num of pool rbd from 8 to 64 for 50% of the data", recommendations[0].String())
+
+	// nothing is recommended without data
+	assert.Equal(t, 0, len(RecommendPGs(&dump, &CephStoragePoolStats{})))
+
+	assert.Equal(t, 32, PGRecommendation{PgNum: 16, TargetPgNum: 32}.NextPgNum())
+	assert.Equal(t, 1, nearestPowerOfTwo(0.3))
+	assert.Equal(t, 128, nearestPowerOfTwo(99))
+	assert.Equal(t, 64, nearestPowerOfTwo(80))
+}
@@ -42,6 +42,8 @@ type CephStoragePoolDetails struct {
 	ErasureCodeProfile string `json:"erasure_code_profile"`
 	FailureDomain      string `json:"failureDomain"`
 	CrushRoot          string `json:"crushRoot"`
+	// The replicas placed in each failure domain, which is not a property of the ceph pool
+	ReplicasPerFailureDomain uint `json:"-"`
 }
 
 type CephStoragePoolStats struct {
@@ -185,6 +187,50 @@ func givePoolAppTag(context *clusterd.Context, clusterName string, poolName stri
 	return nil
 }
 
+// GetPoolLabels returns the labels stored in the metadata of the application of the pool
+func GetPoolLabels(context *clusterd.Context, clusterName, poolName, appName string) (map[string]string, error) {
+	args := []string{"osd", "pool", "application", "get", poolName}
+	buf, err := ExecuteCephCommand(context, clusterName, args)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get applications of pool %s. %+v", poolName, err)
+	}
+
+	var apps map[string]map[string]string
+	if err := json.Unmarshal(buf, &apps); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal applications of pool %s. %+v. raw buffer response: %s", poolName, err, string(buf))
+	}
+	return labelsFromMetadata(apps[appName]), nil
+}
+
+// SetPoolLabels stores the labels in the metadata of the application of the pool and removes the labels that are
+// not given anymore
+func SetPoolLabels(context *clusterd.Context, clusterName, poolName, appName string, labels map[string]string) error {
+	current, err := GetPoolLabels(context, clusterName, poolName, appName)
+	if err != nil {
+		return err
+	}
+
+	for _, key := range sortedKeys(current) {
+		if _, ok := labels[key]; ok {
+			continue
+		}
+		args := []string{"osd", "pool", "application", "rm", poolName, appName, labelMetadataPrefix + key}
+		if _, err := ExecuteCephCommand(context, clusterName, args); err != nil {
+			return fmt.Errorf("failed to remove label %s of pool %s. %+v", key, poolName, err)
+		}
+	}
+	for _, key := range sortedKeys(labels) {
+		if value, ok := current[key]; ok && value == labels[key] {
+			continue
+		}
+		args := []string{"osd", "pool", "application", "set", poolName, appName, labelMetadataPrefix + key, labels[key]}
+		if _, err := ExecuteCephCommand(context, clusterName, args); err != nil {
+			return fmt.Errorf("failed to set label %s of pool %s. %+v", key, poolName, err)
+		}
+	}
+	return nil
+}
+
 func CreateECPoolForApp(context *clusterd.Context, clusterName string, newPool CephStoragePoolDetails, appName string, enableECOverwrite bool, erasureCodedConfig model.ErasureCodedPoolConfig) error {
 	args := []string{"osd", "pool", "create", newPool.Name, strconv.Itoa(newPool.Number), "erasure", newPool.ErasureCodeProfile}
 
@@ -254,6 +300,10 @@ func createReplicationCrushRule(context *clusterd.Context, clusterName string, n
 		crushRoot = "default"
 	}
 
+	if newPool.ReplicasPerFailureDomain > 1 {
+		return CreateSpreadCrushRule(context, clusterName, ruleName, crushRoot, failureDomain, newPool.ReplicasPerFailureDomain)
+	}
+
 	args := []string{"osd", "crush", "rule", "create-simple", ruleName, crushRoot, failureDomain}
 	_, err := ExecuteCephCommand(context, clusterName, args)
 	if err != nil {
@@ -360,6 +410,11 @@ func cephPoolToModelPool(cephPool CephStoragePoolDetails, ecpDetails map[string]
 		pool.ErasureCodedConfig.DataChunkCount = ecpDetails.DataChunkCount
 		pool.ErasureCodedConfig.CodingChunkCount = ecpDetails.CodingChunkCount
 		pool.ErasureCodedConfig.Algorithm = fmt.Sprintf("%s::%s", ecpDetails.Plugin, ecpDetails.Technique)
+		pool.ErasureCodedConfig.FailureDomain = ecpDetails.FailureDomain
+		pool.ErasureCodedConfig.CrushRoot = ecpDetails.CrushRoot
+		pool.ErasureCodedConfig.Plugin = ecpDetails.Plugin
+		pool.ErasureCodedConfig.Locality = ecpDetails.Locality
+		pool.ErasureCodedConfig.Durability = ecpDetails.Durability
 	} else if cephPool.Size > 0 {
 		pool.Type = model.Replicated
 		pool.ReplicatedConfig.Size = cephPool.Size
@@ -154,3 +154,35 @@ func testCreateReplicaPool(t *testing.T, failureDomain, crushRoot string) {
 	assert.Nil(t, err)
 	assert.True(t, crushRuleCreated)
 }
+
+func TestPoolLabels(t *testing.T) {
+	commands := []string{}
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithOutputFile: func(debug bool, actionName string, command string, outFileArg string, args ...string) (string, error) {
+			if args[0] == "osd" && args[1] == "pool" && args[2] == "application" {
+				assert.Equal(t, "mypool", args[4])
+				if args[3] == "get" {
+					return `{"rbd":{"label.owner":"team-a","label.ticket":"123","other":"x"}}`, nil
+				}
+				commands = append(commands, fmt.Sprintf("%s %s", args[3], args[6]))
+				return "", nil
+			}
+			return "", fmt.Errorf("unexpected ceph command '%v'", args)
+		},
+	}
+	context := &clusterd.Context{Executor: executor}
+
+	labels, err := GetPoolLabels(context, "myns", "mypool", "rbd")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"owner": "team-a", "ticket": "123"}, labels)
+
+	// only the changed labels are set
+	err = SetPoolLabels(context, "myns", "mypool", "rbd", map[string]string{"owner": "team-b", "ticket": "123", "env": "prod"})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"set label.env", "set label.owner"}, commands)
+
+	commands = []string{}
+	err = SetPoolLabels(context, "myns", "mypool", "rbd", map[string]string{})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"rm label.owner", "rm label.ticket"}, commands)
+}
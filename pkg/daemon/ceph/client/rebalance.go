@@ -0,0 +1,96 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package client
+
+import (
+	"fmt"
+	"time"
+)
+
+// RebalanceProgress is the progress of the recovery and backfill of the objects after a change to the osds
+type RebalanceProgress struct {
+	DegradedObjects  uint64
+	MisplacedObjects uint64
+	// The number of copies of the objects in the cluster
+	TotalObjects uint64
+	// The rate at which the degraded and misplaced objects decreased in the recent samples
+	ObjectsPerSec float64
+	// The estimated time until the cluster is rebalanced, or zero if the objects are not decreasing
+	TimeLeft time.Duration
+}
+
+type rebalanceSample struct {
+	time      time.Time
+	remaining uint64
+}
+
+// RebalanceTracker estimates the time left to rebalance the cluster from the samples of the placement groups
+type RebalanceTracker struct {
+	// the rate is measured from the last sample that is at least as old as the window
+	window  time.Duration
+	samples []rebalanceSample
+}
+
+// NewRebalanceTracker creates a tracker that measures the rate of the rebalance over about the window
+func NewRebalanceTracker(window time.Duration) *RebalanceTracker {
+	return &RebalanceTracker{window: window}
+}
+
+// Add records the degraded and misplaced objects of the placement groups and returns the progress of the rebalance
+func (t *RebalanceTracker) Add(now time.Time, pgMap PgMap) RebalanceProgress {
+	progress := RebalanceProgress{
+		DegradedObjects:  pgMap.DegradedObjects,
+		MisplacedObjects: pgMap.MisplacedObjects,
+		TotalObjects:     pgMap.DegradedTotal,
+	}
+	if pgMap.MisplacedTotal > progress.TotalObjects {
+		progress.TotalObjects = pgMap.MisplacedTotal
+	}
+	remaining := pgMap.DegradedObjects + pgMap.MisplacedObjects
+	if remaining == 0 {
+		t.samples = nil
+		return progress
+	}
+
+	t.samples = append(t.samples, rebalanceSample{time: now, remaining: remaining})
+	for len(t.samples) > 1 && now.Sub(t.samples[1].time) >= t.window {
+		t.samples = t.samples[1:]
+	}
+	oldest := t.samples[0]
+	elapsed := now.Sub(oldest.time).Seconds()
+	if elapsed > 0 && oldest.remaining > remaining {
+		progress.ObjectsPerSec = float64(oldest.remaining-remaining) / elapsed
+		progress.TimeLeft = time.Duration(float64(remaining)/progress.ObjectsPerSec) * time.Second
+	}
+	return progress
+}
+
+// Done returns whether there are no degraded or misplaced objects left
+func (p RebalanceProgress) Done() bool {
+	return p.DegradedObjects == 0 && p.MisplacedObjects == 0
+}
+
+func (p RebalanceProgress) String() string {
+	if p.Done() {
+		return "no degraded or misplaced objects"
+	}
+	timeLeft := "unknown"
+	if p.TimeLeft > 0 {
+		timeLeft = p.TimeLeft.String()
+	}
+	return fmt.Sprintf("%d degraded and %d misplaced of %d objects, %.1f objects/s, time left %s",
+		p.DegradedObjects, p.MisplacedObjects, p.TotalObjects, p.ObjectsPerSec, timeLeft)
+}
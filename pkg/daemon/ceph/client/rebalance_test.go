@@ -0,0 +1,56 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package client
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRebalanceTracker(t *testing.T) {
+	tracker := NewRebalanceTracker(10 * time.Minute)
+	start := time.Date(2018, time.August, 4, 3, 0, 0, 0, time.UTC)
+	pgMap := func(degraded, misplaced uint64) PgMap {
+		return PgMap{DegradedObjects: degraded, DegradedTotal: 3000, MisplacedObjects: misplaced, MisplacedTotal: 3000}
+	}
+
+	// the time left is unknown until the objects decrease
+	progress := tracker.Add(start, pgMap(600, 600))
+	assert.False(t, progress.Done())
+	assert.Equal(t, uint64(3000), progress.TotalObjects)
+	assert.Equal(t, time.Duration(0), progress.TimeLeft)
+	assert.Contains(t, progress.String(), "time left unknown")
+
+	// 120 objects per minute
+	progress = tracker.Add(start.Add(time.Minute), pgMap(500, 580))
+	assert.Equal(t, 2.0, progress.ObjectsPerSec)
+	assert.Equal(t, 9*time.Minute, progress.TimeLeft)
+
+	// the rate is measured from the last sample that is at least ten minutes old
+	tracker.Add(start.Add(10*time.Minute), pgMap(300, 300))
+	progress = tracker.Add(start.Add(15*time.Minute), pgMap(240, 0))
+	assert.Equal(t, 1.0, progress.ObjectsPerSec)
+	assert.Equal(t, 4*time.Minute, progress.TimeLeft)
+	assert.Equal(t, 3, len(tracker.samples))
+
+	// the samples are reset once the cluster is rebalanced
+	progress = tracker.Add(start.Add(20*time.Minute), pgMap(0, 0))
+	assert.True(t, progress.Done())
+	assert.Equal(t, 0, len(tracker.samples))
+	assert.Equal(t, "no degraded or misplaced objects", progress.String())
+}
@@ -0,0 +1,87 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/rook/rook/pkg/clusterd"
+)
+
+const (
+	// RecoveryProfileAggressive recovers and backfills as fast as possible at the expense of the client IO
+	RecoveryProfileAggressive = "aggressive"
+	// RecoveryProfileBalanced uses the default recovery and backfill settings of ceph
+	RecoveryProfileBalanced = "balanced"
+	// RecoveryProfileLowImpact throttles the recovery and backfill to leave the bandwidth to the clients
+	RecoveryProfileLowImpact = "low-impact"
+)
+
+// recoveryProfiles are the osd settings of each recovery profile
+var recoveryProfiles = map[string]map[string]string{
+	RecoveryProfileAggressive: {
+		"osd_max_backfills":        "8",
+		"osd_recovery_max_active":  "8",
+		"osd_recovery_op_priority": "10",
+		"osd_recovery_sleep_hdd":   "0",
+		"osd_recovery_sleep_ssd":   "0",
+	},
+	RecoveryProfileBalanced: {
+		"osd_max_backfills":        "1",
+		"osd_recovery_max_active":  "3",
+		"osd_recovery_op_priority": "3",
+		"osd_recovery_sleep_hdd":   "0.1",
+		"osd_recovery_sleep_ssd":   "0",
+	},
+	RecoveryProfileLowImpact: {
+		"osd_max_backfills":        "1",
+		"osd_recovery_max_active":  "1",
+		"osd_recovery_op_priority": "1",
+		"osd_recovery_sleep_hdd":   "0.5",
+		"osd_recovery_sleep_ssd":   "0.1",
+	},
+}
+
+// RecoveryProfileSettings returns the osd settings of the recovery profile
+func RecoveryProfileSettings(profile string) (map[string]string, error) {
+	settings, ok := recoveryProfiles[profile]
+	if !ok {
+		return nil, fmt.Errorf("unknown recovery profile %q. must be one of %s, %s or %s",
+			profile, RecoveryProfileAggressive, RecoveryProfileBalanced, RecoveryProfileLowImpact)
+	}
+	return settings, nil
+}
+
+// SetRecoveryProfile applies the settings of the recovery profile to the running osds. The settings are not persisted,
+// so they need to be applied again to the osds that restart.
+func SetRecoveryProfile(context *clusterd.Context, clusterName, profile string) error {
+	settings, err := RecoveryProfileSettings(profile)
+	if err != nil {
+		return err
+	}
+
+	injected := []string{}
+	for _, option := range sortedKeys(settings) {
+		injected = append(injected, fmt.Sprintf("--%s=%s", option, settings[option]))
+	}
+	args := []string{"tell", "osd.*", "injectargs", strings.Join(injected, " ")}
+	if _, err := ExecuteCephCommand(context, clusterName, args); err != nil {
+		return fmt.Errorf("failed to apply recovery profile %s to the osds. %+v", profile, err)
+	}
+	return nil
+}
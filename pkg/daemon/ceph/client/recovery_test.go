@@ -0,0 +1,47 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package client
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/rook/rook/pkg/clusterd"
+	exectest "github.com/rook/rook/pkg/util/exec/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetRecoveryProfile(t *testing.T) {
+	injected := ""
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithOutputFile: func(debug bool, actionName string, command string, outFileArg string, args ...string) (string, error) {
+			if args[0] == "tell" && args[1] == "osd.*" && args[2] == "injectargs" {
+				injected = args[3]
+				return "", nil
+			}
+			return "", fmt.Errorf("unexpected ceph command '%v'", args)
+		},
+	}
+	context := &clusterd.Context{Executor: executor}
+
+	err := SetRecoveryProfile(context, "foocluster", RecoveryProfileLowImpact)
+	assert.Nil(t, err)
+	assert.Equal(t, "--osd_max_backfills=1 --osd_recovery_max_active=1 --osd_recovery_op_priority=1 "+
+		"--osd_recovery_sleep_hdd=0.5 --osd_recovery_sleep_ssd=0.1", injected)
+
+	err = SetRecoveryProfile(context, "foocluster", "fastest")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,226 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rook/rook/pkg/clusterd"
+)
+
+// the inconsistent scrubs kept in the history of a pg
+const maxScrubInconsistencies = 5
+
+// PGScrubStats is the scrub state of a placement group in the pg dump
+type PGScrubStats struct {
+	ID                 string `json:"pgid"`
+	State              string `json:"state"`
+	LastScrubStamp     string `json:"last_scrub_stamp"`
+	LastDeepScrubStamp string `json:"last_deep_scrub_stamp"`
+	ActingOsdIDs       []int  `json:"acting"`
+}
+
+// InconsistentObject is an object whose copies differ between the osds, as found by the last scrub of its pg
+type InconsistentObject struct {
+	Object struct {
+		Name string `json:"name"`
+	} `json:"object"`
+	Errors           []string `json:"errors"`
+	UnionShardErrors []string `json:"union_shard_errors"`
+	Shards           []struct {
+		OSD    int      `json:"osd"`
+		Errors []string `json:"errors"`
+	} `json:"shards"`
+}
+
+// ScrubResult is a scrub of a pg that found inconsistent objects
+type ScrubResult struct {
+	// The time the operator found the result of the scrub
+	Found time.Time `json:"found"`
+	// The scrub stamp of the pg after the scrub
+	Stamp   string `json:"stamp"`
+	Deep    bool   `json:"deep"`
+	Objects int    `json:"inconsistentObjects"`
+	// The osds with a copy of an object that has errors
+	OSDs   []int    `json:"osds,omitempty"`
+	Errors []string `json:"errors,omitempty"`
+	// The command to repair the pg
+	Repair string `json:"repair"`
+}
+
+// PGScrubHistory is the history of the scrubs of a pg, with the recent scrubs that found inconsistent objects
+type PGScrubHistory struct {
+	PG            string        `json:"pg"`
+	LastScrub     string        `json:"lastScrub"`
+	LastDeepScrub string        `json:"lastDeepScrub"`
+	Scrubs        int           `json:"scrubs"`
+	Inconsistent  []ScrubResult `json:"inconsistent,omitempty"`
+}
+
+// Inconsistent returns whether the last scrub of the pg found inconsistent objects
+func (s PGScrubStats) Inconsistent() bool {
+	return strings.Contains(s.State, "inconsistent")
+}
+
+// PoolID returns the id of the pool of the pg, which is the prefix of the pg id
+func (s PGScrubStats) PoolID() (int, error) {
+	parts := strings.SplitN(s.ID, ".", 2)
+	if len(parts) != 2 {
+		return 0, fmt.Errorf("invalid pg id %s", s.ID)
+	}
+	return strconv.Atoi(parts[0])
+}
+
+// GetPGScrubStats returns the scrub state of all the pgs
+func GetPGScrubStats(context *clusterd.Context, clusterName string) ([]PGScrubStats, error) {
+	var stats []PGScrubStats
+	err := ForEachPGScrubStats(context, clusterName, func(s PGScrubStats) error {
+		stats = append(stats, s)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// ForEachPGScrubStats calls process with the scrub state of each pg as it is decoded from the pg dump, which is the
+// largest output of ceph on a big cluster. The dump stops at the first error returned by process, which is returned
+// as is.
+func ForEachPGScrubStats(context *clusterd.Context, clusterName string, process func(PGScrubStats) error) error {
+	args := []string{"pg", "dump", "pgs"}
+	var processErr error
+	err := executeCephCommandWithOutputReader(context, clusterName, args, func(r io.Reader) error {
+		return decodeArray(r, pgStatsKey, func(dec *json.Decoder) error {
+			var s PGScrubStats
+			if err := dec.Decode(&s); err != nil {
+				return err
+			}
+			processErr = process(s)
+			return processErr
+		})
+	})
+	if processErr != nil {
+		return processErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get pg dump: %+v", err)
+	}
+	return nil
+}
+
+// ListInconsistentObjects returns the inconsistent objects found by the last scrub of the pg
+func ListInconsistentObjects(context *clusterd.Context, clusterName, pgID string) ([]InconsistentObject, error) {
+	args := []string{"list-inconsistent-obj", pgID}
+	buf, err := ExecuteRadosCommand(context, clusterName, args)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the inconsistent objects of pg %s: %+v", pgID, err)
+	}
+
+	var result struct {
+		Inconsistents []InconsistentObject `json:"inconsistents"`
+	}
+	if err := json.Unmarshal(buf, &result); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal the inconsistent objects of pg %s: %+v", pgID, err)
+	}
+	return result.Inconsistents, nil
+}
+
+// RepairPG starts a repair of the inconsistent objects of the pg
+func RepairPG(context *clusterd.Context, clusterName, pgID string) error {
+	args := []string{"pg", "repair", pgID}
+	if _, err := ExecuteCephCommand(context, clusterName, args); err != nil {
+		return fmt.Errorf("failed to repair pg %s: %+v", pgID, err)
+	}
+	return nil
+}
+
+// NewScrub returns whether the pg was scrubbed since its last scrub in the history
+func (h *PGScrubHistory) NewScrub(stats PGScrubStats) bool {
+	return stats.LastScrubStamp != h.LastScrub || stats.LastDeepScrubStamp != h.LastDeepScrub
+}
+
+// Record adds the new scrub of the pg to the history. If the scrub found inconsistent objects, the result is added to
+// the inconsistent scrubs of the pg and returned.
+func (h *PGScrubHistory) Record(now time.Time, stats PGScrubStats, objects []InconsistentObject) *ScrubResult {
+	deep := stats.LastDeepScrubStamp != h.LastDeepScrub
+	h.PG = stats.ID
+	h.LastScrub = stats.LastScrubStamp
+	h.LastDeepScrub = stats.LastDeepScrubStamp
+	h.Scrubs++
+	if !stats.Inconsistent() {
+		return nil
+	}
+
+	result := ScrubResult{Found: now, Stamp: stats.LastScrubStamp, Deep: deep, Objects: len(objects),
+		Repair: fmt.Sprintf("ceph pg repair %s", stats.ID)}
+	if deep {
+		result.Stamp = stats.LastDeepScrubStamp
+	}
+	osds := map[int]bool{}
+	errs := map[string]bool{}
+	for _, o := range objects {
+		for _, shard := range o.Shards {
+			if len(shard.Errors) > 0 {
+				osds[shard.OSD] = true
+			}
+		}
+		for _, e := range o.Errors {
+			errs[e] = true
+		}
+		for _, e := range o.UnionShardErrors {
+			errs[e] = true
+		}
+	}
+	for id := range osds {
+		result.OSDs = append(result.OSDs, id)
+	}
+	sort.Ints(result.OSDs)
+	for e := range errs {
+		result.Errors = append(result.Errors, e)
+	}
+	sort.Strings(result.Errors)
+
+	h.Inconsistent = append(h.Inconsistent, result)
+	if len(h.Inconsistent) > maxScrubInconsistencies {
+		h.Inconsistent = h.Inconsistent[len(h.Inconsistent)-maxScrubInconsistencies:]
+	}
+	return &result
+}
+
+// InconsistentScrubsByOSD returns the number of inconsistent scrubs of the pgs since the given time that found errors
+// on each osd
+func InconsistentScrubsByOSD(history []PGScrubHistory, since time.Time) map[int]int {
+	counts := map[int]int{}
+	for _, h := range history {
+		for _, r := range h.Inconsistent {
+			if r.Found.Before(since) {
+				continue
+			}
+			for _, id := range r.OSDs {
+				counts[id]++
+			}
+		}
+	}
+	return counts
+}
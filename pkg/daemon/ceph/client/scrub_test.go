@@ -0,0 +1,82 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/rook/rook/pkg/clusterd"
+	exectest "github.com/rook/rook/pkg/util/exec/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListInconsistentObjects(t *testing.T) {
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithOutput: func(debug bool, actionName string, command string, args ...string) (string, error) {
+			assert.Equal(t, RadosTool, command)
+			assert.Equal(t, []string{"list-inconsistent-obj", "2.5"}, args[:2])
+			return `{"epoch":30,"inconsistents":[{"object":{"name":"obj1"},"errors":[],"union_shard_errors":["read_error"],
+				"shards":[{"osd":0,"errors":[]},{"osd":3,"errors":["read_error"]}]}]}`, nil
+		},
+	}
+	objects, err := ListInconsistentObjects(&clusterd.Context{Executor: executor}, "rook", "2.5")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(objects))
+	assert.Equal(t, "obj1", objects[0].Object.Name)
+	assert.Equal(t, 3, objects[0].Shards[1].OSD)
+}
+
+func TestScrubHistory(t *testing.T) {
+	now := time.Now()
+	h := &PGScrubHistory{}
+	stats := PGScrubStats{ID: "2.5", State: "active+clean", LastScrubStamp: "s1", LastDeepScrubStamp: "d1"}
+	id, err := stats.PoolID()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, id)
+
+	// a clean scrub is only counted
+	assert.True(t, h.NewScrub(stats))
+	assert.Nil(t, h.Record(now, stats, nil))
+	assert.False(t, h.NewScrub(stats))
+	assert.Equal(t, 1, h.Scrubs)
+
+	// a deep scrub that found inconsistent objects is kept with the osds that have errors
+	var objects []InconsistentObject
+	assert.Nil(t, json.Unmarshal([]byte(`[{"object":{"name":"obj1"},"errors":["data_digest_mismatch"],"union_shard_errors":["read_error"],
+		"shards":[{"osd":0,"errors":[]},{"osd":3,"errors":["read_error"]}]}]`), &objects))
+	stats.State = "active+clean+inconsistent"
+	stats.LastScrubStamp = "s2"
+	stats.LastDeepScrubStamp = "d2"
+	assert.True(t, h.NewScrub(stats))
+	result := h.Record(now, stats, objects)
+	assert.NotNil(t, result)
+	assert.Equal(t, ScrubResult{Found: now, Stamp: "d2", Deep: true, Objects: 1, OSDs: []int{3},
+		Errors: []string{"data_digest_mismatch", "read_error"}, Repair: "ceph pg repair 2.5"}, *result)
+	assert.Equal(t, 2, h.Scrubs)
+
+	// only the recent inconsistent scrubs are kept
+	for i := 0; i < 10; i++ {
+		h.Record(now, stats, objects)
+	}
+	assert.Equal(t, maxScrubInconsistencies, len(h.Inconsistent))
+
+	other := PGScrubHistory{Inconsistent: []ScrubResult{{Found: now.Add(-time.Hour), OSDs: []int{3, 4}}, {Found: now.Add(-48 * time.Hour), OSDs: []int{4}}}}
+	counts := InconsistentScrubsByOSD([]PGScrubHistory{*h, other}, now.Add(-24*time.Hour))
+	assert.Equal(t, map[int]int{3: 6, 4: 1}, counts)
+}
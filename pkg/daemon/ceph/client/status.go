@@ -114,6 +114,10 @@ type PgMap struct {
 	CacheFlushBps         uint64         `json:"flush_bytes_sec"`
 	CacheEvictBps         uint64         `json:"evict_bytes_sec"`
 	CachePromoteBps       uint64         `json:"promote_op_per_sec"`
+	DegradedObjects       uint64         `json:"degraded_objects"`
+	DegradedTotal         uint64         `json:"degraded_total"`
+	MisplacedObjects      uint64         `json:"misplaced_objects"`
+	MisplacedTotal        uint64         `json:"misplaced_total"`
 }
 
 type PgStateEntry struct {
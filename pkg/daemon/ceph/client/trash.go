@@ -0,0 +1,126 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rook/rook/pkg/clusterd"
+)
+
+// the format of the expiration time of the images moved to the trash
+const trashTimeFormat = "2006-01-02 15:04:05"
+
+// CephTrashImage is an image that was moved to the trash of its pool
+type CephTrashImage struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Source    string `json:"source"`
+	DeletedAt string `json:"deleted_at"`
+	// Status reports until when the image is protected from a purge of the trash, or since when it is expired
+	Status string `json:"status"`
+}
+
+// TrashImage moves the image to the trash of its pool, where it can be restored until it expires
+func TrashImage(context *clusterd.Context, clusterName, name, poolName string, expiresAt time.Time) error {
+	args := []string{"trash", "mv", getImageSpec(name, poolName), "--expires-at", expiresAt.UTC().Format(trashTimeFormat)}
+	buf, err := ExecuteRBDCommandNoFormat(context, clusterName, args)
+	if err != nil {
+		return fmt.Errorf("failed to move image %s in pool %s to the trash: %+v. output: %s", name, poolName, err, string(buf))
+	}
+	return nil
+}
+
+// ListTrash returns the images in the trash of the pool
+func ListTrash(context *clusterd.Context, clusterName, poolName string) ([]CephTrashImage, error) {
+	args := []string{"trash", "ls", "--long", poolName}
+	buf, err := ExecuteRBDCommand(context, clusterName, args)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the trash of pool %s: %+v. output: %s", poolName, err, string(buf))
+	}
+
+	images := []CephTrashImage{}
+	// an empty trash has no output
+	if len(strings.TrimSpace(string(buf))) == 0 {
+		return images, nil
+	}
+	if err := json.Unmarshal(buf, &images); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal the trash of pool %s. %+v. raw buffer response: %s", poolName, err, string(buf))
+	}
+	return images, nil
+}
+
+// RestoreTrashImage moves the image with the id from the trash back to its pool
+func RestoreTrashImage(context *clusterd.Context, clusterName, poolName, id string) error {
+	args := []string{"trash", "restore", getImageSpec(id, poolName)}
+	buf, err := ExecuteRBDCommandNoFormat(context, clusterName, args)
+	if err != nil {
+		return fmt.Errorf("failed to restore image %s from the trash of pool %s: %+v. output: %s", id, poolName, err, string(buf))
+	}
+	return nil
+}
+
+// RestoreTrashImageAs moves the image with the id from the trash back to its pool with a new name
+func RestoreTrashImageAs(context *clusterd.Context, clusterName, poolName, id, name string) error {
+	args := []string{"trash", "restore", getImageSpec(id, poolName), "--image", name}
+	buf, err := ExecuteRBDCommandNoFormat(context, clusterName, args)
+	if err != nil {
+		return fmt.Errorf("failed to restore image %s from the trash of pool %s as %s: %+v. output: %s", id, poolName, name, err, string(buf))
+	}
+	return nil
+}
+
+// RemoveTrashImage deletes the image with the id from the trash. An image that did not expire yet is only removed
+// when forced.
+func RemoveTrashImage(context *clusterd.Context, clusterName, poolName, id string, force bool) error {
+	args := []string{"trash", "rm", getImageSpec(id, poolName)}
+	if force {
+		args = append(args, "--force")
+	}
+	buf, err := ExecuteRBDCommandNoFormat(context, clusterName, args)
+	if err != nil {
+		return fmt.Errorf("failed to remove image %s from the trash of pool %s: %+v. output: %s", id, poolName, err, string(buf))
+	}
+	return nil
+}
+
+// DeleteTrashImage deletes the image with the id from the trash even if it did not expire yet. The objects of the
+// image are removed with the given number of concurrent operations, or with the rbd default if zero.
+func DeleteTrashImage(context *clusterd.Context, clusterName, poolName, id string, concurrentOps int) error {
+	args := []string{"trash", "rm", getImageSpec(id, poolName), "--force"}
+	if concurrentOps > 0 {
+		args = append(args, fmt.Sprintf("--rbd-concurrent-management-ops=%d", concurrentOps))
+	}
+	buf, err := ExecuteRBDCommandNoFormat(context, clusterName, args)
+	if err != nil {
+		return fmt.Errorf("failed to delete image %s from the trash of pool %s: %+v. output: %s", id, poolName, err, string(buf))
+	}
+	return nil
+}
+
+// PurgeTrash deletes the images in the trash of the pool that are expired
+func PurgeTrash(context *clusterd.Context, clusterName, poolName string) error {
+	args := []string{"trash", "purge", poolName}
+	buf, err := ExecuteRBDCommandNoFormat(context, clusterName, args)
+	if err != nil {
+		return fmt.Errorf("failed to purge the trash of pool %s: %+v. output: %s", poolName, err, string(buf))
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package client
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rook/rook/pkg/clusterd"
+	exectest "github.com/rook/rook/pkg/util/exec/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTrash(t *testing.T) {
+	commands := []string{}
+	trash := ""
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithOutput: func(debug bool, actionName string, command string, args ...string) (string, error) {
+			if command != "rbd" || args[0] != "trash" {
+				return "", fmt.Errorf("unexpected rbd command '%v'", args)
+			}
+			if args[1] == "ls" {
+				assert.Equal(t, []string{"--long", "pool1"}, args[2:4])
+				return trash, nil
+			}
+			// leave out the config and keyring args
+			end := 0
+			for end < len(args) && !strings.HasPrefix(args[end], "--cluster=") {
+				end++
+			}
+			commands = append(commands, strings.Join(args[:end], " "))
+			return "", nil
+		},
+	}
+	context := &clusterd.Context{Executor: executor}
+
+	err := TrashImage(context, "foocluster", "image1", "pool1", time.Date(2018, time.August, 14, 10, 0, 0, 0, time.UTC))
+	assert.Nil(t, err)
+
+	images, err := ListTrash(context, "foocluster", "pool1")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(images))
+
+	trash = `[{"id":"10126b8b4567","name":"image1","source":"USER","deleted_at":"Mon Aug 13 10:00:00 2018","status":"protected until Tue Aug 14 10:00:00 2018"}]`
+	images, err = ListTrash(context, "foocluster", "pool1")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(images))
+	assert.Equal(t, "10126b8b4567", images[0].ID)
+	assert.Equal(t, "image1", images[0].Name)
+	assert.Equal(t, "protected until Tue Aug 14 10:00:00 2018", images[0].Status)
+
+	assert.Nil(t, RestoreTrashImage(context, "foocluster", "pool1", "10126b8b4567"))
+	assert.Nil(t, RestoreTrashImageAs(context, "foocluster", "pool1", "10126b8b4567", "deleting-image1"))
+	assert.Nil(t, RemoveTrashImage(context, "foocluster", "pool1", "10126b8b4567", false))
+	assert.Nil(t, RemoveTrashImage(context, "foocluster", "pool1", "10126b8b4567", true))
+	assert.Nil(t, DeleteTrashImage(context, "foocluster", "pool1", "10126b8b4567", 0))
+	assert.Nil(t, DeleteTrashImage(context, "foocluster", "pool1", "10126b8b4567", 4))
+	assert.Nil(t, PurgeTrash(context, "foocluster", "pool1/ns1"))
+	assert.Equal(t, []string{
+		"trash mv pool1/image1 --expires-at 2018-08-14 10:00:00",
+		"trash restore pool1/10126b8b4567",
+		"trash restore pool1/10126b8b4567 --image deleting-image1",
+		"trash rm pool1/10126b8b4567",
+		"trash rm pool1/10126b8b4567 --force",
+		"trash rm pool1/10126b8b4567 --force",
+		"trash rm pool1/10126b8b4567 --force --rbd-concurrent-management-ops=4",
+		"trash purge pool1/ns1",
+	}, commands)
+}
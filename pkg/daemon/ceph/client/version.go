@@ -0,0 +1,128 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"github.com/rook/rook/pkg/clusterd"
+)
+
+// CephVersion is the version of a ceph release
+type CephVersion struct {
+	Major int
+	Minor int
+	Extra int
+}
+
+var (
+	// Luminous is the first release of ceph 12
+	Luminous = CephVersion{Major: 12}
+	// Mimic is the first release of ceph 13
+	Mimic = CephVersion{Major: 13}
+	// Nautilus is the first release of ceph 14
+	Nautilus = CephVersion{Major: 14}
+
+	versionPattern = regexp.MustCompile(`ceph version (\d+)\.(\d+)\.(\d+)`)
+)
+
+// CephFeatures are the capabilities of the cluster that depend on the versions of its daemons
+type CephFeatures struct {
+	// Version is the oldest version of the daemons in the cluster
+	Version CephVersion
+	// ConfigDatabase is whether the mons store the config options of the daemons and clients
+	ConfigDatabase bool
+	// ConnectionModes is whether the connections between daemons and clients can be encrypted
+	ConnectionModes bool
+}
+
+func (v CephVersion) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Extra)
+}
+
+// IsAtLeast returns whether the version is the same or newer than the other version
+func (v CephVersion) IsAtLeast(other CephVersion) bool {
+	if v.Major != other.Major {
+		return v.Major > other.Major
+	}
+	if v.Minor != other.Minor {
+		return v.Minor > other.Minor
+	}
+	return v.Extra >= other.Extra
+}
+
+// ParseCephVersion extracts the version from the version string of a daemon, such as
+// "ceph version 12.2.7 (3ec878d1e53e1aeb47a9f619c49d9e7c0aa384d5) luminous (stable)"
+func ParseCephVersion(version string) (CephVersion, error) {
+	match := versionPattern.FindStringSubmatch(version)
+	if match == nil {
+		return CephVersion{}, fmt.Errorf("failed to parse version from %q", version)
+	}
+	var parts [3]int
+	for i := range parts {
+		// the pattern only matches digits
+		parts[i], _ = strconv.Atoi(match[i+1])
+	}
+	return CephVersion{Major: parts[0], Minor: parts[1], Extra: parts[2]}, nil
+}
+
+// GetVersions returns the number of daemons running each version, for every type of daemon and overall
+func GetVersions(context *clusterd.Context, clusterName string) (map[string]map[string]int, error) {
+	args := []string{"versions"}
+	buf, err := ExecuteCephCommand(context, clusterName, args)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get versions. %+v", err)
+	}
+
+	var versions map[string]map[string]int
+	if err := json.Unmarshal(buf, &versions); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal versions. %+v. raw buffer response: %s", err, string(buf))
+	}
+	return versions, nil
+}
+
+// DetectFeatures returns the capabilities of the cluster. The oldest version of the running daemons is used, so a
+// feature is only reported after all the daemons have been updated to a release that supports it.
+func DetectFeatures(context *clusterd.Context, clusterName string) (*CephFeatures, error) {
+	versions, err := GetVersions(context, clusterName)
+	if err != nil {
+		return nil, err
+	}
+	if len(versions["overall"]) == 0 {
+		return nil, fmt.Errorf("no daemons reported their version")
+	}
+
+	var oldest *CephVersion
+	for version := range versions["overall"] {
+		v, err := ParseCephVersion(version)
+		if err != nil {
+			return nil, err
+		}
+		if oldest == nil || !v.IsAtLeast(*oldest) {
+			oldest = &v
+		}
+	}
+
+	return &CephFeatures{
+		Version:         *oldest,
+		ConfigDatabase:  oldest.IsAtLeast(Mimic),
+		ConnectionModes: oldest.IsAtLeast(Nautilus),
+	}, nil
+}
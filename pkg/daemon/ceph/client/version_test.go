@@ -0,0 +1,77 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package client
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/rook/rook/pkg/clusterd"
+	exectest "github.com/rook/rook/pkg/util/exec/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCephVersion(t *testing.T) {
+	v, err := ParseCephVersion("ceph version 12.2.7 (3ec878d1e53e1aeb47a9f619c49d9e7c0aa384d5) luminous (stable)")
+	assert.Nil(t, err)
+	assert.Equal(t, CephVersion{Major: 12, Minor: 2, Extra: 7}, v)
+	assert.Equal(t, "12.2.7", v.String())
+	assert.True(t, v.IsAtLeast(Luminous))
+	assert.False(t, v.IsAtLeast(Mimic))
+	assert.True(t, v.IsAtLeast(CephVersion{12, 2, 7}))
+	assert.False(t, v.IsAtLeast(CephVersion{12, 2, 8}))
+
+	v, err = ParseCephVersion("ceph version 14.1.0-123-gabcdef (abcdef) nautilus (dev)")
+	assert.Nil(t, err)
+	assert.True(t, v.IsAtLeast(Nautilus))
+
+	_, err = ParseCephVersion("unknown")
+	assert.NotNil(t, err)
+}
+
+func TestDetectFeatures(t *testing.T) {
+	response := ""
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithOutputFile: func(debug bool, actionName string, command string, outFileArg string, args ...string) (string, error) {
+			if args[0] == "versions" {
+				return response, nil
+			}
+			return "", fmt.Errorf("unexpected ceph command '%v'", args)
+		},
+	}
+	context := &clusterd.Context{Executor: executor}
+
+	response = `{"mon":{"ceph version 14.2.1 (d555a9489eb35f84f2e1ef49b77e19da9d113972) nautilus (stable)":3},
+		"overall":{"ceph version 14.2.1 (d555a9489eb35f84f2e1ef49b77e19da9d113972) nautilus (stable)":3}}`
+	features, err := DetectFeatures(context, "ns")
+	assert.Nil(t, err)
+	assert.Equal(t, CephVersion{14, 2, 1}, features.Version)
+	assert.True(t, features.ConfigDatabase)
+	assert.True(t, features.ConnectionModes)
+
+	// the oldest daemons determine the features during an upgrade
+	response = `{"overall":{"ceph version 14.2.1 (d555a9489eb35f84f2e1ef49b77e19da9d113972) nautilus (stable)":2,
+		"ceph version 12.2.7 (3ec878d1e53e1aeb47a9f619c49d9e7c0aa384d5) luminous (stable)":4}}`
+	features, err = DetectFeatures(context, "ns")
+	assert.Nil(t, err)
+	assert.Equal(t, CephVersion{12, 2, 7}, features.Version)
+	assert.False(t, features.ConfigDatabase)
+	assert.False(t, features.ConnectionModes)
+
+	response = `{"overall":{}}`
+	_, err = DetectFeatures(context, "ns")
+	assert.NotNil(t, err)
+}
@@ -43,7 +43,9 @@ type Config struct {
 	FilesystemID  string
 	ID            string
 	ActiveStandby bool
-	ClusterInfo   *mon.ClusterInfo
+	// The memory limit of the metadata cache in MB, or the ceph default if zero
+	CacheMemoryLimitMB int
+	ClusterInfo        *mon.ClusterInfo
 }
 
 func Run(context *clusterd.Context, config *Config) error {
@@ -78,6 +80,9 @@ func generateConfigFiles(context *clusterd.Context, config *Config) error {
 		"mds_standby_for_fscid": config.FilesystemID,
 		"mds_standby_replay":    strconv.FormatBool(config.ActiveStandby),
 	}
+	if config.CacheMemoryLimitMB > 0 {
+		settings["mds_cache_memory_limit"] = strconv.Itoa(config.CacheMemoryLimitMB * 1024 * 1024)
+	}
 
 	keyringPath := getMDSKeyringPath(context.ConfigDir)
 	_, err = mon.GenerateConfigFile(context, config.ClusterInfo, getMDSConfDir(context.ConfigDir),
@@ -94,8 +94,8 @@ func startMgr(context *clusterd.Context, config *Config) error {
 	confFile := getMgrConfFilePath(context.ConfigDir, config.Name, config.ClusterInfo.Name)
 	util.WriteFileToLog(logger, confFile)
 
+	// the keyring is not written to the log since it contains the secret key of the mgr
 	keyringPath := getMgrKeyringPath(context.ConfigDir, config.Name)
-	util.WriteFileToLog(logger, keyringPath)
 	args := []string{
 		"--foreground",
 		fmt.Sprintf("--cluster=%s", config.ClusterInfo.Name),
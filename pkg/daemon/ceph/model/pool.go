@@ -24,13 +24,19 @@ const (
 type PoolType int
 
 type ReplicatedPoolConfig struct {
-	Size uint `json:"size"`
+	Size                     uint `json:"size"`
+	ReplicasPerFailureDomain uint `json:"replicasPerFailureDomain"`
 }
 
 type ErasureCodedPoolConfig struct {
 	DataChunkCount   uint   `json:"dataChunkCount"`
 	CodingChunkCount uint   `json:"codingChunkCount"`
 	Algorithm        string `json:"algorithm"`
+	FailureDomain    string `json:"failureDomain"`
+	CrushRoot        string `json:"crushRoot"`
+	Plugin           string `json:"plugin"`
+	Locality         uint   `json:"locality"`
+	Durability       uint   `json:"durability"`
 }
 
 type Pool struct {
@@ -49,6 +49,9 @@ const (
 	defaultConfigDir   = "/etc/ceph"
 	defaultConfigFile  = "ceph.conf"
 	defaultKeyringFile = "keyring"
+
+	// keyrings contain secret keys and must only be readable by the owner
+	keyringFileMode = 0600
 )
 
 type CephMonitorConfig struct {
@@ -154,7 +157,7 @@ func writeKeyring(keyring, keyringPath string) error {
 	if err := os.MkdirAll(filepath.Dir(keyringPath), 0744); err != nil {
 		return fmt.Errorf("failed to create keyring directory for %s: %+v", keyringPath, err)
 	}
-	if err := ioutil.WriteFile(keyringPath, []byte(keyring), 0644); err != nil {
+	if err := writeKeyringFile(keyringPath, keyring); err != nil {
 		return fmt.Errorf("failed to write monitor keyring to %s: %+v", keyringPath, err)
 	}
 
@@ -170,7 +173,7 @@ func writeKeyring(keyring, keyringPath string) error {
 		return nil
 	}
 	defaultPath := path.Join(defaultConfigDir, defaultKeyringFile)
-	if err := ioutil.WriteFile(defaultPath, []byte(keyring), 0644); err != nil {
+	if err := writeKeyringFile(defaultPath, keyring); err != nil {
 		logger.Warningf("failed to copy keyring to %s: %+v", defaultPath, err)
 		return nil
 	}
@@ -178,6 +181,15 @@ func writeKeyring(keyring, keyringPath string) error {
 	return nil
 }
 
+// writeKeyringFile writes the keyring so that it is only accessible by the owner. The permissions are also
+// tightened on keyrings that were already written with looser permissions by previous versions.
+func writeKeyringFile(keyringPath, keyring string) error {
+	if err := ioutil.WriteFile(keyringPath, []byte(keyring), keyringFileMode); err != nil {
+		return err
+	}
+	return os.Chmod(keyringPath, keyringFileMode)
+}
+
 func WriteKeyring(keyringPath, keyring string, generateContents func(string) string) error {
 	// write the keyring to disk
 	contents := generateContents(keyring)
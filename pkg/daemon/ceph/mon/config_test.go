@@ -149,3 +149,22 @@ func verifyConfigValue(t *testing.T, actualConf *ini.File, section, key, expecte
 	actualVal := k.Value()
 	assert.Equal(t, expectedVal, actualVal)
 }
+
+func TestWriteKeyringFile(t *testing.T) {
+	configDir, err := ioutil.TempDir("", "TestWriteKeyringFile")
+	if err != nil {
+		t.Fatalf("failed to create temp config dir: %+v", err)
+	}
+	defer os.RemoveAll(configDir)
+
+	// a keyring previously written with loose permissions is tightened
+	keyringPath := filepath.Join(configDir, "client.admin.keyring")
+	assert.Nil(t, ioutil.WriteFile(keyringPath, []byte("old"), 0644))
+	assert.Nil(t, writeKeyringFile(keyringPath, "key = adminsecret"))
+
+	info, err := os.Stat(keyringPath)
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	contents, _ := ioutil.ReadFile(keyringPath)
+	assert.Equal(t, "key = adminsecret", string(contents))
+}
@@ -19,6 +19,7 @@ import (
 	"fmt"
 	"net"
 	"os"
+	"path"
 	"strings"
 
 	"github.com/rook/rook/pkg/clusterd"
@@ -34,6 +35,8 @@ type Config struct {
 	Cluster  *ClusterInfo
 	isDaemon bool
 	Port     int32
+	// The path of the log file of the mon, or stdout if empty
+	LogFile string
 }
 
 func NewConfig(name string, cluster *ClusterInfo, isDaemon bool, port int32) *Config {
@@ -151,6 +154,12 @@ func startMon(context *clusterd.Context, config *Config, confFilePath, monDataDi
 		fmt.Sprintf("--public-addr=%s", joinHostPort(context.NetworkInfo.PublicAddr, config.Port)),
 		fmt.Sprintf("--public-bind-addr=%s", joinHostPort(context.NetworkInfo.ClusterAddr, config.Port)),
 	}
+	if config.LogFile != "" {
+		if err := os.MkdirAll(path.Dir(config.LogFile), 0755); err != nil {
+			return fmt.Errorf("failed to create log dir for mon %s. %+v", config.Name, err)
+		}
+		args = append(args, fmt.Sprintf("--log-file=%s", config.LogFile))
+	}
 	if err = context.Executor.ExecuteCommand(false, config.Name, "ceph-mon", args...); err != nil {
 		return fmt.Errorf("failed to start mon: %+v", err)
 	}
@@ -0,0 +1,178 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package osd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	rookalpha "github.com/rook/rook/pkg/apis/rook.io/v1alpha2"
+	"github.com/rook/rook/pkg/clusterd"
+	"github.com/rook/rook/pkg/operator/ceph/cluster/osd/config"
+	"github.com/rook/rook/pkg/util/sys"
+)
+
+// the prefix of the labels of the partitions that ceph-disk creates for the data, block, journal, db and wal of an osd
+const cephDiskPartitionPrefix = "ceph "
+
+// existingOSD is the data dir of an osd that was created outside of rook
+type existingOSD struct {
+	path      string
+	id        int
+	uuid      uuid.UUID
+	storeType string
+}
+
+// findExistingOSD looks for the data dir of an osd of the cluster inside the config root. Rook data dirs named
+// osd<id> and ceph data dirs named <cluster>-<id> are recognized. Nil is returned if no osd is found.
+func findExistingOSD(configRoot, fsid string) (*existingOSD, error) {
+	entries, err := ioutil.ReadDir(configRoot)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read dir %s. %+v", configRoot, err)
+	}
+
+	var found *existingOSD
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		dataPath := filepath.Join(configRoot, entry.Name())
+		osd, err := loadExistingOSD(dataPath)
+		if err != nil {
+			logger.Debugf("skipping %s. %+v", dataPath, err)
+			continue
+		}
+
+		clusterFSID, err := readOSDDataFile(dataPath, "ceph_fsid")
+		if err != nil || clusterFSID != fsid {
+			logger.Infof("skipping osd.%d in %s that does not belong to cluster %s", osd.id, dataPath, fsid)
+			continue
+		}
+		if isOSDDataNotExist(dataPath) {
+			logger.Infof("skipping osd.%d in %s that was not completely created", osd.id, dataPath)
+			continue
+		}
+
+		if found != nil {
+			return nil, fmt.Errorf("found osd.%d and osd.%d in %s. only one osd per directory can be adopted", found.id, osd.id, configRoot)
+		}
+		found = osd
+	}
+
+	return found, nil
+}
+
+// adoptOSD prepares the existing osd to be run from the osd root dir that rook expects
+func adoptOSD(cfg *osdConfig, osd *existingOSD) error {
+	expectedType := config.Filestore
+	if cfg.storeConfig.StoreType == config.Bluestore {
+		expectedType = config.Bluestore
+	}
+	if osd.storeType != expectedType {
+		return fmt.Errorf("osd.%d in %s is %s but the directory is configured for %s", osd.id, osd.path, osd.storeType, expectedType)
+	}
+
+	rootPath := getOSDRootDir(cfg.configRoot, osd.id)
+	if rootPath != osd.path {
+		// link the ceph data dir to the rook data dir so the osd data is left in place
+		if err := os.Symlink(filepath.Base(osd.path), rootPath); err != nil {
+			return fmt.Errorf("failed to link %s to %s. %+v", rootPath, osd.path, err)
+		}
+	}
+
+	logger.Infof("adopted osd.%d (%s) in %s", osd.id, osd.uuid.String(), osd.path)
+	cfg.id = osd.id
+	cfg.uuid = osd.uuid
+	return nil
+}
+
+// rejectDeviceOSDs returns an error if one of the desired devices has the partitions of an osd created by ceph-disk.
+// Only the osds in directories are adopted. An osd on a device is adopted by mounting its data partition in a
+// directory of the node, so the protected devices with a mounted partition are skipped as devices in use.
+func rejectDeviceOSDs(context *clusterd.Context, desiredDevices string, usingDeviceFilter bool, attributes *rookalpha.DeviceAttributes,
+	protected map[string]string) error {
+	for _, device := range context.Devices {
+		if device.Type == sys.PartType {
+			continue
+		}
+		if _, ok := protected[device.Name]; ok {
+			continue
+		}
+		if selected, err := deviceSelected(device, desiredDevices, usingDeviceFilter, attributes); err != nil || !selected {
+			continue
+		}
+		partitions, _, err := sys.GetDevicePartitions(device.Name, context.Executor)
+		if err != nil {
+			return fmt.Errorf("failed to get the partitions of device %s. %+v", device.Name, err)
+		}
+		for _, p := range partitions {
+			// udev escapes the spaces of the labels
+			label := strings.Replace(p.Label, `\x20`, " ", -1)
+			if strings.HasPrefix(label, cephDiskPartitionPrefix) {
+				return fmt.Errorf("device %s has partition %s (%s) of an existing osd. the osds on devices cannot be adopted. "+
+					"mount the data partition of the osd in a directory with adoptExisting, or remove the device from the osds of the node",
+					device.Name, p.Name, label)
+			}
+		}
+	}
+	return nil
+}
+
+func loadExistingOSD(dataPath string) (*existingOSD, error) {
+	whoami, err := readOSDDataFile(dataPath, "whoami")
+	if err != nil {
+		return nil, err
+	}
+	id, err := strconv.Atoi(whoami)
+	if err != nil {
+		return nil, fmt.Errorf("invalid osd id %s. %+v", whoami, err)
+	}
+
+	name := filepath.Base(dataPath)
+	if name != fmt.Sprintf("osd%d", id) && !strings.HasSuffix(name, fmt.Sprintf("-%d", id)) {
+		return nil, fmt.Errorf("dir name does not match osd.%d", id)
+	}
+
+	fsid, err := readOSDDataFile(dataPath, "fsid")
+	if err != nil {
+		return nil, err
+	}
+	osdUUID, err := uuid.Parse(fsid)
+	if err != nil {
+		return nil, fmt.Errorf("invalid osd uuid %s. %+v", fsid, err)
+	}
+
+	// older filestore osds do not have a type file
+	storeType, err := readOSDDataFile(dataPath, "type")
+	if err != nil {
+		storeType = config.Filestore
+	}
+
+	return &existingOSD{path: dataPath, id: id, uuid: osdUUID, storeType: storeType}, nil
+}
+
+func readOSDDataFile(dataPath, name string) (string, error) {
+	content, err := ioutil.ReadFile(filepath.Join(dataPath, name))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(content)), nil
+}
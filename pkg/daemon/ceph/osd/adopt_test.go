@@ -0,0 +1,142 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package osd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rook/rook/pkg/clusterd"
+	"github.com/rook/rook/pkg/operator/ceph/cluster/osd/config"
+	exectest "github.com/rook/rook/pkg/util/exec/test"
+	"github.com/rook/rook/pkg/util/sys"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testClusterFSID = "4e7c3cbc-2a54-4c6d-b4b3-dd7ec8f0bd48"
+	testOSDUUID     = "8fbd28c4-73a6-4df1-8b0d-4b2e1b3bc5f6"
+)
+
+func createExistingOSD(t *testing.T, dataPath, id, clusterFSID string) {
+	assert.Nil(t, os.MkdirAll(dataPath, 0755))
+	files := map[string]string{"whoami": id + "\n", "fsid": testOSDUUID + "\n", "ceph_fsid": clusterFSID + "\n", "ready": "ready\n", "type": "filestore\n"}
+	for name, content := range files {
+		assert.Nil(t, ioutil.WriteFile(filepath.Join(dataPath, name), []byte(content), 0644))
+	}
+}
+
+func TestFindExistingOSD(t *testing.T) {
+	configRoot, _ := ioutil.TempDir("", "")
+	defer os.RemoveAll(configRoot)
+
+	// an empty dir has no osd to adopt
+	osd, err := findExistingOSD(configRoot, testClusterFSID)
+	assert.Nil(t, err)
+	assert.Nil(t, osd)
+
+	// an osd of another cluster is ignored
+	createExistingOSD(t, filepath.Join(configRoot, "ceph-2"), "2", "other-fsid")
+	osd, err = findExistingOSD(configRoot, testClusterFSID)
+	assert.Nil(t, err)
+	assert.Nil(t, osd)
+
+	// an osd of the cluster is found
+	createExistingOSD(t, filepath.Join(configRoot, "ceph-3"), "3", testClusterFSID)
+	osd, err = findExistingOSD(configRoot, testClusterFSID)
+	assert.Nil(t, err)
+	assert.NotNil(t, osd)
+	assert.Equal(t, 3, osd.id)
+	assert.Equal(t, testOSDUUID, osd.uuid.String())
+	assert.Equal(t, config.Filestore, osd.storeType)
+
+	// an osd that was not completely created is ignored
+	os.Remove(filepath.Join(configRoot, "ceph-3", "ready"))
+	osd, err = findExistingOSD(configRoot, testClusterFSID)
+	assert.Nil(t, err)
+	assert.Nil(t, osd)
+
+	// only one osd per dir can be adopted
+	createExistingOSD(t, filepath.Join(configRoot, "ceph-3"), "3", testClusterFSID)
+	createExistingOSD(t, filepath.Join(configRoot, "ceph-4"), "4", testClusterFSID)
+	_, err = findExistingOSD(configRoot, testClusterFSID)
+	assert.NotNil(t, err)
+}
+
+func TestAdoptOSD(t *testing.T) {
+	configRoot, _ := ioutil.TempDir("", "")
+	defer os.RemoveAll(configRoot)
+	createExistingOSD(t, filepath.Join(configRoot, "ceph-3"), "3", testClusterFSID)
+	osd, err := findExistingOSD(configRoot, testClusterFSID)
+	assert.Nil(t, err)
+
+	// the store type must match the configured store
+	cfg := &osdConfig{id: unassignedOSDID, configRoot: configRoot, dir: true, storeConfig: config.StoreConfig{StoreType: config.Bluestore}}
+	err = adoptOSD(cfg, osd)
+	assert.NotNil(t, err)
+	assert.Equal(t, unassignedOSDID, cfg.id)
+
+	cfg.storeConfig.StoreType = ""
+	err = adoptOSD(cfg, osd)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, cfg.id)
+	assert.Equal(t, testOSDUUID, cfg.uuid.String())
+
+	// the rook osd dir links to the existing data
+	assert.False(t, isOSDDataNotExist(getOSDRootDir(configRoot, 3)))
+	whoami, err := readOSDDataFile(getOSDRootDir(configRoot, 3), "whoami")
+	assert.Nil(t, err)
+	assert.Equal(t, "3", whoami)
+}
+
+func TestRejectDeviceOSDs(t *testing.T) {
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithOutput: func(debug bool, name string, command string, args ...string) (string, error) {
+			switch {
+			case command == "lsblk" && strings.Contains(name, "sdb"):
+				return `NAME="sdb" SIZE="65" TYPE="disk" PKNAME=""
+NAME="sdb1" SIZE="30" TYPE="part" PKNAME="sdb"`, nil
+			case command == "lsblk":
+				return "", nil
+			case command == "udevadm" && strings.Contains(name, "sdb1"):
+				return `ID_PART_ENTRY_NAME=ceph\x20data`, nil
+			}
+			return "", fmt.Errorf("unknown command %s %+v", command, args)
+		},
+	}
+	context := &clusterd.Context{Executor: executor}
+	context.Devices = []*sys.LocalDisk{{Name: "sda"}, {Name: "sdb"}, {Name: "sdb1", Type: sys.PartType}}
+
+	// the devices that are not desired are not checked
+	assert.Nil(t, rejectDeviceOSDs(context, "sda", false, nil, nil))
+	assert.Nil(t, rejectDeviceOSDs(context, "", false, nil, nil))
+
+	// an osd created by ceph-disk on a desired device is rejected
+	err := rejectDeviceOSDs(context, "sda,sdb", false, nil, nil)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "ceph data")
+	assert.NotNil(t, rejectDeviceOSDs(context, "all", false, nil, nil))
+	assert.NotNil(t, rejectDeviceOSDs(context, "^sd.$", true, nil, nil))
+
+	// a device with the data partition mounted to be adopted from its directory is skipped as in use
+	protected := map[string]string{"sdb": "/var/lib/ceph/osd/ceph-3"}
+	assert.Nil(t, rejectDeviceOSDs(context, "all", false, nil, protected))
+	assert.Nil(t, rejectDeviceOSDs(context, "^sd.$", true, nil, protected))
+}
@@ -26,6 +26,7 @@ import (
 
 	"github.com/google/uuid"
 
+	rookalpha "github.com/rook/rook/pkg/apis/rook.io/v1alpha2"
 	"github.com/rook/rook/pkg/clusterd"
 	"github.com/rook/rook/pkg/daemon/ceph/mon"
 	oposd "github.com/rook/rook/pkg/operator/ceph/cluster/osd"
@@ -51,8 +52,10 @@ type OsdAgent struct {
 	osdProc           map[int]*proc.MonitoredProc
 	devices           string
 	usingDeviceFilter bool
+	deviceAttributes  *rookalpha.DeviceAttributes
 	metadataDevice    string
 	directories       string
+	protectedOverride string
 	procMan           *proc.ProcManager
 	storeConfig       config.StoreConfig
 	kv                *k8sutil.ConfigMapKVStore
@@ -60,14 +63,16 @@ type OsdAgent struct {
 	osdsCompleted     chan struct{}
 }
 
-func NewAgent(context *clusterd.Context, devices string, usingDeviceFilter bool, metadataDevice, directories string, forceFormat bool,
+func NewAgent(context *clusterd.Context, devices string, usingDeviceFilter bool, deviceAttributes *rookalpha.DeviceAttributes, metadataDevice, directories, protectedOverride string, forceFormat bool,
 	location string, storeConfig config.StoreConfig, cluster *mon.ClusterInfo, nodeName string, kv *k8sutil.ConfigMapKVStore) *OsdAgent {
 
 	return &OsdAgent{
 		devices:           devices,
 		usingDeviceFilter: usingDeviceFilter,
+		deviceAttributes:  deviceAttributes,
 		metadataDevice:    metadataDevice,
 		directories:       directories,
+		protectedOverride: protectedOverride,
 		forceFormat:       forceFormat,
 		location:          location,
 		storeConfig:       storeConfig,
@@ -91,6 +96,20 @@ func (a *OsdAgent) configureDirs(context *clusterd.Context, dirs map[string]int)
 		config := &osdConfig{id: osdID, configRoot: dirPath, dir: true, storeConfig: a.storeConfig,
 			kv: a.kv, storeName: config.GetConfigStoreName(a.nodeName)}
 
+		if config.id == unassignedOSDID && a.storeConfig.AdoptExisting {
+			// look for an osd of this cluster that was created outside of rook in the dir
+			existing, err := findExistingOSD(dirPath, a.cluster.FSID)
+			if err != nil {
+				return osds, err
+			}
+			if existing != nil {
+				if err := adoptOSD(config, existing); err != nil {
+					return osds, err
+				}
+				dirs[dirPath] = config.id
+			}
+		}
+
 		if config.id == unassignedOSDID {
 			// the osd hasn't been registered with ceph yet, do so now to give it a cluster wide ID
 			osdID, osdUUID, err := registerOSD(context, a.cluster.Name)
@@ -279,6 +298,13 @@ func (a *OsdAgent) getPartitionPerfScheme(context *clusterd.Context, devices *De
 			schemeEntry := config.NewPerfSchemeEntry(a.storeConfig.StoreType)
 			schemeEntry.ID = *osdID
 			schemeEntry.OsdUUID = *osdUUID
+			if schemeEntry.StoreType == config.Filestore {
+				schemeEntry.Filesystem = a.storeConfig.FilestoreFilesystem
+				if schemeEntry.Filesystem == "" {
+					schemeEntry.Filesystem = sys.Ext4FS
+				}
+				schemeEntry.MountOptions = a.storeConfig.FilestoreMountOptions
+			}
 
 			if metadataEntry != nil && perfScheme.Metadata != nil {
 				// we have a metadata device, so put the metadata partitions on it and the data partition on its own disk
@@ -488,6 +514,10 @@ func getOSDInfo(clusterName string, config *osdConfig, devPartInfo *devicePartIn
 	if devPartInfo != nil {
 		osd.DevicePartUUID = devPartInfo.deviceUUID
 	}
+	if isFilestoreDevice(config) {
+		osd.Filesystem = config.partitionScheme.Filesystem
+		osd.MountOptions = config.partitionScheme.MountOptions
+	}
 
 	if isFilestore(config) {
 		osd.Journal = getOSDJournalPath(config.rootPath)
@@ -21,9 +21,12 @@ import (
 
 	"github.com/rook/rook/pkg/clusterd"
 	"github.com/rook/rook/pkg/operator/ceph/cluster/osd/config"
+	"github.com/rook/rook/pkg/operator/k8sutil"
 	"github.com/rook/rook/pkg/util"
 	exectest "github.com/rook/rook/pkg/util/exec/test"
 	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
 )
 
 func TestCrushMap(t *testing.T) {
@@ -71,3 +74,27 @@ func testCrushMapHelper(t *testing.T, storeConfig *config.StoreConfig) {
 	err := addOSDToCrushMap(context, cfg, "rook", location)
 	assert.Nil(t, err)
 }
+
+func TestInitialCrushWeight(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	cfg := &osdConfig{id: 23, kv: k8sutil.NewConfigMapKVStore("rook", clientset, metav1.OwnerReference{})}
+
+	// the size of the osd is its weight unless the weight is set
+	weight, err := initialCrushWeight(cfg, "osd.23", 1.5)
+	assert.Nil(t, err)
+	assert.Equal(t, 1.5, weight)
+
+	cfg.storeConfig.CrushWeight = 0.5
+	weight, err = initialCrushWeight(cfg, "osd.23", 1.5)
+	assert.Nil(t, err)
+	assert.Equal(t, 0.5, weight)
+
+	// the osd starts with a zero weight when it is weighted in gradually
+	cfg.storeConfig.GradualWeightIn = true
+	weight, err = initialCrushWeight(cfg, "osd.23", 1.5)
+	assert.Nil(t, err)
+	assert.Equal(t, 0.0, weight)
+	cm, err := clientset.CoreV1().ConfigMaps("rook").Get(config.WeightConfigMapName, metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, "0.5000", cm.Data["osd.23"])
+}
@@ -23,10 +23,13 @@ import (
 	"strings"
 
 	"github.com/coreos/pkg/capnslog"
+	rookalpha "github.com/rook/rook/pkg/apis/rook.io/v1alpha2"
 	"github.com/rook/rook/pkg/clusterd"
+	"github.com/rook/rook/pkg/daemon/ceph/client"
 	"github.com/rook/rook/pkg/daemon/ceph/mon"
 	oposd "github.com/rook/rook/pkg/operator/ceph/cluster/osd"
 	"github.com/rook/rook/pkg/operator/ceph/cluster/osd/config"
+	"github.com/rook/rook/pkg/operator/discover"
 	"github.com/rook/rook/pkg/operator/k8sutil"
 	"github.com/rook/rook/pkg/util/sys"
 	"k8s.io/apimachinery/pkg/api/errors"
@@ -34,14 +37,17 @@ import (
 
 var (
 	logger = capnslog.NewPackageLogger("github.com/rook/rook", "cephosd")
+	// the mounts of the host, to never format the boot disk or a device with a mounted filesystem
+	hostMountInfoFile = sys.HostMountInfoFile
+	hostDevBlockDir   = sys.DevBlockDir
 )
 
-func RunFilestoreOnDevice(context *clusterd.Context, mountSourcePath, mountPath string, cephArgs []string) error {
+func RunFilestoreOnDevice(context *clusterd.Context, mountSourcePath, mountPath, fstype, mountOptions string, cephArgs []string) error {
 
 	// start the OSD daemon in the foreground with the given config
 	logger.Infof("starting filestore osd on a device")
 
-	if err := sys.MountDevice(mountSourcePath, mountPath, context.Executor); err != nil {
+	if err := sys.MountDeviceWithOptions(mountSourcePath, mountPath, fstype, mountOptions, context.Executor); err != nil {
 		return fmt.Errorf("failed to mount device. %+v", err)
 	}
 	// unmount the device before exit
@@ -55,6 +61,15 @@ func RunFilestoreOnDevice(context *clusterd.Context, mountSourcePath, mountPath
 	return nil
 }
 
+// Run runs the osd daemon in the foreground with the given config
+func Run(context *clusterd.Context, cephArgs []string) error {
+	logger.Infof("starting osd")
+	if err := context.Executor.ExecuteCommand(false, "ceph-osd", "ceph-osd", cephArgs...); err != nil {
+		return fmt.Errorf("failed to start osd. %+v", err)
+	}
+	return nil
+}
+
 func Provision(context *clusterd.Context, agent *OsdAgent) error {
 
 	// set the initial orchestration status
@@ -72,6 +87,10 @@ func Provision(context *clusterd.Context, agent *OsdAgent) error {
 		return fmt.Errorf("failed to write connection config. %+v", err)
 	}
 
+	if err := sys.ValidateFilesystem(agent.storeConfig.FilestoreFilesystem); err != nil {
+		return fmt.Errorf("invalid filestore filesystem. %+v", err)
+	}
+
 	logger.Infof("discovering hardware")
 	rawDevices, err := clusterd.DiscoverDevices(context.Executor)
 	if err != nil {
@@ -81,8 +100,21 @@ func Provision(context *clusterd.Context, agent *OsdAgent) error {
 
 	logger.Infof("creating and starting the osds")
 
+	// the devices with a mounted filesystem are refused unless they are overridden
+	protected, err := getProtectedDevices(context, agent.protectedOverride)
+	if err != nil {
+		return fmt.Errorf("failed to get the protected devices. %+v", err)
+	}
+
+	if agent.storeConfig.AdoptExisting {
+		// the osds on devices are not adopted, and would otherwise be skipped as devices in use
+		if err := rejectDeviceOSDs(context, agent.devices, agent.usingDeviceFilter, agent.deviceAttributes, protected); err != nil {
+			return err
+		}
+	}
+
 	// determine the set of devices that can/should be used for OSDs.
-	devices, err := getAvailableDevices(context, agent.devices, agent.metadataDevice, agent.usingDeviceFilter)
+	devices, err := getAvailableDevices(context, agent.devices, agent.deviceAttributes, agent.metadataDevice, agent.usingDeviceFilter, protected)
 	if err != nil {
 		return fmt.Errorf("failed to get available devices. %+v", err)
 	}
@@ -93,6 +125,15 @@ func Provision(context *clusterd.Context, agent *OsdAgent) error {
 		return fmt.Errorf("failed to get removed devices: %+v", err)
 	}
 
+	// purge the osds of the devices that were swapped in place so that the new devices are provisioned as new osds
+	var replacedOSDs []int
+	if agent.storeConfig.ReplaceSwapped {
+		replacedOSDs, err = replaceSwappedDevices(context, agent)
+		if err != nil {
+			return fmt.Errorf("failed to replace swapped devices. %+v", err)
+		}
+	}
+
 	// determine the set of directories that can/should be used for OSDs, with the default dir if no devices were specified.  save off the node's crush name if needed.
 	devicesSpecified := len(agent.devices) > 0
 	dirs, removedDirs, err := getDataDirs(context, agent.kv, agent.directories, devicesSpecified, agent.nodeName)
@@ -140,7 +181,7 @@ func Provision(context *clusterd.Context, agent *OsdAgent) error {
 	osds := append(deviceOSDs, dirOSDs...)
 
 	// orchestration is completed, update the status
-	status = oposd.OrchestrationStatus{OSDs: osds, Status: oposd.OrchestrationStatusCompleted}
+	status = oposd.OrchestrationStatus{OSDs: osds, Replaced: replacedOSDs, Status: oposd.OrchestrationStatusCompleted}
 	if err := oposd.UpdateNodeStatus(agent.kv, agent.nodeName, status); err != nil {
 		return err
 	}
@@ -148,12 +189,26 @@ func Provision(context *clusterd.Context, agent *OsdAgent) error {
 	return nil
 }
 
-func getAvailableDevices(context *clusterd.Context, desiredDevices string, metadataDevice string, usingDeviceFilter bool) (*DeviceOsdMapping, error) {
-
-	var deviceList []string
-	if !usingDeviceFilter {
-		deviceList = strings.Split(desiredDevices, ",")
+// getProtectedDevices returns the mount point of the devices that must not be formatted, such as the boot disk. The
+// overridden devices are not returned, so they can be used even though they have a mounted filesystem.
+func getProtectedDevices(context *clusterd.Context, overrides string) (map[string]string, error) {
+	protected, err := sys.GetMountedDevices(hostMountInfoFile, hostDevBlockDir, context.Executor)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range strings.Split(overrides, ",") {
+		for _, device := range context.Devices {
+			if _, ok := protected[device.Name]; ok && device.MatchesID(name) {
+				logger.Warningf("device %s is mounted at %s but is overridden to be used by an osd", device.Name, protected[device.Name])
+				delete(protected, device.Name)
+			}
+		}
 	}
+	return protected, nil
+}
+
+func getAvailableDevices(context *clusterd.Context, desiredDevices string, attributes *rookalpha.DeviceAttributes, metadataDevice string,
+	usingDeviceFilter bool, protected map[string]string) (*DeviceOsdMapping, error) {
 
 	available := &DeviceOsdMapping{Entries: map[string]*DeviceOsdIDEntry{}}
 
@@ -166,6 +221,11 @@ func getAvailableDevices(context *clusterd.Context, desiredDevices string, metad
 		if device.Type == sys.PartType {
 			continue
 		}
+		if mountpoint, ok := protected[device.Name]; ok {
+			// never format the boot disk or a device with a mounted filesystem, even if it is listed
+			logger.Warningf("skipping device %s that is mounted at %s", device.Name, mountpoint)
+			continue
+		}
 		ownPartitions, fs, err := sys.CheckIfDeviceAvailable(context.Executor, device.Name)
 		if err != nil {
 			return nil, fmt.Errorf("failed to get device %s info. %+v", device.Name, err)
@@ -177,27 +237,11 @@ func getAvailableDevices(context *clusterd.Context, desiredDevices string, metad
 			continue
 		}
 
-		if metadataDevice != "" && metadataDevice == device.Name {
+		if device.MatchesID(metadataDevice) {
 			// current device is desired as the metadata device
 			available.Entries[device.Name] = &DeviceOsdIDEntry{Data: unassignedOSDID, Metadata: []int{}}
-		} else if desiredDevices == "all" {
-			// user has specified all devices, use the current one for data
-			available.Entries[device.Name] = &DeviceOsdIDEntry{Data: unassignedOSDID}
 		} else if desiredDevices != "" {
-			var matched bool
-			var err error
-			if usingDeviceFilter {
-				// the desired devices is a regular expression
-				matched, err = regexp.Match(desiredDevices, []byte(device.Name))
-			} else {
-				for i := range deviceList {
-					if device.Name == deviceList[i] {
-						matched = true
-						break
-					}
-				}
-			}
-
+			matched, err := deviceSelected(device, desiredDevices, usingDeviceFilter, attributes)
 			if err == nil && matched {
 				// the current device matches the user specifies filter/list, use it for data
 				available.Entries[device.Name] = &DeviceOsdIDEntry{Data: unassignedOSDID}
@@ -212,6 +256,29 @@ func getAvailableDevices(context *clusterd.Context, desiredDevices string, metad
 	return available, nil
 }
 
+// deviceSelected returns whether the device is one of the desired devices, which are either all the devices, a regular
+// expression if a filter is used, or a list of device names and persistent ids. All the devices and the devices of the
+// filter must also match the attributes, as they do in the operator.
+func deviceSelected(device *sys.LocalDisk, desiredDevices string, usingDeviceFilter bool, attributes *rookalpha.DeviceAttributes) (bool, error) {
+	if desiredDevices == "all" {
+		return discover.MatchesAttributes(*device, attributes), nil
+	}
+	if desiredDevices == "" {
+		return false, nil
+	}
+	if usingDeviceFilter {
+		matched, err := regexp.Match(desiredDevices, []byte(device.Name))
+		return err == nil && matched && discover.MatchesAttributes(*device, attributes), err
+	}
+	for _, id := range strings.Split(desiredDevices, ",") {
+		// the desired devices may be given by name or by a persistent id that is resolved to the current name
+		if device.MatchesID(id) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
 func getDataDirs(context *clusterd.Context, kv *k8sutil.ConfigMapKVStore, desiredDirs string,
 	devicesSpecified bool, nodeName string) (dirs, removedDirs map[string]int, err error) {
 
@@ -294,6 +361,82 @@ func getRemovedDevices(agent *OsdAgent) (*config.PerfScheme, *DeviceOsdMapping,
 	return removedDevicesScheme, removedDevicesMapping, nil
 }
 
+// findSwappedDevices returns the entries of the scheme whose device is still present under the same name, but with a
+// different disk UUID. The disk was then swapped in place and the osd of the entry lost its data. A disk UUID that is
+// empty, either in the entry or on the device, is unknown and the device is not considered swapped.
+func findSwappedDevices(devices []*sys.LocalDisk, scheme *config.PerfScheme) []*config.PerfSchemeEntry {
+	names := map[string]string{}
+	uuids := map[string]bool{}
+	for _, device := range devices {
+		names[device.Name] = device.UUID
+		if device.UUID != "" {
+			uuids[device.UUID] = true
+		}
+	}
+
+	swapped := []*config.PerfSchemeEntry{}
+	for _, entry := range scheme.Entries {
+		dataDetails, ok := entry.Partitions[entry.GetDataPartitionType()]
+		if !ok || dataDetails == nil || dataDetails.DiskUUID == "" || uuids[dataDetails.DiskUUID] {
+			continue
+		}
+		if uuid, ok := names[dataDetails.Device]; !ok || uuid == "" {
+			continue
+		}
+		if !entry.IsCollocated() {
+			// the metadata of the osd is on another device that would need to be cleaned up as well
+			logger.Warningf("device %s of osd.%d was swapped, but the osd is not replaced since its metadata is on another device",
+				dataDetails.Device, entry.ID)
+			continue
+		}
+		swapped = append(swapped, entry)
+	}
+	return swapped
+}
+
+// replaceSwappedDevices purges the osds of the devices that were swapped in place and removes them from the scheme of
+// the node. The osds that are still up are left alone. Returns the ids of the purged osds.
+func replaceSwappedDevices(context *clusterd.Context, agent *OsdAgent) ([]int, error) {
+	storeName := config.GetConfigStoreName(agent.nodeName)
+	scheme, err := config.LoadScheme(agent.kv, storeName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load agent's partition scheme: %+v", err)
+	}
+	swapped := findSwappedDevices(context.Devices, scheme)
+	if len(swapped) == 0 {
+		return nil, nil
+	}
+
+	osdDump, err := client.GetOSDDump(context, agent.cluster.Name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get osd dump. %+v", err)
+	}
+
+	replaced := []int{}
+	for _, entry := range swapped {
+		device := entry.Partitions[entry.GetDataPartitionType()].Device
+		up, _, err := osdDump.StatusByID(int64(entry.ID))
+		if err == nil && up == 1 {
+			logger.Warningf("device %s of osd.%d was swapped, but the osd is still up. not replacing it", device, entry.ID)
+			continue
+		}
+
+		logger.Infof("device %s of osd.%d was swapped. purging the osd", device, entry.ID)
+		if err := oposd.PurgeOSD(context, agent.cluster.Name, entry.ID); err != nil {
+			return replaced, fmt.Errorf("failed to purge osd.%d. %+v", entry.ID, err)
+		}
+		if err := agent.removeOSDConfigDir(context.ConfigDir, entry.ID); err != nil {
+			return replaced, fmt.Errorf("failed to remove the config of osd.%d. %+v", entry.ID, err)
+		}
+		if err := config.RemoveFromScheme(entry, agent.kv, storeName); err != nil {
+			return replaced, fmt.Errorf("failed to remove osd.%d from scheme. %+v", entry.ID, err)
+		}
+		logger.Infof("purged osd.%d. a new osd will be provisioned on device %s", entry.ID, device)
+		replaced = append(replaced, entry.ID)
+	}
+	return replaced, nil
+}
+
 func getActiveAndRemovedDirs(currentDirList []string, savedDirMap map[string]int) (activeDirs, removedDirs map[string]int) {
 	activeDirs = map[string]int{}
 	removedDirs = map[string]int{}
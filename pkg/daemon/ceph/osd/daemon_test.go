@@ -19,9 +19,11 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path"
 	"strings"
 	"testing"
 
+	rookalpha "github.com/rook/rook/pkg/apis/rook.io/v1alpha2"
 	"github.com/rook/rook/pkg/clusterd"
 	"github.com/rook/rook/pkg/operator/ceph/cluster/osd/config"
 	exectest "github.com/rook/rook/pkg/util/exec/test"
@@ -69,6 +71,10 @@ func TestRunDaemon(t *testing.T) {
 
 	agent, _, context := createTestAgent(t, "none", configDir, "node5375", &config.StoreConfig{StoreType: config.Bluestore})
 	agent.usingDeviceFilter = true
+	mounts := path.Join(configDir, "mounts")
+	assert.Nil(t, ioutil.WriteFile(mounts, []byte{}, 0644))
+	hostMountInfoFile = mounts
+	defer func() { hostMountInfoFile = sys.HostMountInfoFile }()
 
 	err := Provision(context, agent)
 	assert.Nil(t, err)
@@ -203,14 +209,14 @@ NAME="sdb1" SIZE="30" TYPE="part" PKNAME="sdb"`, nil
 		{Name: "sda"},
 		{Name: "sdb"},
 		{Name: "sdc"},
-		{Name: "sdd"},
+		{Name: "sdd", Serial: "disk-sdd", DevLinks: "/dev/disk/by-id/wwn-0x6001405d27e5d898"},
 		{Name: "nvme01"},
 		{Name: "rda"},
 		{Name: "rdb"},
 	}
 
 	// select all devices, including nvme01 for metadata
-	mapping, err := getAvailableDevices(context, "all", "nvme01", true)
+	mapping, err := getAvailableDevices(context, "all", nil, "nvme01", true, nil)
 	assert.Nil(t, err)
 	assert.Equal(t, 5, len(mapping.Entries))
 	assert.Equal(t, -1, mapping.Entries["sda"].Data)
@@ -222,34 +228,114 @@ NAME="sdb1" SIZE="30" TYPE="part" PKNAME="sdb"`, nil
 	assert.Equal(t, 0, len(mapping.Entries["nvme01"].Metadata))
 
 	// select no devices both using and not using a filter
-	mapping, err = getAvailableDevices(context, "", "", false)
+	mapping, err = getAvailableDevices(context, "", nil, "", false, nil)
 	assert.Nil(t, err)
 	assert.Equal(t, 0, len(mapping.Entries))
 
-	mapping, err = getAvailableDevices(context, "", "", true)
+	mapping, err = getAvailableDevices(context, "", nil, "", true, nil)
 	assert.Nil(t, err)
 	assert.Equal(t, 0, len(mapping.Entries))
 
 	// select the sd* devices
-	mapping, err = getAvailableDevices(context, "^sd.$", "", true)
+	mapping, err = getAvailableDevices(context, "^sd.$", nil, "", true, nil)
 	assert.Nil(t, err)
 	assert.Equal(t, 2, len(mapping.Entries))
 	assert.Equal(t, -1, mapping.Entries["sda"].Data)
 	assert.Equal(t, -1, mapping.Entries["sdd"].Data)
 
+	// the devices of the filter and all the devices must also match the attributes
+	rotational := true
+	attributes := &rookalpha.DeviceAttributes{Rotational: &rotational}
+	context.Devices[0].Rotational = true
+	mapping, err = getAvailableDevices(context, "^sd.$", attributes, "", true, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(mapping.Entries))
+	assert.Equal(t, -1, mapping.Entries["sda"].Data)
+	mapping, err = getAvailableDevices(context, "all", attributes, "", true, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(mapping.Entries))
+	assert.Equal(t, -1, mapping.Entries["sda"].Data)
+	context.Devices[0].Rotational = false
+
 	// select an exact device
-	mapping, err = getAvailableDevices(context, "sdd", "", false)
+	mapping, err = getAvailableDevices(context, "sdd", nil, "", false, nil)
 	assert.Nil(t, err)
 	assert.Equal(t, 1, len(mapping.Entries))
 	assert.Equal(t, -1, mapping.Entries["sdd"].Data)
 
+	// select exact devices by their persistent ids, which are resolved to the current device names
+	mapping, err = getAvailableDevices(context, "/dev/disk/by-id/wwn-0x6001405d27e5d898,rda", nil, "disk-sdd", false, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(mapping.Entries))
+	assert.Equal(t, -1, mapping.Entries["rda"].Data)
+	assert.NotNil(t, mapping.Entries["sdd"].Metadata)
+
 	// select all devices except those that have a prefix of "s"
-	mapping, err = getAvailableDevices(context, "^[^s]", "", true)
+	mapping, err = getAvailableDevices(context, "^[^s]", nil, "", true, nil)
 	assert.Nil(t, err)
 	assert.Equal(t, 3, len(mapping.Entries))
 	assert.Equal(t, -1, mapping.Entries["rda"].Data)
 	assert.Equal(t, -1, mapping.Entries["rdb"].Data)
 	assert.Equal(t, -1, mapping.Entries["nvme01"].Data)
+
+	// the protected devices are never selected, even if they are listed
+	protected := map[string]string{"sda": "/", "rda": "/var/lib/docker"}
+	mapping, err = getAvailableDevices(context, "all", nil, "", true, protected)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(mapping.Entries))
+	assert.Nil(t, mapping.Entries["sda"])
+	assert.Nil(t, mapping.Entries["rda"])
+	mapping, err = getAvailableDevices(context, "sda,rdb", nil, "", false, protected)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(mapping.Entries))
+	assert.Equal(t, -1, mapping.Entries["rdb"].Data)
+}
+
+func TestGetProtectedDevices(t *testing.T) {
+	configDir, _ := ioutil.TempDir("", "")
+	defer os.RemoveAll(configDir)
+	mounts := path.Join(configDir, "mounts")
+	assert.Nil(t, ioutil.WriteFile(mounts, []byte("22 1 8:1 / / rw shared:1 - ext4 /dev/sda1 rw\n"+
+		"40 22 8:48 / /mnt/data rw shared:20 - xfs /dev/sdd rw\n"), 0644))
+	hostMountInfoFile = mounts
+	hostDevBlockDir = path.Join(configDir, "dev-block")
+	defer func() {
+		hostMountInfoFile = sys.HostMountInfoFile
+		hostDevBlockDir = sys.DevBlockDir
+	}()
+
+	executor := &exectest.MockExecutor{}
+	executor.MockExecuteCommandWithOutput = func(debug bool, name string, command string, args ...string) (string, error) {
+		switch name {
+		case "lsblk inverse /dev/sda1":
+			return "sda1\nsda", nil
+		case "lsblk inverse /dev/sdd":
+			return "sdd", nil
+		}
+		return "", fmt.Errorf("unknown command %s %+v", command, args)
+	}
+	context := &clusterd.Context{Executor: executor}
+	context.Devices = []*sys.LocalDisk{
+		{Name: "sda"},
+		{Name: "sdd", Serial: "disk-sdd"},
+	}
+
+	protected, err := getProtectedDevices(context, "")
+	assert.Nil(t, err)
+	assert.Equal(t, "/", protected["sda"])
+	assert.Equal(t, "/mnt/data", protected["sdd"])
+
+	// an overridden device can be used by an osd, by name or by its persistent id
+	protected, err = getProtectedDevices(context, "disk-sdd")
+	assert.Nil(t, err)
+	assert.Equal(t, "/", protected["sda"])
+	_, ok := protected["sdd"]
+	assert.False(t, ok)
+
+	// the devices cannot be provisioned if the mounts are unknown
+	hostMountInfoFile = path.Join(configDir, "missing")
+	_, err = getProtectedDevices(context, "")
+	assert.NotNil(t, err)
 }
 
 func TestGetRemovedDevices(t *testing.T) {
@@ -285,3 +371,85 @@ func testGetRemovedDevicesHelper(t *testing.T, storeConfig *config.StoreConfig)
 	assert.NotNil(t, mappingEntry)
 	assert.Equal(t, 1, mappingEntry.Data)
 }
+
+func TestReplaceSwappedDevices(t *testing.T) {
+	configDir, _ := ioutil.TempDir("", "")
+	defer os.RemoveAll(configDir)
+	os.MkdirAll(configDir, 0755)
+	nodeName := "node3391"
+	storeConfig := &config.StoreConfig{StoreType: config.Bluestore, ReplaceSwapped: true}
+	agent, _, context := createTestAgent(t, "sdx,sdy,sdz", configDir, nodeName, storeConfig)
+
+	// osd 1 on sdx and osd 3 on sdz were swapped, osd 2 on sdy was not
+	_, _, _ = mockPartitionSchemeEntry(t, 1, "sdx", &agent.storeConfig, agent.kv, nodeName)
+	scheme, err := config.LoadScheme(agent.kv, config.GetConfigStoreName(nodeName))
+	assert.Nil(t, err)
+	for i, device := range []string{"sdy", "sdz"} {
+		entry := config.NewPerfSchemeEntry(config.Bluestore)
+		entry.ID = i + 2
+		config.PopulateCollocatedPerfSchemeEntry(entry, device, *storeConfig)
+		scheme.Entries = append(scheme.Entries, entry)
+	}
+	assert.Nil(t, scheme.SaveScheme(agent.kv, config.GetConfigStoreName(nodeName)))
+	sdyUUID := scheme.Entries[1].Partitions[config.BlockPartitionType].DiskUUID
+	context.Devices = []*sys.LocalDisk{{Name: "sdx", UUID: "new-sdx"}, {Name: "sdy", UUID: sdyUUID}, {Name: "sdz"}}
+
+	purged := []string{}
+	context.Executor = &exectest.MockExecutor{
+		MockExecuteCommandWithOutputFile: func(debug bool, actionName string, command string, outFileArg string, args ...string) (string, error) {
+			if args[0] == "osd" && args[1] == "dump" {
+				return `{"osds":[{"osd":1,"up":0,"in":0},{"osd":2,"up":1,"in":1},{"osd":3,"up":1,"in":1}]}`, nil
+			}
+			if args[0] == "osd" && args[1] == "rm" {
+				purged = append(purged, args[2])
+			}
+			return "", nil
+		},
+	}
+
+	// only osd 1 is replaced since osd 3 is still up
+	replaced, err := replaceSwappedDevices(context, agent)
+	assert.Nil(t, err)
+	assert.Equal(t, []int{1}, replaced)
+	assert.Equal(t, []string{"1"}, purged)
+
+	scheme, err = config.LoadScheme(agent.kv, config.GetConfigStoreName(nodeName))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(scheme.Entries))
+	assert.Equal(t, 2, scheme.Entries[0].ID)
+	assert.Equal(t, 3, scheme.Entries[1].ID)
+
+	// nothing is replaced once the swapped devices were purged
+	context.Devices[2].UUID = scheme.Entries[1].Partitions[config.BlockPartitionType].DiskUUID
+	replaced, err = replaceSwappedDevices(context, agent)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(replaced))
+}
+
+func TestFindSwappedDevices(t *testing.T) {
+	storeConfig := config.StoreConfig{StoreType: config.Bluestore}
+	scheme := config.NewPerfScheme()
+	for i, device := range []string{"sda", "sdb", "sdc"} {
+		entry := config.NewPerfSchemeEntry(config.Bluestore)
+		entry.ID = i
+		config.PopulateCollocatedPerfSchemeEntry(entry, device, storeConfig)
+		scheme.Entries = append(scheme.Entries, entry)
+	}
+	sdaUUID := scheme.Entries[0].Partitions[config.BlockPartitionType].DiskUUID
+	devices := []*sys.LocalDisk{{Name: "sda", UUID: sdaUUID}, {Name: "sdb", UUID: "new-sdb"}, {Name: "sdc", UUID: "new-sdc"}}
+
+	swapped := findSwappedDevices(devices, scheme)
+	assert.Equal(t, 2, len(swapped))
+	assert.Equal(t, 1, swapped[0].ID)
+	assert.Equal(t, 2, swapped[1].ID)
+
+	// a device with an unknown uuid is not swapped
+	devices[1].UUID = ""
+	swapped = findSwappedDevices(devices, scheme)
+	assert.Equal(t, 1, len(swapped))
+	assert.Equal(t, 2, swapped[0].ID)
+
+	// an osd without a recorded uuid is not swapped
+	scheme.Entries[2].Partitions[config.BlockPartitionType].DiskUUID = ""
+	assert.Equal(t, 0, len(findSwappedDevices(devices, scheme)))
+}
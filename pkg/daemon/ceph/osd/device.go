@@ -21,7 +21,6 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
-	"syscall"
 	"time"
 
 	"github.com/google/uuid"
@@ -255,18 +254,21 @@ func prepareFilestoreDevice(context *clusterd.Context, cfg *osdConfig, doFormat
 
 	if doFormat {
 		// perform the format and retry if needed
-		if err = sys.FormatDevice(dataPartPath, context.Executor); err != nil {
+		fstype := cfg.partitionScheme.Filesystem
+		mkfsOptions := cfg.storeConfig.FilestoreMkfsOptions
+		if err = sys.FormatDeviceWithOptions(dataPartPath, fstype, mkfsOptions, context.Executor); err != nil {
 			logger.Warningf("first attempt to format partition %s on device %s failed.  Waiting 2 seconds then retrying: %+v",
 				dataPartDetails.PartitionUUID, dataPartDetails.Device, err)
 			<-time.After(2 * time.Second)
-			if err = sys.FormatDevice(dataPartPath, context.Executor); err != nil {
+			if err = sys.FormatDeviceWithOptions(dataPartPath, fstype, mkfsOptions, context.Executor); err != nil {
 				return nil, fmt.Errorf("failed to format partition %s on device %s. %+v", dataPartDetails.PartitionUUID, dataPartDetails.Device, err)
 			}
 		}
 	}
 
-	// mount the device
-	if err = sys.MountDevice(dataPartPath, cfg.rootPath, context.Executor); err != nil {
+	// mount the device with the filesystem and options it was created with
+	err = sys.MountDeviceWithOptions(dataPartPath, cfg.rootPath, cfg.partitionScheme.Filesystem, cfg.partitionScheme.MountOptions, context.Executor)
+	if err != nil {
 		return nil, fmt.Errorf("failed to mount %s at %s: %+v", dataPartPath, cfg.rootPath, context.Executor)
 	}
 
@@ -632,6 +634,10 @@ func addOSDToCrushMap(context *clusterd.Context, config *osdConfig, clusterName,
 	weight, _ = strconv.ParseFloat(fmt.Sprintf("%.4f", weight), 64)
 
 	osdEntity := fmt.Sprintf("osd.%d", osdID)
+	weight, err = initialCrushWeight(config, osdEntity, weight)
+	if err != nil {
+		return err
+	}
 	logger.Infof("adding %s (%s), bytes: %d, weight: %.4f, to crush map at '%s'",
 		osdEntity, osdDataPath, totalBytes, weight, location)
 	args := []string{"osd", "crush", "create-or-move", strconv.Itoa(osdID), fmt.Sprintf("%.4f", weight)}
@@ -644,6 +650,26 @@ func addOSDToCrushMap(context *clusterd.Context, config *osdConfig, clusterName,
 	return nil
 }
 
+// initialCrushWeight returns the weight the new osd is added to the crush map with. With a gradual weight-in the osd
+// is added with a zero weight, and its target weight is saved for the operator to raise the weight in steps.
+func initialCrushWeight(cfg *osdConfig, osdEntity string, sizeWeight float64) (float64, error) {
+	weight := sizeWeight
+	if cfg.storeConfig.CrushWeight > 0 {
+		weight = cfg.storeConfig.CrushWeight
+	}
+	if !cfg.storeConfig.GradualWeightIn {
+		return weight, nil
+	}
+	if cfg.kv == nil {
+		return 0, fmt.Errorf("failed to save the target weight of %s: no config store", osdEntity)
+	}
+	if err := cfg.kv.SetValue(config.WeightConfigMapName, osdEntity, fmt.Sprintf("%.4f", weight)); err != nil {
+		return 0, fmt.Errorf("failed to save the target weight of %s: %+v", osdEntity, err)
+	}
+	logger.Infof("%s will be weighted in gradually to weight %.4f", osdEntity, weight)
+	return 0, nil
+}
+
 func getBluestorePartitionPaths(cfg *osdConfig) (string, string, string, error) {
 	if !isBluestoreDevice(cfg) {
 		return "", "", "", fmt.Errorf("must be bluestore device to get bluestore partition paths: %+v", cfg)
@@ -679,13 +705,3 @@ func getBluestoreDirPaths(cfg *osdConfig) (string, string, string, error) {
 		filepath.Join(cfg.rootPath, config.BluestoreDirBlockName),
 		nil
 }
-
-// getSizeForPath returns the size of the filesystem at the given path.
-func getSizeForPath(path string) (uint64, error) {
-	s := syscall.Statfs_t{}
-	if err := syscall.Statfs(path, &s); err != nil {
-		return 0, fmt.Errorf("failed to statfs on %s, %+v", path, err)
-	}
-
-	return s.Blocks * uint64(s.Bsize), nil
-}
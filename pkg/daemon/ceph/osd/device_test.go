@@ -251,6 +251,8 @@ func TestPartitionBluestoreMetadataSafe(t *testing.T) {
 func TestPartitionOSD(t *testing.T) {
 	testPartitionOSDHelper(t, config.StoreConfig{StoreType: config.Bluestore, WalSizeMB: 1, DatabaseSizeMB: 2})
 	testPartitionOSDHelper(t, config.StoreConfig{StoreType: config.Filestore})
+	testPartitionOSDHelper(t, config.StoreConfig{StoreType: config.Filestore, FilestoreFilesystem: "xfs",
+		FilestoreMkfsOptions: "-i size=2048", FilestoreMountOptions: "noatime"})
 }
 
 func testPartitionOSDHelper(t *testing.T, storeConfig config.StoreConfig) {
@@ -295,9 +297,17 @@ func testPartitionOSDHelper(t *testing.T, storeConfig config.StoreConfig) {
 				assert.Equal(t, 5, len(args))
 				assert.Equal(t, "--change-name=1:ROOK-OSD1-FS-DATA", args[1])
 			case 3:
-				assert.Equal(t, "mkfs.ext4", command)
+				if storeConfig.FilestoreFilesystem == "" {
+					assert.Equal(t, "mkfs.ext4", command)
+				} else {
+					assert.Equal(t, "mkfs.xfs", command)
+					assert.Equal(t, []string{"-i", "size=2048", "-f"}, args[:3])
+				}
 			case 4:
 				assert.Equal(t, "mount", command)
+				if storeConfig.FilestoreFilesystem != "" {
+					assert.Equal(t, []string{"-t", "xfs", "-o", "noatime"}, args[:4])
+				}
 			case 5:
 				assert.Fail(t, "unexpected filestore command")
 			}
@@ -317,9 +327,11 @@ func testPartitionOSDHelper(t *testing.T, storeConfig config.StoreConfig) {
 	entry.ID = 1
 	entry.OsdUUID = uuid.Must(uuid.NewRandom())
 	config.PopulateCollocatedPerfSchemeEntry(entry, "sda", storeConfig)
+	entry.Filesystem = storeConfig.FilestoreFilesystem
+	entry.MountOptions = storeConfig.FilestoreMountOptions
 
-	cfg := &osdConfig{configRoot: configDir, rootPath: filepath.Join(configDir, "osd1"), id: entry.ID,
-		uuid: entry.OsdUUID, dir: false, partitionScheme: entry, kv: mockKVStore(), storeName: config.GetConfigStoreName("node123")}
+	cfg := &osdConfig{configRoot: configDir, rootPath: filepath.Join(configDir, "osd1"), id: entry.ID, uuid: entry.OsdUUID, dir: false,
+		storeConfig: storeConfig, partitionScheme: entry, kv: mockKVStore(), storeName: config.GetConfigStoreName("node123")}
 
 	// partition the OSD on sda now
 	devPartInfo, err := partitionOSD(context, cfg)
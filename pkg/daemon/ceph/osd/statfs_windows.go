@@ -0,0 +1,27 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osd
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// getSizeForPath is not supported on windows, where the osds do not run
+func getSizeForPath(path string) (uint64, error) {
+	return 0, fmt.Errorf("failed to get the size of %s. not supported on %s", path, runtime.GOOS)
+}
@@ -0,0 +1,185 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package osd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+
+	"github.com/rook/rook/pkg/clusterd"
+	"github.com/rook/rook/pkg/daemon/ceph/client"
+	"github.com/rook/rook/pkg/daemon/ceph/mon"
+	"github.com/rook/rook/pkg/operator/ceph/cluster/osd/config"
+	"github.com/rook/rook/pkg/operator/k8sutil"
+	"github.com/rook/rook/pkg/util/sys"
+)
+
+// the block devices of the host, where the holders of a device such as its lvm or dm-crypt mappings are listed
+var sysBlockPath = "/sys/block"
+
+// ZapDevice wipes the partitions, the ceph labels and the lvm and dm-crypt metadata of a device of the node so it can
+// be provisioned again, such as when the cluster is rebuilt. The device is given by its name or a persistent id. It is
+// refused if an osd of the node is on the device, if the device or one of its partitions is mounted or held by another
+// device, or if an osd that is up reports the device.
+func ZapDevice(context *clusterd.Context, cluster *mon.ClusterInfo, kv *k8sutil.ConfigMapKVStore, nodeName, id string) error {
+	devices, err := clusterd.DiscoverDevices(context.Executor)
+	if err != nil {
+		return fmt.Errorf("failed to discover the devices. %+v", err)
+	}
+	context.Devices = devices
+	var device *sys.LocalDisk
+	for _, d := range devices {
+		if d.Type != sys.PartType && d.MatchesID(id) {
+			device = d
+			break
+		}
+	}
+	if device == nil {
+		return fmt.Errorf("device %s not found on node %s", id, nodeName)
+	}
+	partitions, _, err := sys.GetDevicePartitions(device.Name, context.Executor)
+	if err != nil {
+		return fmt.Errorf("failed to get the partitions of device %s. %+v", device.Name, err)
+	}
+
+	// the osds are matched by the uuids of the disk and its partitions since the device names change across reboots
+	scheme, err := config.LoadScheme(kv, config.GetConfigStoreName(nodeName))
+	if err != nil {
+		return fmt.Errorf("failed to load the osds of node %s. %+v", nodeName, err)
+	}
+	diskUUID, err := sys.GetDiskUUID(device.Name, context.Executor)
+	if err != nil {
+		logger.Infof("device %s has no partition table uuid. %+v", device.Name, err)
+	}
+	if osdID, ok := deviceOSD(scheme, device.Name, diskUUID, partitions); ok {
+		return fmt.Errorf("device %s is used by osd.%d. remove the osd before zapping its device", device.Name, osdID)
+	}
+
+	protected, err := getProtectedDevices(context, "")
+	if err != nil {
+		return fmt.Errorf("failed to get the protected devices. %+v", err)
+	}
+	if mountpoint, ok := protected[device.Name]; ok {
+		return fmt.Errorf("device %s is mounted at %s", device.Name, mountpoint)
+	}
+	var partitionNames []string
+	for _, p := range partitions {
+		if mountpoint, ok := protected[p.Name]; ok {
+			return fmt.Errorf("partition %s of device %s is mounted at %s", p.Name, device.Name, mountpoint)
+		}
+		partitionNames = append(partitionNames, p.Name)
+	}
+	if holder, err := deviceHolder(device.Name, partitionNames); err != nil {
+		return err
+	} else if holder != "" {
+		return fmt.Errorf("device %s is held by %s. remove its lvm or dm-crypt mappings before zapping it", device.Name, holder)
+	}
+
+	if err := mon.GenerateAdminConnectionConfig(context, cluster); err != nil {
+		return fmt.Errorf("failed to write connection config. %+v", err)
+	}
+	if osdID, ok, err := upDeviceOSD(context, cluster.Name, nodeName, device.Name, partitionNames); err != nil {
+		return err
+	} else if ok {
+		return fmt.Errorf("device %s is used by osd.%d that is up. remove the osd before zapping its device", device.Name, osdID)
+	}
+
+	logger.Infof("zapping device %s on node %s", device.Name, nodeName)
+	if err := sys.WipeDevice(device.Name, context.Executor); err != nil {
+		return fmt.Errorf("failed to zap device %s. %+v", device.Name, err)
+	}
+	logger.Infof("device %s is zapped", device.Name)
+	return nil
+}
+
+// deviceOSD returns the id of the osd with a partition on the device, including the osds with their metadata on it.
+// The partitions are matched by the uuid of the disk or of the partition, or by the name of the device for the
+// partitions that were recorded without a uuid.
+func deviceOSD(scheme *config.PerfScheme, device, diskUUID string, partitions []sys.Partition) (int, bool) {
+	partitionUUIDs := map[string]bool{}
+	for _, p := range partitions {
+		if p.UUID != "" {
+			partitionUUIDs[p.UUID] = true
+		}
+	}
+	matches := func(name, disk, partition string) bool {
+		if disk == "" && partition == "" {
+			return name == device
+		}
+		return (disk != "" && disk == diskUUID) || partitionUUIDs[partition]
+	}
+
+	for _, entry := range scheme.Entries {
+		for _, p := range entry.Partitions {
+			if p != nil && matches(p.Device, p.DiskUUID, p.PartitionUUID) {
+				return entry.ID, true
+			}
+		}
+	}
+	if scheme.Metadata != nil {
+		for _, p := range scheme.Metadata.Partitions {
+			if matches(scheme.Metadata.Device, scheme.Metadata.DiskUUID, p.PartitionUUID) {
+				return p.ID, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// deviceHolder returns the first device that holds the device or one of its partitions, such as an lvm volume or a
+// dm-crypt mapping
+func deviceHolder(device string, partitions []string) (string, error) {
+	dirs := []string{path.Join(sysBlockPath, device, "holders")}
+	for _, p := range partitions {
+		dirs = append(dirs, path.Join(sysBlockPath, device, p, "holders"))
+	}
+	for _, dir := range dirs {
+		holders, err := ioutil.ReadDir(dir)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return "", fmt.Errorf("failed to read the holders of device %s. %+v", device, err)
+		}
+		if len(holders) > 0 {
+			return holders[0].Name(), nil
+		}
+	}
+	return "", nil
+}
+
+// upDeviceOSD returns the id of an osd of the node that is up and reports the device or one of its partitions
+func upDeviceOSD(context *clusterd.Context, clusterName, nodeName, device string, partitions []string) (int, bool, error) {
+	metadata, err := client.ListOSDMetadata(context, clusterName)
+	if err != nil {
+		return 0, false, err
+	}
+	osdDump, err := client.GetOSDDump(context, clusterName)
+	if err != nil {
+		return 0, false, err
+	}
+	for _, m := range metadata {
+		if m.Hostname != nodeName || !m.UsesDevice(device, partitions) {
+			continue
+		}
+		if up, _, err := osdDump.StatusByID(int64(m.ID)); err == nil && up == 1 {
+			return m.ID, true, nil
+		}
+	}
+	return 0, false, nil
+}
@@ -0,0 +1,136 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package osd
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/rook/rook/pkg/clusterd"
+	"github.com/rook/rook/pkg/daemon/ceph/mon"
+	"github.com/rook/rook/pkg/operator/ceph/cluster/osd/config"
+	exectest "github.com/rook/rook/pkg/util/exec/test"
+	"github.com/rook/rook/pkg/util/sys"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestZapDevice(t *testing.T) {
+	configDir, _ := ioutil.TempDir("", "")
+	defer os.RemoveAll(configDir)
+	mounts := path.Join(configDir, "mounts")
+	assert.Nil(t, ioutil.WriteFile(mounts, []byte("22 1 8:33 / / rw,relatime shared:1 - ext4 /dev/sdc1 rw\n"), 0644))
+	hostMountInfoFile = mounts
+	hostDevBlockDir = path.Join(configDir, "dev-block")
+	defer func() {
+		hostMountInfoFile = sys.HostMountInfoFile
+		hostDevBlockDir = sys.DevBlockDir
+	}()
+
+	// sdd is held by a dm-crypt mapping
+	sysBlockPath = path.Join(configDir, "block")
+	defer func() { sysBlockPath = "/sys/block" }()
+	assert.Nil(t, os.MkdirAll(path.Join(sysBlockPath, "sdd", "holders", "dm-0"), 0755))
+
+	// osd.1 was provisioned on sdb, which is named sda after a reboot
+	kv := mockKVStore()
+	scheme := config.NewPerfScheme()
+	entry := config.NewPerfSchemeEntry(config.Bluestore)
+	entry.ID = 1
+	assert.Nil(t, config.PopulateCollocatedPerfSchemeEntry(entry, "sdb", config.StoreConfig{}))
+	scheme.Entries = append(scheme.Entries, entry)
+	assert.Nil(t, scheme.SaveScheme(kv, config.GetConfigStoreName("node1")))
+	diskUUID := entry.Partitions[config.BlockPartitionType].DiskUUID
+
+	zapped := []string{}
+	executor := &exectest.MockExecutor{}
+	executor.MockExecuteCommandWithOutput = func(debug bool, name string, command string, args ...string) (string, error) {
+		switch {
+		case name == "lsblk all":
+			return "sda\nsdb\nsdc\nsdc1\nsdd\nsde", nil
+		case name == "lsblk inverse /dev/sdc1":
+			return "sdc1\nsdc", nil
+		case strings.HasPrefix(name, "lsblk children"):
+			return "", nil
+		case strings.HasPrefix(name, "lsblk /dev/sdc1"):
+			return `SIZE="1024" ROTA="1" RO="0" TYPE="part" PKNAME="sdc"`, nil
+		case strings.HasPrefix(name, "lsblk /dev/"):
+			return `SIZE="4096" ROTA="1" RO="0" TYPE="disk" PKNAME=""`, nil
+		case name == "get disk sda uuid":
+			return "Disk identifier (GUID): " + diskUUID, nil
+		case strings.HasPrefix(name, "get disk"):
+			return "Disk identifier (GUID): 18484D7E-5287-4CE9-AC73-D02FB69055CE", nil
+		}
+		return "", nil
+	}
+	executor.MockExecuteCommandWithOutputFile = func(debug bool, name, command, outfile string, args ...string) (string, error) {
+		// osd.2 is up on sde
+		if args[0] == "osd" && args[1] == "metadata" {
+			return `[{"id":2,"hostname":"node1","devices":"sde"},{"id":3,"hostname":"node2","devices":"sdb"}]`, nil
+		}
+		if args[0] == "osd" && args[1] == "dump" {
+			return `{"osds":[{"osd":2,"up":1,"in":1},{"osd":3,"up":1,"in":1}]}`, nil
+		}
+		return "", nil
+	}
+	executor.MockExecuteCommand = func(debug bool, name string, command string, args ...string) error {
+		if command == "sgdisk" {
+			zapped = append(zapped, args[len(args)-1])
+		}
+		return nil
+	}
+	context := &clusterd.Context{Executor: executor, ConfigDir: configDir}
+	cluster := &mon.ClusterInfo{Name: "myclust"}
+
+	// the devices of the osds, the mounted, held and unknown devices and the devices of the osds that are up are refused
+	assert.NotNil(t, ZapDevice(context, cluster, kv, "node1", "sda"))
+	assert.NotNil(t, ZapDevice(context, cluster, kv, "node1", "sdc"))
+	assert.NotNil(t, ZapDevice(context, cluster, kv, "node1", "sdd"))
+	assert.NotNil(t, ZapDevice(context, cluster, kv, "node1", "sde"))
+	assert.NotNil(t, ZapDevice(context, cluster, kv, "node1", "sdz"))
+	assert.Equal(t, 0, len(zapped))
+
+	// the other devices are zapped, even if an osd was on a device of the same name before it was renamed
+	assert.Nil(t, ZapDevice(context, cluster, kv, "node1", "/dev/sdb"))
+	assert.Equal(t, []string{"/dev/sdb"}, zapped)
+}
+
+func TestDeviceOSD(t *testing.T) {
+	scheme := config.NewPerfScheme()
+	scheme.Entries = append(scheme.Entries, &config.PerfSchemeEntry{ID: 1, Partitions: map[config.PartitionType]*config.PerfSchemePartitionDetails{
+		config.BlockPartitionType: {Device: "sdb", DiskUUID: "disk1", PartitionUUID: "part1"},
+	}})
+	scheme.Entries = append(scheme.Entries, &config.PerfSchemeEntry{ID: 2, Partitions: map[config.PartitionType]*config.PerfSchemePartitionDetails{
+		config.BlockPartitionType: {Device: "sdc"},
+	}})
+
+	// the partitions are matched by the uuids of the disk and the partitions
+	id, ok := deviceOSD(scheme, "sdd", "disk1", nil)
+	assert.True(t, ok)
+	assert.Equal(t, 1, id)
+	id, ok = deviceOSD(scheme, "sdd", "", []sys.Partition{{Name: "sdd1", UUID: "part1"}})
+	assert.True(t, ok)
+	assert.Equal(t, 1, id)
+	_, ok = deviceOSD(scheme, "sdb", "disk9", nil)
+	assert.False(t, ok)
+
+	// the partitions recorded without uuids are matched by the name of the device
+	id, ok = deviceOSD(scheme, "sdc", "disk9", nil)
+	assert.True(t, ok)
+	assert.Equal(t, 2, id)
+}
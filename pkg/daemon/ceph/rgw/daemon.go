@@ -38,6 +38,11 @@ type Config struct {
 	SecurePort      int
 	Keyring         string
 	CertificatePath string
+	TLSCertPath     string
+	TLSKeyPath      string
+	DNSName         string
+	StaticWebsite   bool
+	WebsiteDNSName  string
 	ClusterInfo     *mon.ClusterInfo
 }
 
@@ -77,24 +82,18 @@ func portString(config *Config) string {
 
 func generateConfigFiles(context *clusterd.Context, config *Config) error {
 
+	if err := prepareCertificate(context, config); err != nil {
+		return fmt.Errorf("failed to prepare the ssl certificate. %+v", err)
+	}
+
 	// create the rgw data directory
 	dataDir := path.Join(getRGWConfDir(context.ConfigDir), "data")
 	if err := os.MkdirAll(dataDir, 0744); err != nil {
 		logger.Warningf("failed to create data directory %s: %+v", dataDir, err)
 	}
 
-	settings := map[string]string{
-		"host":                           config.Host,
-		"rgw data":                       dataDir,
-		"rgw log nonexistent bucket":     "true",
-		"rgw intent log object name utc": "true",
-		"rgw enable usage log":           "true",
-		"rgw_frontends":                  fmt.Sprintf("civetweb port=%s", portString(config)),
-		"rgw_zone":                       config.Name,
-		"rgw_zonegroup":                  config.Name,
-	}
 	_, err := mon.GenerateConfigFile(context, config.ClusterInfo, getRGWConfDir(context.ConfigDir),
-		"client.radosgw.gateway", getRGWKeyringPath(context.ConfigDir), nil, settings)
+		"client.radosgw.gateway", getRGWKeyringPath(context.ConfigDir), nil, configSettings(config, dataDir))
 	if err != nil {
 		return fmt.Errorf("failed to create config file. %+v", err)
 	}
@@ -119,6 +118,62 @@ func generateConfigFiles(context *clusterd.Context, config *Config) error {
 	return nil
 }
 
+// configSettings returns the settings of the rgw in its config file
+func configSettings(config *Config, dataDir string) map[string]string {
+	settings := map[string]string{
+		"host":                           config.Host,
+		"rgw data":                       dataDir,
+		"rgw log nonexistent bucket":     "true",
+		"rgw intent log object name utc": "true",
+		"rgw enable usage log":           "true",
+		"rgw_frontends":                  fmt.Sprintf("civetweb port=%s", portString(config)),
+		"rgw_zone":                       config.Name,
+		"rgw_zonegroup":                  config.Name,
+	}
+	if config.StaticWebsite {
+		settings["rgw enable static website"] = "true"
+	}
+	if config.DNSName != "" {
+		settings["rgw dns name"] = config.DNSName
+	}
+	if config.StaticWebsite && config.WebsiteDNSName != "" {
+		// the website endpoint is recognized by its name, so the same gateway can serve the s3 api and the websites
+		settings["rgw dns s3website name"] = config.WebsiteDNSName
+	}
+	return settings
+}
+
+// prepareCertificate combines the certificate and key of a kubernetes tls secret in the pem file expected by civetweb
+// when the secret does not have the pem file already
+func prepareCertificate(context *clusterd.Context, config *Config) error {
+	if config.CertificatePath == "" {
+		return nil
+	}
+	if _, err := os.Stat(config.CertificatePath); err == nil || config.TLSCertPath == "" || config.TLSKeyPath == "" {
+		return nil
+	}
+
+	key, err := ioutil.ReadFile(config.TLSKeyPath)
+	if err != nil {
+		return fmt.Errorf("no certificate at %s and failed to read the tls key. %+v", config.CertificatePath, err)
+	}
+	cert, err := ioutil.ReadFile(config.TLSCertPath)
+	if err != nil {
+		return fmt.Errorf("failed to read the tls certificate. %+v", err)
+	}
+
+	pemPath := path.Join(getRGWConfDir(context.ConfigDir), "rgw-cert.pem")
+	if err := os.MkdirAll(getRGWConfDir(context.ConfigDir), 0744); err != nil {
+		return fmt.Errorf("failed to create rgw config dir. %+v", err)
+	}
+	if err := ioutil.WriteFile(pemPath, append(append(key, '\n'), cert...), 0600); err != nil {
+		return fmt.Errorf("failed to write the certificate to %s. %+v", pemPath, err)
+	}
+	logger.Infof("combined the tls certificate and key in %s", pemPath)
+	config.CertificatePath = pemPath
+	return nil
+}
+
 func startRGW(context *clusterd.Context, config *Config) (err error) {
 	// start the monitor daemon in the foreground with the given config
 	logger.Infof("starting rgw")
@@ -16,8 +16,12 @@ limitations under the License.
 package rgw
 
 import (
+	"io/ioutil"
+	"os"
+	"path"
 	"testing"
 
+	"github.com/rook/rook/pkg/clusterd"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -47,3 +51,58 @@ func TestPortString(t *testing.T) {
 	result = portString(cfg)
 	assert.Equal(t, "", result)
 }
+
+func TestConfigSettings(t *testing.T) {
+	cfg := &Config{Name: "store", Host: "rgw-host", Port: 80}
+	settings := configSettings(cfg, "/var/lib/rgw")
+	assert.Equal(t, "civetweb port=80", settings["rgw_frontends"])
+	_, ok := settings["rgw enable static website"]
+	assert.False(t, ok)
+
+	// the website dns name is only set for the static websites
+	cfg.WebsiteDNSName = "website.example.com"
+	settings = configSettings(cfg, "/var/lib/rgw")
+	_, ok = settings["rgw dns s3website name"]
+	assert.False(t, ok)
+
+	cfg.StaticWebsite = true
+	cfg.DNSName = "s3.example.com"
+	settings = configSettings(cfg, "/var/lib/rgw")
+	assert.Equal(t, "true", settings["rgw enable static website"])
+	assert.Equal(t, "s3.example.com", settings["rgw dns name"])
+	assert.Equal(t, "website.example.com", settings["rgw dns s3website name"])
+}
+
+func TestPrepareCertificate(t *testing.T) {
+	configDir, err := ioutil.TempDir("", "rgw")
+	assert.Nil(t, err)
+	defer os.RemoveAll(configDir)
+	context := &clusterd.Context{ConfigDir: configDir}
+	assert.Nil(t, ioutil.WriteFile(path.Join(configDir, "tls.crt"), []byte("CERT"), 0600))
+	assert.Nil(t, ioutil.WriteFile(path.Join(configDir, "tls.key"), []byte("KEY"), 0600))
+
+	// the tls certificate and key are combined when the pem file is not found
+	cfg := &Config{
+		CertificatePath: path.Join(configDir, "cert.pem"),
+		TLSCertPath:     path.Join(configDir, "tls.crt"),
+		TLSKeyPath:      path.Join(configDir, "tls.key"),
+	}
+	err = prepareCertificate(context, cfg)
+	assert.Nil(t, err)
+	assert.Equal(t, path.Join(configDir, "rgw", "rgw-cert.pem"), cfg.CertificatePath)
+	pem, err := ioutil.ReadFile(cfg.CertificatePath)
+	assert.Nil(t, err)
+	assert.Equal(t, "KEY\nCERT", string(pem))
+
+	// the pem file is used when it exists
+	assert.Nil(t, ioutil.WriteFile(path.Join(configDir, "cert.pem"), []byte("PEM"), 0600))
+	cfg.CertificatePath = path.Join(configDir, "cert.pem")
+	err = prepareCertificate(context, cfg)
+	assert.Nil(t, err)
+	assert.Equal(t, path.Join(configDir, "cert.pem"), cfg.CertificatePath)
+
+	// a missing certificate fails the start of the rgw
+	cfg = &Config{CertificatePath: path.Join(configDir, "missing.pem"), TLSCertPath: "/missing.crt", TLSKeyPath: "/missing.key"}
+	err = prepareCertificate(context, cfg)
+	assert.NotNil(t, err)
+}
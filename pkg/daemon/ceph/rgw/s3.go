@@ -0,0 +1,223 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rgw
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// BucketWebsite is the static website configuration of a bucket
+type BucketWebsite struct {
+	// The object returned for the requests to the root or to a directory of the website, such as index.html
+	IndexDocument string `json:"indexDocument"`
+	// The object returned when a request fails, such as error.html
+	ErrorDocument string `json:"errorDocument,omitempty"`
+}
+
+// CORSRule allows the cross-origin requests from the browsers to a bucket
+type CORSRule struct {
+	AllowedOrigins []string `json:"allowedOrigins"`
+	AllowedMethods []string `json:"allowedMethods"`
+	AllowedHeaders []string `json:"allowedHeaders,omitempty"`
+	ExposeHeaders  []string `json:"exposeHeaders,omitempty"`
+	MaxAgeSeconds  int64    `json:"maxAgeSeconds,omitempty"`
+}
+
+// bucketOwnerCredentials returns the keys of the owner of the bucket. The website, policy and cors of a bucket are
+// only managed through the S3 API by its owner.
+func bucketOwnerCredentials(c *Context, bucket string) (*credentials.Credentials, error) {
+	metadata, notFound, err := getBucketMetadata(c, bucket)
+	if notFound {
+		return nil, fmt.Errorf("bucket %s not found", bucket)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	owner, _, err := GetUser(c, metadata.Owner)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get owner %s of bucket %s. %+v", metadata.Owner, bucket, err)
+	}
+	if owner.AccessKey == nil || owner.SecretKey == nil {
+		return nil, fmt.Errorf("owner %s of bucket %s has no s3 keys", metadata.Owner, bucket)
+	}
+	return credentials.NewStaticCredentials(*owner.AccessKey, *owner.SecretKey, ""), nil
+}
+
+// newS3Client connects to the S3 API of the object store at the endpoint, such as http://rook-ceph-rgw-my-store:80,
+// with the credentials of the owner of the bucket
+func newS3Client(c *Context, endpoint, bucket string) (*s3.S3, error) {
+	creds, err := bucketOwnerCredentials(c, bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	// the ceph object store expects the default aws region
+	config := aws.NewConfig().
+		WithRegion("us-east-1").
+		WithCredentials(creds).
+		WithEndpoint(endpoint).
+		WithS3ForcePathStyle(true).
+		WithDisableSSL(!strings.HasPrefix(endpoint, "https://"))
+	return s3.New(session.New(), config), nil
+}
+
+// SetBucketWebsite enables the static website hosting of the bucket. The object store must have the static website
+// enabled in its gateway settings to serve the website.
+func SetBucketWebsite(c *Context, endpoint, bucket string, website BucketWebsite) error {
+	if website.IndexDocument == "" {
+		return fmt.Errorf("index document is required")
+	}
+	client, err := newS3Client(c, endpoint, bucket)
+	if err != nil {
+		return err
+	}
+
+	config := &s3.WebsiteConfiguration{IndexDocument: &s3.IndexDocument{Suffix: aws.String(website.IndexDocument)}}
+	if website.ErrorDocument != "" {
+		config.ErrorDocument = &s3.ErrorDocument{Key: aws.String(website.ErrorDocument)}
+	}
+	_, err = client.PutBucketWebsite(&s3.PutBucketWebsiteInput{Bucket: aws.String(bucket), WebsiteConfiguration: config})
+	if err != nil {
+		return fmt.Errorf("failed to set the website of bucket %s. %+v", bucket, err)
+	}
+	return nil
+}
+
+// DeleteBucketWebsite disables the static website hosting of the bucket
+func DeleteBucketWebsite(c *Context, endpoint, bucket string) error {
+	client, err := newS3Client(c, endpoint, bucket)
+	if err != nil {
+		return err
+	}
+	if _, err := client.DeleteBucketWebsite(&s3.DeleteBucketWebsiteInput{Bucket: aws.String(bucket)}); err != nil {
+		return fmt.Errorf("failed to delete the website of bucket %s. %+v", bucket, err)
+	}
+	return nil
+}
+
+// GetBucketPolicy returns the json policy document of the bucket
+func GetBucketPolicy(c *Context, endpoint, bucket string) (string, error) {
+	client, err := newS3Client(c, endpoint, bucket)
+	if err != nil {
+		return "", err
+	}
+	output, err := client.GetBucketPolicy(&s3.GetBucketPolicyInput{Bucket: aws.String(bucket)})
+	if err != nil {
+		return "", fmt.Errorf("failed to get the policy of bucket %s. %+v", bucket, err)
+	}
+	return aws.StringValue(output.Policy), nil
+}
+
+// SetBucketPolicy replaces the policy of the bucket with the json policy document
+func SetBucketPolicy(c *Context, endpoint, bucket, policy string) error {
+	client, err := newS3Client(c, endpoint, bucket)
+	if err != nil {
+		return err
+	}
+	if _, err := client.PutBucketPolicy(&s3.PutBucketPolicyInput{Bucket: aws.String(bucket), Policy: aws.String(policy)}); err != nil {
+		return fmt.Errorf("failed to set the policy of bucket %s. %+v", bucket, err)
+	}
+	return nil
+}
+
+// DeleteBucketPolicy removes the policy of the bucket so only its owner can access it again
+func DeleteBucketPolicy(c *Context, endpoint, bucket string) error {
+	client, err := newS3Client(c, endpoint, bucket)
+	if err != nil {
+		return err
+	}
+	if _, err := client.DeleteBucketPolicy(&s3.DeleteBucketPolicyInput{Bucket: aws.String(bucket)}); err != nil {
+		return fmt.Errorf("failed to delete the policy of bucket %s. %+v", bucket, err)
+	}
+	return nil
+}
+
+// GetBucketCORS returns the cors rules of the bucket
+func GetBucketCORS(c *Context, endpoint, bucket string) ([]CORSRule, error) {
+	client, err := newS3Client(c, endpoint, bucket)
+	if err != nil {
+		return nil, err
+	}
+	output, err := client.GetBucketCors(&s3.GetBucketCorsInput{Bucket: aws.String(bucket)})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the cors rules of bucket %s. %+v", bucket, err)
+	}
+
+	rules := []CORSRule{}
+	for _, r := range output.CORSRules {
+		rules = append(rules, CORSRule{
+			AllowedOrigins: aws.StringValueSlice(r.AllowedOrigins),
+			AllowedMethods: aws.StringValueSlice(r.AllowedMethods),
+			AllowedHeaders: aws.StringValueSlice(r.AllowedHeaders),
+			ExposeHeaders:  aws.StringValueSlice(r.ExposeHeaders),
+			MaxAgeSeconds:  aws.Int64Value(r.MaxAgeSeconds),
+		})
+	}
+	return rules, nil
+}
+
+// SetBucketCORS replaces the cors rules of the bucket
+func SetBucketCORS(c *Context, endpoint, bucket string, rules []CORSRule) error {
+	config := &s3.CORSConfiguration{}
+	for _, r := range rules {
+		if len(r.AllowedOrigins) == 0 || len(r.AllowedMethods) == 0 {
+			return fmt.Errorf("allowed origins and methods are required for each cors rule")
+		}
+		rule := &s3.CORSRule{
+			AllowedOrigins: aws.StringSlice(r.AllowedOrigins),
+			AllowedMethods: aws.StringSlice(r.AllowedMethods),
+		}
+		if len(r.AllowedHeaders) > 0 {
+			rule.AllowedHeaders = aws.StringSlice(r.AllowedHeaders)
+		}
+		if len(r.ExposeHeaders) > 0 {
+			rule.ExposeHeaders = aws.StringSlice(r.ExposeHeaders)
+		}
+		if r.MaxAgeSeconds > 0 {
+			rule.MaxAgeSeconds = aws.Int64(r.MaxAgeSeconds)
+		}
+		config.CORSRules = append(config.CORSRules, rule)
+	}
+
+	client, err := newS3Client(c, endpoint, bucket)
+	if err != nil {
+		return err
+	}
+	if _, err := client.PutBucketCors(&s3.PutBucketCorsInput{Bucket: aws.String(bucket), CORSConfiguration: config}); err != nil {
+		return fmt.Errorf("failed to set the cors rules of bucket %s. %+v", bucket, err)
+	}
+	return nil
+}
+
+// DeleteBucketCORS removes the cors rules of the bucket
+func DeleteBucketCORS(c *Context, endpoint, bucket string) error {
+	client, err := newS3Client(c, endpoint, bucket)
+	if err != nil {
+		return err
+	}
+	if _, err := client.DeleteBucketCors(&s3.DeleteBucketCorsInput{Bucket: aws.String(bucket)}); err != nil {
+		return fmt.Errorf("failed to delete the cors rules of bucket %s. %+v", bucket, err)
+	}
+	return nil
+}
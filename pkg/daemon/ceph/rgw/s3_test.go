@@ -0,0 +1,66 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package rgw
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/rook/rook/pkg/clusterd"
+	exectest "github.com/rook/rook/pkg/util/exec/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBucketOwnerCredentials(t *testing.T) {
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithCombinedOutput: func(debug bool, actionName string, command string, args ...string) (string, error) {
+			switch {
+			case args[0] == "metadata" && args[2] == "bucket:site":
+				return `{"data":{"owner":"web","creation_time":"2018-08-14 10:00:00.000000Z"}}`, nil
+			case args[0] == "metadata" && args[2] == "bucket:nokeys":
+				return `{"data":{"owner":"swift-only","creation_time":"2018-08-14 10:00:00.000000Z"}}`, nil
+			case args[0] == "metadata":
+				return "can't get key: (2) No such file or directory", nil
+			case args[0] == "user" && args[3] == "web":
+				return `{"user_id":"web","display_name":"web","keys":[{"access_key":"AK","secret_key":"SK"}]}`, nil
+			case args[0] == "user" && args[3] == "swift-only":
+				return `{"user_id":"swift-only","display_name":"swift","keys":[]}`, nil
+			}
+			return "", fmt.Errorf("unexpected radosgw-admin command '%v'", args)
+		},
+	}
+	c := NewContext(&clusterd.Context{Executor: executor}, "my-store", "rook-ceph")
+
+	creds, err := bucketOwnerCredentials(c, "site")
+	assert.Nil(t, err)
+	value, err := creds.Get()
+	assert.Nil(t, err)
+	assert.Equal(t, "AK", value.AccessKeyID)
+	assert.Equal(t, "SK", value.SecretAccessKey)
+
+	_, err = bucketOwnerCredentials(c, "nokeys")
+	assert.NotNil(t, err)
+	_, err = bucketOwnerCredentials(c, "missing")
+	assert.NotNil(t, err)
+}
+
+func TestSetBucketCORSValidation(t *testing.T) {
+	c := NewContext(&clusterd.Context{Executor: &exectest.MockExecutor{}}, "my-store", "rook-ceph")
+	err := SetBucketCORS(c, "http://rgw", "site", []CORSRule{{AllowedOrigins: []string{"*"}}})
+	assert.NotNil(t, err)
+	err = SetBucketWebsite(c, "http://rgw", "site", BucketWebsite{})
+	assert.NotNil(t, err)
+}
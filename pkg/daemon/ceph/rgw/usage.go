@@ -0,0 +1,149 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package rgw
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// the date format of the usage log range in radosgw-admin
+const usageDateFormat = "2006-01-02 15:04:05"
+
+// UsageStats are the traffic and operations recorded in the usage log of the object store
+type UsageStats struct {
+	BytesSent     uint64 `json:"bytesSent"`
+	BytesReceived uint64 `json:"bytesReceived"`
+	Ops           uint64 `json:"ops"`
+	SuccessfulOps uint64 `json:"successfulOps"`
+}
+
+// BucketUsage is the usage of a bucket by its owner, with the stats of each category of operations such as put_obj
+// or get_obj
+type BucketUsage struct {
+	Bucket string `json:"bucket"`
+	UsageStats
+	Categories map[string]UsageStats `json:"categories"`
+}
+
+// UserUsage is the usage of the object store by a user, which is the sum of the usage of its buckets
+type UserUsage struct {
+	UserID string `json:"userId"`
+	UsageStats
+	Buckets []BucketUsage `json:"buckets"`
+}
+
+// ObjectStoreUsage is the usage of the object store by each user over a time range
+type ObjectStoreUsage struct {
+	Start *time.Time  `json:"start,omitempty"`
+	End   *time.Time  `json:"end,omitempty"`
+	Users []UserUsage `json:"users"`
+}
+
+type rgwUsageCategory struct {
+	Category      string `json:"category"`
+	BytesSent     uint64 `json:"bytes_sent"`
+	BytesReceived uint64 `json:"bytes_received"`
+	Ops           uint64 `json:"ops"`
+	SuccessfulOps uint64 `json:"successful_ops"`
+}
+
+type rgwUsage struct {
+	Entries []struct {
+		User    string `json:"user"`
+		Buckets []struct {
+			Bucket     string             `json:"bucket"`
+			Categories []rgwUsageCategory `json:"categories"`
+		} `json:"buckets"`
+	} `json:"entries"`
+}
+
+func (s *UsageStats) add(category rgwUsageCategory) {
+	s.BytesSent += category.BytesSent
+	s.BytesReceived += category.BytesReceived
+	s.Ops += category.Ops
+	s.SuccessfulOps += category.SuccessfulOps
+}
+
+// GetUsage returns the usage of each user and bucket recorded in the usage log between the start and end times. The
+// range is open on the side of a zero time, and only the usage of the user is returned when a user id is given. The
+// usage log is collected by the hour, so the usage is only as precise as the hour.
+func GetUsage(c *Context, start, end time.Time, userID string) (*ObjectStoreUsage, error) {
+	if !start.IsZero() && !end.IsZero() && end.Before(start) {
+		return nil, fmt.Errorf("end of the usage range %s is before its start %s", end, start)
+	}
+
+	args := []string{"usage", "show", "--show-log-entries=true", "--show-log-sum=false"}
+	usage := &ObjectStoreUsage{Users: []UserUsage{}}
+	if !start.IsZero() {
+		args = append(args, "--start-date", start.UTC().Format(usageDateFormat))
+		usage.Start = &start
+	}
+	if !end.IsZero() {
+		args = append(args, "--end-date", end.UTC().Format(usageDateFormat))
+		usage.End = &end
+	}
+	if userID != "" {
+		args = append(args, "--uid", userID)
+	}
+
+	result, err := runAdminCommand(c, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to show usage: %+v", err)
+	}
+	var rgwStats rgwUsage
+	if err := json.Unmarshal([]byte(result), &rgwStats); err != nil {
+		return nil, fmt.Errorf("failed to read usage. %+v, result=%s", err, result)
+	}
+
+	// the log has an entry for each hour of each bucket of the users, which are summed over the range
+	users := map[string]map[string]*BucketUsage{}
+	for _, entry := range rgwStats.Entries {
+		if _, ok := users[entry.User]; !ok {
+			users[entry.User] = map[string]*BucketUsage{}
+		}
+		for _, b := range entry.Buckets {
+			bucket, ok := users[entry.User][b.Bucket]
+			if !ok {
+				bucket = &BucketUsage{Bucket: b.Bucket, Categories: map[string]UsageStats{}}
+				users[entry.User][b.Bucket] = bucket
+			}
+			for _, category := range b.Categories {
+				bucket.add(category)
+				stats := bucket.Categories[category.Category]
+				stats.add(category)
+				bucket.Categories[category.Category] = stats
+			}
+		}
+	}
+
+	for user, buckets := range users {
+		u := UserUsage{UserID: user, Buckets: []BucketUsage{}}
+		for _, bucket := range buckets {
+			u.BytesSent += bucket.BytesSent
+			u.BytesReceived += bucket.BytesReceived
+			u.Ops += bucket.Ops
+			u.SuccessfulOps += bucket.SuccessfulOps
+			u.Buckets = append(u.Buckets, *bucket)
+		}
+		sort.Slice(u.Buckets, func(i, j int) bool { return u.Buckets[i].Bucket < u.Buckets[j].Bucket })
+		usage.Users = append(usage.Users, u)
+	}
+	sort.Slice(usage.Users, func(i, j int) bool { return usage.Users[i].UserID < usage.Users[j].UserID })
+	return usage, nil
+}
@@ -0,0 +1,82 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package rgw
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/rook/rook/pkg/clusterd"
+	exectest "github.com/rook/rook/pkg/util/exec/test"
+	"github.com/stretchr/testify/assert"
+)
+
+const usageOutput = `{"entries":[
+	{"user":"bob","buckets":[
+		{"bucket":"photos","time":"2018-06-01 10:00:00.000000Z","epoch":1527847200,"owner":"bob","categories":[
+			{"category":"put_obj","bytes_sent":0,"bytes_received":1000,"ops":2,"successful_ops":2}]}]},
+	{"user":"alice","buckets":[
+		{"bucket":"logs","time":"2018-06-01 10:00:00.000000Z","epoch":1527847200,"owner":"alice","categories":[
+			{"category":"put_obj","bytes_sent":0,"bytes_received":500,"ops":1,"successful_ops":1},
+			{"category":"get_obj","bytes_sent":300,"bytes_received":0,"ops":3,"successful_ops":2}]},
+		{"bucket":"logs","time":"2018-06-01 11:00:00.000000Z","epoch":1527850800,"owner":"alice","categories":[
+			{"category":"get_obj","bytes_sent":200,"bytes_received":0,"ops":1,"successful_ops":1}]},
+		{"bucket":"backups","time":"2018-06-01 11:00:00.000000Z","epoch":1527850800,"owner":"alice","categories":[
+			{"category":"put_obj","bytes_sent":0,"bytes_received":4000,"ops":1,"successful_ops":1}]}]}]}`
+
+func TestGetUsage(t *testing.T) {
+	var usageArgs []string
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithCombinedOutput: func(debug bool, actionName string, command string, args ...string) (string, error) {
+			if args[0] != "usage" || args[1] != "show" {
+				return "", fmt.Errorf("unexpected radosgw-admin command '%v'", args)
+			}
+			usageArgs = args
+			return usageOutput, nil
+		},
+	}
+	c := NewContext(&clusterd.Context{Executor: executor}, "my-store", "rook-ceph")
+
+	start := time.Date(2018, 6, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2018, 7, 1, 0, 0, 0, 0, time.UTC)
+	usage, err := GetUsage(c, start, end, "")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"--start-date", "2018-06-01 00:00:00", "--end-date", "2018-07-01 00:00:00"}, usageArgs[4:8])
+	assert.Equal(t, start, *usage.Start)
+
+	// the users and buckets are sorted, and the hourly entries of a bucket are summed
+	assert.Equal(t, 2, len(usage.Users))
+	alice := usage.Users[0]
+	assert.Equal(t, "alice", alice.UserID)
+	assert.Equal(t, UsageStats{BytesSent: 500, BytesReceived: 4500, Ops: 6, SuccessfulOps: 5}, alice.UsageStats)
+	assert.Equal(t, "backups", alice.Buckets[0].Bucket)
+	logs := alice.Buckets[1]
+	assert.Equal(t, "logs", logs.Bucket)
+	assert.Equal(t, UsageStats{BytesSent: 500, BytesReceived: 500, Ops: 5, SuccessfulOps: 4}, logs.UsageStats)
+	assert.Equal(t, UsageStats{BytesSent: 500, Ops: 4, SuccessfulOps: 3}, logs.Categories["get_obj"])
+	assert.Equal(t, "bob", usage.Users[1].UserID)
+	assert.Equal(t, uint64(1000), usage.Users[1].BytesReceived)
+
+	// an open range for a single user
+	_, err = GetUsage(c, time.Time{}, time.Time{}, "bob")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"--uid", "bob"}, usageArgs[4:6])
+
+	// the end of the range must be after its start
+	_, err = GetUsage(c, end, start, "")
+	assert.NotNil(t, err)
+}
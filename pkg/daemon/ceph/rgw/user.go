@@ -36,6 +36,9 @@ type ObjectUser struct {
 	Email       *string `json:"email"`
 	AccessKey   *string `json:"accessKey"`
 	SecretKey   *string `json:"secretKey"`
+	// The swift subuser and its key for the clients that only support the swift api
+	SwiftUser *string `json:"swiftUser"`
+	SwiftKey  *string `json:"swiftKey"`
 }
 
 func ListUsers(c *Context) ([]string, int, error) {
@@ -60,6 +63,10 @@ type rgwUserInfo struct {
 		AccessKey string `json:"access_key"`
 		SecretKey string `json:"secret_key"`
 	}
+	SwiftKeys []struct {
+		User      string `json:"user"`
+		SecretKey string `json:"secret_key"`
+	} `json:"swift_keys"`
 }
 
 func decodeUser(data string) (*ObjectUser, int, error) {
@@ -75,6 +82,10 @@ func decodeUser(data string) (*ObjectUser, int, error) {
 		rookUser.AccessKey = &user.Keys[0].AccessKey
 		rookUser.SecretKey = &user.Keys[0].SecretKey
 	}
+	if len(user.SwiftKeys) > 0 {
+		rookUser.SwiftUser = &user.SwiftKeys[0].User
+		rookUser.SwiftKey = &user.SwiftKeys[0].SecretKey
+	}
 
 	return &rookUser, RGWErrorNone, nil
 }
@@ -130,6 +141,35 @@ func CreateUser(c *Context, user ObjectUser) (*ObjectUser, int, error) {
 	return decodeUser(result)
 }
 
+// CreateSwiftKey creates the swift subuser <id>:swift with full access to the buckets of the user, and generates its
+// swift key. The user keeps its s3 keys.
+func CreateSwiftKey(c *Context, id string) (*ObjectUser, int, error) {
+	logger.Infof("Creating swift key for user: %s", id)
+
+	args := []string{
+		"subuser",
+		"create",
+		"--uid", id,
+		"--subuser", id + ":swift",
+		"--access", "full",
+		"--key-type", "swift",
+		"--gen-secret",
+	}
+	result, err := runAdminCommand(c, args...)
+	if err != nil {
+		return nil, RGWErrorUnknown, fmt.Errorf("failed to create swift key: %+v", err)
+	}
+
+	if strings.HasPrefix(result, "could not create subuser: unable to create subuser, user not found") {
+		return nil, RGWErrorNotFound, fmt.Errorf("user not found")
+	}
+	if strings.HasPrefix(result, "could not create subuser") {
+		return nil, RGWErrorBadData, fmt.Errorf("failed to create swift subuser: %s", result)
+	}
+
+	return decodeUser(result)
+}
+
 func UpdateUser(c *Context, user ObjectUser) (*ObjectUser, int, error) {
 	logger.Infof("Updating user: %s", user.UserID)
 
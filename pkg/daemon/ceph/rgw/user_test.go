@@ -0,0 +1,55 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package rgw
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/rook/rook/pkg/clusterd"
+	exectest "github.com/rook/rook/pkg/util/exec/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateSwiftKey(t *testing.T) {
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithCombinedOutput: func(debug bool, actionName string, command string, args ...string) (string, error) {
+			if args[0] != "subuser" || args[1] != "create" {
+				return "", fmt.Errorf("unexpected radosgw-admin command '%v'", args)
+			}
+			if args[3] == "missing" {
+				return "could not create subuser: unable to create subuser, user not found", nil
+			}
+			assert.Equal(t, []string{"--subuser", "rook-user:swift", "--access", "full", "--key-type", "swift", "--gen-secret"}, args[4:11])
+			return `{"user_id":"rook-user","display_name":"rook user",
+				"keys":[{"user":"rook-user","access_key":"AK","secret_key":"SK"}],
+				"swift_keys":[{"user":"rook-user:swift","secret_key":"swiftsecret"}]}`, nil
+		},
+	}
+	c := NewContext(&clusterd.Context{Executor: executor}, "my-store", "rook-ceph")
+
+	user, code, err := CreateSwiftKey(c, "rook-user")
+	assert.Nil(t, err)
+	assert.Equal(t, RGWErrorNone, code)
+	assert.Equal(t, "AK", *user.AccessKey)
+	assert.Equal(t, "SK", *user.SecretKey)
+	assert.Equal(t, "rook-user:swift", *user.SwiftUser)
+	assert.Equal(t, "swiftsecret", *user.SwiftKey)
+
+	_, code, err = CreateSwiftKey(c, "missing")
+	assert.NotNil(t, err)
+	assert.Equal(t, RGWErrorNotFound, code)
+}
@@ -30,8 +30,13 @@ const (
 	RBDDevicePathPrefix  = "/dev/rbd"
 )
 
-// FindRBDMappedFile search for the mapped RBD volume and returns its device path
+// FindRBDMappedFile search for the mapped RBD volume and returns its device path. The pool name may
+// be qualified with a rados namespace in the form "pool/namespace".
 func FindRBDMappedFile(imageName, poolName, sysBusDir string) (string, error) {
+	namespace := ""
+	if parts := strings.SplitN(poolName, "/", 2); len(parts) == 2 {
+		poolName, namespace = parts[0], parts[1]
+	}
 
 	sysBusDeviceDir := filepath.Join(sysBusDir, RBDDevicesDir)
 	// if sysPath does not exist, no attachments has happened
@@ -50,8 +55,13 @@ func FindRBDMappedFile(imageName, poolName, sysBusDir string) (string, error) {
 			// the image for the current rbd device matches, now try to match pool
 			poolContent, err := ioutil.ReadFile(filepath.Join(sysBusDeviceDir, idFile.Name(), "pool"))
 			if err == nil && poolName == strings.TrimSpace(string(poolContent)) {
-				// match current device matches both image name and pool name, return the device
-				return idFile.Name(), nil
+				// the pool_ns file is only present on kernels that support namespaces, treat a missing file as
+				// the default namespace
+				nsContent, _ := ioutil.ReadFile(filepath.Join(sysBusDeviceDir, idFile.Name(), "pool_ns"))
+				if namespace == strings.TrimSpace(string(nsContent)) {
+					// match current device matches image name, pool name and namespace, return the device
+					return idFile.Name(), nil
+				}
 			}
 		}
 	}
@@ -37,4 +37,15 @@ func TestFindDevicePath(t *testing.T) {
 	ioutil.WriteFile(filepath.Join(dev0Path, "pool"), []byte("mypool1"), 0777)
 	mappedImageFile, _ := FindRBDMappedFile("myimage1", "mypool1", mockRBDSysBusPath)
 	assert.Equal(t, "3", mappedImageFile)
+
+	// an image with the same name in a namespace of the pool is a different device
+	dev1Path := filepath.Join(mockRBDSysBusPath, "devices", "4")
+	os.MkdirAll(dev1Path, 0777)
+	ioutil.WriteFile(filepath.Join(dev1Path, "name"), []byte("myimage1"), 0777)
+	ioutil.WriteFile(filepath.Join(dev1Path, "pool"), []byte("mypool1"), 0777)
+	ioutil.WriteFile(filepath.Join(dev1Path, "pool_ns"), []byte("tenant1"), 0777)
+	mappedImageFile, _ = FindRBDMappedFile("myimage1", "mypool1/tenant1", mockRBDSysBusPath)
+	assert.Equal(t, "4", mappedImageFile)
+	mappedImageFile, _ = FindRBDMappedFile("myimage1", "mypool1", mockRBDSysBusPath)
+	assert.Equal(t, "3", mappedImageFile)
 }
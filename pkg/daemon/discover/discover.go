@@ -22,6 +22,8 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	"path"
+	"runtime"
 	"syscall"
 	"time"
 
@@ -44,6 +46,17 @@ var (
 	probeInterval                           = 30 * time.Second
 	nodeName, namespace, lastDevice, cmName string
 	cm                                      *v1.ConfigMap
+	// the configmap is read again at this interval in case it was changed or deleted since it was cached
+	fullRefreshInterval = 10 * time.Minute
+	lastFullRefresh     time.Time
+	// the number of writes of the configmap and of unchanged probes since the last full refresh
+	cmWrites, cmSkips int
+	// LocalDiskCMArch is the key of the architecture of the node in the device configmap, so the inventory shows the
+	// nodes of each architecture in a mixed-architecture cluster
+	LocalDiskCMArch = "arch"
+	// the mounts of the host, to mark the devices with a mounted filesystem such as the boot disk
+	hostMountInfoFile = sys.HostMountInfoFile
+	hostDevBlockDir   = sys.DevBlockDir
 )
 
 func Run(context *clusterd.Context) error {
@@ -60,11 +73,21 @@ func Run(context *clusterd.Context) error {
 		logger.Infof("failed to update device configmap: %v", err)
 		return err
 	}
+
+	// probe the devices as soon as a disk is added or removed, in addition to the periodic probes
+	stopCh := make(chan struct{})
+	udevEvents := make(chan string, 10)
+	go monitorUdev(udevEvents, stopCh)
 	for {
 		select {
 		case <-sigc:
 			logger.Infof("shutdown signal received, exiting...")
+			close(stopCh)
 			return nil
+		case device := <-udevEvents:
+			logger.Infof("device %s was added or removed", device)
+			waitUdevSettled(udevEvents)
+			updateDeviceCM(context)
 		case <-time.After(probeInterval):
 			updateDeviceCM(context)
 		}
@@ -78,12 +101,35 @@ func updateDeviceCM(context *clusterd.Context) error {
 		logger.Infof("failed to probe devices: %v", err)
 		return err
 	}
+
+	// only publish the declared devices of the nodes in the static inventory
+	inventory, err := loadInventory(path.Join(InventoryDir, InventoryFile))
+	if err != nil {
+		// publishing all the devices would offer the undeclared devices to the osds
+		logger.Errorf("failed to load the static inventory, keeping the last published devices. %+v", err)
+		if reportErr := reportInventoryError(context, err); reportErr != nil {
+			logger.Warningf("failed to report the inventory error. %+v", reportErr)
+		}
+		return err
+	}
+	devices, report, err := applyInventory(inventory, nodeName, devices)
+	if err != nil {
+		return err
+	}
 	deviceJson, err := json.Marshal(devices)
 	if err != nil {
 		logger.Infof("failed to marshal: %v", err)
 		return err
 	}
 	deviceStr := string(deviceJson)
+	if time.Since(lastFullRefresh) >= fullRefreshInterval {
+		if !lastFullRefresh.IsZero() {
+			logger.Infof("device configmap was written %d times and unchanged for %d probes since the last refresh", cmWrites, cmSkips)
+		}
+		cm = nil
+		cmWrites, cmSkips = 0, 0
+		lastFullRefresh = time.Now()
+	}
 	if cm == nil {
 		cm, err = context.Clientset.CoreV1().ConfigMaps(namespace).Get(cmName, metav1.GetOptions{})
 	}
@@ -96,8 +142,7 @@ func updateDeviceCM(context *clusterd.Context) error {
 			return err
 		}
 
-		data := make(map[string]string, 1)
-		data[LocalDiskCMData] = deviceStr
+		data := deviceCMData(deviceStr, report)
 		// the map doesn't exist yet, create it now
 		cm = &v1.ConfigMap{
 			ObjectMeta: metav1.ObjectMeta{
@@ -115,27 +160,86 @@ func updateDeviceCM(context *clusterd.Context) error {
 			logger.Infof("failed to create configmap: %v", err)
 			return fmt.Errorf("failed to create local device map %s: %+v", cmName, err)
 		}
-		lastDevice = deviceStr
+		cmWrites++
+		return nil
+	}
+	if deviceStr == lastDevice && cm.Data[LocalDiskCMArch] == runtime.GOARCH && cm.Data[LocalDiskCMInventoryReport] == report {
+		// only write the configmap when the devices changed
+		cmSkips++
+		return nil
+	}
+	if report != "" && cm.Data[LocalDiskCMInventoryReport] != report {
+		logger.Infof("differences with the static inventory: %s", report)
+	}
+
+	cm.Data = deviceCMData(deviceStr, report)
+	updated, err := context.Clientset.CoreV1().ConfigMaps(namespace).Update(cm)
+	if err != nil {
+		logger.Infof("failed to update configmap %s: %v", cmName, err)
+		// read the configmap again at the next probe, or create it if it was deleted
+		cm = nil
+		return err
 	}
-	if deviceStr != lastDevice {
-		data := make(map[string]string, 1)
-		data[LocalDiskCMData] = deviceStr
-		cm.Data = data
-		cm, err = context.Clientset.CoreV1().ConfigMaps(namespace).Update(cm)
+	cm = updated
+	cmWrites++
+	return nil
+}
+
+// reportInventoryError sets the error in the inventory report of the device configmap and keeps its devices. No devices
+// are published if the configmap does not exist yet.
+func reportInventoryError(context *clusterd.Context, inventoryErr error) error {
+	report, err := json.Marshal(InventoryReport{Error: inventoryErr.Error()})
+	if err != nil {
+		return fmt.Errorf("failed to marshal the inventory report. %+v", err)
+	}
+	if cm == nil {
+		cm, err = context.Clientset.CoreV1().ConfigMaps(namespace).Get(cmName, metav1.GetOptions{})
 		if err != nil {
-			logger.Infof("failed to update configmap %s: %v", cmName, err)
-			return err
+			cm = nil
+			if errors.IsNotFound(err) {
+				return nil
+			}
+			return fmt.Errorf("failed to get configmap %s. %+v", cmName, err)
 		}
 	}
+	if cm.Data[LocalDiskCMInventoryReport] == string(report) {
+		return nil
+	}
+	if cm.Data == nil {
+		cm.Data = map[string]string{}
+	}
+	cm.Data[LocalDiskCMInventoryReport] = string(report)
+	updated, err := context.Clientset.CoreV1().ConfigMaps(namespace).Update(cm)
+	if err != nil {
+		cm = nil
+		return fmt.Errorf("failed to update configmap %s. %+v", cmName, err)
+	}
+	cm = updated
+	cmWrites++
 	return nil
 }
 
+func deviceCMData(devices, report string) map[string]string {
+	data := make(map[string]string, 3)
+	data[LocalDiskCMData] = devices
+	data[LocalDiskCMArch] = runtime.GOARCH
+	if report != "" {
+		data[LocalDiskCMInventoryReport] = report
+	}
+	return data
+}
+
 func probeDevices(context *clusterd.Context) ([]sys.LocalDisk, error) {
 	devices := make([]sys.LocalDisk, 0)
 	localDevices, err := clusterd.DiscoverDevices(context.Executor)
 	if err != nil {
 		return devices, fmt.Errorf("failed initial hardware discovery. %+v", err)
 	}
+	mounted, err := sys.GetMountedDevices(hostMountInfoFile, hostDevBlockDir, context.Executor)
+	if err != nil {
+		// the osd provisioning still refuses the mounted devices of the node
+		logger.Warningf("failed to get the mounted devices. %+v", err)
+	}
 	for _, device := range localDevices {
 		if device == nil {
 			continue
@@ -159,6 +263,7 @@ func probeDevices(context *clusterd.Context) ([]sys.LocalDisk, error) {
 		device.Partitions = partitions
 		device.Filesystem = fs
 		device.Empty = clusterd.GetDeviceEmpty(device)
+		device.Mountpoint = mounted[device.Name]
 
 		devices = append(devices, *device)
 	}
@@ -18,12 +18,20 @@ limitations under the License.
 package discover
 
 import (
+	"io/ioutil"
+	"os"
+	"path"
+	"runtime"
 	"testing"
+	"time"
 
 	"github.com/rook/rook/pkg/clusterd"
 	exectest "github.com/rook/rook/pkg/util/exec/test"
+	"github.com/rook/rook/pkg/util/sys"
 
 	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
 )
 
 const (
@@ -92,16 +100,164 @@ testa2   centos_host13-home
 
 		case "get disk testa fs serial":
 			output = udevOutput
+		case "lsblk inverse /dev/mapper/centos_host13-root":
+			output = "centos_host13-root\ntesta2\ntesta"
 		}
 
 		return output, nil
 	}
 
+	// the root filesystem is on the disk
+	mounts, err := ioutil.TempFile("", "mounts")
+	assert.Nil(t, err)
+	defer os.Remove(mounts.Name())
+	mounts.WriteString("22 1 253:0 / / rw,relatime shared:1 - xfs /dev/mapper/centos_host13-root rw,attr2\n")
+	mounts.Close()
+	hostMountInfoFile = mounts.Name()
+	hostDevBlockDir = "/not/a/dev/block/dir"
+	defer func() {
+		hostMountInfoFile = sys.HostMountInfoFile
+		hostDevBlockDir = sys.DevBlockDir
+	}()
+
 	context := &clusterd.Context{Executor: executor}
 
 	devices, err := probeDevices(context)
 	assert.Nil(t, err)
 	assert.Equal(t, 1, len(devices))
 	assert.Equal(t, "ext2", devices[0].Filesystem)
+	assert.Equal(t, "/", devices[0].Mountpoint)
+
+}
+
+func TestUpdateDeviceCM(t *testing.T) {
+	executor := &exectest.MockExecutor{}
+	executor.MockExecuteCommandWithOutput = func(debug bool, name string, command string, args ...string) (string, error) {
+		switch name {
+		case "lsblk all":
+			return "testa", nil
+		case "lsblk /dev/testa":
+			return `SIZE="249510756352" ROTA="1" RO="0" TYPE="disk" PKNAME=""`, nil
+		}
+		return "", nil
+	}
+	clientset := fake.NewSimpleClientset()
+	context := &clusterd.Context{Executor: executor, Clientset: clientset}
+	namespace = "rook-system"
+	cmName = LocalDiskCMName + "node1"
+	cm = nil
+	lastFullRefresh = time.Time{}
+
+	// the configmap is created by the first probe
+	assert.Nil(t, updateDeviceCM(context))
+	assert.Equal(t, 1, cmWrites)
+	created, err := clientset.CoreV1().ConfigMaps(namespace).Get(cmName, metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, runtime.GOARCH, created.Data[LocalDiskCMArch])
+
+	// the configmap is not written again while the devices are unchanged
+	assert.Nil(t, updateDeviceCM(context))
+	assert.Equal(t, 1, cmWrites)
+	assert.Equal(t, 1, cmSkips)
+
+	// the deleted configmap is created again at the next full refresh
+	assert.Nil(t, clientset.CoreV1().ConfigMaps(namespace).Delete(cmName, &metav1.DeleteOptions{}))
+	assert.Nil(t, updateDeviceCM(context))
+	_, err = clientset.CoreV1().ConfigMaps(namespace).Get(cmName, metav1.GetOptions{})
+	assert.NotNil(t, err)
+	lastFullRefresh = time.Time{}
+	assert.Nil(t, updateDeviceCM(context))
+	assert.Equal(t, 1, cmWrites)
+	assert.Equal(t, 0, cmSkips)
+	_, err = clientset.CoreV1().ConfigMaps(namespace).Get(cmName, metav1.GetOptions{})
+	assert.Nil(t, err)
+
+	// the architecture is added to a configmap written by an older version
+	delete(cm.Data, LocalDiskCMArch)
+	assert.Nil(t, updateDeviceCM(context))
+	assert.Equal(t, 2, cmWrites)
+	updated, err := clientset.CoreV1().ConfigMaps(namespace).Get(cmName, metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, runtime.GOARCH, updated.Data[LocalDiskCMArch])
+
+	// the last devices are kept with the error in the report when the inventory is invalid
+	dir, err := ioutil.TempDir("", "")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	defer func(dir string) { InventoryDir = dir }(InventoryDir)
+	InventoryDir = dir
+	assert.Nil(t, ioutil.WriteFile(path.Join(dir, InventoryFile), []byte("nodes: [invalid"), 0644))
+	executor.MockExecuteCommandWithOutput = func(debug bool, name string, command string, args ...string) (string, error) {
+		switch name {
+		case "lsblk all":
+			return "testa\ntestb", nil
+		case "lsblk /dev/testa", "lsblk /dev/testb":
+			return `SIZE="249510756352" ROTA="1" RO="0" TYPE="disk" PKNAME=""`, nil
+		}
+		return "", nil
+	}
+	assert.NotNil(t, updateDeviceCM(context))
+	invalid, err := clientset.CoreV1().ConfigMaps(namespace).Get(cmName, metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, updated.Data[LocalDiskCMData], invalid.Data[LocalDiskCMData])
+	assert.Contains(t, invalid.Data[LocalDiskCMInventoryReport], "failed to parse the inventory")
+}
+
+func TestApplyInventory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	// no inventory
+	inventory, err := loadInventory(path.Join(dir, InventoryFile))
+	assert.Nil(t, err)
+	assert.Nil(t, inventory)
+	detected := []sys.LocalDisk{{Name: "sda", Serial: "a"}, {Name: "sdb", Serial: "b"}, {Name: "sdc", Serial: "c"}}
+	devices, report, err := applyInventory(inventory, "node1", detected)
+	assert.Nil(t, err)
+	assert.Equal(t, detected, devices)
+	assert.Equal(t, "", report)
+
+	contents := `
+nodes:
+- name: node1
+  devices:
+  - name: sdb
+  - name: sdc
+    serial: other
+  - name: sdd
+`
+	assert.Nil(t, ioutil.WriteFile(path.Join(dir, InventoryFile), []byte(contents), 0644))
+	inventory, err = loadInventory(path.Join(dir, InventoryFile))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(inventory.Nodes))
+
+	// only the declared devices with the expected serial are published
+	devices, report, err = applyInventory(inventory, "node1", detected)
+	assert.Nil(t, err)
+	assert.Equal(t, []sys.LocalDisk{{Name: "sdb", Serial: "b"}}, devices)
+	assert.Equal(t, `{"missing":["sdd"],"undeclared":["sda"],"mismatched":["sdc"]}`, report)
+
+	// the nodes that are not in the inventory publish all their devices
+	devices, report, err = applyInventory(inventory, "node2", detected)
+	assert.Nil(t, err)
+	assert.Equal(t, detected, devices)
+	assert.Equal(t, "", report)
+}
+
+func TestParseUdevEvent(t *testing.T) {
+	device, ok := parseUdevEvent("UDEV  [1208.370044] add      /devices/pci0000:00/0000:00:10.0/host2/target2:0:1/2:0:1:0/block/sdb (block)")
+	assert.True(t, ok)
+	assert.Equal(t, "sdb", device)
+	device, ok = parseUdevEvent("UDEV  [1210.125330] remove   /devices/virtual/block/loop0 (block)")
+	assert.True(t, ok)
+	assert.Equal(t, "loop0", device)
 
+	// the other events and lines are ignored
+	_, ok = parseUdevEvent("UDEV  [1208.380201] change   /devices/pci0000:00/0000:00:10.0/host2/target2:0:1/2:0:1:0/block/sdb (block)")
+	assert.False(t, ok)
+	_, ok = parseUdevEvent("monitor will print the received events for:")
+	assert.False(t, ok)
+	_, ok = parseUdevEvent("KERNEL[1208.360011] add      /devices/pci0000:00/0000:00:10.0/host2/target2:0:1/2:0:1:0/block/sdb (block)")
+	assert.False(t, ok)
 }
@@ -0,0 +1,141 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package discover
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/ghodss/yaml"
+	"github.com/rook/rook/pkg/util/sys"
+)
+
+var (
+	// InventoryConfigMapName is the configmap with the static inventory, mounted in the discover pods when it exists
+	InventoryConfigMapName = "rook-ceph-inventory"
+	// InventoryDir is where the static inventory is mounted in the discover pods
+	InventoryDir = "/etc/rook/inventory"
+	// InventoryFile is the key of the static inventory in the configmap
+	InventoryFile = "inventory.yaml"
+	// LocalDiskCMInventoryReport is the key of the differences between the static inventory and the detected devices
+	LocalDiskCMInventoryReport = "inventory-report"
+)
+
+// Inventory is the static inventory of the devices of the nodes. The nodes in the inventory only publish the declared
+// devices instead of all the devices they discover.
+type Inventory struct {
+	Nodes []InventoryNode `json:"nodes"`
+}
+
+// InventoryNode is the declared devices of a node
+type InventoryNode struct {
+	Name    string            `json:"name"`
+	Devices []InventoryDevice `json:"devices"`
+}
+
+// InventoryDevice is a declared device, with its optional serial to make sure the expected disk is at the name
+type InventoryDevice struct {
+	Name   string `json:"name"`
+	Serial string `json:"serial,omitempty"`
+}
+
+// InventoryReport is the differences between the declared devices of a node and the devices detected on the node
+type InventoryReport struct {
+	// Missing is the declared devices that are not detected
+	Missing []string `json:"missing,omitempty"`
+	// Undeclared is the detected devices that are not declared, and not published
+	Undeclared []string `json:"undeclared,omitempty"`
+	// Mismatched is the declared devices detected with another serial, which are not published
+	Mismatched []string `json:"mismatched,omitempty"`
+	// Error is why the inventory could not be loaded, in which case the last published devices are kept
+	Error string `json:"error,omitempty"`
+}
+
+// loadInventory loads the static inventory, returning nil if there is none
+func loadInventory(path string) (*Inventory, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read the inventory %s. %+v", path, err)
+	}
+	var inventory Inventory
+	if err := yaml.Unmarshal(contents, &inventory); err != nil {
+		return nil, fmt.Errorf("failed to parse the inventory %s. %+v", path, err)
+	}
+	return &inventory, nil
+}
+
+// applyInventory returns the devices of the node to publish and the report of the differences with the inventory. All
+// the detected devices are published with an empty report if the node is not in the inventory.
+func applyInventory(inventory *Inventory, node string, detected []sys.LocalDisk) ([]sys.LocalDisk, string, error) {
+	if inventory == nil {
+		return detected, "", nil
+	}
+	var declared *InventoryNode
+	for i := range inventory.Nodes {
+		if inventory.Nodes[i].Name == node {
+			declared = &inventory.Nodes[i]
+		}
+	}
+	if declared == nil {
+		return detected, "", nil
+	}
+
+	devices := []sys.LocalDisk{}
+	report := InventoryReport{}
+	for _, d := range declared.Devices {
+		found := false
+		for _, device := range detected {
+			if device.Name != d.Name {
+				continue
+			}
+			found = true
+			if d.Serial != "" && d.Serial != device.Serial {
+				report.Mismatched = append(report.Mismatched, d.Name)
+				logger.Warningf("inventory device %s has serial %s instead of %s. not publishing it", d.Name, device.Serial, d.Serial)
+				break
+			}
+			devices = append(devices, device)
+			break
+		}
+		if !found {
+			report.Missing = append(report.Missing, d.Name)
+		}
+	}
+	for _, device := range detected {
+		declaredDevice := false
+		for _, d := range declared.Devices {
+			if d.Name == device.Name {
+				declaredDevice = true
+				break
+			}
+		}
+		if !declaredDevice {
+			report.Undeclared = append(report.Undeclared, device.Name)
+		}
+	}
+
+	reportJSON, err := json.Marshal(report)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to marshal the inventory report. %+v", err)
+	}
+	return devices, string(reportJSON), nil
+}
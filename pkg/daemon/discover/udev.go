@@ -0,0 +1,96 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package discover
+
+import (
+	"bufio"
+	"os/exec"
+	"path"
+	"strings"
+	"time"
+)
+
+var (
+	// the events of a disk come in bursts with the events of its partitions, which are probed once
+	udevSettleDelay = 2 * time.Second
+	// the monitor is started again after this delay if udevadm exits
+	udevRestartDelay = 30 * time.Second
+)
+
+// monitorUdev sends the name of the block devices that are added or removed, as reported by udev. The devices are
+// still probed periodically if udevadm is not available.
+func monitorUdev(events chan<- string, stopCh chan struct{}) {
+	for {
+		if err := runUdevMonitor(events, stopCh); err != nil {
+			logger.Warningf("udev monitor failed, relying on the periodic probes. %+v", err)
+		}
+		select {
+		case <-stopCh:
+			return
+		case <-time.After(udevRestartDelay):
+		}
+	}
+}
+
+func runUdevMonitor(events chan<- string, stopCh chan struct{}) error {
+	cmd := exec.Command("udevadm", "monitor", "--udev", "--subsystem-match=block")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	go func() {
+		<-stopCh
+		cmd.Process.Kill()
+	}()
+
+	logger.Infof("watching udev for the block devices that are added or removed")
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		if device, ok := parseUdevEvent(scanner.Text()); ok {
+			events <- device
+		}
+	}
+	return cmd.Wait()
+}
+
+// parseUdevEvent returns the device of an add or remove event printed by 'udevadm monitor', such as
+// "UDEV  [1208.370044] add      /devices/pci0000:00/0000:00:10.0/host2/target2:0:1/2:0:1:0/block/sdb (block)"
+func parseUdevEvent(line string) (string, bool) {
+	fields := strings.Fields(line)
+	if len(fields) != 5 || fields[0] != "UDEV" || fields[4] != "(block)" {
+		return "", false
+	}
+	if fields[2] != "add" && fields[2] != "remove" {
+		return "", false
+	}
+	return path.Base(fields[3]), true
+}
+
+// waitUdevSettled returns once no more udev events came for the settle delay, so a burst of events is probed once
+func waitUdevSettled(events <-chan string) {
+	for {
+		select {
+		case device := <-events:
+			logger.Debugf("udev event for device %s", device)
+		case <-time.After(udevSettleDelay):
+			return
+		}
+	}
+}
@@ -37,6 +37,11 @@ const (
 	flexvolumeDefaultDirPath       = "/usr/libexec/kubernetes/kubelet-plugins/volume/exec/"
 	agentDaemonsetTolerationEnv    = "AGENT_TOLERATION"
 	agentDaemonsetTolerationKeyEnv = "AGENT_TOLERATION_KEY"
+	agentMetricsPortEnv            = "AGENT_METRICS_PORT"
+	agentOfflineWindowEnv          = "AGENT_OFFLINE_WINDOW"
+
+	// StateDirPath is the dir on the host where the agents keep the local copy of the volumes attached on the node
+	StateDirPath = "/var/lib/rook/rook-ceph-agent"
 )
 
 var logger = capnslog.NewPackageLogger("github.com/rook/rook", "op-agent")
@@ -105,6 +110,10 @@ func (a *Agent) createAgentDaemonSet(namespace, agentImage, serviceAccount strin
 									Name:      "libmodules",
 									MountPath: "/lib/modules",
 								},
+								{
+									Name:      "state",
+									MountPath: StateDirPath,
+								},
 							},
 							Env: []v1.EnvVar{
 								k8sutil.NamespaceEnvVar(),
@@ -145,6 +154,14 @@ func (a *Agent) createAgentDaemonSet(namespace, agentImage, serviceAccount strin
 								},
 							},
 						},
+						{
+							Name: "state",
+							VolumeSource: v1.VolumeSource{
+								HostPath: &v1.HostPathVolumeSource{
+									Path: StateDirPath,
+								},
+							},
+						},
 					},
 					HostNetwork: true,
 				},
@@ -164,6 +181,18 @@ func (a *Agent) createAgentDaemonSet(namespace, agentImage, serviceAccount strin
 		}
 	}
 
+	// Serve the metrics of the agents if requested
+	if port := os.Getenv(agentMetricsPortEnv); port != "" {
+		container := &ds.Spec.Template.Spec.Containers[0]
+		container.Env = append(container.Env, v1.EnvVar{Name: "ROOK_METRICS_PORT", Value: port})
+	}
+
+	// How long the agents detach volumes while the kubernetes api is unreachable
+	if window := os.Getenv(agentOfflineWindowEnv); window != "" {
+		container := &ds.Spec.Template.Spec.Containers[0]
+		container.Env = append(container.Env, v1.EnvVar{Name: "ROOK_OFFLINE_WINDOW", Value: window})
+	}
+
 	_, err := a.clientset.Extensions().DaemonSets(namespace).Create(ds)
 	if err != nil {
 		if !kserrors.IsAlreadyExists(err) {
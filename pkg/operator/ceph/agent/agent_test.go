@@ -69,9 +69,9 @@ func TestStartAgentDaemonset(t *testing.T) {
 	assert.Equal(t, "mysa", agentDS.Spec.Template.Spec.ServiceAccountName)
 	assert.True(t, *agentDS.Spec.Template.Spec.Containers[0].SecurityContext.Privileged)
 	volumes := agentDS.Spec.Template.Spec.Volumes
-	assert.Equal(t, 4, len(volumes))
+	assert.Equal(t, 5, len(volumes))
 	volumeMounts := agentDS.Spec.Template.Spec.Containers[0].VolumeMounts
-	assert.Equal(t, 4, len(volumeMounts))
+	assert.Equal(t, 5, len(volumeMounts))
 	envs := agentDS.Spec.Template.Spec.Containers[0].Env
 	assert.Equal(t, 2, len(envs))
 	image := agentDS.Spec.Template.Spec.Containers[0].Image
@@ -153,6 +153,12 @@ func TestStartAgentDaemonsetWithToleration(t *testing.T) {
 	os.Setenv(agentDaemonsetTolerationKeyEnv, "example")
 	defer os.Unsetenv(agentDaemonsetTolerationKeyEnv)
 
+	os.Setenv(agentMetricsPortEnv, "9091")
+	defer os.Unsetenv(agentMetricsPortEnv)
+
+	os.Setenv(agentOfflineWindowEnv, "5m")
+	defer os.Unsetenv(agentOfflineWindowEnv)
+
 	pod := v1.Pod{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      "rook-operator",
@@ -184,4 +190,10 @@ func TestStartAgentDaemonsetWithToleration(t *testing.T) {
 	assert.Equal(t, "NoSchedule", string(agentDS.Spec.Template.Spec.Tolerations[0].Effect))
 	assert.Equal(t, "example", string(agentDS.Spec.Template.Spec.Tolerations[0].Key))
 	assert.Equal(t, "Exists", string(agentDS.Spec.Template.Spec.Tolerations[0].Operator))
+
+	// the agents serve their metrics on the port
+	envs := agentDS.Spec.Template.Spec.Containers[0].Env
+	assert.Equal(t, 4, len(envs))
+	assert.Equal(t, v1.EnvVar{Name: "ROOK_METRICS_PORT", Value: "9091"}, envs[2])
+	assert.Equal(t, v1.EnvVar{Name: "ROOK_OFFLINE_WINDOW", Value: "5m"}, envs[3])
 }
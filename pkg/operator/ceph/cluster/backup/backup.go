@@ -0,0 +1,253 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package backup exports and imports the identity and desired state of a ceph cluster so the cluster
+// can be recovered when its kubernetes resources are lost while the daemon data on the hosts survives.
+package backup
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/coreos/pkg/capnslog"
+	cephv1beta1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1beta1"
+	"github.com/rook/rook/pkg/clusterd"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var logger = capnslog.NewPackageLogger("github.com/rook/rook", "op-backup")
+
+const (
+	archiveVersion = 1
+
+	// the secret with the fsid and the mon and admin keys
+	monSecretName = "rook-ceph-mon"
+	// the config map with the mon endpoints
+	monEndpointsName = "rook-ceph-mon-endpoints"
+	// the config maps with the osd ids and disk uuids of each node or directory
+	osdStorePrefix = "rook-ceph-osd-"
+)
+
+var osdStoreSuffixes = []string{"-config", "-fs-backup"}
+
+// Archive is the identity and desired state of a cluster
+type Archive struct {
+	Version      int                       `json:"version"`
+	Namespace    string                    `json:"namespace"`
+	Secrets      []v1.Secret               `json:"secrets"`
+	ConfigMaps   []v1.ConfigMap            `json:"configMaps"`
+	Clusters     []cephv1beta1.Cluster     `json:"clusters"`
+	Pools        []cephv1beta1.Pool        `json:"pools"`
+	Filesystems  []cephv1beta1.Filesystem  `json:"filesystems"`
+	ObjectStores []cephv1beta1.ObjectStore `json:"objectStores"`
+}
+
+// Export collects the cluster identity (fsid, keys, mon endpoints, osd to disk mapping) and the specs
+// of the cluster, pools, filesystems, and object stores in the namespace
+func Export(context *clusterd.Context, namespace string) (*Archive, error) {
+	archive := &Archive{Version: archiveVersion, Namespace: namespace}
+
+	secret, err := context.Clientset.CoreV1().Secrets(namespace).Get(monSecretName, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the cluster identity. %+v", err)
+	}
+	archive.Secrets = append(archive.Secrets, *secret)
+
+	configMaps, err := context.Clientset.CoreV1().ConfigMaps(namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list config maps. %+v", err)
+	}
+	for _, cm := range configMaps.Items {
+		if isClusterState(cm.Name) {
+			archive.ConfigMaps = append(archive.ConfigMaps, cm)
+		}
+	}
+
+	client := context.RookClientset.CephV1beta1()
+	clusters, err := client.Clusters(namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list clusters. %+v", err)
+	}
+	archive.Clusters = clusters.Items
+
+	pools, err := client.Pools(namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pools. %+v", err)
+	}
+	archive.Pools = pools.Items
+
+	filesystems, err := client.Filesystems(namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list filesystems. %+v", err)
+	}
+	archive.Filesystems = filesystems.Items
+
+	objectStores, err := client.ObjectStores(namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list object stores. %+v", err)
+	}
+	archive.ObjectStores = objectStores.Items
+
+	logger.Infof("exported cluster %s with %d config maps, %d pools, %d filesystems, and %d object stores",
+		namespace, len(archive.ConfigMaps), len(archive.Pools), len(archive.Filesystems), len(archive.ObjectStores))
+	return archive, nil
+}
+
+// Import re-creates the resources in the archive in the namespace. The cluster identity is restored before
+// the cluster is created so the operator starts the existing mons and osds instead of creating a new cluster.
+// The import is refused if the namespace already has a cluster identity.
+func Import(context *clusterd.Context, namespace string, archive *Archive) error {
+	if archive.Version != archiveVersion {
+		return fmt.Errorf("unsupported archive version %d", archive.Version)
+	}
+
+	// an identity that is already there is only accepted if it is the identity of the archive, so a failed import can be
+	// retried
+	var identity *v1.Secret
+	for i := range archive.Secrets {
+		if archive.Secrets[i].Name == monSecretName {
+			identity = &archive.Secrets[i]
+		}
+	}
+	if identity == nil {
+		return fmt.Errorf("the archive has no cluster identity")
+	}
+	existing, err := context.Clientset.CoreV1().Secrets(namespace).Get(monSecretName, metav1.GetOptions{})
+	if err == nil && !reflect.DeepEqual(existing.Data, identity.Data) {
+		return fmt.Errorf("namespace %s already has another cluster identity", namespace)
+	}
+	if err != nil && !errors.IsNotFound(err) {
+		return fmt.Errorf("failed to get the cluster identity. %+v", err)
+	}
+
+	// the identity is created after the other secrets and the config maps it depends on, but before the cluster that
+	// would otherwise create a new identity
+	for _, s := range archive.Secrets {
+		if s.Name != monSecretName {
+			if err := importSecret(context, namespace, s); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, c := range archive.ConfigMaps {
+		cm := c
+		resetObjectMeta(&cm.ObjectMeta, namespace)
+		if _, err := context.Clientset.CoreV1().ConfigMaps(namespace).Create(&cm); err != nil && !errors.IsAlreadyExists(err) {
+			return fmt.Errorf("failed to import config map %s. %+v", cm.Name, err)
+		}
+	}
+
+	if err := importSecret(context, namespace, *identity); err != nil {
+		return err
+	}
+
+	client := context.RookClientset.CephV1beta1()
+	for _, c := range archive.Clusters {
+		cluster := c
+		resetObjectMeta(&cluster.ObjectMeta, namespace)
+		cluster.Status = cephv1beta1.ClusterStatus{}
+		if _, err := client.Clusters(namespace).Create(&cluster); err != nil && !errors.IsAlreadyExists(err) {
+			return fmt.Errorf("failed to import cluster %s. %+v", cluster.Name, err)
+		}
+	}
+	for _, p := range archive.Pools {
+		pool := p
+		resetObjectMeta(&pool.ObjectMeta, namespace)
+		if _, err := client.Pools(namespace).Create(&pool); err != nil && !errors.IsAlreadyExists(err) {
+			return fmt.Errorf("failed to import pool %s. %+v", pool.Name, err)
+		}
+	}
+	for _, f := range archive.Filesystems {
+		fs := f
+		resetObjectMeta(&fs.ObjectMeta, namespace)
+		if _, err := client.Filesystems(namespace).Create(&fs); err != nil && !errors.IsAlreadyExists(err) {
+			return fmt.Errorf("failed to import filesystem %s. %+v", fs.Name, err)
+		}
+	}
+	for _, o := range archive.ObjectStores {
+		store := o
+		resetObjectMeta(&store.ObjectMeta, namespace)
+		if _, err := client.ObjectStores(namespace).Create(&store); err != nil && !errors.IsAlreadyExists(err) {
+			return fmt.Errorf("failed to import object store %s. %+v", store.Name, err)
+		}
+	}
+
+	logger.Infof("imported cluster %s into namespace %s", archive.Namespace, namespace)
+	return nil
+}
+
+func importSecret(context *clusterd.Context, namespace string, secret v1.Secret) error {
+	resetObjectMeta(&secret.ObjectMeta, namespace)
+	if _, err := context.Clientset.CoreV1().Secrets(namespace).Create(&secret); err != nil && !errors.IsAlreadyExists(err) {
+		return fmt.Errorf("failed to import secret %s. %+v", secret.Name, err)
+	}
+	return nil
+}
+
+// Marshal serializes the archive and encrypts it with the passphrase
+func Marshal(archive *Archive, passphrase string) ([]byte, error) {
+	data, err := json.Marshal(archive)
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize archive. %+v", err)
+	}
+	return encrypt(data, passphrase)
+}
+
+// Unmarshal decrypts the archive with the passphrase and deserializes it
+func Unmarshal(data []byte, passphrase string) (*Archive, error) {
+	plain, err := decrypt(data, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	var archive Archive
+	if err := json.Unmarshal(plain, &archive); err != nil {
+		return nil, fmt.Errorf("failed to deserialize archive. %+v", err)
+	}
+	return &archive, nil
+}
+
+func isClusterState(configMapName string) bool {
+	if configMapName == monEndpointsName {
+		return true
+	}
+	if !strings.HasPrefix(configMapName, osdStorePrefix) {
+		return false
+	}
+	for _, suffix := range osdStoreSuffixes {
+		if strings.HasSuffix(configMapName, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// clear the fields that were assigned by the api server of the exported cluster. The owner references
+// point to the uid of the exported cluster, which is not the uid of the imported cluster.
+func resetObjectMeta(meta *metav1.ObjectMeta, namespace string) {
+	meta.Namespace = namespace
+	meta.ResourceVersion = ""
+	meta.UID = ""
+	meta.SelfLink = ""
+	meta.CreationTimestamp = metav1.Time{}
+	meta.DeletionTimestamp = nil
+	meta.OwnerReferences = nil
+	meta.Finalizers = nil
+}
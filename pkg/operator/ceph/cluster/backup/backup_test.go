@@ -0,0 +1,128 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package backup
+
+import (
+	"testing"
+
+	cephv1beta1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1beta1"
+	rookfake "github.com/rook/rook/pkg/client/clientset/versioned/fake"
+	"github.com/rook/rook/pkg/clusterd"
+	testop "github.com/rook/rook/pkg/operator/test"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestEncryptArchive(t *testing.T) {
+	data := []byte(`{"version":1}`)
+
+	_, err := encrypt(data, "short")
+	assert.NotNil(t, err)
+
+	sealed, err := encrypt(data, "mypassphrase")
+	assert.Nil(t, err)
+	assert.NotContains(t, string(sealed), "version")
+
+	plain, err := decrypt(sealed, "mypassphrase")
+	assert.Nil(t, err)
+	assert.Equal(t, data, plain)
+
+	_, err = decrypt(sealed, "wrongpassphrase")
+	assert.NotNil(t, err)
+
+	_, err = decrypt([]byte("garbage"), "mypassphrase")
+	assert.NotNil(t, err)
+
+	_, err = decrypt(sealed[:len(archiveMagic)+4], "mypassphrase")
+	assert.NotNil(t, err)
+}
+
+func TestIsClusterState(t *testing.T) {
+	assert.True(t, isClusterState("rook-ceph-mon-endpoints"))
+	assert.True(t, isClusterState("rook-ceph-osd-node1-config"))
+	assert.True(t, isClusterState("rook-ceph-osd-3-fs-backup"))
+	assert.False(t, isClusterState("rook-ceph-osd-node1-status"))
+	assert.False(t, isClusterState("rook-config-override"))
+}
+
+func TestExportImport(t *testing.T) {
+	clientset := testop.New(3)
+	context := &clusterd.Context{Clientset: clientset, RookClientset: rookfake.NewSimpleClientset()}
+	ns := "rook-ceph"
+
+	clientset.CoreV1().Secrets(ns).Create(&v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: monSecretName, Namespace: ns, ResourceVersion: "10"},
+		Data:       map[string][]byte{"fsid": []byte("myfsid")},
+	})
+	for _, name := range []string{"rook-ceph-mon-endpoints", "rook-ceph-osd-node1-config", "rook-ceph-osd-node1-status"} {
+		clientset.CoreV1().ConfigMaps(ns).Create(&v1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: ns}})
+	}
+	context.RookClientset.CephV1beta1().Clusters(ns).Create(&cephv1beta1.Cluster{
+		ObjectMeta: metav1.ObjectMeta{Name: ns, Namespace: ns, Finalizers: []string{"cluster.ceph.rook.io"}},
+		Status:     cephv1beta1.ClusterStatus{State: cephv1beta1.ClusterStateCreated},
+	})
+	context.RookClientset.CephV1beta1().Pools(ns).Create(&cephv1beta1.Pool{ObjectMeta: metav1.ObjectMeta{Name: "replicapool", Namespace: ns}})
+
+	archive, err := Export(context, ns)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(archive.Secrets))
+	assert.Equal(t, 2, len(archive.ConfigMaps))
+	assert.Equal(t, 1, len(archive.Clusters))
+	assert.Equal(t, 1, len(archive.Pools))
+
+	sealed, err := Marshal(archive, "mypassphrase")
+	assert.Nil(t, err)
+	archive, err = Unmarshal(sealed, "mypassphrase")
+	assert.Nil(t, err)
+
+	// the import is refused where another cluster identity already exists
+	other, _ := clientset.CoreV1().Secrets(ns).Get(monSecretName, metav1.GetOptions{})
+	other.Data["fsid"] = []byte("otherfsid")
+	clientset.CoreV1().Secrets(ns).Update(other)
+	err = Import(context, ns, archive)
+	assert.NotNil(t, err)
+
+	// import into a fresh kubernetes cluster
+	clientset = testop.New(3)
+	context = &clusterd.Context{Clientset: clientset, RookClientset: rookfake.NewSimpleClientset()}
+	err = Import(context, ns, archive)
+	assert.Nil(t, err)
+
+	secret, err := clientset.CoreV1().Secrets(ns).Get(monSecretName, metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, "myfsid", string(secret.Data["fsid"]))
+	_, err = clientset.CoreV1().ConfigMaps(ns).Get("rook-ceph-osd-node1-config", metav1.GetOptions{})
+	assert.Nil(t, err)
+	cluster, err := context.RookClientset.CephV1beta1().Clusters(ns).Get(ns, metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(cluster.Finalizers))
+	assert.Equal(t, cephv1beta1.ClusterState(""), cluster.Status.State)
+	_, err = context.RookClientset.CephV1beta1().Pools(ns).Get("replicapool", metav1.GetOptions{})
+	assert.Nil(t, err)
+
+	// a failed import can be retried after the identity of the archive was created
+	clientset = testop.New(3)
+	context = &clusterd.Context{Clientset: clientset, RookClientset: rookfake.NewSimpleClientset()}
+	clientset.CoreV1().Secrets(ns).Create(&v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: monSecretName, Namespace: ns},
+		Data:       map[string][]byte{"fsid": []byte("myfsid")},
+	})
+	err = Import(context, ns, archive)
+	assert.Nil(t, err)
+	_, err = context.RookClientset.CephV1beta1().Clusters(ns).Get(ns, metav1.GetOptions{})
+	assert.Nil(t, err)
+}
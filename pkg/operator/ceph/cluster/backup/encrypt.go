@@ -0,0 +1,108 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package backup
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	// archives start with the magic header, followed by the salt, the nonce, and the sealed json
+	archiveMagic  = "ROOKBAK1"
+	saltSize      = 16
+	minPassphrase = 8
+
+	// the scrypt cost parameters recommended for interactive use, and the key size for AES-256
+	scryptN = 32768
+	scryptR = 8
+	scryptP = 1
+	keySize = 32
+)
+
+// encrypt seals the data with AES-256-GCM using a key derived from the passphrase
+func encrypt(data []byte, passphrase string) ([]byte, error) {
+	if len(passphrase) < minPassphrase {
+		return nil, fmt.Errorf("the passphrase must have at least %d characters", minPassphrase)
+	}
+
+	salt := make([]byte, saltSize)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, fmt.Errorf("failed to generate salt. %+v", err)
+	}
+	gcm, err := newCipher(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce. %+v", err)
+	}
+
+	out := append([]byte(archiveMagic), salt...)
+	out = append(out, nonce...)
+	return gcm.Seal(out, nonce, data, []byte(archiveMagic)), nil
+}
+
+// decrypt opens data that was sealed by encrypt
+func decrypt(data []byte, passphrase string) ([]byte, error) {
+	if !bytes.HasPrefix(data, []byte(archiveMagic)) {
+		return nil, fmt.Errorf("not a cluster archive")
+	}
+	data = data[len(archiveMagic):]
+	if len(data) < saltSize {
+		return nil, fmt.Errorf("archive is truncated")
+	}
+	salt, data := data[:saltSize], data[saltSize:]
+
+	gcm, err := newCipher(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, fmt.Errorf("archive is truncated")
+	}
+	nonce, sealed := data[:gcm.NonceSize()], data[gcm.NonceSize():]
+
+	plain, err := gcm.Open(nil, nonce, sealed, []byte(archiveMagic))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt archive, the passphrase may be wrong. %+v", err)
+	}
+	return plain, nil
+}
+
+func newCipher(passphrase string, salt []byte) (cipher.AEAD, error) {
+	key, err := scrypt.Key([]byte(passphrase), salt, scryptN, scryptR, scryptP, keySize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive the key from the passphrase. %+v", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher. %+v", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher. %+v", err)
+	}
+	return gcm, nil
+}
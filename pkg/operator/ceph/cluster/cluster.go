@@ -21,6 +21,8 @@ import (
 	"fmt"
 	"reflect"
 	"sort"
+	"sync"
+	"time"
 
 	cephv1beta1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1beta1"
 	rookv1alpha2 "github.com/rook/rook/pkg/apis/rook.io/v1alpha2"
@@ -30,6 +32,8 @@ import (
 	"github.com/rook/rook/pkg/operator/ceph/cluster/mon"
 	"github.com/rook/rook/pkg/operator/ceph/cluster/osd"
 	"github.com/rook/rook/pkg/operator/k8sutil"
+	"github.com/rook/rook/pkg/util/logforward"
+	"github.com/rook/rook/pkg/util/metrics"
 	"k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -38,21 +42,38 @@ import (
 type cluster struct {
 	context   *clusterd.Context
 	Namespace string
-	Spec      *cephv1beta1.ClusterSpec
-	mons      *mon.Cluster
-	mgrs      *mgr.Cluster
-	osds      *osd.Cluster
-	stopCh    chan struct{}
-	ownerRef  metav1.OwnerReference
+	// Spec is replaced when the cluster is updated. The goroutines of the cluster read it with spec().
+	Spec     *cephv1beta1.ClusterSpec
+	specLock sync.RWMutex
+	mons     *mon.Cluster
+	mgrs     *mgr.Cluster
+	osds     *osd.Cluster
+	stopCh   chan struct{}
+	ownerRef metav1.OwnerReference
+	// restartLock prevents the rolling restarts of the orchestration and of the config watcher from overlapping
+	restartLock sync.Mutex
+	// recoveryLock serializes applying the recovery profile from the orchestration and from the recovery watcher
+	recoveryLock sync.Mutex
+	// the recovery profile that was last applied to the osds, and the latest epoch an osd was up from at the time
+	recoveryProfile string
+	recoveryUpFrom  int64
+	// osdsLock serializes the orchestrations of the osds from the cluster updates, the spare replacements and the hotplug watcher
+	osdsLock sync.Mutex
+	// networkCheckLock prevents the network checks of successive orchestrations from overlapping
+	networkCheckLock sync.Mutex
+	// rebalance estimates the time left to rebalance from the samples of the status watcher
+	rebalance *client.RebalanceTracker
 }
 
 func newCluster(c *cephv1beta1.Cluster, context *clusterd.Context) *cluster {
 	return &cluster{Namespace: c.Namespace, Spec: &c.Spec, context: context,
-		stopCh:   make(chan struct{}),
-		ownerRef: ClusterOwnerRef(c.Namespace, string(c.UID))}
+		stopCh:    make(chan struct{}),
+		ownerRef:  ClusterOwnerRef(c.Namespace, string(c.UID)),
+		rebalance: client.NewRebalanceTracker(rebalanceWindow)}
 }
 
 func (c *cluster) createInstance(rookImage string) error {
+	defer metrics.ObserveOrchestration("cluster", time.Now())
 
 	// Create a configmap for overriding ceph config settings
 	// These settings should only be modified by a user after they are initialized
@@ -72,38 +93,136 @@ func (c *cluster) createInstance(rookImage string) error {
 		return fmt.Errorf("failed to create override configmap %s. %+v", c.Namespace, err)
 	}
 
+	if c.Spec.External.Enable {
+		// The daemons of an external cluster are not orchestrated
+		return c.connectExternal()
+	}
+
+	if err := c.Spec.Stretch.Validate(c.Spec.Mon.Count); err != nil {
+		return fmt.Errorf("invalid stretch settings. %+v", err)
+	}
+	if c.Spec.Logs.Forward.Target != "" {
+		if err := logforward.ValidTarget(c.Spec.Logs.Forward.Target); err != nil {
+			return fmt.Errorf("invalid log settings. %+v", err)
+		}
+	}
+	if err := cephv1beta1.ValidateImageProfiles(c.Spec.ImageProfiles); err != nil {
+		return fmt.Errorf("invalid image profiles. %+v", err)
+	}
+
 	// Start the mon pods
-	c.mons = mon.New(c.context, c.Namespace, c.Spec.DataDirHostPath, rookImage, c.Spec.Mon, cephv1beta1.GetMonPlacement(c.Spec.Placement),
+	monPlacement := cephv1beta1.ApplyNodeClasses(cephv1beta1.GetMonPlacement(c.Spec.Placement), c.Spec.NodeClasses, cephv1beta1.PlacementKeyMon)
+	c.mons = mon.New(c.context, c.Namespace, c.Spec.DataDirHostPath, rookImage, c.Spec.Mon, monPlacement,
 		c.Spec.Network.HostNetwork, cephv1beta1.GetMonResources(c.Spec.Resources), c.ownerRef)
+	c.mons.Logs = c.Spec.Logs
+	c.mons.Stretch = c.Spec.Stretch
+	c.mons.AllowFailover = func() bool { return c.maintenanceAllows(cephv1beta1.MaintenanceActionMonFailover) }
+	start := time.Now()
 	err = c.mons.Start()
+	metrics.ObserveOrchestration("mon", start)
 	if err != nil {
 		return fmt.Errorf("failed to start the mons. %+v", err)
 	}
 
+	err = c.mons.RotateAdminKey(c.Spec.Security.AdminKeyGeneration)
+	if err != nil {
+		return fmt.Errorf("failed to rotate the admin key. %+v", err)
+	}
+
+	err = c.configureConnectionSecurity()
+	if err != nil {
+		return fmt.Errorf("failed to configure the connection security. %+v", err)
+	}
+
 	err = c.createInitialCrushMap()
 	if err != nil {
 		return fmt.Errorf("failed to create initial crushmap: %+v", err)
 	}
 
-	c.mgrs = mgr.New(c.context, c.Namespace, rookImage, cephv1beta1.GetMgrPlacement(c.Spec.Placement),
+	mgrPlacement := cephv1beta1.ApplyNodeClasses(cephv1beta1.GetMgrPlacement(c.Spec.Placement), c.Spec.NodeClasses, cephv1beta1.PlacementKeyMgr)
+	c.mgrs = mgr.New(c.context, c.Namespace, rookImage, mgrPlacement,
 		c.Spec.Network.HostNetwork, c.Spec.Dashboard, cephv1beta1.GetMgrResources(c.Spec.Resources), c.ownerRef)
+	c.mgrs.Logs = c.Spec.Logs
+	start = time.Now()
 	err = c.mgrs.Start()
+	metrics.ObserveOrchestration("mgr", start)
 	if err != nil {
 		return fmt.Errorf("failed to start the ceph mgr. %+v", err)
 	}
 
 	// Start the OSDs
+	osdPlacement := cephv1beta1.ApplyNodeClasses(cephv1beta1.GetOSDPlacement(c.Spec.Placement), c.Spec.NodeClasses, cephv1beta1.PlacementKeyOSD)
+	c.osdsLock.Lock()
 	c.osds = osd.New(c.context, c.Namespace, rookImage, c.Spec.ServiceAccount, c.Spec.Storage, c.Spec.DataDirHostPath,
-		cephv1beta1.GetOSDPlacement(c.Spec.Placement), c.Spec.Network.HostNetwork, cephv1beta1.GetOSDResources(c.Spec.Resources), c.ownerRef)
+		osdPlacement, c.Spec.Network.HostNetwork, cephv1beta1.GetOSDResources(c.Spec.Resources), c.ownerRef)
+	c.osds.Logs = c.Spec.Logs
+	c.osds.NodeClasses = c.Spec.NodeClasses
+	c.osds.Stretch = c.Spec.Stretch
+	start = time.Now()
 	err = c.osds.Start()
+	c.osdsLock.Unlock()
+	metrics.ObserveOrchestration("osd", start)
 	if err != nil {
 		return fmt.Errorf("failed to start the osds. %+v", err)
 	}
 
+	// Restart the daemons if requested. A restart that does not complete is attempted again by the restart watcher.
+	if err := c.restartDaemons(); err != nil {
+		logger.Errorf("failed to restart the daemons. %+v", err)
+	}
+
+	if err := c.applyRecoveryProfile(); err != nil {
+		logger.Errorf("failed to apply the recovery profile. %+v", err)
+	}
+
+	// The network check runs in the background since it takes as long as the slowest node
+	go c.checkNetwork(rookImage)
+
 	logger.Infof("Done creating rook instance in namespace %s", c.Namespace)
 	return nil
 }
 
+// provisionSpares starts the osds again so the spare devices that replaced failed osds are provisioned
+func (c *cluster) provisionSpares() {
+	c.osdsLock.Lock()
+	defer c.osdsLock.Unlock()
+	if c.osds == nil {
+		return
+	}
+	start := time.Now()
+	err := c.osds.Start()
+	metrics.ObserveOrchestration("osd", start)
+	if err != nil {
+		logger.Errorf("failed to provision the spare osds. %+v", err)
+	}
+}
+
+// spec returns the current spec of the cluster. The spec is replaced rather than modified by an update, so the spec
+// that is returned stays consistent while the cluster is updated.
+func (c *cluster) spec() *cephv1beta1.ClusterSpec {
+	c.specLock.RLock()
+	defer c.specLock.RUnlock()
+	return c.Spec
+}
+
+// setSpec replaces the spec of the cluster with the spec of an update
+func (c *cluster) setSpec(spec *cephv1beta1.ClusterSpec) {
+	c.specLock.Lock()
+	defer c.specLock.Unlock()
+	c.Spec = spec
+}
+
+// maintenanceAllows returns whether the disruptive action can be done now according to the maintenance windows.
+// The action is deferred if the windows are invalid.
+func (c *cluster) maintenanceAllows(action string) bool {
+	allowed, err := c.spec().Maintenance.Allows(action, time.Now())
+	if err != nil {
+		logger.Errorf("failed to check the maintenance windows of cluster %s. %+v", c.Namespace, err)
+		return false
+	}
+	return allowed
+}
+
 func (c *cluster) createInitialCrushMap() error {
 	configMapExists := false
 	createCrushMap := false
@@ -181,5 +300,61 @@ func clusterChanged(oldCluster, newCluster cephv1beta1.ClusterSpec) bool {
 		changeFound = true
 	}
 
+	if oldCluster.Dashboard.URLPrefix != newCluster.Dashboard.URLPrefix {
+		logger.Infof("dashboard url prefix has changed from %q to %q", oldCluster.Dashboard.URLPrefix, newCluster.Dashboard.URLPrefix)
+		changeFound = true
+	}
+
+	if oldCluster.Security.AdminKeyGeneration != newCluster.Security.AdminKeyGeneration {
+		logger.Infof("admin key generation has changed from %d to %d", oldCluster.Security.AdminKeyGeneration, newCluster.Security.AdminKeyGeneration)
+		changeFound = true
+	}
+
+	if oldCluster.Security.RequireSignatures != newCluster.Security.RequireSignatures ||
+		oldCluster.Security.Encryption != newCluster.Security.Encryption {
+		logger.Infof("connection security has changed from %+v to %+v", oldCluster.Security, newCluster.Security)
+		changeFound = true
+	}
+
+	if oldCluster.NetworkCheck != newCluster.NetworkCheck {
+		logger.Infof("network check settings have changed from %+v to %+v", oldCluster.NetworkCheck, newCluster.NetworkCheck)
+		changeFound = true
+	}
+
+	if !reflect.DeepEqual(oldCluster.NodeClasses, newCluster.NodeClasses) {
+		logger.Infof("node classes have changed from %+v to %+v", oldCluster.NodeClasses, newCluster.NodeClasses)
+		changeFound = true
+	}
+
+	if oldCluster.Logs != newCluster.Logs {
+		logger.Infof("log settings have changed from %+v to %+v", oldCluster.Logs, newCluster.Logs)
+		changeFound = true
+	}
+
+	if oldCluster.Restart.Generation != newCluster.Restart.Generation ||
+		oldCluster.Restart.OnConfigChange != newCluster.Restart.OnConfigChange ||
+		!reflect.DeepEqual(oldCluster.Restart.Daemons, newCluster.Restart.Daemons) {
+		logger.Infof("restart settings have changed from %+v to %+v", oldCluster.Restart, newCluster.Restart)
+		changeFound = true
+	}
+
+	if !reflect.DeepEqual(oldCluster.Maintenance.Windows, newCluster.Maintenance.Windows) ||
+		!reflect.DeepEqual(oldCluster.Maintenance.IgnoreWindows, newCluster.Maintenance.IgnoreWindows) {
+		logger.Infof("maintenance windows have changed from %+v to %+v", oldCluster.Maintenance.Windows, newCluster.Maintenance.Windows)
+		changeFound = true
+	}
+
+	if oldCluster.Recovery.Profile != newCluster.Recovery.Profile ||
+		!reflect.DeepEqual(oldCluster.Recovery.BusinessHours, newCluster.Recovery.BusinessHours) {
+		logger.Infof("recovery settings have changed from %+v to %+v", oldCluster.Recovery, newCluster.Recovery)
+		changeFound = true
+	}
+
+	// the changes that were deferred during the maintenance are applied when it ends
+	if oldCluster.Maintenance.ReadOnly && !newCluster.Maintenance.ReadOnly {
+		logger.Infof("maintenance has ended")
+		changeFound = true
+	}
+
 	return changeFound
 }
@@ -27,11 +27,15 @@ import (
 	opkit "github.com/rook/operator-kit"
 	cephv1beta1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1beta1"
 	rookv1alpha1 "github.com/rook/rook/pkg/apis/rook.io/v1alpha1"
+	rookalpha "github.com/rook/rook/pkg/apis/rook.io/v1alpha2"
 	"github.com/rook/rook/pkg/clusterd"
 	"github.com/rook/rook/pkg/daemon/ceph/agent/flexvolume/attachment"
 
+	"github.com/rook/rook/pkg/operator/ceph/cluster/crash"
 	"github.com/rook/rook/pkg/operator/ceph/cluster/mon"
+	"github.com/rook/rook/pkg/operator/ceph/cluster/notify"
 	"github.com/rook/rook/pkg/operator/ceph/cluster/osd"
+	"github.com/rook/rook/pkg/operator/ceph/cluster/scrub"
 	"github.com/rook/rook/pkg/operator/ceph/file"
 	"github.com/rook/rook/pkg/operator/ceph/object"
 	"github.com/rook/rook/pkg/operator/ceph/pool"
@@ -216,6 +220,53 @@ func (c *ClusterController) onAdd(obj interface{}) {
 	poolController := pool.NewPoolController(c.context)
 	poolController.StartWatch(cluster.Namespace, cluster.stopCh)
 
+	// Start the notifier that posts the events of the cluster to its webhooks
+	notifier := notify.NewNotifier(c.context, cluster.Namespace, cluster.ownerRef)
+	notifier.Spec = func() cephv1beta1.NotificationSpec { return cluster.spec().Notifications }
+	go notifier.Start(cluster.stopCh)
+
+	if cluster.Spec.External.Enable {
+		// Only the pools of an external cluster are managed, its daemons, its images and their health are left to its own tools
+		logger.Infof("cluster in namespace %s is external. not watching its daemons", cluster.Namespace)
+	} else {
+		c.startPoolLoops(cluster)
+		c.startDaemonWatchers(cluster)
+	}
+
+	// add the finalizer to the crd
+	err = c.addFinalizer(clusterObj)
+	if err != nil {
+		logger.Errorf("failed to add finalizer to cluster crd. %+v", err)
+	}
+}
+
+// startPoolLoops starts the background loops that change the pools and images of the cluster
+func (c *ClusterController) startPoolLoops(cluster *cluster) {
+	// Start the collector of the resources left behind by deleted pools
+	orphanCollector := pool.NewOrphanCollector(c.context, cluster.Namespace)
+	go orphanCollector.Start(cluster.stopCh)
+
+	// Start the purger of the expired images in the trash of the pools
+	trashPurger := pool.NewTrashPurger(c.context, cluster.Namespace)
+	go trashPurger.Start(cluster.stopCh)
+
+	// Start the queue that deletes the images of the deleted volumes at a throttled rate
+	imageDeleter := pool.NewImageDeleter(c.context, cluster.Namespace)
+	go imageDeleter.Start(cluster.stopCh)
+
+	// Start the queue that writes the objects of the thick provisioned images
+	imageAllocator := pool.NewImageAllocator(c.context, cluster.Namespace)
+	go imageAllocator.Start(cluster.stopCh)
+
+	// Start the advisor of the pg counts of the pools
+	pgAdvisor := pool.NewPGAdvisor(c.context, cluster.Namespace)
+	pgAdvisor.AllowApply = func() bool { return cluster.maintenanceAllows(cephv1beta1.MaintenanceActionPGGrowth) }
+	go pgAdvisor.Start(cluster.stopCh)
+}
+
+// startDaemonWatchers starts the controllers of the filesystems and object stores and the watchers of the daemons of
+// the cluster
+func (c *ClusterController) startDaemonWatchers(cluster *cluster) {
 	// Start object store CRD watcher
 	objectStoreController := object.NewObjectStoreController(c.context, c.rookImage, cluster.Spec.Network.HostNetwork, cluster.ownerRef)
 	objectStoreController.StartWatch(cluster.Namespace, cluster.stopCh)
@@ -230,13 +281,41 @@ func (c *ClusterController) onAdd(obj interface{}) {
 
 	// Start the osd health checker
 	osdChecker := osd.NewMonitor(c.context, cluster.Namespace)
+	osdChecker.ProvisionSpares = cluster.provisionSpares
+	osdChecker.AllowSpareReplace = func() bool { return cluster.maintenanceAllows(cephv1beta1.MaintenanceActionSpareReplace) }
 	go osdChecker.Start(cluster.stopCh)
 
-	// add the finalizer to the crd
-	err = c.addFinalizer(clusterObj)
-	if err != nil {
-		logger.Errorf("failed to add finalizer to cluster crd. %+v", err)
-	}
+	// Start the watcher that provisions the osds on the devices added to the nodes
+	hotplugWatcher := osd.NewHotplugWatcher(c.context, cluster.Namespace)
+	hotplugWatcher.Storage = func() rookalpha.StorageScopeSpec { return cluster.spec().Storage }
+	hotplugWatcher.Provision = cluster.provisionSpares
+	go hotplugWatcher.Start(cluster.stopCh)
+
+	// Start the analysis of the latencies of the osds
+	latencyAnalyzer := osd.NewLatencyAnalyzer(c.context, cluster.Namespace)
+	go latencyAnalyzer.Start(cluster.stopCh)
+
+	// Start the controller that weights in the osds gradually
+	weightController := osd.NewWeightController(c.context, cluster.Namespace)
+	weightController.AllowReweight = func() bool { return cluster.maintenanceAllows(cephv1beta1.MaintenanceActionReweight) }
+	go weightController.Start(cluster.stopCh)
+
+	// Start the collector of the crash reports of the daemons
+	crashCollector := crash.NewCollector(c.context, cluster.Namespace)
+	go crashCollector.Start(cluster.stopCh)
+
+	// Start the monitor that keeps the history of the scrubs of the pgs
+	scrubMonitor := scrub.NewMonitor(c.context, cluster.Namespace)
+	go scrubMonitor.Start(cluster.stopCh)
+
+	// Start the watcher that restarts the daemons when the config override changes or a maintenance window opens
+	go cluster.watchRestarts()
+
+	// Start the watcher that switches the recovery profile of the osds during the business hours
+	go cluster.watchRecoveryProfile()
+
+	// Start the watcher that reports the progress of the rebalance and the health of the sites in the status of the cluster
+	go cluster.watchStatus()
 }
 
 // ************************************************************************************************
@@ -290,6 +369,11 @@ func (c *ClusterController) onUpdate(oldObj, newObj interface{}) {
 		return
 	}
 
+	if newClust.Spec.Maintenance.ReadOnly {
+		logger.Infof("cluster %s is in maintenance (%s). deferring the update until the maintenance ends", newClust.Namespace, newClust.Spec.Maintenance.Reason)
+		return
+	}
+
 	if !clusterChanged(oldClust.Spec, newClust.Spec) {
 		logger.Infof("update event for cluster %s is not supported", newClust.Namespace)
 		return
@@ -304,7 +388,7 @@ func (c *ClusterController) onUpdate(oldObj, newObj interface{}) {
 		logger.Errorf("Cannot update cluster %s that does not exist", newClust.Namespace)
 		return
 	}
-	cluster.Spec = &newClust.Spec
+	cluster.setSpec(&newClust.Spec)
 
 	// attempt to update the cluster.  note this is done outside of wait.Poll because that function
 	// will wait for the retry interval before trying for the first time.
@@ -529,8 +613,9 @@ func (c *ClusterController) updateClusterStatus(namespace, name string, state ce
 		return fmt.Errorf("failed to get cluster from namespace %s prior to updating its status: %+v", namespace, err)
 	}
 
-	// update the status on the retrieved cluster object
-	cluster.Status = cephv1beta1.ClusterStatus{State: state, Message: message}
+	// update the status on the retrieved cluster object, keeping the crashes reported by the crash collector
+	cluster.Status.State = state
+	cluster.Status.Message = message
 	if _, err := c.context.RookClientset.CephV1beta1().Clusters(cluster.Namespace).Update(cluster); err != nil {
 		return fmt.Errorf("failed to update cluster %s status: %+v", cluster.Namespace, err)
 	}
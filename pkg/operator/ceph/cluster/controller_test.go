@@ -151,6 +151,18 @@ func TestClusterChanged(t *testing.T) {
 		{Name: "node1", Selection: rookalpha.Selection{Devices: []rookalpha.Device{{Name: "sda"}}}},
 	}
 	assert.False(t, clusterChanged(old, new))
+
+	// a new admin key generation should be a change
+	new.Security.AdminKeyGeneration = 1
+	assert.True(t, clusterChanged(old, new))
+
+	// the end of the maintenance should be a change to apply the deferred updates
+	old.Security.AdminKeyGeneration = 1
+	old.Maintenance.ReadOnly = true
+	assert.True(t, clusterChanged(old, new))
+	old.Maintenance.ReadOnly = false
+	new.Maintenance.ReadOnly = true
+	assert.False(t, clusterChanged(old, new))
 }
 
 func TestRemoveFinalizer(t *testing.T) {
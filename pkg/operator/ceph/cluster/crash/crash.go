@@ -0,0 +1,357 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package crash collects the crash reports of the ceph daemons from the output of their crashed containers
+package crash
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/coreos/pkg/capnslog"
+	"github.com/rook/rook/pkg/clusterd"
+	"github.com/rook/rook/pkg/operator/ceph/settings"
+	"github.com/rook/rook/pkg/operator/k8sutil"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var logger = capnslog.NewPackageLogger("github.com/rook/rook", "op-crash")
+
+const (
+	// ConfigMapName is the config map where the crash reports are kept, with a report for each crash signature
+	ConfigMapName = "rook-ceph-crash"
+	appPrefix     = "rook-ceph-"
+	// the number of lines read from the end of the output of a crashed container
+	tailLines = 500
+	// the number of frames of the backtrace in the signature of a crash
+	signatureFrames = 10
+	maxReportPods   = 10
+)
+
+var (
+	// CheckInterval is the interval to check the pods of the daemons for crashed containers
+	CheckInterval = settings.NewDuration(5 * time.Minute)
+	// RecentCrashAge is how long a crash is counted in the new crashes of the cluster status, which is the same as
+	// the interval of the RECENT_CRASH health warning of ceph
+	RecentCrashAge = 14 * 24 * time.Hour
+
+	signalRegex = regexp.MustCompile(`\*\*\* Caught signal \((.+?)\) \*\*`)
+	assertRegex = regexp.MustCompile(`FAILED (?:ceph_)?assert\((.+)\)`)
+	frameRegex  = regexp.MustCompile(`(?:^|\s)\d+: \((.*?)(?:\+0x[0-9a-f]+)?\) \[0x[0-9a-f]+\]`)
+)
+
+// Report is a crash of the daemons with the same backtrace. The crashes are deduplicated by their signature, which
+// is a hash of the daemon type, the signal or assert, and the functions of the top frames of the backtrace.
+type Report struct {
+	Signature  string    `json:"signature"`
+	DaemonType string    `json:"daemonType"`
+	Signal     string    `json:"signal,omitempty"`
+	Assert     string    `json:"assert,omitempty"`
+	Backtrace  []string  `json:"backtrace"`
+	Count      int       `json:"count"`
+	FirstSeen  time.Time `json:"firstSeen"`
+	LastSeen   time.Time `json:"lastSeen"`
+	// The most recent pods where the crash happened
+	Pods []string `json:"pods"`
+}
+
+// foundCrash is a crash of a container found by the collector
+type foundCrash struct {
+	report *Report
+	pod    string
+	at     time.Time
+}
+
+// Collector periodically collects the crash reports of the daemons from the output of their containers that
+// terminated after a crash
+type Collector struct {
+	context   *clusterd.Context
+	namespace string
+	// the last terminations of the containers that were already checked for a crash. the terminations that are no
+	// longer the last termination of an existing container are forgotten.
+	checked map[string]bool
+	// getLogs returns the output of the previous instance of the container of the pod
+	getLogs func(pod, container string) (string, error)
+}
+
+// NewCollector creates a new crash collector for the cluster in the namespace
+func NewCollector(context *clusterd.Context, namespace string) *Collector {
+	c := &Collector{context: context, namespace: namespace, checked: map[string]bool{}}
+	c.getLogs = c.previousLogs
+	return c
+}
+
+// Start periodically checks the pods of the daemons for crashes
+func (c *Collector) Start(stopCh chan struct{}) {
+	for {
+		select {
+		case <-stopCh:
+			logger.Infof("stopping the crash collector in namespace %s", c.namespace)
+			return
+
+		case <-time.After(CheckInterval.Get()):
+			if err := c.Collect(); err != nil {
+				logger.Warningf("failed to collect the crashes in namespace %s. %+v", c.namespace, err)
+			}
+		}
+	}
+}
+
+// Collect reads the backtraces of the containers of the daemons that terminated since the last check, adds them to
+// the crash reports and updates the number of new crashes in the status of the cluster
+func (c *Collector) Collect() error {
+	pods, err := c.context.Clientset.CoreV1().Pods(c.namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list pods. %+v", err)
+	}
+	reports, err := c.loadReports()
+	if err != nil {
+		return err
+	}
+
+	crashes := []foundCrash{}
+	terminations := map[string]bool{}
+	// the terminations are only marked as checked once their output is fetched and their crashes are saved, so that
+	// they are checked again after a failure
+	checked := []string{}
+	for _, pod := range pods.Items {
+		app := pod.Labels[k8sutil.AppAttr]
+		if !strings.HasPrefix(app, appPrefix) {
+			continue
+		}
+		for _, status := range pod.Status.ContainerStatuses {
+			terminated := status.LastTerminationState.Terminated
+			if terminated == nil || terminated.ExitCode == 0 {
+				continue
+			}
+			key := fmt.Sprintf("%s/%s/%d", pod.Name, status.Name, status.RestartCount)
+			terminations[key] = true
+			if c.checked[key] {
+				continue
+			}
+
+			output, err := c.getLogs(pod.Name, status.Name)
+			if err != nil {
+				logger.Warningf("failed to get the output of the crashed container %s of pod %s. %+v", status.Name, pod.Name, err)
+				continue
+			}
+			checked = append(checked, key)
+			report := ParseBacktrace(strings.TrimPrefix(app, appPrefix), output)
+			if report == nil {
+				logger.Debugf("no backtrace in the output of container %s of pod %s that exited with code %d",
+					status.Name, pod.Name, terminated.ExitCode)
+				continue
+			}
+			crashes = append(crashes, foundCrash{report: report, pod: pod.Name, at: terminated.FinishedAt.Time})
+		}
+	}
+	for key := range c.checked {
+		if !terminations[key] {
+			delete(c.checked, key)
+		}
+	}
+
+	// the crashes are added in the order they happened to count the crashes of a signature past its last crash
+	sort.Slice(crashes, func(i, j int) bool { return crashes[i].at.Before(crashes[j].at) })
+	changed := false
+	for _, crash := range crashes {
+		if addCrash(reports, crash.report, crash.pod, crash.at) {
+			changed = true
+		}
+	}
+
+	if changed {
+		if err := c.saveReports(reports); err != nil {
+			return err
+		}
+	}
+	for _, key := range checked {
+		c.checked[key] = true
+	}
+	return c.updateStatus(NewCrashes(reports, time.Now()))
+}
+
+// ParseBacktrace returns the crash report of the backtrace in the output of a daemon, or nil if the output has no
+// backtrace
+func ParseBacktrace(daemonType, output string) *Report {
+	report := &Report{DaemonType: daemonType, Backtrace: []string{}}
+	lines := strings.Split(output, "\n")
+	start := -1
+	for i, line := range lines {
+		if m := signalRegex.FindStringSubmatch(line); m != nil {
+			report.Signal = m[1]
+			start = i
+		}
+		if m := assertRegex.FindStringSubmatch(line); m != nil {
+			report.Assert = m[1]
+			if start == -1 {
+				start = i
+			}
+		}
+	}
+	if start == -1 {
+		return nil
+	}
+
+	// the frames after the signal or assert are the backtrace of the crashed thread
+	for _, line := range lines[start:] {
+		m := frameRegex.FindStringSubmatch(line)
+		if m == nil {
+			if len(report.Backtrace) > 0 {
+				break
+			}
+			continue
+		}
+		// the frames without a symbol, such as (()+0x4f6a34), have addresses that change with the builds of the daemon
+		if m[1] != "()" {
+			report.Backtrace = append(report.Backtrace, m[1])
+		}
+	}
+
+	frames := report.Backtrace
+	if len(frames) > signatureFrames {
+		frames = frames[:signatureFrames]
+	}
+	h := sha256.Sum256([]byte(strings.Join(append([]string{daemonType, report.Signal, report.Assert}, frames...), "\n")))
+	report.Signature = hex.EncodeToString(h[:])[:16]
+	return report
+}
+
+// addCrash adds the crash to the report with the same signature and returns whether the reports changed. A crash that
+// is not newer than the last crash of its report was already added before the operator restarted.
+func addCrash(reports map[string]*Report, crash *Report, pod string, at time.Time) bool {
+	report, ok := reports[crash.Signature]
+	if !ok {
+		logger.Warningf("new crash %s of daemon %s in pod %s. signal=%q assert=%q backtrace=%v",
+			crash.Signature, crash.DaemonType, pod, crash.Signal, crash.Assert, crash.Backtrace)
+		crash.FirstSeen = at
+		reports[crash.Signature] = crash
+		report = crash
+	} else if !at.After(report.LastSeen) {
+		return false
+	} else {
+		logger.Warningf("crash %s of daemon %s happened again in pod %s", crash.Signature, crash.DaemonType, pod)
+	}
+
+	report.Count++
+	report.LastSeen = at
+	pods := []string{pod}
+	for _, p := range report.Pods {
+		if p != pod && len(pods) < maxReportPods {
+			pods = append(pods, p)
+		}
+	}
+	report.Pods = pods
+	return true
+}
+
+// NewCrashes returns the number of crash reports with a crash in the recent crash age
+func NewCrashes(reports map[string]*Report, now time.Time) int {
+	count := 0
+	for _, report := range reports {
+		if now.Sub(report.LastSeen) < RecentCrashAge {
+			count++
+		}
+	}
+	return count
+}
+
+// ListReports returns the crash reports of the cluster, most recent first
+func ListReports(context *clusterd.Context, namespace string) ([]Report, error) {
+	c := &Collector{context: context, namespace: namespace}
+	reports, err := c.loadReports()
+	if err != nil {
+		return nil, err
+	}
+	result := []Report{}
+	for _, report := range reports {
+		result = append(result, *report)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].LastSeen.After(result[j].LastSeen) })
+	return result, nil
+}
+
+func (c *Collector) previousLogs(pod, container string) (string, error) {
+	lines := int64(tailLines)
+	opts := &v1.PodLogOptions{Container: container, Previous: true, TailLines: &lines}
+	output, err := c.context.Clientset.CoreV1().Pods(c.namespace).GetLogs(pod, opts).Do().Raw()
+	if err != nil {
+		return "", err
+	}
+	return string(output), nil
+}
+
+func (c *Collector) loadReports() (map[string]*Report, error) {
+	reports := map[string]*Report{}
+	cm, err := c.context.Clientset.CoreV1().ConfigMaps(c.namespace).Get(ConfigMapName, metav1.GetOptions{})
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return reports, nil
+		}
+		return nil, fmt.Errorf("failed to get configmap %s. %+v", ConfigMapName, err)
+	}
+	for signature, data := range cm.Data {
+		var report Report
+		if err := json.Unmarshal([]byte(data), &report); err != nil {
+			logger.Errorf("failed to unmarshal the crash report %s. %+v", signature, err)
+			continue
+		}
+		reports[signature] = &report
+	}
+	return reports, nil
+}
+
+func (c *Collector) saveReports(reports map[string]*Report) error {
+	data := map[string]string{}
+	for signature, report := range reports {
+		d, err := json.Marshal(report)
+		if err != nil {
+			return fmt.Errorf("failed to marshal the crash report %s. %+v", signature, err)
+		}
+		data[signature] = string(d)
+	}
+
+	return k8sutil.ModifyConfigMap(c.context.Clientset, c.namespace, ConfigMapName, nil, func(cm *v1.ConfigMap) {
+		cm.Data = data
+	})
+}
+
+// updateStatus sets the number of new crashes in the status of the cluster crd
+func (c *Collector) updateStatus(newCrashes int) error {
+	clusters, err := c.context.RookClientset.CephV1beta1().Clusters(c.namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list clusters. %+v", err)
+	}
+	for i := range clusters.Items {
+		cluster := &clusters.Items[i]
+		if cluster.Status.NewCrashes == newCrashes {
+			continue
+		}
+		cluster.Status.NewCrashes = newCrashes
+		if _, err := c.context.RookClientset.CephV1beta1().Clusters(c.namespace).Update(cluster); err != nil {
+			return fmt.Errorf("failed to update the crashes in the status of cluster %s. %+v", cluster.Name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package crash
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	cephv1beta1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1beta1"
+	rookfake "github.com/rook/rook/pkg/client/clientset/versioned/fake"
+	"github.com/rook/rook/pkg/clusterd"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const assertOutput = `2018-07-10 10:00:00.000000 I | osd0: 2018-07-10 10:00:00.000 7f1 -1 starting osd.0
+/build/ceph/src/osd/OSD.cc: 7720: FAILED assert(p != added_maps_bl.end())
+ ceph version 13.2.0 (79a10589f1f80dfe21e8f9794365ed98143071c4) mimic (stable)
+ 1: (ceph::__ceph_assert_fail(char const*, char const*, int, char const*)+0x102) [0x7f6a4c04b0f2]
+ 2: (()+0x26b2b7) [0x7f6a4c04b2b7]
+ 3: (OSD::handle_osd_map(MOSDMap*)+0x1a5f) [0x55d5b1f0e52f]
+ 4: (OSD::_dispatch(Message*)+0xa1) [0x55d5b1f10a41]
+ NOTE: a copy of the executable, or ` + "`objdump -rdS <executable>`" + ` is needed to interpret this.
+*** Caught signal (Aborted) **
+ in thread 7f6a3b0f0700 thread_name:ms_dispatch
+ 1: (()+0x4f6a34) [0x55d5b1e0fa34]
+ 2: (()+0x11390) [0x7f6a4b4a1390]
+ 3: (gsignal()+0x38) [0x7f6a4a9d0428]
+ 4: (abort()+0x16a) [0x7f6a4a9d202a]
+ 5: (ceph::__ceph_assert_fail(char const*, char const*, int, char const*)+0x250) [0x7f6a4c04b240]
+ 6: (OSD::handle_osd_map(MOSDMap*)+0x1a5f) [0x55d5b1f0e52f]
+ NOTE: a copy of the executable is needed to interpret this.`
+
+func TestParseBacktrace(t *testing.T) {
+	report := ParseBacktrace("osd", assertOutput)
+	assert.NotNil(t, report)
+	assert.Equal(t, "osd", report.DaemonType)
+	assert.Equal(t, "Aborted", report.Signal)
+	assert.Equal(t, "p != added_maps_bl.end()", report.Assert)
+	// the backtrace of the signal handler without the frames that have no symbol
+	assert.Equal(t, []string{"gsignal()", "abort()", "ceph::__ceph_assert_fail(char const*, char const*, int, char const*)",
+		"OSD::handle_osd_map(MOSDMap*)"}, report.Backtrace)
+	assert.Equal(t, 16, len(report.Signature))
+
+	// the signature does not depend on the addresses of the frames
+	other := ParseBacktrace("osd", `*** Caught signal (Aborted) **
+ 1: (()+0x1234) [0x55d5b1e01234]
+ 3: (gsignal()+0x38) [0x7f000000a428]
+ 4: (abort()+0x16a) [0x7f000000c02a]
+ 5: (ceph::__ceph_assert_fail(char const*, char const*, int, char const*)+0x250) [0x7f0000001240]
+ 6: (OSD::handle_osd_map(MOSDMap*)+0x1a5f) [0x55d500000e52f]
+FAILED assert(p != added_maps_bl.end())`)
+	assert.Equal(t, report.Signature, other.Signature)
+	assert.NotEqual(t, report.Signature, ParseBacktrace("mon", assertOutput).Signature)
+
+	// a segfault without an assert
+	report = ParseBacktrace("mon", "*** Caught signal (Segmentation fault) **\n 1: (Monitor::tick()+0x10) [0x1234]")
+	assert.Equal(t, "Segmentation fault", report.Signal)
+	assert.Equal(t, "", report.Assert)
+	assert.Equal(t, []string{"Monitor::tick()"}, report.Backtrace)
+
+	assert.Nil(t, ParseBacktrace("mon", "failed to start mon: exit status 1"))
+}
+
+func crashedPod(name, app string, restarts int32, exitCode int32, finishedAt time.Time) *v1.Pod {
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "ns", Labels: map[string]string{"app": app}},
+		Status: v1.PodStatus{ContainerStatuses: []v1.ContainerStatus{{
+			Name:         app,
+			RestartCount: restarts,
+			LastTerminationState: v1.ContainerState{Terminated: &v1.ContainerStateTerminated{
+				ExitCode:   exitCode,
+				FinishedAt: metav1.NewTime(finishedAt),
+			}},
+		}}},
+	}
+}
+
+func TestCollect(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	clientset := fake.NewSimpleClientset(
+		crashedPod("rook-ceph-osd-0-abc", "rook-ceph-osd", 1, 134, now.Add(-time.Hour)),
+		crashedPod("rook-ceph-osd-1-def", "rook-ceph-osd", 3, 134, now.Add(-time.Minute)),
+		crashedPod("rook-ceph-mon-a-ghi", "rook-ceph-mon", 1, 1, now),
+		crashedPod("myapp", "myapp", 1, 134, now))
+	rookClientset := rookfake.NewSimpleClientset(&cephv1beta1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "ns", Namespace: "ns"}})
+	context := &clusterd.Context{Clientset: clientset, RookClientset: rookClientset}
+
+	fetched := 0
+	c := NewCollector(context, "ns")
+	c.getLogs = func(pod, container string) (string, error) {
+		fetched++
+		if container == "rook-ceph-osd" {
+			return assertOutput, nil
+		}
+		return "failed to start mon: exit status 1", nil
+	}
+
+	// the same crash of two osds is reported once
+	err := c.Collect()
+	assert.Nil(t, err)
+	assert.Equal(t, 3, fetched)
+	reports, err := ListReports(context, "ns")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(reports))
+	assert.Equal(t, 2, reports[0].Count)
+	assert.Equal(t, []string{"rook-ceph-osd-1-def", "rook-ceph-osd-0-abc"}, reports[0].Pods)
+	assert.True(t, now.Add(-time.Hour).Equal(reports[0].FirstSeen))
+	assert.True(t, now.Add(-time.Minute).Equal(reports[0].LastSeen))
+	cluster, _ := rookClientset.CephV1beta1().Clusters("ns").Get("ns", metav1.GetOptions{})
+	assert.Equal(t, 1, cluster.Status.NewCrashes)
+
+	// the crashes that were already checked are not counted again, even after the operator restarts
+	err = c.Collect()
+	assert.Nil(t, err)
+	assert.Equal(t, 3, fetched)
+	assert.Equal(t, 3, len(c.checked))
+
+	// the checked crashes of the deleted pods are forgotten
+	err = clientset.CoreV1().Pods("ns").Delete("rook-ceph-osd-1-def", &metav1.DeleteOptions{})
+	assert.Nil(t, err)
+	err = c.Collect()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(c.checked))
+	c = NewCollector(context, "ns")
+	c.getLogs = func(pod, container string) (string, error) { return assertOutput, nil }
+	err = c.Collect()
+	assert.Nil(t, err)
+	reports, _ = ListReports(context, "ns")
+	assert.Equal(t, 2, reports[0].Count)
+
+	// the output of a crash is fetched again after a failure
+	_, err = clientset.CoreV1().Pods("ns").Create(crashedPod("rook-ceph-osd-2-jkl", "rook-ceph-osd", 1, 134, now))
+	assert.Nil(t, err)
+	c.getLogs = func(pod, container string) (string, error) { return "", fmt.Errorf("mock failure") }
+	err = c.Collect()
+	assert.Nil(t, err)
+	assert.False(t, c.checked["rook-ceph-osd-2-jkl/rook-ceph-osd/1"])
+	c.getLogs = func(pod, container string) (string, error) { return assertOutput, nil }
+	err = c.Collect()
+	assert.Nil(t, err)
+	assert.True(t, c.checked["rook-ceph-osd-2-jkl/rook-ceph-osd/1"])
+	reports, _ = ListReports(context, "ns")
+	assert.Equal(t, 3, reports[0].Count)
+
+	// old crashes are not new anymore
+	assert.Equal(t, 0, NewCrashes(map[string]*Report{"a": &reports[0]}, now.Add(RecentCrashAge)))
+}
@@ -0,0 +1,45 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cluster
+
+import (
+	"fmt"
+
+	"github.com/rook/rook/pkg/operator/ceph/cluster/mon"
+)
+
+// connectExternal connects to a cluster whose daemons are managed outside of rook. The mons and the admin key of the
+// cluster are loaded from the mon endpoints configmap and the mon secret that were created with the cluster crd.
+// No daemons are started and the cluster is not changed.
+func (c *cluster) connectExternal() error {
+	clusterInfo, _, _, err := mon.LoadClusterInfo(c.context, c.Namespace)
+	if err != nil {
+		return fmt.Errorf("failed to load the info of the external cluster. %+v", err)
+	}
+	if clusterInfo.Name == "" || clusterInfo.AdminSecret == "" {
+		return fmt.Errorf("the cluster name and the admin key of the external cluster are required")
+	}
+	if len(clusterInfo.Monitors) == 0 {
+		return fmt.Errorf("no mons of the external cluster found in configmap %s", mon.EndpointConfigMapName)
+	}
+
+	if err := mon.WriteConnectionConfig(c.context, clusterInfo); err != nil {
+		return err
+	}
+	logger.Infof("connected to external cluster %s with %d mons in namespace %s", clusterInfo.Name, len(clusterInfo.Monitors), c.Namespace)
+	return nil
+}
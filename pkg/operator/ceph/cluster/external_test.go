@@ -0,0 +1,66 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cluster
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	cephv1beta1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1beta1"
+	"github.com/rook/rook/pkg/clusterd"
+	"github.com/rook/rook/pkg/operator/ceph/cluster/mon"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestConnectExternal(t *testing.T) {
+	configDir, _ := ioutil.TempDir("", "")
+	defer os.RemoveAll(configDir)
+	clientset := fake.NewSimpleClientset()
+	context := &clusterd.Context{Clientset: clientset, ConfigDir: configDir}
+	c := newCluster(&cephv1beta1.Cluster{ObjectMeta: metav1.ObjectMeta{Namespace: "ns"}}, context)
+	c.Spec.External.Enable = true
+
+	// the secret with the keys of the cluster is required
+	assert.NotNil(t, c.createInstance("rook/rook:myversion"))
+
+	secret := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "rook-ceph-mon", Namespace: "ns"},
+		Data:       map[string][]byte{"cluster-name": []byte("ext"), "fsid": []byte("abc"), "admin-secret": []byte("key")},
+	}
+	_, err := clientset.CoreV1().Secrets("ns").Create(secret)
+	assert.Nil(t, err)
+
+	// the mons of the cluster are required
+	assert.NotNil(t, c.createInstance("rook/rook:myversion"))
+
+	cm := &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: mon.EndpointConfigMapName, Namespace: "ns"},
+		Data:       map[string]string{mon.EndpointDataKey: "a=10.0.0.1:6789,b=10.0.0.2:6789"},
+	}
+	_, err = clientset.CoreV1().ConfigMaps("ns").Create(cm)
+	assert.Nil(t, err)
+
+	// the connection config is written without starting any daemons
+	assert.Nil(t, c.createInstance("rook/rook:myversion"))
+	_, err = os.Stat(path.Join(configDir, "ext", "ext.config"))
+	assert.Nil(t, err)
+	assert.Nil(t, c.mons)
+}
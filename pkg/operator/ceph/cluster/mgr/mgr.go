@@ -20,6 +20,7 @@ package mgr
 import (
 	"fmt"
 	"strconv"
+	"strings"
 
 	"github.com/coreos/pkg/capnslog"
 	cephv1beta1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1beta1"
@@ -41,8 +42,10 @@ const (
 	keyringName          = "keyring"
 	prometheusModuleName = "prometheus"
 	dashboardModuleName  = "dashboard"
-	metricsPort          = 9283
-	dashboardPort        = 7000
+	// the mgr option of the path the dashboard is served at
+	dashboardURLPrefixOption = "mgr/dashboard/url_prefix"
+	metricsPort              = 9283
+	dashboardPort            = 7000
 )
 
 var mgrNames = []string{"a", "b"}
@@ -59,6 +62,8 @@ type Cluster struct {
 	resources   v1.ResourceRequirements
 	ownerRef    metav1.OwnerReference
 	dashboard   cephv1beta1.DashboardSpec
+	// Logs are the log settings of the cluster, of which the mgrs only use the forwarding of the logs
+	Logs cephv1beta1.LogSpec
 }
 
 // New creates an instance of the mgr
@@ -124,6 +129,12 @@ func (c *Cluster) Start() error {
 }
 
 func (c *Cluster) configureDashboard() error {
+	if c.dashboard.Enabled {
+		if err := c.configureDashboardURLPrefix(c.Namespace); err != nil {
+			return fmt.Errorf("failed to set the url prefix of the dashboard. %+v", err)
+		}
+	}
+
 	// enable or disable the dashboard module
 	if err := c.configureDashboardModule(c.Namespace, c.dashboard.Enabled); err != nil {
 		return fmt.Errorf("failed to enable mgr dashboard module. %+v", err)
@@ -202,6 +213,15 @@ func (c *Cluster) makeDashboardService(name string) *v1.Service {
 
 func (c *Cluster) makeDeployment(name, daemonName string) *extensions.Deployment {
 
+	container := c.mgrContainer(name, daemonName)
+	volumes := []v1.Volume{
+		{Name: k8sutil.DataDirVolume, VolumeSource: v1.VolumeSource{EmptyDir: &v1.EmptyDirVolumeSource{}}},
+		k8sutil.ConfigOverrideVolume(),
+	}
+	if volume, mount := opmon.LogForwardVolume(c.Logs); volume != nil {
+		volumes = append(volumes, *volume)
+		container.VolumeMounts = append(container.VolumeMounts, *mount)
+	}
 	podSpec := v1.PodTemplateSpec{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:   name,
@@ -210,13 +230,10 @@ func (c *Cluster) makeDeployment(name, daemonName string) *extensions.Deployment
 				"prometheus.io/port": strconv.Itoa(metricsPort)},
 		},
 		Spec: v1.PodSpec{
-			Containers:    []v1.Container{c.mgrContainer(name, daemonName)},
+			Containers:    []v1.Container{container},
 			RestartPolicy: v1.RestartPolicyAlways,
-			Volumes: []v1.Volume{
-				{Name: k8sutil.DataDirVolume, VolumeSource: v1.VolumeSource{EmptyDir: &v1.EmptyDirVolumeSource{}}},
-				k8sutil.ConfigOverrideVolume(),
-			},
-			HostNetwork: c.HostNetwork,
+			Volumes:       volumes,
+			HostNetwork:   c.HostNetwork,
 		},
 	}
 	if c.HostNetwork {
@@ -238,7 +255,7 @@ func (c *Cluster) makeDeployment(name, daemonName string) *extensions.Deployment
 
 func (c *Cluster) mgrContainer(name, daemonName string) v1.Container {
 
-	return v1.Container{
+	container := v1.Container{
 		Args: []string{
 			"ceph",
 			"mgr",
@@ -280,6 +297,8 @@ func (c *Cluster) mgrContainer(name, daemonName string) v1.Container {
 			},
 		},
 	}
+	container.Env = append(container.Env, opmon.LogForwardEnvVars(c.Logs, c.Namespace, fmt.Sprintf("mgr.%s", daemonName))...)
+	return container
 }
 
 func (c *Cluster) getLabels() map[string]string {
@@ -355,6 +374,55 @@ func (c *Cluster) configureDashboardModule(clusterName string, enable bool) erro
 	return nil
 }
 
+// configureDashboardURLPrefix sets the path the dashboard is served at. The dashboard module only reads the prefix
+// when it starts, so the module is disabled when the prefix changes and enabled again with the new prefix. The prefix
+// is stored in the config database of the mons since mimic, and in their key/value store before.
+func (c *Cluster) configureDashboardURLPrefix(clusterName string) error {
+	features, err := client.DetectFeatures(c.context, clusterName)
+	if err != nil {
+		return fmt.Errorf("failed to detect the ceph version. %+v", err)
+	}
+
+	var current string
+	if features.ConfigDatabase {
+		current, _, err = client.GetStoredConfig(c.context, clusterName, "mgr", dashboardURLPrefixOption)
+	} else {
+		current, _, err = client.GetConfigKey(c.context, clusterName, dashboardURLPrefixOption)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get the current url prefix. %+v", err)
+	}
+	prefix := normalizeURLPrefix(c.dashboard.URLPrefix)
+	if current == prefix {
+		return nil
+	}
+
+	switch {
+	case features.ConfigDatabase && prefix == "":
+		err = client.RemoveConfig(c.context, clusterName, "mgr", dashboardURLPrefixOption)
+	case features.ConfigDatabase:
+		err = client.SetConfig(c.context, clusterName, "mgr", dashboardURLPrefixOption, prefix)
+	case prefix == "":
+		err = client.RemoveConfigKey(c.context, clusterName, dashboardURLPrefixOption)
+	default:
+		err = client.SetConfigKey(c.context, clusterName, dashboardURLPrefixOption, prefix)
+	}
+	if err != nil {
+		return err
+	}
+	logger.Infof("dashboard url prefix changed from %q to %q", current, prefix)
+	return client.MgrDisableModule(c.context, clusterName, dashboardModuleName)
+}
+
+// normalizeURLPrefix returns the prefix with a leading slash and without a trailing slash, as the dashboard expects
+func normalizeURLPrefix(prefix string) string {
+	prefix = strings.Trim(strings.TrimSpace(prefix), "/")
+	if prefix == "" {
+		return ""
+	}
+	return "/" + prefix
+}
+
 func getKeyringProperties(name string) (string, []string) {
 	username := fmt.Sprintf("mgr.%s", name)
 	access := []string{"mon", "allow *"}
@@ -20,6 +20,7 @@ import (
 	"io/ioutil"
 	"os"
 	"strconv"
+	"strings"
 	"testing"
 
 	cephv1beta1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1beta1"
@@ -37,6 +38,12 @@ import (
 func TestStartMGR(t *testing.T) {
 	executor := &exectest.MockExecutor{
 		MockExecuteCommandWithOutputFile: func(debug bool, actionName string, command string, outFileArg string, args ...string) (string, error) {
+			switch args[0] {
+			case "versions":
+				return `{"overall":{"ceph version 12.2.7 (abcdef) luminous (stable)":3}}`, nil
+			case "config-key":
+				return "[]", nil
+			}
 			return "{\"key\":\"mysecurekey\"}", nil
 		},
 	}
@@ -86,6 +93,84 @@ func validateStart(t *testing.T, c *Cluster) {
 	}
 }
 
+func TestDashboardURLPrefix(t *testing.T) {
+	version := "13.2.1"
+	prefix := ""
+	var commands []string
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithOutputFile: func(debug bool, actionName string, command string, outFileArg string, args ...string) (string, error) {
+			switch {
+			case args[0] == "versions":
+				return fmt.Sprintf(`{"overall":{"ceph version %s (abcdef) release (stable)":3}}`, version), nil
+			case args[0] == "config" && args[1] == "dump":
+				if prefix == "" {
+					return `[{"section":"global","name":"mon_allow_pool_delete","value":"true"}]`, nil
+				}
+				return fmt.Sprintf(`[{"section":"mgr","name":"mgr/dashboard/url_prefix","value":"%s"}]`, prefix), nil
+			case args[0] == "config-key" && args[1] == "ls":
+				if prefix == "" {
+					return `["mgr/dashboard/server_port"]`, nil
+				}
+				return `["mgr/dashboard/url_prefix"]`, nil
+			case args[0] == "config-key" && args[1] == "get":
+				return prefix + "\n", nil
+			case args[0] == "config" && args[1] == "set":
+				prefix = args[4]
+			case args[0] == "config-key" && args[1] == "set":
+				prefix = args[3]
+			case args[1] == "rm":
+				prefix = ""
+			}
+			if args[1] != "dump" && args[1] != "ls" && args[1] != "get" {
+				commands = append(commands, strings.Join(args[:3], " "))
+			}
+			return "", nil
+		},
+	}
+	c := &Cluster{context: &clusterd.Context{Executor: executor}, Namespace: "ns"}
+
+	// the module is restarted when the prefix is set
+	c.dashboard.URLPrefix = "ui/"
+	assert.Nil(t, c.configureDashboardURLPrefix("ns"))
+	assert.Equal(t, "/ui", prefix)
+	assert.Equal(t, []string{"config set mgr", "mgr module disable"}, commands)
+
+	// nothing changes if the prefix is already set
+	commands = nil
+	c.dashboard.URLPrefix = "/ui"
+	assert.Nil(t, c.configureDashboardURLPrefix("ns"))
+	assert.Equal(t, 0, len(commands))
+
+	c.dashboard.URLPrefix = ""
+	assert.Nil(t, c.configureDashboardURLPrefix("ns"))
+	assert.Equal(t, "", prefix)
+	assert.Equal(t, []string{"config rm mgr", "mgr module disable"}, commands)
+
+	// luminous stores the prefix in the key/value store of the mons
+	version = "12.2.7"
+	commands = nil
+	c.dashboard.URLPrefix = "ui"
+	assert.Nil(t, c.configureDashboardURLPrefix("ns"))
+	assert.Equal(t, "/ui", prefix)
+	assert.Equal(t, []string{"config-key set mgr/dashboard/url_prefix", "mgr module disable"}, commands)
+	commands = nil
+	assert.Nil(t, c.configureDashboardURLPrefix("ns"))
+	assert.Equal(t, 0, len(commands))
+	c.dashboard.URLPrefix = ""
+	assert.Nil(t, c.configureDashboardURLPrefix("ns"))
+	assert.Equal(t, "", prefix)
+	assert.Equal(t, []string{"config-key rm mgr/dashboard/url_prefix", "mgr module disable"}, commands)
+
+	// the prefix is not changed if the version cannot be detected
+	version = "unknown"
+	c.dashboard.URLPrefix = "ui"
+	assert.NotNil(t, c.configureDashboardURLPrefix("ns"))
+	assert.Equal(t, "", prefix)
+
+	assert.Equal(t, "/ceph/ui", normalizeURLPrefix(" /ceph/ui/ "))
+	assert.Equal(t, "", normalizeURLPrefix("/"))
+}
+
 func TestPodSpec(t *testing.T) {
 	c := New(&clusterd.Context{Clientset: testop.New(1)}, "ns", "rook/rook:myversion", rookalpha.Placement{}, false, cephv1beta1.DashboardSpec{}, v1.ResourceRequirements{
 		Limits: v1.ResourceList{
@@ -24,6 +24,7 @@ import (
 	"github.com/rook/rook/pkg/clusterd"
 	"github.com/rook/rook/pkg/daemon/ceph/client"
 	"github.com/rook/rook/pkg/daemon/ceph/mon"
+	"github.com/rook/rook/pkg/operator/ceph/settings"
 	"github.com/rook/rook/pkg/operator/k8sutil"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -31,9 +32,9 @@ import (
 
 var (
 	// HealthCheckInterval interval to check the mons to be in quorum
-	HealthCheckInterval = 45 * time.Second
+	HealthCheckInterval = settings.NewDuration(45 * time.Second)
 	// MonOutTimeout the duration to wait before removing/failover to a new mon pod
-	MonOutTimeout = 300 * time.Second
+	MonOutTimeout = settings.NewDuration(300 * time.Second)
 )
 
 // HealthChecker check health for the monitors
@@ -56,7 +57,7 @@ func (hc *HealthChecker) Check(stopCh chan struct{}) {
 			logger.Infof("Stopping monitoring of mons in namespace %s", hc.monCluster.Namespace)
 			return
 
-		case <-time.After(HealthCheckInterval):
+		case <-time.After(HealthCheckInterval.Get()):
 			logger.Debugf("checking health of mons")
 			err := hc.monCluster.checkHealth()
 			if err != nil {
@@ -125,7 +126,7 @@ func (c *Cluster) checkHealth() error {
 
 			// when the timeout for the mon has been reached, continue to the
 			// normal failover/delete mon pod part of the code
-			if time.Since(c.monTimeoutList[mon.Name]) <= MonOutTimeout {
+			if time.Since(c.monTimeoutList[mon.Name]) <= MonOutTimeout.Get() {
 				logger.Warningf("mon %s not found in quorum, still in mon out timeout", mon.Name)
 				continue
 			}
@@ -180,7 +181,9 @@ func (c *Cluster) checkMonsOnSameNode() (bool, error) {
 			// fail it over to an other node
 			if len(availableNodes) > 0 {
 				logger.Infof("rebalance: enough nodes available %d to failover mon %s", len(availableNodes), name)
-				c.failMon(len(c.clusterInfo.Monitors), name)
+				if c.failoverAllowed(name) {
+					c.failMon(len(c.clusterInfo.Monitors), name)
+				}
 			} else {
 				logger.Debugf("rebalance: not enough nodes available to failover mon %s", name)
 			}
@@ -206,7 +209,9 @@ func (c *Cluster) checkMonsOnValidNodes() (bool, error) {
 			logger.Warning("failed to validate node %s %v", node.Name, err)
 		} else if !valid {
 			logger.Warningf("node %s isn't valid anymore, failover mon %s", nInfo.Name, mon)
-			c.failoverMon(mon)
+			if c.failoverAllowed(mon) {
+				c.failoverMon(mon)
+			}
 			return true, nil
 		}
 		logger.Debugf("node %s with mon %s is still valid", nInfo.Name, mon)
@@ -214,7 +219,8 @@ func (c *Cluster) checkMonsOnValidNodes() (bool, error) {
 	return false, nil
 }
 
-// failMon monCount is compared against c.Size (wanted mon count)
+// failMon monCount is compared against c.Size (wanted mon count). A mon that is out of quorum or not in the mon map is
+// failed over right away since the quorum is at risk, only the rebalancing of the healthy mons waits for a window.
 func (c *Cluster) failMon(monCount int, name string) {
 	if monCount > c.Size {
 		// no need to create a new mon since we have an extra
@@ -229,6 +235,16 @@ func (c *Cluster) failMon(monCount int, name string) {
 	}
 }
 
+// failoverAllowed returns whether the healthy mon can be moved to another node now, or whether the move waits for a
+// maintenance window
+func (c *Cluster) failoverAllowed(name string) bool {
+	if c.AllowFailover == nil || c.AllowFailover() {
+		return true
+	}
+	logger.Infof("deferring the move of mon %s until the next maintenance window", name)
+	return false
+}
+
 func (c *Cluster) failoverMon(name string) error {
 	logger.Infof("Failing over monitor %s", name)
 
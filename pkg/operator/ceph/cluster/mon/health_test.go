@@ -122,6 +122,9 @@ func TestCheckHealthNotFound(t *testing.T) {
 
 	// Because the mon a isn't in the MonInQuorumResponse() this will create a new mon
 	delete(c.mapping.Node, "b")
+
+	// the failover of a mon out of quorum is not deferred outside of a maintenance window
+	c.AllowFailover = func() bool { return false }
 	err = c.checkHealth()
 	assert.Nil(t, err)
 
@@ -224,6 +227,13 @@ func TestCheckHealthTwoMonsOneNode(t *testing.T) {
 	n.Name = "node2"
 	clientset.CoreV1().Nodes().Create(n)
 
+	// the move of the healthy mon waits for a maintenance window
+	c.AllowFailover = func() bool { return false }
+	_, err = c.checkMonsOnSameNode()
+	assert.Nil(t, err)
+	assert.Nil(t, c.mapping.Node["c"])
+
+	c.AllowFailover = func() bool { return true }
 	_, err = c.checkMonsOnSameNode()
 	assert.Nil(t, err)
 
@@ -0,0 +1,108 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package mon
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+
+	cephv1beta1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1beta1"
+	"github.com/rook/rook/pkg/operator/k8sutil"
+	"github.com/rook/rook/pkg/util/logforward"
+	"k8s.io/api/core/v1"
+)
+
+const (
+	defaultLogMaxSizeMB = 100
+	defaultLogMaxFiles  = 5
+	logRotateName       = "log-rotate"
+	logForwardVolume    = "log-forward-socket"
+)
+
+// LogDir returns the directory of the log files of the daemons of all the clusters in the data dir
+func LogDir() string {
+	return path.Join(k8sutil.DataDir, "log")
+}
+
+// DaemonLogPath returns the path of the log file of a daemon such as mon.a in the data dir, which is in a directory
+// for each cluster since several clusters may share the data dir of the hosts
+func DaemonLogPath(clusterName, daemon string) string {
+	return path.Join(LogDir(), clusterName, fmt.Sprintf("%s.log", daemon))
+}
+
+// LogRotateContainer returns the sidecar container that rotates the log file of the daemon in the data dir
+func LogRotateContainer(logs cephv1beta1.LogSpec, clusterName, daemon, version string) v1.Container {
+	maxSize := logs.MaxSizeMB
+	if maxSize <= 0 {
+		maxSize = defaultLogMaxSizeMB
+	}
+	maxFiles := logs.MaxFiles
+	if maxFiles <= 0 {
+		maxFiles = defaultLogMaxFiles
+	}
+	return v1.Container{
+		Args: []string{
+			"ceph",
+			"log-rotate",
+			fmt.Sprintf("--log-file=%s", DaemonLogPath(clusterName, daemon)),
+			fmt.Sprintf("--log-dir=%s", LogDir()),
+			fmt.Sprintf("--max-size-mb=%d", maxSize),
+			fmt.Sprintf("--max-files=%d", maxFiles),
+			fmt.Sprintf("--compress=%s", strconv.FormatBool(logs.Compress)),
+		},
+		Name:  logRotateName,
+		Image: k8sutil.MakeRookImage(version),
+		VolumeMounts: []v1.VolumeMount{
+			{Name: k8sutil.DataDirVolume, MountPath: k8sutil.DataDir},
+		},
+		Env: []v1.EnvVar{k8sutil.NodeEnvVar()},
+	}
+}
+
+// LogForwardEnvVars returns the env vars of the log forwarding flags of the rook command that runs a daemon, which
+// forwards its own logs and the output of the ceph daemon. There are no env vars if the logs are not forwarded.
+func LogForwardEnvVars(logs cephv1beta1.LogSpec, clusterName, daemon string) []v1.EnvVar {
+	if logs.Forward.Target == "" {
+		return nil
+	}
+	envVars := []v1.EnvVar{
+		{Name: "ROOK_LOG_FORWARD", Value: logs.Forward.Target},
+		{Name: "ROOK_LOG_FORWARD_CLUSTER", Value: clusterName},
+		{Name: "ROOK_LOG_FORWARD_DAEMON", Value: daemon},
+		{Name: "ROOK_LOG_FORWARD_NODE", ValueFrom: &v1.EnvVarSource{FieldRef: &v1.ObjectFieldSelector{FieldPath: "spec.nodeName"}}},
+	}
+	if logs.Forward.Facility != "" {
+		envVars = append(envVars, v1.EnvVar{Name: "ROOK_LOG_FORWARD_FACILITY", Value: logs.Forward.Facility})
+	}
+	return envVars
+}
+
+// LogForwardVolume returns the volume and the mount of the socket of the host the logs are forwarded to, or nil if
+// the logs are not forwarded to the journal or the syslog of the host
+func LogForwardVolume(logs cephv1beta1.LogSpec) (*v1.Volume, *v1.VolumeMount) {
+	var socket string
+	switch logs.Forward.Target {
+	case logforward.Journald:
+		socket = logforward.JournalSocket
+	case logforward.Syslog:
+		socket = logforward.SyslogSocket
+	default:
+		return nil, nil
+	}
+	volume := &v1.Volume{Name: logForwardVolume, VolumeSource: v1.VolumeSource{HostPath: &v1.HostPathVolumeSource{Path: socket}}}
+	return volume, &v1.VolumeMount{Name: logForwardVolume, MountPath: socket}
+}
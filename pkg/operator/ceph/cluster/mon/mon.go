@@ -50,6 +50,8 @@ const (
 	MaxMonIDKey = "maxMonId"
 	// MappingKey is the name of the mapping for the mon->node and node->port
 	MappingKey = "mapping"
+	// SecretName is the name of the secret with the fsid and the mon and admin keys of the cluster
+	SecretName = appName
 
 	appName           = "rook-ceph-mon"
 	monNodeAttr       = "mon_node"
@@ -87,6 +89,12 @@ type Cluster struct {
 	mapping              *Mapping
 	resources            v1.ResourceRequirements
 	ownerRef             metav1.OwnerReference
+	// AllowFailover returns whether a mon can be failed over now. The failover is deferred while it returns false.
+	AllowFailover func() bool
+	// Logs are the settings of the log files of the mons, which are only written to files with a dataDirHostPath
+	Logs cephv1beta1.LogSpec
+	// Stretch are the sites of a stretched cluster, between which the mons are split
+	Stretch cephv1beta1.StretchSpec
 }
 
 // monConfig for a single monitor
@@ -317,6 +325,14 @@ func (c *Cluster) assignMons(mons []*monConfig) error {
 		return fmt.Errorf("no nodes available for mon placement")
 	}
 
+	if c.Stretch.Enabled() {
+		if err := c.assignStretchMons(mons, availableNodes); err != nil {
+			return err
+		}
+		logger.Debug("mons have been assigned to the nodes of the sites")
+		return nil
+	}
+
 	nodeIndex := 0
 	for _, m := range mons {
 		if _, ok := c.mapping.Node[m.DaemonName]; ok {
@@ -325,22 +341,9 @@ func (c *Cluster) assignMons(mons []*monConfig) error {
 		}
 
 		// pick one of the available nodes where the mon will be assigned
-		node := availableNodes[nodeIndex%len(availableNodes)]
-		logger.Debugf("mon %s assigned to node %s", m.DaemonName, node.Name)
-		nodeInfo, err := getNodeInfoFromNode(node)
-		if err != nil {
-			return fmt.Errorf("couldn't get node info from node %s. %+v", node.Name, err)
-		}
-		// when hostNetwork is used check if we need to increase the port of the node
-		if c.HostNetwork {
-			if _, ok := c.mapping.Port[node.Name]; ok {
-				// when the node was already chosen increase port by 1 and set
-				// assignment and that the node was chosen
-				m.Port = c.mapping.Port[node.Name] + int32(1)
-			}
-			c.mapping.Port[node.Name] = m.Port
+		if err := c.assignMon(m, availableNodes[nodeIndex%len(availableNodes)]); err != nil {
+			return err
 		}
-		c.mapping.Node[m.DaemonName] = nodeInfo
 		nodeIndex++
 	}
 
@@ -348,6 +351,25 @@ func (c *Cluster) assignMons(mons []*monConfig) error {
 	return nil
 }
 
+func (c *Cluster) assignMon(m *monConfig, node v1.Node) error {
+	logger.Debugf("mon %s assigned to node %s", m.DaemonName, node.Name)
+	nodeInfo, err := getNodeInfoFromNode(node)
+	if err != nil {
+		return fmt.Errorf("couldn't get node info from node %s. %+v", node.Name, err)
+	}
+	// when hostNetwork is used check if we need to increase the port of the node
+	if c.HostNetwork {
+		if _, ok := c.mapping.Port[node.Name]; ok {
+			// when the node was already chosen increase port by 1 and set
+			// assignment and that the node was chosen
+			m.Port = c.mapping.Port[node.Name] + int32(1)
+		}
+		c.mapping.Port[node.Name] = m.Port
+	}
+	c.mapping.Node[m.DaemonName] = nodeInfo
+	return nil
+}
+
 func getNodeInfoFromNode(n v1.Node) (*NodeInfo, error) {
 	nr := &NodeInfo{
 		Name:     n.Name,
@@ -457,7 +479,7 @@ func (c *Cluster) getMonNodes() ([]v1.Node, error) {
 	if c.AllowMultiplePerNode && len(availableNodes) == 0 {
 		logger.Infof("All nodes are running mons. Adding all %d nodes to the availability.", len(nodes.Items))
 		for _, node := range nodes.Items {
-			valid, err := k8sutil.ValidNode(node, c.placement)
+			valid, err := k8sutil.ValidNewNode(node, c.placement)
 			if err != nil {
 				logger.Warning("failed to validate node %s %v", node.Name, err)
 			} else if valid {
@@ -489,7 +511,7 @@ func (c *Cluster) getAvailableMonNodes() ([]v1.Node, *v1.NodeList, error) {
 	availableNodes := []v1.Node{}
 	for _, node := range nodes.Items {
 		if !nodesInUse.Contains(node.Name) {
-			valid, err := k8sutil.ValidNode(node, c.placement)
+			valid, err := k8sutil.ValidNewNode(node, c.placement)
 			if err != nil {
 				logger.Warning("failed to validate node %s %v", node.Name, err)
 			} else if valid {
@@ -0,0 +1,123 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mon
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+
+	"github.com/rook/rook/pkg/daemon/ceph/client"
+	"github.com/rook/rook/pkg/daemon/ceph/mon"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	adminKeyGenerationName = "admin-key-generation"
+	pendingAdminSecretName = "admin-secret-pending"
+	rotateDirName          = "rotate"
+)
+
+// RotateAdminKey replaces the client.admin key when the requested generation is newer than the generation
+// of the key in the mon secret. The new key is saved in the secret before it is imported to ceph so that
+// an interrupted rotation is completed with the same key on the next orchestration.
+func (c *Cluster) RotateAdminKey(generation int) error {
+	secrets := c.context.Clientset.CoreV1().Secrets(c.Namespace)
+	secret, err := secrets.Get(appName, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get mon secrets. %+v", err)
+	}
+
+	current := 0
+	if val, ok := secret.Data[adminKeyGenerationName]; ok {
+		if current, err = strconv.Atoi(string(val)); err != nil {
+			return fmt.Errorf("invalid admin key generation %s. %+v", string(val), err)
+		}
+	}
+	if generation <= current {
+		logger.Debugf("admin key is at generation %d", current)
+		return nil
+	}
+	logger.Infof("rotating the admin key from generation %d to %d", current, generation)
+
+	dir := path.Join(c.context.ConfigDir, c.Namespace, rotateDirName)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("failed to create dir %s. %+v", dir, err)
+	}
+	defer os.RemoveAll(dir)
+
+	if secret.Data == nil {
+		secret.Data = map[string][]byte{}
+	}
+	newKey := string(secret.Data[pendingAdminSecretName])
+	resuming := newKey != ""
+	if !resuming {
+		if newKey, err = genSecret(c.context.Executor, dir, client.AdminUsername, adminCaps); err != nil {
+			return fmt.Errorf("failed to generate the new admin key. %+v", err)
+		}
+
+		// persist the new key before ceph knows about it, otherwise a failure below could lock us out
+		secret.Data[pendingAdminSecretName] = []byte(newKey)
+		if secret, err = secrets.Update(secret); err != nil {
+			return fmt.Errorf("failed to save the pending admin key. %+v", err)
+		}
+	} else {
+		logger.Infof("resuming the rotation of the admin key")
+	}
+
+	// replace the key in ceph. the old key is no longer accepted after the import.
+	keyringPath := path.Join(dir, "import.keyring")
+	if err := ioutil.WriteFile(keyringPath, []byte(fmt.Sprintf(mon.AdminKeyringTemplate, newKey)), 0600); err != nil {
+		return fmt.Errorf("failed to write the new admin keyring. %+v", err)
+	}
+	if err := client.AuthImport(c.context, c.Namespace, keyringPath); err != nil {
+		if !resuming {
+			return fmt.Errorf("failed to import the new admin key. %+v", err)
+		}
+		// the pending key may already be the active key if a previous rotation was interrupted after the import
+		logger.Warningf("failed to import the pending admin key with the current key, retrying with the pending key. %+v", err)
+		if err := c.useAdminKey(newKey); err != nil {
+			return err
+		}
+		if err := client.AuthImport(c.context, c.Namespace, keyringPath); err != nil {
+			return fmt.Errorf("failed to import the new admin key. %+v", err)
+		}
+	}
+
+	// the operator connects with the new key from now on
+	if err := c.useAdminKey(newKey); err != nil {
+		return err
+	}
+
+	// the agents and other daemons load the admin key from the secret
+	secret.Data[adminSecretName] = []byte(newKey)
+	secret.Data[adminKeyGenerationName] = []byte(strconv.Itoa(generation))
+	delete(secret.Data, pendingAdminSecretName)
+	if _, err := secrets.Update(secret); err != nil {
+		return fmt.Errorf("failed to save the rotated admin key. %+v", err)
+	}
+
+	logger.Infof("rotated the admin key to generation %d", generation)
+	return nil
+}
+
+func (c *Cluster) useAdminKey(key string) error {
+	c.clusterInfo.AdminSecret = key
+	return WriteConnectionConfig(c.context, c.clusterInfo)
+}
@@ -0,0 +1,90 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package mon
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/rook/rook/pkg/clusterd"
+	"github.com/rook/rook/pkg/daemon/ceph/mon"
+	"github.com/rook/rook/pkg/operator/test"
+	exectest "github.com/rook/rook/pkg/util/exec/test"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestRotateAdminKey(t *testing.T) {
+	configDir, _ := ioutil.TempDir("", "")
+	defer os.RemoveAll(configDir)
+
+	imports := 0
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithOutput: func(debug bool, actionName string, command string, args ...string) (string, error) {
+			// write the generated keyring where ceph-authtool was asked to create it
+			ioutil.WriteFile(args[1], []byte("[client.admin]\n\tkey = newkey\n"), 0600)
+			return "", nil
+		},
+		MockExecuteCommandWithOutputFile: func(debug bool, actionName string, command string, outFileArg string, args ...string) (string, error) {
+			if args[0] == "auth" && args[1] == "import" {
+				imports++
+			}
+			return "", nil
+		},
+	}
+	clientset := test.New(1)
+	context := &clusterd.Context{Clientset: clientset, Executor: executor, ConfigDir: configDir}
+	secret := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: appName, Namespace: "ns"},
+		Data:       map[string][]byte{adminSecretName: []byte("oldkey")},
+	}
+	_, err := clientset.CoreV1().Secrets("ns").Create(secret)
+	assert.Nil(t, err)
+
+	c := &Cluster{context: context, Namespace: "ns", clusterInfo: &mon.ClusterInfo{Name: "ns", AdminSecret: "oldkey"}}
+
+	// the key is not rotated until a generation is requested
+	err = c.RotateAdminKey(0)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, imports)
+
+	err = c.RotateAdminKey(1)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, imports)
+	assert.Equal(t, "newkey", c.clusterInfo.AdminSecret)
+	secret, err = clientset.CoreV1().Secrets("ns").Get(appName, metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, "newkey", string(secret.Data[adminSecretName]))
+	assert.Equal(t, "1", string(secret.Data[adminKeyGenerationName]))
+	_, ok := secret.Data[pendingAdminSecretName]
+	assert.False(t, ok)
+
+	// the same generation is not rotated again
+	err = c.RotateAdminKey(1)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, imports)
+
+	// an interrupted rotation is completed with the pending key
+	secret.Data[pendingAdminSecretName] = []byte("pendingkey")
+	_, err = clientset.CoreV1().Secrets("ns").Update(secret)
+	assert.Nil(t, err)
+	err = c.RotateAdminKey(2)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, imports)
+	assert.Equal(t, "pendingkey", c.clusterInfo.AdminSecret)
+}
@@ -96,16 +96,27 @@ func (c *Cluster) makeMonPod(config *monConfig, hostname string) *v1.Pod {
 		dataDirSource = v1.VolumeSource{HostPath: &v1.HostPathVolumeSource{Path: c.dataDirHostPath}}
 	}
 
-	container := c.monContainer(config, c.clusterInfo.FSID)
+	volumes := []v1.Volume{
+		{Name: k8sutil.DataDirVolume, VolumeSource: dataDirSource},
+		k8sutil.ConfigOverrideVolume(),
+	}
+	containers := []v1.Container{c.monContainer(config, c.clusterInfo.FSID)}
+	daemon := fmt.Sprintf("mon.%s", config.DaemonName)
+	if c.logToFile() {
+		containers[0].Args = append(containers[0].Args, fmt.Sprintf("--log-file=%s", DaemonLogPath(c.Namespace, daemon)))
+		containers = append(containers, LogRotateContainer(c.Logs, c.Namespace, daemon, c.Version))
+	}
+	containers[0].Env = append(containers[0].Env, LogForwardEnvVars(c.Logs, c.Namespace, daemon)...)
+	if volume, mount := LogForwardVolume(c.Logs); volume != nil {
+		volumes = append(volumes, *volume)
+		containers[0].VolumeMounts = append(containers[0].VolumeMounts, *mount)
+	}
 	podSpec := v1.PodSpec{
-		Containers:    []v1.Container{container},
+		Containers:    containers,
 		RestartPolicy: v1.RestartPolicyAlways,
 		NodeSelector:  map[string]string{apis.LabelHostname: hostname},
-		Volumes: []v1.Volume{
-			{Name: k8sutil.DataDirVolume, VolumeSource: dataDirSource},
-			k8sutil.ConfigOverrideVolume(),
-		},
-		HostNetwork: c.HostNetwork,
+		Volumes:       volumes,
+		HostNetwork:   c.HostNetwork,
 	}
 	if c.HostNetwork {
 		podSpec.DNSPolicy = v1.DNSClusterFirstWithHostNet
@@ -128,6 +139,11 @@ func (c *Cluster) makeMonPod(config *monConfig, hostname string) *v1.Pod {
 	return pod
 }
 
+// logToFile returns whether the mons write their logs to files in the dataDirHostPath
+func (c *Cluster) logToFile() bool {
+	return c.Logs.ToFile && c.dataDirHostPath != ""
+}
+
 func (c *Cluster) monContainer(config *monConfig, fsid string) v1.Container {
 	// Running the mon privileged is required to use hostPath when a PodSecurityPolicy is enabled with selinux
 	// After local volumes are used (instead of hostPath), privileged will not be needed anymore
@@ -0,0 +1,78 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package mon
+
+import (
+	"fmt"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// assignStretchMons assigns each mon to a node in the site with the most missing mons, so that the mons are split
+// between the two sites and a single mon runs in the tiebreaker site. The quorum then survives the loss of a site.
+func (c *Cluster) assignStretchMons(mons []*monConfig, availableNodes []v1.Node) error {
+	nodes, err := c.context.Clientset.CoreV1().Nodes().List(metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list the nodes. %+v", err)
+	}
+	label := c.Stretch.GetSiteLabel()
+	sites := map[string]string{}
+	for _, n := range nodes.Items {
+		sites[n.Name] = n.Labels[label]
+	}
+
+	missing := c.Stretch.MonsPerSite(len(mons))
+	for _, m := range mons {
+		if info, ok := c.mapping.Node[m.DaemonName]; ok {
+			missing[sites[info.Name]]--
+		}
+	}
+
+	used := map[string]bool{}
+	for _, m := range mons {
+		if _, ok := c.mapping.Node[m.DaemonName]; ok {
+			logger.Debugf("mon %s already assigned to a node, no need to assign", m.DaemonName)
+			continue
+		}
+
+		site := c.Stretch.Tiebreaker
+		for _, s := range c.Stretch.Sites {
+			if missing[s] > missing[site] {
+				site = s
+			}
+		}
+		var node *v1.Node
+		for i := range availableNodes {
+			n := &availableNodes[i]
+			if sites[n.Name] == site && (c.AllowMultiplePerNode || !used[n.Name]) {
+				node = n
+				break
+			}
+		}
+		if node == nil {
+			return fmt.Errorf("no node with label %s=%s is available for mon %s", label, site, m.DaemonName)
+		}
+
+		logger.Infof("mon %s assigned to site %s", m.DaemonName, site)
+		if err := c.assignMon(m, *node); err != nil {
+			return err
+		}
+		used[node.Name] = true
+		missing[site]--
+	}
+	return nil
+}
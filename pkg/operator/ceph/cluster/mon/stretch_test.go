@@ -0,0 +1,80 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package mon
+
+import (
+	"testing"
+
+	cephv1beta1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1beta1"
+	"github.com/rook/rook/pkg/clusterd"
+	"github.com/rook/rook/pkg/operator/test"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestAssignStretchMons(t *testing.T) {
+	clientset := test.New(6)
+	sites := map[string]string{"node0": "dc1", "node1": "dc1", "node2": "dc2", "node3": "dc2", "node4": "dc3", "node5": "dc1"}
+	for name, site := range sites {
+		n, err := clientset.CoreV1().Nodes().Get(name, metav1.GetOptions{})
+		assert.Nil(t, err)
+		n.Labels = map[string]string{cephv1beta1.DefaultSiteLabel: site}
+		_, err = clientset.CoreV1().Nodes().Update(n)
+		assert.Nil(t, err)
+	}
+	nodes, err := clientset.CoreV1().Nodes().List(metav1.ListOptions{})
+	assert.Nil(t, err)
+
+	c := newCluster(&clusterd.Context{Clientset: clientset}, "ns", false, v1.ResourceRequirements{})
+	c.AllowMultiplePerNode = false
+	c.Stretch = cephv1beta1.StretchSpec{Sites: []string{"dc1", "dc2"}, Tiebreaker: "dc3"}
+	mons := []*monConfig{newMonConfig(0), newMonConfig(1), newMonConfig(2), newMonConfig(3), newMonConfig(4)}
+
+	// two mons in each site and one in the tiebreaker, on different nodes
+	assert.Nil(t, c.assignStretchMons(mons, nodes.Items))
+	perSite := map[string]int{}
+	used := map[string]bool{}
+	for _, m := range mons {
+		node := c.mapping.Node[m.DaemonName].Name
+		assert.False(t, used[node])
+		used[node] = true
+		perSite[sites[node]]++
+	}
+	assert.Equal(t, map[string]int{"dc1": 2, "dc2": 2, "dc3": 1}, perSite)
+
+	// the mon that replaces a failed mon is placed in the same site, which fails without an available node in the site
+	var replaced string
+	for _, m := range mons {
+		if sites[c.mapping.Node[m.DaemonName].Name] == "dc2" {
+			replaced = m.DaemonName
+			delete(c.mapping.Node, m.DaemonName)
+			break
+		}
+	}
+	available := []v1.Node{}
+	for _, n := range nodes.Items {
+		if !used[n.Name] {
+			available = append(available, n)
+		}
+	}
+	assert.Equal(t, 1, len(available))
+	assert.NotNil(t, c.assignStretchMons(mons, available))
+
+	c.AllowMultiplePerNode = true
+	assert.Nil(t, c.assignStretchMons(mons, nodes.Items))
+	assert.Equal(t, "dc2", sites[c.mapping.Node[replaced].Name])
+}
@@ -43,6 +43,8 @@ const (
 	maxPerChar = 26
 )
 
+var adminCaps = []string{"--set-uid=0", "--cap", "mon", "'allow *'", "--cap", "osd", "'allow *'", "--cap", "mgr", "'allow *'", "--cap", "mds", "'allow'"}
+
 // LoadClusterInfo constructs or loads a clusterinfo and returns it along with the maxMonID
 func LoadClusterInfo(context *clusterd.Context, namespace string) (*mon.ClusterInfo, int, *Mapping, error) {
 	return CreateOrLoadClusterInfo(context, namespace, nil)
@@ -210,8 +212,7 @@ func createNamedClusterInfo(context *clusterd.Context, clusterName string) (*mon
 	}
 
 	// generate the admin secret if one was not provided at the command line
-	args := []string{"--set-uid=0", "--cap", "mon", "'allow *'", "--cap", "osd", "'allow *'", "--cap", "mgr", "'allow *'", "--cap", "mds", "'allow'"}
-	adminSecret, err := genSecret(context.Executor, dir, client.AdminUsername, args)
+	adminSecret, err := genSecret(context.Executor, dir, client.AdminUsername, adminCaps)
 	if err != nil {
 		return nil, err
 	}
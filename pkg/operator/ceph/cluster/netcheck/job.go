@@ -0,0 +1,211 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package netcheck
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	cephv1beta1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1beta1"
+	"github.com/rook/rook/pkg/clusterd"
+	"github.com/rook/rook/pkg/operator/k8sutil"
+	batch "k8s.io/api/batch/v1"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/kubernetes/pkg/kubelet/apis"
+)
+
+const (
+	appName    = "rook-ceph-network-check"
+	jobNameFmt = "rook-ceph-network-check-%s"
+	osdAppName = "rook-ceph-osd"
+	// the service account of the osds, which can update the config maps in the namespace
+	defaultServiceAccount = "rook-ceph-cluster"
+)
+
+// Settings are the settings of the network check jobs in the cluster
+type Settings struct {
+	Version        string
+	ServiceAccount string
+	HostNetwork    bool
+	OwnerRef       metav1.OwnerReference
+}
+
+// Run measures the network between the nodes of the osds with a job on each node, and saves the report of the
+// measurements in the config map
+func Run(context *clusterd.Context, namespace string, spec cephv1beta1.NetworkCheckSpec, settings Settings) (*Report, error) {
+	nodes, err := osdNodes(context, namespace)
+	if err != nil {
+		return nil, err
+	}
+	if len(nodes) < 2 {
+		return nil, fmt.Errorf("the network check needs at least two nodes with osds, found %v", nodes)
+	}
+
+	// the config map is reset for the new generation, which stops the jobs of a previous check
+	if err := resetConfigMap(context, namespace, spec.Generation, settings.OwnerRef); err != nil {
+		return nil, err
+	}
+	defer deleteJobs(context, namespace, nodes)
+	for _, node := range nodes {
+		deleteJob(context, namespace, node)
+		job := makeJob(context, namespace, node, nodes, spec, settings)
+		if _, err := context.Clientset.Batch().Jobs(namespace).Create(job); err != nil {
+			return nil, fmt.Errorf("failed to create network check job for node %s. %+v", node, err)
+		}
+	}
+	logger.Infof("started network check %d on nodes %v", spec.Generation, nodes)
+
+	data, err := waitForKeys(context.Clientset, namespace, resultKeyPrefix, nodes, time.Now().Add(Timeout+time.Minute))
+	if err != nil {
+		return nil, err
+	}
+	prefixed := map[string]string{}
+	for node, value := range data {
+		prefixed[resultKeyPrefix+node] = value
+	}
+	report := buildReport(spec.Generation, nodes, prefixed)
+	reportData, err := json.Marshal(report)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal the network check report. %+v", err)
+	}
+	if err := setKey(context.Clientset, namespace, spec.Generation, reportKey, string(reportData)); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// osdNodes returns the nodes where the osds run
+func osdNodes(context *clusterd.Context, namespace string) ([]string, error) {
+	deployments, err := context.Clientset.ExtensionsV1beta1().Deployments(namespace).List(
+		metav1.ListOptions{LabelSelector: fmt.Sprintf("%s=%s", k8sutil.AppAttr, osdAppName)})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list osd deployments. %+v", err)
+	}
+	found := map[string]bool{}
+	nodes := []string{}
+	for _, d := range deployments.Items {
+		node := d.Spec.Template.Spec.NodeSelector[apis.LabelHostname]
+		if node != "" && !found[node] {
+			found[node] = true
+			nodes = append(nodes, node)
+		}
+	}
+	sort.Strings(nodes)
+	return nodes, nil
+}
+
+func resetConfigMap(context *clusterd.Context, namespace string, generation int, ownerRef metav1.OwnerReference) error {
+	data := map[string]string{generationKey: strconv.Itoa(generation)}
+	configMaps := context.Clientset.CoreV1().ConfigMaps(namespace)
+	cm, err := configMaps.Get(ConfigMapName, metav1.GetOptions{})
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			return fmt.Errorf("failed to get configmap %s. %+v", ConfigMapName, err)
+		}
+		cm = &v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: ConfigMapName, Namespace: namespace},
+			Data:       data,
+		}
+		k8sutil.SetOwnerRef(context.Clientset, namespace, &cm.ObjectMeta, &ownerRef)
+		if _, err := configMaps.Create(cm); err != nil {
+			return fmt.Errorf("failed to create configmap %s. %+v", ConfigMapName, err)
+		}
+		return nil
+	}
+	cm.Data = data
+	if _, err := configMaps.Update(cm); err != nil {
+		return fmt.Errorf("failed to update configmap %s. %+v", ConfigMapName, err)
+	}
+	return nil
+}
+
+func makeJob(context *clusterd.Context, namespace, node string, nodes []string, spec cephv1beta1.NetworkCheckSpec, settings Settings) *batch.Job {
+	backoffLimit := int32(0)
+	dnsPolicy := v1.DNSClusterFirst
+	if settings.HostNetwork {
+		dnsPolicy = v1.DNSClusterFirstWithHostNet
+	}
+	serviceAccount := settings.ServiceAccount
+	if serviceAccount == "" {
+		serviceAccount = defaultServiceAccount
+	}
+	labels := map[string]string{
+		k8sutil.AppAttr:     appName,
+		k8sutil.ClusterAttr: namespace,
+	}
+	job := &batch.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      k8sutil.TruncateNodeName(jobNameFmt, node),
+			Namespace: namespace,
+			Labels:    labels,
+		},
+		Spec: batch.JobSpec{
+			BackoffLimit: &backoffLimit,
+			Template: v1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels},
+				Spec: v1.PodSpec{
+					Containers: []v1.Container{
+						{
+							Args: []string{
+								"ceph",
+								"network-check",
+								fmt.Sprintf("--nodes=%s", strings.Join(nodes, ",")),
+								fmt.Sprintf("--generation=%d", spec.Generation),
+								fmt.Sprintf("--sample-size=%d", spec.SampleSize),
+								fmt.Sprintf("--port=%d", DefaultPort),
+							},
+							Name:  appName,
+							Image: k8sutil.MakeRookImage(settings.Version),
+							Env: []v1.EnvVar{
+								k8sutil.NodeEnvVar(),
+								k8sutil.NamespaceEnvVar(),
+								k8sutil.PodIPEnvVar(k8sutil.PublicIPEnvVar),
+							},
+						},
+					},
+					NodeSelector:       map[string]string{apis.LabelHostname: node},
+					RestartPolicy:      v1.RestartPolicyNever,
+					ServiceAccountName: serviceAccount,
+					HostNetwork:        settings.HostNetwork,
+					DNSPolicy:          dnsPolicy,
+				},
+			},
+		},
+	}
+	k8sutil.SetOwnerRef(context.Clientset, namespace, &job.ObjectMeta, &settings.OwnerRef)
+	return job
+}
+
+func deleteJobs(context *clusterd.Context, namespace string, nodes []string) {
+	for _, node := range nodes {
+		deleteJob(context, namespace, node)
+	}
+}
+
+func deleteJob(context *clusterd.Context, namespace, node string) {
+	propagation := metav1.DeletePropagationBackground
+	options := &metav1.DeleteOptions{PropagationPolicy: &propagation}
+	name := k8sutil.TruncateNodeName(jobNameFmt, node)
+	if err := context.Clientset.Batch().Jobs(namespace).Delete(name, options); err != nil && !errors.IsNotFound(err) {
+		logger.Warningf("failed to delete network check job %s. %+v", name, err)
+	}
+}
@@ -0,0 +1,227 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package netcheck runs the diagnostic of the network between the nodes of the osds. A job on each node measures the
+// latency and throughput to the other nodes, and the jobs exchange their addresses and results in a config map.
+package netcheck
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/coreos/pkg/capnslog"
+	"github.com/rook/rook/pkg/util/netcheck"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+var logger = capnslog.NewPackageLogger("github.com/rook/rook", "op-netcheck")
+
+const (
+	// ConfigMapName is the config map where the nodes exchange their addresses and results, and where the report
+	// of the last network check is kept
+	ConfigMapName = "rook-ceph-network-check"
+	// DefaultPort is the port on which the nodes answer the measurements of the other nodes
+	DefaultPort = 9797
+
+	generationKey   = "generation"
+	reportKey       = "report"
+	addrKeyPrefix   = "addr."
+	resultKeyPrefix = "result."
+	updateRetries   = 10
+)
+
+var (
+	// Timeout is how long the nodes wait for the other nodes to start and to finish their measurements
+	Timeout      = 10 * time.Minute
+	pollInterval = 5 * time.Second
+)
+
+// AgentConfig is the settings of the network check on a node
+type AgentConfig struct {
+	Namespace string
+	Node      string
+	// All the nodes of the network check, including this node
+	Nodes []string
+	// The IP where the other nodes reach this node
+	IP         string
+	Port       int
+	Generation int
+	SampleSize int
+	Pings      int
+	SizeMB     int
+}
+
+// Report is the matrix of the results measured from each node to the other nodes, with the links that are
+// unreachable, slow or asymmetric
+type Report struct {
+	Generation int                                   `json:"generation"`
+	Time       time.Time                             `json:"time"`
+	Nodes      []string                              `json:"nodes"`
+	Results    map[string]map[string]netcheck.Result `json:"results"`
+	Findings   []netcheck.Finding                    `json:"findings"`
+}
+
+// Peers returns the nodes measured by the node. In each round of the measurements the nodes measure a different
+// peer, so that each node receives the data of a single node at a time. All the other nodes are measured if the
+// sample size is zero.
+func Peers(node string, nodes []string, sampleSize int) []string {
+	sorted := append([]string{}, nodes...)
+	sort.Strings(sorted)
+	index := sort.SearchStrings(sorted, node)
+	if index == len(sorted) || sorted[index] != node {
+		return []string{}
+	}
+	peers := []string{}
+	for round := 1; round < len(sorted); round++ {
+		if sampleSize > 0 && round > sampleSize {
+			break
+		}
+		peers = append(peers, sorted[(index+round)%len(sorted)])
+	}
+	return peers
+}
+
+// RunAgent registers the address of the node, measures its peers once the other nodes registered, and keeps
+// answering the measurements of the other nodes until they are done
+func RunAgent(clientset kubernetes.Interface, config AgentConfig) error {
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", config.Port))
+	if err != nil {
+		return fmt.Errorf("failed to listen on port %d. %+v", config.Port, err)
+	}
+	defer listener.Close()
+	go netcheck.Serve(listener)
+
+	addr := net.JoinHostPort(config.IP, strconv.Itoa(config.Port))
+	if err := setKey(clientset, config.Namespace, config.Generation, addrKeyPrefix+config.Node, addr); err != nil {
+		return err
+	}
+	deadline := time.Now().Add(Timeout)
+	addrs, err := waitForKeys(clientset, config.Namespace, addrKeyPrefix, config.Nodes, deadline)
+	if err != nil {
+		return err
+	}
+
+	results := map[string]netcheck.Result{}
+	size := int64(config.SizeMB) * 1024 * 1024
+	for _, peer := range Peers(config.Node, config.Nodes, config.SampleSize) {
+		peerAddr, ok := addrs[peer]
+		if !ok {
+			results[peer] = netcheck.Result{Error: "the network check did not start on the node"}
+			continue
+		}
+		result, err := netcheck.Measure(peerAddr, config.Pings, size, time.Minute)
+		if err != nil {
+			logger.Warningf("failed to measure node %s. %+v", peer, err)
+			results[peer] = netcheck.Result{Error: err.Error()}
+			continue
+		}
+		logger.Infof("latency to node %s is %.2fms and throughput is %.1fMB/s", peer, result.LatencyMs, result.ThroughputMBps)
+		results[peer] = *result
+	}
+
+	data, err := json.Marshal(results)
+	if err != nil {
+		return fmt.Errorf("failed to marshal the results. %+v", err)
+	}
+	if err := setKey(clientset, config.Namespace, config.Generation, resultKeyPrefix+config.Node, string(data)); err != nil {
+		return err
+	}
+	_, err = waitForKeys(clientset, config.Namespace, resultKeyPrefix, config.Nodes, deadline)
+	return err
+}
+
+// LastGeneration returns the generation of the last network check, or zero if the network was never checked
+func LastGeneration(clientset kubernetes.Interface, namespace string) (int, error) {
+	cm, err := clientset.CoreV1().ConfigMaps(namespace).Get(ConfigMapName, metav1.GetOptions{})
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("failed to get configmap %s. %+v", ConfigMapName, err)
+	}
+	generation, err := strconv.Atoi(cm.Data[generationKey])
+	if err != nil {
+		return 0, fmt.Errorf("invalid network check generation %q. %+v", cm.Data[generationKey], err)
+	}
+	return generation, nil
+}
+
+// buildReport returns the report of the results of the nodes in the config map. The nodes without results are
+// reported as findings.
+func buildReport(generation int, nodes []string, data map[string]string) *Report {
+	report := &Report{Generation: generation, Time: time.Now().UTC(), Nodes: nodes, Results: map[string]map[string]netcheck.Result{}}
+	missing := []netcheck.Finding{}
+	for _, node := range nodes {
+		var results map[string]netcheck.Result
+		if err := json.Unmarshal([]byte(data[resultKeyPrefix+node]), &results); err != nil {
+			missing = append(missing, netcheck.Finding{From: node, Problem: "the node did not report its results"})
+			continue
+		}
+		report.Results[node] = results
+	}
+	report.Findings = append(missing, netcheck.Analyze(report.Results)...)
+	return report
+}
+
+// setKey sets the key in the config map of the network check unless the check was replaced by a new generation
+func setKey(clientset kubernetes.Interface, namespace string, generation int, key, value string) error {
+	for i := 0; i < updateRetries; i++ {
+		cm, err := clientset.CoreV1().ConfigMaps(namespace).Get(ConfigMapName, metav1.GetOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to get configmap %s. %+v", ConfigMapName, err)
+		}
+		if cm.Data[generationKey] != strconv.Itoa(generation) {
+			return fmt.Errorf("network check %d was replaced by generation %s", generation, cm.Data[generationKey])
+		}
+		cm.Data[key] = value
+		_, err = clientset.CoreV1().ConfigMaps(namespace).Update(cm)
+		if err == nil {
+			return nil
+		}
+		if !errors.IsConflict(err) {
+			return fmt.Errorf("failed to update configmap %s. %+v", ConfigMapName, err)
+		}
+	}
+	return fmt.Errorf("failed to update configmap %s after %d conflicts", ConfigMapName, updateRetries)
+}
+
+// waitForKeys waits for the key of each node and returns the values of the keys found before the deadline
+func waitForKeys(clientset kubernetes.Interface, namespace, prefix string, nodes []string, deadline time.Time) (map[string]string, error) {
+	for {
+		cm, err := clientset.CoreV1().ConfigMaps(namespace).Get(ConfigMapName, metav1.GetOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get configmap %s. %+v", ConfigMapName, err)
+		}
+		values := map[string]string{}
+		for key, value := range cm.Data {
+			if strings.HasPrefix(key, prefix) {
+				values[strings.TrimPrefix(key, prefix)] = value
+			}
+		}
+		if len(values) >= len(nodes) || time.Now().After(deadline) {
+			return values, nil
+		}
+		logger.Infof("waiting for %d of %d nodes of the network check", len(nodes)-len(values), len(nodes))
+		time.Sleep(pollInterval)
+	}
+}
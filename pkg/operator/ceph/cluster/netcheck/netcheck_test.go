@@ -0,0 +1,123 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package netcheck
+
+import (
+	"testing"
+	"time"
+
+	cephv1beta1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1beta1"
+	"github.com/rook/rook/pkg/clusterd"
+	"github.com/rook/rook/pkg/util/netcheck"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/api/core/v1"
+	extensions "k8s.io/api/extensions/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestPeers(t *testing.T) {
+	nodes := []string{"c", "a", "d", "b"}
+	assert.Equal(t, []string{"b", "c", "d"}, Peers("a", nodes, 0))
+	assert.Equal(t, []string{"a", "b", "c"}, Peers("d", nodes, 0))
+	assert.Equal(t, []string{"d", "a"}, Peers("c", nodes, 2))
+	assert.Equal(t, []string{}, Peers("e", nodes, 0))
+
+	// in each round every node is measured by a single node
+	for round := 0; round < 3; round++ {
+		measured := map[string]bool{}
+		for _, node := range nodes {
+			peer := Peers(node, nodes, 0)[round]
+			assert.False(t, measured[peer])
+			measured[peer] = true
+		}
+	}
+}
+
+func TestConfigMapKeys(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	context := &clusterd.Context{Clientset: clientset}
+	pollInterval = time.Millisecond
+
+	generation, err := LastGeneration(clientset, "ns")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, generation)
+
+	err = resetConfigMap(context, "ns", 3, metav1.OwnerReference{})
+	assert.Nil(t, err)
+	generation, err = LastGeneration(clientset, "ns")
+	assert.Nil(t, err)
+	assert.Equal(t, 3, generation)
+
+	assert.Nil(t, setKey(clientset, "ns", 3, addrKeyPrefix+"a", "10.0.0.1:9797"))
+	assert.Nil(t, setKey(clientset, "ns", 3, addrKeyPrefix+"b", "10.0.0.2:9797"))
+	addrs, err := waitForKeys(clientset, "ns", addrKeyPrefix, []string{"a", "b"}, time.Now().Add(time.Minute))
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"a": "10.0.0.1:9797", "b": "10.0.0.2:9797"}, addrs)
+
+	// the keys found before the deadline are returned
+	addrs, err = waitForKeys(clientset, "ns", addrKeyPrefix, []string{"a", "b", "c"}, time.Now())
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(addrs))
+
+	// the nodes of a replaced check cannot report
+	err = resetConfigMap(context, "ns", 4, metav1.OwnerReference{})
+	assert.Nil(t, err)
+	assert.NotNil(t, setKey(clientset, "ns", 3, resultKeyPrefix+"a", "{}"))
+}
+
+func TestBuildReport(t *testing.T) {
+	data := map[string]string{
+		resultKeyPrefix + "a": `{"b":{"latencyMs":0.2,"throughputMBps":1000}}`,
+		resultKeyPrefix + "b": `{"a":{"latencyMs":0.2,"throughputMBps":1000},"c":{"error":"connection refused"}}`,
+	}
+	report := buildReport(2, []string{"a", "b", "c"}, data)
+	assert.Equal(t, 2, report.Generation)
+	assert.Equal(t, 2, len(report.Results))
+	assert.Equal(t, netcheck.Result{LatencyMs: 0.2, ThroughputMBps: 1000}, report.Results["a"]["b"])
+	assert.Equal(t, []netcheck.Finding{
+		{From: "c", Problem: "the node did not report its results"},
+		{From: "b", To: "c", Problem: "unreachable: connection refused"},
+	}, report.Findings)
+}
+
+func TestOSDNodesAndJob(t *testing.T) {
+	osdDeployment := func(name, node string) *extensions.Deployment {
+		return &extensions.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "ns", Labels: map[string]string{"app": "rook-ceph-osd"}},
+			Spec: extensions.DeploymentSpec{Template: v1.PodTemplateSpec{Spec: v1.PodSpec{
+				NodeSelector: map[string]string{"kubernetes.io/hostname": node}}}},
+		}
+	}
+	clientset := fake.NewSimpleClientset(osdDeployment("rook-ceph-osd-0", "node2"), osdDeployment("rook-ceph-osd-1", "node1"),
+		osdDeployment("rook-ceph-osd-2", "node2"))
+	context := &clusterd.Context{Clientset: clientset}
+
+	nodes, err := osdNodes(context, "ns")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"node1", "node2"}, nodes)
+
+	spec := cephv1beta1.NetworkCheckSpec{Generation: 5, SampleSize: 1}
+	job := makeJob(context, "ns", "node1", nodes, spec, Settings{Version: "rook/ceph:v0.8", HostNetwork: true})
+	assert.Equal(t, "rook-ceph-network-check-node1", job.Name)
+	podSpec := job.Spec.Template.Spec
+	assert.Equal(t, "node1", podSpec.NodeSelector["kubernetes.io/hostname"])
+	assert.Equal(t, "rook-ceph-cluster", podSpec.ServiceAccountName)
+	assert.True(t, podSpec.HostNetwork)
+	assert.Equal(t, v1.RestartPolicyNever, podSpec.RestartPolicy)
+	assert.Equal(t, []string{"ceph", "network-check", "--nodes=node1,node2", "--generation=5", "--sample-size=1", "--port=9797"},
+		podSpec.Containers[0].Args)
+}
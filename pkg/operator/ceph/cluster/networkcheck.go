@@ -0,0 +1,61 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cluster
+
+import (
+	"github.com/rook/rook/pkg/operator/ceph/cluster/netcheck"
+)
+
+// checkNetwork measures the network between the nodes of the osds when the generation of the network check changed
+// since the last check. A check that fails is not attempted again until the generation changes.
+func (c *cluster) checkNetwork(rookImage string) {
+	c.networkCheckLock.Lock()
+	defer c.networkCheckLock.Unlock()
+
+	// the check runs in the background, so the spec is read once in case the cluster is updated meanwhile
+	clusterSpec := c.spec()
+	spec := clusterSpec.NetworkCheck
+	if spec.Generation == 0 {
+		return
+	}
+	last, err := netcheck.LastGeneration(c.context.Clientset, c.Namespace)
+	if err != nil {
+		logger.Errorf("failed to get the last network check. %+v", err)
+		return
+	}
+	if last == spec.Generation {
+		return
+	}
+
+	settings := netcheck.Settings{
+		Version:        rookImage,
+		ServiceAccount: clusterSpec.ServiceAccount,
+		HostNetwork:    clusterSpec.Network.HostNetwork,
+		OwnerRef:       c.ownerRef,
+	}
+	report, err := netcheck.Run(c.context, c.Namespace, spec, settings)
+	if err != nil {
+		logger.Errorf("failed to check the network in namespace %s. %+v", c.Namespace, err)
+		return
+	}
+	if len(report.Findings) == 0 {
+		logger.Infof("network check %d found no slow links between the nodes %v", spec.Generation, report.Nodes)
+		return
+	}
+	for _, f := range report.Findings {
+		logger.Warningf("network check %d: link from %s to %s: %s", spec.Generation, f.From, f.To, f.Problem)
+	}
+}
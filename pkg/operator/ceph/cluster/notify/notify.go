@@ -0,0 +1,235 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package notify notifies the external systems of the events of the clusters. The operator records the changes of a
+// cluster as kubernetes events, and the notifier of the cluster posts the events to the webhooks of the cluster and
+// sends them as snmp traps to the snmp managers of the cluster.
+package notify
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/coreos/pkg/capnslog"
+	cephv1beta1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1beta1"
+	"github.com/rook/rook/pkg/clusterd"
+	"github.com/rook/rook/pkg/daemon/ceph/client"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+)
+
+var logger = capnslog.NewPackageLogger("github.com/rook/rook", "op-notify")
+
+const (
+	// EventSource is the component of the events recorded by the operator
+	EventSource = "rook-ceph-operator"
+
+	// PoolCreated is the reason of the event of a pool created in a cluster
+	PoolCreated = "PoolCreated"
+	// OSDFailed is the reason of the event of an osd down for longer than the grace period
+	OSDFailed = "OSDFailed"
+	// NodeJoined is the reason of the event of a node whose devices are published for the first time
+	NodeJoined = "NodeJoined"
+	// HealthDegraded is the reason of the event of the health of a cluster getting worse
+	HealthDegraded = "HealthDegraded"
+	// HealthRecovered is the reason of the event of the health of a cluster back to HEALTH_OK
+	HealthRecovered = "HealthRecovered"
+
+	watchRetryInterval = 10 * time.Second
+)
+
+var (
+	// HealthCheckInterval is the interval to check the health of the cluster for the health events
+	HealthCheckInterval = time.Minute
+
+	// the order of the health status from the best to the worst
+	healthRank = map[string]int{client.CephHealthOK: 0, client.CephHealthWarn: 1, client.CephHealthErr: 2}
+)
+
+// Record records an event of the operator on the object in the namespace. The events are seen with kubectl and are
+// posted to the webhooks of the cluster.
+func Record(clientset kubernetes.Interface, namespace string, object v1.ObjectReference, eventType, reason, message string) error {
+	now := metav1.Now()
+	event := &v1.Event{
+		ObjectMeta:     metav1.ObjectMeta{Name: fmt.Sprintf("%s.%x", object.Name, now.UnixNano()), Namespace: namespace},
+		InvolvedObject: object,
+		Reason:         reason,
+		Message:        message,
+		Type:           eventType,
+		Source:         v1.EventSource{Component: EventSource},
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+		Count:          1,
+	}
+	if _, err := clientset.CoreV1().Events(namespace).Create(event); err != nil {
+		return fmt.Errorf("failed to create the %s event of %s %s. %+v", reason, object.Kind, object.Name, err)
+	}
+	return nil
+}
+
+// Notifier posts the events of the operator in the namespace of a cluster to the webhooks of the cluster, sends them to
+// the snmp managers of the cluster, and records the events of the changes of the health of the cluster
+type Notifier struct {
+	context   *clusterd.Context
+	namespace string
+	// the cluster object the health events are recorded on
+	cluster v1.ObjectReference
+	// Spec returns the current notification settings of the cluster
+	Spec func() cephv1beta1.NotificationSpec
+
+	webhooks *webhooks
+	traps    *traps
+	// the last health status of the cluster, empty until the health is checked
+	lastHealth string
+	// the resource version of the last event seen by the watch, where the watch resumes when it is restarted
+	resourceVersion string
+}
+
+// NewNotifier creates a notifier of the events of the cluster in the namespace
+func NewNotifier(context *clusterd.Context, namespace string, cluster metav1.OwnerReference) *Notifier {
+	n := &Notifier{
+		context:   context,
+		namespace: namespace,
+		cluster:   v1.ObjectReference{Kind: cluster.Kind, APIVersion: cluster.APIVersion, Name: cluster.Name, UID: cluster.UID, Namespace: namespace},
+		Spec:      func() cephv1beta1.NotificationSpec { return cephv1beta1.NotificationSpec{} },
+	}
+	n.webhooks = newWebhooks(context, namespace, cluster, func() []cephv1beta1.WebhookSpec { return n.Spec().Webhooks })
+	n.traps = newTraps(context, namespace, func() cephv1beta1.SNMPSpec { return n.Spec().SNMP })
+	return n
+}
+
+// Start posts the events to the webhooks and checks the health of the cluster until the channel is closed
+func (n *Notifier) Start(stopCh chan struct{}) {
+	go n.watchEvents(stopCh)
+
+	for {
+		select {
+		case <-stopCh:
+			logger.Infof("stopping the notifications of cluster %s", n.namespace)
+			return
+		case <-time.After(HealthCheckInterval):
+			if err := n.checkHealth(); err != nil {
+				logger.Warningf("failed to check the health of cluster %s for the notifications. %+v", n.namespace, err)
+			}
+		}
+	}
+}
+
+// checkHealth records an event when the health of the cluster gets worse, or when it is back to HEALTH_OK. The
+// health seen at the first check is not an event since the operator does not know the health before it started.
+func (n *Notifier) checkHealth() error {
+	status, err := client.Status(n.context, n.namespace)
+	if err != nil {
+		return err
+	}
+	health := status.Health.Status
+	last := n.lastHealth
+	n.lastHealth = health
+	if last == "" || health == last {
+		return nil
+	}
+
+	if healthRank[health] > healthRank[last] {
+		message := fmt.Sprintf("the health of cluster %s changed from %s to %s: %s", n.namespace, last, health, healthSummary(status.Health))
+		return Record(n.context.Clientset, n.namespace, n.cluster, v1.EventTypeWarning, HealthDegraded, message)
+	}
+	if health == client.CephHealthOK {
+		message := fmt.Sprintf("the health of cluster %s changed from %s to %s", n.namespace, last, health)
+		return Record(n.context.Clientset, n.namespace, n.cluster, v1.EventTypeNormal, HealthRecovered, message)
+	}
+	return nil
+}
+
+// healthSummary returns the messages of the health checks of the cluster sorted by check
+func healthSummary(health client.HealthStatus) string {
+	var names []string
+	for name := range health.Checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var messages []string
+	for _, name := range names {
+		messages = append(messages, fmt.Sprintf("%s: %s", name, health.Checks[name].Summary.Message))
+	}
+	return strings.Join(messages, "; ")
+}
+
+// watchEvents queues the events of the operator created in the namespace since the notifier started for the webhooks,
+// and sends them to the snmp managers
+func (n *Notifier) watchEvents(stopCh chan struct{}) {
+	for {
+		if err := n.watch(stopCh); err != nil {
+			logger.Warningf("failed to watch the events of cluster %s for the notifications, trying again. %+v", n.namespace, err)
+		}
+		select {
+		case <-stopCh:
+			return
+		case <-time.After(watchRetryInterval):
+		}
+	}
+}
+
+// watch watches the events from the last event seen by the previous watch, so no events are missed when the watch
+// is restarted. The events are listed only when the notifier starts or the version of the last event expired.
+func (n *Notifier) watch(stopCh chan struct{}) error {
+	if n.resourceVersion == "" {
+		// the events from before the watch started are in the list and are not posted again
+		events, err := n.context.Clientset.CoreV1().Events(n.namespace).List(metav1.ListOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to list the events. %+v", err)
+		}
+		n.resourceVersion = events.ResourceVersion
+	}
+	w, err := n.context.Clientset.CoreV1().Events(n.namespace).Watch(metav1.ListOptions{ResourceVersion: n.resourceVersion})
+	if err != nil {
+		return fmt.Errorf("failed to start the watch of the events. %+v", err)
+	}
+	defer w.Stop()
+
+	for {
+		select {
+		case <-stopCh:
+			return nil
+		case e, ok := <-w.ResultChan():
+			if !ok {
+				logger.Debugf("event watch of cluster %s closed, restarting it from version %s", n.namespace, n.resourceVersion)
+				return nil
+			}
+			if e.Type == watch.Error {
+				// the version is too old to resume from, the events are listed again
+				n.resourceVersion = ""
+				return fmt.Errorf("event watch failed. %+v", errors.FromObject(e.Object))
+			}
+			event, ok := e.Object.(*v1.Event)
+			if !ok {
+				continue
+			}
+			n.resourceVersion = event.ResourceVersion
+			// the updates of the events are repeats of the same event
+			if e.Type != watch.Added || event.Source.Component != EventSource {
+				continue
+			}
+			notification := newNotification(n.namespace, event)
+			n.webhooks.queue(notification, stopCh)
+			n.traps.send(notification)
+		}
+	}
+}
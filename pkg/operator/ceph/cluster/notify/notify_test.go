@@ -0,0 +1,301 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package notify
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	cephv1beta1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1beta1"
+	"github.com/rook/rook/pkg/clusterd"
+	exectest "github.com/rook/rook/pkg/util/exec/test"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestWebhookDelivery(t *testing.T) {
+	defer func(attempts int, interval time.Duration) { DeliveryAttempts, RetryInterval = attempts, interval }(DeliveryAttempts, RetryInterval)
+	RetryInterval = time.Millisecond
+	failures := 1
+	var received []Notification
+	var signatures []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failures > 0 {
+			failures--
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		var n Notification
+		assert.Nil(t, json.Unmarshal(body, &n))
+		received = append(received, n)
+		signatures = append(signatures, r.Header.Get(SignatureHeader))
+	}))
+	defer server.Close()
+
+	clientset := fake.NewSimpleClientset(&v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "cmdb-key", Namespace: "ns"},
+		Data:       map[string][]byte{SecretKey: []byte("key")},
+	})
+	specs := []cephv1beta1.WebhookSpec{
+		{Name: "cmdb", URL: server.URL, SecretName: "cmdb-key", Events: []string{PoolCreated}},
+		{Name: "down", URL: "http://127.0.0.1:1/"},
+	}
+	ownerRef := metav1.OwnerReference{Kind: "Cluster", Name: "ns", UID: "cluster-uid"}
+	w := newWebhooks(&clusterd.Context{Clientset: clientset}, "ns", ownerRef, func() []cephv1beta1.WebhookSpec { return specs })
+	event := &v1.Event{Reason: PoolCreated, Type: v1.EventTypeNormal, Message: "created pool replicapool",
+		InvolvedObject: v1.ObjectReference{Kind: "Pool", Name: "replicapool"}}
+
+	// the notification is posted again after a failure, and signed with the secret of the webhook
+	status := w.post(specs[0], newNotification("ns", event), nil)
+	assert.Equal(t, 1, status.Delivered)
+	assert.Equal(t, 2, status.LastAttempts)
+	assert.Equal(t, "", status.LastError)
+	assert.Equal(t, 1, len(received))
+	assert.Equal(t, "replicapool", received[0].Name)
+	assert.Equal(t, PoolCreated, received[0].Reason)
+	body, _ := json.Marshal(newNotification("ns", event))
+	assert.Equal(t, sign([]byte("key"), body), signatures[0])
+
+	// the notification is dropped after all its attempts failed
+	DeliveryAttempts = 2
+	status = w.post(specs[1], newNotification("ns", event), nil)
+	assert.Equal(t, 0, status.Delivered)
+	assert.Equal(t, 1, status.Failed)
+	assert.Equal(t, 2, status.LastAttempts)
+	assert.NotEqual(t, "", status.LastError)
+
+	// the status of each webhook is saved
+	assert.Nil(t, w.saveStatus("cmdb", DeliveryStatus{Delivered: 3}))
+	assert.Nil(t, w.saveStatus("down", DeliveryStatus{Failed: 1}))
+	assert.Equal(t, 3, w.loadStatus("cmdb").Delivered)
+	assert.Equal(t, 1, w.loadStatus("down").Failed)
+	cm, err := clientset.CoreV1().ConfigMaps("ns").Get(StatusConfigMapName, metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, []metav1.OwnerReference{ownerRef}, cm.OwnerReferences)
+
+	// the webhooks only get the events they subscribed to
+	assert.True(t, subscribed(specs[0], PoolCreated))
+	assert.False(t, subscribed(specs[0], OSDFailed))
+	assert.True(t, subscribed(specs[1], OSDFailed))
+
+	// the notifications are not queued without webhooks
+	specs = nil
+	w.queue(newNotification("ns", event), nil)
+	assert.Equal(t, 0, len(w.queues))
+}
+
+func TestWebhookQueues(t *testing.T) {
+	defer func(attempts int, interval time.Duration) { DeliveryAttempts, RetryInterval = attempts, interval }(DeliveryAttempts, RetryInterval)
+	RetryInterval = time.Hour
+	received := make(chan Notification, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var n Notification
+		assert.Nil(t, json.NewDecoder(r.Body).Decode(&n))
+		received <- n
+	}))
+	defer server.Close()
+
+	specs := []cephv1beta1.WebhookSpec{
+		{Name: "down", URL: "http://127.0.0.1:1/"},
+		{Name: "cmdb", URL: server.URL},
+	}
+	w := newWebhooks(&clusterd.Context{Clientset: fake.NewSimpleClientset()}, "ns", metav1.OwnerReference{},
+		func() []cephv1beta1.WebhookSpec { return specs })
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+
+	// the webhook that is down waits to retry while the notifications are delivered to the other webhook
+	w.queue(Notification{Cluster: "ns", Reason: PoolCreated}, stopCh)
+	w.queue(Notification{Cluster: "ns", Reason: OSDFailed}, stopCh)
+	for _, reason := range []string{PoolCreated, OSDFailed} {
+		select {
+		case n := <-received:
+			assert.Equal(t, reason, n.Reason)
+		case <-time.After(5 * time.Second):
+			assert.Fail(t, "the notification was not delivered", reason)
+		}
+	}
+	assert.Equal(t, 2, len(w.queues))
+}
+
+func TestWatchResume(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	versions := make(chan string, 2)
+	watchers := make(chan *watch.FakeWatcher, 2)
+	clientset.PrependWatchReactor("events", func(action k8stesting.Action) (bool, watch.Interface, error) {
+		versions <- action.(k8stesting.WatchActionImpl).GetWatchRestrictions().ResourceVersion
+		watcher := watch.NewFakeWithChanSize(2, false)
+		watchers <- watcher
+		return true, watcher, nil
+	})
+	n := NewNotifier(&clusterd.Context{Clientset: clientset}, "ns", metav1.OwnerReference{Kind: "Cluster", Name: "ns"})
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+
+	done := make(chan error)
+	go func() { done <- n.watch(stopCh) }()
+	watcher := <-watchers
+	watcher.Add(&v1.Event{ObjectMeta: metav1.ObjectMeta{Name: "e1", ResourceVersion: "12"}, Source: v1.EventSource{Component: "kubelet"}})
+	watcher.Stop()
+	assert.Nil(t, <-done)
+	assert.Equal(t, "", <-versions)
+	assert.Equal(t, "12", n.resourceVersion)
+
+	// the restarted watch resumes from the last event
+	go func() { done <- n.watch(stopCh) }()
+	watcher = <-watchers
+	assert.Equal(t, "12", <-versions)
+
+	// the events are listed again when the version expired
+	watcher.Error(&metav1.Status{Status: metav1.StatusFailure, Reason: metav1.StatusReasonGone, Code: http.StatusGone})
+	assert.NotNil(t, <-done)
+	assert.Equal(t, "", n.resourceVersion)
+}
+
+func TestHealthEvents(t *testing.T) {
+	health := "HEALTH_OK"
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithOutputFile: func(debug bool, actionName, command, outFileArg string, args ...string) (string, error) {
+			return fmt.Sprintf(`{"health":{"status":"%s","checks":{"OSD_DOWN":{"severity":"HEALTH_WARN","summary":{"message":"1 osds down"}}}}}`, health), nil
+		},
+	}
+	clientset := fake.NewSimpleClientset()
+	n := NewNotifier(&clusterd.Context{Executor: executor, Clientset: clientset}, "ns", metav1.OwnerReference{Kind: "Cluster", Name: "ns"})
+	reasons := func() []string {
+		events, err := clientset.CoreV1().Events("ns").List(metav1.ListOptions{})
+		assert.Nil(t, err)
+		var r []string
+		for _, e := range events.Items {
+			r = append(r, e.Reason)
+		}
+		return r
+	}
+
+	// the health of the first check is not an event
+	assert.Nil(t, n.checkHealth())
+	assert.Equal(t, 0, len(reasons()))
+
+	health = "HEALTH_WARN"
+	assert.Nil(t, n.checkHealth())
+	assert.Equal(t, []string{HealthDegraded}, reasons())
+	assert.Nil(t, n.checkHealth())
+	assert.Equal(t, 1, len(reasons()))
+
+	// a better health that is not ok is not an event
+	health = "HEALTH_ERR"
+	assert.Nil(t, n.checkHealth())
+	health = "HEALTH_WARN"
+	assert.Nil(t, n.checkHealth())
+	assert.Equal(t, 2, len(reasons()))
+
+	health = "HEALTH_OK"
+	assert.Nil(t, n.checkHealth())
+	assert.Equal(t, 3, len(reasons()))
+	assert.Contains(t, reasons(), HealthRecovered)
+}
+
+func TestBER(t *testing.T) {
+	oid, err := berObjectID(snmpTrapOID)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{0x06, 0x0a, 0x2b, 0x06, 0x01, 0x06, 0x03, 0x01, 0x01, 0x04, 0x01, 0x00}, oid)
+	oid, err = berObjectID(rookCephOID)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{0x06, 0x06, 0x2b, 0x06, 0x01, 0x03, 0x8f, 0x62}, oid)
+	_, err = berObjectID("1.3.x")
+	assert.NotNil(t, err)
+
+	assert.Equal(t, []byte{0x00}, berInt(0))
+	assert.Equal(t, []byte{0x7f}, berInt(127))
+	assert.Equal(t, []byte{0x00, 0x80}, berInt(128))
+	assert.Equal(t, []byte{0xff, 0x7f}, berInt(-129))
+	assert.Equal(t, []byte{0x00, 0xff, 0xff, 0xff, 0xff}, berUint(0xffffffff))
+
+	assert.Equal(t, []byte{0x04, 0x02, 'o', 'k'}, berString("ok"))
+	long := berTLV(berOctetString, make([]byte, 300))
+	assert.Equal(t, []byte{0x04, 0x82, 0x01, 0x2c}, long[:4])
+	assert.Equal(t, 258, len(berString(string(make([]byte, 300)))))
+	// the strings are truncated on a character boundary
+	truncated := berString(strings.Repeat("é", 200))
+	assert.Equal(t, 257, len(truncated))
+	assert.True(t, utf8.Valid(truncated[3:]))
+}
+
+func TestSNMPTraps(t *testing.T) {
+	listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer listener.Close()
+
+	spec := cephv1beta1.SNMPSpec{Targets: []string{listener.LocalAddr().String()}, Events: []string{HealthDegraded}}
+	context := &clusterd.Context{Clientset: fake.NewSimpleClientset()}
+	traps := newTraps(context, "ns", func() cephv1beta1.SNMPSpec { return spec })
+	degraded := Notification{Cluster: "ns", Reason: HealthDegraded, Type: v1.EventTypeWarning, Message: "OSD_DOWN: 1 osds down", Kind: "Cluster", Name: "ns"}
+
+	// the trap is a v2c trap with the community, the oid of the notification and the strings of the event
+	traps.send(degraded)
+	packet := make([]byte, 1500)
+	listener.SetReadDeadline(time.Now().Add(5 * time.Second))
+	size, _, err := listener.ReadFrom(packet)
+	assert.Nil(t, err)
+	packet = packet[:size]
+	assert.Equal(t, byte(berSequence), packet[0])
+	// the trap is longer than 127 bytes, so its length takes two bytes
+	header := []byte{0x02, 0x01, 0x01, 0x04, 0x06, 'p', 'u', 'b', 'l', 'i', 'c', berSNMPv2TrapPDU}
+	assert.Equal(t, header, packet[3:3+len(header)])
+	trapOID, _ := berObjectID(healthDegradedTrapOID)
+	assert.Contains(t, string(packet), string(trapOID))
+	assert.Contains(t, string(packet), "OSD_DOWN: 1 osds down")
+
+	// the events the managers did not subscribe to are not sent
+	traps.send(Notification{Cluster: "ns", Reason: PoolCreated})
+	listener.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	_, _, err = listener.ReadFrom(packet)
+	assert.NotNil(t, err)
+
+	// the traps are not sent while the secret with the community is missing
+	spec.SecretName = "snmp-community"
+	traps.send(degraded)
+	listener.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	_, _, err = listener.ReadFrom(packet)
+	assert.NotNil(t, err)
+
+	// the traps are sent with the community of the secret
+	_, err = context.Clientset.CoreV1().Secrets("ns").Create(&v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "snmp-community", Namespace: "ns"},
+		Data:       map[string][]byte{SNMPCommunityKey: []byte("rook")},
+	})
+	assert.Nil(t, err)
+	traps.send(degraded)
+	packet = make([]byte, 1500)
+	listener.SetReadDeadline(time.Now().Add(5 * time.Second))
+	size, _, err = listener.ReadFrom(packet)
+	assert.Nil(t, err)
+	header = []byte{0x02, 0x01, 0x01, 0x04, 0x04, 'r', 'o', 'o', 'k', berSNMPv2TrapPDU}
+	assert.Equal(t, header, packet[3:3+len(header)])
+}
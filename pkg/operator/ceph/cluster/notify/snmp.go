@@ -0,0 +1,274 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package notify
+
+import (
+	"fmt"
+	"math/rand"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	cephv1beta1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1beta1"
+	"github.com/rook/rook/pkg/clusterd"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// SNMPCommunityKey is the key of the secret of the snmp managers with the community of the traps
+	SNMPCommunityKey = "community"
+
+	defaultSNMPPort      = "162"
+	defaultSNMPCommunity = "public"
+	snmpVersion2c        = 1
+	snmpSendTimeout      = 5 * time.Second
+	// the unit of the sysUpTime of the traps
+	timeTick = 10 * time.Millisecond
+	// the max size of the strings of the traps, which are DisplayStrings in the mib
+	maxDisplayString = 255
+
+	// the oids of the ROOK-CEPH-MIB in cluster/examples/kubernetes/ceph/ROOK-CEPH-MIB.txt, which is under the
+	// experimental arc until rook has an enterprise number
+	rookCephOID            = "1.3.6.1.3.2018"
+	healthDegradedTrapOID  = rookCephOID + ".0.1"
+	healthRecoveredTrapOID = rookCephOID + ".0.2"
+	eventTrapOID           = rookCephOID + ".0.3"
+	clusterObjectOID       = rookCephOID + ".1.1.0"
+	reasonObjectOID        = rookCephOID + ".1.2.0"
+	severityObjectOID      = rookCephOID + ".1.3.0"
+	kindObjectOID          = rookCephOID + ".1.4.0"
+	nameObjectOID          = rookCephOID + ".1.5.0"
+	messageObjectOID       = rookCephOID + ".1.6.0"
+	sysUpTimeOID           = "1.3.6.1.2.1.1.3.0"
+	snmpTrapOID            = "1.3.6.1.6.3.1.1.4.1.0"
+
+	// the ber tags of the trap
+	berInteger       = 0x02
+	berOctetString   = 0x04
+	berOID           = 0x06
+	berSequence      = 0x30
+	berTimeTicks     = 0x43
+	berSNMPv2TrapPDU = 0xa7
+)
+
+// traps sends the notifications of a cluster to the snmp managers of the cluster as snmp v2c traps. The traps are not
+// acknowledged by the managers, so they are sent once.
+type traps struct {
+	context   *clusterd.Context
+	namespace string
+	spec      func() cephv1beta1.SNMPSpec
+	// the start of the notifier, which is the sysUpTime of the traps
+	start time.Time
+}
+
+func newTraps(context *clusterd.Context, namespace string, spec func() cephv1beta1.SNMPSpec) *traps {
+	return &traps{context: context, namespace: namespace, spec: spec, start: time.Now()}
+}
+
+// send sends the trap of the notification to each manager if the manager subscribed to its reason
+func (t *traps) send(n Notification) {
+	spec := t.spec()
+	if len(spec.Targets) == 0 || !subscribedTo(spec.Events, n.Reason) {
+		return
+	}
+	community, err := t.community(spec.SecretName)
+	if err != nil {
+		logger.Warningf("failed to send the snmp trap of the %s notification of cluster %s. %+v", n.Reason, t.namespace, err)
+		return
+	}
+	packet, err := trapPacket(community, rand.Int31(), time.Since(t.start), n)
+	if err != nil {
+		logger.Warningf("failed to encode the snmp trap of the %s notification of cluster %s. %+v", n.Reason, t.namespace, err)
+		return
+	}
+	for _, target := range spec.Targets {
+		if err := sendTrap(target, packet); err != nil {
+			logger.Warningf("failed to send the snmp trap of the %s notification of cluster %s to %s. %+v", n.Reason, t.namespace, target, err)
+		}
+	}
+}
+
+// community returns the community in the secret of the snmp managers, which is read for each trap so that a new
+// community is used as soon as the secret is updated
+func (t *traps) community(secretName string) (string, error) {
+	if secretName == "" {
+		return defaultSNMPCommunity, nil
+	}
+	secret, err := t.context.Clientset.CoreV1().Secrets(t.namespace).Get(secretName, metav1.GetOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to get the secret %s of the snmp managers. %+v", secretName, err)
+	}
+	community, ok := secret.Data[SNMPCommunityKey]
+	if !ok {
+		return "", fmt.Errorf("secret %s has no %s key", secretName, SNMPCommunityKey)
+	}
+	return string(community), nil
+}
+
+func sendTrap(target string, packet []byte) error {
+	if _, _, err := net.SplitHostPort(target); err != nil {
+		target = net.JoinHostPort(target, defaultSNMPPort)
+	}
+	conn, err := net.DialTimeout("udp", target, snmpSendTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetWriteDeadline(time.Now().Add(snmpSendTimeout))
+	_, err = conn.Write(packet)
+	return err
+}
+
+// subscribedTo returns whether the reason is one of the events, where no events means all the events
+func subscribedTo(events []string, reason string) bool {
+	if len(events) == 0 {
+		return true
+	}
+	for _, e := range events {
+		if e == reason {
+			return true
+		}
+	}
+	return false
+}
+
+// trapOID returns the notification of the mib for the reason of the event
+func trapOID(reason string) string {
+	switch reason {
+	case HealthDegraded:
+		return healthDegradedTrapOID
+	case HealthRecovered:
+		return healthRecoveredTrapOID
+	}
+	return eventTrapOID
+}
+
+// trapPacket encodes the snmp v2c trap of the notification
+func trapPacket(community string, requestID int32, uptime time.Duration, n Notification) ([]byte, error) {
+	trap, err := berObjectID(trapOID(n.Reason))
+	if err != nil {
+		return nil, err
+	}
+	// the first two variables of a v2 trap are the uptime and the oid of the notification
+	values := []struct {
+		oid   string
+		value []byte
+	}{
+		{sysUpTimeOID, berTLV(berTimeTicks, berUint(uint32(uptime/timeTick)))},
+		{snmpTrapOID, trap},
+		{clusterObjectOID, berString(n.Cluster)},
+		{reasonObjectOID, berString(n.Reason)},
+		{severityObjectOID, berString(n.Type)},
+		{kindObjectOID, berString(n.Kind)},
+		{nameObjectOID, berString(n.Name)},
+		{messageObjectOID, berString(n.Message)},
+	}
+	var varbinds []byte
+	for _, v := range values {
+		name, err := berObjectID(v.oid)
+		if err != nil {
+			return nil, err
+		}
+		varbinds = append(varbinds, berTLV(berSequence, append(name, v.value...))...)
+	}
+
+	pdu := berTLV(berInteger, berInt(int64(requestID)))
+	pdu = append(pdu, berTLV(berInteger, berInt(0))...) // error-status
+	pdu = append(pdu, berTLV(berInteger, berInt(0))...) // error-index
+	pdu = append(pdu, berTLV(berSequence, varbinds)...)
+
+	message := berTLV(berInteger, berInt(snmpVersion2c))
+	message = append(message, berTLV(berOctetString, []byte(community))...)
+	message = append(message, berTLV(berSNMPv2TrapPDU, pdu)...)
+	return berTLV(berSequence, message), nil
+}
+
+// berTLV encodes the tag, the length and the value of a ber element
+func berTLV(tag byte, value []byte) []byte {
+	encoded := []byte{tag}
+	length := len(value)
+	switch {
+	case length < 0x80:
+		encoded = append(encoded, byte(length))
+	case length <= 0xff:
+		encoded = append(encoded, 0x81, byte(length))
+	default:
+		encoded = append(encoded, 0x82, byte(length>>8), byte(length))
+	}
+	return append(encoded, value...)
+}
+
+// berInt encodes the integer in the fewest bytes of two's complement
+func berInt(v int64) []byte {
+	encoded := []byte{byte(v)}
+	for v > 0x7f || v < -0x80 {
+		v >>= 8
+		encoded = append([]byte{byte(v)}, encoded...)
+	}
+	return encoded
+}
+
+// berUint encodes the unsigned integer, with a leading zero byte if its top bit is set
+func berUint(v uint32) []byte {
+	return berInt(int64(v))
+}
+
+// berString encodes the string as an octet string, truncated to the size of a DisplayString without splitting a
+// utf-8 character
+func berString(s string) []byte {
+	if len(s) > maxDisplayString {
+		end := maxDisplayString
+		for end > 0 && !utf8.RuneStart(s[end]) {
+			end--
+		}
+		s = s[:end]
+	}
+	return berTLV(berOctetString, []byte(s))
+}
+
+// berObjectID encodes the dotted oid
+func berObjectID(oid string) ([]byte, error) {
+	parts := strings.Split(oid, ".")
+	if len(parts) < 2 {
+		return nil, fmt.Errorf("invalid oid %s", oid)
+	}
+	ids := make([]uint64, len(parts))
+	for i, p := range parts {
+		id, err := strconv.ParseUint(p, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid oid %s. %+v", oid, err)
+		}
+		ids[i] = id
+	}
+
+	encoded := base128(ids[0]*40 + ids[1])
+	for _, id := range ids[2:] {
+		encoded = append(encoded, base128(id)...)
+	}
+	return berTLV(berOID, encoded), nil
+}
+
+// base128 encodes the id of an oid in 7 bit groups, with the top bit set on all but the last group
+func base128(id uint64) []byte {
+	encoded := []byte{byte(id & 0x7f)}
+	for id >>= 7; id > 0; id >>= 7 {
+		encoded = append([]byte{byte(id&0x7f) | 0x80}, encoded...)
+	}
+	return encoded
+}
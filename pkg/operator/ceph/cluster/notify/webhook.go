@@ -0,0 +1,298 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package notify
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	cephv1beta1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1beta1"
+	"github.com/rook/rook/pkg/clusterd"
+	"github.com/rook/rook/pkg/operator/k8sutil"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// StatusConfigMapName is the config map with the delivery status of each webhook of the cluster
+	StatusConfigMapName = "rook-ceph-webhooks"
+	// SecretKey is the key of the secret of a webhook that signs the events
+	SecretKey = "secret"
+	// SignatureHeader is the header with the hex hmac-sha256 of the body of a notification, signed with the secret of
+	// the webhook
+	SignatureHeader = "X-Rook-Signature"
+
+	// the notifications waiting to be delivered to a webhook, after which its new notifications are dropped
+	maxQueuedNotifications = 100
+)
+
+var (
+	// DeliveryAttempts is the number of times a notification is posted to a webhook before it is dropped
+	DeliveryAttempts = 5
+	// RetryInterval is the time before a failed notification is posted again, doubled after each attempt
+	RetryInterval = 5 * time.Second
+	// DeliveryTimeout is the time a webhook has to answer a notification
+	DeliveryTimeout = 10 * time.Second
+)
+
+// Notification is the json posted to the webhooks for an event of a cluster
+type Notification struct {
+	// The namespace of the cluster
+	Cluster string `json:"cluster"`
+	// The reason of the event, such as PoolCreated
+	Reason string `json:"reason"`
+	// The type of the event, Normal or Warning
+	Type    string `json:"type"`
+	Message string `json:"message"`
+	// The kind and the name of the object of the event, such as the deployment of an osd
+	Kind string    `json:"kind"`
+	Name string    `json:"name"`
+	Time time.Time `json:"time"`
+}
+
+// DeliveryStatus is the status of the deliveries of the notifications to a webhook
+type DeliveryStatus struct {
+	// The number of notifications delivered, and dropped after all their attempts failed
+	Delivered int `json:"delivered"`
+	Failed    int `json:"failed"`
+	// The reason of the last notification and the time of its last attempt
+	LastReason  string    `json:"lastReason,omitempty"`
+	LastAttempt time.Time `json:"lastAttempt,omitempty"`
+	// The attempts of the last notification and the error of its last attempt if it failed
+	LastAttempts int    `json:"lastAttempts,omitempty"`
+	LastError    string `json:"lastError,omitempty"`
+}
+
+func newNotification(namespace string, event *v1.Event) Notification {
+	return Notification{
+		Cluster: namespace,
+		Reason:  event.Reason,
+		Type:    event.Type,
+		Message: event.Message,
+		Kind:    event.InvolvedObject.Kind,
+		Name:    event.InvolvedObject.Name,
+		Time:    event.FirstTimestamp.Time,
+	}
+}
+
+// webhooks delivers the notifications to the webhooks of a cluster. Each webhook has its own queue and goroutine, so
+// the deliveries to a webhook are in the order of the events and a webhook that is down does not delay the others.
+type webhooks struct {
+	context   *clusterd.Context
+	namespace string
+	ownerRef  metav1.OwnerReference
+	specs     func() []cephv1beta1.WebhookSpec
+	client    *http.Client
+	// the pending notifications of each webhook by name
+	queuesLock sync.Mutex
+	queues     map[string]chan Notification
+	// the status of the webhooks is in a single config map updated by the goroutines of all the webhooks
+	statusLock sync.Mutex
+}
+
+func newWebhooks(context *clusterd.Context, namespace string, ownerRef metav1.OwnerReference, specs func() []cephv1beta1.WebhookSpec) *webhooks {
+	return &webhooks{
+		context:   context,
+		namespace: namespace,
+		ownerRef:  ownerRef,
+		specs:     specs,
+		client:    &http.Client{Timeout: DeliveryTimeout},
+		queues:    map[string]chan Notification{},
+	}
+}
+
+// queue adds the notification to the deliveries of each webhook subscribed to its reason, starting the delivery of a
+// webhook with its first notification. The notification is dropped for a webhook with too many notifications waiting.
+func (w *webhooks) queue(n Notification, stopCh chan struct{}) {
+	w.queuesLock.Lock()
+	defer w.queuesLock.Unlock()
+	for _, spec := range w.specs() {
+		if !subscribed(spec, n.Reason) {
+			continue
+		}
+		pending, ok := w.queues[spec.Name]
+		if !ok {
+			pending = make(chan Notification, maxQueuedNotifications)
+			w.queues[spec.Name] = pending
+			go w.deliver(spec.Name, pending, stopCh)
+		}
+		select {
+		case pending <- n:
+		default:
+			logger.Warningf("dropping the %s notification of cluster %s for webhook %s, %d notifications are waiting", n.Reason, w.namespace, spec.Name, maxQueuedNotifications)
+		}
+	}
+}
+
+// deliver posts the queued notifications to the webhook until the channel is closed. The current settings of the
+// webhook are used for each notification, and the notifications are dropped if the webhook was removed.
+func (w *webhooks) deliver(name string, pending chan Notification, stopCh chan struct{}) {
+	for {
+		select {
+		case <-stopCh:
+			return
+		case n := <-pending:
+			spec, ok := w.spec(name)
+			if !ok {
+				logger.Infof("dropping the %s notification of cluster %s for removed webhook %s", n.Reason, w.namespace, name)
+				continue
+			}
+			status := w.post(spec, n, stopCh)
+			if err := w.saveStatus(spec.Name, status); err != nil {
+				logger.Warningf("failed to save the delivery status of webhook %s. %+v", spec.Name, err)
+			}
+		}
+	}
+}
+
+// spec returns the current settings of the webhook
+func (w *webhooks) spec(name string) (cephv1beta1.WebhookSpec, bool) {
+	for _, spec := range w.specs() {
+		if spec.Name == name {
+			return spec, true
+		}
+	}
+	return cephv1beta1.WebhookSpec{}, false
+}
+
+// post posts the notification to the webhook until it is delivered, all the attempts failed or the channel is closed,
+// and returns the status of the webhook updated with the delivery
+func (w *webhooks) post(spec cephv1beta1.WebhookSpec, n Notification, stopCh chan struct{}) DeliveryStatus {
+	status := w.loadStatus(spec.Name)
+	status.LastReason = n.Reason
+	status.LastError = ""
+
+	body, err := json.Marshal(n)
+	if err != nil {
+		status.Failed++
+		status.LastError = fmt.Sprintf("failed to marshal the notification. %+v", err)
+		return status
+	}
+	retry := RetryInterval
+	for attempt := 1; ; attempt++ {
+		status.LastAttempts = attempt
+		status.LastAttempt = time.Now().UTC()
+		err := w.postOnce(spec, body)
+		if err == nil {
+			status.Delivered++
+			return status
+		}
+		logger.Warningf("failed to post the %s notification of cluster %s to webhook %s (attempt %d of %d). %+v", n.Reason, w.namespace, spec.Name, attempt, DeliveryAttempts, err)
+
+		status.LastError = err.Error()
+		if attempt >= DeliveryAttempts {
+			status.Failed++
+			return status
+		}
+		select {
+		case <-stopCh:
+			status.Failed++
+			return status
+		case <-time.After(retry):
+			retry *= 2
+		}
+	}
+}
+
+func (w *webhooks) postOnce(spec cephv1beta1.WebhookSpec, body []byte) error {
+	request, err := http.NewRequest("POST", spec.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("invalid url. %+v", err)
+	}
+	request.Header.Set("Content-Type", "application/json")
+	if spec.SecretName != "" {
+		key, err := w.secret(spec.SecretName)
+		if err != nil {
+			return err
+		}
+		request.Header.Set(SignatureHeader, sign(key, body))
+	}
+
+	response, err := w.client.Do(request)
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return fmt.Errorf("webhook answered %s", response.Status)
+	}
+	return nil
+}
+
+// secret returns the key of the secret of a webhook, which is read for each delivery so that a new key is used as soon
+// as the secret is updated
+func (w *webhooks) secret(name string) ([]byte, error) {
+	secret, err := w.context.Clientset.CoreV1().Secrets(w.namespace).Get(name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the secret %s of the webhook. %+v", name, err)
+	}
+	key, ok := secret.Data[SecretKey]
+	if !ok {
+		return nil, fmt.Errorf("secret %s has no %s key", name, SecretKey)
+	}
+	return key, nil
+}
+
+// sign returns the signature of the body with the key, which the webhooks compare with the hmac of the body they got
+func sign(key, body []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// subscribed returns whether the notifications of the reason are posted to the webhook
+func subscribed(spec cephv1beta1.WebhookSpec, reason string) bool {
+	return subscribedTo(spec.Events, reason)
+}
+
+// loadStatus returns the delivery status of the webhook, or an empty status if none was saved
+func (w *webhooks) loadStatus(name string) DeliveryStatus {
+	var status DeliveryStatus
+	cm, err := w.context.Clientset.CoreV1().ConfigMaps(w.namespace).Get(StatusConfigMapName, metav1.GetOptions{})
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			logger.Warningf("failed to get the delivery status of the webhooks. %+v", err)
+		}
+		return status
+	}
+	if data, ok := cm.Data[name]; ok {
+		if err := json.Unmarshal([]byte(data), &status); err != nil {
+			logger.Warningf("ignoring the invalid delivery status of webhook %s. %+v", name, err)
+		}
+	}
+	return status
+}
+
+func (w *webhooks) saveStatus(name string, status DeliveryStatus) error {
+	data, err := json.Marshal(status)
+	if err != nil {
+		return fmt.Errorf("failed to marshal the delivery status. %+v", err)
+	}
+	w.statusLock.Lock()
+	defer w.statusLock.Unlock()
+	return k8sutil.ModifyConfigMap(w.context.Clientset, w.namespace, StatusConfigMapName, &w.ownerRef, func(cm *v1.ConfigMap) {
+		cm.Data[name] = string(data)
+	})
+}
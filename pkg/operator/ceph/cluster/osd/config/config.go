@@ -28,6 +28,9 @@ const (
 	OSDFSStoreNameFmt  = "rook-ceph-osd-%d-fs-backup"
 	configStoreNameFmt = "rook-ceph-osd-%s-config"
 	osdDirsKeyName     = "osd-dirs"
+
+	// WeightConfigMapName is the config map with the target crush weights of the osds, keyed by the name of the osd
+	WeightConfigMapName = "rook-ceph-osd-weights"
 )
 
 var logger = capnslog.NewPackageLogger("github.com/rook/rook", "osd-config")
@@ -42,6 +45,19 @@ const (
 	DatabaseSizeMBKey = "databaseSizeMB"
 	JournalSizeMBKey  = "journalSizeMB"
 	MetadataDeviceKey = "metadataDevice"
+	AdoptExistingKey  = "adoptExisting"
+	ReplaceSwappedKey = "replaceSwappedDevices"
+	CrushWeightKey    = "crushWeight"
+	GradualWeightKey  = "gradualWeightIn"
+
+	// the filesystem (ext4, xfs or btrfs) and the options of mkfs and mount for the filestore osds on devices
+	FilestoreFilesystemKey   = "filestoreFilesystem"
+	FilestoreMkfsOptionsKey  = "filestoreMkfsOptions"
+	FilestoreMountOptionsKey = "filestoreMountOptions"
+
+	// ProtectedDeviceOverrideKey is the device config that allows a device with a mounted filesystem to be formatted
+	// when its value is the name of the device
+	ProtectedDeviceOverrideKey = "protectedDeviceOverride"
 )
 
 type StoreConfig struct {
@@ -49,6 +65,18 @@ type StoreConfig struct {
 	WalSizeMB      int    `json:"walSizeMB,omitempty"`
 	DatabaseSizeMB int    `json:"databaseSizeMB,omitempty"`
 	JournalSizeMB  int    `json:"journalSizeMB,omitempty"`
+	AdoptExisting  bool   `json:"adoptExisting,omitempty"`
+	ReplaceSwapped bool   `json:"replaceSwappedDevices,omitempty"`
+	// The crush weight of the new osds instead of their size in TiB
+	CrushWeight float64 `json:"crushWeight,omitempty"`
+	// Whether the new osds are added with a zero crush weight that the operator raises to the target weight in steps
+	GradualWeightIn bool `json:"gradualWeightIn,omitempty"`
+	// The filesystem created on the devices of the new filestore osds, ext4 if empty
+	FilestoreFilesystem string `json:"filestoreFilesystem,omitempty"`
+	// The space-separated options of mkfs when the filesystem is created
+	FilestoreMkfsOptions string `json:"filestoreMkfsOptions,omitempty"`
+	// The comma-separated options of mount when the filesystem is mounted
+	FilestoreMountOptions string `json:"filestoreMountOptions,omitempty"`
 }
 
 func ToStoreConfig(config map[string]string) StoreConfig {
@@ -63,6 +91,20 @@ func ToStoreConfig(config map[string]string) StoreConfig {
 			storeConfig.DatabaseSizeMB = convertToIntIgnoreErr(v)
 		case JournalSizeMBKey:
 			storeConfig.JournalSizeMB = convertToIntIgnoreErr(v)
+		case AdoptExistingKey:
+			storeConfig.AdoptExisting = v == "true"
+		case ReplaceSwappedKey:
+			storeConfig.ReplaceSwapped = v == "true"
+		case CrushWeightKey:
+			storeConfig.CrushWeight = convertToFloatIgnoreErr(v)
+		case GradualWeightKey:
+			storeConfig.GradualWeightIn = v == "true"
+		case FilestoreFilesystemKey:
+			storeConfig.FilestoreFilesystem = v
+		case FilestoreMkfsOptionsKey:
+			storeConfig.FilestoreMkfsOptions = v
+		case FilestoreMountOptionsKey:
+			storeConfig.FilestoreMountOptions = v
 		}
 	}
 
@@ -88,3 +130,12 @@ func convertToIntIgnoreErr(raw string) int {
 
 	return val
 }
+
+func convertToFloatIgnoreErr(raw string) float64 {
+	val, err := strconv.ParseFloat(raw, 64)
+	if err != nil || val < 0 {
+		val = 0
+	}
+
+	return val
+}
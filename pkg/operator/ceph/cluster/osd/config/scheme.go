@@ -61,6 +61,10 @@ type PerfSchemeEntry struct {
 	Partitions map[PartitionType]*PerfSchemePartitionDetails `json:"partitions"` // mapping of partition name to its details
 	StoreType  string                                        `json:"storeType,omitempty"`
 	FSCreated  bool                                          `json:"fsCreated"`
+	// The filesystem and mount options of the data partition of a filestore osd, which are kept when the
+	// settings of the cluster change. An empty filesystem was created as ext4 before it was recorded.
+	Filesystem   string `json:"filesystem,omitempty"`
+	MountOptions string `json:"mountOptions,omitempty"`
 }
 
 // details for 1 OSD partition
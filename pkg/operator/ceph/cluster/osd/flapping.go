@@ -0,0 +1,256 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package osd
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/rook/rook/pkg/clusterd"
+	"github.com/rook/rook/pkg/daemon/ceph/client"
+	"github.com/rook/rook/pkg/operator/ceph/settings"
+	"github.com/rook/rook/pkg/operator/k8sutil"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// QuarantineAnnotation on the deployment of an osd records why the osd was quarantined. The deployment of a
+// quarantined osd is scaled down and is not updated by the orchestration until the annotation is removed.
+const QuarantineAnnotation = "ceph.rook.io/quarantined"
+
+var (
+	// FlapThreshold is how many times an osd may be marked up again within the FlapWindow before it is quarantined.
+	// The osds are never quarantined if the threshold is zero.
+	FlapThreshold = settings.NewInt(5)
+	// FlapWindow is the time in which the flaps of an osd are counted
+	FlapWindow = settings.NewDuration(30 * time.Minute)
+	// MaxQuarantinedOSDs is how many osds may be quarantined at the same time in the cluster
+	MaxQuarantinedOSDs = 3
+	// MaxQuarantinedOSDsPerHost is how many osds may be quarantined at the same time on a host, which is the failure
+	// domain of the pools by default
+	MaxQuarantinedOSDsPerHost = 1
+)
+
+// the id of a missing osd in the acting set of a pg of an erasure coded pool
+const missingOSD = 0x7fffffff
+
+// recordFlap records a flap of the osd if it was marked up again since the last check, which ceph records in the
+// epoch that the osd is up from. Several flaps between two checks are counted once. It returns whether the osd flapped
+// more often than the threshold within the window.
+func (m *Monitor) recordFlap(id int, upFrom int64, now time.Time) bool {
+	last, seen := m.upFrom[id]
+	m.upFrom[id] = upFrom
+	if !seen || upFrom <= last {
+		return false
+	}
+
+	flaps := append(m.flaps[id], now)
+	for len(flaps) > 0 && now.Sub(flaps[0]) > FlapWindow.Get() {
+		flaps = flaps[1:]
+	}
+	m.flaps[id] = flaps
+	logger.Warningf("osd.%d was marked up again. %d flaps in the last %s", id, len(flaps), FlapWindow.Get())
+	threshold := FlapThreshold.Get()
+	return threshold > 0 && len(flaps) > threshold
+}
+
+// quarantine marks the flapping osd out and scales its deployment down so it is not restarted. An event with the
+// host and devices of the osd is created on the deployment. The osd is not quarantined if too many osds are already
+// quarantined, or if stopping it would leave pgs with fewer copies than the min_size of their pool.
+func (m *Monitor) quarantine(id int, down map[int]bool) error {
+	if err := m.checkQuarantine(id, down); err != nil {
+		return fmt.Errorf("not quarantining osd.%d. %+v", id, err)
+	}
+	if _, err := client.OSDOut(m.context, m.clusterName, id); err != nil {
+		return fmt.Errorf("failed to mark osd.%d out. %+v", id, err)
+	}
+
+	suspect := "unknown devices"
+	if metadata, err := client.GetOSDMetadata(m.context, m.clusterName, id); err != nil {
+		logger.Warningf("failed to get the devices of osd.%d. %+v", id, err)
+	} else {
+		suspect = fmt.Sprintf("devices %s on host %s", metadata.Devices, metadata.Hostname)
+	}
+	reason := fmt.Sprintf("osd.%d flapped %d times in %s. suspected %s", id, len(m.flaps[id]), FlapWindow.Get(), suspect)
+
+	name := fmt.Sprintf(osdAppNameFmt, id)
+	d, err := m.context.Clientset.Extensions().Deployments(m.clusterName).Get(name, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get deployment %s. %+v", name, err)
+	}
+	replicas := int32(0)
+	d.Spec.Replicas = &replicas
+	if d.Annotations == nil {
+		d.Annotations = map[string]string{}
+	}
+	d.Annotations[QuarantineAnnotation] = reason
+	if _, err := m.context.Clientset.Extensions().Deployments(m.clusterName).Update(d); err != nil {
+		return fmt.Errorf("failed to scale down deployment %s. %+v", name, err)
+	}
+	delete(m.flaps, id)
+
+	now := metav1.Now()
+	event := &v1.Event{
+		ObjectMeta:     metav1.ObjectMeta{Name: fmt.Sprintf("%s.%x", name, now.UnixNano()), Namespace: m.clusterName},
+		InvolvedObject: v1.ObjectReference{Kind: "Deployment", Namespace: m.clusterName, Name: name, UID: d.UID},
+		Reason:         "OSDQuarantined",
+		Message:        reason,
+		Type:           v1.EventTypeWarning,
+		Source:         v1.EventSource{Component: "rook-ceph-operator"},
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+		Count:          1,
+	}
+	if _, err := m.context.Clientset.CoreV1().Events(m.clusterName).Create(event); err != nil {
+		logger.Warningf("failed to create the quarantine event of osd.%d. %+v", id, err)
+	}
+	logger.Errorf("quarantined %s", reason)
+	return nil
+}
+
+// checkQuarantine returns an error if the osd cannot be quarantined. The number of quarantined osds is limited in the
+// cluster and on each host, and the pgs of the osd must keep at least the min_size of their pool of the other osds up.
+func (m *Monitor) checkQuarantine(id int, down map[int]bool) error {
+	quarantined, err := quarantinedOSDs(m.context, m.clusterName)
+	if err != nil {
+		return err
+	}
+	if len(quarantined) >= MaxQuarantinedOSDs {
+		return fmt.Errorf("%d osds are already quarantined, which is the limit of the cluster", len(quarantined))
+	}
+
+	crush, err := client.GetCrushMap(m.context, m.clusterName)
+	if err != nil {
+		return fmt.Errorf("failed to get the crush map to find the host of the osd. %+v", err)
+	}
+	hosts := map[int]string{}
+	for _, b := range crush.Buckets {
+		if b.TypeName != "host" {
+			continue
+		}
+		for _, item := range b.Items {
+			hosts[item.ID] = b.Name
+		}
+	}
+	if host, ok := hosts[id]; ok {
+		count := 0
+		for _, q := range quarantined {
+			if hosts[q] == host {
+				count++
+			}
+		}
+		if count >= MaxQuarantinedOSDsPerHost {
+			return fmt.Errorf("%d osds are already quarantined on host %s, which is the limit of a host", count, host)
+		}
+	}
+
+	osdDump, err := client.GetOSDDump(m.context, m.clusterName)
+	if err != nil {
+		return err
+	}
+	minSize := map[int]int{}
+	for _, p := range osdDump.Pools {
+		minSize[p.ID] = p.MinSize
+	}
+	return client.ForEachPGDumpBrief(m.context, m.clusterName, func(pg client.PGDumpBrief) error {
+		if !intsContain(pg.ActingOsdIDs, id) {
+			return nil
+		}
+		poolID, err := pg.PoolID()
+		if err != nil {
+			return err
+		}
+		available := 0
+		for _, member := range pg.ActingOsdIDs {
+			if member != id && member != missingOSD && !down[member] {
+				available++
+			}
+		}
+		if available < minSize[poolID] {
+			return fmt.Errorf("pg %s would have %d copies available, less than the min_size %d of its pool", pg.ID, available, minSize[poolID])
+		}
+		return nil
+	})
+}
+
+func intsContain(values []int, value int) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// quarantinedOSDs returns the sorted ids of the osds whose deployments have the quarantine annotation
+func quarantinedOSDs(context *clusterd.Context, namespace string) ([]int, error) {
+	deployments, err := context.Clientset.Extensions().Deployments(namespace).List(metav1.ListOptions{LabelSelector: fmt.Sprintf("%s=%s", k8sutil.AppAttr, appName)})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list osd deployments. %+v", err)
+	}
+	var quarantined []int
+	for _, d := range deployments.Items {
+		if _, ok := d.Annotations[QuarantineAnnotation]; !ok {
+			continue
+		}
+		if id, err := strconv.Atoi(d.Labels[osdLabelKey]); err == nil {
+			quarantined = append(quarantined, id)
+		}
+	}
+	sort.Ints(quarantined)
+	return quarantined, nil
+}
+
+// updateQuarantineStatus sets the osds whose deployments have the quarantine annotation in the status of the cluster
+func (m *Monitor) updateQuarantineStatus() error {
+	quarantined, err := quarantinedOSDs(m.context, m.clusterName)
+	if err != nil {
+		return err
+	}
+
+	clusters, err := m.context.RookClientset.CephV1beta1().Clusters(m.clusterName).List(metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list clusters. %+v", err)
+	}
+	for i := range clusters.Items {
+		cluster := &clusters.Items[i]
+		if reflect.DeepEqual(cluster.Status.QuarantinedOSDs, quarantined) {
+			continue
+		}
+		cluster.Status.QuarantinedOSDs = quarantined
+		if _, err := m.context.RookClientset.CephV1beta1().Clusters(m.clusterName).Update(cluster); err != nil {
+			return fmt.Errorf("failed to update the quarantined osds in the status of cluster %s. %+v", cluster.Name, err)
+		}
+	}
+	return nil
+}
+
+// isQuarantined returns whether the deployment of the osd has the quarantine annotation
+func (c *Cluster) isQuarantined(id int) bool {
+	return osdQuarantined(c.context, c.Namespace, id)
+}
+
+func osdQuarantined(context *clusterd.Context, namespace string, id int) bool {
+	d, err := context.Clientset.Extensions().Deployments(namespace).Get(fmt.Sprintf(osdAppNameFmt, id), metav1.GetOptions{})
+	if err != nil {
+		return false
+	}
+	_, ok := d.Annotations[QuarantineAnnotation]
+	return ok
+}
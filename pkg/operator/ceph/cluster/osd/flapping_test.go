@@ -0,0 +1,156 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package osd
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	cephv1beta1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1beta1"
+	rookfake "github.com/rook/rook/pkg/client/clientset/versioned/fake"
+	"github.com/rook/rook/pkg/clusterd"
+	"github.com/rook/rook/pkg/operator/k8sutil"
+	exectest "github.com/rook/rook/pkg/util/exec/test"
+	"github.com/stretchr/testify/assert"
+	extensions "k8s.io/api/extensions/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestRecordFlap(t *testing.T) {
+	m := NewMonitor(&clusterd.Context{}, "ns")
+	now := time.Now()
+
+	// the first epoch of an osd is not a flap
+	assert.False(t, m.recordFlap(0, 10, now))
+	assert.False(t, m.recordFlap(0, 10, now))
+	assert.Equal(t, 0, len(m.flaps[0]))
+
+	for i := 1; i <= FlapThreshold.Get(); i++ {
+		assert.False(t, m.recordFlap(0, int64(10+i), now.Add(time.Duration(i)*time.Minute)))
+	}
+	assert.True(t, m.recordFlap(0, 20, now.Add(10*time.Minute)))
+
+	// the flaps older than the window are forgotten
+	assert.False(t, m.recordFlap(0, 21, now.Add(FlapWindow.Get()+5*time.Minute)))
+	assert.Equal(t, 3, len(m.flaps[0]))
+}
+
+func TestQuarantine(t *testing.T) {
+	var out []string
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithOutputFile: func(debug bool, actionName string, command string, outFileArg string, args ...string) (string, error) {
+			switch {
+			case args[0] == "osd" && args[1] == "out":
+				out = append(out, args[2])
+				return "", nil
+			case args[0] == "osd" && args[1] == "metadata":
+				return `{"id":3,"hostname":"node1","devices":"sdb","osd_objectstore":"bluestore"}`, nil
+			case args[0] == "osd" && args[1] == "crush" && args[2] == "dump":
+				return `{"buckets":[{"id":-2,"name":"node1","type_name":"host","items":[{"id":3}]}]}`, nil
+			case args[0] == "osd" && args[1] == "dump":
+				return `{"pools":[{"pool":1,"pool_name":"replicapool","size":3,"min_size":2}]}`, nil
+			case args[0] == "pg" && args[1] == "dump":
+				return `{"pg_stats":[{"pgid":"1.0","acting":[3,4,5]}]}`, nil
+			}
+			return "", fmt.Errorf("unexpected ceph command '%v'", args)
+		},
+	}
+	d := &extensions.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "rook-ceph-osd-3", Namespace: "ns",
+		Labels: map[string]string{k8sutil.AppAttr: appName, osdLabelKey: "3"}}}
+	clientset := fake.NewSimpleClientset(d)
+	rookClientset := rookfake.NewSimpleClientset(&cephv1beta1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "rook-ceph", Namespace: "ns"}})
+	context := &clusterd.Context{Executor: executor, Clientset: clientset, RookClientset: rookClientset}
+	m := NewMonitor(context, "ns")
+	m.flaps[3] = []time.Time{time.Now(), time.Now()}
+
+	assert.Nil(t, m.quarantine(3, map[int]bool{}))
+	assert.Equal(t, []string{"3"}, out)
+	d, err := clientset.Extensions().Deployments("ns").Get("rook-ceph-osd-3", metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, int32(0), *d.Spec.Replicas)
+	assert.Equal(t, "osd.3 flapped 2 times in 30m0s. suspected devices sdb on host node1", d.Annotations[QuarantineAnnotation])
+	events, err := clientset.CoreV1().Events("ns").List(metav1.ListOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(events.Items))
+	assert.Equal(t, "OSDQuarantined", events.Items[0].Reason)
+
+	// the orchestration does not update the quarantined osd
+	c := &Cluster{context: context, Namespace: "ns"}
+	assert.True(t, c.isQuarantined(3))
+	assert.False(t, c.isQuarantined(4))
+
+	// the quarantined osds are in the status of the cluster until the annotation is removed
+	assert.Nil(t, m.updateQuarantineStatus())
+	cluster, err := rookClientset.CephV1beta1().Clusters("ns").Get("rook-ceph", metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, []int{3}, cluster.Status.QuarantinedOSDs)
+
+	delete(d.Annotations, QuarantineAnnotation)
+	_, err = clientset.Extensions().Deployments("ns").Update(d)
+	assert.Nil(t, err)
+	assert.Nil(t, m.updateQuarantineStatus())
+	cluster, err = rookClientset.CephV1beta1().Clusters("ns").Get("rook-ceph", metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.Nil(t, cluster.Status.QuarantinedOSDs)
+}
+
+func TestCheckQuarantine(t *testing.T) {
+	acting := `[3,4,5]`
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithOutputFile: func(debug bool, actionName string, command string, outFileArg string, args ...string) (string, error) {
+			switch {
+			case args[0] == "osd" && args[1] == "crush" && args[2] == "dump":
+				return `{"buckets":[{"id":-2,"name":"node1","type_name":"host","items":[{"id":1},{"id":3}]},
+					{"id":-3,"name":"node2","type_name":"host","items":[{"id":2},{"id":4}]}]}`, nil
+			case args[0] == "osd" && args[1] == "dump":
+				return `{"pools":[{"pool":1,"pool_name":"replicapool","size":3,"min_size":2}]}`, nil
+			case args[0] == "pg" && args[1] == "dump":
+				return `{"pg_stats":[{"pgid":"1.0","acting":` + acting + `}]}`, nil
+			}
+			return "", fmt.Errorf("unexpected ceph command '%v'", args)
+		},
+	}
+	clientset := fake.NewSimpleClientset()
+	context := &clusterd.Context{Executor: executor, Clientset: clientset}
+	m := NewMonitor(context, "ns")
+	quarantineOSD := func(id int) {
+		d := &extensions.Deployment{ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("rook-ceph-osd-%d", id), Namespace: "ns",
+			Labels:      map[string]string{k8sutil.AppAttr: appName, osdLabelKey: fmt.Sprintf("%d", id)},
+			Annotations: map[string]string{QuarantineAnnotation: "flapping"}}}
+		_, err := clientset.Extensions().Deployments("ns").Create(d)
+		assert.Nil(t, err)
+	}
+
+	assert.Nil(t, m.checkQuarantine(3, map[int]bool{}))
+
+	// the pg would lose a copy below the min_size of its pool
+	assert.NotNil(t, m.checkQuarantine(3, map[int]bool{4: true}))
+	acting = `[3,4,2147483647]`
+	assert.NotNil(t, m.checkQuarantine(3, map[int]bool{}))
+	acting = `[3,4,5]`
+
+	// only one osd is quarantined on a host
+	quarantineOSD(1)
+	assert.NotNil(t, m.checkQuarantine(3, map[int]bool{}))
+	assert.Nil(t, m.checkQuarantine(4, map[int]bool{}))
+
+	// the number of quarantined osds of the cluster is limited
+	quarantineOSD(2)
+	quarantineOSD(6)
+	assert.NotNil(t, m.checkQuarantine(5, map[int]bool{}))
+}
@@ -16,10 +16,13 @@ limitations under the License.
 package osd
 
 import (
+	"fmt"
 	"time"
 
 	"github.com/rook/rook/pkg/clusterd"
 	"github.com/rook/rook/pkg/daemon/ceph/client"
+	"github.com/rook/rook/pkg/operator/ceph/cluster/notify"
+	"k8s.io/api/core/v1"
 )
 
 const upStatus = 1
@@ -37,11 +40,27 @@ type Monitor struct {
 	// lastStatus keeps track of OSDs status
 	// key - OSD id; value: time of the status change.
 	lastStatus map[int]time.Time
+
+	// the epoch each osd was last seen up from, and the recent times each osd was marked up again
+	upFrom map[int]int64
+	flaps  map[int][]time.Time
+
+	// the time each osd was first seen down, to replace the osds that stay down with spare devices
+	downSince map[int]time.Time
+	// the osds down for longer than the grace period whose failure was reported
+	failed map[int]bool
+	// the osds replaced with a spare in the current check
+	replaced int
+	// ProvisionSpares is called to provision the spare devices after an osd was replaced with a spare
+	ProvisionSpares func()
+	// AllowSpareReplace returns whether the maintenance windows allow an osd to be replaced with a spare now
+	AllowSpareReplace func() bool
 }
 
 // newMonitor instantiates OSD monitoring
 func NewMonitor(context *clusterd.Context, clusterName string) *Monitor {
-	return &Monitor{context, clusterName, make(map[int]time.Time)}
+	return &Monitor{context: context, clusterName: clusterName, lastStatus: make(map[int]time.Time),
+		upFrom: make(map[int]int64), flaps: make(map[int][]time.Time), downSince: make(map[int]time.Time), failed: make(map[int]bool)}
 }
 
 // Run runs monitoring logic for osds status at set intervals
@@ -55,6 +74,9 @@ func (m *Monitor) Start(stopCh chan struct{}) {
 			if err != nil {
 				logger.Warningf("Failed OSD status check: %+v", err)
 			}
+			if err := m.updateQuarantineStatus(); err != nil {
+				logger.Warningf("failed to update the quarantined osds. %+v", err)
+			}
 
 		case <-stopCh:
 			logger.Infof("Stopping monitoring of OSDs in namespace %s", m.clusterName)
@@ -72,9 +94,25 @@ func (m *Monitor) osdStatus() error {
 	}
 	logger.Debugf("osd dump %v", osdDump)
 
+	down := map[int]bool{}
+	for _, osdStatus := range osdDump.OSDs {
+		id, err := osdStatus.OSD.Int64()
+		if err != nil {
+			continue
+		}
+		if status, _, err := osdDump.StatusByID(id); err == nil && status != upStatus {
+			down[int(id)] = true
+		}
+	}
+	m.replaced = 0
+
 	evalDownStatus := func(id int) {
 		if now := time.Now(); now.Sub(m.lastStatus[id]) > osdGracePeriod {
 			logger.Warningf("osd.%d has been down for longer than the grace period (down since %+v)", id, m.lastStatus[id])
+			if !m.failed[id] {
+				m.failed[id] = true
+				m.reportFailed(id, m.lastStatus[id])
+			}
 			m.lastStatus[id] = time.Now()
 		} else {
 			logger.Warningf("waiting for the osd.%d to exceed the grace period", id)
@@ -104,14 +142,102 @@ func (m *Monitor) osdStatus() error {
 			} else {
 				m.lastStatus[id] = time.Now()
 			}
+			m.checkSpare(id, time.Now(), down)
 		} else {
 			logger.Debugf("osd.%d is healthy.", id)
 			if tracked {
 				logger.Debugf("osd.%d recovered, stopping tracking.", id)
 				delete(m.lastStatus, id)
 			}
+			delete(m.downSince, id)
+			delete(m.failed, id)
+			upFrom, _ := osdStatus.UpFrom.Int64()
+			if m.recordFlap(id, upFrom, time.Now()) {
+				if err := m.quarantine(id, down); err != nil {
+					logger.Errorf("failed to quarantine flapping osd.%d. %+v", id, err)
+				}
+			}
 		}
 	}
 
 	return nil
 }
+
+// reportFailed records the event of the osd down for longer than the grace period, which is reported once until the
+// osd is up again
+func (m *Monitor) reportFailed(id int, since time.Time) {
+	object := v1.ObjectReference{Kind: "Deployment", Namespace: m.clusterName, Name: fmt.Sprintf(osdAppNameFmt, id)}
+	message := fmt.Sprintf("osd.%d has been down since %s", id, since.Format(time.RFC3339))
+	if err := notify.Record(m.context.Clientset, m.clusterName, object, v1.EventTypeWarning, notify.OSDFailed, message); err != nil {
+		logger.Warningf("%+v", err)
+	}
+}
+
+// checkSpare replaces the osd with a spare device when it has been down for longer than the spare timeout. If no
+// spare is available, the replacement is attempted again after another timeout. A quarantined osd is down on purpose
+// and is not replaced. The replacement waits for a maintenance window, for the next check if the osds replaced in this
+// check reached the limit, and for the host of the osd to come back if all the osds of the host are down.
+func (m *Monitor) checkSpare(id int, now time.Time, down map[int]bool) {
+	since, ok := m.downSince[id]
+	if !ok {
+		m.downSince[id] = now
+		return
+	}
+	if timeout := SpareReplaceTimeout.Get(); timeout == 0 || now.Sub(since) <= timeout {
+		return
+	}
+	if osdQuarantined(m.context, m.clusterName, id) {
+		logger.Debugf("osd.%d is quarantined. not replacing it with a spare", id)
+		return
+	}
+	if m.AllowSpareReplace != nil && !m.AllowSpareReplace() {
+		logger.Infof("osd.%d has been down for more than %s. waiting for a maintenance window to replace it with a spare", id, SpareReplaceTimeout.Get())
+		return
+	}
+	if m.replaced >= SpareReplacementsPerCheck {
+		logger.Infof("osd.%d has been down for more than %s. waiting for the next check to replace it with a spare", id, SpareReplaceTimeout.Get())
+		return
+	}
+	if m.hostDown(id, down) {
+		logger.Warningf("osd.%d and all the other osds on its host are down. waiting for the host instead of replacing the osd with a spare", id)
+		return
+	}
+
+	m.downSince[id] = now
+	replaced, err := m.replaceWithSpare(id, now)
+	if err != nil {
+		logger.Errorf("failed to replace osd.%d with a spare. %+v", id, err)
+	} else if !replaced {
+		logger.Warningf("osd.%d has been down for more than %s and no spare device is available to replace it", id, SpareReplaceTimeout.Get())
+	} else {
+		m.replaced++
+	}
+}
+
+// hostDown returns whether all the osds under the host bucket of the osd in the crush map are down, in which case
+// the host failed rather than the device of the osd. The host is assumed down if the crush map cannot be read.
+func (m *Monitor) hostDown(id int, down map[int]bool) bool {
+	crush, err := client.GetCrushMap(m.context, m.clusterName)
+	if err != nil {
+		logger.Warningf("failed to get the crush map to find the host of osd.%d. %+v", id, err)
+		return true
+	}
+	for _, b := range crush.Buckets {
+		if b.TypeName != "host" {
+			continue
+		}
+		found := false
+		allDown := true
+		for _, item := range b.Items {
+			if item.ID == id {
+				found = true
+			} else if item.ID >= 0 && !down[item.ID] {
+				allDown = false
+			}
+		}
+		if found {
+			return allDown && len(b.Items) > 1
+		}
+	}
+	return false
+}
@@ -20,7 +20,10 @@ import (
 	"time"
 
 	"github.com/rook/rook/pkg/clusterd"
+	"github.com/rook/rook/pkg/operator/ceph/cluster/notify"
 	exectest "github.com/rook/rook/pkg/util/exec/test"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -54,7 +57,8 @@ func TestOSDStatus(t *testing.T) {
 
 	// Setting up objects needed to create OSD
 	context := &clusterd.Context{
-		Executor: executor,
+		Executor:  executor,
+		Clientset: fake.NewSimpleClientset(),
 	}
 	// Initializing an OSD monitoring
 	osdMon := NewMonitor(context, cluster)
@@ -74,6 +78,15 @@ func TestOSDStatus(t *testing.T) {
 	assert.Equal(t, 2, execCount)
 	// OSD monitor should stop tracking that process once the action is triggered
 	assert.Equal(t, 1, len(osdMon.lastStatus))
+
+	// the failure of the osd is reported once while it is down
+	err = osdMon.osdStatus()
+	assert.Nil(t, err)
+	events, err := context.Clientset.CoreV1().Events(cluster).List(metav1.ListOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(events.Items))
+	assert.Equal(t, notify.OSDFailed, events.Items[0].Reason)
+	assert.Equal(t, "rook-ceph-osd-0", events.Items[0].InvolvedObject.Name)
 }
 
 func TestMonitorStart(t *testing.T) {
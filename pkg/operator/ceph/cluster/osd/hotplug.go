@@ -0,0 +1,207 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	rookalpha "github.com/rook/rook/pkg/apis/rook.io/v1alpha2"
+	"github.com/rook/rook/pkg/clusterd"
+	discoverDaemon "github.com/rook/rook/pkg/daemon/discover"
+	"github.com/rook/rook/pkg/operator/ceph/cluster/notify"
+	"github.com/rook/rook/pkg/operator/discover"
+	"github.com/rook/rook/pkg/operator/k8sutil"
+	"github.com/rook/rook/pkg/util/sys"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+var hotplugRetryInterval = 10 * time.Second
+
+// HotplugWatcher provisions the osds as soon as the discover agent of a node publishes a new empty device that is
+// selected by the storage settings of the cluster
+type HotplugWatcher struct {
+	context     *clusterd.Context
+	clusterName string
+	// Storage returns the current storage settings of the cluster
+	Storage func() rookalpha.StorageScopeSpec
+	// Provision is called to provision the osds on the new devices
+	Provision func()
+
+	// the names of the devices last published by each node
+	known       map[string]map[string]bool
+	initialized bool
+}
+
+// NewHotplugWatcher creates a watcher of the devices added to the nodes
+func NewHotplugWatcher(context *clusterd.Context, clusterName string) *HotplugWatcher {
+	return &HotplugWatcher{context: context, clusterName: clusterName, known: map[string]map[string]bool{}}
+}
+
+// Start watches the device configmaps of the nodes until the channel is closed
+func (h *HotplugWatcher) Start(stopCh chan struct{}) {
+	namespace := os.Getenv(k8sutil.PodNamespaceEnvVar)
+	opts := metav1.ListOptions{LabelSelector: fmt.Sprintf("%s=%s", k8sutil.AppAttr, discoverDaemon.AppName)}
+	for {
+		if err := h.watch(namespace, opts, stopCh); err != nil {
+			logger.Warningf("failed to watch the devices of the nodes for cluster %s, trying again. %+v", h.clusterName, err)
+		}
+		select {
+		case <-stopCh:
+			logger.Infof("stopping the watch of the devices of the nodes for cluster %s", h.clusterName)
+			return
+		case <-time.After(hotplugRetryInterval):
+		}
+	}
+}
+
+func (h *HotplugWatcher) watch(namespace string, opts metav1.ListOptions, stopCh chan struct{}) error {
+	// the devices published while the watch was restarted are found in the list
+	cms, err := h.context.Clientset.CoreV1().ConfigMaps(namespace).List(opts)
+	if err != nil {
+		return fmt.Errorf("failed to list the device configmaps. %+v", err)
+	}
+	added := false
+	for i := range cms.Items {
+		if len(h.addedDevices(&cms.Items[i])) > 0 {
+			added = true
+		}
+	}
+	h.initialized = true
+	if added {
+		h.Provision()
+	}
+
+	opts.ResourceVersion = cms.ResourceVersion
+	opts.Watch = true
+	w, err := h.context.Clientset.CoreV1().ConfigMaps(namespace).Watch(opts)
+	if err != nil {
+		return fmt.Errorf("failed to start the watch of the device configmaps. %+v", err)
+	}
+	defer w.Stop()
+
+	for {
+		select {
+		case <-stopCh:
+			return nil
+		case e, ok := <-w.ResultChan():
+			if !ok {
+				logger.Debugf("device configmap watch closed, restarting it")
+				return nil
+			}
+			if e.Type != watch.Added && e.Type != watch.Modified {
+				continue
+			}
+			cm, ok := e.Object.(*v1.ConfigMap)
+			if !ok {
+				continue
+			}
+			if devices := h.addedDevices(cm); len(devices) > 0 {
+				logger.Infof("devices %v were added to node %s, provisioning the osds of cluster %s", devices, cm.Labels[discoverDaemon.NodeAttr], h.clusterName)
+				h.Provision()
+			}
+		}
+	}
+}
+
+// addedDevices returns the devices of the configmap that were not published before by the node, and that are empty
+// and selected by the storage settings of the node. The devices of the first list are known but not returned since
+// they were already provisioned when the cluster was started.
+func (h *HotplugWatcher) addedDevices(cm *v1.ConfigMap) []string {
+	node := cm.Labels[discoverDaemon.NodeAttr]
+	if node == "" {
+		return nil
+	}
+	var devices []sys.LocalDisk
+	if err := json.Unmarshal([]byte(cm.Data[discoverDaemon.LocalDiskCMData]), &devices); err != nil {
+		logger.Warningf("failed to unmarshal the devices of node %s. %+v", node, err)
+		return nil
+	}
+
+	previous, seen := h.known[node]
+	current := map[string]bool{}
+	var added []sys.LocalDisk
+	for _, d := range devices {
+		current[d.Name] = true
+		if h.initialized && !previous[d.Name] {
+			added = append(added, d)
+		}
+	}
+	h.known[node] = current
+	// a node whose devices are published after the first list joined the cluster
+	joined := h.initialized && !seen
+	if len(added) == 0 && !joined {
+		return nil
+	}
+
+	n := h.resolveNode(node)
+	if n == nil {
+		return nil
+	}
+	if joined {
+		h.reportJoined(node, len(devices))
+	}
+	var selected []string
+	for _, d := range added {
+		if !d.Empty || isSpare(d, n.Spares) {
+			continue
+		}
+		if discover.DeviceMatches(d, n.Devices, n.Selection.DeviceFilter, n.Selection.DeviceAttributes, n.Selection.GetUseAllDevices()) {
+			selected = append(selected, d.Name)
+		}
+	}
+	return selected
+}
+
+// reportJoined records the event of a storage node of the cluster that joined with the devices
+func (h *HotplugWatcher) reportJoined(node string, devices int) {
+	object := v1.ObjectReference{Kind: "Node", Name: node}
+	message := fmt.Sprintf("node %s joined cluster %s with %d devices", node, h.clusterName, devices)
+	if err := notify.Record(h.context.Clientset, h.clusterName, object, v1.EventTypeNormal, notify.NodeJoined, message); err != nil {
+		logger.Warningf("%+v", err)
+	}
+}
+
+// resolveNode returns the storage settings of the node, or nil if the node is not a storage node of the cluster
+func (h *HotplugWatcher) resolveNode(node string) *rookalpha.Node {
+	storage := h.Storage()
+	nodes := []rookalpha.Node{}
+	for _, n := range storage.Nodes {
+		if n.Name == node {
+			// resolving the node updates its config in place
+			nodes = append(nodes, *n.DeepCopy())
+		}
+	}
+	if len(nodes) == 0 && storage.UseAllNodes {
+		nodes = append(nodes, rookalpha.Node{Name: node})
+	}
+	storage.Nodes = nodes
+	return storage.ResolveNode(node)
+}
+
+func isSpare(device sys.LocalDisk, spares []rookalpha.Device) bool {
+	for _, s := range spares {
+		if device.MatchesID(s.Name) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,83 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package osd
+
+import (
+	"encoding/json"
+	"testing"
+
+	rookalpha "github.com/rook/rook/pkg/apis/rook.io/v1alpha2"
+	"github.com/rook/rook/pkg/clusterd"
+	discoverDaemon "github.com/rook/rook/pkg/daemon/discover"
+	"github.com/rook/rook/pkg/operator/ceph/cluster/notify"
+	"github.com/rook/rook/pkg/util/sys"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func deviceConfigMap(t *testing.T, node string, devices []sys.LocalDisk) *v1.ConfigMap {
+	deviceJSON, err := json.Marshal(devices)
+	assert.Nil(t, err)
+	return &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: discoverDaemon.LocalDiskCMName + node, Labels: map[string]string{discoverDaemon.NodeAttr: node}},
+		Data:       map[string]string{discoverDaemon.LocalDiskCMData: string(deviceJSON)},
+	}
+}
+
+func TestHotplugAddedDevices(t *testing.T) {
+	storage := rookalpha.StorageScopeSpec{
+		Selection: rookalpha.Selection{DeviceFilter: "^sd", Spares: []rookalpha.Device{{Name: "sdz"}}},
+		Nodes:     []rookalpha.Node{{Name: "node1"}},
+	}
+	clientset := fake.NewSimpleClientset()
+	h := NewHotplugWatcher(&clusterd.Context{Clientset: clientset}, "rook-ceph")
+	h.Storage = func() rookalpha.StorageScopeSpec { return storage }
+
+	// the devices of the first list are already provisioned
+	devices := []sys.LocalDisk{{Name: "sda", Empty: true}}
+	assert.Equal(t, 0, len(h.addedDevices(deviceConfigMap(t, "node1", devices))))
+	h.initialized = true
+
+	// only the new empty devices that match the filter and are not spares are provisioned
+	devices = append(devices, sys.LocalDisk{Name: "sdb", Empty: true}, sys.LocalDisk{Name: "sdc"},
+		sys.LocalDisk{Name: "nvme0n1", Empty: true}, sys.LocalDisk{Name: "sdz", Empty: true})
+	assert.Equal(t, []string{"sdb"}, h.addedDevices(deviceConfigMap(t, "node1", devices)))
+
+	// the devices are only added once
+	assert.Equal(t, 0, len(h.addedDevices(deviceConfigMap(t, "node1", devices))))
+
+	// a removed device that is added again is provisioned
+	assert.Equal(t, 0, len(h.addedDevices(deviceConfigMap(t, "node1", devices[:1]))))
+	assert.Equal(t, []string{"sdb"}, h.addedDevices(deviceConfigMap(t, "node1", devices)))
+
+	// the nodes that are not storage nodes of the cluster are ignored
+	assert.Equal(t, 0, len(h.addedDevices(deviceConfigMap(t, "node2", devices))))
+	events, err := clientset.CoreV1().Events("rook-ceph").List(metav1.ListOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(events.Items))
+
+	// unless all the nodes are used, where the devices of a new node are all added and the node joined the cluster
+	storage.UseAllNodes = true
+	assert.Equal(t, []string{"sda", "sdb"}, h.addedDevices(deviceConfigMap(t, "node3", devices[:2])))
+	events, err = clientset.CoreV1().Events("rook-ceph").List(metav1.ListOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(events.Items))
+	assert.Equal(t, notify.NodeJoined, events.Items[0].Reason)
+	assert.Equal(t, "node3", events.Items[0].InvolvedObject.Name)
+}
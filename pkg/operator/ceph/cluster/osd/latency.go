@@ -0,0 +1,120 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package osd
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/rook/rook/pkg/clusterd"
+	"github.com/rook/rook/pkg/daemon/ceph/client"
+	"github.com/rook/rook/pkg/operator/ceph/settings"
+	"github.com/rook/rook/pkg/operator/k8sutil"
+	"k8s.io/api/core/v1"
+)
+
+// LatencyConfigMapName is the config map where the latency report of the osds is kept
+const LatencyConfigMapName = "rook-ceph-osd-latency"
+
+var (
+	// LatencyCheckInterval is the interval to sample the commit and apply latencies of the osds
+	LatencyCheckInterval = settings.NewDuration(time.Minute)
+	// LatencyWindow is the time in which the latency samples of the osds are compared
+	LatencyWindow = time.Hour
+)
+
+// LatencyAnalyzer periodically compares the latencies of each osd with the other osds of its device class to find the
+// slow osds
+type LatencyAnalyzer struct {
+	context   *clusterd.Context
+	namespace string
+	tracker   *client.LatencyTracker
+	outliers  map[int]bool
+}
+
+// NewLatencyAnalyzer creates a new latency analyzer for the osds of the cluster in the namespace
+func NewLatencyAnalyzer(context *clusterd.Context, namespace string) *LatencyAnalyzer {
+	return &LatencyAnalyzer{context: context, namespace: namespace, tracker: client.NewLatencyTracker(LatencyWindow), outliers: map[int]bool{}}
+}
+
+// Start periodically samples the latencies of the osds
+func (a *LatencyAnalyzer) Start(stopCh chan struct{}) {
+	for {
+		select {
+		case <-stopCh:
+			logger.Infof("stopping the latency analysis of the osds in namespace %s", a.namespace)
+			return
+
+		case <-time.After(LatencyCheckInterval.Get()):
+			if err := a.Analyze(time.Now()); err != nil {
+				logger.Warningf("failed to analyze the latency of the osds in namespace %s. %+v", a.namespace, err)
+			}
+		}
+	}
+}
+
+// Analyze adds a sample of the latencies of the osds and saves the ranked report in the latency config map
+func (a *LatencyAnalyzer) Analyze(now time.Time) error {
+	stats, err := client.GetOSDPerfStats(a.context, a.namespace)
+	if err != nil {
+		return err
+	}
+	crush, err := client.GetCrushMap(a.context, a.namespace)
+	if err != nil {
+		return err
+	}
+	classes := map[int]string{}
+	for _, d := range crush.Devices {
+		classes[d.ID] = d.Class
+	}
+
+	a.tracker.Add(now, stats)
+	report := a.tracker.Report(classes)
+
+	// only log the changes of the outliers since the report is refreshed at every sample
+	outliers := map[int]bool{}
+	for _, l := range report {
+		if !l.Outlier {
+			continue
+		}
+		outliers[l.ID] = true
+		if !a.outliers[l.ID] {
+			logger.Warningf("osd.%d is slow compared to the other %s osds. p95 commit latency %.0fms, apply latency %.0fms (%.1fx the median)",
+				l.ID, l.DeviceClass, l.CommitP95, l.ApplyP95, l.Ratio)
+		}
+	}
+	for id := range a.outliers {
+		if !outliers[id] {
+			logger.Infof("osd.%d is no longer slow compared to its peers", id)
+		}
+	}
+	a.outliers = outliers
+
+	return a.saveReport(report)
+}
+
+func (a *LatencyAnalyzer) saveReport(report []client.OSDLatency) error {
+	d, err := json.Marshal(report)
+	if err != nil {
+		return fmt.Errorf("failed to marshal the osd latency report. %+v", err)
+	}
+	data := map[string]string{"report": string(d)}
+
+	return k8sutil.ModifyConfigMap(a.context.Clientset, a.namespace, LatencyConfigMapName, nil, func(cm *v1.ConfigMap) {
+		cm.Data = data
+	})
+}
@@ -0,0 +1,67 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package osd
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/rook/rook/pkg/clusterd"
+	"github.com/rook/rook/pkg/daemon/ceph/client"
+	exectest "github.com/rook/rook/pkg/util/exec/test"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestLatencyAnalyzer(t *testing.T) {
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithOutputFile: func(debug bool, actionName string, command string, outFileArg string, args ...string) (string, error) {
+			switch {
+			case args[0] == "osd" && args[1] == "perf":
+				return `{"osd_perf_infos":[
+					{"id":0,"perf_stats":{"commit_latency_ms":5,"apply_latency_ms":5}},
+					{"id":1,"perf_stats":{"commit_latency_ms":4,"apply_latency_ms":4}},
+					{"id":2,"perf_stats":{"commit_latency_ms":60,"apply_latency_ms":60}}]}`, nil
+			case args[0] == "osd" && args[1] == "crush" && args[2] == "dump":
+				return `{"devices":[{"id":0,"name":"osd.0","class":"hdd"},{"id":1,"name":"osd.1","class":"hdd"},{"id":2,"name":"osd.2","class":"hdd"}]}`, nil
+			}
+			return "", fmt.Errorf("unexpected ceph command '%v'", args)
+		},
+	}
+	clientset := fake.NewSimpleClientset()
+	a := NewLatencyAnalyzer(&clusterd.Context{Executor: executor, Clientset: clientset}, "ns")
+
+	assert.Nil(t, a.Analyze(time.Now()))
+	assert.Equal(t, map[int]bool{2: true}, a.outliers)
+
+	cm, err := clientset.CoreV1().ConfigMaps("ns").Get(LatencyConfigMapName, metav1.GetOptions{})
+	assert.Nil(t, err)
+	var report []client.OSDLatency
+	assert.Nil(t, json.Unmarshal([]byte(cm.Data["report"]), &report))
+	assert.Equal(t, 3, len(report))
+	assert.Equal(t, 2, report[0].ID)
+	assert.True(t, report[0].Outlier)
+	assert.Equal(t, float64(12), report[0].Ratio)
+
+	// the report is updated at the next sample
+	assert.Nil(t, a.Analyze(time.Now()))
+	cm, err = clientset.CoreV1().ConfigMaps("ns").Get(LatencyConfigMapName, metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.Contains(t, cm.Data["report"], `"commitP95Ms":60`)
+}
@@ -25,6 +25,7 @@ import (
 	"time"
 
 	"github.com/coreos/pkg/capnslog"
+	cephv1beta1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1beta1"
 	rookalpha "github.com/rook/rook/pkg/apis/rook.io/v1alpha2"
 	"github.com/rook/rook/pkg/clusterd"
 	"github.com/rook/rook/pkg/daemon/ceph/client"
@@ -64,6 +65,9 @@ type Cluster struct {
 	Storage         rookalpha.StorageScopeSpec
 	dataDirHostPath string
 	HostNetwork     bool
+	Logs            cephv1beta1.LogSpec
+	NodeClasses     []cephv1beta1.NodeClassSpec
+	Stretch         cephv1beta1.StretchSpec
 	resources       v1.ResourceRequirements
 	ownerRef        metav1.OwnerReference
 	serviceAccount  string
@@ -116,12 +120,17 @@ type OSDInfo struct {
 	IsFileStore    bool   `json:"is-file-store"`
 	IsDirectory    bool   `json:"is-directory"`
 	DevicePartUUID string `json:"device-part-uuid"`
+	// The filesystem and mount options of a filestore osd on a device
+	Filesystem   string `json:"filesystem,omitempty"`
+	MountOptions string `json:"mount-options,omitempty"`
 }
 
 type OrchestrationStatus struct {
 	OSDs    []OSDInfo `json:"osds"`
 	Status  string    `json:"status"`
 	Message string    `json:"message"`
+	// The ids of the osds that were purged since their devices were swapped in place
+	Replaced []int `json:"replaced,omitempty"`
 }
 
 // Start the osd management
@@ -159,7 +168,16 @@ func (c *Cluster) Start() error {
 		}
 		logger.Debugf("storage nodes: %+v", c.Storage.Nodes)
 	}
-	validNodes := k8sutil.GetValidNodes(c.Storage.Nodes, c.context.Clientset, c.placement)
+	// the nodes that already run osds are kept even if their architecture is not supported for new osds
+	osdNodes, err := c.discoverStorageNodes()
+	if err != nil {
+		logger.Warningf("failed to discover the nodes with osds. %+v", err)
+	}
+	inUse := map[string]bool{}
+	for name := range osdNodes {
+		inUse[name] = true
+	}
+	validNodes := k8sutil.GetValidNewNodes(c.Storage.Nodes, c.context.Clientset, c.placement, inUse)
 	// no valid node is ready to run an osd
 	if len(validNodes) == 0 {
 		logger.Warningf("no valid node available to run an osd in namespace %s", c.Namespace)
@@ -196,6 +214,10 @@ func (c *Cluster) Start() error {
 
 func (c *Cluster) startProvisioning(config *provisionConfig) {
 	config.devicesToUse = make(map[string][]rookalpha.Device, len(c.Storage.Nodes))
+	spareSubs, err := loadSpareSubstitutions(c.context, c.Namespace)
+	if err != nil {
+		logger.Warningf("failed to load the spare substitutions. %+v", err)
+	}
 
 	// start with nodes currently in the storage spec
 	for _, node := range c.Storage.Nodes {
@@ -211,20 +233,35 @@ func (c *Cluster) startProvisioning(config *provisionConfig) {
 			continue
 		}
 
-		// update the orchestration status of this node to the starting state
-		status := OrchestrationStatus{Status: OrchestrationStatusStarting}
-		if err := c.updateNodeStatus(n.Name, status); err != nil {
-			config.addError("failed to set orchestration starting status for node %s: %+v", n.Name, err)
-			continue
-		}
 		config.devicesToUse[n.Name] = n.Devices
-		availDev, deviceErr := discover.GetAvailableDevices(c.context, n.Name, c.Namespace, n.Devices, n.Selection.DeviceFilter, n.Selection.GetUseAllDevices())
+		availDev, deviceErr := discover.GetAvailableDevices(c.context, n.Name, c.Namespace, n.Devices, n.Selection.DeviceFilter, n.Selection.DeviceAttributes, n.Selection.GetUseAllDevices())
 		if deviceErr != nil {
 			logger.Warningf("failed to get devices for node %s cluster %s: %v", n.Name, c.Namespace, deviceErr)
 		} else {
+			availDev = c.spareDevicesToUse(n, availDev, spareSubs[n.Name])
 			config.devicesToUse[n.Name] = availDev
 			logger.Infof("avail devices for node %s: %+v", n.Name, availDev)
 		}
+		selection := n.Selection
+		if len(config.devicesToUse[n.Name]) == 0 && !deviceFallbackAllowed(n) {
+			// the prepare job would select the devices again by the filter or as all the devices, which would format the
+			// devices that the operator excluded
+			if len(selection.Directories) == 0 {
+				logger.Warningf("skipping node %s since none of its devices were selected", n.Name)
+				continue
+			}
+			logger.Infof("provisioning only the directories of node %s since none of its devices were selected", n.Name)
+			noDevices := false
+			selection.DeviceFilter = ""
+			selection.UseAllDevices = &noDevices
+		}
+
+		// update the orchestration status of this node to the starting state
+		status := OrchestrationStatus{Status: OrchestrationStatusStarting}
+		if err := c.updateNodeStatus(n.Name, status); err != nil {
+			config.addError("failed to set orchestration starting status for node %s: %+v", n.Name, err)
+			continue
+		}
 		if len(availDev) == 0 && len(c.dataDirHostPath) == 0 {
 			config.addError("empty volumes for node %s", n.Name)
 			continue
@@ -233,7 +270,7 @@ func (c *Cluster) startProvisioning(config *provisionConfig) {
 		// create the job that prepares osds on the node
 		storeConfig := osdconfig.ToStoreConfig(n.Config)
 		metadataDevice := osdconfig.MetadataDevice(n.Config)
-		job, err := c.makeJob(n.Name, config.devicesToUse[n.Name], n.Selection, n.Resources, storeConfig, metadataDevice, n.Location)
+		job, err := c.makeJob(n.Name, config.devicesToUse[n.Name], selection, n.Resources, storeConfig, metadataDevice, n.Location)
 		if err != nil {
 			message := fmt.Sprintf("failed to create prepare job node %s: %v", n.Name, err)
 			config.addError(message)
@@ -252,6 +289,13 @@ func (c *Cluster) startProvisioning(config *provisionConfig) {
 	}
 }
 
+// deviceFallbackAllowed returns whether the prepare job of the node may select the devices by the device filter or as
+// all the devices when the operator did not resolve any device, which is only safe if the operator did not narrow down
+// the devices further than the job would. The job does not know the spares either, so it would format the idle spares.
+func deviceFallbackAllowed(n *rookalpha.Node) bool {
+	return n.Selection.DeviceAttributes == nil && len(n.Spares) == 0
+}
+
 func (c *Cluster) updateJob(job *batch.Job, nodeName string, config *provisionConfig, action string) bool {
 	// check if the job was already created and what its status is
 	existingJob, err := c.context.Clientset.Batch().Jobs(c.Namespace).Get(job.Name, metav1.GetOptions{})
@@ -328,6 +372,9 @@ func (c *Cluster) startOSDDaemonsOnNode(nodeName string, config *provisionConfig
 	storeConfig := osdconfig.ToStoreConfig(n.Config)
 	metadataDevice := osdconfig.MetadataDevice(n.Config)
 
+	// delete the deployments of the osds that were purged, unless the new osds were given the same ids
+	c.deleteReplacedDeployments(osds, status.Replaced)
+
 	// start osds
 	for _, osd := range osds {
 		logger.Debugf("start osd %v", osd)
@@ -357,6 +404,10 @@ func (c *Cluster) startOSDDaemonsOnNode(nodeName string, config *provisionConfig
 				}
 				continue
 			}
+			if c.isQuarantined(osd.ID) {
+				logger.Warningf("not updating the deployment of osd %d that is quarantined", osd.ID)
+				continue
+			}
 			logger.Infof("deployment for osd %d already exists. updating if needed", osd.ID)
 			if err = k8sutil.UpdateDeploymentAndWait(c.context, dp, c.Namespace); err != nil {
 				config.addError(fmt.Sprintf("failed to update osd deployment %d. %+v", osd.ID, err))
@@ -367,6 +418,25 @@ func (c *Cluster) startOSDDaemonsOnNode(nodeName string, config *provisionConfig
 	}
 }
 
+func (c *Cluster) deleteReplacedDeployments(osds []OSDInfo, replaced []int) {
+	for _, id := range replaced {
+		reused := false
+		for _, osd := range osds {
+			if osd.ID == id {
+				reused = true
+				break
+			}
+		}
+		if reused {
+			continue
+		}
+		logger.Infof("deleting the deployment of replaced osd %d", id)
+		if err := k8sutil.DeleteDeployment(c.context.Clientset, c.Namespace, fmt.Sprintf(osdAppNameFmt, id)); err != nil {
+			logger.Warningf("failed to delete the deployment of replaced osd %d. %+v", id, err)
+		}
+	}
+}
+
 func (c *Cluster) deleteDeploymentWithLegacyName(osdID int) error {
 	legacyName := fmt.Sprintf(legacyAppNameFmt, osdID)
 	return k8sutil.DeleteDeployment(c.context.Clientset, c.Namespace, legacyName)
@@ -569,13 +639,78 @@ func getIDFromDeployment(deployment *extensions.Deployment) int {
 	return unknownID
 }
 
+// nodeClass returns the class of the node, or nil if the node is not in a class
+func (c *Cluster) nodeClass(nodeName string) *cephv1beta1.NodeClassSpec {
+	if len(c.NodeClasses) == 0 {
+		return nil
+	}
+	node, err := c.context.Clientset.CoreV1().Nodes().Get(nodeName, metav1.GetOptions{})
+	if err != nil {
+		logger.Warningf("failed to get node %s to find its class. %+v", nodeName, err)
+		return nil
+	}
+	return cephv1beta1.GetNodeClass(c.NodeClasses, node.Labels)
+}
+
+// nodeClassResources returns the osd resources of the cluster, overridden by the resources of the class of the node
+func (c *Cluster) nodeClassResources(class *cephv1beta1.NodeClassSpec) v1.ResourceRequirements {
+	if class == nil {
+		return c.resources
+	}
+	return k8sutil.MergeResourceRequirements(*class.Resources.DeepCopy(), c.resources)
+}
+
+// nodeClassStorage returns the storage settings of the cluster with the config of the class of the node, which
+// overrides the config of the cluster but not the config of the node. The settings are copied since resolving a node
+// adds the config of the cluster to the config of the node, which would then hide the config of the class.
+func (c *Cluster) nodeClassStorage(class *cephv1beta1.NodeClassSpec) *rookalpha.StorageScopeSpec {
+	storage := c.Storage.DeepCopy()
+	if class == nil || len(class.Config) == 0 {
+		return storage
+	}
+	if storage.Config == nil {
+		storage.Config = map[string]string{}
+	}
+	for k, v := range class.Config {
+		storage.Config[k] = v
+	}
+	return storage
+}
+
+// siteLocation adds the datacenter of the site of the node to the crush location of its osds in a stretched cluster,
+// unless the location already has a datacenter
+func (c *Cluster) siteLocation(nodeName, location string) string {
+	if !c.Stretch.Enabled() || strings.Contains(location, cephv1beta1.SiteCrushType+"=") {
+		return location
+	}
+	node, err := c.context.Clientset.CoreV1().Nodes().Get(nodeName, metav1.GetOptions{})
+	if err != nil {
+		logger.Warningf("failed to get node %s to find its site. %+v", nodeName, err)
+		return location
+	}
+	site := node.Labels[c.Stretch.GetSiteLabel()]
+	if site == "" {
+		logger.Warningf("node %s of a stretched cluster has no label %s", nodeName, c.Stretch.GetSiteLabel())
+		return location
+	}
+	if site == c.Stretch.Tiebreaker {
+		logger.Warningf("node %s is in the tiebreaker site %s, where its osds would store data", nodeName, site)
+	}
+	if location == "" {
+		return fmt.Sprintf("%s=%s", cephv1beta1.SiteCrushType, site)
+	}
+	return fmt.Sprintf("%s,%s=%s", location, cephv1beta1.SiteCrushType, site)
+}
+
 func (c *Cluster) resolveNode(nodeName string) *rookalpha.Node {
 	// fully resolve the storage config and resources for this node
-	rookNode := c.Storage.ResolveNode(nodeName)
+	class := c.nodeClass(nodeName)
+	rookNode := c.nodeClassStorage(class).ResolveNode(nodeName)
 	if rookNode == nil {
 		return nil
 	}
-	rookNode.Resources = k8sutil.MergeResourceRequirements(rookNode.Resources, c.resources)
+	rookNode.Resources = k8sutil.MergeResourceRequirements(rookNode.Resources, c.nodeClassResources(class))
+	rookNode.Location = c.siteLocation(nodeName, rookNode.Location)
 
 	// ensure no invalid dirs are specified
 	var validDirs []rookalpha.Directory
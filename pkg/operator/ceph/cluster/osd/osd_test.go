@@ -20,6 +20,7 @@ import (
 	"os"
 	"testing"
 
+	cephv1beta1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1beta1"
 	rookalpha "github.com/rook/rook/pkg/apis/rook.io/v1alpha2"
 	"github.com/rook/rook/pkg/clusterd"
 	discoverDaemon "github.com/rook/rook/pkg/daemon/discover"
@@ -31,6 +32,7 @@ import (
 	"k8s.io/api/core/v1"
 	corev1 "k8s.io/api/core/v1"
 	extensions "k8s.io/api/extensions/v1beta1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/watch"
@@ -354,3 +356,71 @@ func TestAddNodeFailure(t *testing.T) {
 	assert.True(t, startCompleted)
 	assert.NotNil(t, startErr)
 }
+
+func TestNodeClassResources(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	node := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1", Labels: map[string]string{cephv1beta1.NodeClassLabel: "storage"}}}
+	_, err := clientset.CoreV1().Nodes().Create(node)
+	assert.Nil(t, err)
+	assert.Nil(t, createNode("node2", v1.NodeReady, clientset))
+
+	resources := v1.ResourceRequirements{Limits: v1.ResourceList{v1.ResourceCPU: resource.MustParse("1"), v1.ResourceMemory: resource.MustParse("1Gi")}}
+	c := New(&clusterd.Context{Clientset: clientset}, "ns", "myversion", "", rookalpha.StorageScopeSpec{}, "", rookalpha.Placement{},
+		false, resources, metav1.OwnerReference{})
+	c.NodeClasses = []cephv1beta1.NodeClassSpec{{Name: "storage", Roles: []string{"osd"},
+		Resources: v1.ResourceRequirements{Limits: v1.ResourceList{v1.ResourceMemory: resource.MustParse("4Gi")}}}}
+
+	// the class overrides the resources of the cluster
+	r := c.nodeClassResources(c.nodeClass("node1"))
+	assert.Equal(t, "1", r.Limits.Cpu().String())
+	assert.Equal(t, "4Gi", r.Limits.Memory().String())
+
+	// the nodes without a class have the resources of the cluster
+	assert.Nil(t, c.nodeClass("node2"))
+	r = c.nodeClassResources(c.nodeClass("node2"))
+	assert.Equal(t, "1Gi", r.Limits.Memory().String())
+	assert.Equal(t, 1, len(c.NodeClasses[0].Resources.Limits))
+}
+
+func TestNodeClassConfig(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	for _, name := range []string{"node1", "node2"} {
+		node := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{cephv1beta1.NodeClassLabel: "storage"}}}
+		_, err := clientset.CoreV1().Nodes().Create(node)
+		assert.Nil(t, err)
+	}
+	assert.Nil(t, createNode("node3", v1.NodeReady, clientset))
+
+	storage := rookalpha.StorageScopeSpec{
+		Config: map[string]string{"storeType": "filestore", "filestoreFilesystem": "ext4"},
+		Nodes: []rookalpha.Node{
+			{Name: "node1"},
+			{Name: "node2", Config: map[string]string{"filestoreFilesystem": "btrfs"}},
+			{Name: "node3"},
+		},
+	}
+	c := New(&clusterd.Context{Clientset: clientset}, "ns", "myversion", "", storage, "", rookalpha.Placement{},
+		false, v1.ResourceRequirements{}, metav1.OwnerReference{})
+	c.NodeClasses = []cephv1beta1.NodeClassSpec{{Name: "storage", Roles: []string{"osd"},
+		Config: map[string]string{"filestoreFilesystem": "xfs", "filestoreMountOptions": "noatime"}}}
+
+	// the class overrides the config of the cluster, even after the node was resolved before
+	for i := 0; i < 2; i++ {
+		n := c.resolveNode("node1")
+		assert.Equal(t, "filestore", n.Config["storeType"])
+		assert.Equal(t, "xfs", n.Config["filestoreFilesystem"])
+		assert.Equal(t, "noatime", n.Config["filestoreMountOptions"])
+	}
+
+	// the config of the node overrides the config of its class
+	n := c.resolveNode("node2")
+	assert.Equal(t, "btrfs", n.Config["filestoreFilesystem"])
+	assert.Equal(t, "noatime", n.Config["filestoreMountOptions"])
+
+	// the nodes without a class have the config of the cluster
+	n = c.resolveNode("node3")
+	assert.Equal(t, "ext4", n.Config["filestoreFilesystem"])
+	assert.Equal(t, "", n.Config["filestoreMountOptions"])
+	assert.Equal(t, 2, len(c.Storage.Config))
+	assert.Equal(t, 0, len(c.Storage.Nodes[0].Config))
+}
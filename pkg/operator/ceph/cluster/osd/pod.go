@@ -18,6 +18,7 @@ limitations under the License.
 package osd
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
 	"path"
@@ -28,6 +29,7 @@ import (
 	rookalpha "github.com/rook/rook/pkg/apis/rook.io/v1alpha2"
 	opmon "github.com/rook/rook/pkg/operator/ceph/cluster/mon"
 	"github.com/rook/rook/pkg/operator/ceph/cluster/osd/config"
+	"github.com/rook/rook/pkg/operator/discover"
 	"github.com/rook/rook/pkg/operator/k8sutil"
 
 	batch "k8s.io/api/batch/v1"
@@ -45,6 +47,13 @@ const (
 	osdWalSizeEnvVarName        = "ROOK_OSD_WAL_SIZE"
 	osdJournalSizeEnvVarName    = "ROOK_OSD_JOURNAL_SIZE"
 	osdMetadataDeviceEnvVarName = "ROOK_METADATA_DEVICE"
+	osdAdoptEnvVarName          = "ROOK_OSD_ADOPT"
+	osdReplaceSwappedEnvVarName = "ROOK_OSD_REPLACE_SWAPPED"
+	osdCrushWeightEnvVarName    = "ROOK_OSD_CRUSH_WEIGHT"
+	osdGradualWeightEnvVarName  = "ROOK_OSD_GRADUAL_WEIGHT_IN"
+	osdFilestoreFSEnvVarName    = "ROOK_OSD_FILESTORE_FS"
+	osdMkfsOptionsEnvVarName    = "ROOK_OSD_FILESTORE_MKFS_OPTIONS"
+	osdMountOptionsEnvVarName   = "ROOK_OSD_FILESTORE_MOUNT_OPTIONS"
 )
 
 func (c *Cluster) makeJob(nodeName string, devices []rookalpha.Device,
@@ -56,6 +65,8 @@ func (c *Cluster) makeJob(nodeName string, devices []rookalpha.Device,
 	}
 	podSpec.Spec.NodeSelector = map[string]string{apis.LabelHostname: nodeName}
 
+	// stop the job if the osds take too long to be provisioned, such as when the format of a dying device is stuck
+	deadline := int64(ProvisionTimeout.Get().Seconds())
 	job := &batch.Job{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      k8sutil.TruncateNodeName(prepareAppNameFmt, nodeName),
@@ -66,7 +77,8 @@ func (c *Cluster) makeJob(nodeName string, devices []rookalpha.Device,
 			},
 		},
 		Spec: batch.JobSpec{
-			Template: *podSpec,
+			Template:              *podSpec,
+			ActiveDeadlineSeconds: &deadline,
 		},
 	}
 	k8sutil.SetOwnerRef(c.context.Clientset, c.Namespace, &job.ObjectMeta, &c.ownerRef)
@@ -146,18 +158,43 @@ func (c *Cluster) makeDeployment(nodeName string, devices []rookalpha.Device, se
 	if osd.IsFileStore {
 		commonArgs = append(commonArgs, fmt.Sprintf("--osd-journal=%s", osd.Journal))
 	}
+	logToFile := c.Logs.ToFile && c.dataDirHostPath != ""
+	daemon := fmt.Sprintf("osd.%d", osd.ID)
+	if logToFile {
+		// the init container creates the directory of the log file before the osd starts
+		commonArgs = append(commonArgs, fmt.Sprintf("--log-file=%s", opmon.DaemonLogPath(c.Namespace, daemon)))
+		configEnvVars = append(configEnvVars, v1.EnvVar{Name: "ROOK_LOG_DIR", Value: path.Dir(opmon.DaemonLogPath(c.Namespace, daemon))})
+	}
+	logForwardEnvVars := opmon.LogForwardEnvVars(c.Logs, c.Namespace, daemon)
+	envVars = append(envVars, logForwardEnvVars...)
+	configEnvVars = append(configEnvVars, logForwardEnvVars...)
+	if volume, mount := opmon.LogForwardVolume(c.Logs); volume != nil {
+		volumes = append(volumes, *volume)
+		volumeMounts = append(volumeMounts, *mount)
+		// the mounts of the init container are copied since the mounts of the osd may share their array
+		configVolumeMounts = append(append([]v1.VolumeMount{}, configVolumeMounts...), *mount)
+	}
 
 	var command []string
 	var args []string
 	if !osd.IsDirectory && osd.IsFileStore {
 		// filestore on a device requires indirection through the rook entrypoint so we can mount the image
 		sourcePath := path.Join("/dev/disk/by-partuuid", osd.DevicePartUUID)
-		args = append([]string{
+		args = []string{
 			"ceph", "osd", "filestore-device",
 			"--source-path", sourcePath,
 			"--mount-path", osd.DataPath,
-			"--",
-		}, commonArgs...)
+		}
+		if osd.Filesystem != "" {
+			args = append(args, "--fs-type", osd.Filesystem)
+		}
+		if osd.MountOptions != "" {
+			args = append(args, "--mount-options", osd.MountOptions)
+		}
+		args = append(append(args, "--"), commonArgs...)
+	} else if c.Logs.Forward.Target != "" {
+		// the rook entrypoint runs the osd daemon to forward its output with the logs
+		args = append([]string{"ceph", "osd", "run", "--"}, commonArgs...)
 	} else {
 		// other osds can launch the osd daemon directly
 		command = append([]string{"/tini", "--", "ceph-osd",
@@ -238,6 +275,10 @@ func (c *Cluster) makeDeployment(nodeName string, devices []rookalpha.Device, se
 			Replicas: &replicaCount,
 		},
 	}
+	if logToFile {
+		podSpec := &deployment.Spec.Template.Spec
+		podSpec.Containers = append(podSpec.Containers, opmon.LogRotateContainer(c.Logs, c.Namespace, daemon, c.Version))
+	}
 	k8sutil.SetOwnerRef(c.context.Clientset, c.Namespace, &deployment.ObjectMeta, &c.ownerRef)
 	c.placement.ApplyToPodSpec(&deployment.Spec.Template.Spec)
 	return deployment, nil
@@ -254,7 +295,8 @@ func (c *Cluster) provisionPodTemplateSpec(devices []rookalpha.Device, selection
 	}
 
 	// by default, don't define any volume config unless it is required
-	if len(devices) > 0 || selection.DeviceFilter != "" || selection.GetUseAllDevices() || metadataDevice != "" {
+	devicesNeeded := len(devices) > 0 || selection.DeviceFilter != "" || selection.GetUseAllDevices() || metadataDevice != ""
+	if devicesNeeded {
 		// create volume config for the data dir and /dev so the pod can access devices on the host
 		devVolume := v1.Volume{Name: "devices", VolumeSource: v1.VolumeSource{HostPath: &v1.HostPathVolumeSource{Path: "/dev"}}}
 		volumes = append(volumes, devVolume)
@@ -281,6 +323,8 @@ func (c *Cluster) provisionPodTemplateSpec(devices []rookalpha.Device, selection
 		RestartPolicy:      restart,
 		Volumes:            volumes,
 		HostNetwork:        c.HostNetwork,
+		// the mounts of the host are read from its init process so the mounted devices are never formatted
+		HostPID: devicesNeeded,
 	}
 	if c.HostNetwork {
 		podSpec.DNSPolicy = v1.DNSClusterFirstWithHostNet
@@ -330,6 +374,34 @@ func (c *Cluster) getConfigEnvVars(storeConfig config.StoreConfig, dataDir, loca
 		envVars = append(envVars, osdJournalSizeEnvVar(storeConfig.JournalSizeMB))
 	}
 
+	if storeConfig.AdoptExisting {
+		envVars = append(envVars, osdAdoptEnvVar())
+	}
+
+	if storeConfig.ReplaceSwapped {
+		envVars = append(envVars, osdReplaceSwappedEnvVar())
+	}
+
+	if storeConfig.CrushWeight != 0 {
+		envVars = append(envVars, osdCrushWeightEnvVar(storeConfig.CrushWeight))
+	}
+
+	if storeConfig.GradualWeightIn {
+		envVars = append(envVars, osdGradualWeightEnvVar())
+	}
+
+	if storeConfig.FilestoreFilesystem != "" {
+		envVars = append(envVars, osdFilestoreFSEnvVar(storeConfig.FilestoreFilesystem))
+	}
+
+	if storeConfig.FilestoreMkfsOptions != "" {
+		envVars = append(envVars, osdMkfsOptionsEnvVar(storeConfig.FilestoreMkfsOptions))
+	}
+
+	if storeConfig.FilestoreMountOptions != "" {
+		envVars = append(envVars, osdMountOptionsEnvVar(storeConfig.FilestoreMountOptions))
+	}
+
 	if location != "" {
 		envVars = append(envVars, rookalpha.LocationEnvVar(location))
 	}
@@ -347,10 +419,17 @@ func (c *Cluster) provisionOSDContainer(devices []rookalpha.Device, selection ro
 	// only 1 of device list, device filter and use all devices can be specified.  We prioritize in that order.
 	if len(devices) > 0 {
 		deviceNames := make([]string, len(devices))
+		overrides := []string{}
 		for i := range devices {
 			deviceNames[i] = devices[i].Name
+			if discover.ProtectedDeviceOverride(devices[i]) {
+				overrides = append(overrides, devices[i].Name)
+			}
 		}
 		envVars = append(envVars, dataDevicesEnvVar(strings.Join(deviceNames, ",")))
+		if len(overrides) > 0 {
+			envVars = append(envVars, protectedDevicesOverrideEnvVar(strings.Join(overrides, ",")))
+		}
 		devMountNeeded = true
 	} else if selection.DeviceFilter != "" {
 		envVars = append(envVars, deviceFilterEnvVar(selection.DeviceFilter))
@@ -359,6 +438,10 @@ func (c *Cluster) provisionOSDContainer(devices []rookalpha.Device, selection ro
 		envVars = append(envVars, deviceFilterEnvVar("all"))
 		devMountNeeded = true
 	}
+	if len(devices) == 0 && devMountNeeded && selection.DeviceAttributes != nil {
+		// the job must not select more devices than the operator would
+		envVars = append(envVars, deviceAttributesEnvVar(selection.DeviceAttributes))
+	}
 
 	if metadataDevice != "" {
 		envVars = append(envVars, metadataDeviceEnvVar(metadataDevice))
@@ -422,10 +505,19 @@ func dataDevicesEnvVar(dataDevices string) v1.EnvVar {
 	return v1.EnvVar{Name: "ROOK_DATA_DEVICES", Value: dataDevices}
 }
 
+func protectedDevicesOverrideEnvVar(devices string) v1.EnvVar {
+	return v1.EnvVar{Name: "ROOK_PROTECTED_DEVICES_OVERRIDE", Value: devices}
+}
+
 func deviceFilterEnvVar(filter string) v1.EnvVar {
 	return v1.EnvVar{Name: "ROOK_DATA_DEVICE_FILTER", Value: filter}
 }
 
+func deviceAttributesEnvVar(attributes *rookalpha.DeviceAttributes) v1.EnvVar {
+	value, _ := json.Marshal(attributes)
+	return v1.EnvVar{Name: "ROOK_DATA_DEVICE_ATTRIBUTES", Value: string(value)}
+}
+
 func metadataDeviceEnvVar(metadataDevice string) v1.EnvVar {
 	return v1.EnvVar{Name: osdMetadataDeviceEnvVarName, Value: metadataDevice}
 }
@@ -450,6 +542,34 @@ func osdJournalSizeEnvVar(journalSize int) v1.EnvVar {
 	return v1.EnvVar{Name: osdJournalSizeEnvVarName, Value: strconv.Itoa(journalSize)}
 }
 
+func osdAdoptEnvVar() v1.EnvVar {
+	return v1.EnvVar{Name: osdAdoptEnvVarName, Value: "true"}
+}
+
+func osdReplaceSwappedEnvVar() v1.EnvVar {
+	return v1.EnvVar{Name: osdReplaceSwappedEnvVarName, Value: "true"}
+}
+
+func osdCrushWeightEnvVar(weight float64) v1.EnvVar {
+	return v1.EnvVar{Name: osdCrushWeightEnvVarName, Value: strconv.FormatFloat(weight, 'f', -1, 64)}
+}
+
+func osdGradualWeightEnvVar() v1.EnvVar {
+	return v1.EnvVar{Name: osdGradualWeightEnvVarName, Value: "true"}
+}
+
+func osdFilestoreFSEnvVar(fstype string) v1.EnvVar {
+	return v1.EnvVar{Name: osdFilestoreFSEnvVarName, Value: fstype}
+}
+
+func osdMkfsOptionsEnvVar(options string) v1.EnvVar {
+	return v1.EnvVar{Name: osdMkfsOptionsEnvVarName, Value: options}
+}
+
+func osdMountOptionsEnvVar(options string) v1.EnvVar {
+	return v1.EnvVar{Name: osdMountOptionsEnvVarName, Value: options}
+}
+
 func getDirectoriesFromContainer(osdContainer v1.Container) []rookalpha.Directory {
 	var dirsArg string
 	for _, envVar := range osdContainer.Env {
@@ -486,6 +606,20 @@ func getConfigFromContainer(osdContainer v1.Container) map[string]string {
 			cfg[config.JournalSizeMBKey] = envVar.Value
 		case osdMetadataDeviceEnvVarName:
 			cfg[config.MetadataDeviceKey] = envVar.Value
+		case osdAdoptEnvVarName:
+			cfg[config.AdoptExistingKey] = envVar.Value
+		case osdReplaceSwappedEnvVarName:
+			cfg[config.ReplaceSwappedKey] = envVar.Value
+		case osdCrushWeightEnvVarName:
+			cfg[config.CrushWeightKey] = envVar.Value
+		case osdGradualWeightEnvVarName:
+			cfg[config.GradualWeightKey] = envVar.Value
+		case osdFilestoreFSEnvVarName:
+			cfg[config.FilestoreFilesystemKey] = envVar.Value
+		case osdMkfsOptionsEnvVarName:
+			cfg[config.FilestoreMkfsOptionsKey] = envVar.Value
+		case osdMountOptionsEnvVarName:
+			cfg[config.FilestoreMountOptionsKey] = envVar.Value
 		}
 	}
 
@@ -20,6 +20,7 @@ package osd
 import (
 	"testing"
 
+	cephv1beta1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1beta1"
 	rookalpha "github.com/rook/rook/pkg/apis/rook.io/v1alpha2"
 	"github.com/rook/rook/pkg/clusterd"
 	"github.com/rook/rook/pkg/operator/ceph/cluster/osd/config"
@@ -202,6 +203,29 @@ func TestStorageSpecDevicesAndDirectories(t *testing.T) {
 	assert.Equal(t, "/etc/rook/config", initCont.VolumeMounts[1].MountPath)
 }
 
+func TestFilestoreDeviceArgs(t *testing.T) {
+	storageSpec := rookalpha.StorageScopeSpec{Nodes: []rookalpha.Node{{Name: "node1"}}}
+	c := New(&clusterd.Context{Clientset: fake.NewSimpleClientset(), ConfigDir: "/var/lib/rook", Executor: &exectest.MockExecutor{}}, "ns", "rook/rook:myversion", "",
+		storageSpec, "/var/lib/rook", rookalpha.Placement{}, false, v1.ResourceRequirements{}, metav1.OwnerReference{})
+	n := c.Storage.ResolveNode("node1")
+
+	// the filesystem and the mount options recorded for the osd are passed to the mount
+	osd := OSDInfo{ID: 0, IsFileStore: true, DataPath: "/var/lib/rook/osd0", DevicePartUUID: "part-uuid", Filesystem: "xfs", MountOptions: "noatime,largeio"}
+	deployment, err := c.makeDeployment(n.Name, n.Devices, n.Selection, v1.ResourceRequirements{}, config.StoreConfig{}, "", n.Location, osd)
+	require.Nil(t, err)
+	args := deployment.Spec.Template.Spec.Containers[0].Args
+	assert.Equal(t, []string{"ceph", "osd", "filestore-device", "--source-path", "/dev/disk/by-partuuid/part-uuid",
+		"--mount-path", "/var/lib/rook/osd0", "--fs-type", "xfs", "--mount-options", "noatime,largeio", "--"}, args[:12])
+
+	// the osds created before the filesystem was recorded are mounted with the detected filesystem
+	osd.Filesystem = ""
+	osd.MountOptions = ""
+	deployment, err = c.makeDeployment(n.Name, n.Devices, n.Selection, v1.ResourceRequirements{}, config.StoreConfig{}, "", n.Location, osd)
+	require.Nil(t, err)
+	args = deployment.Spec.Template.Spec.Containers[0].Args
+	assert.Equal(t, "--", args[7])
+}
+
 func TestStorageSpecConfig(t *testing.T) {
 	storageSpec := rookalpha.StorageScopeSpec{
 		Nodes: []rookalpha.Node{
@@ -209,11 +233,16 @@ func TestStorageSpecConfig(t *testing.T) {
 				Name:     "node1",
 				Location: "rack=foo",
 				Config: map[string]string{
-					"storeType":      "bluestore",
-					"databaseSizeMB": "10",
-					"walSizeMB":      "20",
-					"journalSizeMB":  "30",
-					"metadataDevice": "nvme093",
+					"storeType":             "bluestore",
+					"databaseSizeMB":        "10",
+					"walSizeMB":             "20",
+					"journalSizeMB":         "30",
+					"metadataDevice":        "nvme093",
+					"adoptExisting":         "true",
+					"replaceSwappedDevices": "true",
+					"filestoreFilesystem":   "xfs",
+					"filestoreMkfsOptions":  "-i size=2048",
+					"filestoreMountOptions": "noatime",
 				},
 				Selection: rookalpha.Selection{
 					Directories: []rookalpha.Directory{{Path: "/rook/storageDir472"}},
@@ -242,6 +271,7 @@ func TestStorageSpecConfig(t *testing.T) {
 	assert.NotNil(t, job)
 	assert.Nil(t, err)
 	assert.Equal(t, "rook-ceph-osd-prepare-node1", job.ObjectMeta.Name)
+	assert.Equal(t, int64(600), *job.Spec.ActiveDeadlineSeconds)
 	container := job.Spec.Template.Spec.Containers[0]
 	assert.NotNil(t, container)
 	verifyEnvVar(t, container.Env, "ROOK_OSD_STORE", "bluestore", true)
@@ -250,6 +280,11 @@ func TestStorageSpecConfig(t *testing.T) {
 	verifyEnvVar(t, container.Env, "ROOK_OSD_JOURNAL_SIZE", "30", true)
 	verifyEnvVar(t, container.Env, "ROOK_LOCATION", "rack=foo", true)
 	verifyEnvVar(t, container.Env, "ROOK_METADATA_DEVICE", "nvme093", true)
+	verifyEnvVar(t, container.Env, "ROOK_OSD_ADOPT", "true", true)
+	verifyEnvVar(t, container.Env, "ROOK_OSD_REPLACE_SWAPPED", "true", true)
+	verifyEnvVar(t, container.Env, "ROOK_OSD_FILESTORE_FS", "xfs", true)
+	verifyEnvVar(t, container.Env, "ROOK_OSD_FILESTORE_MKFS_OPTIONS", "-i size=2048", true)
+	verifyEnvVar(t, container.Env, "ROOK_OSD_FILESTORE_MOUNT_OPTIONS", "noatime", true)
 
 	assert.Equal(t, "100", container.Resources.Limits.Cpu().String())
 	assert.Equal(t, "1337", container.Resources.Requests.Memory().String())
@@ -293,3 +328,132 @@ func TestHostNetwork(t *testing.T) {
 	assert.Equal(t, true, r.Spec.Template.Spec.HostNetwork)
 	assert.Equal(t, v1.DNSClusterFirstWithHostNet, r.Spec.Template.Spec.DNSPolicy)
 }
+
+func TestProtectedDevicesOverride(t *testing.T) {
+	cluster := &Cluster{Namespace: "myosd", Version: "23"}
+	devices := []rookalpha.Device{
+		{Name: "sda", Config: map[string]string{config.ProtectedDeviceOverrideKey: "sda"}},
+		{Name: "sdb"},
+	}
+	c, err := cluster.provisionPodTemplateSpec(devices, rookalpha.Selection{}, v1.ResourceRequirements{}, config.StoreConfig{}, "", "", v1.RestartPolicyOnFailure)
+	assert.Nil(t, err)
+
+	// the mounts of the host are needed to protect the mounted devices
+	assert.True(t, c.Spec.HostPID)
+	env := map[string]string{}
+	for _, e := range c.Spec.Containers[0].Env {
+		env[e.Name] = e.Value
+	}
+	assert.Equal(t, "sda,sdb", env["ROOK_DATA_DEVICES"])
+	assert.Equal(t, "sda", env["ROOK_PROTECTED_DEVICES_OVERRIDE"])
+
+	// the pods without devices do not need the mounts of the host
+	c, err = cluster.provisionPodTemplateSpec([]rookalpha.Device{}, rookalpha.Selection{}, v1.ResourceRequirements{}, config.StoreConfig{}, "", "", v1.RestartPolicyOnFailure)
+	assert.Nil(t, err)
+	assert.False(t, c.Spec.HostPID)
+}
+
+func TestDeviceAttributes(t *testing.T) {
+	cluster := &Cluster{Namespace: "myosd", Version: "23"}
+	rotational := true
+	selection := rookalpha.Selection{DeviceFilter: "^sd", DeviceAttributes: &rookalpha.DeviceAttributes{Rotational: &rotational}}
+
+	// the job gets the attributes with the filter so that it selects the same devices as the operator
+	c, err := cluster.provisionPodTemplateSpec([]rookalpha.Device{}, selection, v1.ResourceRequirements{}, config.StoreConfig{}, "", "", v1.RestartPolicyOnFailure)
+	assert.Nil(t, err)
+	verifyEnvVar(t, c.Spec.Containers[0].Env, "ROOK_DATA_DEVICE_FILTER", "^sd", true)
+	verifyEnvVar(t, c.Spec.Containers[0].Env, "ROOK_DATA_DEVICE_ATTRIBUTES", `{"rotational":true}`, true)
+
+	// the devices resolved by the operator are not filtered again
+	c, err = cluster.provisionPodTemplateSpec([]rookalpha.Device{{Name: "sda"}}, selection, v1.ResourceRequirements{}, config.StoreConfig{}, "", "", v1.RestartPolicyOnFailure)
+	assert.Nil(t, err)
+	verifyEnvVar(t, c.Spec.Containers[0].Env, "ROOK_DATA_DEVICES", "sda", true)
+	verifyEnvVar(t, c.Spec.Containers[0].Env, "ROOK_DATA_DEVICE_ATTRIBUTES", "", false)
+
+	// a node without any selected device is not provisioned with the filter
+	node := &rookalpha.Node{Selection: selection}
+	assert.False(t, deviceFallbackAllowed(node))
+	node.Selection.DeviceAttributes = nil
+	assert.True(t, deviceFallbackAllowed(node))
+
+	// the job would not leave out the idle spares
+	node.Spares = []rookalpha.Device{{Name: "sdz"}}
+	assert.False(t, deviceFallbackAllowed(node))
+}
+
+func TestLogToFile(t *testing.T) {
+	storageSpec := rookalpha.StorageScopeSpec{Nodes: []rookalpha.Node{{Name: "node1"}}}
+	clientset := fake.NewSimpleClientset()
+	c := New(&clusterd.Context{Clientset: clientset, ConfigDir: "/var/lib/rook", Executor: &exectest.MockExecutor{}}, "ns", "myversion", "",
+		storageSpec, "/var/lib/rook", rookalpha.Placement{}, false, v1.ResourceRequirements{}, metav1.OwnerReference{})
+	c.Logs = cephv1beta1.LogSpec{ToFile: true, MaxSizeMB: 20, Compress: true}
+
+	n := c.Storage.ResolveNode(storageSpec.Nodes[0].Name)
+	osd := OSDInfo{ID: 3}
+	r, err := c.makeDeployment(n.Name, n.Devices, n.Selection, v1.ResourceRequirements{}, config.StoreConfig{}, "", n.Location, osd)
+	assert.Nil(t, err)
+
+	// the osd logs to a file in the data dir that is rotated by the sidecar
+	containers := r.Spec.Template.Spec.Containers
+	assert.Equal(t, 2, len(containers))
+	assert.Contains(t, containers[0].Command, "--log-file=/var/lib/rook/log/ns/osd.3.log")
+	assert.Equal(t, "log-rotate", containers[1].Name)
+	assert.Contains(t, containers[1].Args, "--max-size-mb=20")
+	assert.Contains(t, containers[1].Args, "--max-files=5")
+	assert.Contains(t, containers[1].Args, "--compress=true")
+	verifyEnvVar(t, r.Spec.Template.Spec.InitContainers[0].Env, "ROOK_LOG_DIR", "/var/lib/rook/log/ns", true)
+
+	// the osd logs to stdout without a data dir on the host
+	c.dataDirHostPath = ""
+	r, err = c.makeDeployment(n.Name, n.Devices, n.Selection, v1.ResourceRequirements{}, config.StoreConfig{}, "", n.Location, osd)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(r.Spec.Template.Spec.Containers))
+	verifyEnvVar(t, r.Spec.Template.Spec.InitContainers[0].Env, "ROOK_LOG_DIR", "", false)
+}
+
+func TestLogForward(t *testing.T) {
+	storageSpec := rookalpha.StorageScopeSpec{Nodes: []rookalpha.Node{{Name: "node1"}}}
+	clientset := fake.NewSimpleClientset()
+	c := New(&clusterd.Context{Clientset: clientset, ConfigDir: "/var/lib/rook", Executor: &exectest.MockExecutor{}}, "ns", "myversion", "",
+		storageSpec, "/var/lib/rook", rookalpha.Placement{}, false, v1.ResourceRequirements{}, metav1.OwnerReference{})
+	c.Logs = cephv1beta1.LogSpec{Forward: cephv1beta1.LogForwardSpec{Target: "journald", Facility: "local0"}}
+
+	n := c.Storage.ResolveNode(storageSpec.Nodes[0].Name)
+	osd := OSDInfo{ID: 3}
+	r, err := c.makeDeployment(n.Name, n.Devices, n.Selection, v1.ResourceRequirements{}, config.StoreConfig{}, "", n.Location, osd)
+	assert.Nil(t, err)
+
+	// the osd runs through rook to forward its output to the journal of the host
+	podSpec := r.Spec.Template.Spec
+	container := podSpec.Containers[0]
+	assert.Nil(t, container.Command)
+	assert.Equal(t, []string{"ceph", "osd", "run", "--", "--foreground"}, container.Args[:5])
+	for _, envVars := range [][]v1.EnvVar{container.Env, podSpec.InitContainers[0].Env} {
+		verifyEnvVar(t, envVars, "ROOK_LOG_FORWARD", "journald", true)
+		verifyEnvVar(t, envVars, "ROOK_LOG_FORWARD_FACILITY", "local0", true)
+		verifyEnvVar(t, envVars, "ROOK_LOG_FORWARD_CLUSTER", "ns", true)
+		verifyEnvVar(t, envVars, "ROOK_LOG_FORWARD_DAEMON", "osd.3", true)
+	}
+	assert.Equal(t, "/run/systemd/journal/socket", podSpec.Volumes[len(podSpec.Volumes)-1].HostPath.Path)
+	assert.Equal(t, "/run/systemd/journal/socket", container.VolumeMounts[len(container.VolumeMounts)-1].MountPath)
+	assert.Equal(t, "devices", container.VolumeMounts[len(container.VolumeMounts)-2].Name)
+	initMounts := podSpec.InitContainers[0].VolumeMounts
+	assert.Equal(t, "/run/systemd/journal/socket", initMounts[len(initMounts)-1].MountPath)
+
+	// the socket of the host is not mounted for a remote syslog server
+	c.Logs.Forward = cephv1beta1.LogForwardSpec{Target: "udp://logs.example.com"}
+	r, err = c.makeDeployment(n.Name, n.Devices, n.Selection, v1.ResourceRequirements{}, config.StoreConfig{}, "", n.Location, osd)
+	assert.Nil(t, err)
+	for _, volume := range r.Spec.Template.Spec.Volumes {
+		assert.NotEqual(t, "log-forward-socket", volume.Name)
+	}
+	verifyEnvVar(t, r.Spec.Template.Spec.Containers[0].Env, "ROOK_LOG_FORWARD", "udp://logs.example.com", true)
+	verifyEnvVar(t, r.Spec.Template.Spec.Containers[0].Env, "ROOK_LOG_FORWARD_FACILITY", "", false)
+
+	// the osd daemon runs directly without forwarding
+	c.Logs.Forward = cephv1beta1.LogForwardSpec{}
+	r, err = c.makeDeployment(n.Name, n.Devices, n.Selection, v1.ResourceRequirements{}, config.StoreConfig{}, "", n.Location, osd)
+	assert.Nil(t, err)
+	assert.Equal(t, "/tini", r.Spec.Template.Spec.Containers[0].Command[0])
+	verifyEnvVar(t, r.Spec.Template.Spec.Containers[0].Env, "ROOK_LOG_FORWARD", "", false)
+}
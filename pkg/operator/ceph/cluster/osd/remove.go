@@ -31,6 +31,7 @@ import (
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/kubernetes/pkg/kubelet/apis"
 )
 
 func removeOSD(context *clusterd.Context, namespace, deploymentName string, id int) error {
@@ -40,6 +41,11 @@ func removeOSD(context *clusterd.Context, namespace, deploymentName string, id i
 		logger.Warningf("failed to get baseline OSD usage, but will still continue")
 	}
 
+	// stop moving the weight of the OSD towards a target weight
+	if err := removeTargetWeight(context, namespace, id); err != nil {
+		logger.Warningf("failed to remove the target weight of osd.%d. %+v", id, err)
+	}
+
 	// first reweight the OSD to be 0.0, which will begin the data migration
 	o, err := client.CrushReweight(context, namespace, id, 0.0)
 	alreadyPurged := false
@@ -73,7 +79,7 @@ func removeOSD(context *clusterd.Context, namespace, deploymentName string, id i
 	}
 
 	// purge the OSD from the cluster
-	if err := purgeOSD(context, namespace, id); err != nil {
+	if err := PurgeOSD(context, namespace, id); err != nil {
 		return fmt.Errorf("failed to purge osd.%d from the cluster: %+v", id, err)
 	}
 
@@ -154,15 +160,10 @@ func waitForRebalance(context *clusterd.Context, namespace string, osdID int, in
 	}
 
 	// wait until the cluster gets fully rebalanced again
+	tracker := client.NewRebalanceTracker(10 * time.Minute)
 	err := util.Retry(3000, 15*time.Second, func() error {
-		// get a dump of all placement groups
-		pgDump, err := client.GetPGDumpBrief(context, namespace)
-		if err != nil {
-			return err
-		}
-
-		// ensure that the given OSD is no longer assigned to any placement groups
-		for _, pg := range pgDump {
+		// ensure that the given OSD is no longer assigned to any placement groups, stopping at the first one
+		err := client.ForEachPGDumpBrief(context, namespace, func(pg client.PGDumpBrief) error {
 			if pg.UpPrimaryID == osdID {
 				return fmt.Errorf("osd.%d is still up primary for pg %s", osdID, pg.ID)
 			}
@@ -179,6 +180,15 @@ func waitForRebalance(context *clusterd.Context, namespace string, osdID int, in
 					return fmt.Errorf("osd.%d is still acting for pg %s", osdID, pg.ID)
 				}
 			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		// report the progress so that a long rebalance does not appear to be hung
+		if status, err := client.Status(context, namespace); err == nil {
+			logger.Infof("waiting for the data of osd.%d to be rebalanced. %s", osdID, tracker.Add(time.Now(), status.PgMap))
 		}
 
 		// finally, ensure the cluster gets back to a clean state, meaning rebalancing is complete
@@ -196,7 +206,8 @@ func markOSDOut(context *clusterd.Context, namespace string, id int) error {
 	return err
 }
 
-func purgeOSD(context *clusterd.Context, namespace string, id int) error {
+// PurgeOSD removes the OSD from the crush map, deletes its auth and removes it from the cluster
+func PurgeOSD(context *clusterd.Context, namespace string, id int) error {
 	// remove the OSD from the crush map
 	_, err := client.CrushRemove(context, namespace, fmt.Sprintf("osd.%d", id))
 	if err != nil {
@@ -244,3 +255,27 @@ func (c *Cluster) cleanUpNodeResources(nodeName, nodeCrushName string) error {
 
 	return nil
 }
+
+// NodeRemovalComplete returns whether the osd deployments of a node that was removed from the cluster are deleted and
+// the cleanup job on the node completed, which clears the orchestration status of the node
+func NodeRemovalComplete(context *clusterd.Context, namespace, nodeName string) (bool, error) {
+	listOpts := metav1.ListOptions{LabelSelector: fmt.Sprintf("app=%s", appName)}
+	osdDeployments, err := context.Clientset.Extensions().Deployments(namespace).List(listOpts)
+	if err != nil {
+		return false, fmt.Errorf("failed to list osd deployments. %+v", err)
+	}
+	for _, d := range osdDeployments.Items {
+		if d.Spec.Template.Spec.NodeSelector[apis.LabelHostname] == nodeName {
+			return false, nil
+		}
+	}
+
+	statusMapName := fmt.Sprintf(orchestrationStatusMapName, nodeName)
+	if _, err := context.Clientset.CoreV1().ConfigMaps(namespace).Get(statusMapName, metav1.GetOptions{}); err != nil {
+		if errors.IsNotFound(err) {
+			return true, nil
+		}
+		return false, fmt.Errorf("failed to get the orchestration status of node %s. %+v", nodeName, err)
+	}
+	return false, nil
+}
@@ -0,0 +1,338 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package osd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	rookalpha "github.com/rook/rook/pkg/apis/rook.io/v1alpha2"
+	"github.com/rook/rook/pkg/clusterd"
+	"github.com/rook/rook/pkg/daemon/ceph/client"
+	"github.com/rook/rook/pkg/operator/ceph/settings"
+	"github.com/rook/rook/pkg/operator/discover"
+	"github.com/rook/rook/pkg/operator/k8sutil"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// SparesConfigMapName is the config map where the spare devices that replaced failed osds are recorded, with the
+// substitutions on each node
+const SparesConfigMapName = "rook-ceph-osd-spares"
+
+// SpareReplaceTimeout is how long an osd must be down before it is considered failed permanently and is replaced with
+// a spare device. The osds are never replaced if the timeout is zero.
+var SpareReplaceTimeout = settings.NewDuration(time.Hour)
+
+// SpareReplacementsPerCheck is how many osds are replaced with a spare at most in each health check, so that a
+// failure of many osds at once does not start the recovery of all their data at the same time
+var SpareReplacementsPerCheck = 1
+
+// SpareSubstitution is a spare device that was provisioned to replace a failed osd
+type SpareSubstitution struct {
+	Device     string    `json:"device"`
+	FailedOSD  int       `json:"failedOSD"`
+	FailedHost string    `json:"failedHost"`
+	Time       time.Time `json:"time"`
+}
+
+// replaceWithSpare marks the failed osd out and records the substitution of a spare device on the host of the osd or
+// on another host in the same failure domain, then starts the provisioning of the spare. It returns whether the osd
+// was replaced.
+func (m *Monitor) replaceWithSpare(id int, now time.Time) (bool, error) {
+	clusters, err := m.context.RookClientset.CephV1beta1().Clusters(m.clusterName).List(metav1.ListOptions{})
+	if err != nil {
+		return false, fmt.Errorf("failed to list clusters. %+v", err)
+	}
+	if len(clusters.Items) == 0 {
+		return false, nil
+	}
+	storage := clusters.Items[0].Spec.Storage
+
+	subs, err := loadSpareSubstitutions(m.context, m.clusterName)
+	if err != nil {
+		return false, err
+	}
+	for _, nodeSubs := range subs {
+		for _, s := range nodeSubs {
+			if s.FailedOSD == id {
+				// the osd was already replaced
+				return true, nil
+			}
+		}
+	}
+
+	metadata, err := client.GetOSDMetadata(m.context, m.clusterName, id)
+	if err != nil {
+		return false, fmt.Errorf("failed to get the host of osd.%d. %+v", id, err)
+	}
+	nodeNames, err := storageNodeNames(m.context, storage)
+	if err != nil {
+		return false, err
+	}
+	nodeName, device := findSpare(storage, nodeNames, metadata.Hostname, subs)
+	if nodeName == "" {
+		return false, nil
+	}
+
+	if _, err := client.OSDOut(m.context, m.clusterName, id); err != nil {
+		return false, fmt.Errorf("failed to mark osd.%d out. %+v", id, err)
+	}
+	sub := SpareSubstitution{Device: device, FailedOSD: id, FailedHost: metadata.Hostname, Time: now}
+	if err := saveSpareSubstitution(m.context, m.clusterName, nodeName, sub); err != nil {
+		return false, err
+	}
+
+	message := fmt.Sprintf("osd.%d on host %s was down for more than %s and is replaced with spare device %s on node %s",
+		id, metadata.Hostname, SpareReplaceTimeout.Get(), device, nodeName)
+	logger.Warning(message)
+	m.spareEvent(id, message)
+
+	if m.ProvisionSpares != nil {
+		m.ProvisionSpares()
+	}
+	return true, nil
+}
+
+// spareEvent creates an event on the deployment of the failed osd that records its substitution
+func (m *Monitor) spareEvent(id int, message string) {
+	name := fmt.Sprintf(osdAppNameFmt, id)
+	d, err := m.context.Clientset.Extensions().Deployments(m.clusterName).Get(name, metav1.GetOptions{})
+	if err != nil {
+		logger.Warningf("failed to get deployment %s for the spare event. %+v", name, err)
+		return
+	}
+	now := metav1.Now()
+	event := &v1.Event{
+		ObjectMeta:     metav1.ObjectMeta{Name: fmt.Sprintf("%s.%x", name, now.UnixNano()), Namespace: m.clusterName},
+		InvolvedObject: v1.ObjectReference{Kind: "Deployment", Namespace: m.clusterName, Name: name, UID: d.UID},
+		Reason:         "OSDReplacedWithSpare",
+		Message:        message,
+		Type:           v1.EventTypeWarning,
+		Source:         v1.EventSource{Component: "rook-ceph-operator"},
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+		Count:          1,
+	}
+	if _, err := m.context.Clientset.CoreV1().Events(m.clusterName).Create(event); err != nil {
+		logger.Warningf("failed to create the spare event of osd.%d. %+v", id, err)
+	}
+}
+
+// storageNodeNames returns the names of the storage nodes, which are all the nodes with discovered devices if all the
+// nodes are used
+func storageNodeNames(context *clusterd.Context, storage rookalpha.StorageScopeSpec) ([]string, error) {
+	var names []string
+	if storage.UseAllNodes {
+		allNodeDevices, err := discover.ListDevices(context, os.Getenv(k8sutil.PodNamespaceEnvVar), "" /* all nodes */)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get the storage nodes. %+v", err)
+		}
+		for name := range allNodeDevices {
+			names = append(names, name)
+		}
+	} else {
+		for _, n := range storage.Nodes {
+			names = append(names, n.Name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// findSpare returns the node and name of an unused spare device on the failed host, or else on another node in the
+// same failure domain, which is the location of the node without the host. An empty node name is returned if no spare
+// is available.
+func findSpare(storage rookalpha.StorageScopeSpec, nodeNames []string, failedHost string, subs map[string][]SpareSubstitution) (string, string) {
+	if storage.UseAllNodes {
+		storage.Nodes = nil
+		for _, name := range nodeNames {
+			storage.Nodes = append(storage.Nodes, rookalpha.Node{Name: name})
+		}
+	} else {
+		// resolving the nodes updates them and their config in place
+		storage.Nodes = storage.DeepCopy().Nodes
+	}
+
+	spares := map[string][]string{}
+	domains := map[string]string{}
+	for _, name := range nodeNames {
+		n := storage.ResolveNode(name)
+		if n == nil {
+			continue
+		}
+		spares[name] = idleSpares(n.Spares, subs[name])
+		domains[name] = failureDomain(n.Location)
+	}
+
+	if len(spares[failedHost]) > 0 {
+		return failedHost, spares[failedHost][0]
+	}
+	domain, ok := domains[failedHost]
+	if !ok || domain == "" {
+		return "", ""
+	}
+	for _, name := range nodeNames {
+		if name != failedHost && domains[name] == domain && len(spares[name]) > 0 {
+			return name, spares[name][0]
+		}
+	}
+	return "", ""
+}
+
+// spareDevicesToUse removes the idle spares from the available devices of the node and adds the spares that replaced
+// a failed osd
+func (c *Cluster) spareDevicesToUse(n *rookalpha.Node, available []rookalpha.Device, subs []SpareSubstitution) []rookalpha.Device {
+	devices := withoutIdleSpares(available, n.Spares, subs)
+	active := activeSpares(n.Spares, subs)
+	if len(active) == 0 {
+		return devices
+	}
+	spareDev, err := discover.GetAvailableDevices(c.context, n.Name, c.Namespace, active, "", nil, false)
+	if err != nil {
+		logger.Warningf("failed to get the spare devices for node %s. %+v", n.Name, err)
+		return devices
+	}
+	for _, d := range spareDev {
+		found := false
+		for _, existing := range devices {
+			if existing.Name == d.Name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			devices = append(devices, d)
+		}
+	}
+	return devices
+}
+
+// idleSpares returns the names of the spare devices that did not replace an osd yet
+func idleSpares(spares []rookalpha.Device, subs []SpareSubstitution) []string {
+	var idle []string
+	for _, d := range spares {
+		if !substituted(d.Name, subs) {
+			idle = append(idle, d.Name)
+		}
+	}
+	return idle
+}
+
+// activeSpares returns the spare devices that replaced an osd and are provisioned like the other devices of the node
+func activeSpares(spares []rookalpha.Device, subs []SpareSubstitution) []rookalpha.Device {
+	var active []rookalpha.Device
+	for _, d := range spares {
+		if substituted(d.Name, subs) {
+			active = append(active, d)
+		}
+	}
+	return active
+}
+
+// withoutIdleSpares removes the spare devices that did not replace an osd yet from the devices to provision
+func withoutIdleSpares(devices, spares []rookalpha.Device, subs []SpareSubstitution) []rookalpha.Device {
+	idle := idleSpares(spares, subs)
+	if len(idle) == 0 {
+		return devices
+	}
+	var result []rookalpha.Device
+	for _, d := range devices {
+		isIdle := false
+		for _, name := range idle {
+			if d.Name == name {
+				isIdle = true
+				break
+			}
+		}
+		if !isIdle {
+			result = append(result, d)
+		}
+	}
+	return result
+}
+
+func substituted(device string, subs []SpareSubstitution) bool {
+	for _, s := range subs {
+		if s.Device == device {
+			return true
+		}
+	}
+	return false
+}
+
+// failureDomain returns the crush location without the host, in a canonical order
+func failureDomain(location string) string {
+	var pairs []string
+	for _, pair := range strings.Split(location, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" || strings.HasPrefix(pair, "host=") {
+			continue
+		}
+		pairs = append(pairs, pair)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// loadSpareSubstitutions returns the spare substitutions by the node of the spare device
+func loadSpareSubstitutions(context *clusterd.Context, namespace string) (map[string][]SpareSubstitution, error) {
+	subs := map[string][]SpareSubstitution{}
+	cm, err := context.Clientset.CoreV1().ConfigMaps(namespace).Get(SparesConfigMapName, metav1.GetOptions{})
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return subs, nil
+		}
+		return nil, fmt.Errorf("failed to get configmap %s. %+v", SparesConfigMapName, err)
+	}
+	for node, data := range cm.Data {
+		var nodeSubs []SpareSubstitution
+		if err := json.Unmarshal([]byte(data), &nodeSubs); err != nil {
+			logger.Warningf("ignoring the invalid spare substitutions of node %s. %+v", node, err)
+			continue
+		}
+		subs[node] = nodeSubs
+	}
+	return subs, nil
+}
+
+// saveSpareSubstitution adds the substitution to the substitutions of the node in the spares config map
+func saveSpareSubstitution(context *clusterd.Context, namespace, nodeName string, sub SpareSubstitution) error {
+	var marshalErr error
+	err := k8sutil.ModifyConfigMap(context.Clientset, namespace, SparesConfigMapName, nil, func(cm *v1.ConfigMap) {
+		var subs []SpareSubstitution
+		if data, ok := cm.Data[nodeName]; ok {
+			if err := json.Unmarshal([]byte(data), &subs); err != nil {
+				logger.Warningf("replacing the invalid spare substitutions of node %s. %+v", nodeName, err)
+			}
+		}
+		d, err := json.Marshal(append(subs, sub))
+		if err != nil {
+			marshalErr = fmt.Errorf("failed to marshal the spare substitutions of node %s. %+v", nodeName, err)
+			return
+		}
+		cm.Data[nodeName] = string(d)
+	})
+	if marshalErr != nil {
+		return marshalErr
+	}
+	return err
+}
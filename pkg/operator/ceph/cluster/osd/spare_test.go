@@ -0,0 +1,173 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package osd
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	cephv1beta1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1beta1"
+	rookalpha "github.com/rook/rook/pkg/apis/rook.io/v1alpha2"
+	rookfake "github.com/rook/rook/pkg/client/clientset/versioned/fake"
+	"github.com/rook/rook/pkg/clusterd"
+	exectest "github.com/rook/rook/pkg/util/exec/test"
+	"github.com/stretchr/testify/assert"
+	extensions "k8s.io/api/extensions/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestFindSpare(t *testing.T) {
+	storage := rookalpha.StorageScopeSpec{
+		Selection: rookalpha.Selection{Spares: []rookalpha.Device{{Name: "sdz"}}},
+		Nodes: []rookalpha.Node{
+			{Name: "node1", Location: "rack=a,host=node1"},
+			{Name: "node2", Location: "host=node2,rack=a", Selection: rookalpha.Selection{Spares: []rookalpha.Device{{Name: "sdx"}, {Name: "sdy"}}}},
+			{Name: "node3", Location: "rack=b"},
+			{Name: "node4"},
+		},
+	}
+	names := []string{"node1", "node2", "node3", "node4"}
+
+	// the spare on the failed host is used first
+	node, device := findSpare(storage, names, "node1", nil)
+	assert.Equal(t, "node1", node)
+	assert.Equal(t, "sdz", device)
+
+	// then a spare on another host in the same rack
+	subs := map[string][]SpareSubstitution{"node1": {{Device: "sdz", FailedOSD: 1}}}
+	node, device = findSpare(storage, names, "node1", subs)
+	assert.Equal(t, "node2", node)
+	assert.Equal(t, "sdx", device)
+
+	subs["node2"] = []SpareSubstitution{{Device: "sdx", FailedOSD: 2}, {Device: "sdy", FailedOSD: 3}}
+	node, _ = findSpare(storage, names, "node1", subs)
+	assert.Equal(t, "", node)
+
+	// a node without a location only uses its own spares
+	subs["node4"] = []SpareSubstitution{{Device: "sdz", FailedOSD: 4}}
+	node, _ = findSpare(storage, names, "node4", subs)
+	assert.Equal(t, "", node)
+
+	// the nodes of the spec are not changed by resolving them
+	assert.Nil(t, storage.Nodes[0].Spares)
+}
+
+func TestSpareDevices(t *testing.T) {
+	spares := []rookalpha.Device{{Name: "sdx"}, {Name: "sdy"}}
+	subs := []SpareSubstitution{{Device: "sdy", FailedOSD: 2}}
+	devices := []rookalpha.Device{{Name: "sda"}, {Name: "sdx"}, {Name: "sdy"}}
+
+	assert.Equal(t, []rookalpha.Device{{Name: "sda"}, {Name: "sdy"}}, withoutIdleSpares(devices, spares, subs))
+	assert.Equal(t, []rookalpha.Device{{Name: "sdy"}}, activeSpares(spares, subs))
+	assert.Equal(t, []string{"sdx"}, idleSpares(spares, subs))
+
+	assert.Equal(t, "rack=a,row=1", failureDomain("row=1, host=node1,rack=a"))
+	assert.Equal(t, "", failureDomain("host=node1"))
+}
+
+func TestReplaceWithSpare(t *testing.T) {
+	var out []string
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithOutputFile: func(debug bool, actionName string, command string, outFileArg string, args ...string) (string, error) {
+			switch {
+			case args[0] == "osd" && args[1] == "out":
+				out = append(out, args[2])
+				return "", nil
+			case args[0] == "osd" && args[1] == "metadata":
+				return `{"id":3,"hostname":"node1","devices":"sdb","osd_objectstore":"bluestore"}`, nil
+			case args[0] == "osd" && args[1] == "crush" && args[2] == "dump":
+				return `{"buckets":[{"id":-2,"name":"node1","type_name":"host","items":[{"id":3},{"id":4}]}]}`, nil
+			}
+			return "", fmt.Errorf("unexpected ceph command '%v'", args)
+		},
+	}
+	d := &extensions.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "rook-ceph-osd-3", Namespace: "ns"}}
+	clientset := fake.NewSimpleClientset(d)
+	rookClientset := rookfake.NewSimpleClientset(&cephv1beta1.Cluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "rook-ceph", Namespace: "ns"},
+		Spec: cephv1beta1.ClusterSpec{Storage: rookalpha.StorageScopeSpec{
+			Nodes: []rookalpha.Node{{Name: "node1", Selection: rookalpha.Selection{Spares: []rookalpha.Device{{Name: "sdz"}}}}},
+		}},
+	})
+	context := &clusterd.Context{Executor: executor, Clientset: clientset, RookClientset: rookClientset}
+	m := NewMonitor(context, "ns")
+	provisioned := 0
+	m.ProvisionSpares = func() { provisioned++ }
+
+	now := time.Now()
+	down := map[int]bool{3: true}
+	m.checkSpare(3, now, down)
+	m.checkSpare(3, now.Add(time.Minute), down)
+	assert.Equal(t, 0, len(out))
+
+	// the osd is not replaced outside of the maintenance windows
+	allowed := false
+	m.AllowSpareReplace = func() bool { return allowed }
+	m.checkSpare(3, now.Add(SpareReplaceTimeout.Get()+time.Minute), down)
+	assert.Equal(t, 0, len(out))
+
+	// nor when all the osds of its host are down
+	allowed = true
+	m.checkSpare(3, now.Add(SpareReplaceTimeout.Get()+time.Minute), map[int]bool{3: true, 4: true})
+	assert.Equal(t, 0, len(out))
+
+	// nor when the osds replaced in the check reached the limit
+	m.replaced = SpareReplacementsPerCheck
+	m.checkSpare(3, now.Add(SpareReplaceTimeout.Get()+time.Minute), down)
+	assert.Equal(t, 0, len(out))
+
+	m.replaced = 0
+	m.checkSpare(3, now.Add(SpareReplaceTimeout.Get()+time.Minute), down)
+	assert.Equal(t, []string{"3"}, out)
+	assert.Equal(t, 1, m.replaced)
+	assert.Equal(t, 1, provisioned)
+	subs, err := loadSpareSubstitutions(context, "ns")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(subs["node1"]))
+	assert.Equal(t, "sdz", subs["node1"][0].Device)
+	assert.Equal(t, 3, subs["node1"][0].FailedOSD)
+	events, err := clientset.CoreV1().Events("ns").List(metav1.ListOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(events.Items))
+	assert.Equal(t, "OSDReplacedWithSpare", events.Items[0].Reason)
+
+	// the osd is only replaced once
+	replaced, err := m.replaceWithSpare(3, now.Add(2*SpareReplaceTimeout.Get()))
+	assert.Nil(t, err)
+	assert.True(t, replaced)
+	assert.Equal(t, 1, len(out))
+	assert.Equal(t, 1, provisioned)
+}
+
+func TestSpareSkipsQuarantined(t *testing.T) {
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithOutputFile: func(debug bool, actionName string, command string, outFileArg string, args ...string) (string, error) {
+			return "", fmt.Errorf("unexpected ceph command '%v'", args)
+		},
+	}
+	d := &extensions.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "rook-ceph-osd-3", Namespace: "ns",
+		Annotations: map[string]string{QuarantineAnnotation: "flapping"}}}
+	context := &clusterd.Context{Executor: executor, Clientset: fake.NewSimpleClientset(d), RookClientset: rookfake.NewSimpleClientset()}
+	m := NewMonitor(context, "ns")
+
+	// the quarantined osd is down on purpose and is not replaced
+	now := time.Now()
+	m.checkSpare(3, now, map[int]bool{3: true})
+	m.checkSpare(3, now.Add(SpareReplaceTimeout.Get()+time.Minute), map[int]bool{3: true})
+	assert.Equal(t, 0, m.replaced)
+}
@@ -20,9 +20,11 @@ package osd
 import (
 	"encoding/json"
 	"fmt"
+	"math"
 	"time"
 
 	rookalpha "github.com/rook/rook/pkg/apis/rook.io/v1alpha2"
+	"github.com/rook/rook/pkg/operator/ceph/settings"
 	"github.com/rook/rook/pkg/operator/k8sutil"
 	"github.com/rook/rook/pkg/util"
 	"k8s.io/api/core/v1"
@@ -44,6 +46,10 @@ const (
 	nodeLabelKey                     = "node"
 )
 
+// ProvisionTimeout is the time the osds may take to be provisioned on a node. The prepare job of a node that takes longer
+// is stopped and the provisioning of the node fails, so that a stuck device does not wedge the orchestration.
+var ProvisionTimeout = settings.NewDuration(10 * time.Minute)
+
 type provisionConfig struct {
 	devicesToUse  map[string][]rookalpha.Device
 	errorMessages []string
@@ -114,7 +120,7 @@ func parseOrchestrationStatus(data map[string]string) *OrchestrationStatus {
 }
 
 func (c *Cluster) completeProvision(config *provisionConfig) bool {
-	timeoutMinutes := 10
+	timeoutMinutes := int(math.Ceil(ProvisionTimeout.Get().Minutes()))
 	return c.completeOSDsForAllNodes(config, true, timeoutMinutes)
 }
 
@@ -214,6 +220,10 @@ func (c *Cluster) completeOSDsForAllNodes(config *provisionConfig, configOSDs bo
 				currentTimeoutMinutes++
 				if currentTimeoutMinutes == timeoutMinutes {
 					config.addError("timed out waiting for %d nodes: %+v", remainingNodes.Count(), remainingNodes)
+					// record the failure so the nodes are provisioned again from the start at the next orchestration
+					for node := range remainingNodes.Iter() {
+						c.handleOrchestrationFailure(config, node, fmt.Sprintf("timed out after %d minutes waiting for the osds of node %s", timeoutMinutes, node))
+					}
 					return false
 				}
 				logger.Infof("waiting on orchestration status update from %d remaining nodes", remainingNodes.Count())
@@ -27,10 +27,12 @@ import (
 	exectest "github.com/rook/rook/pkg/util/exec/test"
 	"github.com/stretchr/testify/assert"
 	"k8s.io/api/core/v1"
+	extensions "k8s.io/api/extensions/v1beta1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/kubernetes/pkg/kubelet/apis"
 )
 
 func TestOrchestrationStatus(t *testing.T) {
@@ -59,6 +61,45 @@ func TestOrchestrationStatus(t *testing.T) {
 	assert.Equal(t, status, *retrievedStatus)
 }
 
+func TestNodeRemovalComplete(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	context := &clusterd.Context{Clientset: clientset}
+	kv := k8sutil.NewConfigMapKVStore("ns", clientset, metav1.OwnerReference{})
+
+	// the removal is complete for a node without osds
+	complete, err := NodeRemovalComplete(context, "ns", "node1")
+	assert.Nil(t, err)
+	assert.True(t, complete)
+
+	// the osds of the node are still running
+	d := &extensions.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "rook-ceph-osd-0", Labels: map[string]string{"app": appName}}}
+	d.Spec.Template.Spec.NodeSelector = map[string]string{apis.LabelHostname: "node1"}
+	_, err = clientset.Extensions().Deployments("ns").Create(d)
+	assert.Nil(t, err)
+	complete, err = NodeRemovalComplete(context, "ns", "node1")
+	assert.Nil(t, err)
+	assert.False(t, complete)
+	complete, err = NodeRemovalComplete(context, "ns", "node2")
+	assert.Nil(t, err)
+	assert.True(t, complete)
+
+	// the osds were removed and the cleanup job is running
+	err = clientset.Extensions().Deployments("ns").Delete(d.Name, &metav1.DeleteOptions{})
+	assert.Nil(t, err)
+	err = UpdateNodeStatus(kv, "node1", OrchestrationStatus{Status: OrchestrationStatusStarting})
+	assert.Nil(t, err)
+	complete, err = NodeRemovalComplete(context, "ns", "node1")
+	assert.Nil(t, err)
+	assert.False(t, complete)
+
+	// the cleanup completed
+	err = kv.ClearStore(fmt.Sprintf(orchestrationStatusMapName, "node1"))
+	assert.Nil(t, err)
+	complete, err = NodeRemovalComplete(context, "ns", "node1")
+	assert.Nil(t, err)
+	assert.True(t, complete)
+}
+
 func mockNodeOrchestrationCompletion(c *Cluster, nodeName string, statusMapWatcher *watch.FakeWatcher) {
 	// if no valid osd node, don't need to check its status, return immediately
 	if len(c.Storage.Nodes) == 0 {
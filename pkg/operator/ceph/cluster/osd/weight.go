@@ -0,0 +1,204 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package osd
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rook/rook/pkg/clusterd"
+	"github.com/rook/rook/pkg/daemon/ceph/client"
+	"github.com/rook/rook/pkg/operator/ceph/cluster/osd/config"
+	"github.com/rook/rook/pkg/operator/ceph/settings"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// the crush weights are only changed when they differ from the targets by more than the precision of the weights
+const weightTolerance = 0.0001
+
+var (
+	// WeightInInterval is the interval to move the crush weights of the osds towards their target weights
+	WeightInInterval = settings.NewDuration(time.Minute)
+	// WeightInStep is the share of the target weight that the crush weight of an osd is moved by at each step. The
+	// target weight is set at once if the step is zero or one.
+	WeightInStep = settings.NewFloat(0.1)
+	// WeightInMaxRecovery is the ratio of degraded and misplaced objects above which the weights are not changed,
+	// so the data moved by a step is recovered before the next step
+	WeightInMaxRecovery = settings.NewFloat(0.05)
+)
+
+// WeightController moves the crush weights of the osds in steps towards the target weights in the weights config
+// map, such as the new osds that are weighted in gradually
+type WeightController struct {
+	context   *clusterd.Context
+	namespace string
+	// AllowReweight returns whether the maintenance windows allow the crush weights to be changed now
+	AllowReweight func() bool
+}
+
+// NewWeightController creates a new weight controller for the cluster in the namespace
+func NewWeightController(context *clusterd.Context, namespace string) *WeightController {
+	return &WeightController{context: context, namespace: namespace}
+}
+
+// Start periodically moves the crush weights of the osds towards their targets
+func (w *WeightController) Start(stopCh chan struct{}) {
+	for {
+		select {
+		case <-stopCh:
+			logger.Infof("stopping the osd weight controller in namespace %s", w.namespace)
+			return
+
+		case <-time.After(WeightInInterval.Get()):
+			if err := w.Check(); err != nil {
+				logger.Warningf("failed to update the weights of the osds in namespace %s. %+v", w.namespace, err)
+			}
+		}
+	}
+}
+
+// Check moves the crush weight of each osd that differs from its target weight a step towards the target, unless
+// the cluster is still recovering the objects moved by the previous step or no maintenance window is open
+func (w *WeightController) Check() error {
+	targets, err := w.targetWeights()
+	if err != nil || len(targets) == 0 {
+		return err
+	}
+
+	usage, err := client.GetOSDUsage(w.context, w.namespace)
+	if err != nil {
+		return fmt.Errorf("failed to get the crush weights of the osds. %+v", err)
+	}
+	var ids []int
+	weights := map[int]float64{}
+	for _, node := range usage.OSDNodes {
+		target, ok := targets[node.ID]
+		if !ok {
+			continue
+		}
+		weight, err := node.CrushWeight.Float64()
+		if err != nil || math.Abs(weight-target) <= weightTolerance {
+			continue
+		}
+		ids = append(ids, node.ID)
+		weights[node.ID] = weight
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	if w.AllowReweight != nil && !w.AllowReweight() {
+		logger.Infof("deferring the weights of %d osds until a maintenance window opens", len(ids))
+		return nil
+	}
+
+	status, err := client.Status(w.context, w.namespace)
+	if err != nil {
+		return fmt.Errorf("failed to get the recovery of the cluster. %+v", err)
+	}
+	if ratio := recoveryRatio(status.PgMap); ratio > WeightInMaxRecovery.Get() {
+		logger.Infof("deferring the weights of %d osds until the cluster recovers. %.1f%% of the objects are degraded or misplaced",
+			len(ids), ratio*100)
+		return nil
+	}
+
+	sort.Ints(ids)
+	for _, id := range ids {
+		next := stepWeight(weights[id], targets[id])
+		if _, err := client.CrushReweight(w.context, w.namespace, id, next); err != nil {
+			return fmt.Errorf("failed to reweight osd.%d to %.4f. %+v", id, next, err)
+		}
+		logger.Infof("reweighted osd.%d from %.4f to %.4f of target weight %.4f", id, weights[id], next, targets[id])
+	}
+	return nil
+}
+
+// targetWeights returns the target weights of the osds by id from the weights config map
+func (w *WeightController) targetWeights() (map[int]float64, error) {
+	cm, err := w.context.Clientset.CoreV1().ConfigMaps(w.namespace).Get(config.WeightConfigMapName, metav1.GetOptions{})
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get configmap %s. %+v", config.WeightConfigMapName, err)
+	}
+
+	targets := map[int]float64{}
+	for name, value := range cm.Data {
+		id, err := strconv.Atoi(strings.TrimPrefix(name, "osd."))
+		if err != nil || !strings.HasPrefix(name, "osd.") {
+			logger.Warningf("ignoring the target weight of unknown osd %s", name)
+			continue
+		}
+		target, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil || target < 0 {
+			logger.Warningf("ignoring invalid target weight %s of osd.%d", value, id)
+			continue
+		}
+		targets[id] = target
+	}
+	return targets, nil
+}
+
+// removeTargetWeight removes the target weight of the osd so the weight of the osd is no longer changed
+func removeTargetWeight(context *clusterd.Context, namespace string, id int) error {
+	configMaps := context.Clientset.CoreV1().ConfigMaps(namespace)
+	cm, err := configMaps.Get(config.WeightConfigMapName, metav1.GetOptions{})
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to get configmap %s. %+v", config.WeightConfigMapName, err)
+	}
+	name := fmt.Sprintf("osd.%d", id)
+	if _, ok := cm.Data[name]; !ok {
+		return nil
+	}
+	delete(cm.Data, name)
+	if _, err := configMaps.Update(cm); err != nil {
+		return fmt.Errorf("failed to update configmap %s. %+v", config.WeightConfigMapName, err)
+	}
+	return nil
+}
+
+// stepWeight returns the weight a step from the current weight towards the target weight
+func stepWeight(current, target float64) float64 {
+	ratio := WeightInStep.Get()
+	step := math.Max(current, target) * ratio
+	if ratio <= 0 || ratio >= 1 {
+		return target
+	}
+	if current < target {
+		return math.Min(current+step, target)
+	}
+	return math.Max(current-step, target)
+}
+
+// recoveryRatio returns the ratio of the objects that are degraded or misplaced
+func recoveryRatio(pgMap client.PgMap) float64 {
+	total := pgMap.DegradedTotal
+	if pgMap.MisplacedTotal > total {
+		total = pgMap.MisplacedTotal
+	}
+	if total == 0 {
+		return 0
+	}
+	return float64(pgMap.DegradedObjects+pgMap.MisplacedObjects) / float64(total)
+}
@@ -0,0 +1,88 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package osd
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/rook/rook/pkg/clusterd"
+	"github.com/rook/rook/pkg/operator/ceph/cluster/osd/config"
+	exectest "github.com/rook/rook/pkg/util/exec/test"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestWeightIn(t *testing.T) {
+	pgmap := `{"pgmap":{"num_pgs":8,"misplaced_objects":20,"misplaced_total":100}}`
+	weights := map[string]string{}
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithOutputFile: func(debug bool, actionName string, command string, outFileArg string, args ...string) (string, error) {
+			switch {
+			case args[0] == "osd" && args[1] == "df":
+				return `{"nodes":[{"id":0,"crush_weight":1.0},{"id":1,"crush_weight":0.0},{"id":2,"crush_weight":0.95}]}`, nil
+			case args[0] == "status":
+				return pgmap, nil
+			case args[0] == "osd" && args[1] == "crush" && args[2] == "reweight":
+				weights[args[3]] = args[4]
+				return "", nil
+			}
+			return "", fmt.Errorf("unexpected ceph command '%v'", args)
+		},
+	}
+	cm := &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: config.WeightConfigMapName, Namespace: "ns"},
+		Data:       map[string]string{"osd.0": "1.0000", "osd.1": "2.0000", "osd.2": "0.5", "osd.5": "1", "foo": "1"},
+	}
+	clientset := fake.NewSimpleClientset(cm)
+	context := &clusterd.Context{Executor: executor, Clientset: clientset}
+	w := NewWeightController(context, "ns")
+
+	// the weights are not changed while the cluster is recovering
+	assert.Nil(t, w.Check())
+	assert.Equal(t, 0, len(weights))
+
+	// nor outside of the maintenance windows
+	pgmap = `{"pgmap":{"num_pgs":8,"misplaced_objects":2,"misplaced_total":100}}`
+	allowed := false
+	w.AllowReweight = func() bool { return allowed }
+	assert.Nil(t, w.Check())
+	assert.Equal(t, 0, len(weights))
+
+	// the osds that are not at their target weight are moved a step towards it
+	allowed = true
+	assert.Nil(t, w.Check())
+	assert.Equal(t, map[string]string{"osd.1": "0.2000", "osd.2": "0.8550"}, weights)
+
+	// the weight of a removed osd is no longer changed
+	assert.Nil(t, removeTargetWeight(context, "ns", 1))
+	cm, err := clientset.CoreV1().ConfigMaps("ns").Get(config.WeightConfigMapName, metav1.GetOptions{})
+	assert.Nil(t, err)
+	_, ok := cm.Data["osd.1"]
+	assert.False(t, ok)
+}
+
+func TestStepWeight(t *testing.T) {
+	assert.Equal(t, 0.1, stepWeight(0, 1))
+	assert.Equal(t, 1.0, stepWeight(0.95, 1))
+	assert.Equal(t, 0.9, stepWeight(1, 0.5))
+
+	WeightInStep.Store(1)
+	defer WeightInStep.Store(0.1)
+	assert.Equal(t, 2.0, stepWeight(0, 2))
+}
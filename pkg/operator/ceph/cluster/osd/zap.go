@@ -0,0 +1,162 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package osd for the Ceph OSDs.
+package osd
+
+import (
+	"fmt"
+
+	rookalpha "github.com/rook/rook/pkg/apis/rook.io/v1alpha2"
+	"github.com/rook/rook/pkg/clusterd"
+	opmon "github.com/rook/rook/pkg/operator/ceph/cluster/mon"
+	"github.com/rook/rook/pkg/operator/k8sutil"
+	batch "k8s.io/api/batch/v1"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/kubernetes/pkg/kubelet/apis"
+)
+
+const (
+	zapAppName    = "rook-ceph-zap"
+	zapAppNameFmt = "rook-ceph-zap-%s"
+)
+
+// ZapSettings are the settings of the jobs that zap the devices of the nodes
+type ZapSettings struct {
+	Image          string
+	ServiceAccount string
+	Placement      rookalpha.Placement
+	OwnerRef       metav1.OwnerReference
+}
+
+// StartZap starts the job that wipes a device of a node, so it can be provisioned again when the cluster is rebuilt
+// without wiping the disks by hand. The device is refused on the node if it is used by an osd of the cluster or if
+// it has a mounted filesystem. A single device of each node is zapped at a time.
+func StartZap(context *clusterd.Context, namespace, nodeName, device string, settings ZapSettings) error {
+	jobs := context.Clientset.Batch().Jobs(namespace)
+	name := k8sutil.TruncateNodeName(zapAppNameFmt, nodeName)
+	existing, err := jobs.Get(name, metav1.GetOptions{})
+	if err == nil {
+		if existing.Status.Active > 0 {
+			return fmt.Errorf("a device of node %s is already being zapped by job %s", nodeName, name)
+		}
+		// replace the job of the previous zap
+		propagation := metav1.DeletePropagationBackground
+		if err := jobs.Delete(name, &metav1.DeleteOptions{PropagationPolicy: &propagation}); err != nil && !errors.IsNotFound(err) {
+			return fmt.Errorf("failed to delete the previous zap job %s. %+v", name, err)
+		}
+	} else if !errors.IsNotFound(err) {
+		return fmt.Errorf("failed to get zap job %s. %+v", name, err)
+	}
+
+	job := makeZapJob(namespace, nodeName, device, settings)
+	k8sutil.SetOwnerRef(context.Clientset, namespace, &job.ObjectMeta, &settings.OwnerRef)
+	if _, err := jobs.Create(job); err != nil {
+		return fmt.Errorf("failed to create zap job %s. %+v", name, err)
+	}
+	logger.Infof("started job %s to zap device %s of node %s", name, device, nodeName)
+	return nil
+}
+
+// ZapComplete returns whether the zap job of the node succeeded, or an error if the device was refused or the zap failed
+func ZapComplete(context *clusterd.Context, namespace, nodeName string) (bool, error) {
+	name := k8sutil.TruncateNodeName(zapAppNameFmt, nodeName)
+	job, err := context.Clientset.Batch().Jobs(namespace).Get(name, metav1.GetOptions{})
+	if err != nil {
+		return false, fmt.Errorf("failed to get zap job %s. %+v", name, err)
+	}
+	if job.Status.Failed > 0 {
+		return false, fmt.Errorf("zap job %s failed. see the log of its pod for the reason", name)
+	}
+	return job.Status.Succeeded > 0, nil
+}
+
+// OSDImage returns the image of the osds of the cluster, which the zap jobs run by default
+func OSDImage(context *clusterd.Context, namespace string) (string, error) {
+	deployments, err := context.Clientset.Extensions().Deployments(namespace).List(metav1.ListOptions{LabelSelector: fmt.Sprintf("%s=%s", k8sutil.AppAttr, appName)})
+	if err != nil {
+		return "", fmt.Errorf("failed to list osd deployments. %+v", err)
+	}
+	for _, d := range deployments.Items {
+		if len(d.Spec.Template.Spec.Containers) > 0 {
+			return d.Spec.Template.Spec.Containers[0].Image, nil
+		}
+	}
+	return "", fmt.Errorf("no osd found in namespace %s", namespace)
+}
+
+func makeZapJob(namespace, nodeName, device string, settings ZapSettings) *batch.Job {
+	backoffLimit := int32(0)
+	deadline := int64(ProvisionTimeout.Get().Seconds())
+	privileged := true
+	labels := map[string]string{
+		k8sutil.AppAttr:     zapAppName,
+		k8sutil.ClusterAttr: namespace,
+	}
+	podSpec := v1.PodSpec{
+		Containers: []v1.Container{
+			{
+				Args:  []string{"ceph", "osd", "zap"},
+				Name:  zapAppName,
+				Image: settings.Image,
+				Env: []v1.EnvVar{
+					nodeNameEnvVar(),
+					opmon.ClusterNameEnvVar(namespace),
+					// the zap checks that no osd that is up uses the device
+					opmon.EndpointEnvVar(),
+					opmon.AdminSecretEnvVar(),
+					k8sutil.ConfigDirEnvVar(k8sutil.DataDir),
+					{Name: "ROOK_DEVICE", Value: device},
+				},
+				VolumeMounts: []v1.VolumeMount{
+					{Name: k8sutil.DataDirVolume, MountPath: k8sutil.DataDir},
+					{Name: "devices", MountPath: "/dev"},
+					{Name: "udev", MountPath: "/run/udev"},
+				},
+				SecurityContext: &v1.SecurityContext{Privileged: &privileged},
+			},
+		},
+		Volumes: []v1.Volume{
+			{Name: k8sutil.DataDirVolume, VolumeSource: v1.VolumeSource{EmptyDir: &v1.EmptyDirVolumeSource{}}},
+			{Name: "devices", VolumeSource: v1.VolumeSource{HostPath: &v1.HostPathVolumeSource{Path: "/dev"}}},
+			{Name: "udev", VolumeSource: v1.VolumeSource{HostPath: &v1.HostPathVolumeSource{Path: "/run/udev"}}},
+		},
+		NodeSelector:       map[string]string{apis.LabelHostname: nodeName},
+		RestartPolicy:      v1.RestartPolicyNever,
+		ServiceAccountName: settings.ServiceAccount,
+		// the mounts of the host are read from its init process so a mounted device is never zapped
+		HostPID: true,
+	}
+	settings.Placement.ApplyToPodSpec(&podSpec)
+
+	return &batch.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      k8sutil.TruncateNodeName(zapAppNameFmt, nodeName),
+			Namespace: namespace,
+			Labels:    labels,
+		},
+		Spec: batch.JobSpec{
+			BackoffLimit:          &backoffLimit,
+			ActiveDeadlineSeconds: &deadline,
+			Template: v1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels},
+				Spec:       podSpec,
+			},
+		},
+	}
+}
@@ -0,0 +1,77 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package osd
+
+import (
+	"testing"
+
+	"github.com/rook/rook/pkg/clusterd"
+	"github.com/stretchr/testify/assert"
+	batch "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/kubernetes/pkg/kubelet/apis"
+)
+
+func TestStartZap(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	context := &clusterd.Context{Clientset: clientset}
+	settings := ZapSettings{Image: "rook/ceph:v0.8.0", ServiceAccount: "rook-ceph-cluster"}
+
+	assert.Nil(t, StartZap(context, "ns", "node1", "sdb", settings))
+	job, err := clientset.Batch().Jobs("ns").Get("rook-ceph-zap-node1", metav1.GetOptions{})
+	assert.Nil(t, err)
+	spec := job.Spec.Template.Spec
+	assert.Equal(t, "node1", spec.NodeSelector[apis.LabelHostname])
+	assert.True(t, spec.HostPID)
+	assert.Equal(t, "rook/ceph:v0.8.0", spec.Containers[0].Image)
+	assert.Equal(t, []string{"ceph", "osd", "zap"}, spec.Containers[0].Args)
+	assert.True(t, *spec.Containers[0].SecurityContext.Privileged)
+	env := map[string]string{}
+	for _, e := range spec.Containers[0].Env {
+		env[e.Name] = e.Value
+	}
+	assert.Equal(t, "sdb", env["ROOK_DEVICE"])
+	assert.Equal(t, "ns", env["ROOK_CLUSTER_NAME"])
+
+	// a single device of the node is zapped at a time
+	job.Status = batch.JobStatus{Active: 1}
+	_, err = clientset.Batch().Jobs("ns").Update(job)
+	assert.Nil(t, err)
+	assert.NotNil(t, StartZap(context, "ns", "node1", "sdc", settings))
+	complete, err := ZapComplete(context, "ns", "node1")
+	assert.Nil(t, err)
+	assert.False(t, complete)
+
+	// the refused or failed zaps are reported
+	job.Status = batch.JobStatus{Failed: 1}
+	_, err = clientset.Batch().Jobs("ns").Update(job)
+	assert.Nil(t, err)
+	_, err = ZapComplete(context, "ns", "node1")
+	assert.NotNil(t, err)
+
+	// the job of a completed zap is replaced
+	job.Status = batch.JobStatus{Succeeded: 1}
+	_, err = clientset.Batch().Jobs("ns").Update(job)
+	assert.Nil(t, err)
+	complete, err = ZapComplete(context, "ns", "node1")
+	assert.Nil(t, err)
+	assert.True(t, complete)
+	assert.Nil(t, StartZap(context, "ns", "node1", "sdc", settings))
+	job, err = clientset.Batch().Jobs("ns").Get("rook-ceph-zap-node1", metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, int32(0), job.Status.Succeeded)
+}
@@ -0,0 +1,102 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cluster
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+
+	cephv1beta1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1beta1"
+	"github.com/rook/rook/pkg/daemon/ceph/client"
+	"github.com/rook/rook/pkg/operator/ceph/settings"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// the rate of the rebalance is measured over about the last ten minutes
+const rebalanceWindow = 10 * time.Minute
+
+// StatusCheckInterval is the interval to sample the placement groups and report the progress of the rebalance and
+// the health of the sites of a stretched cluster
+var StatusCheckInterval = settings.NewDuration(time.Minute)
+
+// watchStatus periodically reports the progress of the rebalance and the health of the sites of a stretched cluster
+// in the status of the cluster
+func (c *cluster) watchStatus() {
+	for {
+		select {
+		case <-c.stopCh:
+			logger.Infof("stopping the status watcher in namespace %s", c.Namespace)
+			return
+
+		case <-time.After(StatusCheckInterval.Get()):
+			if err := c.updateRebalanceStatus(); err != nil {
+				logger.Warningf("failed to update the rebalance progress in namespace %s. %+v", c.Namespace, err)
+			}
+			if c.spec().Stretch.Enabled() {
+				if err := c.updateSiteStatus(); err != nil {
+					logger.Warningf("failed to update the health of the sites in namespace %s. %+v", c.Namespace, err)
+				}
+			}
+		}
+	}
+}
+
+// updateRebalanceStatus samples the placement groups and sets the progress of the rebalance in the status of the
+// cluster. The progress is removed from the status once the cluster is rebalanced.
+func (c *cluster) updateRebalanceStatus() error {
+	status, err := client.Status(c.context, c.Namespace)
+	if err != nil {
+		return err
+	}
+	progress := c.rebalance.Add(time.Now(), status.PgMap)
+	rebalance := rebalanceStatus(progress)
+
+	clusters, err := c.context.RookClientset.CephV1beta1().Clusters(c.Namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list clusters. %+v", err)
+	}
+	for i := range clusters.Items {
+		cluster := &clusters.Items[i]
+		if reflect.DeepEqual(cluster.Status.Rebalance, rebalance) {
+			continue
+		}
+		if rebalance != nil && cluster.Status.Rebalance == nil {
+			logger.Infof("cluster in namespace %s is rebalancing. %s", c.Namespace, progress)
+		}
+		cluster.Status.Rebalance = rebalance
+		if _, err := c.context.RookClientset.CephV1beta1().Clusters(c.Namespace).Update(cluster); err != nil {
+			return fmt.Errorf("failed to update the rebalance progress in the status of cluster %s. %+v", cluster.Name, err)
+		}
+	}
+	return nil
+}
+
+func rebalanceStatus(progress client.RebalanceProgress) *cephv1beta1.RebalanceStatus {
+	if progress.Done() {
+		return nil
+	}
+	status := &cephv1beta1.RebalanceStatus{
+		DegradedObjects:  progress.DegradedObjects,
+		MisplacedObjects: progress.MisplacedObjects,
+		TotalObjects:     progress.TotalObjects,
+		ObjectsPerSec:    fmt.Sprintf("%.1f", progress.ObjectsPerSec),
+	}
+	if progress.TimeLeft > 0 {
+		status.TimeLeft = progress.TimeLeft.String()
+	}
+	return status
+}
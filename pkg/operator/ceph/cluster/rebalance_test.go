@@ -0,0 +1,57 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cluster
+
+import (
+	"fmt"
+	"testing"
+
+	cephv1beta1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1beta1"
+	rookfake "github.com/rook/rook/pkg/client/clientset/versioned/fake"
+	"github.com/rook/rook/pkg/clusterd"
+	"github.com/rook/rook/pkg/daemon/ceph/client"
+	exectest "github.com/rook/rook/pkg/util/exec/test"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestUpdateRebalanceStatus(t *testing.T) {
+	pgmap := `{"pgmap":{"num_pgs":8,"degraded_objects":10,"degraded_total":300,"misplaced_objects":20,"misplaced_total":300}}`
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithOutputFile: func(debug bool, actionName string, command string, outFileArg string, args ...string) (string, error) {
+			if args[0] == "status" {
+				return pgmap, nil
+			}
+			return "", fmt.Errorf("unexpected ceph command '%v'", args)
+		},
+	}
+	rookClientset := rookfake.NewSimpleClientset(&cephv1beta1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "rook-ceph", Namespace: "ns"}})
+	context := &clusterd.Context{Executor: executor, RookClientset: rookClientset}
+	c := &cluster{Namespace: "ns", Spec: &cephv1beta1.ClusterSpec{}, context: context, rebalance: client.NewRebalanceTracker(rebalanceWindow)}
+
+	assert.Nil(t, c.updateRebalanceStatus())
+	cluster, err := rookClientset.CephV1beta1().Clusters("ns").Get("rook-ceph", metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, &cephv1beta1.RebalanceStatus{DegradedObjects: 10, MisplacedObjects: 20, TotalObjects: 300, ObjectsPerSec: "0.0"},
+		cluster.Status.Rebalance)
+
+	// the progress is removed once the cluster is rebalanced
+	pgmap = `{"pgmap":{"num_pgs":8}}`
+	assert.Nil(t, c.updateRebalanceStatus())
+	cluster, err = rookClientset.CephV1beta1().Clusters("ns").Get("rook-ceph", metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.Nil(t, cluster.Status.Rebalance)
+}
@@ -0,0 +1,120 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cluster
+
+import (
+	"fmt"
+	"time"
+
+	cephv1beta1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1beta1"
+	"github.com/rook/rook/pkg/daemon/ceph/client"
+	"github.com/rook/rook/pkg/operator/ceph/settings"
+)
+
+// RecoveryCheckInterval is the interval to apply the recovery profile to the osds, which switches the profile when the
+// business hours start or end and applies it again to the osds that were restarted
+var RecoveryCheckInterval = settings.NewDuration(time.Minute)
+
+// watchRecoveryProfile periodically applies the recovery profile of the current time to the osds
+func (c *cluster) watchRecoveryProfile() {
+	for {
+		select {
+		case <-c.stopCh:
+			logger.Infof("stopping the recovery profile watcher in namespace %s", c.Namespace)
+			return
+
+		case <-time.After(RecoveryCheckInterval.Get()):
+			if err := c.applyRecoveryProfile(); err != nil {
+				logger.Warningf("failed to apply the recovery profile in namespace %s. %+v", c.Namespace, err)
+			}
+		}
+	}
+}
+
+// applyRecoveryProfile applies the settings of the recovery profile to the osds. The low-impact profile is applied
+// during the business hours. The settings are only injected when the profile changes or an osd was restarted since
+// the profile was applied, and no settings are applied if neither a profile nor business hours are set.
+func (c *cluster) applyRecoveryProfile() error {
+	c.recoveryLock.Lock()
+	defer c.recoveryLock.Unlock()
+
+	profile, err := recoveryProfile(c.Spec.Recovery, time.Now())
+	if err != nil {
+		return err
+	}
+	if profile == "" {
+		if c.recoveryProfile != "" {
+			logger.Infof("recovery profile %s removed. the osds keep its settings until they restart", c.recoveryProfile)
+			c.recoveryProfile = ""
+		}
+		return nil
+	}
+
+	// a restarted osd is up from a later epoch and lost the injected settings
+	osdDump, err := client.GetOSDDump(c.context, c.Namespace)
+	if err != nil {
+		return fmt.Errorf("failed to get the osd dump. %+v", err)
+	}
+	upFrom := latestUpFrom(osdDump)
+	if profile == c.recoveryProfile && upFrom <= c.recoveryUpFrom {
+		return nil
+	}
+
+	if err := client.SetRecoveryProfile(c.context, c.Namespace, profile); err != nil {
+		return err
+	}
+	if profile != c.recoveryProfile {
+		logger.Infof("applied recovery profile %s to the osds", profile)
+	}
+	c.recoveryProfile = profile
+	c.recoveryUpFrom = upFrom
+	return nil
+}
+
+// latestUpFrom returns the latest osdmap epoch that an osd is up from
+func latestUpFrom(osdDump *client.OSDDump) int64 {
+	var latest int64
+	for _, d := range osdDump.OSDs {
+		if upFrom, err := d.UpFrom.Int64(); err == nil && upFrom > latest {
+			latest = upFrom
+		}
+	}
+	return latest
+}
+
+// recoveryProfile returns the recovery profile that applies at the given time, or an empty profile if the recovery
+// settings of the osds are left to the user
+func recoveryProfile(spec cephv1beta1.RecoverySpec, now time.Time) (string, error) {
+	if spec.Profile == "" && len(spec.BusinessHours) == 0 {
+		return "", nil
+	}
+	profile := spec.Profile
+	if profile == "" {
+		profile = client.RecoveryProfileBalanced
+	}
+	if _, err := client.RecoveryProfileSettings(profile); err != nil {
+		return "", err
+	}
+
+	businessHours, err := cephv1beta1.WindowOpen(spec.BusinessHours, now)
+	if err != nil {
+		return "", fmt.Errorf("invalid business hours. %+v", err)
+	}
+	if businessHours {
+		return client.RecoveryProfileLowImpact, nil
+	}
+	return profile, nil
+}
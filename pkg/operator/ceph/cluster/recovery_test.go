@@ -0,0 +1,64 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cluster
+
+import (
+	"testing"
+	"time"
+
+	cephv1beta1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1beta1"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecoveryProfile(t *testing.T) {
+	// wednesday
+	now := time.Date(2018, time.August, 8, 10, 0, 0, 0, time.UTC)
+	spec := cephv1beta1.RecoverySpec{}
+
+	// the settings of the osds are left alone without a profile or business hours
+	profile, err := recoveryProfile(spec, now)
+	assert.Nil(t, err)
+	assert.Equal(t, "", profile)
+
+	spec.Profile = "aggressive"
+	profile, err = recoveryProfile(spec, now)
+	assert.Nil(t, err)
+	assert.Equal(t, "aggressive", profile)
+
+	// the low-impact profile is applied during the business hours on weekdays
+	spec.BusinessHours = []cephv1beta1.MaintenanceWindow{{Schedule: "0 8 * * 1-5", Duration: "10h"}}
+	profile, err = recoveryProfile(spec, now)
+	assert.Nil(t, err)
+	assert.Equal(t, "low-impact", profile)
+	profile, err = recoveryProfile(spec, now.Add(9*time.Hour))
+	assert.Nil(t, err)
+	assert.Equal(t, "aggressive", profile)
+
+	// the balanced profile applies outside of the business hours by default
+	spec.Profile = ""
+	profile, err = recoveryProfile(spec, now.Add(9*time.Hour))
+	assert.Nil(t, err)
+	assert.Equal(t, "balanced", profile)
+
+	spec.Profile = "fastest"
+	_, err = recoveryProfile(spec, now)
+	assert.NotNil(t, err)
+
+	spec.Profile = ""
+	spec.BusinessHours = []cephv1beta1.MaintenanceWindow{{Schedule: "0 8 * *", Duration: "10h"}}
+	_, err = recoveryProfile(spec, now)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,293 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cluster
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	cephv1beta1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1beta1"
+	"github.com/rook/rook/pkg/daemon/ceph/client"
+	"github.com/rook/rook/pkg/operator/ceph/settings"
+	"github.com/rook/rook/pkg/operator/k8sutil"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+const (
+	restartConfigMapName = "rook-ceph-restart"
+	restartGenerationKey = "generation"
+	restartConfigHashKey = "config-hash"
+)
+
+var (
+	// RestartCheckInterval is the interval to check whether the daemons need a rolling restart
+	RestartCheckInterval = settings.NewDuration(time.Minute)
+	// RestartHealthTimeout is how long to wait for the cluster to be healthy after a daemon is restarted
+	RestartHealthTimeout = settings.NewDuration(10 * time.Minute)
+
+	restartRetryInterval = 5 * time.Second
+	// the daemons are restarted in the order of their dependencies
+	restartOrder   = []string{"mon", "mgr", "osd", "mds", "rgw"}
+	restartAppName = map[string]string{
+		"mon": "rook-ceph-mon",
+		"mgr": "rook-ceph-mgr",
+		"osd": "rook-ceph-osd",
+		"mds": "rook-ceph-mds",
+		"rgw": "rook-ceph-rgw",
+	}
+)
+
+// watchRestarts periodically restarts the daemons if the config override has changed since they were started, or if
+// a restart was deferred until a maintenance window
+func (c *cluster) watchRestarts() {
+	for {
+		select {
+		case <-c.stopCh:
+			logger.Infof("stopping the restart watcher in namespace %s", c.Namespace)
+			return
+
+		case <-time.After(RestartCheckInterval.Get()):
+			if c.spec().Maintenance.ReadOnly {
+				continue
+			}
+			if err := c.restartDaemons(); err != nil {
+				logger.Warningf("failed to restart the daemons in namespace %s. %+v", c.Namespace, err)
+			}
+		}
+	}
+}
+
+// restartDaemons restarts the daemons one at a time when the restart generation was changed, or when the config
+// override was changed if the restart on config changes is enabled. The mons must be in quorum and the placement
+// groups must be clean before the next daemon is restarted. If the cluster does not become healthy, the restart
+// is attempted again at the next check. A restart outside of the maintenance windows is
+// deferred until a window opens. The restart settings are taken from the spec when the restart starts, so an update
+// of the cluster applies at the next check.
+func (c *cluster) restartDaemons() error {
+	c.restartLock.Lock()
+	defer c.restartLock.Unlock()
+
+	spec := c.spec()
+	daemons, err := restartDaemonTypes(spec.Restart.Daemons)
+	if err != nil {
+		return err
+	}
+
+	state, err := c.context.Clientset.CoreV1().ConfigMaps(c.Namespace).Get(restartConfigMapName, metav1.GetOptions{})
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			return fmt.Errorf("failed to get configmap %s. %+v", restartConfigMapName, err)
+		}
+		state = nil
+	}
+	configHash, err := c.configOverrideHash()
+	if err != nil {
+		return err
+	}
+	generation := strconv.Itoa(spec.Restart.Generation)
+
+	restart := false
+	if state != nil {
+		if stored := state.Data[restartGenerationKey]; stored != generation {
+			logger.Infof("restart generation changed from %s to %s", stored, generation)
+			restart = true
+		}
+		if stored := state.Data[restartConfigHashKey]; spec.Restart.OnConfigChange && stored != configHash {
+			logger.Infof("config override changed since the daemons were restarted")
+			restart = true
+		}
+	} else if spec.Restart.Generation != 0 {
+		restart = true
+	}
+
+	if restart && !c.maintenanceAllows(cephv1beta1.MaintenanceActionRestart) {
+		logger.Infof("deferring the restart of the daemons %v until the next maintenance window", daemons)
+		return nil
+	}
+
+	if restart {
+		for _, daemon := range daemons {
+			if err := c.restartDaemonType(daemon); err != nil {
+				return err
+			}
+		}
+		logger.Infof("done restarting the daemons %v in namespace %s", daemons, c.Namespace)
+	} else if state != nil {
+		// the daemons keep running with the config they loaded at the last restart
+		configHash = state.Data[restartConfigHashKey]
+	}
+
+	return c.saveRestartState(state, generation, configHash)
+}
+
+func (c *cluster) saveRestartState(state *v1.ConfigMap, generation, configHash string) error {
+	data := map[string]string{restartGenerationKey: generation, restartConfigHashKey: configHash}
+	if state == nil {
+		cm := &v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: restartConfigMapName, Namespace: c.Namespace},
+			Data:       data,
+		}
+		k8sutil.SetOwnerRef(c.context.Clientset, c.Namespace, &cm.ObjectMeta, &c.ownerRef)
+		if _, err := c.context.Clientset.CoreV1().ConfigMaps(c.Namespace).Create(cm); err != nil {
+			return fmt.Errorf("failed to create configmap %s. %+v", restartConfigMapName, err)
+		}
+		return nil
+	}
+
+	if state.Data[restartGenerationKey] == generation && state.Data[restartConfigHashKey] == configHash {
+		return nil
+	}
+	state.Data = data
+	if _, err := c.context.Clientset.CoreV1().ConfigMaps(c.Namespace).Update(state); err != nil {
+		return fmt.Errorf("failed to update configmap %s. %+v", restartConfigMapName, err)
+	}
+	return nil
+}
+
+// configOverrideHash returns a hash of the config override, or an empty string if there is no override
+func (c *cluster) configOverrideHash() (string, error) {
+	cm, err := c.context.Clientset.CoreV1().ConfigMaps(c.Namespace).Get(k8sutil.ConfigOverrideName, metav1.GetOptions{})
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to get the config override. %+v", err)
+	}
+	config := cm.Data[k8sutil.ConfigOverrideVal]
+	if config == "" {
+		return "", nil
+	}
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(config))), nil
+}
+
+// restartDaemonType restarts the pods of each deployment of the daemon type by deleting them, and waits for the
+// cluster to be healthy before the next deployment is restarted
+func (c *cluster) restartDaemonType(daemon string) error {
+	listOpts := metav1.ListOptions{LabelSelector: fmt.Sprintf("app=%s", restartAppName[daemon])}
+	deployments, err := c.context.Clientset.Extensions().Deployments(c.Namespace).List(listOpts)
+	if err != nil {
+		return fmt.Errorf("failed to list the %s deployments. %+v", daemon, err)
+	}
+	sort.Slice(deployments.Items, func(i, j int) bool { return deployments.Items[i].Name < deployments.Items[j].Name })
+
+	for _, d := range deployments.Items {
+		logger.Infof("restarting %s", d.Name)
+		selector := labels.SelectorFromSet(d.Spec.Selector.MatchLabels).String()
+		pods, err := c.context.Clientset.CoreV1().Pods(c.Namespace).List(metav1.ListOptions{LabelSelector: selector})
+		if err != nil {
+			return fmt.Errorf("failed to list the pods of %s. %+v", d.Name, err)
+		}
+		restarted := map[string]bool{}
+		for _, pod := range pods.Items {
+			if err := c.context.Clientset.CoreV1().Pods(c.Namespace).Delete(pod.Name, &metav1.DeleteOptions{}); err != nil && !errors.IsNotFound(err) {
+				return fmt.Errorf("failed to delete pod %s. %+v", pod.Name, err)
+			}
+			restarted[pod.Name] = true
+		}
+
+		if err := c.waitForRestart(d.Name, selector, restarted); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// waitForRestart waits until the old pods of the deployment are gone, the new pods are ready, all the mons are in
+// quorum and the placement groups are clean. The wait is interrupted when the cluster is stopped.
+func (c *cluster) waitForRestart(name, selector string, oldPods map[string]bool) error {
+	var lastErr error
+	tracker := client.NewRebalanceTracker(rebalanceWindow)
+	for start := time.Now(); time.Since(start) < RestartHealthTimeout.Get(); {
+		select {
+		case <-c.stopCh:
+			return fmt.Errorf("stopped waiting for %s to restart", name)
+		case <-time.After(restartRetryInterval):
+		}
+		if lastErr = c.restartedPodsReady(name, selector, oldPods); lastErr != nil {
+			logger.Debugf("waiting for %s to restart. %+v", name, lastErr)
+			continue
+		}
+		if lastErr = c.clusterHealthy(); lastErr != nil {
+			logger.Infof("waiting for the cluster to be healthy after restarting %s. %+v", name, lastErr)
+			if status, err := client.Status(c.context, c.Namespace); err == nil {
+				logger.Infof("rebalance progress after restarting %s: %s", name, tracker.Add(time.Now(), status.PgMap))
+			}
+			continue
+		}
+		logger.Infof("restarted %s", name)
+		return nil
+	}
+	return fmt.Errorf("cluster not healthy after restarting %s. %+v", name, lastErr)
+}
+
+func (c *cluster) restartedPodsReady(name, selector string, oldPods map[string]bool) error {
+	d, err := c.context.Clientset.Extensions().Deployments(c.Namespace).Get(name, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get deployment %s. %+v", name, err)
+	}
+	pods, err := c.context.Clientset.CoreV1().Pods(c.Namespace).List(metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return fmt.Errorf("failed to list the pods of %s. %+v", name, err)
+	}
+	for _, pod := range pods.Items {
+		if oldPods[pod.Name] {
+			return fmt.Errorf("pod %s is still running", pod.Name)
+		}
+	}
+	if d.Spec.Replicas != nil && d.Status.ReadyReplicas < *d.Spec.Replicas {
+		return fmt.Errorf("%d of %d pods are ready", d.Status.ReadyReplicas, *d.Spec.Replicas)
+	}
+	return nil
+}
+
+func (c *cluster) clusterHealthy() error {
+	monStatus, err := client.GetMonStatus(c.context, c.Namespace, false)
+	if err != nil {
+		return err
+	}
+	if len(monStatus.Quorum) != len(monStatus.MonMap.Mons) {
+		return fmt.Errorf("%d of %d mons are in quorum", len(monStatus.Quorum), len(monStatus.MonMap.Mons))
+	}
+	return client.IsClusterClean(c.context, c.Namespace)
+}
+
+// restartDaemonTypes returns the daemon types to restart in the order they are restarted
+func restartDaemonTypes(daemons []string) ([]string, error) {
+	if len(daemons) == 0 {
+		return restartOrder, nil
+	}
+	requested := map[string]bool{}
+	for _, daemon := range daemons {
+		if _, ok := restartAppName[daemon]; !ok {
+			return nil, fmt.Errorf("invalid daemon type %s to restart. must be one of %v", daemon, restartOrder)
+		}
+		requested[daemon] = true
+	}
+	var ordered []string
+	for _, daemon := range restartOrder {
+		if requested[daemon] {
+			ordered = append(ordered, daemon)
+		}
+	}
+	return ordered, nil
+}
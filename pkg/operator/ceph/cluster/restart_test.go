@@ -0,0 +1,149 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cluster
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	cephv1beta1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1beta1"
+	"github.com/rook/rook/pkg/clusterd"
+	"github.com/rook/rook/pkg/operator/k8sutil"
+	testop "github.com/rook/rook/pkg/operator/test"
+	exectest "github.com/rook/rook/pkg/util/exec/test"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/api/core/v1"
+	extensions "k8s.io/api/extensions/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func createDaemonObjs(t *testing.T, context *clusterd.Context, app, name string) {
+	replicas := int32(1)
+	labels := map[string]string{"app": app, "daemon": name}
+	d := &extensions.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "ns", Labels: labels},
+		Spec: extensions.DeploymentSpec{
+			Replicas: &replicas,
+			Selector: &metav1.LabelSelector{MatchLabels: labels},
+		},
+		Status: extensions.DeploymentStatus{ReadyReplicas: 1},
+	}
+	_, err := context.Clientset.Extensions().Deployments("ns").Create(d)
+	assert.Nil(t, err)
+	pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: name + "-pod", Namespace: "ns", Labels: labels}}
+	_, err = context.Clientset.CoreV1().Pods("ns").Create(pod)
+	assert.Nil(t, err)
+}
+
+func podExists(context *clusterd.Context, name string) bool {
+	_, err := context.Clientset.CoreV1().Pods("ns").Get(name, metav1.GetOptions{})
+	return err == nil
+}
+
+func TestRestartDaemons(t *testing.T) {
+	restartRetryInterval = time.Millisecond
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithOutputFile: func(debug bool, actionName string, command string, outFileArg string, args ...string) (string, error) {
+			switch args[0] {
+			case "mon_status":
+				return `{"quorum":[0],"monmap":{"mons":[{"name":"a","rank":0}]}}`, nil
+			case "status":
+				return `{"pgmap":{"num_pgs":0}}`, nil
+			}
+			return "", fmt.Errorf("unexpected ceph command '%v'", args)
+		},
+	}
+	context := &clusterd.Context{Executor: executor, Clientset: testop.New(1)}
+	spec := &cephv1beta1.ClusterSpec{}
+	c := &cluster{Namespace: "ns", Spec: spec, context: context}
+	createDaemonObjs(t, context, "rook-ceph-mon", "rook-ceph-mon-a")
+	createDaemonObjs(t, context, "rook-ceph-osd", "rook-ceph-osd-0")
+	override := &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: k8sutil.ConfigOverrideName, Namespace: "ns"},
+		Data:       map[string]string{k8sutil.ConfigOverrideVal: ""},
+	}
+	_, err := context.Clientset.CoreV1().ConfigMaps("ns").Create(override)
+	assert.Nil(t, err)
+
+	// the daemons are not restarted when the cluster is created
+	err = c.restartDaemons()
+	assert.Nil(t, err)
+	assert.True(t, podExists(context, "rook-ceph-mon-a-pod"))
+	state, err := context.Clientset.CoreV1().ConfigMaps("ns").Get(restartConfigMapName, metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, "0", state.Data[restartGenerationKey])
+
+	// only the mons are restarted
+	spec.Restart.Generation = 1
+	spec.Restart.Daemons = []string{"mon"}
+	err = c.restartDaemons()
+	assert.Nil(t, err)
+	assert.False(t, podExists(context, "rook-ceph-mon-a-pod"))
+	assert.True(t, podExists(context, "rook-ceph-osd-0-pod"))
+
+	// a change of the config override is ignored unless enabled
+	override.Data[k8sutil.ConfigOverrideVal] = "[global]\nosd pool default size = 2\n"
+	_, err = context.Clientset.CoreV1().ConfigMaps("ns").Update(override)
+	assert.Nil(t, err)
+	spec.Restart.Daemons = nil
+	err = c.restartDaemons()
+	assert.Nil(t, err)
+	assert.True(t, podExists(context, "rook-ceph-osd-0-pod"))
+
+	spec.Restart.OnConfigChange = true
+	err = c.restartDaemons()
+	assert.Nil(t, err)
+	assert.False(t, podExists(context, "rook-ceph-osd-0-pod"))
+
+	// the restart is not repeated
+	createDaemonObjs(t, context, "rook-ceph-mgr", "rook-ceph-mgr-a")
+	err = c.restartDaemons()
+	assert.Nil(t, err)
+	assert.True(t, podExists(context, "rook-ceph-mgr-a-pod"))
+
+	// the restart is deferred outside of the maintenance windows
+	spec.Maintenance.Windows = []cephv1beta1.MaintenanceWindow{{Schedule: "0 0 1 1 *", Duration: "1m"}}
+	spec.Restart.Generation = 2
+	err = c.restartDaemons()
+	assert.Nil(t, err)
+	assert.True(t, podExists(context, "rook-ceph-mgr-a-pod"))
+	state, err = context.Clientset.CoreV1().ConfigMaps("ns").Get(restartConfigMapName, metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, "1", state.Data[restartGenerationKey])
+
+	spec.Maintenance.Windows = nil
+	spec.Restart.Daemons = []string{"unknown"}
+	err = c.restartDaemons()
+	assert.NotNil(t, err)
+
+	// the wait for a restarted daemon stops with the cluster
+	c.stopCh = make(chan struct{})
+	close(c.stopCh)
+	err = c.waitForRestart("rook-ceph-mgr-a", "app=rook-ceph-mgr", map[string]bool{"rook-ceph-mgr-a-pod": true})
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "stopped")
+}
+
+func TestRestartDaemonTypes(t *testing.T) {
+	daemons, err := restartDaemonTypes(nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"mon", "mgr", "osd", "mds", "rgw"}, daemons)
+
+	daemons, err = restartDaemonTypes([]string{"rgw", "mon"})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"mon", "rgw"}, daemons)
+}
@@ -0,0 +1,280 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package scrub keeps the history of the scrubs of the placement groups and reports the osds with recurring
+// inconsistencies
+package scrub
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/coreos/pkg/capnslog"
+	"github.com/rook/rook/pkg/clusterd"
+	"github.com/rook/rook/pkg/daemon/ceph/client"
+	"github.com/rook/rook/pkg/operator/ceph/settings"
+	"github.com/rook/rook/pkg/operator/k8sutil"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var logger = capnslog.NewPackageLogger("github.com/rook/rook", "op-scrub")
+
+const (
+	// HistoryConfigMapName is the prefix of the config maps where the scrub history is kept, with a config map for the
+	// history of the pgs of each pool named after the pool id
+	HistoryConfigMapName = "rook-ceph-scrub-history"
+	historyAppLabel      = "app"
+	historyPoolLabel     = "pool"
+	osdDeploymentNameFmt = "rook-ceph-osd-%d"
+)
+
+var (
+	// CheckInterval is the interval to look for the pgs that were scrubbed since the last check
+	CheckInterval = settings.NewDuration(10 * time.Minute)
+	// RecurringThreshold is how many scrubs within the RecurringWindow must find errors on an osd to raise an alert for
+	// the osd. No alerts are raised if the threshold is zero.
+	RecurringThreshold = settings.NewInt(2)
+	// RecurringWindow is the time in which the inconsistent scrubs of an osd are counted
+	RecurringWindow = settings.NewDuration(30 * 24 * time.Hour)
+	// the size of the history of a pool above which the history of the pgs without inconsistent scrubs is dropped, so
+	// the config map of a pool with many pgs stays below the 1MiB limit of the config maps
+	maxPoolHistorySize = 768 * 1024
+)
+
+// Monitor periodically adds the results of the scrubs of the pgs to the scrub history
+type Monitor struct {
+	context   *clusterd.Context
+	namespace string
+}
+
+// NewMonitor creates a new scrub monitor for the cluster in the namespace
+func NewMonitor(context *clusterd.Context, namespace string) *Monitor {
+	return &Monitor{context: context, namespace: namespace}
+}
+
+// Start periodically checks the pgs for new scrubs
+func (m *Monitor) Start(stopCh chan struct{}) {
+	for {
+		select {
+		case <-stopCh:
+			logger.Infof("stopping the scrub monitor in namespace %s", m.namespace)
+			return
+
+		case <-time.After(CheckInterval.Get()):
+			if err := m.Check(time.Now()); err != nil {
+				logger.Warningf("failed to check the scrubs in namespace %s. %+v", m.namespace, err)
+			}
+		}
+	}
+}
+
+// Check records the scrubs of the pgs since the last check in the scrub history, and raises an alert for the osds
+// that had errors in a new scrub and in at least the threshold of scrubs within the window
+func (m *Monitor) Check(now time.Time) error {
+	stats, err := client.GetPGScrubStats(m.context, m.namespace)
+	if err != nil {
+		return err
+	}
+	pools, err := client.GetPoolNamesByID(m.context, m.namespace)
+	if err != nil {
+		return err
+	}
+	history, err := m.loadHistory()
+	if err != nil {
+		return err
+	}
+
+	byPool := map[int][]client.PGScrubHistory{}
+	var all []client.PGScrubHistory
+	newErrors := map[int][]string{}
+	for _, s := range stats {
+		id, err := s.PoolID()
+		if err != nil {
+			logger.Warningf("ignoring the scrubs of pg. %+v", err)
+			continue
+		}
+		pool, ok := pools[id]
+		if !ok {
+			continue
+		}
+
+		h := history[s.ID]
+		if h.NewScrub(s) {
+			var objects []client.InconsistentObject
+			if s.Inconsistent() {
+				if objects, err = client.ListInconsistentObjects(m.context, m.namespace, s.ID); err != nil {
+					logger.Warningf("failed to get the inconsistent objects of pg %s. %+v", s.ID, err)
+				}
+			}
+			if result := h.Record(now, s, objects); result != nil {
+				logger.Warningf("scrub of pg %s in pool %s found %d inconsistent objects on osds %v. repair with '%s'",
+					s.ID, pool, result.Objects, result.OSDs, result.Repair)
+				for _, osd := range result.OSDs {
+					newErrors[osd] = append(newErrors[osd], s.ID)
+				}
+			}
+		}
+		byPool[id] = append(byPool[id], h)
+		all = append(all, h)
+	}
+
+	if err := m.saveHistory(pools, byPool); err != nil {
+		return err
+	}
+
+	counts := client.InconsistentScrubsByOSD(all, now.Add(-RecurringWindow.Get()))
+	threshold := RecurringThreshold.Get()
+	for osd, pgs := range newErrors {
+		if threshold > 0 && counts[osd] >= threshold {
+			m.alert(osd, counts[osd], pgs)
+		}
+	}
+	return nil
+}
+
+// alert logs and creates an event on the deployment of the osd whose errors recur, which is a sign of failing media
+func (m *Monitor) alert(osd, count int, pgs []string) {
+	sort.Strings(pgs)
+	message := fmt.Sprintf("scrubs found errors on osd.%d %d times in %s, most recently in pgs %s. the media of the osd may be failing",
+		osd, count, RecurringWindow.Get(), strings.Join(pgs, ","))
+	logger.Error(message)
+
+	name := fmt.Sprintf(osdDeploymentNameFmt, osd)
+	d, err := m.context.Clientset.Extensions().Deployments(m.namespace).Get(name, metav1.GetOptions{})
+	if err != nil {
+		logger.Warningf("failed to get deployment %s for the scrub error event. %+v", name, err)
+		return
+	}
+	now := metav1.Now()
+	event := &v1.Event{
+		ObjectMeta:     metav1.ObjectMeta{Name: fmt.Sprintf("%s.%x", name, now.UnixNano()), Namespace: m.namespace},
+		InvolvedObject: v1.ObjectReference{Kind: "Deployment", Namespace: m.namespace, Name: name, UID: d.UID},
+		Reason:         "RecurringScrubErrors",
+		Message:        message,
+		Type:           v1.EventTypeWarning,
+		Source:         v1.EventSource{Component: "rook-ceph-operator"},
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+		Count:          1,
+	}
+	if _, err := m.context.Clientset.CoreV1().Events(m.namespace).Create(event); err != nil {
+		logger.Warningf("failed to create the scrub error event of osd.%d. %+v", osd, err)
+	}
+}
+
+// HistoryConfigMapNameForPool returns the name of the config map with the scrub history of the pool
+func HistoryConfigMapNameForPool(poolID int) string {
+	return fmt.Sprintf("%s-%d", HistoryConfigMapName, poolID)
+}
+
+// loadHistory returns the scrub history of the pgs by pg id
+func (m *Monitor) loadHistory() (map[string]client.PGScrubHistory, error) {
+	history := map[string]client.PGScrubHistory{}
+	configMaps, err := m.listHistory()
+	if err != nil {
+		return nil, err
+	}
+	for _, cm := range configMaps {
+		for pool, data := range cm.Data {
+			var pgs []client.PGScrubHistory
+			if err := json.Unmarshal([]byte(data), &pgs); err != nil {
+				logger.Warningf("ignoring the invalid scrub history of pool %s. %+v", pool, err)
+				continue
+			}
+			for _, h := range pgs {
+				history[h.PG] = h
+			}
+		}
+	}
+	return history, nil
+}
+
+// listHistory returns the config maps of the scrub history of the pools
+func (m *Monitor) listHistory() ([]v1.ConfigMap, error) {
+	opts := metav1.ListOptions{LabelSelector: fmt.Sprintf("%s=%s", historyAppLabel, HistoryConfigMapName)}
+	list, err := m.context.Clientset.CoreV1().ConfigMaps(m.namespace).List(opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the scrub history configmaps. %+v", err)
+	}
+	return list.Items, nil
+}
+
+// saveHistory replaces the scrub history of each pool with the history of its current pgs, and deletes the history of
+// the deleted pools
+func (m *Monitor) saveHistory(pools map[int]string, byPool map[int][]client.PGScrubHistory) error {
+	for id, pgs := range byPool {
+		if err := m.savePoolHistory(id, pools[id], pgs); err != nil {
+			return err
+		}
+	}
+
+	configMaps, err := m.listHistory()
+	if err != nil {
+		return err
+	}
+	for _, cm := range configMaps {
+		id, err := strconv.Atoi(cm.Labels[historyPoolLabel])
+		if err != nil {
+			logger.Warningf("ignoring scrub history configmap %s without a pool id. %+v", cm.Name, err)
+			continue
+		}
+		if _, ok := byPool[id]; ok {
+			continue
+		}
+		logger.Infof("deleting the scrub history of deleted pool %d", id)
+		err = m.context.Clientset.CoreV1().ConfigMaps(m.namespace).Delete(cm.Name, &metav1.DeleteOptions{})
+		if err != nil && !errors.IsNotFound(err) {
+			return fmt.Errorf("failed to delete configmap %s. %+v", cm.Name, err)
+		}
+	}
+	return nil
+}
+
+// savePoolHistory replaces the scrub history of the pool. If the history is too large for a config map, only the pgs
+// with inconsistent scrubs are kept.
+func (m *Monitor) savePoolHistory(id int, pool string, pgs []client.PGScrubHistory) error {
+	sort.Slice(pgs, func(i, j int) bool { return pgs[i].PG < pgs[j].PG })
+	d, err := json.Marshal(pgs)
+	if err != nil {
+		return fmt.Errorf("failed to marshal the scrub history of pool %s. %+v", pool, err)
+	}
+	if len(d) > maxPoolHistorySize {
+		var inconsistent []client.PGScrubHistory
+		for _, h := range pgs {
+			if len(h.Inconsistent) > 0 {
+				inconsistent = append(inconsistent, h)
+			}
+		}
+		logger.Warningf("the scrub history of pool %s is too large with %d pgs. keeping the %d pgs with inconsistent scrubs",
+			pool, len(pgs), len(inconsistent))
+		if d, err = json.Marshal(inconsistent); err != nil {
+			return fmt.Errorf("failed to marshal the scrub history of pool %s. %+v", pool, err)
+		}
+	}
+
+	name := HistoryConfigMapNameForPool(id)
+	data := map[string]string{pool: string(d)}
+	return k8sutil.ModifyConfigMap(m.context.Clientset, m.namespace, name, nil, func(cm *v1.ConfigMap) {
+		cm.Labels = map[string]string{historyAppLabel: HistoryConfigMapName, historyPoolLabel: strconv.Itoa(id)}
+		cm.Data = data
+	})
+}
@@ -0,0 +1,152 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scrub
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/rook/rook/pkg/clusterd"
+	"github.com/rook/rook/pkg/daemon/ceph/client"
+	exectest "github.com/rook/rook/pkg/util/exec/test"
+	"github.com/stretchr/testify/assert"
+	extensions "k8s.io/api/extensions/v1beta1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestScrubHistory(t *testing.T) {
+	pgs := `[{"pgid":"1.0","state":"active+clean","last_scrub_stamp":"s1","last_deep_scrub_stamp":"d1"},
+		{"pgid":"1.1","state":"active+clean","last_scrub_stamp":"s1","last_deep_scrub_stamp":"d1"}]`
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithOutputFile: func(debug bool, actionName string, command string, outFileArg string, args ...string) (string, error) {
+			switch {
+			case args[0] == "pg" && args[1] == "dump":
+				return pgs, nil
+			case args[0] == "osd" && args[1] == "lspools":
+				return `[{"poolnum":1,"poolname":"replicapool"}]`, nil
+			}
+			return "", fmt.Errorf("unexpected ceph command '%v'", args)
+		},
+		MockExecuteCommandWithOutput: func(debug bool, actionName string, command string, args ...string) (string, error) {
+			if command == client.RadosTool && args[0] == "list-inconsistent-obj" {
+				return `{"inconsistents":[{"object":{"name":"obj1"},"errors":[],"union_shard_errors":["read_error"],
+					"shards":[{"osd":0,"errors":[]},{"osd":2,"errors":["read_error"]}]}]}`, nil
+			}
+			return "", fmt.Errorf("unexpected command %s '%v'", command, args)
+		},
+	}
+	d := &extensions.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "rook-ceph-osd-2", Namespace: "ns"}}
+	clientset := fake.NewSimpleClientset(d)
+	m := NewMonitor(&clusterd.Context{Executor: executor, Clientset: clientset}, "ns")
+	now := time.Now()
+
+	// the first scrubs of the pgs start the history
+	assert.Nil(t, m.Check(now))
+	history := loadPool(t, clientset, "replicapool")
+	assert.Equal(t, 2, len(history))
+	assert.Equal(t, "1.0", history[0].PG)
+	assert.Equal(t, 1, history[0].Scrubs)
+
+	// an inconsistent scrub is kept with the osds that had errors
+	pgs = `[{"pgid":"1.0","state":"active+clean+inconsistent","last_scrub_stamp":"s2","last_deep_scrub_stamp":"d2"},
+		{"pgid":"1.1","state":"active+clean","last_scrub_stamp":"s1","last_deep_scrub_stamp":"d1"}]`
+	assert.Nil(t, m.Check(now.Add(time.Hour)))
+	history = loadPool(t, clientset, "replicapool")
+	assert.Equal(t, 2, history[0].Scrubs)
+	assert.Equal(t, 1, history[1].Scrubs)
+	assert.Equal(t, 1, len(history[0].Inconsistent))
+	assert.Equal(t, []int{2}, history[0].Inconsistent[0].OSDs)
+	assert.Equal(t, "ceph pg repair 1.0", history[0].Inconsistent[0].Repair)
+	events, err := clientset.CoreV1().Events("ns").List(metav1.ListOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(events.Items))
+
+	// an alert is raised when the errors recur on the osd
+	pgs = `[{"pgid":"1.0","state":"active+clean","last_scrub_stamp":"s3","last_deep_scrub_stamp":"d2"},
+		{"pgid":"1.1","state":"active+clean+inconsistent","last_scrub_stamp":"s2","last_deep_scrub_stamp":"d2"}]`
+	assert.Nil(t, m.Check(now.Add(2*time.Hour)))
+	events, err = clientset.CoreV1().Events("ns").List(metav1.ListOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(events.Items))
+	assert.Equal(t, "RecurringScrubErrors", events.Items[0].Reason)
+	assert.Equal(t, "rook-ceph-osd-2", events.Items[0].InvolvedObject.Name)
+
+	// no new alert without a new inconsistent scrub
+	assert.Nil(t, m.Check(now.Add(3*time.Hour)))
+	events, err = clientset.CoreV1().Events("ns").List(metav1.ListOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(events.Items))
+
+	// only the pgs with inconsistent scrubs are kept when the history of a pool is too large
+	maxPoolHistorySize = 100
+	defer func() { maxPoolHistorySize = 768 * 1024 }()
+	assert.Nil(t, m.Check(now.Add(4*time.Hour)))
+	history = loadPool(t, clientset, "replicapool")
+	assert.Equal(t, 2, len(history))
+	pgs = `[{"pgid":"1.0","state":"active+clean","last_scrub_stamp":"s3","last_deep_scrub_stamp":"d2"},
+		{"pgid":"1.1","state":"active+clean","last_scrub_stamp":"s2","last_deep_scrub_stamp":"d2"},
+		{"pgid":"1.2","state":"active+clean","last_scrub_stamp":"s1","last_deep_scrub_stamp":"d1"}]`
+	assert.Nil(t, m.Check(now.Add(5*time.Hour)))
+	history = loadPool(t, clientset, "replicapool")
+	assert.Equal(t, 2, len(history))
+	assert.Equal(t, "1.0", history[0].PG)
+	assert.Equal(t, "1.1", history[1].PG)
+}
+
+func TestScrubHistoryDeletedPool(t *testing.T) {
+	pools := `[{"poolnum":1,"poolname":"replicapool"},{"poolnum":2,"poolname":"ecpool"}]`
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithOutputFile: func(debug bool, actionName string, command string, outFileArg string, args ...string) (string, error) {
+			switch {
+			case args[0] == "pg" && args[1] == "dump":
+				return `[{"pgid":"1.0","state":"active+clean","last_scrub_stamp":"s1","last_deep_scrub_stamp":"d1"},
+					{"pgid":"2.0","state":"active+clean","last_scrub_stamp":"s1","last_deep_scrub_stamp":"d1"}]`, nil
+			case args[0] == "osd" && args[1] == "lspools":
+				return pools, nil
+			}
+			return "", fmt.Errorf("unexpected ceph command '%v'", args)
+		},
+	}
+	clientset := fake.NewSimpleClientset()
+	m := NewMonitor(&clusterd.Context{Executor: executor, Clientset: clientset}, "ns")
+
+	// each pool has its own history
+	assert.Nil(t, m.Check(time.Now()))
+	assert.Equal(t, 1, len(loadPool(t, clientset, "replicapool")))
+	cm, err := clientset.CoreV1().ConfigMaps("ns").Get(HistoryConfigMapNameForPool(2), metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.NotEmpty(t, cm.Data["ecpool"])
+
+	// the history of a deleted pool is deleted
+	pools = `[{"poolnum":1,"poolname":"replicapool"}]`
+	assert.Nil(t, m.Check(time.Now()))
+	assert.Equal(t, 1, len(loadPool(t, clientset, "replicapool")))
+	_, err = clientset.CoreV1().ConfigMaps("ns").Get(HistoryConfigMapNameForPool(2), metav1.GetOptions{})
+	assert.True(t, errors.IsNotFound(err))
+}
+
+func loadPool(t *testing.T, clientset *fake.Clientset, pool string) []client.PGScrubHistory {
+	cm, err := clientset.CoreV1().ConfigMaps("ns").Get(HistoryConfigMapNameForPool(1), metav1.GetOptions{})
+	assert.Nil(t, err)
+	var history []client.PGScrubHistory
+	assert.Nil(t, json.Unmarshal([]byte(cm.Data[pool]), &history))
+	return history
+}
@@ -0,0 +1,132 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cluster
+
+import (
+	"fmt"
+
+	"github.com/rook/rook/pkg/daemon/ceph/client"
+)
+
+const (
+	encryptionNone    = ""
+	encryptionPrefer  = "prefer"
+	encryptionRequire = "require"
+)
+
+var (
+	signatureOptions = []string{"cephx_require_signatures", "cephx_cluster_require_signatures", "cephx_service_require_signatures"}
+	// the modes of the connections between daemons, from clients to daemons, and from the daemons to other daemons
+	connectionModeOptions = []string{"ms_cluster_mode", "ms_service_mode", "ms_client_mode"}
+	// the connection mode for each encryption stage in the order of the rollout
+	encryptionStages = []string{encryptionNone, encryptionPrefer, encryptionRequire}
+	encryptionModes  = map[string]string{encryptionPrefer: "secure crc", encryptionRequire: "secure"}
+)
+
+// configureConnectionSecurity applies the signature and encryption settings of the cluster to the config database of
+// the mons where all daemons and clients load them from. The encryption is changed by a single stage at each
+// orchestration, so the daemons that still use the previous mode can connect to the daemons that use the new mode.
+func (c *cluster) configureConnectionSecurity() error {
+	target := stageIndex(c.Spec.Security.Encryption)
+	if target < 0 {
+		return fmt.Errorf("invalid encryption %s. must be empty, %s or %s", c.Spec.Security.Encryption, encryptionPrefer, encryptionRequire)
+	}
+
+	features, err := client.DetectFeatures(c.context, c.Namespace)
+	if err != nil {
+		// the daemons do not report their versions for a short time while the quorum of the mons changes, the
+		// orchestration is retried until the settings are applied
+		return fmt.Errorf("failed to detect the ceph features. %+v", err)
+	}
+	if !features.ConfigDatabase {
+		if !c.Spec.Security.RequireSignatures && target == 0 {
+			// the mons of older ceph versions do not have the config database, so there is nothing to reset
+			logger.Debugf("skipping the connection security that is not supported by ceph %s", features.Version)
+			return nil
+		}
+		return fmt.Errorf("the connection security requires ceph %s or newer, but the cluster runs ceph %s", client.Mimic, features.Version)
+	}
+
+	// the signatures are supported by all the releases with the config database
+	for _, option := range signatureOptions {
+		if err := c.setConfig(option, c.Spec.Security.RequireSignatures, "true"); err != nil {
+			return err
+		}
+	}
+
+	if !features.ConnectionModes {
+		if target == 0 {
+			return nil
+		}
+		return fmt.Errorf("the encryption of the connections requires ceph %s or newer, but the cluster runs ceph %s", client.Nautilus, features.Version)
+	}
+
+	mode, err := client.GetConfig(c.context, c.Namespace, "mon", connectionModeOptions[0])
+	if err != nil {
+		return fmt.Errorf("failed to get the connection mode. %+v", err)
+	}
+	current := encryptionStage(mode)
+
+	next := target
+	if target > current+1 {
+		next = current + 1
+	} else if target < current-1 {
+		next = current - 1
+	}
+	if next != target {
+		logger.Warningf("changing the encryption from %q to %q. the encryption %q will be applied the next time the cluster is orchestrated, after the daemons have been restarted",
+			encryptionStages[current], encryptionStages[next], encryptionStages[target])
+	}
+	if next == current {
+		return nil
+	}
+
+	logger.Infof("changing the encryption of the connections from %q to %q", encryptionStages[current], encryptionStages[next])
+	for _, option := range connectionModeOptions {
+		if err := c.setConfig(option, next != 0, encryptionModes[encryptionStages[next]]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setConfig sets the option for all daemons and clients if it is enabled, otherwise the option is reset to the default
+func (c *cluster) setConfig(option string, enabled bool, value string) error {
+	if enabled {
+		return client.SetConfig(c.context, c.Namespace, "global", option, value)
+	}
+	return client.RemoveConfig(c.context, c.Namespace, "global", option)
+}
+
+func stageIndex(encryption string) int {
+	for i, stage := range encryptionStages {
+		if stage == encryption {
+			return i
+		}
+	}
+	return -1
+}
+
+// encryptionStage returns the stage of the connection mode. Other modes than the ones set by rook are stage none.
+func encryptionStage(mode string) int {
+	for stage, stageMode := range encryptionModes {
+		if stageMode == mode {
+			return stageIndex(stage)
+		}
+	}
+	return 0
+}
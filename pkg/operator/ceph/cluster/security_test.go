@@ -0,0 +1,126 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cluster
+
+import (
+	"fmt"
+	"testing"
+
+	cephv1beta1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1beta1"
+	"github.com/rook/rook/pkg/clusterd"
+	exectest "github.com/rook/rook/pkg/util/exec/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfigureConnectionSecurity(t *testing.T) {
+	config := map[string]string{}
+	version := "14.2.1"
+	versionsErr := error(nil)
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithOutputFile: func(debug bool, actionName string, command string, outFileArg string, args ...string) (string, error) {
+			if args[0] == "versions" {
+				if versionsErr != nil {
+					return "", versionsErr
+				}
+				return fmt.Sprintf(`{"overall":{"ceph version %s (abcdef) release (stable)":3}}`, version), nil
+			}
+			if args[0] != "config" {
+				return "", fmt.Errorf("unexpected ceph command '%v'", args)
+			}
+			switch args[1] {
+			case "get":
+				if mode, ok := config[args[3]]; ok {
+					return mode + "\n", nil
+				}
+				return "crc secure\n", nil
+			case "set":
+				assert.Equal(t, "global", args[2])
+				config[args[3]] = args[4]
+			case "rm":
+				delete(config, args[3])
+			}
+			return "", nil
+		},
+	}
+	spec := &cephv1beta1.ClusterSpec{}
+	c := &cluster{Namespace: "ns", Spec: spec, context: &clusterd.Context{Executor: executor}}
+
+	// nothing is set by default
+	err := c.configureConnectionSecurity()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(config))
+
+	// the encryption is required after it was preferred
+	spec.Security.RequireSignatures = true
+	spec.Security.Encryption = "require"
+	err = c.configureConnectionSecurity()
+	assert.Nil(t, err)
+	assert.Equal(t, "true", config["cephx_require_signatures"])
+	assert.Equal(t, "secure crc", config["ms_cluster_mode"])
+	assert.Equal(t, "secure crc", config["ms_client_mode"])
+	err = c.configureConnectionSecurity()
+	assert.Nil(t, err)
+	assert.Equal(t, "secure", config["ms_cluster_mode"])
+	assert.Equal(t, "secure", config["ms_service_mode"])
+
+	// the settings are reset in stages too
+	spec.Security.RequireSignatures = false
+	spec.Security.Encryption = ""
+	err = c.configureConnectionSecurity()
+	assert.Nil(t, err)
+	assert.Equal(t, "secure crc", config["ms_cluster_mode"])
+	_, ok := config["cephx_require_signatures"]
+	assert.False(t, ok)
+	err = c.configureConnectionSecurity()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(config))
+
+	// the orchestration fails to be retried if the versions are not reported
+	versionsErr = fmt.Errorf("mon quorum changing")
+	spec.Security.RequireSignatures = true
+	err = c.configureConnectionSecurity()
+	assert.NotNil(t, err)
+	assert.Equal(t, 0, len(config))
+	versionsErr = nil
+	spec.Security.RequireSignatures = false
+
+	spec.Security.Encryption = "always"
+	err = c.configureConnectionSecurity()
+	assert.NotNil(t, err)
+
+	// the signatures require ceph mimic and the encryption requires ceph nautilus
+	version = "13.2.1"
+	spec.Security.Encryption = ""
+	err = c.configureConnectionSecurity()
+	assert.Nil(t, err)
+	spec.Security.RequireSignatures = true
+	err = c.configureConnectionSecurity()
+	assert.Nil(t, err)
+	assert.Equal(t, "true", config["cephx_require_signatures"])
+	_, ok = config["ms_cluster_mode"]
+	assert.False(t, ok)
+	spec.Security.Encryption = "prefer"
+	err = c.configureConnectionSecurity()
+	assert.NotNil(t, err)
+
+	version = "12.2.7"
+	spec.Security.Encryption = ""
+	err = c.configureConnectionSecurity()
+	assert.NotNil(t, err)
+	spec.Security.RequireSignatures = false
+	err = c.configureConnectionSecurity()
+	assert.Nil(t, err)
+}
@@ -0,0 +1,161 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cluster
+
+import (
+	"fmt"
+	"reflect"
+
+	cephv1beta1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1beta1"
+	"github.com/rook/rook/pkg/daemon/ceph/client"
+	"github.com/rook/rook/pkg/operator/k8sutil"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/kubernetes/pkg/kubelet/apis"
+)
+
+// updateSiteStatus sets the mons in quorum and the osds that are up in each site of a stretched cluster in the status
+// of the cluster
+func (c *cluster) updateSiteStatus() error {
+	stretch := c.Spec.Stretch
+	names := append(append([]string{}, stretch.Sites...), stretch.Tiebreaker)
+	sites := map[string]*cephv1beta1.SiteStatus{}
+	for _, name := range names {
+		sites[name] = &cephv1beta1.SiteStatus{Name: name}
+	}
+
+	// the mons are in the site of the node they are assigned to
+	nodes, err := c.context.Clientset.CoreV1().Nodes().List(metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list the nodes. %+v", err)
+	}
+	hostSites := map[string]string{}
+	for _, n := range nodes.Items {
+		hostSites[n.Labels[apis.LabelHostname]] = n.Labels[stretch.GetSiteLabel()]
+	}
+	monStatus, err := client.GetMonStatus(c.context, c.Namespace, false)
+	if err != nil {
+		return err
+	}
+	inQuorum := map[string]bool{}
+	for _, m := range monStatus.MonMap.Mons {
+		for _, rank := range monStatus.Quorum {
+			if m.Rank == rank {
+				inQuorum[m.Name] = true
+			}
+		}
+	}
+	pods, err := c.context.Clientset.CoreV1().Pods(c.Namespace).List(metav1.ListOptions{LabelSelector: fmt.Sprintf("%s=%s", k8sutil.AppAttr, restartAppName["mon"])})
+	if err != nil {
+		return fmt.Errorf("failed to list the mon pods. %+v", err)
+	}
+	for _, pod := range pods.Items {
+		site, ok := sites[hostSites[pod.Spec.NodeSelector[apis.LabelHostname]]]
+		if !ok {
+			continue
+		}
+		site.Mons++
+		if inQuorum[pod.Labels["mon"]] {
+			site.MonsInQuorum++
+		}
+	}
+
+	// the osds are in the site of the datacenter they are under in the crush map
+	crush, err := client.GetCrushMap(c.context, c.Namespace)
+	if err != nil {
+		return err
+	}
+	dump, err := client.GetOSDDump(c.context, c.Namespace)
+	if err != nil {
+		return err
+	}
+	up := map[int]bool{}
+	for _, osd := range dump.OSDs {
+		id, err := osd.OSD.Int64()
+		if err != nil {
+			continue
+		}
+		if u, _ := osd.Up.Int64(); u == 1 {
+			up[int(id)] = true
+		}
+	}
+	for name, ids := range osdsBySite(crush) {
+		site, ok := sites[name]
+		if !ok {
+			continue
+		}
+		for _, id := range ids {
+			site.OSDs++
+			if up[id] {
+				site.OSDsUp++
+			}
+		}
+	}
+
+	status := []cephv1beta1.SiteStatus{}
+	for _, name := range names {
+		status = append(status, *sites[name])
+	}
+
+	clusters, err := c.context.RookClientset.CephV1beta1().Clusters(c.Namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list clusters. %+v", err)
+	}
+	for i := range clusters.Items {
+		cluster := &clusters.Items[i]
+		if reflect.DeepEqual(cluster.Status.Sites, status) {
+			continue
+		}
+		for _, s := range status {
+			if (s.Mons > 0 && s.MonsInQuorum == 0) || (s.OSDs > 0 && s.OSDsUp == 0) {
+				logger.Warningf("site %s of the cluster in namespace %s is down. %d/%d mons in quorum, %d/%d osds up",
+					s.Name, c.Namespace, s.MonsInQuorum, s.Mons, s.OSDsUp, s.OSDs)
+			}
+		}
+		cluster.Status.Sites = status
+		if _, err := c.context.RookClientset.CephV1beta1().Clusters(c.Namespace).Update(cluster); err != nil {
+			return fmt.Errorf("failed to update the sites in the status of cluster %s. %+v", cluster.Name, err)
+		}
+	}
+	return nil
+}
+
+// osdsBySite returns the osds under each datacenter bucket of the crush map
+func osdsBySite(crush client.CrushMap) map[string][]int {
+	buckets := map[int]int{}
+	for i, b := range crush.Buckets {
+		buckets[b.ID] = i
+	}
+	var osds func(index int) []int
+	osds = func(index int) []int {
+		ids := []int{}
+		for _, item := range crush.Buckets[index].Items {
+			if item.ID >= 0 {
+				ids = append(ids, item.ID)
+			} else if child, ok := buckets[item.ID]; ok {
+				ids = append(ids, osds(child)...)
+			}
+		}
+		return ids
+	}
+
+	sites := map[string][]int{}
+	for i, b := range crush.Buckets {
+		if b.TypeName == cephv1beta1.SiteCrushType {
+			sites[b.Name] = osds(i)
+		}
+	}
+	return sites
+}
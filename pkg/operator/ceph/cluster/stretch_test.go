@@ -0,0 +1,76 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cluster
+
+import (
+	"fmt"
+	"testing"
+
+	cephv1beta1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1beta1"
+	rookfake "github.com/rook/rook/pkg/client/clientset/versioned/fake"
+	"github.com/rook/rook/pkg/clusterd"
+	exectest "github.com/rook/rook/pkg/util/exec/test"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/kubernetes/pkg/kubelet/apis"
+)
+
+func TestUpdateSiteStatus(t *testing.T) {
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithOutputFile: func(debug bool, actionName string, command string, outFileArg string, args ...string) (string, error) {
+			switch {
+			case args[0] == "mon_status":
+				return `{"quorum":[0,2],"monmap":{"mons":[{"name":"a","rank":0},{"name":"b","rank":1},{"name":"c","rank":2}]}}`, nil
+			case args[0] == "osd" && args[1] == "crush" && args[2] == "dump":
+				return `{"buckets":[
+					{"id":-1,"name":"default","type_name":"root","items":[{"id":-2},{"id":-3}]},
+					{"id":-2,"name":"dc1","type_name":"datacenter","items":[{"id":-4}]},
+					{"id":-3,"name":"dc2","type_name":"datacenter","items":[{"id":-5}]},
+					{"id":-4,"name":"node1","type_name":"host","items":[{"id":0},{"id":1}]},
+					{"id":-5,"name":"node2","type_name":"host","items":[{"id":2},{"id":3}]}]}`, nil
+			case args[0] == "osd" && args[1] == "dump":
+				return `{"osds":[{"osd":0,"up":1,"in":1},{"osd":1,"up":1,"in":1},{"osd":2,"up":0,"in":1},{"osd":3,"up":0,"in":1}]}`, nil
+			}
+			return "", fmt.Errorf("unexpected ceph command '%v'", args)
+		},
+	}
+	clientset := fake.NewSimpleClientset()
+	for i, site := range []string{"dc1", "dc2", "dc3"} {
+		node := fmt.Sprintf("node%d", i+1)
+		clientset.CoreV1().Nodes().Create(&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: node,
+			Labels: map[string]string{apis.LabelHostname: node, cephv1beta1.DefaultSiteLabel: site}}})
+		mon := fmt.Sprintf("%c", 'a'+i)
+		clientset.CoreV1().Pods("ns").Create(&v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "rook-ceph-mon-" + mon, Namespace: "ns", Labels: map[string]string{"app": "rook-ceph-mon", "mon": mon}},
+			Spec:       v1.PodSpec{NodeSelector: map[string]string{apis.LabelHostname: node}},
+		})
+	}
+	rookClientset := rookfake.NewSimpleClientset(&cephv1beta1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "rook-ceph", Namespace: "ns"}})
+	context := &clusterd.Context{Executor: executor, Clientset: clientset, RookClientset: rookClientset}
+	spec := &cephv1beta1.ClusterSpec{Stretch: cephv1beta1.StretchSpec{Sites: []string{"dc1", "dc2"}, Tiebreaker: "dc3"}}
+	c := &cluster{Namespace: "ns", Spec: spec, context: context}
+
+	assert.Nil(t, c.updateSiteStatus())
+	cluster, err := rookClientset.CephV1beta1().Clusters("ns").Get("rook-ceph", metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, []cephv1beta1.SiteStatus{
+		{Name: "dc1", MonsInQuorum: 1, Mons: 1, OSDsUp: 2, OSDs: 2},
+		{Name: "dc2", MonsInQuorum: 0, Mons: 1, OSDsUp: 0, OSDs: 2},
+		{Name: "dc3", MonsInQuorum: 1, Mons: 1},
+	}, cluster.Status.Sites)
+}
@@ -21,6 +21,7 @@ import (
 	"fmt"
 	"reflect"
 
+	"github.com/rook/rook/pkg/operator/ceph/maintenance"
 	"github.com/rook/rook/pkg/operator/ceph/pool"
 
 	"github.com/coreos/pkg/capnslog"
@@ -67,6 +68,7 @@ type FilesystemController struct {
 	rookImage   string
 	hostNetwork bool
 	ownerRef    metav1.OwnerReference
+	changes     *maintenance.ChangeQueue
 }
 
 // NewFilesystemController create controller for watching file system custom resources created
@@ -76,6 +78,7 @@ func NewFilesystemController(context *clusterd.Context, rookImage string, hostNe
 		rookImage:   rookImage,
 		hostNetwork: hostNetwork,
 		ownerRef:    ownerRef,
+		changes:     maintenance.NewChangeQueue(context),
 	}
 }
 
@@ -112,10 +115,12 @@ func (c *FilesystemController) onAdd(obj interface{}) {
 		return
 	}
 
-	err = CreateFilesystem(c.context, *filesystem, c.rookImage, c.hostNetwork, c.filesystemOwners(filesystem))
-	if err != nil {
-		logger.Errorf("failed to create file system %s. %+v", filesystem.Name, err)
-	}
+	c.changes.Apply(filesystem.Namespace, func() {
+		err := CreateFilesystem(c.context, *filesystem, c.rookImage, c.hostNetwork, false, c.filesystemOwners(filesystem))
+		if err != nil {
+			logger.Errorf("failed to create file system %s. %+v", filesystem.Name, err)
+		}
+	})
 }
 
 func (c *FilesystemController) onUpdate(oldObj, newObj interface{}) {
@@ -143,11 +148,13 @@ func (c *FilesystemController) onUpdate(oldObj, newObj interface{}) {
 	}
 
 	// if the file system is modified, allow the file system to be created if it wasn't already
-	logger.Infof("updating filesystem %s", newFS)
-	err = CreateFilesystem(c.context, *newFS, c.rookImage, c.hostNetwork, c.filesystemOwners(newFS))
-	if err != nil {
-		logger.Errorf("failed to create (modify) file system %s. %+v", newFS.Name, err)
-	}
+	c.changes.Apply(newFS.Namespace, func() {
+		logger.Infof("updating filesystem %s", newFS)
+		err := CreateFilesystem(c.context, *newFS, c.rookImage, c.hostNetwork, true, c.filesystemOwners(newFS))
+		if err != nil {
+			logger.Errorf("failed to create (modify) file system %s. %+v", newFS.Name, err)
+		}
+	})
 }
 
 func (c *FilesystemController) onDelete(obj interface{}) {
@@ -162,10 +169,12 @@ func (c *FilesystemController) onDelete(obj interface{}) {
 		return
 	}
 
-	err = DeleteFilesystem(c.context, *filesystem)
-	if err != nil {
-		logger.Errorf("failed to delete file system %s. %+v", filesystem.Name, err)
-	}
+	c.changes.Apply(filesystem.Namespace, func() {
+		err := DeleteFilesystem(c.context, *filesystem)
+		if err != nil {
+			logger.Errorf("failed to delete file system %s. %+v", filesystem.Name, err)
+		}
+	})
 }
 
 func (c *FilesystemController) filesystemOwners(fs *cephv1beta1.Filesystem) []metav1.OwnerReference {
@@ -190,6 +199,19 @@ func filesystemChanged(oldFS, newFS cephv1beta1.FilesystemSpec) bool {
 		logger.Infof("mds active standby changed from %t to %t", oldFS.MetadataServer.ActiveStandby, newFS.MetadataServer.ActiveStandby)
 		return true
 	}
+	if oldFS.MetadataServer.CacheMemoryLimitMB != newFS.MetadataServer.CacheMemoryLimitMB {
+		logger.Infof("mds cache memory limit changed from %dMB to %dMB", oldFS.MetadataServer.CacheMemoryLimitMB, newFS.MetadataServer.CacheMemoryLimitMB)
+		return true
+	}
+	if oldFS.MetadataServer.SessionTimeout != newFS.MetadataServer.SessionTimeout ||
+		oldFS.MetadataServer.SessionAutoclose != newFS.MetadataServer.SessionAutoclose {
+		logger.Infof("mds session timeouts changed")
+		return true
+	}
+	if !reflect.DeepEqual(oldFS.AllowSnapshots, newFS.AllowSnapshots) {
+		logger.Infof("allow snapshots changed")
+		return true
+	}
 	return false
 }
 
@@ -46,6 +46,12 @@ func TestFilesystemChanged(t *testing.T) {
 
 	new = cephv1beta1.FilesystemSpec{MetadataServer: cephv1beta1.MetadataServerSpec{ActiveCount: 1, ActiveStandby: false}}
 	assert.True(t, filesystemChanged(old, new))
+
+	allow := true
+	new = cephv1beta1.FilesystemSpec{MetadataServer: cephv1beta1.MetadataServerSpec{ActiveCount: 1, ActiveStandby: true}, AllowSnapshots: &allow}
+	assert.True(t, filesystemChanged(old, new))
+	old.AllowSnapshots = &allow
+	assert.False(t, filesystemChanged(old, new))
 }
 
 func TestGetFilesystemObject(t *testing.T) {
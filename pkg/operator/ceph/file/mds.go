@@ -31,6 +31,7 @@ import (
 	"github.com/rook/rook/pkg/operator/k8sutil"
 	"k8s.io/api/core/v1"
 	extensions "k8s.io/api/extensions/v1beta1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
@@ -40,11 +41,16 @@ const (
 	AppName = "rook-ceph-mds"
 )
 
-// Create the file system
-func CreateFilesystem(context *clusterd.Context, fs cephv1beta1.Filesystem, version string, hostNetwork bool, ownerRefs []metav1.OwnerReference) error {
+// Create the file system. If updating, the mds pods are restarted with the new settings if the deployment exists and
+// its spec changed. The settings of the file system, such as the session timeouts, are applied without a restart.
+func CreateFilesystem(context *clusterd.Context, fs cephv1beta1.Filesystem, version string, hostNetwork, update bool, ownerRefs []metav1.OwnerReference) error {
 	if err := validateFilesystem(context, fs); err != nil {
 		return err
 	}
+	pool.WarnPoolTopology(context, fs.Namespace, fs.Name+"-metadata", &fs.Spec.MetadataPool)
+	for i := range fs.Spec.DataPools {
+		pool.WarnPoolTopology(context, fs.Namespace, fmt.Sprintf("%s-data%d", fs.Name, i), &fs.Spec.DataPools[i])
+	}
 
 	var dataPools []*model.Pool
 	for _, p := range fs.Spec.DataPools {
@@ -59,6 +65,15 @@ func CreateFilesystem(context *clusterd.Context, fs cephv1beta1.Filesystem, vers
 	if err != nil {
 		return fmt.Errorf("failed to get file system %s. %+v", fs.Name, err)
 	}
+	if fs.Spec.AllowSnapshots != nil {
+		// the snapshots that were allowed by hand are left alone unless the setting is in the spec
+		if err := client.SetFilesystemSnapshots(context, fs.Namespace, fs.Name, *fs.Spec.AllowSnapshots); err != nil {
+			return err
+		}
+	}
+	if err := setSessionProperties(context, fs); err != nil {
+		return err
+	}
 
 	logger.Infof("start running mds for file system %s", fs.Name)
 
@@ -69,7 +84,23 @@ func CreateFilesystem(context *clusterd.Context, fs cephv1beta1.Filesystem, vers
 		if !errors.IsAlreadyExists(err) {
 			return fmt.Errorf("failed to create mds deployment. %+v", err)
 		}
-		logger.Infof("mds deployment %s already exists", deployment.Name)
+		if !update {
+			logger.Infof("mds deployment %s already exists", deployment.Name)
+			return nil
+		}
+		existing, err := context.Clientset.ExtensionsV1beta1().Deployments(fs.Namespace).Get(deployment.Name, metav1.GetOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to get mds deployment. %+v", err)
+		}
+		// the fields that rook does not set are defaulted by kubernetes in the existing deployment and are ignored
+		if equality.Semantic.DeepDerivative(deployment.Spec, existing.Spec) {
+			logger.Infof("mds deployment %s did not change. not restarting the mds pods", deployment.Name)
+			return nil
+		}
+		// the standbys take over while the mds pods are restarted with the new settings
+		if err := k8sutil.UpdateDeploymentAndWait(context, deployment, fs.Namespace); err != nil {
+			return fmt.Errorf("failed to update mds deployment. %+v", err)
+		}
 	} else {
 		logger.Infof("mds deployment %s started", deployment.Name)
 	}
@@ -77,6 +108,23 @@ func CreateFilesystem(context *clusterd.Context, fs cephv1beta1.Filesystem, vers
 	return nil
 }
 
+// setSessionProperties sets the session timeouts of the file system, which apply to the running mds immediately
+func setSessionProperties(context *clusterd.Context, fs cephv1beta1.Filesystem) error {
+	properties := map[string]int{
+		"session_timeout":   fs.Spec.MetadataServer.SessionTimeout,
+		"session_autoclose": fs.Spec.MetadataServer.SessionAutoclose,
+	}
+	for _, name := range []string{"session_timeout", "session_autoclose"} {
+		if properties[name] == 0 {
+			continue
+		}
+		if err := client.SetFilesystemProperty(context, fs.Namespace, fs.Name, name, strconv.Itoa(properties[name])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // Delete the file system
 func DeleteFilesystem(context *clusterd.Context, fs cephv1beta1.Filesystem) error {
 	// Delete the mds deployment
@@ -159,6 +207,7 @@ func mdsContainer(fs cephv1beta1.Filesystem, filesystemID, version string) v1.Co
 			{Name: "ROOK_POD_NAME", ValueFrom: &v1.EnvVarSource{FieldRef: &v1.ObjectFieldSelector{FieldPath: "metadata.name"}}},
 			{Name: "ROOK_FILESYSTEM_ID", Value: filesystemID},
 			{Name: "ROOK_ACTIVE_STANDBY", Value: strconv.FormatBool(fs.Spec.MetadataServer.ActiveStandby)},
+			{Name: "ROOK_CACHE_MEMORY_LIMIT_MB", Value: strconv.Itoa(fs.Spec.MetadataServer.CacheMemoryLimitMB)},
 			opmon.ClusterNameEnvVar(fs.Namespace),
 			opmon.EndpointEnvVar(),
 			opmon.AdminSecretEnvVar(),
@@ -199,6 +248,20 @@ func validateFilesystem(context *clusterd.Context, f cephv1beta1.Filesystem) err
 	if f.Spec.MetadataServer.ActiveCount < 1 {
 		return fmt.Errorf("MetadataServer.ActiveCount must be at least 1")
 	}
+	spec := f.Spec.MetadataServer
+	if spec.CacheMemoryLimitMB < 0 || spec.SessionTimeout < 0 || spec.SessionAutoclose < 0 {
+		return fmt.Errorf("the cache memory limit and session timeouts of the mds cannot be negative")
+	}
+	if spec.SessionTimeout > 0 && spec.SessionAutoclose > 0 && spec.SessionAutoclose < spec.SessionTimeout {
+		return fmt.Errorf("session autoclose %ds cannot be less than the session timeout %ds", spec.SessionAutoclose, spec.SessionTimeout)
+	}
+	if memory, ok := spec.Resources.Limits[v1.ResourceMemory]; ok && spec.CacheMemoryLimitMB > 0 {
+		// the mds may use up to 50% more memory than its cache limit
+		if int64(spec.CacheMemoryLimitMB)*1024*1024*3/2 > memory.Value() {
+			logger.Warningf("the mds of file system %s may exceed their memory limit %s with a cache memory limit of %dMB",
+				f.Name, memory.String(), spec.CacheMemoryLimitMB)
+		}
+	}
 
 	return nil
 }
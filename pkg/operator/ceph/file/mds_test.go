@@ -39,8 +39,12 @@ func TestStartMDS(t *testing.T) {
 	// Output to check multiple file system creation
 	fses := `[{"name":"myfs","metadata_pool":"myfs-metadata","metadata_pool_id":1,"data_pool_ids":[2],"data_pools":["myfs-data0"]}]`
 
+	var fsSet []string
 	executor := &exectest.MockExecutor{
 		MockExecuteCommandWithOutputFile: func(debug bool, actionName string, command string, outFileArg string, args ...string) (string, error) {
+			if args[0] == "fs" && args[1] == "set" {
+				fsSet = append(fsSet, args[3]+"="+args[4])
+			}
 			return "{\"key\":\"mysecurekey\"}", nil
 		},
 		MockExecuteCommandWithOutput: func(debug bool, actionName string, command string, args ...string) (string, error) {
@@ -78,15 +82,22 @@ func TestStartMDS(t *testing.T) {
 	//defer os.RemoveAll(c.dataDir)
 
 	// start a basic cluster
-	err := CreateFilesystem(context, fs, "v0.1", false, []metav1.OwnerReference{})
+	err := CreateFilesystem(context, fs, "v0.1", false, false, []metav1.OwnerReference{})
 	assert.Nil(t, err)
 	validateStart(t, context, fs)
 
 	// starting again should be a no-op
-	err = CreateFilesystem(context, fs, "v0.1", false, []metav1.OwnerReference{})
+	err = CreateFilesystem(context, fs, "v0.1", false, false, []metav1.OwnerReference{})
 	assert.Nil(t, err)
 	validateStart(t, context, fs)
 
+	// the session timeouts are set on the file system without updating the deployment
+	fs.Spec.MetadataServer.SessionTimeout = 120
+	err = CreateFilesystem(context, fs, "v0.1", false, true, []metav1.OwnerReference{})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"session_timeout=120"}, fsSet)
+	validateStart(t, context, fs)
+
 	// Test multiple filesystem creation
 	executor = &exectest.MockExecutor{
 		MockExecuteCommandWithOutputFile: func(debug bool, actionName string, command string, outFileArg string, args ...string) (string, error) {
@@ -102,7 +113,7 @@ func TestStartMDS(t *testing.T) {
 		Clientset: testop.New(3)}
 
 	//Create another filesystem which should fail
-	err = CreateFilesystem(context, fs, "v0.1", false, []metav1.OwnerReference{})
+	err = CreateFilesystem(context, fs, "v0.1", false, false, []metav1.OwnerReference{})
 	assert.Equal(t, "failed to create file system myfs: Cannot create multiple filesystems. Enable ROOK_ALLOW_MULTIPLE_FILESYSTEMS env variable to create more than one", err.Error())
 }
 
@@ -127,7 +138,8 @@ func TestPodSpecs(t *testing.T) {
 		ObjectMeta: metav1.ObjectMeta{Name: "myfs", Namespace: "ns"},
 		Spec: cephv1beta1.FilesystemSpec{
 			MetadataServer: cephv1beta1.MetadataServerSpec{
-				ActiveCount: 1,
+				ActiveCount:        1,
+				CacheMemoryLimitMB: 2048,
 				Resources: v1.ResourceRequirements{
 					Limits: v1.ResourceList{
 						v1.ResourceCPU: *resource.NewQuantity(100.0, resource.BinarySI),
@@ -161,6 +173,7 @@ func TestPodSpecs(t *testing.T) {
 	assert.Equal(t, "ceph", cont.Args[0])
 	assert.Equal(t, "mds", cont.Args[1])
 	assert.Equal(t, "--config-dir=/var/lib/rook", cont.Args[2])
+	assert.Contains(t, cont.Env, v1.EnvVar{Name: "ROOK_CACHE_MEMORY_LIMIT_MB", Value: "2048"})
 
 	assert.Equal(t, "100", cont.Resources.Limits.Cpu().String())
 	assert.Equal(t, "1337", cont.Resources.Requests.Memory().String())
@@ -208,4 +221,15 @@ func TestValidateSpec(t *testing.T) {
 
 	// valid!
 	assert.Nil(t, validateFilesystem(context, fs))
+
+	// session timeouts
+	fs.Spec.MetadataServer.SessionTimeout = 60
+	fs.Spec.MetadataServer.SessionAutoclose = 30
+	assert.NotNil(t, validateFilesystem(context, fs))
+	fs.Spec.MetadataServer.SessionAutoclose = 300
+	assert.Nil(t, validateFilesystem(context, fs))
+
+	// negative cache limit
+	fs.Spec.MetadataServer.CacheMemoryLimitMB = -1
+	assert.NotNil(t, validateFilesystem(context, fs))
 }
@@ -0,0 +1,155 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package maintenance holds off the changes to the resources of the clusters while the clusters are read-only.
+package maintenance
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/coreos/pkg/capnslog"
+	cephv1beta1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1beta1"
+	"github.com/rook/rook/pkg/clusterd"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var logger = capnslog.NewPackageLogger("github.com/rook/rook", "op-maintenance")
+
+const clusterUpdatingReason = "the cluster is being updated"
+
+var readOnlyCheckInterval = 15 * time.Second
+
+// WritableTimeout is how long a change waits for an update of the cluster to complete. A cluster that is still updating
+// after the timeout is assumed to have a stale status, and the change is applied. The changes deferred by the
+// maintenance of the cluster wait until the maintenance ends.
+var WritableTimeout = time.Hour
+
+// ChangeQueue defers the changes to the resources of the clusters while the clusters are read-only, so that the event
+// handlers of the resources are not blocked. The changes of a namespace are applied in the order they were queued.
+type ChangeQueue struct {
+	context *clusterd.Context
+	lock    sync.Mutex
+	pending map[string][]deferredChange
+}
+
+type deferredChange struct {
+	queued time.Time
+	apply  func()
+}
+
+// NewChangeQueue creates a new queue for the changes to the resources of the clusters
+func NewChangeQueue(context *clusterd.Context) *ChangeQueue {
+	return &ChangeQueue{context: context, pending: map[string][]deferredChange{}}
+}
+
+// Apply applies the change right away if the cluster in the namespace is writable and no earlier change is deferred.
+// Otherwise the change is queued and applied in the background once the cluster is writable.
+func (q *ChangeQueue) Apply(namespace string, apply func()) {
+	q.lock.Lock()
+	if len(q.pending[namespace]) == 0 {
+		reason, err := readOnlyReason(q.context, namespace)
+		if err != nil {
+			logger.Warningf("failed to check whether cluster %s is read-only. %+v", namespace, err)
+		}
+		if err != nil || reason == "" {
+			q.lock.Unlock()
+			apply()
+			return
+		}
+		logger.Infof("deferring changes in namespace %s while the cluster is read-only: %s", namespace, reason)
+		go q.applyDeferred(namespace)
+	}
+	q.pending[namespace] = append(q.pending[namespace], deferredChange{queued: time.Now(), apply: apply})
+	q.lock.Unlock()
+}
+
+// applyDeferred applies the queued changes of the namespace in order as soon as the cluster is writable
+func (q *ChangeQueue) applyDeferred(namespace string) {
+	for {
+		q.lock.Lock()
+		change := q.pending[namespace][0]
+		q.lock.Unlock()
+
+		waitForWritableCluster(q.context, namespace, change.queued)
+		change.apply()
+
+		q.lock.Lock()
+		q.pending[namespace] = q.pending[namespace][1:]
+		if len(q.pending[namespace]) == 0 {
+			delete(q.pending, namespace)
+			q.lock.Unlock()
+			return
+		}
+		q.lock.Unlock()
+	}
+}
+
+// WaitForWritableCluster holds off a change to a resource of the cluster while the cluster is read-only. The cluster
+// is read-only while it is in maintenance and while the operator is updating it, for at most the WritableTimeout.
+// The event handlers queue their changes in a ChangeQueue instead of waiting.
+func WaitForWritableCluster(context *clusterd.Context, namespace string) {
+	waitForWritableCluster(context, namespace, time.Now())
+}
+
+func waitForWritableCluster(context *clusterd.Context, namespace string, since time.Time) {
+	deferred := false
+	for {
+		reason, err := readOnlyReason(context, namespace)
+		if err != nil {
+			logger.Warningf("failed to check whether cluster %s is read-only. %+v", namespace, err)
+			return
+		}
+		if reason == "" {
+			if deferred {
+				logger.Infof("cluster %s is writable, applying the deferred change", namespace)
+			}
+			return
+		}
+		if reason == clusterUpdatingReason && time.Since(since) > WritableTimeout {
+			logger.Warningf("cluster %s is still updating after %s. applying the deferred change", namespace, WritableTimeout)
+			return
+		}
+
+		if !deferred {
+			logger.Infof("deferring change in namespace %s while the cluster is read-only: %s", namespace, reason)
+			deferred = true
+		}
+		<-time.After(readOnlyCheckInterval)
+	}
+}
+
+// readOnlyReason returns why the cluster in the namespace is read-only, or an empty string if it can be changed
+func readOnlyReason(context *clusterd.Context, namespace string) (string, error) {
+	clusters, err := context.RookClientset.CephV1beta1().Clusters(namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to list clusters. %+v", err)
+	}
+
+	for _, cluster := range clusters.Items {
+		if cluster.Spec.Maintenance.ReadOnly {
+			if cluster.Spec.Maintenance.Reason == "" {
+				return "maintenance", nil
+			}
+			return fmt.Sprintf("maintenance (%s)", cluster.Spec.Maintenance.Reason), nil
+		}
+		if cluster.Status.State == cephv1beta1.ClusterStateUpdating {
+			return clusterUpdatingReason, nil
+		}
+	}
+	return "", nil
+}
@@ -0,0 +1,132 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package maintenance
+
+import (
+	"testing"
+	"time"
+
+	cephv1beta1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1beta1"
+	rookfake "github.com/rook/rook/pkg/client/clientset/versioned/fake"
+	"github.com/rook/rook/pkg/clusterd"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestWaitForWritableCluster(t *testing.T) {
+	readOnlyCheckInterval = time.Millisecond
+	cluster := &cephv1beta1.Cluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "rook-ceph", Namespace: "ns"},
+		Spec: cephv1beta1.ClusterSpec{
+			Maintenance: cephv1beta1.MaintenanceSpec{ReadOnly: true, Reason: "upgrading kernels"},
+		},
+	}
+	context := &clusterd.Context{RookClientset: rookfake.NewSimpleClientset(cluster)}
+
+	reason, err := readOnlyReason(context, "ns")
+	assert.Nil(t, err)
+	assert.Equal(t, "maintenance (upgrading kernels)", reason)
+
+	// a cluster that is being updated is read-only
+	cluster.Spec.Maintenance.ReadOnly = false
+	cluster.Status.State = cephv1beta1.ClusterStateUpdating
+	_, err = context.RookClientset.CephV1beta1().Clusters("ns").Update(cluster)
+	assert.Nil(t, err)
+	reason, err = readOnlyReason(context, "ns")
+	assert.Nil(t, err)
+	assert.Equal(t, "the cluster is being updated", reason)
+
+	// the change is held off until the cluster is writable
+	done := make(chan struct{})
+	go func() {
+		WaitForWritableCluster(context, "ns")
+		close(done)
+	}()
+	select {
+	case <-done:
+		assert.Fail(t, "change was not deferred")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	cluster.Status.State = cephv1beta1.ClusterStateCreated
+	_, err = context.RookClientset.CephV1beta1().Clusters("ns").Update(cluster)
+	assert.Nil(t, err)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		assert.Fail(t, "change was not applied after the cluster became writable")
+	}
+
+	// other namespaces are not affected
+	reason, err = readOnlyReason(context, "other")
+	assert.Nil(t, err)
+	assert.Equal(t, "", reason)
+}
+
+func TestChangeQueue(t *testing.T) {
+	readOnlyCheckInterval = time.Millisecond
+	cluster := &cephv1beta1.Cluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "rook-ceph", Namespace: "ns"},
+	}
+	context := &clusterd.Context{RookClientset: rookfake.NewSimpleClientset(cluster)}
+	q := NewChangeQueue(context)
+
+	// the changes are applied right away while the cluster is writable
+	applied := make(chan int, 10)
+	q.Apply("ns", func() { applied <- 0 })
+	assert.Equal(t, 0, <-applied)
+
+	// the changes are queued without blocking while the cluster is in maintenance
+	cluster.Spec.Maintenance.ReadOnly = true
+	_, err := context.RookClientset.CephV1beta1().Clusters("ns").Update(cluster)
+	assert.Nil(t, err)
+	for i := 1; i <= 3; i++ {
+		change := i
+		q.Apply("ns", func() { applied <- change })
+	}
+	select {
+	case <-applied:
+		assert.Fail(t, "change was not deferred")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	// the queued changes are applied in order once the cluster is writable
+	cluster.Spec.Maintenance.ReadOnly = false
+	_, err = context.RookClientset.CephV1beta1().Clusters("ns").Update(cluster)
+	assert.Nil(t, err)
+	for i := 1; i <= 3; i++ {
+		select {
+		case change := <-applied:
+			assert.Equal(t, i, change)
+		case <-time.After(5 * time.Second):
+			assert.Fail(t, "change was not applied after the cluster became writable")
+		}
+	}
+
+	// a cluster that is stuck updating does not hold the changes after the timeout
+	WritableTimeout = 10 * time.Millisecond
+	defer func() { WritableTimeout = time.Hour }()
+	cluster.Status.State = cephv1beta1.ClusterStateUpdating
+	_, err = context.RookClientset.CephV1beta1().Clusters("ns").Update(cluster)
+	assert.Nil(t, err)
+	q.Apply("ns", func() { applied <- 4 })
+	select {
+	case change := <-applied:
+		assert.Equal(t, 4, change)
+	case <-time.After(5 * time.Second):
+		assert.Fail(t, "change was not applied after the timeout")
+	}
+}
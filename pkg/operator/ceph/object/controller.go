@@ -27,6 +27,7 @@ import (
 	rookv1alpha1 "github.com/rook/rook/pkg/apis/rook.io/v1alpha1"
 	rookv1alpha2 "github.com/rook/rook/pkg/apis/rook.io/v1alpha2"
 	"github.com/rook/rook/pkg/clusterd"
+	"github.com/rook/rook/pkg/operator/ceph/maintenance"
 	"github.com/rook/rook/pkg/operator/ceph/pool"
 	apiextensionsv1beta1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
 	"k8s.io/apimachinery/pkg/api/errors"
@@ -66,6 +67,7 @@ type ObjectStoreController struct {
 	rookImage   string
 	hostNetwork bool
 	ownerRef    metav1.OwnerReference
+	changes     *maintenance.ChangeQueue
 }
 
 // NewObjectStoreController create controller for watching object store custom resources created
@@ -75,6 +77,7 @@ func NewObjectStoreController(context *clusterd.Context, rookImage string, hostN
 		rookImage:   rookImage,
 		hostNetwork: hostNetwork,
 		ownerRef:    ownerRef,
+		changes:     maintenance.NewChangeQueue(context),
 	}
 }
 
@@ -111,9 +114,11 @@ func (c *ObjectStoreController) onAdd(obj interface{}) {
 		return
 	}
 
-	if err = CreateStore(c.context, *objectstore, c.rookImage, c.hostNetwork, c.storeOwners(objectstore)); err != nil {
-		logger.Errorf("failed to create object store %s. %+v", objectstore.Name, err)
-	}
+	c.changes.Apply(objectstore.Namespace, func() {
+		if err := CreateStore(c.context, *objectstore, c.rookImage, c.hostNetwork, c.storeOwners(objectstore)); err != nil {
+			logger.Errorf("failed to create object store %s. %+v", objectstore.Name, err)
+		}
+	})
 }
 
 func (c *ObjectStoreController) onUpdate(oldObj, newObj interface{}) {
@@ -141,10 +146,12 @@ func (c *ObjectStoreController) onUpdate(oldObj, newObj interface{}) {
 		return
 	}
 
-	logger.Infof("applying object store %s changes", newStore.Name)
-	if err = UpdateStore(c.context, *newStore, c.rookImage, c.hostNetwork, c.storeOwners(newStore)); err != nil {
-		logger.Errorf("failed to create (modify) object store %s. %+v", newStore.Name, err)
-	}
+	c.changes.Apply(newStore.Namespace, func() {
+		logger.Infof("applying object store %s changes", newStore.Name)
+		if err := UpdateStore(c.context, *newStore, c.rookImage, c.hostNetwork, c.storeOwners(newStore)); err != nil {
+			logger.Errorf("failed to create (modify) object store %s. %+v", newStore.Name, err)
+		}
+	})
 }
 
 func (c *ObjectStoreController) onDelete(obj interface{}) {
@@ -159,9 +166,11 @@ func (c *ObjectStoreController) onDelete(obj interface{}) {
 		return
 	}
 
-	if err = DeleteStore(c.context, *objectstore); err != nil {
-		logger.Errorf("failed to delete object store %s. %+v", objectstore.Name, err)
-	}
+	c.changes.Apply(objectstore.Namespace, func() {
+		if err := DeleteStore(c.context, *objectstore); err != nil {
+			logger.Errorf("failed to delete object store %s. %+v", objectstore.Name, err)
+		}
+	})
 }
 
 func (c *ObjectStoreController) storeOwners(store *cephv1beta1.ObjectStore) []metav1.OwnerReference {
@@ -201,6 +210,18 @@ func storeChanged(oldStore, newStore cephv1beta1.ObjectStoreSpec) bool {
 		logger.Infof("SSLCertificateRef changed from %s to %s", oldStore.Gateway.SSLCertificateRef, newStore.Gateway.SSLCertificateRef)
 		return true
 	}
+	if oldStore.Gateway.DNSName != newStore.Gateway.DNSName {
+		logger.Infof("DNSName changed from %s to %s", oldStore.Gateway.DNSName, newStore.Gateway.DNSName)
+		return true
+	}
+	if oldStore.Gateway.StaticWebsite != newStore.Gateway.StaticWebsite {
+		logger.Infof("StaticWebsite changed from %t to %t", oldStore.Gateway.StaticWebsite, newStore.Gateway.StaticWebsite)
+		return true
+	}
+	if oldStore.Gateway.WebsiteDNSName != newStore.Gateway.WebsiteDNSName {
+		logger.Infof("WebsiteDNSName changed from %s to %s", oldStore.Gateway.WebsiteDNSName, newStore.Gateway.WebsiteDNSName)
+		return true
+	}
 	return false
 }
 
@@ -20,6 +20,7 @@ package object
 import (
 	"fmt"
 	"path"
+	"strings"
 
 	cephv1beta1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1beta1"
 	"github.com/rook/rook/pkg/clusterd"
@@ -42,6 +43,9 @@ const (
 	certMountPath  = "/etc/rook/private"
 	certKeyName    = "cert"
 	certFilename   = "rgw-cert.pem"
+	// the certificate and key of a kubernetes tls secret, which the rgw combines in a pem file
+	tlsCertFilename = "rgw-tls.crt"
+	tlsKeyFilename  = "rgw-tls.key"
 )
 
 // Start the rgw manager
@@ -58,6 +62,8 @@ func createOrUpdate(context *clusterd.Context, store cephv1beta1.ObjectStore, ve
 	if err := validateStore(context, store); err != nil {
 		return fmt.Errorf("invalid object store %s arguments. %+v", store.Name, err)
 	}
+	pool.WarnPoolTopology(context, store.Namespace, store.Name+" metadata", &store.Spec.MetadataPool)
+	pool.WarnPoolTopology(context, store.Namespace, store.Name+" data", &store.Spec.DataPool)
 
 	// check if the object store already exists
 	exists, err := storeExists(context, store)
@@ -271,9 +277,16 @@ func makeRGWPodSpec(store cephv1beta1.ObjectStore, version string, hostNetwork b
 
 	// Set the ssl cert if specified
 	if store.Spec.Gateway.SSLCertificateRef != "" {
+		// the keys are optional since the secret has either the pem file or the key and certificate of a tls secret
+		optional := true
 		certVol := v1.Volume{Name: certVolumeName, VolumeSource: v1.VolumeSource{Secret: &v1.SecretVolumeSource{
 			SecretName: store.Spec.Gateway.SSLCertificateRef,
-			Items:      []v1.KeyToPath{{Key: certKeyName, Path: certFilename}},
+			Items: []v1.KeyToPath{
+				{Key: certKeyName, Path: certFilename},
+				{Key: v1.TLSCertKey, Path: tlsCertFilename},
+				{Key: v1.TLSPrivateKeyKey, Path: tlsKeyFilename},
+			},
+			Optional: &optional,
 		}}}
 		podSpec.Volumes = append(podSpec.Volumes, certVol)
 	}
@@ -358,9 +371,21 @@ func rgwContainer(store cephv1beta1.ObjectStore, version string) v1.Container {
 		mount := v1.VolumeMount{Name: certVolumeName, MountPath: certMountPath, ReadOnly: true}
 		container.VolumeMounts = append(container.VolumeMounts, mount)
 
-		// Pass the flag for using the ssl cert
-		path := path.Join(certMountPath, certFilename)
-		container.Args = append(container.Args, fmt.Sprintf("--rgw-cert=%s", path))
+		// Pass the flag for using the ssl cert, or the cert and key of a tls secret if the cert is not found
+		container.Args = append(container.Args,
+			fmt.Sprintf("--rgw-cert=%s", path.Join(certMountPath, certFilename)),
+			fmt.Sprintf("--rgw-tls-cert=%s", path.Join(certMountPath, tlsCertFilename)),
+			fmt.Sprintf("--rgw-tls-key=%s", path.Join(certMountPath, tlsKeyFilename)))
+	}
+
+	if store.Spec.Gateway.StaticWebsite {
+		container.Args = append(container.Args, "--rgw-static-website")
+		if store.Spec.Gateway.WebsiteDNSName != "" {
+			container.Args = append(container.Args, fmt.Sprintf("--rgw-website-dns-name=%s", store.Spec.Gateway.WebsiteDNSName))
+		}
+	}
+	if store.Spec.Gateway.DNSName != "" {
+		container.Args = append(container.Args, fmt.Sprintf("--rgw-dns-name=%s", store.Spec.Gateway.DNSName))
 	}
 
 	return container
@@ -384,7 +409,9 @@ func startService(context *clusterd.Context, store cephv1beta1.ObjectStore, host
 	}
 
 	addPort(svc, "http", store.Spec.Gateway.Port)
-	addPort(svc, "https", store.Spec.Gateway.SecurePort)
+	if store.Spec.Gateway.SSLCertificateRef != "" {
+		addPort(svc, "https", store.Spec.Gateway.SecurePort)
+	}
 
 	svc, err := context.Clientset.CoreV1().Services(store.Namespace).Create(svc)
 	if err != nil {
@@ -447,6 +474,14 @@ func validateStore(context *clusterd.Context, s cephv1beta1.ObjectStore) error {
 	if err := pool.ValidatePoolSpec(context, s.Namespace, &s.Spec.DataPool); err != nil {
 		return fmt.Errorf("invalid data pool spec. %+v", err)
 	}
+	if s.Spec.Gateway.SecurePort != 0 && s.Spec.Gateway.SSLCertificateRef == "" {
+		// the stores created before the certificate was required are still accepted. rgw only listens on the secure port
+		// with a certificate, and the port is not added to the service without it.
+		logger.Warningf("the secure port %d of object store %s is not served without an ssl certificate", s.Spec.Gateway.SecurePort, s.Name)
+	}
+	if strings.ContainsAny(s.Spec.Gateway.DNSName, "/: ") {
+		return fmt.Errorf("invalid dns name %q", s.Spec.Gateway.DNSName)
+	}
 
 	return nil
 }
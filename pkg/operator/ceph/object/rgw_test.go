@@ -151,9 +151,25 @@ func TestSSLPodSpec(t *testing.T) {
 	assert.Equal(t, certVolumeName, cont.VolumeMounts[2].Name)
 	assert.Equal(t, certMountPath, cont.VolumeMounts[2].MountPath)
 
-	assert.Equal(t, 7, len(cont.Args))
+	assert.Equal(t, 9, len(cont.Args))
 	assert.Equal(t, fmt.Sprintf("--rgw-secure-port=%d", 443), cont.Args[5])
 	assert.Equal(t, fmt.Sprintf("--rgw-cert=%s/%s", certMountPath, certFilename), cont.Args[6])
+	assert.Equal(t, fmt.Sprintf("--rgw-tls-cert=%s/%s", certMountPath, tlsCertFilename), cont.Args[7])
+	assert.Equal(t, fmt.Sprintf("--rgw-tls-key=%s/%s", certMountPath, tlsKeyFilename), cont.Args[8])
+	assert.Equal(t, 3, len(s.Spec.Volumes[2].Secret.Items))
+	assert.True(t, *s.Spec.Volumes[2].Secret.Optional)
+
+	store.Spec.Gateway.StaticWebsite = true
+	store.Spec.Gateway.DNSName = "s3.example.com"
+	cont = rgwContainer(store, "v1.0")
+	assert.Equal(t, 11, len(cont.Args))
+	assert.Equal(t, "--rgw-static-website", cont.Args[9])
+	assert.Equal(t, "--rgw-dns-name=s3.example.com", cont.Args[10])
+
+	store.Spec.Gateway.WebsiteDNSName = "website.example.com"
+	cont = rgwContainer(store, "v1.0")
+	assert.Equal(t, 12, len(cont.Args))
+	assert.Equal(t, "--rgw-website-dns-name=website.example.com", cont.Args[10])
 }
 
 func TestCreateObjectStore(t *testing.T) {
@@ -215,6 +231,11 @@ func TestValidateSpec(t *testing.T) {
 	s.Spec.MetadataPool.Replicated.Size = 1
 	err = validateStore(context, s)
 	assert.Nil(t, err)
+
+	// a secure port without a certificate is only a warning
+	s.Spec.Gateway.SecurePort = 443
+	err = validateStore(context, s)
+	assert.Nil(t, err)
 }
 
 func simpleStore() cephv1beta1.ObjectStore {
@@ -38,6 +38,7 @@ import (
 	"github.com/rook/rook/pkg/operator/ceph/pool"
 	"github.com/rook/rook/pkg/operator/ceph/provisioner"
 	"github.com/rook/rook/pkg/operator/ceph/provisioner/controller"
+	"github.com/rook/rook/pkg/operator/ceph/settings"
 	"github.com/rook/rook/pkg/operator/discover"
 	"github.com/rook/rook/pkg/operator/k8sutil"
 	"k8s.io/api/core/v1"
@@ -65,13 +66,14 @@ type Operator struct {
 	resources       []opkit.CustomResource
 	rookImage       string
 	securityAccount string
+	settings        *settings.Registry
 	// The custom resource that is global to the kubernetes cluster.
 	// The cluster is global because you create multiple clusters in k8s
 	clusterController *cluster.ClusterController
 }
 
 // New creates an operator instance
-func New(context *clusterd.Context, volumeAttachmentWrapper attachment.Attachment, rookImage, securityAccount string) *Operator {
+func New(context *clusterd.Context, volumeAttachmentWrapper attachment.Attachment, rookImage, securityAccount string, settings *settings.Registry) *Operator {
 	clusterController := cluster.NewClusterController(context, rookImage, volumeAttachmentWrapper)
 
 	schemes := []opkit.CustomResource{cluster.ClusterResource, pool.PoolResource, object.ObjectStoreResource,
@@ -82,6 +84,7 @@ func New(context *clusterd.Context, volumeAttachmentWrapper attachment.Attachmen
 		resources:         schemes,
 		rookImage:         rookImage,
 		securityAccount:   securityAccount,
+		settings:          settings,
 	}
 }
 
@@ -145,6 +148,9 @@ func (o *Operator) Run() error {
 		logger.Infof("rook-provisioner %s started using %s flex vendor dir", name, vendor)
 	}
 
+	// apply the changes to the settings of the operator
+	go o.settings.Start(namespace, stopChan)
+
 	// watch for changes to the rook clusters
 	o.clusterController.StartWatch(v1.NamespaceAll, stopChan)
 
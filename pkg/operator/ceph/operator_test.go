@@ -25,6 +25,7 @@ import (
 	"github.com/rook/rook/pkg/operator/ceph/file"
 	"github.com/rook/rook/pkg/operator/ceph/object"
 	"github.com/rook/rook/pkg/operator/ceph/pool"
+	"github.com/rook/rook/pkg/operator/ceph/settings"
 	"github.com/rook/rook/pkg/operator/test"
 	"github.com/stretchr/testify/assert"
 )
@@ -32,7 +33,7 @@ import (
 func TestOperator(t *testing.T) {
 	clientset := test.New(3)
 	context := &clusterd.Context{Clientset: clientset}
-	o := New(context, &attachment.MockAttachment{}, "", "")
+	o := New(context, &attachment.MockAttachment{}, "", "", settings.NewRegistry(context))
 
 	assert.NotNil(t, o)
 	assert.NotNil(t, o.clusterController)
@@ -0,0 +1,139 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package pool
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	cephv1beta1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1beta1"
+	ceph "github.com/rook/rook/pkg/daemon/ceph/client"
+	"github.com/rook/rook/pkg/operator/ceph/settings"
+	"github.com/rook/rook/pkg/util/display"
+)
+
+const (
+	// DeleteRequestAnnotation on a pool crd requests a token to confirm the deletion of the pool
+	DeleteRequestAnnotation = "ceph.rook.io/delete-request"
+	// DeleteTokenAnnotation is set by the operator to the token that confirms the deletion
+	DeleteTokenAnnotation = "ceph.rook.io/delete-token"
+	// DeleteImpactAnnotation is set by the operator to the data that the deletion destroys
+	DeleteImpactAnnotation = "ceph.rook.io/delete-impact"
+	// DeleteExpiresAnnotation is set by the operator to the time the token expires
+	DeleteExpiresAnnotation = "ceph.rook.io/delete-token-expires"
+	// ConfirmDeleteAnnotation must be set to the token when the crd is deleted for the pool to be deleted
+	ConfirmDeleteAnnotation = "ceph.rook.io/confirm-delete"
+
+	deleteTokenTTL = 10 * time.Minute
+)
+
+// DeleteConfirmation is whether a pool is only deleted with its crd if the deletion was confirmed with a token. The
+// pool is kept if the crd is deleted without the token.
+var DeleteConfirmation = settings.NewBool(false)
+
+// deleteToken confirms the deletion of a pool until it expires
+type deleteToken struct {
+	token   string
+	expires time.Time
+}
+
+// requestDeleteToken issues a token to confirm the deletion of the pool if the pool has the delete request annotation
+// and does not have a valid token yet. The token and the impact of the deletion are set in the annotations of the crd.
+func (c *PoolController) requestDeleteToken(p *cephv1beta1.Pool) error {
+	if !DeleteConfirmation.Get() {
+		return nil
+	}
+	if _, ok := p.Annotations[DeleteRequestAnnotation]; !ok {
+		return nil
+	}
+	key := p.Namespace + "/" + p.Name
+	c.tokensLock.Lock()
+	defer c.tokensLock.Unlock()
+	if t, ok := c.deleteTokens[key]; ok && time.Now().Before(t.expires) && p.Annotations[DeleteTokenAnnotation] == t.token {
+		// the token was already issued
+		return nil
+	}
+
+	impact, err := c.deleteImpact(p)
+	if err != nil {
+		return fmt.Errorf("failed to get the impact of deleting pool %s. %+v", p.Name, err)
+	}
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return fmt.Errorf("failed to generate a token. %+v", err)
+	}
+	t := deleteToken{token: hex.EncodeToString(buf), expires: time.Now().Add(deleteTokenTTL)}
+
+	updated := p.DeepCopy()
+	if updated.Annotations == nil {
+		updated.Annotations = map[string]string{}
+	}
+	updated.Annotations[DeleteTokenAnnotation] = t.token
+	updated.Annotations[DeleteImpactAnnotation] = impact
+	updated.Annotations[DeleteExpiresAnnotation] = t.expires.UTC().Format(time.RFC3339)
+	if _, err := c.context.RookClientset.CephV1beta1().Pools(p.Namespace).Update(updated); err != nil {
+		return fmt.Errorf("failed to set the delete token of pool %s. %+v", p.Name, err)
+	}
+
+	if c.deleteTokens == nil {
+		c.deleteTokens = map[string]deleteToken{}
+	}
+	c.deleteTokens[key] = t
+	logger.Infof("issued a token to confirm the deletion of pool %s until %s. %s", p.Name, updated.Annotations[DeleteExpiresAnnotation], impact)
+	return nil
+}
+
+// deletionConfirmed returns whether the pool of the deleted crd may be deleted. The deletion is confirmed if the crd
+// had the confirm annotation with a token that was issued for the pool and that did not expire yet.
+func (c *PoolController) deletionConfirmed(p *cephv1beta1.Pool) bool {
+	if !DeleteConfirmation.Get() {
+		return true
+	}
+	key := p.Namespace + "/" + p.Name
+	c.tokensLock.Lock()
+	defer c.tokensLock.Unlock()
+	t, ok := c.deleteTokens[key]
+	delete(c.deleteTokens, key)
+	if !ok || time.Now().After(t.expires) {
+		return false
+	}
+	return p.Annotations[ConfirmDeleteAnnotation] == t.token
+}
+
+// deleteImpact describes the data that is destroyed with the pool
+func (c *PoolController) deleteImpact(p *cephv1beta1.Pool) (string, error) {
+	stats, err := ceph.GetPoolStats(c.context, p.Namespace)
+	if err != nil {
+		return "", err
+	}
+	var objects, bytes float64
+	for _, s := range stats.Pools {
+		if s.Name == p.Name {
+			objects = s.Stats.Objects
+			bytes = s.Stats.BytesUsed
+			break
+		}
+	}
+
+	images, err := ceph.ListImages(c.context, p.Namespace, p.Name)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("deleting pool %s destroys %d images and %d objects using %s", p.Name, len(images), int64(objects),
+		display.BytesToString(uint64(bytes))), nil
+}
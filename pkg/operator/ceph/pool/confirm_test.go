@@ -0,0 +1,84 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package pool
+
+import (
+	"fmt"
+	"testing"
+
+	cephv1beta1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1beta1"
+	rookfake "github.com/rook/rook/pkg/client/clientset/versioned/fake"
+	"github.com/rook/rook/pkg/clusterd"
+	exectest "github.com/rook/rook/pkg/util/exec/test"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestDeleteConfirmation(t *testing.T) {
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithOutputFile: func(debug bool, actionName string, command string, outFileArg string, args ...string) (string, error) {
+			if args[0] == "df" {
+				return `{"pools":[{"name":"replicapool","id":1,"stats":{"bytes_used":2048,"objects":12}}]}`, nil
+			}
+			return "", fmt.Errorf("unexpected ceph command '%v'", args)
+		},
+		MockExecuteCommandWithOutput: func(debug bool, actionName string, command string, args ...string) (string, error) {
+			if args[0] == "ls" {
+				return `[{"image":"img1","size":1024},{"image":"img2","size":1024}]`, nil
+			}
+			return "", fmt.Errorf("unexpected rbd command '%v'", args)
+		},
+	}
+	p := &cephv1beta1.Pool{ObjectMeta: metav1.ObjectMeta{Name: "replicapool", Namespace: "ns"}}
+	context := &clusterd.Context{Executor: executor, RookClientset: rookfake.NewSimpleClientset(p)}
+	c := &PoolController{context: context}
+
+	// every deletion is confirmed unless confirmations are required
+	assert.True(t, c.deletionConfirmed(p))
+	DeleteConfirmation.Store(true)
+	defer DeleteConfirmation.Store(false)
+	assert.False(t, c.deletionConfirmed(p))
+
+	// no token is issued without the request annotation
+	assert.Nil(t, c.requestDeleteToken(p))
+	assert.Equal(t, 0, len(c.deleteTokens))
+
+	p.Annotations = map[string]string{DeleteRequestAnnotation: "true"}
+	assert.Nil(t, c.requestDeleteToken(p))
+	p, err := context.RookClientset.CephV1beta1().Pools("ns").Get("replicapool", metav1.GetOptions{})
+	assert.Nil(t, err)
+	token := p.Annotations[DeleteTokenAnnotation]
+	assert.Equal(t, 16, len(token))
+	assert.Equal(t, "deleting pool replicapool destroys 2 images and 12 objects using 2.00 KiB", p.Annotations[DeleteImpactAnnotation])
+	assert.NotEqual(t, "", p.Annotations[DeleteExpiresAnnotation])
+
+	// the token is not issued again for the update of the annotations
+	assert.Nil(t, c.requestDeleteToken(p))
+	assert.Equal(t, token, c.deleteTokens["ns/replicapool"].token)
+
+	// a wrong token does not confirm the deletion and the token can only be used once
+	p.Annotations[ConfirmDeleteAnnotation] = "wrong"
+	assert.False(t, c.deletionConfirmed(p))
+	p.Annotations[ConfirmDeleteAnnotation] = token
+	assert.False(t, c.deletionConfirmed(p))
+
+	// the deletion is confirmed with the token that was issued
+	p.Annotations[DeleteTokenAnnotation] = ""
+	assert.Nil(t, c.requestDeleteToken(p))
+	token = c.deleteTokens["ns/replicapool"].token
+	p.Annotations[ConfirmDeleteAnnotation] = token
+	assert.True(t, c.deletionConfirmed(p))
+}
@@ -20,6 +20,8 @@ package pool
 import (
 	"fmt"
 	"reflect"
+	"strings"
+	"sync"
 
 	"github.com/coreos/pkg/capnslog"
 	opkit "github.com/rook/operator-kit"
@@ -28,8 +30,12 @@ import (
 	"github.com/rook/rook/pkg/clusterd"
 	ceph "github.com/rook/rook/pkg/daemon/ceph/client"
 	"github.com/rook/rook/pkg/daemon/ceph/model"
+	"github.com/rook/rook/pkg/operator/ceph/cluster/notify"
+	"github.com/rook/rook/pkg/operator/ceph/maintenance"
+	"k8s.io/api/core/v1"
 	apiextensionsv1beta1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/tools/cache"
 )
@@ -66,17 +72,24 @@ var PoolResourceRookLegacy = opkit.CustomResource{
 // PoolController represents a controller object for pool custom resources
 type PoolController struct {
 	context *clusterd.Context
+	stopCh  chan struct{}
+	// the tokens that confirm the deletion of the pools by namespace/name
+	deleteTokens map[string]deleteToken
+	tokensLock   sync.Mutex
+	changes      *maintenance.ChangeQueue
 }
 
 // NewPoolController create controller for watching pool custom resources created
 func NewPoolController(context *clusterd.Context) *PoolController {
 	return &PoolController{
 		context: context,
+		changes: maintenance.NewChangeQueue(context),
 	}
 }
 
 // Watch watches for instances of Pool custom resources and acts on them
 func (c *PoolController) StartWatch(namespace string, stopCh chan struct{}) error {
+	c.stopCh = stopCh
 
 	resourceHandlerFuncs := cache.ResourceEventHandlerFuncs{
 		AddFunc:    c.onAdd,
@@ -91,6 +104,9 @@ func (c *PoolController) StartWatch(namespace string, stopCh chan struct{}) erro
 	// watch for events on all legacy types too
 	c.watchLegacyPools(namespace, stopCh, resourceHandlerFuncs)
 
+	// complete the deletions that were still delayed when the operator stopped
+	c.resumeDeletions(namespace)
+
 	return nil
 }
 
@@ -108,9 +124,26 @@ func (c *PoolController) onAdd(obj interface{}) {
 		return
 	}
 
-	err = createPool(c.context, pool)
-	if err != nil {
-		logger.Errorf("failed to create pool %s. %+v", pool.ObjectMeta.Name, err)
+	c.changes.Apply(pool.Namespace, func() {
+		// the pools that already exist are added again when the operator restarts, which is not a new pool
+		existed, err := poolExists(c.context, pool)
+		if err != nil {
+			logger.Warningf("failed to check if pool %s exists. %+v", pool.Name, err)
+			existed = true
+		}
+		err = createPool(c.context, pool)
+		if err != nil {
+			logger.Errorf("failed to create pool %s. %+v", pool.ObjectMeta.Name, err)
+		} else if !existed {
+			object := v1.ObjectReference{Kind: PoolResource.Kind, APIVersion: cephv1beta1.SchemeGroupVersion.String(), Namespace: pool.Namespace, Name: pool.Name, UID: pool.UID}
+			message := fmt.Sprintf("created pool %s in cluster %s", pool.Name, pool.Namespace)
+			if err := notify.Record(c.context.Clientset, pool.Namespace, object, v1.EventTypeNormal, notify.PoolCreated, message); err != nil {
+				logger.Warningf("%+v", err)
+			}
+		}
+	})
+	if err := c.requestDeleteToken(pool); err != nil {
+		logger.Errorf("%+v", err)
 	}
 }
 
@@ -137,8 +170,19 @@ func (c *PoolController) onUpdate(oldObj, newObj interface{}) {
 		logger.Errorf("failed to update pool %s. name update not allowed", pool.Name)
 		return
 	}
+	if err := c.requestDeleteToken(pool); err != nil {
+		logger.Errorf("%+v", err)
+	}
+	if !reflect.DeepEqual(oldPool.Labels, pool.Labels) {
+		c.changes.Apply(pool.Namespace, func() {
+			logger.Infof("updating the labels of pool %s to %v", pool.Name, pool.Labels)
+			if err := ceph.SetPoolLabels(c.context, pool.Namespace, pool.Name, poolApplicationNameRBD, pool.Labels); err != nil {
+				logger.Errorf("failed to set the labels of pool %s. %+v", pool.Name, err)
+			}
+		})
+	}
 	if pool.Spec.ErasureCoded.CodingChunks != 0 && pool.Spec.ErasureCoded.DataChunks != 0 {
-		logger.Errorf("failed to update pool %s. erasurecoded update not allowed", pool.Name)
+		c.updateErasureCodedPool(oldPool, pool)
 		return
 	}
 	if !poolChanged(oldPool.Spec, pool.Spec) {
@@ -147,10 +191,34 @@ func (c *PoolController) onUpdate(oldObj, newObj interface{}) {
 	}
 
 	// if the pool is modified, allow the pool to be created if it wasn't already
-	logger.Infof("updating pool %s", pool.Name)
-	if err := createPool(c.context, pool); err != nil {
-		logger.Errorf("failed to create (modify) pool %s. %+v", pool.ObjectMeta.Name, err)
+	c.changes.Apply(pool.Namespace, func() {
+		logger.Infof("updating pool %s", pool.Name)
+		if err := createPool(c.context, pool); err != nil {
+			logger.Errorf("failed to create (modify) pool %s. %+v", pool.ObjectMeta.Name, err)
+		}
+	})
+}
+
+// updateErasureCodedPool creates the namespaces added to an erasure coded pool. The other settings of an erasure
+// coded pool cannot be changed after it is created, except for the quota that is read when the images are provisioned.
+func (c *PoolController) updateErasureCodedPool(oldPool, pool *cephv1beta1.Pool) {
+	oldSpec, newSpec := oldPool.Spec, pool.Spec
+	oldSpec.Namespaces, newSpec.Namespaces = nil, nil
+	oldSpec.Quota, newSpec.Quota = cephv1beta1.QuotaSpec{}, cephv1beta1.QuotaSpec{}
+	if !reflect.DeepEqual(oldSpec, newSpec) {
+		logger.Errorf("failed to update pool %s. erasurecoded update not allowed except for the namespaces and the quota", pool.Name)
+	}
+	if reflect.DeepEqual(oldPool.Spec.Namespaces, pool.Spec.Namespaces) {
+		logger.Debugf("namespaces of pool %s not changed", pool.Name)
+		return
 	}
+
+	c.changes.Apply(pool.Namespace, func() {
+		logger.Infof("updating the namespaces of pool %s from %v to %v", pool.Name, oldPool.Spec.Namespaces, pool.Spec.Namespaces)
+		if err := createNamespaces(c.context, pool); err != nil {
+			logger.Errorf("failed to create the namespaces of pool %s. %+v", pool.Name, err)
+		}
+	})
 }
 
 func poolChanged(old, new cephv1beta1.PoolSpec) bool {
@@ -158,6 +226,10 @@ func poolChanged(old, new cephv1beta1.PoolSpec) bool {
 		logger.Infof("pool replication changed from %d to %d", old.Replicated.Size, new.Replicated.Size)
 		return true
 	}
+	if !reflect.DeepEqual(old.Namespaces, new.Namespaces) {
+		logger.Infof("pool namespaces changed from %v to %v", old.Namespaces, new.Namespaces)
+		return true
+	}
 	return false
 }
 
@@ -173,9 +245,23 @@ func (c *PoolController) onDelete(obj interface{}) {
 		return
 	}
 
-	if err := deletePool(c.context, pool); err != nil {
-		logger.Errorf("failed to delete pool %s. %+v", pool.ObjectMeta.Name, err)
+	if !c.deletionConfirmed(pool) {
+		logger.Warningf("pool %s is kept since its deletion was not confirmed with a token. create its crd again to manage it", pool.Name)
+		return
+	}
+
+	if DeleteDelay.Get() > 0 {
+		if err := c.scheduleDeletion(pool); err != nil {
+			logger.Errorf("failed to schedule the deletion of pool %s. %+v", pool.ObjectMeta.Name, err)
+		}
+		return
 	}
+
+	c.changes.Apply(pool.Namespace, func() {
+		if err := deletePool(c.context, pool); err != nil {
+			logger.Errorf("failed to delete pool %s. %+v", pool.ObjectMeta.Name, err)
+		}
+	})
 }
 
 // Create the pool
@@ -184,12 +270,29 @@ func createPool(context *clusterd.Context, p *cephv1beta1.Pool) error {
 	if err := ValidatePool(context, p); err != nil {
 		return fmt.Errorf("invalid pool %s arguments. %+v", p.Name, err)
 	}
+	if err := validatePoolTopology(context, p.Namespace, p.Name, &p.Spec); err != nil {
+		return fmt.Errorf("invalid pool %s. %+v", p.Name, err)
+	}
 
 	// create the pool
 	logger.Infof("creating pool %s in namespace %s", p.Name, p.Namespace)
 	if err := ceph.CreatePoolWithProfile(context, p.Namespace, *p.Spec.ToModel(p.Name), poolApplicationNameRBD); err != nil {
 		return fmt.Errorf("failed to create pool %s. %+v", p.Name, err)
 	}
+	if p.Spec.ErasureCode() != nil {
+		if err := recordCreatedResources(context, p.Namespace, createdProfile, ceph.GetErasureCodeProfileForPool(p.Name)); err != nil {
+			logger.Warningf("failed to record the erasure code profile of pool %s. %+v", p.Name, err)
+		}
+	}
+
+	if err := createNamespaces(context, p); err != nil {
+		return fmt.Errorf("failed to create namespaces for pool %s. %+v", p.Name, err)
+	}
+
+	// the labels of the pool crd are mirrored to the pool for the tools that query ceph directly
+	if err := ceph.SetPoolLabels(context, p.Namespace, p.Name, poolApplicationNameRBD, p.Labels); err != nil {
+		return fmt.Errorf("failed to set the labels of pool %s. %+v", p.Name, err)
+	}
 
 	logger.Infof("created pool %s", p.Name)
 	return nil
@@ -202,6 +305,7 @@ func deletePool(context *clusterd.Context, p *cephv1beta1.Pool) error {
 		return fmt.Errorf("failed to delete pool '%s'. %+v", p.Name, err)
 	}
 
+	deleteNamespaceClients(context, p)
 	return nil
 }
 
@@ -224,8 +328,9 @@ func ModelToSpec(pool model.Pool) cephv1beta1.PoolSpec {
 	return cephv1beta1.PoolSpec{
 		FailureDomain: pool.FailureDomain,
 		CrushRoot:     pool.CrushRoot,
-		Replicated:    cephv1beta1.ReplicatedSpec{Size: pool.ReplicatedConfig.Size},
-		ErasureCoded:  cephv1beta1.ErasureCodedSpec{CodingChunks: ec.CodingChunkCount, DataChunks: ec.DataChunkCount, Algorithm: ec.Algorithm},
+		Replicated:    cephv1beta1.ReplicatedSpec{Size: pool.ReplicatedConfig.Size, ReplicasPerFailureDomain: pool.ReplicatedConfig.ReplicasPerFailureDomain},
+		ErasureCoded: cephv1beta1.ErasureCodedSpec{CodingChunks: ec.CodingChunkCount, DataChunks: ec.DataChunkCount, Algorithm: ec.Algorithm,
+			FailureDomain: ec.FailureDomain, CrushRoot: ec.CrushRoot, Plugin: ec.Plugin, Locality: ec.Locality, Durability: ec.Durability},
 	}
 }
 
@@ -250,47 +355,220 @@ func ValidatePoolSpec(context *clusterd.Context, namespace string, p *cephv1beta
 	if p.Replication() == nil && p.ErasureCode() == nil {
 		return fmt.Errorf("neither replication nor erasure code settings were specified")
 	}
+	if ec := p.ErasureCode(); ec != nil {
+		if err := validateErasureCodePlugin(ec); err != nil {
+			return err
+		}
+	}
+	if r := p.Replication(); r != nil && r.ReplicasPerFailureDomain > 1 {
+		if r.ReplicasPerFailureDomain > r.Size {
+			return fmt.Errorf("the replicas per failure domain (%d) cannot exceed the size %d", r.ReplicasPerFailureDomain, r.Size)
+		}
+		if p.FailureDomain == "" || p.FailureDomain == "host" || p.FailureDomain == "osd" {
+			return fmt.Errorf("the replicas per failure domain are placed on different hosts, so the failure domain must be above the hosts")
+		}
+	}
+	for _, ns := range p.Namespaces {
+		if ns == "" || strings.Contains(ns, "/") {
+			return fmt.Errorf("invalid namespace %q", ns)
+		}
+	}
+	for _, quota := range []string{p.Quota.MaxProvisionedSize, p.Quota.MaxProvisionedSizePerNamespace} {
+		if quota == "" {
+			continue
+		}
+		if _, err := resource.ParseQuantity(quota); err != nil {
+			return fmt.Errorf("invalid quota %q. %+v", quota, err)
+		}
+	}
 
-	var crush ceph.CrushMap
-	var err error
-	if p.FailureDomain != "" || p.CrushRoot != "" {
-		crush, err = ceph.GetCrushMap(context, namespace)
-		if err != nil {
-			return fmt.Errorf("failed to get crush map. %+v", err)
+	if p.FailureDomain == "" && p.CrushRoot == "" && p.ErasureCoded.FailureDomain == "" && p.ErasureCoded.CrushRoot == "" {
+		return nil
+	}
+	crush, err := ceph.GetCrushMap(context, namespace)
+	if err != nil {
+		return fmt.Errorf("failed to get crush map. %+v", err)
+	}
+	if err := validateCrushLocation(crush, p.FailureDomain, p.CrushRoot); err != nil {
+		return err
+	}
+	if err := validateCrushLocation(crush, p.ErasureCoded.FailureDomain, p.ErasureCoded.CrushRoot); err != nil {
+		return fmt.Errorf("invalid erasure code settings. %+v", err)
+	}
+
+	return nil
+}
+
+// validateErasureCodePlugin checks that the plugin is supported and the parameters of the lrc and shec plugins can be
+// combined with the chunks
+func validateErasureCodePlugin(ec *cephv1beta1.ErasureCodedSpec) error {
+	switch ec.Plugin {
+	case "", "jerasure", "isa", ceph.LRCPlugin, ceph.SHECPlugin:
+	default:
+		return fmt.Errorf("unsupported erasure code plugin %s", ec.Plugin)
+	}
+	if ec.Locality > 0 && ec.Plugin != ceph.LRCPlugin {
+		return fmt.Errorf("locality is only supported by the %s erasure code plugin", ceph.LRCPlugin)
+	}
+	if ec.Durability > 0 && ec.Plugin != ceph.SHECPlugin {
+		return fmt.Errorf("durability is only supported by the %s erasure code plugin", ceph.SHECPlugin)
+	}
+
+	switch ec.Plugin {
+	case ceph.LRCPlugin:
+		if ec.Locality == 0 {
+			return fmt.Errorf("the locality is required by the %s erasure code plugin", ceph.LRCPlugin)
+		}
+		if (ec.DataChunks+ec.CodingChunks)%ec.Locality != 0 {
+			return fmt.Errorf("the data and coding chunks (%d) must be a multiple of the locality %d", ec.DataChunks+ec.CodingChunks, ec.Locality)
+		}
+	case ceph.SHECPlugin:
+		if ec.CodingChunks > ec.DataChunks {
+			return fmt.Errorf("the coding chunks (%d) cannot exceed the data chunks (%d) with the %s erasure code plugin", ec.CodingChunks, ec.DataChunks, ceph.SHECPlugin)
+		}
+		if ec.Durability > ec.CodingChunks {
+			return fmt.Errorf("the durability %d cannot exceed the coding chunks (%d)", ec.Durability, ec.CodingChunks)
 		}
 	}
+	return nil
+}
 
-	// validate the failure domain if specified
-	if p.FailureDomain != "" {
+// validateCrushLocation checks that the failure domain is a type in the crush map and the crush root is a bucket in the
+// crush map, if they are specified
+func validateCrushLocation(crush ceph.CrushMap, failureDomain, crushRoot string) error {
+	if failureDomain != "" {
 		found := false
 		for _, t := range crush.Types {
-			if t.Name == p.FailureDomain {
+			if t.Name == failureDomain {
 				found = true
 				break
 			}
 		}
 		if !found {
-			return fmt.Errorf("unrecognized failure domain %s", p.FailureDomain)
+			return fmt.Errorf("unrecognized failure domain %s", failureDomain)
 		}
 	}
 
-	// validate the crush root if specified
-	if p.CrushRoot != "" {
+	if crushRoot != "" {
 		found := false
 		for _, t := range crush.Buckets {
-			if t.Name == p.CrushRoot {
+			if t.Name == crushRoot {
 				found = true
 				break
 			}
 		}
 		if !found {
-			return fmt.Errorf("unrecognized crush root %s", p.CrushRoot)
+			return fmt.Errorf("unrecognized crush root %s", crushRoot)
+		}
+	}
+
+	return nil
+}
+
+// WarnPoolTopology logs a warning if the pool of a filesystem or object store cannot be placed on the failure domains
+// of the crush map. Their pools are still created since the PGs become active+clean as soon as the missing hosts or
+// racks join the cluster.
+func WarnPoolTopology(context *clusterd.Context, namespace, name string, p *cephv1beta1.PoolSpec) {
+	if err := validatePoolTopology(context, namespace, name, p); err != nil {
+		logger.Warningf("pool %s will not be healthy until more osds are added. %+v", name, err)
+	}
+}
+
+// validatePoolTopology checks that the crush map has enough failure domains under the crush root to place every
+// replica or chunk of an object. Otherwise the PGs of the pool could never become active+clean.
+func validatePoolTopology(context *clusterd.Context, namespace, name string, p *cephv1beta1.PoolSpec) error {
+	var needed uint
+	failureDomain := p.FailureDomain
+	crushRoot := p.CrushRoot
+	if r := p.Replication(); r != nil {
+		needed = r.Size
+		if r.ReplicasPerFailureDomain > 1 {
+			needed = (r.Size + r.ReplicasPerFailureDomain - 1) / r.ReplicasPerFailureDomain
+		}
+	} else if ec := p.ErasureCode(); ec != nil {
+		needed = ec.DataChunks + ec.CodingChunks
+		if ec.Plugin == ceph.LRCPlugin && ec.Locality > 0 {
+			// each locality group has a local parity chunk
+			needed += needed / ec.Locality
+		}
+		if ec.FailureDomain != "" {
+			failureDomain = ec.FailureDomain
 		}
+		if ec.CrushRoot != "" {
+			crushRoot = ec.CrushRoot
+		}
+	}
+	if failureDomain == "" {
+		failureDomain = "host"
+	}
+	if crushRoot == "" {
+		crushRoot = "default"
 	}
 
+	crush, err := ceph.GetCrushMap(context, namespace)
+	if err != nil {
+		return fmt.Errorf("failed to get crush map. %+v", err)
+	}
+	available := countFailureDomains(crush, crushRoot, failureDomain)
+	if uint(available) < needed {
+		return fmt.Errorf("%d failure domains of type %s are needed under crush root %s, but only %d have osds",
+			needed, failureDomain, crushRoot, available)
+	}
+	logger.Debugf("pool %s needs %d failure domains of type %s and %d are available", name, needed, failureDomain, available)
 	return nil
 }
 
+// countFailureDomains counts the buckets of the failure domain type under the root that contain at least one osd.
+// The osds themselves are counted for the osd failure domain.
+func countFailureDomains(crush ceph.CrushMap, root, failureDomain string) int {
+	buckets := map[int]int{}
+	rootIndex := -1
+	for i, b := range crush.Buckets {
+		buckets[b.ID] = i
+		if b.Name == root {
+			rootIndex = i
+		}
+	}
+	if rootIndex == -1 {
+		return 0
+	}
+
+	// count the osds under a bucket, following the items of the bucket down the hierarchy
+	var countOSDs func(index int) int
+	countOSDs = func(index int) int {
+		count := 0
+		for _, item := range crush.Buckets[index].Items {
+			if item.ID >= 0 {
+				count++
+			} else if child, ok := buckets[item.ID]; ok {
+				count += countOSDs(child)
+			}
+		}
+		return count
+	}
+	if failureDomain == "osd" {
+		return countOSDs(rootIndex)
+	}
+
+	var countDomains func(index int) int
+	countDomains = func(index int) int {
+		count := 0
+		for _, item := range crush.Buckets[index].Items {
+			child, ok := buckets[item.ID]
+			if item.ID >= 0 || !ok {
+				continue
+			}
+			if crush.Buckets[child].TypeName != failureDomain {
+				count += countDomains(child)
+			} else if countOSDs(child) > 0 {
+				count++
+			}
+		}
+		return count
+	}
+	return countDomains(rootIndex)
+}
+
 func (c *PoolController) watchLegacyPools(namespace string, stopCh chan struct{}, resourceHandlerFuncs cache.ResourceEventHandlerFuncs) {
 	// watch for pool.rook.io/v1alpha1 events if the CRD exists
 	if _, err := c.context.RookClientset.RookV1alpha1().Pools(namespace).List(metav1.ListOptions{}); err != nil {
@@ -23,6 +23,7 @@ import (
 	rookv1alpha1 "github.com/rook/rook/pkg/apis/rook.io/v1alpha1"
 	rookfake "github.com/rook/rook/pkg/client/clientset/versioned/fake"
 	"github.com/rook/rook/pkg/clusterd"
+	ceph "github.com/rook/rook/pkg/daemon/ceph/client"
 	testop "github.com/rook/rook/pkg/operator/test"
 	exectest "github.com/rook/rook/pkg/util/exec/test"
 	"github.com/stretchr/testify/assert"
@@ -62,6 +63,20 @@ func TestValidatePool(t *testing.T) {
 	err = ValidatePool(context, &p)
 	assert.Nil(t, err)
 
+	// fail with an invalid namespace
+	p.Spec.Namespaces = []string{"tenant1", "tenant/2"}
+	err = ValidatePool(context, &p)
+	assert.NotNil(t, err)
+	p.Spec.Namespaces = nil
+
+	// fail with an invalid quota
+	p.Spec.Quota.MaxProvisionedSize = "10Ti"
+	err = ValidatePool(context, &p)
+	assert.Nil(t, err)
+	p.Spec.Quota.MaxProvisionedSizePerNamespace = "lots"
+	err = ValidatePool(context, &p)
+	assert.NotNil(t, err)
+
 	// succeed with ec settings
 	p = cephv1beta1.Pool{ObjectMeta: metav1.ObjectMeta{Name: "mypool", Namespace: "myns"}}
 	p.Spec.ErasureCoded.CodingChunks = 1
@@ -107,26 +122,175 @@ func TestValidateCrushProperties(t *testing.T) {
 	p.Spec.CrushRoot = "good"
 	err = ValidatePool(context, p)
 	assert.Nil(t, err)
+
+	// the failure domain and crush root of the erasure code profile are validated
+	p.Spec = cephv1beta1.PoolSpec{
+		ErasureCoded: cephv1beta1.ErasureCodedSpec{DataChunks: 2, CodingChunks: 1, FailureDomain: "osd", CrushRoot: "good"},
+	}
+	assert.Nil(t, ValidatePool(context, p))
+	p.Spec.ErasureCoded.FailureDomain = "rack"
+	assert.NotNil(t, ValidatePool(context, p))
+	p.Spec.ErasureCoded.FailureDomain = "osd"
+	p.Spec.ErasureCoded.CrushRoot = "bad"
+	assert.NotNil(t, ValidatePool(context, p))
+}
+
+func TestValidateReplicasPerFailureDomain(t *testing.T) {
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithOutputFile: func(debug bool, actionName, command, outfile string, args ...string) (string, error) {
+			if args[1] == "crush" && args[2] == "dump" {
+				return testCrushMap, nil
+			}
+			return "", fmt.Errorf("unexpected ceph command '%v'", args)
+		},
+	}
+	context := &clusterd.Context{Executor: executor}
+	spec := &cephv1beta1.PoolSpec{FailureDomain: "rack", Replicated: cephv1beta1.ReplicatedSpec{Size: 4, ReplicasPerFailureDomain: 2}}
+	assert.Nil(t, ValidatePoolSpec(context, "myns", spec))
+
+	// the replicas in a failure domain are on different hosts
+	spec.FailureDomain = "host"
+	assert.NotNil(t, ValidatePoolSpec(context, "myns", spec))
+	spec.FailureDomain = "rack"
+	spec.Replicated.ReplicasPerFailureDomain = 5
+	assert.NotNil(t, ValidatePoolSpec(context, "myns", spec))
+}
+
+func TestValidateErasureCodePlugin(t *testing.T) {
+	ec := &cephv1beta1.ErasureCodedSpec{DataChunks: 4, CodingChunks: 2}
+	assert.Nil(t, validateErasureCodePlugin(ec))
+	ec.Plugin = "isa"
+	assert.Nil(t, validateErasureCodePlugin(ec))
+	ec.Plugin = "unknown"
+	assert.NotNil(t, validateErasureCodePlugin(ec))
+
+	// the chunks of the lrc plugin are split in locality groups
+	ec.Plugin = "lrc"
+	assert.NotNil(t, validateErasureCodePlugin(ec))
+	ec.Locality = 4
+	assert.NotNil(t, validateErasureCodePlugin(ec))
+	ec.Locality = 3
+	assert.Nil(t, validateErasureCodePlugin(ec))
+
+	// the durability of the shec plugin is limited by the coding chunks
+	ec.Plugin = "shec"
+	assert.NotNil(t, validateErasureCodePlugin(ec))
+	ec.Locality = 0
+	ec.Durability = 2
+	assert.Nil(t, validateErasureCodePlugin(ec))
+	ec.Durability = 3
+	assert.NotNil(t, validateErasureCodePlugin(ec))
+	ec.Durability = 1
+	ec.CodingChunks = 5
+	assert.NotNil(t, validateErasureCodePlugin(ec))
+
+	// the parameters of a plugin are not accepted by the others
+	ec.Plugin = ""
+	ec.CodingChunks = 2
+	assert.NotNil(t, validateErasureCodePlugin(ec))
+}
+
+// a crush map with four hosts in the default root, one of them without osds, and two racks
+const testCrushMap = `{"types":[{"type_id":0,"name":"osd"},{"type_id":1,"name":"host"},{"type_id":3,"name":"rack"},{"type_id":10,"name":"root"}],
+"buckets":[
+	{"id":-1,"name":"default","type_name":"root","items":[{"id":-5},{"id":-6}]},
+	{"id":-2,"name":"host-a","type_name":"host","items":[{"id":0},{"id":1}]},
+	{"id":-3,"name":"host-b","type_name":"host","items":[{"id":2}]},
+	{"id":-4,"name":"host-c","type_name":"host","items":[]},
+	{"id":-7,"name":"host-d","type_name":"host","items":[{"id":3}]},
+	{"id":-8,"name":"host-e","type_name":"host","items":[{"id":4}]},
+	{"id":-5,"name":"rack-1","type_name":"rack","items":[{"id":-2},{"id":-3},{"id":-4}]},
+	{"id":-6,"name":"rack-2","type_name":"rack","items":[{"id":-7},{"id":-8}]}]}`
+
+func TestValidatePoolTopology(t *testing.T) {
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithOutputFile: func(debug bool, actionName, command, outfile string, args ...string) (string, error) {
+			if args[1] == "crush" && args[2] == "dump" {
+				return testCrushMap, nil
+			}
+			return "", fmt.Errorf("unexpected ceph command '%v'", args)
+		},
+	}
+	context := &clusterd.Context{Executor: executor}
+
+	// the hosts without osds are not counted
+	crush, err := ceph.GetCrushMap(context, "myns")
+	assert.Nil(t, err)
+	assert.Equal(t, 4, countFailureDomains(crush, "default", "host"))
+	assert.Equal(t, 2, countFailureDomains(crush, "default", "rack"))
+	assert.Equal(t, 5, countFailureDomains(crush, "default", "osd"))
+	assert.Equal(t, 0, countFailureDomains(crush, "missing", "host"))
+
+	// replicas are placed on separate hosts by default
+	spec := &cephv1beta1.PoolSpec{Replicated: cephv1beta1.ReplicatedSpec{Size: 4}}
+	assert.Nil(t, validatePoolTopology(context, "myns", "mypool", spec))
+	spec.Replicated.Size = 5
+	assert.NotNil(t, validatePoolTopology(context, "myns", "mypool", spec))
+	spec.FailureDomain = "osd"
+	assert.Nil(t, validatePoolTopology(context, "myns", "mypool", spec))
+
+	// several replicas can be placed in each failure domain
+	spec = &cephv1beta1.PoolSpec{FailureDomain: "rack", Replicated: cephv1beta1.ReplicatedSpec{Size: 4}}
+	assert.NotNil(t, validatePoolTopology(context, "myns", "mypool", spec))
+	spec.Replicated.ReplicasPerFailureDomain = 2
+	assert.Nil(t, validatePoolTopology(context, "myns", "mypool", spec))
+
+	// all the chunks of an erasure coded object need a failure domain
+	spec = &cephv1beta1.PoolSpec{FailureDomain: "rack", ErasureCoded: cephv1beta1.ErasureCodedSpec{DataChunks: 2, CodingChunks: 1}}
+	assert.NotNil(t, validatePoolTopology(context, "myns", "mypool", spec))
+	spec.ErasureCoded.DataChunks = 1
+	assert.Nil(t, validatePoolTopology(context, "myns", "mypool", spec))
+
+	// the failure domains are counted under the crush root of the pool
+	spec.CrushRoot = "rack-2"
+	spec.FailureDomain = "host"
+	assert.Nil(t, validatePoolTopology(context, "myns", "mypool", spec))
+	spec.ErasureCoded.CodingChunks = 2
+	assert.NotNil(t, validatePoolTopology(context, "myns", "mypool", spec))
+
+	// the failure domain of the erasure code profile takes precedence over the pool
+	spec.ErasureCoded.FailureDomain = "osd"
+	assert.Nil(t, validatePoolTopology(context, "myns", "mypool", spec))
+
+	// the local parity chunks of the lrc plugin need a failure domain too
+	spec.CrushRoot = ""
+	spec.ErasureCoded = cephv1beta1.ErasureCodedSpec{DataChunks: 2, CodingChunks: 2, Plugin: "lrc", Locality: 2, FailureDomain: "osd"}
+	assert.NotNil(t, validatePoolTopology(context, "myns", "mypool", spec))
+	spec.ErasureCoded.Locality = 4
+	assert.Nil(t, validatePoolTopology(context, "myns", "mypool", spec))
 }
 
 func TestCreatePool(t *testing.T) {
+	labels := map[string]string{}
 	executor := &exectest.MockExecutor{
 		MockExecuteCommandWithOutputFile: func(debug bool, actionName, command, outfile string, args ...string) (string, error) {
+			if args[1] == "crush" && args[2] == "dump" {
+				return testCrushMap, nil
+			}
+			if args[1] == "pool" && args[2] == "application" && args[3] == "get" {
+				return `{"rbd":{}}`, nil
+			}
+			if args[1] == "pool" && args[2] == "application" && args[3] == "set" {
+				assert.Equal(t, "rbd", args[5])
+				labels[args[6]] = args[7]
+				return "", nil
+			}
 			if command == "ceph" && args[1] == "erasure-code-profile" {
 				return `{"k":"2","m":"1","plugin":"jerasure","technique":"reed_sol_van"}`, nil
 			}
 			return "", nil
 		},
 	}
-	context := &clusterd.Context{Executor: executor}
+	context := &clusterd.Context{Executor: executor, Clientset: testop.New(1)}
 
-	p := &cephv1beta1.Pool{ObjectMeta: metav1.ObjectMeta{Name: "mypool", Namespace: "myns"}}
+	p := &cephv1beta1.Pool{ObjectMeta: metav1.ObjectMeta{Name: "mypool", Namespace: "myns", Labels: map[string]string{"owner": "team-a"}}}
 	p.Spec.Replicated.Size = 1
 
 	exists, err := poolExists(context, p)
 	assert.False(t, exists)
 	err = createPool(context, p)
 	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"label.owner": "team-a"}, labels)
 
 	// fail if both replication and EC are specified
 	p.Spec.ErasureCoded.CodingChunks = 2
@@ -138,6 +302,17 @@ func TestCreatePool(t *testing.T) {
 	p.Spec.Replicated.Size = 0
 	err = createPool(context, p)
 	assert.Nil(t, err)
+
+	// the erasure code profile is recorded as created by the operator
+	created, err := getCreatedResources(context, "myns")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"mypool_ecprofile": createdProfile}, created)
+
+	// fail without a host for every chunk
+	p.Spec.ErasureCoded.CodingChunks = 3
+	err = createPool(context, p)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "5 failure domains of type host")
 }
 
 func TestUpdatePool(t *testing.T) {
@@ -152,6 +327,114 @@ func TestUpdatePool(t *testing.T) {
 	new = cephv1beta1.PoolSpec{FailureDomain: "osd", Replicated: cephv1beta1.ReplicatedSpec{Size: 2}}
 	changed = poolChanged(old, new)
 	assert.True(t, changed)
+
+	// the pool changed when a namespace is added
+	old = cephv1beta1.PoolSpec{Replicated: cephv1beta1.ReplicatedSpec{Size: 1}}
+	new = cephv1beta1.PoolSpec{Replicated: cephv1beta1.ReplicatedSpec{Size: 1}, Namespaces: []string{"tenant1"}}
+	changed = poolChanged(old, new)
+	assert.True(t, changed)
+}
+
+func TestCreatePoolNamespaces(t *testing.T) {
+	namespacesCreated := []string{}
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithOutput: func(debug bool, actionName string, command string, args ...string) (string, error) {
+			if command == "rbd" && args[0] == "namespace" && args[1] == "ls" {
+				return `[{"name":"tenant1"}]`, nil
+			}
+			if command == "rbd" && args[0] == "namespace" && args[1] == "create" {
+				namespacesCreated = append(namespacesCreated, args[2])
+				return "", nil
+			}
+			return "", fmt.Errorf("unexpected rbd command '%v'", args)
+		},
+		MockExecuteCommandWithOutputFile: func(debug bool, actionName, command, outfile string, args ...string) (string, error) {
+			if command == "ceph" && args[0] == "auth" {
+				return `{"key":"mysecret"}`, nil
+			}
+			if args[1] == "crush" && args[2] == "dump" {
+				return testCrushMap, nil
+			}
+			if args[1] == "pool" && args[2] == "application" && args[3] == "get" {
+				return `{"rbd":{}}`, nil
+			}
+			return "", nil
+		},
+	}
+	clientset := testop.New(3)
+	context := &clusterd.Context{Executor: executor, Clientset: clientset}
+
+	p := &cephv1beta1.Pool{ObjectMeta: metav1.ObjectMeta{Name: "mypool", Namespace: "myns"}}
+	p.Spec.Replicated.Size = 1
+	p.Spec.Namespaces = []string{"tenant1", "tenant2"}
+	err := createPool(context, p)
+	assert.Nil(t, err)
+
+	// only the namespace that didn't exist is created
+	assert.Equal(t, []string{"mypool/tenant2"}, namespacesCreated)
+
+	// a secret is created with the restricted client for each namespace
+	for _, ns := range p.Spec.Namespaces {
+		secret, err := clientset.CoreV1().Secrets("myns").Get(NamespaceSecretName("mypool", ns), metav1.GetOptions{})
+		assert.Nil(t, err)
+		assert.Equal(t, "client.mypool."+ns, secret.StringData[namespaceUserNameKey])
+		assert.Equal(t, "mysecret", secret.StringData[namespaceSecretKeyKey])
+	}
+
+	// the clients are recorded as created by the operator
+	created, err := getCreatedResources(context, "myns")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"client.mypool.tenant1": createdClient, "client.mypool.tenant2": createdClient}, created)
+
+	// the secrets are removed when the pool is deleted
+	err = deletePool(context, p)
+	assert.Nil(t, err)
+	_, err = clientset.CoreV1().Secrets("myns").Get(NamespaceSecretName("mypool", "tenant1"), metav1.GetOptions{})
+	assert.True(t, errors.IsNotFound(err))
+	created, err = getCreatedResources(context, "myns")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(created))
+}
+
+func TestUpdateErasureCodedPool(t *testing.T) {
+	namespacesCreated := []string{}
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithOutput: func(debug bool, actionName string, command string, args ...string) (string, error) {
+			if command == "rbd" && args[0] == "namespace" && args[1] == "ls" {
+				return `[]`, nil
+			}
+			if command == "rbd" && args[0] == "namespace" && args[1] == "create" {
+				namespacesCreated = append(namespacesCreated, args[2])
+				return "", nil
+			}
+			return "", fmt.Errorf("unexpected rbd command '%v'", args)
+		},
+		MockExecuteCommandWithOutputFile: func(debug bool, actionName, command, outfile string, args ...string) (string, error) {
+			if command == "ceph" && args[0] == "auth" {
+				return `{"key":"mysecret"}`, nil
+			}
+			return "", fmt.Errorf("unexpected ceph command '%v'", args)
+		},
+	}
+	cluster := &cephv1beta1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "rook-ceph", Namespace: "myns"}}
+	context := &clusterd.Context{Executor: executor, Clientset: testop.New(3), RookClientset: rookfake.NewSimpleClientset(cluster)}
+	c := NewPoolController(context)
+
+	old := &cephv1beta1.Pool{ObjectMeta: metav1.ObjectMeta{Name: "mypool", Namespace: "myns"}}
+	old.Spec.ErasureCoded = cephv1beta1.ErasureCodedSpec{CodingChunks: 1, DataChunks: 2}
+	pool := old.DeepCopy()
+
+	// nothing is applied when the namespaces did not change
+	pool.Spec.FailureDomain = "host"
+	c.updateErasureCodedPool(old, pool)
+	assert.Equal(t, 0, len(namespacesCreated))
+
+	// the namespaces added to the pool are created
+	pool.Spec.Namespaces = []string{"tenant1"}
+	c.updateErasureCodedPool(old, pool)
+	assert.Equal(t, []string{"mypool/tenant1"}, namespacesCreated)
+	_, err := context.Clientset.CoreV1().Secrets("myns").Get(NamespaceSecretName("mypool", "tenant1"), metav1.GetOptions{})
+	assert.Nil(t, err)
 }
 
 func TestDeletePool(t *testing.T) {
@@ -0,0 +1,379 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pool
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rook/rook/pkg/clusterd"
+	ceph "github.com/rook/rook/pkg/daemon/ceph/client"
+	"github.com/rook/rook/pkg/operator/k8sutil"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// ImageAllocationsConfigMapName is the config map with the queue of the thick provisioned images and their progress
+	ImageAllocationsConfigMapName = "rook-ceph-image-allocations"
+
+	// the allocated images are kept in the config map for a day to report their allocation
+	imageAllocationHistory = 24 * time.Hour
+
+	// ImageAllocationQueued is the status of an image that waits to be allocated
+	ImageAllocationQueued = "queued"
+	// ImageAllocationAllocating is the status of the image whose objects are being written
+	ImageAllocationAllocating = "allocating"
+	// ImageAllocationAllocated is the status of an image whose objects were all written
+	ImageAllocationAllocated = "allocated"
+	// ImageAllocationFailed is the status of an image whose allocation failed and is resumed at the next check
+	ImageAllocationFailed = "failed"
+)
+
+var (
+	// ImageAllocationInterval is the interval to look for queued images to allocate
+	ImageAllocationInterval = 10 * time.Second
+	// ImageAllocationRate is the number of objects per second each image is allocated at. The rate is not
+	// limited if it is zero.
+	ImageAllocationRate = 0
+	// ImageAllocationConcurrency is the number of images that are allocated at the same time
+	ImageAllocationConcurrency = 4
+
+	// the concurrent allocations update the config map one at a time
+	imageAllocationsLock sync.Mutex
+)
+
+// ImageAllocation is a thick provisioned image in the allocation queue with the progress of its allocation
+type ImageAllocation struct {
+	Pool           string    `json:"pool"`
+	Image          string    `json:"image"`
+	ClaimNamespace string    `json:"claimNamespace,omitempty"`
+	ClaimName      string    `json:"claimName,omitempty"`
+	ClaimUID       string    `json:"claimUID,omitempty"`
+	Objects        uint64    `json:"objects"`
+	Allocated      uint64    `json:"allocated"`
+	Status         string    `json:"status"`
+	Queued         time.Time `json:"queued"`
+	Started        time.Time `json:"started"`
+	Finished       time.Time `json:"finished"`
+	Attempts       int       `json:"attempts,omitempty"`
+	Error          string    `json:"error,omitempty"`
+}
+
+// Progress returns the percentage of the objects of the image that were allocated
+func (a *ImageAllocation) Progress() int {
+	if a.Objects == 0 {
+		return 100
+	}
+	return int(a.Allocated * 100 / a.Objects)
+}
+
+// QueueImageAllocation queues the image to be allocated in the background by the allocation queue of the cluster, or
+// returns the allocation of the image if it was already queued. The image must not be used until it is allocated
+// since its objects are overwritten. The image is removed with its allocation if the claim is deleted before the
+// volume of the image is created.
+func QueueImageAllocation(context *clusterd.Context, namespace, image, pool string, claim *v1.PersistentVolumeClaim) (*ImageAllocation, error) {
+	allocations, err := loadImageAllocations(context, namespace)
+	if err != nil {
+		return nil, err
+	}
+	for i, allocation := range allocations {
+		if allocation.Pool == pool && allocation.Image == image {
+			return &allocations[i], nil
+		}
+	}
+
+	info, err := ceph.GetImageInfo(context, namespace, image, pool)
+	if err != nil {
+		return nil, err
+	}
+	allocation := ImageAllocation{Pool: pool, Image: image, Objects: info.Objects, Status: ImageAllocationQueued, Queued: time.Now()}
+	if claim != nil {
+		allocation.ClaimNamespace = claim.Namespace
+		allocation.ClaimName = claim.Name
+		allocation.ClaimUID = string(claim.UID)
+	}
+	if err := updateImageAllocation(context, namespace, allocation); err != nil {
+		return nil, fmt.Errorf("failed to queue the allocation of image %s/%s. %+v", pool, image, err)
+	}
+	logger.Infof("queued the allocation of image %s/%s with %d objects", pool, image, info.Objects)
+	return &allocation, nil
+}
+
+// ImageAllocator writes all the objects of the queued images in the background, allocating a few images at a time
+type ImageAllocator struct {
+	context   *clusterd.Context
+	namespace string
+	lock      sync.Mutex
+	running   map[string]bool
+}
+
+// NewImageAllocator creates a new image allocator for the cluster in the namespace
+func NewImageAllocator(context *clusterd.Context, namespace string) *ImageAllocator {
+	return &ImageAllocator{context: context, namespace: namespace, running: map[string]bool{}}
+}
+
+// Start periodically starts the allocation of the queued images
+func (a *ImageAllocator) Start(stopCh chan struct{}) {
+	for {
+		select {
+		case <-stopCh:
+			logger.Infof("stopping the image allocator in namespace %s", a.namespace)
+			return
+
+		case <-time.After(ImageAllocationInterval):
+			if _, err := a.startQueued(stopCh); err != nil {
+				logger.Warningf("failed to allocate the queued images in namespace %s. %+v", a.namespace, err)
+			}
+		}
+	}
+}
+
+// AllocateQueued starts the allocation of the queued images and waits until their allocations are complete
+func (a *ImageAllocator) AllocateQueued(stopCh chan struct{}) error {
+	results, err := a.startQueued(stopCh)
+	if err != nil {
+		return err
+	}
+	failed := 0
+	for err := range results {
+		if err != nil {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("failed to allocate %d images", failed)
+	}
+	return nil
+}
+
+// startQueued starts allocating the queued images in the order they were queued, while fewer than the concurrent
+// allocations are running, and restarts the images whose allocation failed or was interrupted. The images of the
+// claims that were deleted before their volume was created are removed, and the allocated images are dropped from
+// the history when they are older than a day. The result of each started allocation is sent to the returned channel,
+// which is closed when they are all complete.
+func (a *ImageAllocator) startQueued(stopCh chan struct{}) (chan error, error) {
+	allocations, err := loadImageAllocations(a.context, a.namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	var pending []ImageAllocation
+	for _, allocation := range allocations {
+		if a.running[imageAllocationKey(allocation)] {
+			continue
+		}
+		if a.claimDeleted(allocation) {
+			if err := a.removeOrphan(allocation); err != nil {
+				logger.Warningf("%+v", err)
+			}
+			continue
+		}
+		if allocation.Status != ImageAllocationAllocated {
+			pending = append(pending, allocation)
+		} else if time.Since(allocation.Finished) > imageAllocationHistory {
+			if err := removeImageAllocation(a.context, a.namespace, allocation); err != nil {
+				logger.Warningf("failed to remove allocated image %s/%s from the history. %+v", allocation.Pool, allocation.Image, err)
+			}
+		}
+	}
+	sort.Slice(pending, func(i, j int) bool { return pending[i].Queued.Before(pending[j].Queued) })
+	free := ImageAllocationConcurrency - len(a.running)
+	if free < 0 {
+		free = 0
+	}
+	if len(pending) > free {
+		pending = pending[:free]
+	}
+
+	results := make(chan error, len(pending))
+	var wg sync.WaitGroup
+	for _, allocation := range pending {
+		key := imageAllocationKey(allocation)
+		a.running[key] = true
+		wg.Add(1)
+		go func(allocation ImageAllocation) {
+			defer wg.Done()
+			err := a.allocate(allocation, stopCh)
+			if err != nil {
+				logger.Errorf("%+v", err)
+			}
+			a.lock.Lock()
+			delete(a.running, key)
+			a.lock.Unlock()
+			results <- err
+		}(allocation)
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+	return results, nil
+}
+
+// allocate writes all the objects of the image, recording the allocation in the queue. An image that was deleted
+// while it was queued is dropped from the queue.
+func (a *ImageAllocator) allocate(allocation ImageAllocation, stopCh chan struct{}) error {
+	select {
+	case <-stopCh:
+		return nil
+	default:
+	}
+
+	info, err := ceph.GetImageInfo(a.context, a.namespace, allocation.Image, allocation.Pool)
+	if err != nil {
+		if !a.imageExists(allocation) {
+			logger.Infof("image %s/%s was deleted before it was allocated", allocation.Pool, allocation.Image)
+			return removeImageAllocation(a.context, a.namespace, allocation)
+		}
+		return a.failed(allocation, err)
+	}
+
+	allocation.Status = ImageAllocationAllocating
+	allocation.Started = time.Now()
+	allocation.Objects = info.Objects
+	allocation.Allocated = 0
+	allocation.Attempts++
+	if err := updateImageAllocation(a.context, a.namespace, allocation); err != nil {
+		return err
+	}
+
+	logger.Infof("allocating the %d objects of image %s/%s", info.Objects, allocation.Pool, allocation.Image)
+	if err := ceph.AllocateImage(a.context, a.namespace, allocation.Image, allocation.Pool, info, ImageAllocationRate); err != nil {
+		return a.failed(allocation, err)
+	}
+
+	allocation.Status = ImageAllocationAllocated
+	allocation.Allocated = info.Objects
+	allocation.Finished = time.Now()
+	allocation.Error = ""
+	if err := updateImageAllocation(a.context, a.namespace, allocation); err != nil {
+		return err
+	}
+	logger.Infof("allocated image %s/%s in %s", allocation.Pool, allocation.Image, allocation.Finished.Sub(allocation.Started))
+	return nil
+}
+
+// failed records the failure of the allocation, which is restarted at the next check
+func (a *ImageAllocator) failed(allocation ImageAllocation, err error) error {
+	allocation.Status = ImageAllocationFailed
+	allocation.Error = err.Error()
+	if updateErr := updateImageAllocation(a.context, a.namespace, allocation); updateErr != nil {
+		logger.Warningf("failed to update the allocation of image %s/%s. %+v", allocation.Pool, allocation.Image, updateErr)
+	}
+	return fmt.Errorf("failed to allocate image %s/%s. %+v", allocation.Pool, allocation.Image, err)
+}
+
+// claimDeleted returns whether the claim of the image was deleted, or replaced by a claim with the same name, before
+// the volume of the image was created. The volume has the name of the image, and once it is created it owns the image.
+func (a *ImageAllocator) claimDeleted(allocation ImageAllocation) bool {
+	if allocation.ClaimUID == "" {
+		return false
+	}
+	claim, err := a.context.Clientset.CoreV1().PersistentVolumeClaims(allocation.ClaimNamespace).Get(allocation.ClaimName, metav1.GetOptions{})
+	if err == nil && string(claim.UID) == allocation.ClaimUID {
+		return false
+	}
+	if err != nil && !errors.IsNotFound(err) {
+		logger.Warningf("failed to get claim %s/%s of image %s/%s. %+v", allocation.ClaimNamespace, allocation.ClaimName, allocation.Pool, allocation.Image, err)
+		return false
+	}
+	_, err = a.context.Clientset.CoreV1().PersistentVolumes().Get(allocation.Image, metav1.GetOptions{})
+	return errors.IsNotFound(err)
+}
+
+// removeOrphan removes the image of a deleted claim and its allocation
+func (a *ImageAllocator) removeOrphan(allocation ImageAllocation) error {
+	logger.Infof("removing image %s/%s since claim %s/%s was deleted before its volume was created",
+		allocation.Pool, allocation.Image, allocation.ClaimNamespace, allocation.ClaimName)
+	if a.imageExists(allocation) {
+		if err := ceph.DeleteImage(a.context, a.namespace, allocation.Image, allocation.Pool); err != nil {
+			return fmt.Errorf("failed to remove the image of deleted claim %s/%s. %+v", allocation.ClaimNamespace, allocation.ClaimName, err)
+		}
+	}
+	return removeImageAllocation(a.context, a.namespace, allocation)
+}
+
+// imageExists returns whether the queued image is still in its pool
+func (a *ImageAllocator) imageExists(allocation ImageAllocation) bool {
+	images, err := ceph.ListImages(a.context, a.namespace, allocation.Pool)
+	if err != nil {
+		return true
+	}
+	for _, image := range images {
+		if image.Name == allocation.Image {
+			return true
+		}
+	}
+	return false
+}
+
+// imageAllocationKey is the key of the image in the config map, which must be a valid key even for the images in the
+// rados namespaces of a pool
+func imageAllocationKey(allocation ImageAllocation) string {
+	return fmt.Sprintf("%s.%s", strings.Replace(allocation.Pool, "/", ".", -1), allocation.Image)
+}
+
+// loadImageAllocations returns the images in the allocation queue
+func loadImageAllocations(context *clusterd.Context, namespace string) ([]ImageAllocation, error) {
+	var allocations []ImageAllocation
+	cm, err := context.Clientset.CoreV1().ConfigMaps(namespace).Get(ImageAllocationsConfigMapName, metav1.GetOptions{})
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return allocations, nil
+		}
+		return nil, fmt.Errorf("failed to get configmap %s. %+v", ImageAllocationsConfigMapName, err)
+	}
+	for key, data := range cm.Data {
+		var allocation ImageAllocation
+		if err := json.Unmarshal([]byte(data), &allocation); err != nil {
+			logger.Warningf("ignoring the invalid image allocation %s. %+v", key, err)
+			continue
+		}
+		allocations = append(allocations, allocation)
+	}
+	return allocations, nil
+}
+
+// updateImageAllocation sets the allocation of the image in the config map
+func updateImageAllocation(context *clusterd.Context, namespace string, allocation ImageAllocation) error {
+	data, err := json.Marshal(allocation)
+	if err != nil {
+		return fmt.Errorf("failed to marshal the allocation of image %s/%s. %+v", allocation.Pool, allocation.Image, err)
+	}
+	imageAllocationsLock.Lock()
+	defer imageAllocationsLock.Unlock()
+	return k8sutil.ModifyConfigMap(context.Clientset, namespace, ImageAllocationsConfigMapName, nil, func(cm *v1.ConfigMap) {
+		cm.Data[imageAllocationKey(allocation)] = string(data)
+	})
+}
+
+// removeImageAllocation removes the image from the config map
+func removeImageAllocation(context *clusterd.Context, namespace string, allocation ImageAllocation) error {
+	imageAllocationsLock.Lock()
+	defer imageAllocationsLock.Unlock()
+	return k8sutil.ModifyConfigMap(context.Clientset, namespace, ImageAllocationsConfigMapName, nil, func(cm *v1.ConfigMap) {
+		delete(cm.Data, imageAllocationKey(allocation))
+	})
+}
@@ -0,0 +1,196 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pool
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/rook/rook/pkg/clusterd"
+	testop "github.com/rook/rook/pkg/operator/test"
+	exectest "github.com/rook/rook/pkg/util/exec/test"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestImageAllocationQueue(t *testing.T) {
+	allocated := 0
+	allocateErr := error(nil)
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithOutput: func(debug bool, actionName string, command string, args ...string) (string, error) {
+			switch {
+			case command == "rbd" && args[0] == "info":
+				assert.Equal(t, "replicapool/team-a/image1", args[1])
+				return `{"name":"image1","size":10485760,"objects":3,"order":22,"block_name_prefix":"rbd_data.10226b8b4567",` +
+					`"data_pool":"ecpool","features":["layering","exclusive-lock","object-map"]}`, nil
+			case command == "rbd" && args[0] == "bench":
+				// all the objects are written in one command, one object per write
+				assert.Equal(t, []string{"bench", "replicapool/team-a/image1", "--io-type", "write", "--io-pattern", "seq",
+					"--io-size", "4194304", "--io-total", "10485760"}, args[:10])
+				if allocateErr != nil {
+					return "", allocateErr
+				}
+				allocated++
+				return "", nil
+			}
+			return "", fmt.Errorf("unexpected command %s '%v'", command, args)
+		},
+	}
+	context := &clusterd.Context{Executor: executor, Clientset: testop.New(1)}
+
+	allocation, err := QueueImageAllocation(context, "ns", "image1", "replicapool/team-a", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, ImageAllocationQueued, allocation.Status)
+	assert.Equal(t, uint64(3), allocation.Objects)
+	assert.Equal(t, 0, allocation.Progress())
+
+	// a failed allocation is recorded and restarted
+	allocateErr = fmt.Errorf("mock failure")
+	a := NewImageAllocator(context, "ns")
+	assert.NotNil(t, a.AllocateQueued(make(chan struct{})))
+	allocation, err = QueueImageAllocation(context, "ns", "image1", "replicapool/team-a", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, ImageAllocationFailed, allocation.Status)
+	assert.Equal(t, 1, allocation.Attempts)
+	assert.Contains(t, allocation.Error, "mock failure")
+
+	allocateErr = nil
+	assert.Nil(t, a.AllocateQueued(make(chan struct{})))
+	assert.Equal(t, 1, allocated)
+	allocation, _ = QueueImageAllocation(context, "ns", "image1", "replicapool/team-a", nil)
+	assert.Equal(t, ImageAllocationAllocated, allocation.Status)
+	assert.Equal(t, uint64(3), allocation.Allocated)
+	assert.Equal(t, 100, allocation.Progress())
+	assert.Equal(t, "", allocation.Error)
+
+	// the allocated images are not allocated again
+	assert.Nil(t, a.AllocateQueued(make(chan struct{})))
+	assert.Equal(t, 1, allocated)
+}
+
+func TestImageAllocationConcurrency(t *testing.T) {
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithOutput: func(debug bool, actionName string, command string, args ...string) (string, error) {
+			if args[0] == "info" {
+				return `{"name":"image","size":4194304,"objects":1,"order":22}`, nil
+			}
+			return "", nil
+		},
+	}
+	context := &clusterd.Context{Executor: executor, Clientset: testop.New(1)}
+	for i := 0; i < 3; i++ {
+		_, err := QueueImageAllocation(context, "ns", fmt.Sprintf("image%d", i), "replicapool", nil)
+		assert.Nil(t, err)
+	}
+
+	// only the configured number of images are allocated at the same time, the others wait for the next check
+	defer func(concurrency int) { ImageAllocationConcurrency = concurrency }(ImageAllocationConcurrency)
+	ImageAllocationConcurrency = 2
+	a := NewImageAllocator(context, "ns")
+	assert.Nil(t, a.AllocateQueued(make(chan struct{})))
+	allocations, err := loadImageAllocations(context, "ns")
+	assert.Nil(t, err)
+	allocated := 0
+	for _, allocation := range allocations {
+		if allocation.Status == ImageAllocationAllocated {
+			allocated++
+		}
+	}
+	assert.Equal(t, 2, allocated)
+
+	assert.Nil(t, a.AllocateQueued(make(chan struct{})))
+	allocation, _ := QueueImageAllocation(context, "ns", "image2", "replicapool", nil)
+	assert.Equal(t, ImageAllocationAllocated, allocation.Status)
+}
+
+func TestImageAllocationDeletedClaim(t *testing.T) {
+	removed := []string{}
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithOutput: func(debug bool, actionName string, command string, args ...string) (string, error) {
+			switch args[0] {
+			case "info":
+				return `{"name":"image","size":4194304,"objects":1,"order":22}`, nil
+			case "ls":
+				return `[{"image":"pvc-1","size":4194304,"format":2},{"image":"pvc-2","size":4194304,"format":2}]`, nil
+			case "rm":
+				removed = append(removed, args[1])
+			}
+			return "", nil
+		},
+	}
+	clientset := testop.New(1)
+	context := &clusterd.Context{Executor: executor, Clientset: clientset}
+	claim := &v1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Name: "claim1", Namespace: "default", UID: "uid-1"}}
+	_, err := clientset.CoreV1().PersistentVolumeClaims("default").Create(claim)
+	assert.Nil(t, err)
+	_, err = QueueImageAllocation(context, "ns", "pvc-1", "replicapool", claim)
+	assert.Nil(t, err)
+
+	// the claim of the second image was deleted and replaced by a claim with the same name
+	claim2 := &v1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Name: "claim2", Namespace: "default", UID: "uid-2"}}
+	_, err = QueueImageAllocation(context, "ns", "pvc-2", "replicapool", claim2)
+	assert.Nil(t, err)
+	claim2.UID = "uid-3"
+	_, err = clientset.CoreV1().PersistentVolumeClaims("default").Create(claim2)
+	assert.Nil(t, err)
+
+	a := NewImageAllocator(context, "ns")
+	assert.Nil(t, a.AllocateQueued(make(chan struct{})))
+	assert.Equal(t, []string{"replicapool/pvc-2"}, removed)
+	allocations, err := loadImageAllocations(context, "ns")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(allocations))
+	assert.Equal(t, "pvc-1", allocations[0].Image)
+
+	// once the volume is created it owns the image, which is not removed with the claim
+	_, err = clientset.CoreV1().PersistentVolumes().Create(&v1.PersistentVolume{ObjectMeta: metav1.ObjectMeta{Name: "pvc-1"}})
+	assert.Nil(t, err)
+	assert.Nil(t, clientset.CoreV1().PersistentVolumeClaims("default").Delete("claim1", &metav1.DeleteOptions{}))
+	assert.Nil(t, a.AllocateQueued(make(chan struct{})))
+	assert.Equal(t, []string{"replicapool/pvc-2"}, removed)
+
+	// the image of a claim deleted after it was allocated is removed if its volume was not created
+	assert.Nil(t, clientset.CoreV1().PersistentVolumes().Delete("pvc-1", &metav1.DeleteOptions{}))
+	assert.Nil(t, a.AllocateQueued(make(chan struct{})))
+	assert.Equal(t, []string{"replicapool/pvc-2", "replicapool/pvc-1"}, removed)
+	allocations, err = loadImageAllocations(context, "ns")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(allocations))
+}
+
+func TestImageAllocationDeletedImage(t *testing.T) {
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithOutput: func(debug bool, actionName string, command string, args ...string) (string, error) {
+			switch {
+			case args[0] == "info":
+				return "", fmt.Errorf("image not found")
+			case args[0] == "ls":
+				return `[]`, nil
+			}
+			return "", fmt.Errorf("unexpected command %s '%v'", command, args)
+		},
+	}
+	context := &clusterd.Context{Executor: executor, Clientset: testop.New(1)}
+	assert.Nil(t, updateImageAllocation(context, "ns", ImageAllocation{Pool: "replicapool", Image: "image1", Status: ImageAllocationQueued}))
+
+	// an image that was deleted while it was queued is dropped from the queue
+	assert.Nil(t, NewImageAllocator(context, "ns").AllocateQueued(make(chan struct{})))
+	allocations, err := loadImageAllocations(context, "ns")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(allocations))
+}
@@ -0,0 +1,357 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pool
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rook/rook/pkg/clusterd"
+	ceph "github.com/rook/rook/pkg/daemon/ceph/client"
+	"github.com/rook/rook/pkg/operator/ceph/settings"
+	"github.com/rook/rook/pkg/operator/k8sutil"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// ImageDeletionsConfigMapName is the config map with the queue of the images to delete and their progress
+	ImageDeletionsConfigMapName = "rook-ceph-image-deletions"
+
+	// the queued images stay in the trash until the deletion queue removes them, or until they expire and are purged
+	// with the trash if the queue cannot delete them
+	imageDeletionTrashExpiry = 7 * 24 * time.Hour
+	// the deleted images are kept in the config map for a day to report their deletion
+	imageDeletionHistory = 24 * time.Hour
+	// the prefix of the name an image is restored with from the trash to be deleted in chunks
+	imageDeletionPrefix = "rook-deleting-"
+
+	// ImageDeletionQueued is the status of an image that waits to be deleted
+	ImageDeletionQueued = "queued"
+	// ImageDeletionDeleting is the status of the image that is being deleted
+	ImageDeletionDeleting = "deleting"
+	// ImageDeletionDeleted is the status of an image whose objects were all deleted
+	ImageDeletionDeleted = "deleted"
+	// ImageDeletionFailed is the status of an image whose deletion failed and is attempted again at the next check
+	ImageDeletionFailed = "failed"
+)
+
+var (
+	// ImageDeletionInterval is the interval to look for queued images to delete
+	ImageDeletionInterval = settings.NewDuration(30 * time.Second)
+	// ImageDeletionConcurrency is how many objects of an image are deleted at the same time. The rbd default is used
+	// if it is zero.
+	ImageDeletionConcurrency = settings.NewInt(4)
+	// ImageDeletionRate is the average number of objects per second the images are deleted at. The rate is not
+	// limited if it is zero.
+	ImageDeletionRate = settings.NewInt(0)
+
+	// when the rate is limited, the objects are deleted in chunks of the objects that are deleted in this time at the
+	// rate
+	imageDeletionChunkTime = 10 * time.Second
+)
+
+// ImageDeletion is an image in the deletion queue with the progress of its deletion
+type ImageDeletion struct {
+	Pool     string    `json:"pool"`
+	Image    string    `json:"image"`
+	ID       string    `json:"id"`
+	Objects  uint64    `json:"objects"`
+	Deleted  uint64    `json:"deleted"`
+	Status   string    `json:"status"`
+	Queued   time.Time `json:"queued"`
+	Started  time.Time `json:"started"`
+	Finished time.Time `json:"finished"`
+	Attempts int       `json:"attempts,omitempty"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// QueueImageDeletion moves the image to the trash and queues it to be deleted in the background by the deletion
+// queue of the cluster. The image disappears from the pool at once, while its objects are removed at the throttled
+// rate of the queue.
+func QueueImageDeletion(context *clusterd.Context, namespace, image, pool string) error {
+	info, err := ceph.GetImageInfo(context, namespace, image, pool)
+	if err != nil {
+		return err
+	}
+	id := info.ID()
+	if id == "" {
+		return fmt.Errorf("failed to find the id of image %s in pool %s", image, pool)
+	}
+
+	if err := ceph.TrashImage(context, namespace, image, pool, time.Now().Add(imageDeletionTrashExpiry)); err != nil {
+		return err
+	}
+	deletion := ImageDeletion{Pool: pool, Image: image, ID: id, Objects: info.Objects, Status: ImageDeletionQueued, Queued: time.Now()}
+	if err := updateImageDeletion(context, namespace, deletion); err != nil {
+		// the image is purged with the trash when it expires
+		return fmt.Errorf("failed to queue image %s/%s that was moved to the trash. %+v", pool, image, err)
+	}
+	logger.Infof("queued the deletion of image %s/%s with %d objects", pool, image, info.Objects)
+	return nil
+}
+
+// ImageDeleter deletes the queued images one at a time at the configured concurrency and rate
+type ImageDeleter struct {
+	context   *clusterd.Context
+	namespace string
+}
+
+// NewImageDeleter creates a new image deleter for the cluster in the namespace
+func NewImageDeleter(context *clusterd.Context, namespace string) *ImageDeleter {
+	return &ImageDeleter{context: context, namespace: namespace}
+}
+
+// Start periodically deletes the queued images
+func (d *ImageDeleter) Start(stopCh chan struct{}) {
+	for {
+		select {
+		case <-stopCh:
+			logger.Infof("stopping the image deleter in namespace %s", d.namespace)
+			return
+
+		case <-time.After(ImageDeletionInterval.Get()):
+			if err := d.DeleteQueued(stopCh); err != nil {
+				logger.Warningf("failed to delete the queued images in namespace %s. %+v", d.namespace, err)
+			}
+		}
+	}
+}
+
+// DeleteQueued deletes the queued images in the order they were queued, including the images whose deletion failed
+// or was interrupted, and drops the deleted images from the history when they are older than a day
+func (d *ImageDeleter) DeleteQueued(stopCh chan struct{}) error {
+	deletions, err := loadImageDeletions(d.context, d.namespace)
+	if err != nil {
+		return err
+	}
+
+	var pending []ImageDeletion
+	for _, deletion := range deletions {
+		if deletion.Status != ImageDeletionDeleted {
+			pending = append(pending, deletion)
+		} else if time.Since(deletion.Finished) > imageDeletionHistory {
+			if err := removeImageDeletion(d.context, d.namespace, deletion); err != nil {
+				logger.Warningf("failed to remove deleted image %s/%s from the history. %+v", deletion.Pool, deletion.Image, err)
+			}
+		}
+	}
+	sort.Slice(pending, func(i, j int) bool { return pending[i].Queued.Before(pending[j].Queued) })
+
+	failed := 0
+	for _, deletion := range pending {
+		select {
+		case <-stopCh:
+			return nil
+		default:
+		}
+		if err := d.delete(deletion, stopCh); err != nil {
+			logger.Errorf("%+v", err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("failed to delete %d images", failed)
+	}
+	return nil
+}
+
+// delete removes the image from the trash and records the progress in the deletion queue. When the rate is limited,
+// the objects of the image are deleted in chunks at no more than the rate.
+func (d *ImageDeleter) delete(deletion ImageDeletion, stopCh chan struct{}) error {
+	deletion.Status = ImageDeletionDeleting
+	deletion.Started = time.Now()
+	deletion.Attempts++
+	if err := updateImageDeletion(d.context, d.namespace, deletion); err != nil {
+		return err
+	}
+
+	logger.Infof("deleting image %s/%s with %d objects", deletion.Pool, deletion.Image, deletion.Objects)
+	var err error
+	finished := true
+	if rate := ImageDeletionRate.Get(); rate > 0 {
+		finished, err = d.deleteInChunks(&deletion, rate, stopCh)
+	} else {
+		err = ceph.DeleteTrashImage(d.context, d.namespace, deletion.Pool, deletion.ID, ImageDeletionConcurrency.Get())
+	}
+	if err != nil && (d.inTrash(deletion) || d.restored(deletion)) {
+		deletion.Status = ImageDeletionFailed
+		deletion.Error = err.Error()
+		if updateErr := updateImageDeletion(d.context, d.namespace, deletion); updateErr != nil {
+			logger.Warningf("failed to update the deletion of image %s/%s. %+v", deletion.Pool, deletion.Image, updateErr)
+		}
+		return err
+	}
+	if !finished {
+		// the deletion is resumed from the remaining objects
+		return updateImageDeletion(d.context, d.namespace, deletion)
+	}
+
+	deletion.Status = ImageDeletionDeleted
+	deletion.Deleted = deletion.Objects
+	deletion.Finished = time.Now()
+	deletion.Error = ""
+	if err := updateImageDeletion(d.context, d.namespace, deletion); err != nil {
+		return err
+	}
+	logger.Infof("deleted image %s/%s in %s", deletion.Pool, deletion.Image, deletion.Finished.Sub(deletion.Started))
+	return nil
+}
+
+// deleteInChunks restores the image from the trash with a name reserved for the queue and shrinks it by a chunk of
+// objects at a time, waiting after each chunk until its objects were deleted at no more than the rate. The image is
+// restored since the objects of an image in the trash can only be removed all at once. It returns whether the image
+// was deleted, or false if the deletion was stopped.
+func (d *ImageDeleter) deleteInChunks(deletion *ImageDeletion, rate int, stopCh chan struct{}) (bool, error) {
+	name := imageDeletionName(*deletion)
+	if d.inTrash(*deletion) {
+		if err := ceph.RestoreTrashImageAs(d.context, d.namespace, deletion.Pool, deletion.ID, name); err != nil {
+			return false, err
+		}
+	}
+	info, err := ceph.GetImageInfo(d.context, d.namespace, name, deletion.Pool)
+	if err != nil {
+		if !d.restored(*deletion) {
+			// the image was deleted by a previous attempt
+			return true, nil
+		}
+		return false, err
+	}
+
+	chunk := uint64(rate) * uint64(imageDeletionChunkTime) / uint64(time.Second)
+	if chunk == 0 {
+		chunk = 1
+	}
+	objectSize := info.ObjectSize()
+	objects := (info.Size + objectSize - 1) / objectSize
+	start := time.Now()
+	deleted := uint64(0)
+	for objects > chunk {
+		objects -= chunk
+		if err := ceph.ShrinkImage(d.context, d.namespace, name, deletion.Pool, objects*objectSize, ImageDeletionConcurrency.Get()); err != nil {
+			return false, err
+		}
+		deleted += chunk
+		if deletion.Objects > objects {
+			deletion.Deleted = deletion.Objects - objects
+		}
+		if err := updateImageDeletion(d.context, d.namespace, *deletion); err != nil {
+			logger.Warningf("failed to update the deletion of image %s/%s. %+v", deletion.Pool, deletion.Image, err)
+		}
+
+		select {
+		case <-stopCh:
+			return false, nil
+		case <-time.After(objectPace(deleted, rate) - time.Since(start)):
+		}
+	}
+	return true, ceph.DeleteImage(d.context, d.namespace, name, deletion.Pool)
+}
+
+// inTrash returns whether the queued image is still in the trash, so a deletion that failed after the image was
+// removed by a previous attempt or by hand is completed
+func (d *ImageDeleter) inTrash(deletion ImageDeletion) bool {
+	images, err := ceph.ListTrash(d.context, d.namespace, deletion.Pool)
+	if err != nil {
+		return true
+	}
+	for _, image := range images {
+		if image.ID == deletion.ID {
+			return true
+		}
+	}
+	return false
+}
+
+// restored returns whether the queued image was restored from the trash to be deleted in chunks and is still in the
+// pool
+func (d *ImageDeleter) restored(deletion ImageDeletion) bool {
+	images, err := ceph.ListImages(d.context, d.namespace, deletion.Pool)
+	if err != nil {
+		return true
+	}
+	name := imageDeletionName(deletion)
+	for _, image := range images {
+		if image.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// imageDeletionName is the name the image is restored with from the trash to be deleted in chunks
+func imageDeletionName(deletion ImageDeletion) string {
+	return imageDeletionPrefix + deletion.ID
+}
+
+// objectPace returns the minimum time to delete or write the objects at the rate, or zero if the rate is not limited
+func objectPace(objects uint64, rate int) time.Duration {
+	if rate <= 0 {
+		return 0
+	}
+	return time.Duration(objects) * time.Second / time.Duration(rate)
+}
+
+// imageDeletionKey is the key of the image in the config map, which must be a valid key even for the images in the
+// rados namespaces of a pool
+func imageDeletionKey(deletion ImageDeletion) string {
+	return fmt.Sprintf("%s.%s", strings.Replace(deletion.Pool, "/", ".", -1), deletion.ID)
+}
+
+// loadImageDeletions returns the images in the deletion queue
+func loadImageDeletions(context *clusterd.Context, namespace string) ([]ImageDeletion, error) {
+	var deletions []ImageDeletion
+	cm, err := context.Clientset.CoreV1().ConfigMaps(namespace).Get(ImageDeletionsConfigMapName, metav1.GetOptions{})
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return deletions, nil
+		}
+		return nil, fmt.Errorf("failed to get configmap %s. %+v", ImageDeletionsConfigMapName, err)
+	}
+	for key, data := range cm.Data {
+		var deletion ImageDeletion
+		if err := json.Unmarshal([]byte(data), &deletion); err != nil {
+			logger.Warningf("ignoring the invalid image deletion %s. %+v", key, err)
+			continue
+		}
+		deletions = append(deletions, deletion)
+	}
+	return deletions, nil
+}
+
+// updateImageDeletion sets the deletion of the image in the config map, retrying when the config map was changed
+// concurrently by the provisioner
+func updateImageDeletion(context *clusterd.Context, namespace string, deletion ImageDeletion) error {
+	data, err := json.Marshal(deletion)
+	if err != nil {
+		return fmt.Errorf("failed to marshal the deletion of image %s/%s. %+v", deletion.Pool, deletion.Image, err)
+	}
+	return k8sutil.ModifyConfigMap(context.Clientset, namespace, ImageDeletionsConfigMapName, nil, func(cm *v1.ConfigMap) {
+		cm.Data[imageDeletionKey(deletion)] = string(data)
+	})
+}
+
+// removeImageDeletion removes the image from the config map
+func removeImageDeletion(context *clusterd.Context, namespace string, deletion ImageDeletion) error {
+	return k8sutil.ModifyConfigMap(context.Clientset, namespace, ImageDeletionsConfigMapName, nil, func(cm *v1.ConfigMap) {
+		delete(cm.Data, imageDeletionKey(deletion))
+	})
+}
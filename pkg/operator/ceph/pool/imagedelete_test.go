@@ -0,0 +1,141 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pool
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rook/rook/pkg/clusterd"
+	testop "github.com/rook/rook/pkg/operator/test"
+	exectest "github.com/rook/rook/pkg/util/exec/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestImageDeletionQueue(t *testing.T) {
+	trashed := []string{}
+	removed := []string{}
+	trash := `[]`
+	removeErr := error(nil)
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithOutput: func(debug bool, actionName string, command string, args ...string) (string, error) {
+			switch {
+			case args[0] == "info":
+				return `{"name":"image1","size":41943040,"objects":10,"block_name_prefix":"rbd_data.10226b8b4567"}`, nil
+			case args[0] == "trash" && args[1] == "mv":
+				trashed = append(trashed, args[2])
+				return "", nil
+			case args[0] == "trash" && args[1] == "rm":
+				assert.Equal(t, "--force", args[3])
+				assert.Equal(t, "--rbd-concurrent-management-ops=4", args[4])
+				removed = append(removed, args[2])
+				return "", removeErr
+			case args[0] == "trash" && args[1] == "ls":
+				return trash, nil
+			}
+			return "", fmt.Errorf("unexpected rbd command '%v'", args)
+		},
+	}
+	context := &clusterd.Context{Executor: executor, Clientset: testop.New(1)}
+
+	assert.Nil(t, QueueImageDeletion(context, "ns", "image1", "replicapool/team-a"))
+	assert.Equal(t, []string{"replicapool/team-a/image1"}, trashed)
+	deletions, err := loadImageDeletions(context, "ns")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(deletions))
+	assert.Equal(t, ImageDeletionQueued, deletions[0].Status)
+	assert.Equal(t, "10226b8b4567", deletions[0].ID)
+	assert.Equal(t, uint64(10), deletions[0].Objects)
+
+	// a failed deletion is recorded and attempted again
+	removeErr = fmt.Errorf("mock failure")
+	trash = `[{"id":"10226b8b4567","name":"image1"}]`
+	d := NewImageDeleter(context, "ns")
+	assert.NotNil(t, d.DeleteQueued(make(chan struct{})))
+	deletions, _ = loadImageDeletions(context, "ns")
+	assert.Equal(t, ImageDeletionFailed, deletions[0].Status)
+	assert.Equal(t, 1, deletions[0].Attempts)
+
+	removeErr = nil
+	assert.Nil(t, d.DeleteQueued(make(chan struct{})))
+	assert.Equal(t, []string{"replicapool/team-a/10226b8b4567", "replicapool/team-a/10226b8b4567"}, removed)
+	deletions, _ = loadImageDeletions(context, "ns")
+	assert.Equal(t, ImageDeletionDeleted, deletions[0].Status)
+	assert.Equal(t, 2, deletions[0].Attempts)
+	assert.Equal(t, "", deletions[0].Error)
+
+	// the deleted images are not deleted again
+	assert.Nil(t, d.DeleteQueued(make(chan struct{})))
+	assert.Equal(t, 2, len(removed))
+}
+
+func TestImageDeletionChunks(t *testing.T) {
+	commands := []string{}
+	restored := false
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithOutput: func(debug bool, actionName string, command string, args ...string) (string, error) {
+			switch {
+			case args[0] == "info" && args[1] == "replicapool/image1":
+				return `{"name":"image1","size":41943040,"objects":10,"order":22,"block_name_prefix":"rbd_data.10226b8b4567"}`, nil
+			case args[0] == "info" && args[1] == "replicapool/rook-deleting-10226b8b4567":
+				return `{"name":"rook-deleting-10226b8b4567","size":41943040,"objects":10,"order":22}`, nil
+			case args[0] == "trash" && args[1] == "mv":
+				return "", nil
+			case args[0] == "trash" && args[1] == "ls":
+				if restored {
+					return `[]`, nil
+				}
+				return `[{"id":"10226b8b4567","name":"image1"}]`, nil
+			case args[0] == "trash" && args[1] == "restore":
+				restored = true
+			}
+			// leave out the config and keyring args
+			end := 0
+			for end < len(args) && !strings.HasPrefix(args[end], "--cluster=") {
+				end++
+			}
+			commands = append(commands, strings.Join(args[:end], " "))
+			return "", nil
+		},
+	}
+	context := &clusterd.Context{Executor: executor, Clientset: testop.New(1)}
+	assert.Nil(t, QueueImageDeletion(context, "ns", "image1", "replicapool"))
+
+	// the image is restored with a reserved name and shrunk by the objects that are deleted in a chunk of time
+	defer ImageDeletionRate.Store(ImageDeletionRate.Get())
+	defer func(chunkTime time.Duration) { imageDeletionChunkTime = chunkTime }(imageDeletionChunkTime)
+	ImageDeletionRate.Store(1000)
+	imageDeletionChunkTime = 4 * time.Millisecond
+	assert.Nil(t, NewImageDeleter(context, "ns").DeleteQueued(make(chan struct{})))
+	assert.Equal(t, []string{
+		"trash restore replicapool/10226b8b4567 --image rook-deleting-10226b8b4567",
+		"resize replicapool/rook-deleting-10226b8b4567 --size 24576K --allow-shrink --rbd-concurrent-management-ops=4",
+		"resize replicapool/rook-deleting-10226b8b4567 --size 8192K --allow-shrink --rbd-concurrent-management-ops=4",
+		"rm replicapool/rook-deleting-10226b8b4567",
+	}, commands)
+	deletions, _ := loadImageDeletions(context, "ns")
+	assert.Equal(t, ImageDeletionDeleted, deletions[0].Status)
+	assert.Equal(t, uint64(10), deletions[0].Deleted)
+}
+
+func TestDeletionPace(t *testing.T) {
+	assert.Equal(t, time.Duration(0), objectPace(1000, 0))
+	assert.Equal(t, 10*time.Second, objectPace(1000, 100))
+	assert.Equal(t, 250*time.Millisecond, objectPace(1, 4))
+}
@@ -0,0 +1,189 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pool
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/rook/rook/pkg/clusterd"
+	ceph "github.com/rook/rook/pkg/daemon/ceph/client"
+	"github.com/rook/rook/pkg/operator/k8sutil"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// the config map of each pool records the target pool of the images that were migrated out of it
+	migrationStoreNameFmt = "rook-ceph-pool-%s-migration"
+	// images that are being copied are recorded with the prefix so they are not attached until the copy is done
+	migratingPrefix  = "migrating:"
+	maxMigrationHops = 10
+)
+
+// MigrationStatus is the result of migrating the images of a pool
+type MigrationStatus struct {
+	Migrated []string
+	InUse    []string
+	Failed   map[string]error
+}
+
+// MigrateImages copies the block images of the source pool to the target pool. Each image is switched to the
+// target pool when its copy completes, so volumes are attached from the target pool from then on. Images that
+// are in use are skipped. The migration can be run again to migrate them after their consumers are stopped.
+// The source images are not deleted.
+func MigrateImages(context *clusterd.Context, namespace, source, target, dataPool string) (*MigrationStatus, error) {
+	if source == target {
+		return nil, fmt.Errorf("source and target pool are both %s", source)
+	}
+
+	migrations, err := getMigrations(context.Clientset, namespace, source)
+	if err != nil {
+		return nil, err
+	}
+	images, err := ceph.ListImages(context, namespace, source)
+	if err != nil {
+		return nil, err
+	}
+	targetImages, err := ceph.ListImages(context, namespace, target)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &MigrationStatus{Failed: map[string]error{}}
+	for i, image := range images {
+		if strings.HasPrefix(image.Name, imageDeletionPrefix) {
+			// the image is being deleted by the deletion queue
+			continue
+		}
+		if pool, ok := migrations[image.Name]; ok && pool == target {
+			status.Migrated = append(status.Migrated, image.Name)
+			continue
+		}
+
+		logger.Infof("migrating image %d/%d %s from pool %s to %s", i+1, len(images), image.Name, source, target)
+		inUse, err := migrateImage(context, namespace, image.Name, source, target, dataPool, targetImages)
+		if err != nil {
+			logger.Errorf("failed to migrate image %s. %+v", image.Name, err)
+			status.Failed[image.Name] = err
+		} else if inUse {
+			logger.Warningf("skipping image %s that is in use", image.Name)
+			status.InUse = append(status.InUse, image.Name)
+		} else {
+			status.Migrated = append(status.Migrated, image.Name)
+		}
+	}
+
+	logger.Infof("migrated %d/%d images from pool %s to %s. %d in use, %d failed",
+		len(status.Migrated), len(images), source, target, len(status.InUse), len(status.Failed))
+	return status, nil
+}
+
+// MigratedPool returns the pool where the image is stored after the migrations out of the pool
+func MigratedPool(clientset kubernetes.Interface, namespace, pool, image string) (string, error) {
+	// follow the image through the pools it was migrated to
+	for hops := 0; hops < maxMigrationHops; hops++ {
+		migrations, err := getMigrations(clientset, namespace, pool)
+		if err != nil {
+			return "", err
+		}
+
+		target, ok := migrations[image]
+		if !ok {
+			return pool, nil
+		}
+		if strings.HasPrefix(target, migratingPrefix) {
+			return "", fmt.Errorf("image %s is being migrated from pool %s to %s", image, pool, strings.TrimPrefix(target, migratingPrefix))
+		}
+		pool = target
+	}
+	return "", fmt.Errorf("image %s was migrated more than %d times", image, maxMigrationHops)
+}
+
+func migrateImage(context *clusterd.Context, namespace, image, source, target, dataPool string, targetImages []ceph.CephBlockImage) (bool, error) {
+	inUse, err := isImageInUse(context, namespace, image, source)
+	if err != nil || inUse {
+		return inUse, err
+	}
+
+	// block attaching the image while it is copied, then check again for a consumer that attached in the meantime
+	if err := setMigration(context.Clientset, namespace, source, image, migratingPrefix+target); err != nil {
+		return false, err
+	}
+	inUse, err = isImageInUse(context, namespace, image, source)
+	if err != nil || inUse {
+		if clearErr := setMigration(context.Clientset, namespace, source, image, ""); clearErr != nil {
+			logger.Warningf("failed to clear the migration of image %s. %+v", image, clearErr)
+		}
+		return inUse, err
+	}
+
+	// remove the partial copy of an interrupted migration
+	for _, targetImage := range targetImages {
+		if targetImage.Name == image {
+			logger.Infof("removing the partial copy of image %s from pool %s", image, target)
+			if err := ceph.DeleteImage(context, namespace, image, target); err != nil {
+				return false, err
+			}
+		}
+	}
+
+	if err := ceph.CopyImage(context, namespace, image, source, target, dataPool); err != nil {
+		return false, err
+	}
+	return false, setMigration(context.Clientset, namespace, source, image, target)
+}
+
+func isImageInUse(context *clusterd.Context, namespace, image, pool string) (bool, error) {
+	watchers, err := ceph.ListImageWatchers(context, namespace, image, pool)
+	if err != nil {
+		return false, err
+	}
+	return len(watchers) > 0, nil
+}
+
+func migrationStoreName(pool string) string {
+	return fmt.Sprintf(migrationStoreNameFmt, pool)
+}
+
+func getMigrations(clientset kubernetes.Interface, namespace, pool string) (map[string]string, error) {
+	cm, err := clientset.CoreV1().ConfigMaps(namespace).Get(migrationStoreName(pool), metav1.GetOptions{})
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return map[string]string{}, nil
+		}
+		return nil, fmt.Errorf("failed to get migrations of pool %s. %+v", pool, err)
+	}
+	return cm.Data, nil
+}
+
+// setMigration records the target pool of the image. An empty target removes the record.
+func setMigration(clientset kubernetes.Interface, namespace, pool, image, target string) error {
+	err := k8sutil.ModifyConfigMap(clientset, namespace, migrationStoreName(pool), nil, func(cm *v1.ConfigMap) {
+		if target == "" {
+			delete(cm.Data, image)
+		} else {
+			cm.Data[image] = target
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save migration of image %s. %+v", image, err)
+	}
+	return nil
+}
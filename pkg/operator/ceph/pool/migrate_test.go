@@ -0,0 +1,89 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package pool
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/rook/rook/pkg/clusterd"
+	testop "github.com/rook/rook/pkg/operator/test"
+	exectest "github.com/rook/rook/pkg/util/exec/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMigrateImages(t *testing.T) {
+	copied := []string{}
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithOutput: func(debug bool, actionName string, command string, args ...string) (string, error) {
+			switch {
+			case command == "rbd" && args[0] == "ls" && args[2] == "source":
+				return `[{"image":"image1","size":1048576,"format":2},{"image":"image2","size":1048576,"format":2}]`, nil
+			case command == "rbd" && args[0] == "ls" && args[2] == "target":
+				return `[]`, nil
+			case command == "rbd" && args[0] == "status" && args[1] == "source/image2":
+				return `{"watchers":[{"address":"10.0.0.1:0/3928","client":4157,"cookie":1}]}`, nil
+			case command == "rbd" && args[0] == "status":
+				return `{"watchers":[]}`, nil
+			case command == "rbd" && args[0] == "cp":
+				assert.Equal(t, "--data-pool=ecpool", args[3])
+				copied = append(copied, args[1])
+				return "", nil
+			}
+			return "", fmt.Errorf("unexpected rbd command '%v'", args)
+		},
+	}
+	clientset := testop.New(3)
+	context := &clusterd.Context{Executor: executor, Clientset: clientset}
+
+	_, err := MigrateImages(context, "ns", "source", "source", "")
+	assert.NotNil(t, err)
+
+	// the image in use is skipped
+	status, err := MigrateImages(context, "ns", "source", "target", "ecpool")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"image1"}, status.Migrated)
+	assert.Equal(t, []string{"image2"}, status.InUse)
+	assert.Equal(t, 0, len(status.Failed))
+	assert.Equal(t, []string{"source/image1"}, copied)
+
+	// the migrated image is attached from the target pool
+	pool, err := MigratedPool(clientset, "ns", "source", "image1")
+	assert.Nil(t, err)
+	assert.Equal(t, "target", pool)
+	pool, err = MigratedPool(clientset, "ns", "source", "image2")
+	assert.Nil(t, err)
+	assert.Equal(t, "source", pool)
+
+	// the migrated image is not copied again
+	status, err = MigrateImages(context, "ns", "source", "target", "ecpool")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"image1"}, status.Migrated)
+	assert.Equal(t, 1, len(copied))
+
+	// an image cannot be attached while it is copied
+	err = setMigration(clientset, "ns", "source", "image2", migratingPrefix+"target")
+	assert.Nil(t, err)
+	_, err = MigratedPool(clientset, "ns", "source", "image2")
+	assert.NotNil(t, err)
+
+	// a chain of migrations is followed to the last pool
+	err = setMigration(clientset, "ns", "target", "image1", "final")
+	assert.Nil(t, err)
+	pool, err = MigratedPool(clientset, "ns", "source", "image1")
+	assert.Nil(t, err)
+	assert.Equal(t, "final", pool)
+}
@@ -0,0 +1,133 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pool
+
+import (
+	"fmt"
+
+	cephv1beta1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1beta1"
+	"github.com/rook/rook/pkg/clusterd"
+	ceph "github.com/rook/rook/pkg/daemon/ceph/client"
+	"github.com/rook/rook/pkg/operator/k8sutil"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	namespaceUserNameKey  = "userName"
+	namespaceSecretKeyKey = "secretKey"
+)
+
+// NamespaceSecretName returns the name of the secret holding the credentials of the client that is restricted
+// to the given namespace of the pool
+func NamespaceSecretName(poolName, namespace string) string {
+	return fmt.Sprintf("rook-ceph-pool-%s-%s", poolName, namespace)
+}
+
+// Create the rados namespaces of the pool, along with a client key for each namespace that is only
+// authorized to access the images in that namespace
+func createNamespaces(context *clusterd.Context, p *cephv1beta1.Pool) error {
+	if len(p.Spec.Namespaces) == 0 {
+		return nil
+	}
+
+	existing, err := ceph.ListNamespaces(context, p.Namespace, p.Name)
+	if err != nil {
+		return fmt.Errorf("failed to list namespaces in pool %s. %+v", p.Name, err)
+	}
+	found := map[string]bool{}
+	for _, ns := range existing {
+		found[ns.Name] = true
+	}
+
+	var clients []string
+	for _, ns := range p.Spec.Namespaces {
+		if !found[ns] {
+			logger.Infof("creating namespace %s in pool %s", ns, p.Name)
+			if err := ceph.CreateNamespace(context, p.Namespace, p.Name, ns); err != nil {
+				return err
+			}
+		}
+
+		if err := createNamespaceSecret(context, p, ns); err != nil {
+			return fmt.Errorf("failed to create client for namespace %s in pool %s. %+v", ns, p.Name, err)
+		}
+		clients = append(clients, ceph.NamespaceClientName(p.Name, ns))
+	}
+
+	if err := recordCreatedResources(context, p.Namespace, createdClient, clients...); err != nil {
+		logger.Warningf("failed to record the namespace clients of pool %s. %+v", p.Name, err)
+	}
+	return nil
+}
+
+func createNamespaceSecret(context *clusterd.Context, p *cephv1beta1.Pool, namespace string) error {
+	name := NamespaceSecretName(p.Name, namespace)
+	_, err := context.Clientset.CoreV1().Secrets(p.Namespace).Get(name, metav1.GetOptions{})
+	if err == nil {
+		logger.Debugf("client secret %s for namespace %s already exists", name, namespace)
+		return nil
+	}
+	if !errors.IsNotFound(err) {
+		return fmt.Errorf("failed to get secret %s. %+v", name, err)
+	}
+
+	key, err := ceph.CreateNamespaceClientKey(context, p.Namespace, p.Name, namespace)
+	if err != nil {
+		return err
+	}
+
+	secret := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: p.Namespace,
+		},
+		StringData: map[string]string{
+			namespaceUserNameKey:  ceph.NamespaceClientName(p.Name, namespace),
+			namespaceSecretKeyKey: key,
+		},
+		Type: k8sutil.RookType,
+	}
+	if _, err = context.Clientset.CoreV1().Secrets(p.Namespace).Create(secret); err != nil {
+		return fmt.Errorf("failed to save secret %s. %+v", name, err)
+	}
+
+	return nil
+}
+
+// Remove the clients and secrets of the pool namespaces. The namespaces themselves are removed with the pool.
+func deleteNamespaceClients(context *clusterd.Context, p *cephv1beta1.Pool) {
+	var deleted []string
+	for _, ns := range p.Spec.Namespaces {
+		client := ceph.NamespaceClientName(p.Name, ns)
+		if err := ceph.AuthDelete(context, p.Namespace, client); err != nil {
+			logger.Warningf("failed to delete client for namespace %s in pool %s. %+v", ns, p.Name, err)
+		} else {
+			deleted = append(deleted, client)
+		}
+
+		name := NamespaceSecretName(p.Name, ns)
+		err := context.Clientset.CoreV1().Secrets(p.Namespace).Delete(name, &metav1.DeleteOptions{})
+		if err != nil && !errors.IsNotFound(err) {
+			logger.Warningf("failed to delete secret %s. %+v", name, err)
+		}
+	}
+	if err := forgetCreatedResources(context, p.Namespace, deleted); err != nil {
+		logger.Warningf("%+v", err)
+	}
+}
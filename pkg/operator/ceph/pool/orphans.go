@@ -0,0 +1,284 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pool
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rook/rook/pkg/clusterd"
+	ceph "github.com/rook/rook/pkg/daemon/ceph/client"
+	"github.com/rook/rook/pkg/operator/ceph/settings"
+	"github.com/rook/rook/pkg/operator/k8sutil"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	namespaceSecretPrefix = "rook-ceph-pool-"
+	namespaceCapsPrefix   = "profile rbd pool="
+
+	// the config map with the erasure code profiles and clients that the operator created for the pools. Only these
+	// are ever deleted as orphans, so the entities that were created by hand are left alone even if their names match.
+	createdResourcesConfigMapName = "rook-ceph-pool-resources"
+	createdProfile                = "erasure-code-profile"
+	createdClient                 = "client"
+)
+
+var (
+	// OrphanCheckInterval is the interval to look for orphaned resources
+	OrphanCheckInterval = settings.NewDuration(time.Hour)
+	// OrphanCleanup is whether the orphaned resources are deleted when they are found, or only reported
+	OrphanCleanup = settings.NewBool(false)
+)
+
+// OrphanCollector periodically looks for resources that were left behind by pools that no longer exist
+type OrphanCollector struct {
+	context   *clusterd.Context
+	namespace string
+}
+
+// NewOrphanCollector creates a new orphan collector for the cluster in the namespace
+func NewOrphanCollector(context *clusterd.Context, namespace string) *OrphanCollector {
+	return &OrphanCollector{context: context, namespace: namespace}
+}
+
+// Start periodically reports the orphaned resources and deletes them if the cleanup is enabled
+func (c *OrphanCollector) Start(stopCh chan struct{}) {
+	for {
+		select {
+		case <-stopCh:
+			logger.Infof("stopping the orphan collector in namespace %s", c.namespace)
+			return
+
+		case <-time.After(OrphanCheckInterval.Get()):
+			if err := c.collect(); err != nil {
+				logger.Warningf("failed to collect orphans in namespace %s. %+v", c.namespace, err)
+			}
+		}
+	}
+}
+
+func (c *OrphanCollector) collect() error {
+	orphans, err := FindOrphans(c.context, c.namespace)
+	if err != nil {
+		return err
+	}
+	if orphans.Empty() {
+		logger.Debugf("no orphans found in namespace %s", c.namespace)
+		return nil
+	}
+
+	logger.Infof("found orphans in namespace %s. erasure code profiles: %v, clients: %v, secrets: %v",
+		c.namespace, orphans.ErasureCodeProfiles, orphans.Clients, orphans.Secrets)
+	if !OrphanCleanup.Get() {
+		return nil
+	}
+	return DeleteOrphans(c.context, c.namespace, orphans)
+}
+
+// Orphans are the resources that the operator created for pools that no longer exist
+type Orphans struct {
+	// ErasureCodeProfiles are the profiles created for erasure coded pools that were deleted
+	ErasureCodeProfiles []string
+	// Clients are the ceph users restricted to a namespace of a pool that is not in any pool crd
+	Clients []string
+	// Secrets are the secrets with the credentials of a namespace client that is not in any pool crd
+	Secrets []string
+}
+
+// Empty returns whether no orphans were found
+func (o *Orphans) Empty() bool {
+	return len(o.ErasureCodeProfiles) == 0 && len(o.Clients) == 0 && len(o.Secrets) == 0
+}
+
+// FindOrphans looks for the resources that were left behind for pools and namespaces that no longer exist
+func FindOrphans(context *clusterd.Context, namespace string) (*Orphans, error) {
+	pools, err := context.RookClientset.CephV1beta1().Pools(namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pools. %+v", err)
+	}
+	expectedClients := map[string]bool{}
+	expectedSecrets := map[string]bool{}
+	for _, p := range pools.Items {
+		for _, ns := range p.Spec.Namespaces {
+			expectedClients[ceph.NamespaceClientName(p.Name, ns)] = true
+			expectedSecrets[NamespaceSecretName(p.Name, ns)] = true
+		}
+	}
+
+	created, err := getCreatedResources(context, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	orphans := &Orphans{}
+	if orphans.ErasureCodeProfiles, err = findOrphanedProfiles(context, namespace, created); err != nil {
+		return nil, err
+	}
+
+	entities, err := ceph.AuthList(context, namespace)
+	if err != nil {
+		return nil, err
+	}
+	for _, entity := range entities {
+		if created[entity.Name] == createdClient && isNamespaceClient(entity) && !expectedClients[entity.Name] {
+			orphans.Clients = append(orphans.Clients, entity.Name)
+		}
+	}
+
+	secrets, err := context.Clientset.CoreV1().Secrets(namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list secrets. %+v", err)
+	}
+	for _, secret := range secrets.Items {
+		if secret.Type != k8sutil.RookType || !strings.HasPrefix(secret.Name, namespaceSecretPrefix) {
+			continue
+		}
+		_, inData := secret.Data[namespaceUserNameKey]
+		_, inStringData := secret.StringData[namespaceUserNameKey]
+		if (inData || inStringData) && !expectedSecrets[secret.Name] {
+			orphans.Secrets = append(orphans.Secrets, secret.Name)
+		}
+	}
+
+	return orphans, nil
+}
+
+// DeleteOrphans removes the orphaned resources. A failure to remove one of them does not stop the others
+// from being removed.
+func DeleteOrphans(context *clusterd.Context, namespace string, orphans *Orphans) error {
+	failed := 0
+	var deleted []string
+	for _, profile := range orphans.ErasureCodeProfiles {
+		logger.Infof("deleting orphaned erasure code profile %s", profile)
+		if err := ceph.DeleteErasureCodeProfile(context, namespace, profile); err != nil {
+			logger.Errorf("failed to delete erasure code profile %s. %+v", profile, err)
+			failed++
+			continue
+		}
+		deleted = append(deleted, profile)
+	}
+	for _, client := range orphans.Clients {
+		logger.Infof("deleting orphaned client %s", client)
+		if err := ceph.AuthDelete(context, namespace, client); err != nil {
+			logger.Errorf("%+v", err)
+			failed++
+			continue
+		}
+		deleted = append(deleted, client)
+	}
+	if err := forgetCreatedResources(context, namespace, deleted); err != nil {
+		logger.Warningf("%+v", err)
+	}
+	for _, secret := range orphans.Secrets {
+		logger.Infof("deleting orphaned secret %s", secret)
+		err := context.Clientset.CoreV1().Secrets(namespace).Delete(secret, &metav1.DeleteOptions{})
+		if err != nil && !errors.IsNotFound(err) {
+			logger.Errorf("failed to delete secret %s. %+v", secret, err)
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("failed to delete %d orphans", failed)
+	}
+	return nil
+}
+
+// the erasure code profiles that rook creates are named after their pool, so a profile that rook created is orphaned
+// when its pool is gone
+func findOrphanedProfiles(context *clusterd.Context, namespace string, created map[string]string) ([]string, error) {
+	profiles, err := ceph.ListErasureCodeProfiles(context, namespace)
+	if err != nil {
+		return nil, err
+	}
+	pools, err := ceph.ListPoolSummaries(context, namespace)
+	if err != nil {
+		return nil, err
+	}
+	existing := map[string]bool{}
+	for _, p := range pools {
+		existing[ceph.GetErasureCodeProfileForPool(p.Name)] = true
+	}
+
+	var orphaned []string
+	for _, profile := range profiles {
+		if created[profile] == createdProfile && !existing[profile] {
+			orphaned = append(orphaned, profile)
+		}
+	}
+	return orphaned, nil
+}
+
+// a namespace client is recognized from the osd caps that restrict it to a single namespace of a pool
+func isNamespaceClient(entity ceph.AuthEntity) bool {
+	caps := entity.Caps["osd"]
+	return strings.HasPrefix(entity.Name, "client.") && strings.HasPrefix(caps, namespaceCapsPrefix) && strings.Contains(caps, " namespace=")
+}
+
+// recordCreatedResources records the erasure code profiles or clients that the operator created, which makes them
+// candidates for the orphan cleanup once their pool is gone. The config map is only updated for new entries.
+func recordCreatedResources(context *clusterd.Context, namespace, kind string, names ...string) error {
+	created, err := getCreatedResources(context, namespace)
+	if err != nil {
+		return err
+	}
+	var missing []string
+	for _, name := range names {
+		if created[name] != kind {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	return k8sutil.ModifyConfigMap(context.Clientset, namespace, createdResourcesConfigMapName, nil, func(cm *v1.ConfigMap) {
+		for _, name := range missing {
+			cm.Data[name] = kind
+		}
+	})
+}
+
+// forgetCreatedResources removes the records of the entities that were deleted
+func forgetCreatedResources(context *clusterd.Context, namespace string, names []string) error {
+	if len(names) == 0 {
+		return nil
+	}
+	return k8sutil.ModifyConfigMap(context.Clientset, namespace, createdResourcesConfigMapName, nil, func(cm *v1.ConfigMap) {
+		for _, name := range names {
+			delete(cm.Data, name)
+		}
+	})
+}
+
+// getCreatedResources returns the kind of each entity that the operator created, keyed by the name of the entity
+func getCreatedResources(context *clusterd.Context, namespace string) (map[string]string, error) {
+	cm, err := context.Clientset.CoreV1().ConfigMaps(namespace).Get(createdResourcesConfigMapName, metav1.GetOptions{})
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return map[string]string{}, nil
+		}
+		return nil, fmt.Errorf("failed to get configmap %s. %+v", createdResourcesConfigMapName, err)
+	}
+	if cm.Data == nil {
+		return map[string]string{}, nil
+	}
+	return cm.Data, nil
+}
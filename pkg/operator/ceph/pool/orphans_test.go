@@ -0,0 +1,101 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package pool
+
+import (
+	"fmt"
+	"testing"
+
+	cephv1beta1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1beta1"
+	rookfake "github.com/rook/rook/pkg/client/clientset/versioned/fake"
+	"github.com/rook/rook/pkg/clusterd"
+	"github.com/rook/rook/pkg/operator/k8sutil"
+	testop "github.com/rook/rook/pkg/operator/test"
+	exectest "github.com/rook/rook/pkg/util/exec/test"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func createNamespaceSecretObj(t *testing.T, context *clusterd.Context, name string) {
+	secret := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "ns"},
+		StringData: map[string]string{namespaceUserNameKey: "user", namespaceSecretKeyKey: "key"},
+		Type:       k8sutil.RookType,
+	}
+	_, err := context.Clientset.CoreV1().Secrets("ns").Create(secret)
+	assert.Nil(t, err)
+}
+
+func TestFindOrphans(t *testing.T) {
+	deleted := []string{}
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithOutputFile: func(debug bool, actionName string, command string, outFileArg string, args ...string) (string, error) {
+			switch {
+			case args[0] == "osd" && args[1] == "erasure-code-profile" && args[2] == "ls":
+				return `["default","ecpool_ecprofile","deleted_ecprofile","manual_ecprofile"]`, nil
+			case args[0] == "osd" && args[1] == "erasure-code-profile" && args[2] == "rm":
+				deleted = append(deleted, args[3])
+				return "", nil
+			case args[0] == "osd" && args[1] == "lspools":
+				return `[{"poolnum":1,"poolname":"ecpool"},{"poolnum":2,"poolname":"replicapool"}]`, nil
+			case args[0] == "auth" && args[1] == "ls":
+				return `{"auth_dump":[
+					{"entity":"client.admin","caps":{"mon":"allow *","osd":"allow *"}},
+					{"entity":"client.replicapool.team-a","caps":{"mon":"profile rbd","osd":"profile rbd pool=replicapool namespace=team-a"}},
+					{"entity":"client.replicapool.team-b","caps":{"mon":"profile rbd","osd":"profile rbd pool=replicapool namespace=team-b"}},
+					{"entity":"client.replicapool.manual","caps":{"mon":"profile rbd","osd":"profile rbd pool=replicapool namespace=manual"}},
+					{"entity":"client.other","caps":{"mon":"profile rbd","osd":"profile rbd pool=replicapool"}}]}`, nil
+			case args[0] == "auth" && args[1] == "del":
+				deleted = append(deleted, args[2])
+				return "", nil
+			}
+			return "", fmt.Errorf("unexpected ceph command '%v'", args)
+		},
+	}
+	p := &cephv1beta1.Pool{
+		ObjectMeta: metav1.ObjectMeta{Name: "replicapool", Namespace: "ns"},
+		Spec:       cephv1beta1.PoolSpec{Namespaces: []string{"team-a"}},
+	}
+	context := &clusterd.Context{Executor: executor, Clientset: testop.New(1), RookClientset: rookfake.NewSimpleClientset(p)}
+	// the profiles and clients created by hand are not recorded, so they are never orphans even if their names match
+	err := recordCreatedResources(context, "ns", createdProfile, "ecpool_ecprofile", "deleted_ecprofile")
+	assert.Nil(t, err)
+	err = recordCreatedResources(context, "ns", createdClient, "client.replicapool.team-a", "client.replicapool.team-b")
+	assert.Nil(t, err)
+	createNamespaceSecretObj(t, context, NamespaceSecretName("replicapool", "team-a"))
+	createNamespaceSecretObj(t, context, NamespaceSecretName("replicapool", "team-b"))
+
+	orphans, err := FindOrphans(context, "ns")
+	assert.Nil(t, err)
+	assert.False(t, orphans.Empty())
+	assert.Equal(t, []string{"deleted_ecprofile"}, orphans.ErasureCodeProfiles)
+	assert.Equal(t, []string{"client.replicapool.team-b"}, orphans.Clients)
+	assert.Equal(t, []string{"rook-ceph-pool-replicapool-team-b"}, orphans.Secrets)
+
+	err = DeleteOrphans(context, "ns", orphans)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"deleted_ecprofile", "client.replicapool.team-b"}, deleted)
+	_, err = context.Clientset.CoreV1().Secrets("ns").Get(NamespaceSecretName("replicapool", "team-b"), metav1.GetOptions{})
+	assert.NotNil(t, err)
+	_, err = context.Clientset.CoreV1().Secrets("ns").Get(NamespaceSecretName("replicapool", "team-a"), metav1.GetOptions{})
+	assert.Nil(t, err)
+
+	// the records of the deleted orphans are removed
+	created, err := getCreatedResources(context, "ns")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"ecpool_ecprofile": createdProfile, "client.replicapool.team-a": createdClient}, created)
+}
@@ -0,0 +1,201 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pool
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rook/rook/pkg/clusterd"
+	ceph "github.com/rook/rook/pkg/daemon/ceph/client"
+	"github.com/rook/rook/pkg/operator/ceph/settings"
+	"github.com/rook/rook/pkg/operator/k8sutil"
+	"k8s.io/api/core/v1"
+)
+
+// PGAdvisorConfigMapName is the config map where the pg recommendations are kept, with a recommendation for each pool
+const PGAdvisorConfigMapName = "rook-ceph-pg-advisor"
+
+var (
+	// PGAdvisorInterval is the interval to compare the pg counts of the pools with their share of the data
+	PGAdvisorInterval = settings.NewDuration(time.Hour)
+	// PGAutoApply is whether the recommended pg counts are applied. The pgs of a pool are at most doubled at each
+	// check, and only while the cluster is not rebalancing.
+	PGAutoApply = settings.NewBool(false)
+
+	// the interval and the timeout to wait for the new pgs of a pool to be created before their data is placed in them
+	pgCreateCheckInterval = 5 * time.Second
+	pgCreateTimeout       = 10 * time.Minute
+)
+
+// PGAdvisor periodically recommends the pg counts of the pools for the data in the pools
+type PGAdvisor struct {
+	context   *clusterd.Context
+	namespace string
+	// AllowApply returns whether the maintenance windows allow the pg counts to be increased now
+	AllowApply func() bool
+}
+
+// NewPGAdvisor creates a new pg advisor for the cluster in the namespace
+func NewPGAdvisor(context *clusterd.Context, namespace string) *PGAdvisor {
+	return &PGAdvisor{context: context, namespace: namespace}
+}
+
+// Start periodically checks the pg counts of the pools
+func (a *PGAdvisor) Start(stopCh chan struct{}) {
+	for {
+		select {
+		case <-stopCh:
+			logger.Infof("stopping the pg advisor in namespace %s", a.namespace)
+			return
+
+		case <-time.After(PGAdvisorInterval.Get()):
+			if err := a.Check(); err != nil {
+				logger.Warningf("failed to check the pgs of the pools in namespace %s. %+v", a.namespace, err)
+			}
+		}
+	}
+}
+
+// Check saves the recommended pg counts of the pools in the advisor config map, after growing the pgs of the pools
+// towards the recommendations if the auto apply is enabled
+func (a *PGAdvisor) Check() error {
+	dump, err := ceph.GetOSDDump(a.context, a.namespace)
+	if err != nil {
+		return err
+	}
+	stats, err := ceph.GetPoolStats(a.context, a.namespace)
+	if err != nil {
+		return err
+	}
+	recommendations := ceph.RecommendPGs(dump, stats)
+	for _, r := range recommendations {
+		logger.Infof("pg advisor: %s", r)
+	}
+
+	if PGAutoApply.Get() && len(recommendations) > 0 {
+		if err := a.apply(dump, recommendations); err != nil {
+			logger.Errorf("failed to apply the pg recommendations. %+v", err)
+		}
+	}
+	return a.saveRecommendations(recommendations)
+}
+
+// apply grows the pgs of each pool a step towards its recommendation, unless the cluster is still moving the data
+// of a previous change or no maintenance window is open. The data is placed in the new pgs once they are created.
+func (a *PGAdvisor) apply(dump *ceph.OSDDump, recommendations []ceph.PGRecommendation) error {
+	if a.AllowApply != nil && !a.AllowApply() {
+		logger.Infof("deferring the pg recommendations of %d pools until a maintenance window opens", len(recommendations))
+		return nil
+	}
+	status, err := ceph.Status(a.context, a.namespace)
+	if err != nil {
+		return err
+	}
+	if status.PgMap.DegradedObjects > 0 || status.PgMap.MisplacedObjects > 0 {
+		logger.Infof("deferring the pg recommendations until the cluster in namespace %s is rebalanced", a.namespace)
+		return nil
+	}
+
+	// the pgs of a previous step that were not created in time are placed first, and the pools are grown at the next
+	// check once their data is moved
+	numPGs := status.PgMap.NumPgs
+	placed := false
+	for _, p := range dump.Pools {
+		if p.PgpNum == 0 || p.PgpNum >= p.PgNum {
+			continue
+		}
+		if err := a.placePGs(p.Name, p.PgNum, numPGs); err != nil {
+			return err
+		}
+		placed = true
+	}
+	if placed {
+		return nil
+	}
+
+	for i := range recommendations {
+		r := &recommendations[i]
+		next := r.NextPgNum()
+		if err := ceph.SetPoolProperty(a.context, a.namespace, r.Pool, "pg_num", strconv.Itoa(next)); err != nil {
+			return err
+		}
+		logger.Infof("increased pg_num of pool %s from %d to %d", r.Pool, r.PgNum, next)
+		numPGs += next - r.PgNum
+		r.PgNum = next
+		if err := a.placePGs(r.Pool, next, numPGs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// placePGs sets the pgp_num of the pool to its pg_num once the cluster has created all of its pgs, since the data
+// cannot be moved to the pgs that do not exist yet
+func (a *PGAdvisor) placePGs(pool string, pgNum, numPGs int) error {
+	start := time.Now()
+	for {
+		status, err := ceph.Status(a.context, a.namespace)
+		if err != nil {
+			return err
+		}
+		if pgsCreated(status.PgMap, numPGs) {
+			break
+		}
+		if time.Since(start) > pgCreateTimeout {
+			return fmt.Errorf("the new pgs of pool %s were not created after %s. %+v", pool, pgCreateTimeout, status.PgMap.PgsByState)
+		}
+		<-time.After(pgCreateCheckInterval)
+	}
+
+	if err := ceph.SetPoolProperty(a.context, a.namespace, pool, "pgp_num", strconv.Itoa(pgNum)); err != nil {
+		return err
+	}
+	logger.Infof("placing the data of pool %s in its %d pgs", pool, pgNum)
+	return nil
+}
+
+// pgsCreated returns whether the cluster has the number of pgs and none of them is still being created
+func pgsCreated(pgMap ceph.PgMap, numPGs int) bool {
+	if pgMap.NumPgs < numPGs {
+		return false
+	}
+	for _, s := range pgMap.PgsByState {
+		if strings.Contains(s.StateName, "creating") || strings.Contains(s.StateName, "unknown") {
+			return false
+		}
+	}
+	return true
+}
+
+func (a *PGAdvisor) saveRecommendations(recommendations []ceph.PGRecommendation) error {
+	data := map[string]string{}
+	for _, r := range recommendations {
+		d, err := json.Marshal(r)
+		if err != nil {
+			return fmt.Errorf("failed to marshal the pg recommendation of pool %s. %+v", r.Pool, err)
+		}
+		data[r.Pool] = string(d)
+	}
+
+	return k8sutil.ModifyConfigMap(a.context.Clientset, a.namespace, PGAdvisorConfigMapName, nil, func(cm *v1.ConfigMap) {
+		cm.Data = data
+	})
+}
@@ -0,0 +1,102 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package pool
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/rook/rook/pkg/clusterd"
+	exectest "github.com/rook/rook/pkg/util/exec/test"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestPGAdvisor(t *testing.T) {
+	pgCreateCheckInterval = time.Millisecond
+	pgmap := `{"pgmap":{"num_pgs":8,"misplaced_objects":20,"misplaced_total":300}}`
+	pools := `[{"pool_name":"replicapool","size":3,"pg_num":8,"pg_placement_num":8},{"pool_name":"small","size":3,"pg_num":8,"pg_placement_num":8}]`
+	pgNums := map[string]string{}
+	creating := false
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithOutputFile: func(debug bool, actionName string, command string, outFileArg string, args ...string) (string, error) {
+			switch {
+			case args[0] == "osd" && args[1] == "dump":
+				return `{"osds":[{"osd":0,"up":1,"in":1},{"osd":1,"up":1,"in":1},{"osd":2,"up":1,"in":1}],"pools":` + pools + `}`, nil
+			case args[0] == "df":
+				return `{"pools":[{"name":"replicapool","stats":{"bytes_used":2048}},{"name":"small","stats":{"bytes_used":1}}]}`, nil
+			case args[0] == "status":
+				if creating {
+					// the new pgs are reported once as being created
+					creating = false
+					return `{"pgmap":{"num_pgs":24,"pgs_by_state":[{"state_name":"creating+peering","count":8},{"state_name":"active+clean","count":16}]}}`, nil
+				}
+				return pgmap, nil
+			case args[0] == "osd" && args[1] == "pool" && args[2] == "set":
+				if args[4] == "pg_num" {
+					creating = true
+					pgmap = `{"pgmap":{"num_pgs":24,"pgs_by_state":[{"state_name":"active+clean","count":24}]}}`
+				}
+				if args[4] == "pgp_num" {
+					assert.False(t, creating, "the data was placed before the pgs were created")
+				}
+				pgNums[args[3]+"/"+args[4]] = args[5]
+				return "", nil
+			}
+			return "", fmt.Errorf("unexpected ceph command '%v'", args)
+		},
+	}
+	clientset := fake.NewSimpleClientset()
+	context := &clusterd.Context{Executor: executor, Clientset: clientset}
+	a := NewPGAdvisor(context, "ns")
+
+	// the recommendations are only reported unless they are applied
+	assert.Nil(t, a.Check())
+	cm, err := clientset.CoreV1().ConfigMaps("ns").Get(PGAdvisorConfigMapName, metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"replicapool": `{"pool":"replicapool","pgNum":8,"targetPgNum":128,"dataShare":0.9995119570522206}`}, cm.Data)
+	assert.Equal(t, 0, len(pgNums))
+
+	// the pgs are not changed while the cluster is rebalancing
+	PGAutoApply.Store(true)
+	defer PGAutoApply.Store(false)
+	assert.Nil(t, a.Check())
+	assert.Equal(t, 0, len(pgNums))
+
+	// nor outside of the maintenance windows
+	pgmap = `{"pgmap":{"num_pgs":16}}`
+	allowed := false
+	a.AllowApply = func() bool { return allowed }
+	assert.Nil(t, a.Check())
+	assert.Equal(t, 0, len(pgNums))
+
+	// the pgs are doubled once the cluster is rebalanced, and the data is placed in them once they are created
+	allowed = true
+	assert.Nil(t, a.Check())
+	assert.Equal(t, map[string]string{"replicapool/pg_num": "16", "replicapool/pgp_num": "16"}, pgNums)
+	assert.False(t, creating)
+	cm, err = clientset.CoreV1().ConfigMaps("ns").Get(PGAdvisorConfigMapName, metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, `{"pool":"replicapool","pgNum":16,"targetPgNum":128,"dataShare":0.9995119570522206}`, cm.Data["replicapool"])
+
+	// the pgs that were not placed in time are placed before the pool is grown again
+	pgNums = map[string]string{}
+	pools = `[{"pool_name":"replicapool","size":3,"pg_num":16,"pg_placement_num":8},{"pool_name":"small","size":3,"pg_num":8,"pg_placement_num":8}]`
+	assert.Nil(t, a.Check())
+	assert.Equal(t, map[string]string{"replicapool/pgp_num": "16"}, pgNums)
+}
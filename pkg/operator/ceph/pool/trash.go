@@ -0,0 +1,212 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pool
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	cephv1beta1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1beta1"
+	"github.com/rook/rook/pkg/clusterd"
+	ceph "github.com/rook/rook/pkg/daemon/ceph/client"
+	"github.com/rook/rook/pkg/operator/ceph/maintenance"
+	"github.com/rook/rook/pkg/operator/ceph/settings"
+	"github.com/rook/rook/pkg/operator/k8sutil"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const pendingDeletionsConfigMapName = "rook-ceph-pool-deletions"
+
+var (
+	// TrashPurgeInterval is the interval to delete the expired images from the trash of the pools
+	TrashPurgeInterval = settings.NewDuration(time.Hour)
+	// DeleteDelay is how long a pool is kept after its crd is deleted. The deletion is canceled if the crd is
+	// created again in the meantime.
+	DeleteDelay = settings.NewDuration(time.Duration(0))
+)
+
+// pendingDeletion is a pool whose crd was deleted and that is deleted once the delay has passed. The uid of the deleted
+// crd tells the deletions apart when a pool with the same name is created and deleted again before the delay passed.
+type pendingDeletion struct {
+	UID        types.UID `json:"uid,omitempty"`
+	DeleteAt   time.Time `json:"deleteAt"`
+	Namespaces []string  `json:"namespaces,omitempty"`
+}
+
+// TrashPurger periodically deletes the images in the trash of the pools when they expire
+type TrashPurger struct {
+	context   *clusterd.Context
+	namespace string
+}
+
+// NewTrashPurger creates a new trash purger for the cluster in the namespace
+func NewTrashPurger(context *clusterd.Context, namespace string) *TrashPurger {
+	return &TrashPurger{context: context, namespace: namespace}
+}
+
+// Start periodically purges the trash of the pools
+func (p *TrashPurger) Start(stopCh chan struct{}) {
+	for {
+		select {
+		case <-stopCh:
+			logger.Infof("stopping the trash purger in namespace %s", p.namespace)
+			return
+
+		case <-time.After(TrashPurgeInterval.Get()):
+			if err := PurgeExpiredImages(p.context, p.namespace); err != nil {
+				logger.Warningf("failed to purge the trash in namespace %s. %+v", p.namespace, err)
+			}
+		}
+	}
+}
+
+// PurgeExpiredImages deletes the expired images from the trash of each pool and of the namespaces of the pools
+func PurgeExpiredImages(context *clusterd.Context, namespace string) error {
+	pools, err := context.RookClientset.CephV1beta1().Pools(namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list pools. %+v", err)
+	}
+
+	failed := 0
+	for _, p := range pools.Items {
+		for _, ns := range append([]string{""}, p.Spec.Namespaces...) {
+			if err := ceph.PurgeTrash(context, namespace, ceph.PoolNamespaceSpec(p.Name, ns)); err != nil {
+				logger.Errorf("%+v", err)
+				failed++
+			}
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("failed to purge the trash of %d pools", failed)
+	}
+	return nil
+}
+
+// scheduleDeletion records the deletion of the pool so it is completed after the delay, even if the operator restarts
+func (c *PoolController) scheduleDeletion(p *cephv1beta1.Pool) error {
+	deletion := pendingDeletion{UID: p.UID, DeleteAt: time.Now().Add(DeleteDelay.Get()), Namespaces: p.Spec.Namespaces}
+	data, err := json.Marshal(deletion)
+	if err != nil {
+		return fmt.Errorf("failed to marshal the deletion of pool %s. %+v", p.Name, err)
+	}
+
+	err = k8sutil.ModifyConfigMap(c.context.Clientset, p.Namespace, pendingDeletionsConfigMapName, nil, func(cm *v1.ConfigMap) {
+		cm.Data[p.Name] = string(data)
+	})
+	if err != nil {
+		return err
+	}
+
+	logger.Infof("pool %s will be deleted at %s unless its crd is created again", p.Name, deletion.DeleteAt.UTC())
+	go c.deleteAfterDelay(p.Namespace, p.Name, deletion)
+	return nil
+}
+
+// resumeDeletions waits for the deletions that were scheduled before the operator restarted
+func (c *PoolController) resumeDeletions(namespace string) {
+	cm, err := c.context.Clientset.CoreV1().ConfigMaps(namespace).Get(pendingDeletionsConfigMapName, metav1.GetOptions{})
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			logger.Errorf("failed to get the pending pool deletions. %+v", err)
+		}
+		return
+	}
+	for name, data := range cm.Data {
+		var deletion pendingDeletion
+		if err := json.Unmarshal([]byte(data), &deletion); err != nil {
+			logger.Errorf("failed to unmarshal the pending deletion of pool %s. %+v", name, err)
+			continue
+		}
+		logger.Infof("resuming the deletion of pool %s at %s", name, deletion.DeleteAt.UTC())
+		go c.deleteAfterDelay(namespace, name, deletion)
+	}
+}
+
+func (c *PoolController) deleteAfterDelay(namespace, name string, deletion pendingDeletion) {
+	select {
+	case <-c.stopCh:
+		return
+	case <-time.After(deletion.DeleteAt.Sub(time.Now())):
+	}
+
+	if err := c.completeDeletion(namespace, name, deletion); err != nil {
+		logger.Errorf("failed to delete pool %s. %+v", name, err)
+	}
+}
+
+// completeDeletion deletes the pool if its crd was not created again since the deletion was scheduled. Nothing is done
+// if the deletion is no longer the pending deletion of the pool, since a later deletion replaced it.
+func (c *PoolController) completeDeletion(namespace, name string, deletion pendingDeletion) error {
+	current, err := c.pendingDeletion(namespace, name)
+	if err != nil {
+		return err
+	}
+	if current == nil || current.UID != deletion.UID || !current.DeleteAt.Equal(deletion.DeleteAt) {
+		logger.Infof("skipping a deletion of pool %s that was replaced by a later deletion", name)
+		return nil
+	}
+
+	_, err = c.context.RookClientset.CephV1beta1().Pools(namespace).Get(name, metav1.GetOptions{})
+	if err == nil {
+		logger.Infof("canceled the deletion of pool %s since its crd was created again", name)
+	} else if errors.IsNotFound(err) {
+		maintenance.WaitForWritableCluster(c.context, namespace)
+		p := &cephv1beta1.Pool{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+			Spec:       cephv1beta1.PoolSpec{Namespaces: deletion.Namespaces},
+		}
+		if err := deletePool(c.context, p); err != nil {
+			return err
+		}
+	} else {
+		return fmt.Errorf("failed to get pool %s. %+v", name, err)
+	}
+
+	cm, err := c.context.Clientset.CoreV1().ConfigMaps(namespace).Get(pendingDeletionsConfigMapName, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get configmap %s. %+v", pendingDeletionsConfigMapName, err)
+	}
+	delete(cm.Data, name)
+	if _, err := c.context.Clientset.CoreV1().ConfigMaps(namespace).Update(cm); err != nil {
+		return fmt.Errorf("failed to update configmap %s. %+v", pendingDeletionsConfigMapName, err)
+	}
+	return nil
+}
+
+// pendingDeletion returns the deletion of the pool that is recorded in the configmap, or nil if none is pending
+func (c *PoolController) pendingDeletion(namespace, name string) (*pendingDeletion, error) {
+	cm, err := c.context.Clientset.CoreV1().ConfigMaps(namespace).Get(pendingDeletionsConfigMapName, metav1.GetOptions{})
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get configmap %s. %+v", pendingDeletionsConfigMapName, err)
+	}
+	data, ok := cm.Data[name]
+	if !ok {
+		return nil, nil
+	}
+	var deletion pendingDeletion
+	if err := json.Unmarshal([]byte(data), &deletion); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal the pending deletion of pool %s. %+v", name, err)
+	}
+	return &deletion, nil
+}
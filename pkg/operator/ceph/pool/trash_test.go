@@ -0,0 +1,127 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package pool
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	cephv1beta1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1beta1"
+	rookfake "github.com/rook/rook/pkg/client/clientset/versioned/fake"
+	"github.com/rook/rook/pkg/clusterd"
+	testop "github.com/rook/rook/pkg/operator/test"
+	exectest "github.com/rook/rook/pkg/util/exec/test"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestPurgeExpiredImages(t *testing.T) {
+	purged := []string{}
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithOutput: func(debug bool, actionName string, command string, args ...string) (string, error) {
+			if args[0] == "trash" && args[1] == "purge" {
+				purged = append(purged, args[2])
+				return "", nil
+			}
+			return "", fmt.Errorf("unexpected rbd command '%v'", args)
+		},
+	}
+	p := &cephv1beta1.Pool{
+		ObjectMeta: metav1.ObjectMeta{Name: "replicapool", Namespace: "ns"},
+		Spec:       cephv1beta1.PoolSpec{Namespaces: []string{"team-a"}},
+	}
+	context := &clusterd.Context{Executor: executor, RookClientset: rookfake.NewSimpleClientset(p)}
+
+	err := PurgeExpiredImages(context, "ns")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"replicapool", "replicapool/team-a"}, purged)
+}
+
+func TestDelayedDeletion(t *testing.T) {
+	deleted := []string{}
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithOutputFile: func(debug bool, actionName string, command string, outFileArg string, args ...string) (string, error) {
+			switch {
+			case args[0] == "osd" && args[1] == "pool" && args[2] == "get":
+				return `{"pool":"replicapool","pool_id":1,"size":1}`, nil
+			case args[0] == "osd" && args[1] == "pool" && args[2] == "delete":
+				deleted = append(deleted, args[3])
+				return "", nil
+			case args[0] == "osd" && args[1] == "crush":
+				return "", nil
+			case args[0] == "auth" && args[1] == "del":
+				deleted = append(deleted, args[2])
+				return "", nil
+			}
+			return "", fmt.Errorf("unexpected ceph command '%v'", args)
+		},
+	}
+	context := &clusterd.Context{Executor: executor, Clientset: testop.New(1), RookClientset: rookfake.NewSimpleClientset()}
+	c := &PoolController{context: context, stopCh: make(chan struct{})}
+	defer close(c.stopCh)
+	DeleteDelay.Store(time.Hour)
+	defer DeleteDelay.Store(0)
+
+	p := &cephv1beta1.Pool{
+		ObjectMeta: metav1.ObjectMeta{Name: "replicapool", Namespace: "ns"},
+		Spec:       cephv1beta1.PoolSpec{Namespaces: []string{"team-a"}},
+	}
+	err := c.scheduleDeletion(p)
+	assert.Nil(t, err)
+	cm, err := context.Clientset.CoreV1().ConfigMaps("ns").Get(pendingDeletionsConfigMapName, metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.Contains(t, cm.Data["replicapool"], "team-a")
+	assert.Equal(t, 0, len(deleted))
+
+	// the deletion is canceled when the crd is created again
+	_, err = context.RookClientset.CephV1beta1().Pools("ns").Create(p)
+	assert.Nil(t, err)
+	deletion, err := c.pendingDeletion("ns", "replicapool")
+	assert.Nil(t, err)
+	err = c.completeDeletion("ns", "replicapool", *deletion)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(deleted))
+	cm, err = context.Clientset.CoreV1().ConfigMaps("ns").Get(pendingDeletionsConfigMapName, metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(cm.Data))
+
+	// the pool and the clients of its namespaces are deleted after the delay
+	err = c.scheduleDeletion(p)
+	assert.Nil(t, err)
+	err = context.RookClientset.CephV1beta1().Pools("ns").Delete("replicapool", &metav1.DeleteOptions{})
+	assert.Nil(t, err)
+	first, err := c.pendingDeletion("ns", "replicapool")
+	assert.Nil(t, err)
+
+	// a pool that is created and deleted again is deleted after the delay of the last deletion
+	p.UID = "second-uid"
+	err = c.scheduleDeletion(p)
+	assert.Nil(t, err)
+	err = c.completeDeletion("ns", "replicapool", *first)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(deleted))
+	second, err := c.pendingDeletion("ns", "replicapool")
+	assert.Nil(t, err)
+	assert.Equal(t, p.UID, second.UID)
+
+	err = c.completeDeletion("ns", "replicapool", *second)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"replicapool", "client.replicapool.team-a"}, deleted)
+	cm, err = context.Clientset.CoreV1().ConfigMaps("ns").Get(pendingDeletionsConfigMapName, metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(cm.Data))
+}
@@ -707,6 +707,9 @@ func (ctrl *ProvisionController) updateProvisionStats(claim *v1.PersistentVolume
 		return
 	}
 
+	if _, ok := err.(*PendingError); ok {
+		return
+	}
 	if err != nil {
 		if failureCount, exists := ctrl.failedProvisionStats[claim.UID]; exists == true {
 			failureCount = failureCount + 1
@@ -797,6 +800,12 @@ func (ctrl *ProvisionController) provisionClaimOperation(claim *v1.PersistentVol
 			glog.Infof("provision of claim %q ignored: %v", claimToClaimKey(claim), ierr)
 			return nil
 		}
+		if perr, ok := err.(*PendingError); ok {
+			// Provision is in progress, retry until the volume is ready.
+			glog.Infof("provision of claim %q pending: %v", claimToClaimKey(claim), perr)
+			ctrl.eventRecorder.Event(claim, v1.EventTypeNormal, "ProvisioningPending", perr.Reason)
+			return err
+		}
 		strerr := fmt.Sprintf("Failed to provision volume with StorageClass %q: %v", claimClass, err)
 		glog.Errorf("Failed to provision volume for claim %q with StorageClass %q: %v", claimToClaimKey(claim), claimClass, err)
 		ctrl.eventRecorder.Event(claim, v1.EventTypeWarning, "ProvisioningFailed", strerr)
@@ -357,6 +357,27 @@ func TestShouldProvision(t *testing.T) {
 	}
 }
 
+func TestProvisionPending(t *testing.T) {
+	claim := newClaim("claim-1", "1-1", "class-1", "", nil)
+	client := fake.NewSimpleClientset(claim)
+	ctrl := newTestProvisionController(client, "foo.bar/baz", newTestProvisioner(), "v1.5.0")
+	ctrl.SetFailedProvisionThreshold(1)
+	if err := ctrl.classes.Add(newStorageClass("class-1", "foo.bar/baz")); err != nil {
+		t.Fatalf("error adding class to cache: %v", err)
+	}
+
+	// a pending volume is not a failure, so the claim is provisioned again
+	ctrl.updateProvisionStats(claim, &PendingError{"the image is being allocated"})
+	if !ctrl.shouldProvision(claim) {
+		t.Errorf("expected to provision the pending claim again")
+	}
+
+	ctrl.updateProvisionStats(claim, fmt.Errorf("mock failure"))
+	if ctrl.shouldProvision(claim) {
+		t.Errorf("expected to stop provisioning the claim after the failure threshold")
+	}
+}
+
 func TestShouldDelete(t *testing.T) {
 	tests := []struct {
 		name             string
@@ -51,6 +51,18 @@ func (e *IgnoredError) Error() string {
 	return fmt.Sprintf("ignored because %s", e.Reason)
 }
 
+// PendingError is the value for Provision to return to indicate that the
+// volume is still being prepared in the background. The claim is provisioned
+// again at a later resync, and the attempts are not counted against the
+// failedProvisionThreshold.
+type PendingError struct {
+	Reason string
+}
+
+func (e *PendingError) Error() string {
+	return fmt.Sprintf("pending because %s", e.Reason)
+}
+
 // VolumeOptions contains option information about a volume
 // https://github.com/kubernetes/kubernetes/blob/release-1.4/pkg/volume/plugins.go
 type VolumeOptions struct {
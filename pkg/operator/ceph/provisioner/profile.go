@@ -0,0 +1,104 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provisioner
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	cephv1beta1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1beta1"
+	"github.com/rook/rook/pkg/operator/ceph/cluster"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// the parameter of the storage classes with the name of the image profile of the cluster
+const profileParam = "profile"
+
+// profileParameters returns the parameters of the storage class merged with the settings of the image profile it
+// references, where the parameters of the storage class override the settings of the profile. The parameters are
+// returned unchanged if the storage class does not reference a profile.
+func (p *RookVolumeProvisioner) profileParameters(params map[string]string) (map[string]string, error) {
+	var name, clusterNamespace string
+	merged := map[string]string{}
+	for k, v := range params {
+		switch strings.ToLower(k) {
+		case profileParam:
+			name = v
+			continue
+		case "clusternamespace", "clustername":
+			clusterNamespace = v
+		}
+		merged[strings.ToLower(k)] = v
+	}
+	if name == "" {
+		return params, nil
+	}
+	if clusterNamespace == "" {
+		clusterNamespace = cluster.DefaultClusterName
+	}
+
+	profile, err := p.findProfile(clusterNamespace, name)
+	if err != nil {
+		return nil, err
+	}
+
+	settings := map[string]string{
+		"pool":           profile.Pool,
+		"datapool":       profile.DataPool,
+		"imagefeatures":  profile.ImageFeatures,
+		"fstype":         profile.FSType,
+		"minsize":        profile.MinSize,
+		"trashretention": profile.TrashRetention,
+	}
+	limits := map[string]uint64{
+		"qosiopslimit": profile.QoS.IOPSLimit,
+		"qosbpslimit":  profile.QoS.BPSLimit,
+		"qosiopsburst": profile.QoS.IOPSBurst,
+		"qosbpsburst":  profile.QoS.BPSBurst,
+	}
+	for k, v := range limits {
+		if v > 0 {
+			settings[k] = strconv.FormatUint(v, 10)
+		}
+	}
+	if profile.ThickProvision {
+		settings["thickprovision"] = "true"
+	}
+	for k, v := range settings {
+		if _, ok := merged[k]; !ok && v != "" {
+			merged[k] = v
+		}
+	}
+	return merged, nil
+}
+
+// findProfile returns the image profile of the cluster in the namespace with the given name
+func (p *RookVolumeProvisioner) findProfile(clusterNamespace, name string) (*cephv1beta1.ImageProfileSpec, error) {
+	clusters, err := p.context.RookClientset.CephV1beta1().Clusters(clusterNamespace).List(metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list clusters to get image profile %s. %+v", name, err)
+	}
+	for _, c := range clusters.Items {
+		for i, profile := range c.Spec.ImageProfiles {
+			if profile.Name == name {
+				return &c.Spec.ImageProfiles[i], nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("image profile %s not found in the cluster in namespace %s", name, clusterNamespace)
+}
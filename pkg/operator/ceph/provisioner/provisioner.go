@@ -19,13 +19,17 @@ package provisioner
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/coreos/pkg/capnslog"
 	"github.com/rook/rook/pkg/clusterd"
 	"github.com/rook/rook/pkg/daemon/ceph/agent/flexvolume"
 	ceph "github.com/rook/rook/pkg/daemon/ceph/client"
 	"github.com/rook/rook/pkg/operator/ceph/cluster"
+	oppool "github.com/rook/rook/pkg/operator/ceph/pool"
 	"github.com/rook/rook/pkg/operator/ceph/provisioner/controller"
 	"k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
@@ -36,6 +40,10 @@ const (
 	attacherImageKey              = "attacherImage"
 	storageClassBetaAnnotationKey = "volume.beta.kubernetes.io/storage-class"
 	sizeMB                        = 1048576 // 1 MB
+	// the annotation of the volume with the time that its image is kept in the trash after the volume is deleted
+	trashRetentionAnnotation = "ceph.rook.io/trash-retention"
+	// the features of the new images keep an object map, so that the usage of the images is computed from the map
+	defaultImageFeatures = "layering,exclusive-lock,object-map,fast-diff"
 )
 
 var logger = capnslog.NewPackageLogger("github.com/rook/rook", "op-provisioner")
@@ -46,6 +54,9 @@ type RookVolumeProvisioner struct {
 
 	// The flex driver vendor dir to use
 	flexDriverVendor string
+
+	// Serializes the quota checks with the creation of the images
+	quotaLock sync.Mutex
 }
 
 type provisionerConfig struct {
@@ -60,6 +71,27 @@ type provisionerConfig struct {
 
 	// Optional: For erasure coded pools the data pool must be given
 	dataPool string
+
+	// Optional: The comma separated features of the images. Default is `layering,exclusive-lock,object-map,fast-diff`
+	imageFeatures string
+
+	// Optional: The rados namespace in the pool where the images will be isolated
+	radosNamespace string
+
+	// Optional: Whether the images of each claim namespace (tenant) are isolated in a rados namespace of the same name
+	isolateTenants bool
+
+	// Optional: The IO limits of the images
+	qos ceph.ImageQoS
+
+	// Optional: How long the images of deleted volumes are kept in the trash, where they can be restored
+	trashRetention time.Duration
+
+	// Optional: The smallest size in bytes of the images. The claims that request less get an image of this size.
+	minSize int64
+
+	// Optional: Whether all the objects of the images are written before the volumes are provisioned
+	thickProvision bool
 }
 
 // New creates RookVolumeProvisioner
@@ -78,15 +110,34 @@ func (p *RookVolumeProvisioner) Provision(options controller.VolumeOptions) (*v1
 		return nil, fmt.Errorf("claim Selector is not supported")
 	}
 
-	cfg, err := parseClassParameters(options.Parameters)
+	params, err := p.profileParameters(options.Parameters)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, err := parseClassParameters(params)
 	if err != nil {
 		return nil, err
 	}
 
 	logger.Infof("creating volume with configuration %+v", *cfg)
+	if cfg.thickProvision || cfg.trashRetention > 0 {
+		// the allocation queue and the trash purger of the operator do not run for an external cluster
+		external, err := p.isExternalCluster(cfg.clusterNamespace)
+		if err != nil {
+			return nil, err
+		}
+		if external {
+			return nil, fmt.Errorf("thick provisioning and trash retention are not supported by the external cluster in namespace %s", cfg.clusterNamespace)
+		}
+	}
 
 	capacity := options.PVC.Spec.Resources.Requests[v1.ResourceName(v1.ResourceStorage)]
 	requestBytes := capacity.Value()
+	if requestBytes < cfg.minSize {
+		logger.Infof("raising the size of volume %s from %d to the minimum size of %d bytes", options.PVName, requestBytes, cfg.minSize)
+		requestBytes = cfg.minSize
+	}
 
 	imageName := options.PVName
 
@@ -95,10 +146,32 @@ func (p *RookVolumeProvisioner) Provision(options controller.VolumeOptions) (*v1
 		return nil, err
 	}
 
-	blockImage, err := p.createVolume(imageName, cfg.pool, cfg.dataPool, cfg.clusterNamespace, requestBytes)
+	if cfg.isolateTenants {
+		cfg.radosNamespace = options.PVC.Namespace
+		if err := p.createTenantNamespace(cfg.clusterNamespace, cfg.pool, cfg.radosNamespace); err != nil {
+			return nil, err
+		}
+	}
+
+	blockImage, err := p.createVolumeWithinQuota(cfg, imageName, requestBytes)
 	if err != nil {
 		return nil, err
 	}
+	if err := p.setVolumeQoS(imageName, ceph.PoolNamespaceSpec(cfg.pool, cfg.radosNamespace), cfg.clusterNamespace, cfg.qos); err != nil {
+		return nil, err
+	}
+	if len(options.PVC.Labels) > 0 {
+		// the labels of the claim are copied to the image so the images can be found by their owner outside of kubernetes
+		err := ceph.SetImageLabels(p.context, cfg.clusterNamespace, imageName, ceph.PoolNamespaceSpec(cfg.pool, cfg.radosNamespace), options.PVC.Labels)
+		if err != nil {
+			logger.Warningf("failed to set the labels of rook block image %s. %+v", imageName, err)
+		}
+	}
+	if cfg.thickProvision {
+		if err := p.waitForAllocation(cfg, imageName, options.PVC); err != nil {
+			return nil, err
+		}
+	}
 
 	// since we can guarantee the size of the volume image generated have to be in `MB` boundary, so we can
 	// convert it to `MB` unit safely here
@@ -134,30 +207,122 @@ func (p *RookVolumeProvisioner) Provision(options controller.VolumeOptions) (*v1
 						flexvolume.ImageKey:            imageName,
 						flexvolume.ClusterNamespaceKey: cfg.clusterNamespace,
 						flexvolume.DataPoolKey:         cfg.dataPool,
+						flexvolume.RadosNamespaceKey:   cfg.radosNamespace,
 					},
 				},
 			},
 		},
 	}
+	if cfg.trashRetention > 0 {
+		pv.Annotations = map[string]string{trashRetentionAnnotation: cfg.trashRetention.String()}
+	}
 	logger.Infof("successfully created Rook Block volume %+v", pv.Spec.PersistentVolumeSource.FlexVolume)
 	return pv, nil
 }
 
 // createVolume creates a rook block volume.
-func (p *RookVolumeProvisioner) createVolume(image, pool, dataPool string, clusterNamespace string, size int64) (*ceph.CephBlockImage, error) {
+func (p *RookVolumeProvisioner) createVolume(image, pool, dataPool, imageFeatures string, clusterNamespace string, size int64) (*ceph.CephBlockImage, error) {
 	if image == "" || pool == "" || clusterNamespace == "" || size == 0 {
 		return nil, fmt.Errorf("image missing required fields (image=%s, pool=%s, clusterNamespace=%s, size=%d)", image, pool, clusterNamespace, size)
 	}
 
-	createdImage, err := ceph.CreateImage(p.context, clusterNamespace, image, pool, dataPool, uint64(size))
+	createdImage, err := ceph.CreateImage(p.context, clusterNamespace, image, pool, dataPool, imageFeatures, uint64(size))
 	if err != nil {
-		return nil, fmt.Errorf("Failed to create rook block image %s/%s: %v", pool, image, err)
+		// the image name is unique to the claim, so an image that already exists was created by a previous
+		// attempt that timed out and the provisioning is being retried
+		existing := p.findImage(clusterNamespace, image, pool)
+		if existing == nil || existing.Size < uint64(size) {
+			return nil, fmt.Errorf("Failed to create rook block image %s/%s: %v", pool, image, err)
+		}
+		logger.Infof("Rook block image %s/%s was already created", pool, image)
+		return existing, nil
 	}
 	logger.Infof("Rook block image created: %s, size = %d", createdImage.Name, createdImage.Size)
 
 	return createdImage, nil
 }
 
+// createVolumeWithinQuota creates the rook block volume if it does not exceed the quota of its pool
+func (p *RookVolumeProvisioner) createVolumeWithinQuota(cfg *provisionerConfig, image string, size int64) (*ceph.CephBlockImage, error) {
+	p.quotaLock.Lock()
+	defer p.quotaLock.Unlock()
+
+	if err := p.checkQuota(cfg, image, size); err != nil {
+		return nil, err
+	}
+	return p.createVolume(image, ceph.PoolNamespaceSpec(cfg.pool, cfg.radosNamespace), cfg.dataPool, cfg.imageFeatures, cfg.clusterNamespace, size)
+}
+
+// waitForAllocation queues the thick provisioning of the image, and returns a pending error until all the objects of
+// the image were written by the allocation queue of the cluster. The volume is only created when the image is
+// allocated, so the allocation cannot overwrite the data of the volume. The claim is provisioned again until then,
+// and the queue removes the image if the claim is deleted in the meantime.
+func (p *RookVolumeProvisioner) waitForAllocation(cfg *provisionerConfig, image string, claim *v1.PersistentVolumeClaim) error {
+	pool := ceph.PoolNamespaceSpec(cfg.pool, cfg.radosNamespace)
+	allocation, err := oppool.QueueImageAllocation(p.context, cfg.clusterNamespace, image, pool, claim)
+	if err != nil {
+		return err
+	}
+	switch allocation.Status {
+	case oppool.ImageAllocationAllocated:
+		return nil
+	case oppool.ImageAllocationFailed:
+		return &controller.PendingError{Reason: fmt.Sprintf("the allocation of image %s/%s will be restarted after an error: %s",
+			pool, image, allocation.Error)}
+	}
+	return &controller.PendingError{Reason: fmt.Sprintf("image %s/%s is %s, with %d objects to allocate",
+		pool, image, allocation.Status, allocation.Objects)}
+}
+
+// findImage returns the image in the pool, or nil if it was not found
+func (p *RookVolumeProvisioner) findImage(clusterNamespace, image, pool string) *ceph.CephBlockImage {
+	images, err := ceph.ListImages(p.context, clusterNamespace, pool)
+	if err != nil {
+		logger.Warningf("failed to list images in pool %s. %+v", pool, err)
+		return nil
+	}
+	for i := range images {
+		if images[i].Name == image {
+			return &images[i]
+		}
+	}
+	return nil
+}
+
+// setVolumeQoS sets the IO limits of the image. The image is removed if the limits cannot be set so the
+// volume is not provisioned without them.
+func (p *RookVolumeProvisioner) setVolumeQoS(image, pool, clusterNamespace string, qos ceph.ImageQoS) error {
+	if qos == (ceph.ImageQoS{}) {
+		return nil
+	}
+
+	if err := ceph.SetImageQoS(p.context, clusterNamespace, image, pool, qos); err != nil {
+		if deleteErr := ceph.DeleteImage(p.context, clusterNamespace, image, pool); deleteErr != nil {
+			logger.Warningf("failed to remove image %s/%s without qos. %+v", pool, image, deleteErr)
+		}
+		return fmt.Errorf("failed to set qos of rook block image %s/%s: %v", pool, image, err)
+	}
+	logger.Infof("Rook block image %s qos: %+v", image, qos)
+
+	return nil
+}
+
+// createTenantNamespace creates the rados namespace for the tenant in the pool if it does not exist yet
+func (p *RookVolumeProvisioner) createTenantNamespace(clusterNamespace, pool, namespace string) error {
+	namespaces, err := ceph.ListNamespaces(p.context, clusterNamespace, pool)
+	if err != nil {
+		return fmt.Errorf("failed to list namespaces in pool %s: %v", pool, err)
+	}
+	for _, ns := range namespaces {
+		if ns.Name == namespace {
+			return nil
+		}
+	}
+
+	logger.Infof("creating namespace %s in pool %s for tenant", namespace, pool)
+	return ceph.CreateNamespace(p.context, clusterNamespace, pool, namespace)
+}
+
 // Delete removes the storage asset that was created by Provision represented
 // by the given PV.
 func (p *RookVolumeProvisioner) Delete(volume *v1.PersistentVolume) error {
@@ -171,14 +336,70 @@ func (p *RookVolumeProvisioner) Delete(volume *v1.PersistentVolume) error {
 	name := volume.Spec.PersistentVolumeSource.FlexVolume.Options[flexvolume.ImageKey]
 	clusterns := volume.Spec.PersistentVolumeSource.FlexVolume.Options[flexvolume.ClusterNamespaceKey]
 	pool := volume.Spec.PersistentVolumeSource.FlexVolume.Options[flexvolume.PoolKey]
-	err := ceph.DeleteImage(p.context, clusterns, name, pool)
+	radosNamespace := volume.Spec.PersistentVolumeSource.FlexVolume.Options[flexvolume.RadosNamespaceKey]
+	if radosNamespace == "" {
+		// delete the image from the pool it was migrated to
+		migratedPool, err := oppool.MigratedPool(p.context.Clientset, clusterns, pool, name)
+		if err != nil {
+			return fmt.Errorf("Failed to delete rook block image %s/%s: %v", pool, volume.Name, err)
+		}
+		pool = migratedPool
+	}
+	poolSpec := ceph.PoolNamespaceSpec(pool, radosNamespace)
+	err := p.deleteImage(clusterns, name, poolSpec, volume.Annotations[trashRetentionAnnotation])
 	if err != nil {
-		return fmt.Errorf("Failed to delete rook block image %s/%s: %v", pool, volume.Name, err)
+		// a retry of a deletion that timed out does not find the image anymore
+		if p.findImage(clusterns, name, poolSpec) != nil {
+			return fmt.Errorf("Failed to delete rook block image %s/%s: %v", pool, volume.Name, err)
+		}
+		logger.Infof("Rook block image %s/%s was already deleted", pool, name)
 	}
 	logger.Infof("succeeded deleting volume %+v", volume)
 	return nil
 }
 
+// deleteImage queues the image of a deleted volume for deletion, or moves it to the trash if the volume has a trash
+// retention
+func (p *RookVolumeProvisioner) deleteImage(clusterNamespace, image, pool, trashRetention string) error {
+	if trashRetention == "" {
+		external, err := p.isExternalCluster(clusterNamespace)
+		if err != nil {
+			return err
+		}
+		if external {
+			// the deletion queue of the operator does not run for an external cluster
+			return ceph.DeleteImage(p.context, clusterNamespace, image, pool)
+		}
+		// the objects of the image are deleted in the background so the deletion of a large image does not block
+		return oppool.QueueImageDeletion(p.context, clusterNamespace, image, pool)
+	}
+
+	retention, err := time.ParseDuration(trashRetention)
+	if err != nil {
+		return fmt.Errorf("invalid trash retention %q: %v", trashRetention, err)
+	}
+	expiresAt := time.Now().Add(retention)
+	if err := ceph.TrashImage(p.context, clusterNamespace, image, pool, expiresAt); err != nil {
+		return err
+	}
+	logger.Infof("Rook block image %s/%s moved to the trash until %s", pool, image, expiresAt.UTC())
+	return nil
+}
+
+// isExternalCluster returns whether the cluster in the namespace is managed outside of rook
+func (p *RookVolumeProvisioner) isExternalCluster(clusterNamespace string) (bool, error) {
+	clusters, err := p.context.RookClientset.CephV1beta1().Clusters(clusterNamespace).List(metav1.ListOptions{})
+	if err != nil {
+		return false, fmt.Errorf("failed to list clusters in namespace %s. %+v", clusterNamespace, err)
+	}
+	for _, c := range clusters.Items {
+		if c.Spec.External.Enable {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
 func parseStorageClass(options controller.VolumeOptions) (string, error) {
 	if options.PVC.Spec.StorageClassName != nil {
 		return *options.PVC.Spec.StorageClassName, nil
@@ -194,6 +415,7 @@ func parseStorageClass(options controller.VolumeOptions) (string, error) {
 
 func parseClassParameters(params map[string]string) (*provisionerConfig, error) {
 	var cfg provisionerConfig
+	var err error
 
 	for k, v := range params {
 		switch strings.ToLower(k) {
@@ -207,6 +429,48 @@ func parseClassParameters(params map[string]string) (*provisionerConfig, error)
 			cfg.fstype = v
 		case "datapool":
 			cfg.dataPool = v
+		case "imagefeatures":
+			cfg.imageFeatures = v
+		case "radosnamespace":
+			cfg.radosNamespace = v
+		case "isolatetenants":
+			isolate, err := strconv.ParseBool(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid value %q for option %q: %v", v, k, err)
+			}
+			cfg.isolateTenants = isolate
+		case "thickprovision":
+			thick, err := strconv.ParseBool(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid value %q for option %q: %v", v, k, err)
+			}
+			cfg.thickProvision = thick
+		case "qosiopslimit":
+			if cfg.qos.IOPSLimit, err = parseQoSLimit(k, v); err != nil {
+				return nil, err
+			}
+		case "qosbpslimit":
+			if cfg.qos.BPSLimit, err = parseQoSLimit(k, v); err != nil {
+				return nil, err
+			}
+		case "qosiopsburst":
+			if cfg.qos.IOPSBurst, err = parseQoSLimit(k, v); err != nil {
+				return nil, err
+			}
+		case "qosbpsburst":
+			if cfg.qos.BPSBurst, err = parseQoSLimit(k, v); err != nil {
+				return nil, err
+			}
+		case "trashretention":
+			if cfg.trashRetention, err = time.ParseDuration(v); err != nil || cfg.trashRetention < 0 {
+				return nil, fmt.Errorf("invalid value %q for option %q. must be a duration such as 72h", v, k)
+			}
+		case "minsize":
+			size, err := resource.ParseQuantity(v)
+			if err != nil || size.Sign() < 0 {
+				return nil, fmt.Errorf("invalid value %q for option %q. must be a size such as 10Gi", v, k)
+			}
+			cfg.minSize = size.Value()
 		default:
 			return nil, fmt.Errorf("invalid option %q for volume plugin %s", k, "rookVolumeProvisioner")
 		}
@@ -216,9 +480,25 @@ func parseClassParameters(params map[string]string) (*provisionerConfig, error)
 		return nil, fmt.Errorf("StorageClass for provisioner %s must contain 'pool' parameter", "rookVolumeProvisioner")
 	}
 
+	if cfg.isolateTenants && len(cfg.radosNamespace) > 0 {
+		return nil, fmt.Errorf("StorageClass for provisioner %s cannot specify both 'radosNamespace' and 'isolateTenants'", "rookVolumeProvisioner")
+	}
+
 	if len(cfg.clusterNamespace) == 0 {
 		cfg.clusterNamespace = cluster.DefaultClusterName
 	}
 
+	if len(cfg.imageFeatures) == 0 {
+		cfg.imageFeatures = defaultImageFeatures
+	}
+
 	return &cfg, nil
 }
+
+func parseQoSLimit(k, v string) (uint64, error) {
+	limit, err := strconv.ParseUint(v, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q for option %q: %v", v, k, err)
+	}
+	return limit, nil
+}
@@ -17,14 +17,19 @@ limitations under the License.
 package provisioner
 
 import (
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path"
 	"strings"
 	"testing"
 
+	cephv1beta1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1beta1"
+	rookfake "github.com/rook/rook/pkg/client/clientset/versioned/fake"
 	"github.com/rook/rook/pkg/clusterd"
+	ceph "github.com/rook/rook/pkg/daemon/ceph/client"
 	cephtest "github.com/rook/rook/pkg/daemon/ceph/test"
+	oppool "github.com/rook/rook/pkg/operator/ceph/pool"
 	"github.com/rook/rook/pkg/operator/ceph/provisioner/controller"
 	"github.com/rook/rook/pkg/operator/test"
 	exectest "github.com/rook/rook/pkg/util/exec/test"
@@ -43,6 +48,7 @@ func TestProvisionImage(t *testing.T) {
 	os.Setenv("POD_NAMESPACE", "rook-system")
 	defer os.Setenv("POD_NAMESPACE", "")
 	defer os.RemoveAll(configDir)
+	imageLabels := map[string]string{}
 	executor := &exectest.MockExecutor{
 		MockExecuteCommandWithOutput: func(debug bool, actionName string, command string, args ...string) (string, error) {
 			if strings.Contains(command, "ceph-authtool") {
@@ -53,6 +59,11 @@ func TestProvisionImage(t *testing.T) {
 				return `[{"image":"pvc-uid-1-1","size":1048576,"format":2}]`, nil
 			}
 
+			if command == "rbd" && args[0] == "image-meta" && args[1] == "set" {
+				assert.Equal(t, "testpool/pvc-uid-1-1", args[2])
+				imageLabels[args[3]] = args[4]
+			}
+
 			if command == "rbd" && args[0] == "ls" && args[1] == "-l" {
 				return `[{"image":"pvc-uid-1-1","size":1048576,"format":2}]`, nil
 			}
@@ -61,9 +72,10 @@ func TestProvisionImage(t *testing.T) {
 	}
 
 	context := &clusterd.Context{
-		Clientset: clientset,
-		Executor:  executor,
-		ConfigDir: configDir,
+		Clientset:     clientset,
+		RookClientset: rookfake.NewSimpleClientset(),
+		Executor:      executor,
+		ConfigDir:     configDir,
 	}
 
 	provisioner := New(context, "foo.io")
@@ -82,10 +94,16 @@ func TestProvisionImage(t *testing.T) {
 	assert.Equal(t, "pvc-uid-1-1", pv.Spec.PersistentVolumeSource.FlexVolume.Options["image"])
 	assert.Equal(t, "", pv.Spec.PersistentVolumeSource.FlexVolume.Options["dataPool"])
 
-	volume = newVolumeOptions(newStorageClass("class-1", "foo.io/block", map[string]string{"pool": "testpool", "clusterNamespace": "testCluster", "fsType": "ext3", "dataPool": "iamdatapool"}), newClaim("claim-1", "uid-1-1", "class-1", "", "class-1", nil))
+	assert.Equal(t, 0, len(imageLabels))
+
+	// the labels of the claim are set on the image
+	claim := newClaim("claim-1", "uid-1-1", "class-1", "", "class-1", nil)
+	claim.Labels = map[string]string{"owner": "team-a"}
+	volume = newVolumeOptions(newStorageClass("class-1", "foo.io/block", map[string]string{"pool": "testpool", "clusterNamespace": "testCluster", "fsType": "ext3", "dataPool": "iamdatapool"}), claim)
 
 	pv, err = provisioner.Provision(volume)
 	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"label.owner": "team-a"}, imageLabels)
 
 	assert.Equal(t, "pvc-uid-1-1", pv.Name)
 	assert.NotNil(t, pv.Spec.PersistentVolumeSource.FlexVolume)
@@ -103,6 +121,8 @@ func TestParseClassParameters(t *testing.T) {
 	cfg["pool"] = "testPool"
 	cfg["clustername"] = "myname"
 	cfg["fstype"] = "ext4"
+	cfg["radosNamespace"] = "tenant1"
+	cfg["imageFeatures"] = "layering"
 
 	provConfig, err := parseClassParameters(cfg)
 	assert.Nil(t, err)
@@ -110,6 +130,273 @@ func TestParseClassParameters(t *testing.T) {
 	assert.Equal(t, "testPool", provConfig.pool)
 	assert.Equal(t, "myname", provConfig.clusterNamespace)
 	assert.Equal(t, "ext4", provConfig.fstype)
+	assert.Equal(t, "tenant1", provConfig.radosNamespace)
+	assert.Equal(t, "layering", provConfig.imageFeatures)
+
+	// the images keep an object map by default
+	delete(cfg, "imageFeatures")
+	provConfig, err = parseClassParameters(cfg)
+	assert.Nil(t, err)
+	assert.Equal(t, "layering,exclusive-lock,object-map,fast-diff", provConfig.imageFeatures)
+}
+
+func TestProvisionTenantImage(t *testing.T) {
+	clientset := test.New(3)
+	os.Setenv("POD_NAMESPACE", "rook-system")
+	defer os.Setenv("POD_NAMESPACE", "")
+	namespaceCreated := false
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithOutput: func(debug bool, actionName string, command string, args ...string) (string, error) {
+			if command == "rbd" && args[0] == "namespace" && args[1] == "ls" {
+				return `[]`, nil
+			}
+			if command == "rbd" && args[0] == "namespace" && args[1] == "create" {
+				assert.Equal(t, "testpool/default", args[2])
+				namespaceCreated = true
+				return "", nil
+			}
+			if command == "rbd" && args[0] == "create" {
+				assert.Equal(t, "testpool/default/pvc-uid-1-1", args[1])
+				return "", nil
+			}
+			if command == "rbd" && args[0] == "ls" && args[1] == "-l" {
+				assert.Equal(t, "testpool/default", args[2])
+				return `[{"image":"pvc-uid-1-1","size":1048576,"format":2}]`, nil
+			}
+			return "", nil
+		},
+	}
+	context := &clusterd.Context{
+		Clientset:     clientset,
+		RookClientset: rookfake.NewSimpleClientset(),
+		Executor:      executor,
+	}
+
+	provisioner := New(context, "foo.io")
+	volume := newVolumeOptions(newStorageClass("class-1", "foo.io/block", map[string]string{"pool": "testpool", "clusterNamespace": "testCluster", "isolateTenants": "true"}), newClaim("claim-1", "uid-1-1", "class-1", "", "class-1", nil))
+
+	pv, err := provisioner.Provision(volume)
+	assert.Nil(t, err)
+	assert.True(t, namespaceCreated)
+	assert.Equal(t, "testpool", pv.Spec.PersistentVolumeSource.FlexVolume.Options["pool"])
+	assert.Equal(t, "default", pv.Spec.PersistentVolumeSource.FlexVolume.Options["radosNamespace"])
+}
+
+func TestProvisionRetry(t *testing.T) {
+	clientset := test.New(3)
+	os.Setenv("POD_NAMESPACE", "rook-system")
+	defer os.Setenv("POD_NAMESPACE", "")
+	images := `[]`
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithOutput: func(debug bool, actionName string, command string, args ...string) (string, error) {
+			if command == "rbd" && (args[0] == "create" || args[0] == "rm") {
+				return "", fmt.Errorf("mock rbd failure")
+			}
+			if command == "rbd" && args[0] == "ls" && args[1] == "-l" {
+				return images, nil
+			}
+			return "", nil
+		},
+	}
+	context := &clusterd.Context{
+		Clientset:     clientset,
+		RookClientset: rookfake.NewSimpleClientset(),
+		Executor:      executor,
+	}
+
+	provisioner := New(context, "foo.io")
+	volume := newVolumeOptions(newStorageClass("class-1", "foo.io/block", map[string]string{"pool": "testpool", "clusterNamespace": "testCluster"}), newClaim("claim-1", "uid-1-1", "class-1", "", "class-1", nil))
+
+	// a failure to create the image is returned if the image does not exist
+	_, err := provisioner.Provision(volume)
+	assert.NotNil(t, err)
+
+	// the image that was created by a previous attempt is used
+	images = `[{"image":"pvc-uid-1-1","size":1048576,"format":2}]`
+	pv, err := provisioner.Provision(volume)
+	assert.Nil(t, err)
+	assert.Equal(t, "pvc-uid-1-1", pv.Spec.PersistentVolumeSource.FlexVolume.Options["image"])
+
+	// a failure to delete the image is returned while the image exists
+	err = provisioner.Delete(pv)
+	assert.NotNil(t, err)
+
+	// the image that was deleted by a previous attempt is not deleted again
+	images = `[]`
+	err = provisioner.Delete(pv)
+	assert.Nil(t, err)
+}
+
+func TestDeleteToTrash(t *testing.T) {
+	clientset := test.New(3)
+	os.Setenv("POD_NAMESPACE", "rook-system")
+	defer os.Setenv("POD_NAMESPACE", "")
+	trashed := ""
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithOutput: func(debug bool, actionName string, command string, args ...string) (string, error) {
+			if command == "rbd" && args[0] == "create" {
+				return `[{"image":"pvc-uid-1-1","size":1048576,"format":2}]`, nil
+			}
+			if command == "rbd" && args[0] == "rm" {
+				return "", fmt.Errorf("the image must be moved to the trash")
+			}
+			if command == "rbd" && args[0] == "trash" && args[1] == "mv" {
+				assert.Equal(t, "--expires-at", args[3])
+				trashed = args[2]
+			}
+			return "", nil
+		},
+	}
+	context := &clusterd.Context{
+		Clientset:     clientset,
+		RookClientset: rookfake.NewSimpleClientset(),
+		Executor:      executor,
+	}
+
+	provisioner := New(context, "foo.io")
+	volume := newVolumeOptions(newStorageClass("class-1", "foo.io/block", map[string]string{"pool": "testpool", "clusterNamespace": "testCluster", "trashRetention": "72h"}), newClaim("claim-1", "uid-1-1", "class-1", "", "class-1", nil))
+	pv, err := provisioner.Provision(volume)
+	assert.Nil(t, err)
+	assert.Equal(t, "72h0m0s", pv.Annotations[trashRetentionAnnotation])
+
+	err = provisioner.Delete(pv)
+	assert.Nil(t, err)
+	assert.Equal(t, "testpool/pvc-uid-1-1", trashed)
+
+	_, err = parseClassParameters(map[string]string{"pool": "testpool", "trashRetention": "3 days"})
+	assert.NotNil(t, err)
+}
+
+func TestProvisionImageProfile(t *testing.T) {
+	clientset := test.New(3)
+	os.Setenv("POD_NAMESPACE", "rook-system")
+	defer os.Setenv("POD_NAMESPACE", "")
+	var created []string
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithOutput: func(debug bool, actionName string, command string, args ...string) (string, error) {
+			if command == "rbd" && args[0] == "create" {
+				created = args
+				return "", nil
+			}
+			if command == "rbd" && args[0] == "ls" && args[1] == "-l" {
+				return `[{"image":"pvc-uid-1-1","size":10485760,"format":2}]`, nil
+			}
+			return "", nil
+		},
+	}
+	cluster := &cephv1beta1.Cluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "testCluster", Namespace: "testCluster"},
+		Spec: cephv1beta1.ClusterSpec{
+			ImageProfiles: []cephv1beta1.ImageProfileSpec{
+				{Name: "fast", Pool: "ssdpool", ImageFeatures: "layering,exclusive-lock,object-map,fast-diff", FSType: "xfs", MinSize: "10Mi"},
+			},
+		},
+	}
+	context := &clusterd.Context{
+		Clientset:     clientset,
+		RookClientset: rookfake.NewSimpleClientset(cluster),
+		Executor:      executor,
+	}
+
+	// the settings of the profile are the defaults of the images
+	provisioner := New(context, "foo.io")
+	volume := newVolumeOptions(newStorageClass("class-1", "foo.io/block", map[string]string{"profile": "fast", "clusterNamespace": "testCluster"}), newClaim("claim-1", "uid-1-1", "class-1", "", "class-1", nil))
+	pv, err := provisioner.Provision(volume)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"create", "ssdpool/pvc-uid-1-1", "--size", "10", "--image-feature=layering,exclusive-lock,object-map,fast-diff"}, created[:5])
+	assert.Equal(t, "ssdpool", pv.Spec.PersistentVolumeSource.FlexVolume.Options["pool"])
+	assert.Equal(t, "xfs", pv.Spec.PersistentVolumeSource.FlexVolume.FSType)
+
+	// the parameters of the storage class override the profile
+	volume = newVolumeOptions(newStorageClass("class-1", "foo.io/block", map[string]string{"profile": "fast", "clusterNamespace": "testCluster", "pool": "hddpool"}), newClaim("claim-1", "uid-1-1", "class-1", "", "class-1", nil))
+	pv, err = provisioner.Provision(volume)
+	assert.Nil(t, err)
+	assert.Equal(t, "hddpool/pvc-uid-1-1", created[1])
+	assert.Equal(t, "hddpool", pv.Spec.PersistentVolumeSource.FlexVolume.Options["pool"])
+
+	// a profile that is not in the cluster is an error
+	volume = newVolumeOptions(newStorageClass("class-1", "foo.io/block", map[string]string{"profile": "slow", "clusterNamespace": "testCluster"}), newClaim("claim-1", "uid-1-1", "class-1", "", "class-1", nil))
+	_, err = provisioner.Provision(volume)
+	assert.NotNil(t, err)
+
+	_, err = parseClassParameters(map[string]string{"pool": "testpool", "minSize": "ten gigs"})
+	assert.NotNil(t, err)
+}
+
+func TestProvisionThickImage(t *testing.T) {
+	clientset := test.New(3)
+	os.Setenv("POD_NAMESPACE", "rook-system")
+	defer os.Setenv("POD_NAMESPACE", "")
+	written := 0
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithOutput: func(debug bool, actionName string, command string, args ...string) (string, error) {
+			if command == "rbd" && args[0] == "ls" && args[1] == "-l" {
+				return `[{"image":"pvc-uid-1-1","size":8388608,"format":2}]`, nil
+			}
+			if command == "rbd" && args[0] == "info" {
+				return `{"name":"pvc-uid-1-1","size":8388608,"objects":2,"order":22,"block_name_prefix":"rbd_data.10226b8b4567"}`, nil
+			}
+			if command == "rbd" && args[0] == "bench" {
+				assert.Equal(t, "testpool/pvc-uid-1-1", args[1])
+				written++
+			}
+			return "", nil
+		},
+	}
+	context := &clusterd.Context{
+		Clientset:     clientset,
+		RookClientset: rookfake.NewSimpleClientset(),
+		Executor:      executor,
+	}
+
+	// the volume is pending until its image is allocated by the allocation queue
+	provisioner := New(context, "foo.io")
+	volume := newVolumeOptions(newStorageClass("class-1", "foo.io/block", map[string]string{"pool": "testpool", "clusterNamespace": "testCluster", "thickProvision": "true"}), newClaim("claim-1", "uid-1-1", "class-1", "", "class-1", nil))
+	_, err := clientset.CoreV1().PersistentVolumeClaims(v1.NamespaceDefault).Create(volume.PVC)
+	assert.Nil(t, err)
+	_, err = provisioner.Provision(volume)
+	assert.NotNil(t, err)
+	_, pending := err.(*controller.PendingError)
+	assert.True(t, pending)
+	assert.Equal(t, 0, written)
+
+	assert.Nil(t, oppool.NewImageAllocator(context, "testCluster").AllocateQueued(make(chan struct{})))
+	assert.Equal(t, 1, written)
+
+	pv, err := provisioner.Provision(volume)
+	assert.Nil(t, err)
+	assert.Equal(t, "pvc-uid-1-1", pv.Spec.PersistentVolumeSource.FlexVolume.Options["image"])
+	assert.Equal(t, 1, written)
+
+	_, err = parseClassParameters(map[string]string{"pool": "testpool", "thickProvision": "maybe"})
+	assert.NotNil(t, err)
+}
+
+func TestParseClassParametersTenants(t *testing.T) {
+	cfg := map[string]string{"pool": "testPool", "isolateTenants": "true"}
+	provConfig, err := parseClassParameters(cfg)
+	assert.Nil(t, err)
+	assert.True(t, provConfig.isolateTenants)
+
+	// the tenant namespace is implied, it cannot also be given explicitly
+	cfg["radosNamespace"] = "tenant1"
+	_, err = parseClassParameters(cfg)
+	assert.NotNil(t, err)
+
+	cfg = map[string]string{"pool": "testPool", "isolateTenants": "maybe"}
+	_, err = parseClassParameters(cfg)
+	assert.NotNil(t, err)
+}
+
+func TestParseClassParametersQoS(t *testing.T) {
+	cfg := map[string]string{"pool": "testPool", "qosIopsLimit": "500", "qosBpsBurst": "20971520"}
+	provConfig, err := parseClassParameters(cfg)
+	assert.Nil(t, err)
+	assert.Equal(t, ceph.ImageQoS{IOPSLimit: 500, BPSBurst: 20971520}, provConfig.qos)
+
+	cfg["qosBpsLimit"] = "10M"
+	_, err = parseClassParameters(cfg)
+	assert.NotNil(t, err)
 }
 
 func TestParseClassParametersDefault(t *testing.T) {
@@ -0,0 +1,101 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provisioner
+
+import (
+	"fmt"
+
+	ceph "github.com/rook/rook/pkg/daemon/ceph/client"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// checkQuota returns an error if provisioning an image of the given size would exceed the quota of the pool or of
+// the rados namespace where the image is created. The provisioned size is the total size of the other images, so an image
+// that was created by a previous attempt to provision it is not counted twice.
+func (p *RookVolumeProvisioner) checkQuota(cfg *provisionerConfig, image string, size int64) error {
+	pool, err := p.context.RookClientset.CephV1beta1().Pools(cfg.clusterNamespace).Get(cfg.pool, metav1.GetOptions{})
+	if err != nil {
+		if errors.IsNotFound(err) {
+			// the pool was not created from a pool crd, so it has no quota
+			return nil
+		}
+		return fmt.Errorf("failed to get pool %s to check its quota. %+v", cfg.pool, err)
+	}
+	quota := pool.Spec.Quota
+
+	if quota.MaxProvisionedSizePerNamespace != "" {
+		used, err := p.provisionedSize(cfg.clusterNamespace, image, []string{ceph.PoolNamespaceSpec(cfg.pool, cfg.radosNamespace)})
+		if err != nil {
+			return err
+		}
+		scope := fmt.Sprintf("namespace %q of pool %s", cfg.radosNamespace, cfg.pool)
+		if err := checkLimit(scope, quota.MaxProvisionedSizePerNamespace, used, size); err != nil {
+			return err
+		}
+	}
+
+	if quota.MaxProvisionedSize != "" {
+		pools := []string{cfg.pool}
+		namespaces, err := ceph.ListNamespaces(p.context, cfg.clusterNamespace, cfg.pool)
+		if err != nil {
+			// the pools of older ceph versions cannot have namespaces
+			logger.Warningf("failed to list namespaces of pool %s, only the images outside of namespaces count against the quota. %+v", cfg.pool, err)
+		}
+		for _, ns := range namespaces {
+			pools = append(pools, ceph.PoolNamespaceSpec(cfg.pool, ns.Name))
+		}
+		used, err := p.provisionedSize(cfg.clusterNamespace, image, pools)
+		if err != nil {
+			return err
+		}
+		if err := checkLimit("pool "+cfg.pool, quota.MaxProvisionedSize, used, size); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// provisionedSize returns the total size of the images in the pools except the given image
+func (p *RookVolumeProvisioner) provisionedSize(clusterNamespace, exclude string, pools []string) (int64, error) {
+	var total int64
+	for _, pool := range pools {
+		images, err := ceph.ListImages(p.context, clusterNamespace, pool)
+		if err != nil {
+			return 0, fmt.Errorf("failed to get the provisioned size of pool %s. %+v", pool, err)
+		}
+		for _, image := range images {
+			if image.Name != exclude {
+				total += int64(image.Size)
+			}
+		}
+	}
+	return total, nil
+}
+
+func checkLimit(scope, limit string, used, size int64) error {
+	max, err := resource.ParseQuantity(limit)
+	if err != nil {
+		return fmt.Errorf("invalid quota %q of %s. %+v", limit, scope, err)
+	}
+	if used+size > max.Value() {
+		return fmt.Errorf("quota exceeded: %s has %d bytes provisioned of its %s quota, cannot provision %d more bytes", scope, used, limit, size)
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package provisioner
+
+import (
+	"testing"
+
+	cephv1beta1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1beta1"
+	rookfake "github.com/rook/rook/pkg/client/clientset/versioned/fake"
+	"github.com/rook/rook/pkg/clusterd"
+	exectest "github.com/rook/rook/pkg/util/exec/test"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestCheckQuota(t *testing.T) {
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithOutput: func(debug bool, actionName string, command string, args ...string) (string, error) {
+			if command == "rbd" && args[0] == "namespace" && args[1] == "ls" {
+				return `[{"name":"tenant1"}]`, nil
+			}
+			if command == "rbd" && args[0] == "ls" && args[2] == "testpool" {
+				return `[{"image":"image1","size":4194304,"format":2}]`, nil
+			}
+			if command == "rbd" && args[0] == "ls" && args[2] == "testpool/tenant1" {
+				return `[{"image":"image2","size":2097152,"format":2}]`, nil
+			}
+			return `[]`, nil
+		},
+	}
+	pool := &cephv1beta1.Pool{
+		ObjectMeta: metav1.ObjectMeta{Name: "testpool", Namespace: "ns"},
+		Spec:       cephv1beta1.PoolSpec{Quota: cephv1beta1.QuotaSpec{MaxProvisionedSize: "8Mi", MaxProvisionedSizePerNamespace: "3Mi"}},
+	}
+	context := &clusterd.Context{Executor: executor, RookClientset: rookfake.NewSimpleClientset(pool)}
+	p := &RookVolumeProvisioner{context: context}
+
+	// a pool that is not known has no quota
+	err := p.checkQuota(&provisionerConfig{pool: "other", clusterNamespace: "ns"}, "new", 100*sizeMB)
+	assert.Nil(t, err)
+
+	// the quota of the namespace
+	cfg := &provisionerConfig{pool: "testpool", clusterNamespace: "ns", radosNamespace: "tenant1"}
+	err = p.checkQuota(cfg, "new", sizeMB)
+	assert.Nil(t, err)
+	err = p.checkQuota(cfg, "new", 2*sizeMB)
+	assert.NotNil(t, err)
+
+	// the quota of the pool counts the images of all namespaces
+	pool.Spec.Quota.MaxProvisionedSizePerNamespace = ""
+	_, err = context.RookClientset.CephV1beta1().Pools("ns").Update(pool)
+	assert.Nil(t, err)
+	err = p.checkQuota(cfg, "new", 2*sizeMB)
+	assert.Nil(t, err)
+	err = p.checkQuota(cfg, "new", 3*sizeMB)
+	assert.NotNil(t, err)
+
+	// an image that already exists is not counted twice
+	err = p.checkQuota(cfg, "image2", 4*sizeMB)
+	assert.Nil(t, err)
+}
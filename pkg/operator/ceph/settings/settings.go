@@ -0,0 +1,210 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package settings changes the tunables of the operator at runtime from a config map in the namespace of the operator.
+// The settings are the flags of the operator, which keep the value given on the command line or in the environment
+// until they are set in the config map.
+package settings
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/coreos/pkg/capnslog"
+	"github.com/rook/rook/pkg/clusterd"
+	"github.com/spf13/pflag"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+)
+
+var logger = capnslog.NewPackageLogger("github.com/rook/rook", "op-settings")
+
+// ConfigMapName is the config map with the settings of the operator
+const ConfigMapName = "rook-ceph-operator-settings"
+
+// CheckInterval is the interval to apply the settings of the config map again, in addition to applying them when the
+// config map changes
+var CheckInterval = time.Minute
+
+// Setting is a tunable of the operator with the value it had when the operator started
+type Setting struct {
+	Name        string
+	Type        string
+	Default     string
+	Description string
+	value       pflag.Value
+	validate    func(value string) error
+}
+
+// Registry is the settings of the operator that can be changed at runtime
+type Registry struct {
+	context  *clusterd.Context
+	settings map[string]*Setting
+	// the value last applied to each setting
+	applied map[string]string
+}
+
+// NewRegistry creates an empty registry of settings
+func NewRegistry(context *clusterd.Context) *Registry {
+	return &Registry{context: context, settings: map[string]*Setting{}, applied: map[string]string{}}
+}
+
+// Register adds the flag to the settings. The current value of the flag is the default of the setting, so the
+// flags must be parsed first. The value is optionally validated after it is parsed by the flag.
+func (r *Registry) Register(flagSet *pflag.FlagSet, name string, validate func(value string) error) error {
+	flag := flagSet.Lookup(name)
+	if flag == nil {
+		return fmt.Errorf("unknown flag %s", name)
+	}
+	r.settings[name] = &Setting{
+		Name:        name,
+		Type:        flag.Value.Type(),
+		Default:     flag.Value.String(),
+		Description: flag.Usage,
+		value:       flag.Value,
+		validate:    validate,
+	}
+	r.applied[name] = flag.Value.String()
+	return nil
+}
+
+// Settings returns the registered settings sorted by name
+func (r *Registry) Settings() []Setting {
+	settings := []Setting{}
+	for _, s := range r.settings {
+		settings = append(settings, *s)
+	}
+	sort.Slice(settings, func(i, j int) bool { return settings[i].Name < settings[j].Name })
+	return settings
+}
+
+// Start applies the settings of the config map in the namespace of the operator when the config map changes, until
+// the channel is closed
+func (r *Registry) Start(namespace string, stopCh chan struct{}) {
+	selector := fields.OneTermEqualSelector("metadata.name", ConfigMapName).String()
+	source := &cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			options.FieldSelector = selector
+			return r.context.Clientset.CoreV1().ConfigMaps(namespace).List(options)
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			options.FieldSelector = selector
+			return r.context.Clientset.CoreV1().ConfigMaps(namespace).Watch(options)
+		},
+	}
+	_, controller := cache.NewInformer(source, &v1.ConfigMap{}, CheckInterval, cache.ResourceEventHandlerFuncs{
+		AddFunc:    r.onChange,
+		UpdateFunc: func(oldObj, newObj interface{}) { r.onChange(newObj) },
+		// the settings are reset to their defaults when the config map is deleted
+		DeleteFunc: func(obj interface{}) { r.apply(map[string]string{}) },
+	})
+
+	logger.Infof("watching the operator settings in configmap %s", ConfigMapName)
+	controller.Run(stopCh)
+	logger.Infof("stopping the operator settings watcher")
+}
+
+func (r *Registry) onChange(obj interface{}) {
+	cm, ok := obj.(*v1.ConfigMap)
+	if !ok || cm.Name != ConfigMapName {
+		return
+	}
+	r.apply(cm.Data)
+}
+
+func (r *Registry) apply(data map[string]string) {
+	for _, err := range r.Apply(data) {
+		logger.Warningf("ignoring operator setting. %+v", err)
+	}
+}
+
+// Apply sets the settings to the values in the data, and the settings missing from the data back to their default.
+// A setting with an invalid value keeps its current value. The errors of the unknown and invalid settings are
+// returned.
+func (r *Registry) Apply(data map[string]string) []error {
+	errs := []error{}
+	for key := range data {
+		if _, ok := r.settings[key]; !ok {
+			errs = append(errs, fmt.Errorf("unknown setting %s", key))
+		}
+	}
+
+	for _, s := range r.Settings() {
+		value, ok := data[s.Name]
+		if !ok {
+			value = s.Default
+		}
+		if value == r.applied[s.Name] {
+			continue
+		}
+		if s.validate != nil {
+			if err := s.validate(value); err != nil {
+				errs = append(errs, fmt.Errorf("invalid value %q for setting %s. %+v", value, s.Name, err))
+				continue
+			}
+		}
+		if err := s.value.Set(value); err != nil {
+			errs = append(errs, fmt.Errorf("invalid value %q for setting %s. %+v", value, s.Name, err))
+			continue
+		}
+		logger.Infof("operator setting %s changed from %s to %s", s.Name, r.applied[s.Name], value)
+		r.applied[s.Name] = value
+	}
+	sort.Slice(errs, func(i, j int) bool { return errs[i].Error() < errs[j].Error() })
+	return errs
+}
+
+// PositiveDuration validates that the value is a duration greater than zero, such as the interval of a watcher
+func PositiveDuration(value string) error {
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+	if d <= 0 {
+		return fmt.Errorf("the duration must be greater than zero")
+	}
+	return nil
+}
+
+// NonNegativeDuration validates that the value is a duration that is not negative
+func NonNegativeDuration(value string) error {
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+	if d < 0 {
+		return fmt.Errorf("the duration must not be negative")
+	}
+	return nil
+}
+
+// Ratio validates that the value is a number between zero and one, such as a share of the objects
+func Ratio(value string) error {
+	r, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return err
+	}
+	if r < 0 || r > 1 {
+		return fmt.Errorf("the ratio must be between 0 and 1")
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package settings
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rook/rook/pkg/clusterd"
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestApply(t *testing.T) {
+	interval := time.Hour
+	cleanup := false
+	flagSet := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	flagSet.DurationVar(&interval, "check-interval", interval, "interval of the check")
+	flagSet.BoolVar(&cleanup, "cleanup", cleanup, "delete what is found")
+	assert.Nil(t, flagSet.Parse([]string{"--check-interval=2h"}))
+
+	r := NewRegistry(&clusterd.Context{})
+	assert.Nil(t, r.Register(flagSet, "check-interval", PositiveDuration))
+	assert.Nil(t, r.Register(flagSet, "cleanup", nil))
+	assert.NotNil(t, r.Register(flagSet, "missing", nil))
+
+	// the value of the command line is the default
+	settings := r.Settings()
+	assert.Equal(t, 2, len(settings))
+	assert.Equal(t, "check-interval", settings[0].Name)
+	assert.Equal(t, "duration", settings[0].Type)
+	assert.Equal(t, "2h0m0s", settings[0].Default)
+	assert.Equal(t, "cleanup", settings[1].Name)
+
+	errs := r.Apply(map[string]string{"check-interval": "10m", "cleanup": "true"})
+	assert.Equal(t, 0, len(errs))
+	assert.Equal(t, 10*time.Minute, interval)
+	assert.True(t, cleanup)
+
+	// invalid values keep the current value
+	errs = r.Apply(map[string]string{"check-interval": "0s", "cleanup": "maybe", "other": "1"})
+	assert.Equal(t, 3, len(errs))
+	assert.Contains(t, errs[0].Error(), "setting check-interval")
+	assert.Contains(t, errs[1].Error(), "setting cleanup")
+	assert.Equal(t, "unknown setting other", errs[2].Error())
+	assert.Equal(t, 10*time.Minute, interval)
+	assert.True(t, cleanup)
+
+	// the settings removed from the config map are reset to their default
+	errs = r.Apply(map[string]string{})
+	assert.Equal(t, 0, len(errs))
+	assert.Equal(t, 2*time.Hour, interval)
+	assert.False(t, cleanup)
+}
+
+func TestStart(t *testing.T) {
+	interval := NewDuration(time.Hour)
+	flagSet := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	flagSet.Var(interval, "check-interval", "interval of the check")
+
+	clientset := fake.NewSimpleClientset()
+	r := NewRegistry(&clusterd.Context{Clientset: clientset})
+	assert.Nil(t, r.Register(flagSet, "check-interval", PositiveDuration))
+	assert.Equal(t, "duration", r.Settings()[0].Type)
+	assert.Equal(t, "1h0m0s", r.Settings()[0].Default)
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	go r.Start("ns", stopCh)
+	waitFor := func(expected time.Duration) {
+		for i := 0; i < 100 && interval.Get() != expected; i++ {
+			time.Sleep(50 * time.Millisecond)
+		}
+		assert.Equal(t, expected, interval.Get())
+	}
+
+	// the settings are applied when the config map is created, changed and deleted
+	cm := &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: ConfigMapName, Namespace: "ns"},
+		Data:       map[string]string{"check-interval": "5m"},
+	}
+	_, err := clientset.CoreV1().ConfigMaps("ns").Create(cm)
+	assert.Nil(t, err)
+	waitFor(5 * time.Minute)
+
+	cm.Data["check-interval"] = "10m"
+	_, err = clientset.CoreV1().ConfigMaps("ns").Update(cm)
+	assert.Nil(t, err)
+	waitFor(10 * time.Minute)
+
+	assert.Nil(t, clientset.CoreV1().ConfigMaps("ns").Delete(ConfigMapName, &metav1.DeleteOptions{}))
+	waitFor(time.Hour)
+}
+
+func TestValues(t *testing.T) {
+	// the values have the format of the flags of the native types
+	d := NewDuration(90 * time.Second)
+	assert.Equal(t, "1m30s", d.String())
+	assert.Nil(t, d.Set("2h"))
+	assert.Equal(t, 2*time.Hour, d.Get())
+	assert.NotNil(t, d.Set("soon"))
+
+	i := NewInt(4)
+	assert.Equal(t, "4", i.String())
+	assert.Nil(t, i.Set("8"))
+	assert.Equal(t, 8, i.Get())
+	assert.NotNil(t, i.Set("many"))
+
+	b := NewBool(false)
+	assert.Equal(t, "false", b.String())
+	assert.Nil(t, b.Set("true"))
+	assert.True(t, b.Get())
+	assert.NotNil(t, b.Set("maybe"))
+
+	f := NewFloat(0.1)
+	assert.Equal(t, "0.1", f.String())
+	assert.Nil(t, f.Set("0.25"))
+	assert.Equal(t, 0.25, f.Get())
+	assert.Equal(t, "float64", f.Type())
+}
+
+func TestValidateDuration(t *testing.T) {
+	assert.Nil(t, PositiveDuration("1m"))
+	assert.NotNil(t, PositiveDuration("0s"))
+	assert.NotNil(t, PositiveDuration("soon"))
+	assert.Nil(t, NonNegativeDuration("0s"))
+	assert.NotNil(t, NonNegativeDuration("-1m"))
+}
+
+func TestValidateRatio(t *testing.T) {
+	assert.Nil(t, Ratio("0.05"))
+	assert.Nil(t, Ratio("1"))
+	assert.NotNil(t, Ratio("1.5"))
+	assert.NotNil(t, Ratio("-0.1"))
+	assert.NotNil(t, Ratio("half"))
+}
@@ -0,0 +1,166 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package settings
+
+import (
+	"math"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// The values of the settings are flags that are read by the watchers of the operator while the settings watcher
+// changes them, so they are stored atomically. Each value implements pflag.Value with the same type and format as the
+// flag of the native type.
+
+// Duration is a duration setting
+type Duration struct {
+	value int64
+}
+
+// NewDuration creates a duration setting with the initial value
+func NewDuration(d time.Duration) *Duration {
+	return &Duration{value: int64(d)}
+}
+
+// Get returns the current value
+func (d *Duration) Get() time.Duration {
+	return time.Duration(atomic.LoadInt64(&d.value))
+}
+
+// Store changes the value
+func (d *Duration) Store(value time.Duration) {
+	atomic.StoreInt64(&d.value, int64(value))
+}
+
+func (d *Duration) String() string { return d.Get().String() }
+func (d *Duration) Type() string   { return "duration" }
+
+// Set parses the value of the flag
+func (d *Duration) Set(s string) error {
+	value, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	d.Store(value)
+	return nil
+}
+
+// Int is an integer setting
+type Int struct {
+	value int64
+}
+
+// NewInt creates an integer setting with the initial value
+func NewInt(i int) *Int {
+	return &Int{value: int64(i)}
+}
+
+// Get returns the current value
+func (i *Int) Get() int {
+	return int(atomic.LoadInt64(&i.value))
+}
+
+// Store changes the value
+func (i *Int) Store(value int) {
+	atomic.StoreInt64(&i.value, int64(value))
+}
+
+func (i *Int) String() string { return strconv.Itoa(i.Get()) }
+func (i *Int) Type() string   { return "int" }
+
+// Set parses the value of the flag
+func (i *Int) Set(s string) error {
+	value, err := strconv.ParseInt(s, 0, 64)
+	if err != nil {
+		return err
+	}
+	i.Store(int(value))
+	return nil
+}
+
+// Bool is a boolean setting
+type Bool struct {
+	value int32
+}
+
+// NewBool creates a boolean setting with the initial value
+func NewBool(b bool) *Bool {
+	s := &Bool{}
+	s.Store(b)
+	return s
+}
+
+// Get returns the current value
+func (b *Bool) Get() bool {
+	return atomic.LoadInt32(&b.value) != 0
+}
+
+// Store changes the value
+func (b *Bool) Store(value bool) {
+	var v int32
+	if value {
+		v = 1
+	}
+	atomic.StoreInt32(&b.value, v)
+}
+
+func (b *Bool) String() string { return strconv.FormatBool(b.Get()) }
+func (b *Bool) Type() string   { return "bool" }
+
+// Set parses the value of the flag
+func (b *Bool) Set(s string) error {
+	value, err := strconv.ParseBool(s)
+	if err != nil {
+		return err
+	}
+	b.Store(value)
+	return nil
+}
+
+// Float is a floating point setting
+type Float struct {
+	value uint64
+}
+
+// NewFloat creates a floating point setting with the initial value
+func NewFloat(f float64) *Float {
+	return &Float{value: math.Float64bits(f)}
+}
+
+// Get returns the current value
+func (f *Float) Get() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&f.value))
+}
+
+// Store changes the value
+func (f *Float) Store(value float64) {
+	atomic.StoreUint64(&f.value, math.Float64bits(value))
+}
+
+func (f *Float) String() string { return strconv.FormatFloat(f.Get(), 'g', -1, 64) }
+func (f *Float) Type() string   { return "float64" }
+
+// Set parses the value of the flag
+func (f *Float) Set(s string) error {
+	value, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return err
+	}
+	f.Store(value)
+	return nil
+}
@@ -28,12 +28,14 @@ import (
 	rookalpha "github.com/rook/rook/pkg/apis/rook.io/v1alpha2"
 	"github.com/rook/rook/pkg/clusterd"
 	discoverDaemon "github.com/rook/rook/pkg/daemon/discover"
+	osdconfig "github.com/rook/rook/pkg/operator/ceph/cluster/osd/config"
 	"github.com/rook/rook/pkg/operator/k8sutil"
 	"github.com/rook/rook/pkg/util/sys"
 	"k8s.io/api/core/v1"
 	extensions "k8s.io/api/extensions/v1beta1"
 	"k8s.io/api/rbac/v1beta1"
 	kserrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 )
@@ -81,6 +83,7 @@ func (d *Discover) Start(namespace, discoverImage, securityAccount string) error
 
 func (d *Discover) createDiscoverDaemonSet(namespace, discoverImage, securityAccount string) error {
 	privileged := true
+	optional := true
 	ds := &extensions.DaemonSet{
 		ObjectMeta: metav1.ObjectMeta{
 			Name: discoverDaemonsetName,
@@ -122,6 +125,11 @@ func (d *Discover) createDiscoverDaemonSet(namespace, discoverImage, securityAcc
 									MountPath: "/run/udev",
 									ReadOnly:  true,
 								},
+								{
+									Name:      "inventory",
+									MountPath: discoverDaemon.InventoryDir,
+									ReadOnly:  true,
+								},
 							},
 							Env: []v1.EnvVar{
 								k8sutil.NamespaceEnvVar(),
@@ -154,8 +162,21 @@ func (d *Discover) createDiscoverDaemonSet(namespace, discoverImage, securityAcc
 								},
 							},
 						},
+						{
+							// the static inventory is optional, the devices are discovered if it does not exist
+							Name: "inventory",
+							VolumeSource: v1.VolumeSource{
+								ConfigMap: &v1.ConfigMapVolumeSource{
+									LocalObjectReference: v1.LocalObjectReference{Name: discoverDaemon.InventoryConfigMapName},
+									Optional:             &optional,
+								},
+							},
+						},
 					},
-					HostNetwork: false,
+					// the udev events of the host are only received in the network namespace of the host
+					HostNetwork: true,
+					// the mounts of the host are read from its init process to find the boot disk and the mounted devices
+					HostPID: true,
 				},
 			},
 		},
@@ -322,7 +343,8 @@ func FreeDevicesByCluster(context *clusterd.Context, clusterName string) error {
 }
 
 // GetAvailableDevices conducts outer join using input filters with free devices that a node has. It marks the devices from join result as in-use.
-func GetAvailableDevices(context *clusterd.Context, nodeName, clusterName string, devices []rookalpha.Device, filter string, useAllDevices bool) ([]rookalpha.Device, error) {
+func GetAvailableDevices(context *clusterd.Context, nodeName, clusterName string, devices []rookalpha.Device, filter string, attributes *rookalpha.DeviceAttributes,
+	useAllDevices bool) ([]rookalpha.Device, error) {
 	results := []rookalpha.Device{}
 	if len(devices) == 0 && len(filter) == 0 && !useAllDevices {
 		return results, nil
@@ -360,7 +382,12 @@ func GetAvailableDevices(context *clusterd.Context, nodeName, clusterName string
 	if len(devices) > 0 {
 		for i := range devices {
 			for j := range nodeDevices {
-				if devices[i].Name == nodeDevices[j].Name {
+				if nodeDevices[j].MatchesID(devices[i].Name) {
+					if nodeDevices[j].Mountpoint != "" && !ProtectedDeviceOverride(devices[i]) {
+						logger.Warningf("skipping device %s on node %s that is mounted at %s. set its %s config to %s to format it anyway",
+							devices[i].Name, nodeName, nodeDevices[j].Mountpoint, osdconfig.ProtectedDeviceOverrideKey, devices[i].Name)
+						continue
+					}
 					results = append(results, devices[i])
 					claimedDevices = append(claimedDevices, nodeDevices[j])
 				}
@@ -370,7 +397,7 @@ func GetAvailableDevices(context *clusterd.Context, nodeName, clusterName string
 		for i := range nodeDevices {
 			//TODO support filter based on other keys
 			matched, err := regexp.Match(filter, []byte(nodeDevices[i].Name))
-			if err == nil && matched {
+			if err == nil && matched && nodeDevices[i].Mountpoint == "" && MatchesAttributes(nodeDevices[i], attributes) {
 				d := rookalpha.Device{
 					Name: nodeDevices[i].Name,
 				}
@@ -380,6 +407,9 @@ func GetAvailableDevices(context *clusterd.Context, nodeName, clusterName string
 		}
 	} else if useAllDevices {
 		for i := range nodeDevices {
+			if nodeDevices[i].Mountpoint != "" || !MatchesAttributes(nodeDevices[i], attributes) {
+				continue
+			}
 			d := rookalpha.Device{
 				Name: nodeDevices[i].Name,
 			}
@@ -421,3 +451,82 @@ func GetAvailableDevices(context *clusterd.Context, nodeName, clusterName string
 	}
 	return results, nil
 }
+
+// DeviceMatches returns whether a discovered device is selected by the devices, the filter or useAllDevices of a node,
+// in the same order of precedence as GetAvailableDevices
+func DeviceMatches(device sys.LocalDisk, devices []rookalpha.Device, filter string, attributes *rookalpha.DeviceAttributes, useAllDevices bool) bool {
+	if len(devices) > 0 {
+		for _, d := range devices {
+			if device.MatchesID(d.Name) {
+				return device.Mountpoint == "" || ProtectedDeviceOverride(d)
+			}
+		}
+		return false
+	}
+	if device.Mountpoint != "" {
+		return false
+	}
+	if filter != "" {
+		matched, err := regexp.Match(filter, []byte(device.Name))
+		return err == nil && matched && MatchesAttributes(device, attributes)
+	}
+	return useAllDevices && MatchesAttributes(device, attributes)
+}
+
+// ProtectedDeviceOverride returns whether a device with a mounted filesystem, such as the boot disk, can still be
+// formatted for an osd. The device must be listed by name and its name repeated in its protectedDeviceOverride config.
+func ProtectedDeviceOverride(device rookalpha.Device) bool {
+	return device.Name != "" && device.Config[osdconfig.ProtectedDeviceOverrideKey] == device.Name
+}
+
+// MatchesAttributes returns whether the device has all the attributes that are set. No device matches invalid
+// attributes, so a typo does not select more devices than intended.
+func MatchesAttributes(device sys.LocalDisk, attributes *rookalpha.DeviceAttributes) bool {
+	if attributes == nil {
+		return true
+	}
+	if attributes.Rotational != nil && *attributes.Rotational != device.Rotational {
+		return false
+	}
+	if attributes.MinSize != "" {
+		min, err := resource.ParseQuantity(attributes.MinSize)
+		if err != nil {
+			logger.Warningf("invalid minSize %s of the device attributes. %+v", attributes.MinSize, err)
+			return false
+		}
+		if device.Size < uint64(min.Value()) {
+			return false
+		}
+	}
+	if attributes.MaxSize != "" {
+		max, err := resource.ParseQuantity(attributes.MaxSize)
+		if err != nil {
+			logger.Warningf("invalid maxSize %s of the device attributes. %+v", attributes.MaxSize, err)
+			return false
+		}
+		if device.Size > uint64(max.Value()) {
+			return false
+		}
+	}
+	if attributes.Model != "" {
+		matched, err := regexp.MatchString(attributes.Model, device.Model)
+		if err != nil {
+			logger.Warningf("invalid model %s of the device attributes. %+v", attributes.Model, err)
+			return false
+		}
+		if !matched {
+			return false
+		}
+	}
+	if attributes.Exclude != "" {
+		excluded, err := regexp.MatchString(attributes.Exclude, device.Name)
+		if err != nil {
+			logger.Warningf("invalid exclude %s of the device attributes. %+v", attributes.Exclude, err)
+			return false
+		}
+		if excluded {
+			return false
+		}
+	}
+	return true
+}
@@ -24,8 +24,10 @@ import (
 	rookalpha "github.com/rook/rook/pkg/apis/rook.io/v1alpha2"
 	"github.com/rook/rook/pkg/clusterd"
 	discoverDaemon "github.com/rook/rook/pkg/daemon/discover"
+	osdconfig "github.com/rook/rook/pkg/operator/ceph/cluster/osd/config"
 	"github.com/rook/rook/pkg/operator/k8sutil"
 	"github.com/rook/rook/pkg/operator/test"
+	"github.com/rook/rook/pkg/util/sys"
 
 	"github.com/stretchr/testify/assert"
 
@@ -57,9 +59,9 @@ func TestStartDiscoveryDaemonset(t *testing.T) {
 	assert.Equal(t, "mysa", agentDS.Spec.Template.Spec.ServiceAccountName)
 	assert.True(t, *agentDS.Spec.Template.Spec.Containers[0].SecurityContext.Privileged)
 	volumes := agentDS.Spec.Template.Spec.Volumes
-	assert.Equal(t, 3, len(volumes))
+	assert.Equal(t, 4, len(volumes))
 	volumeMounts := agentDS.Spec.Template.Spec.Containers[0].VolumeMounts
-	assert.Equal(t, 3, len(volumeMounts))
+	assert.Equal(t, 4, len(volumeMounts))
 	envs := agentDS.Spec.Template.Spec.Containers[0].Env
 	assert.Equal(t, 2, len(envs))
 	image := agentDS.Spec.Template.Spec.Containers[0].Image
@@ -109,36 +111,80 @@ func TestGetAvailableDevices(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, 1, len(nodeDevices))
 
-	devices, err := GetAvailableDevices(context, nodeName, ns, d, "^sd.", false)
+	devices, err := GetAvailableDevices(context, nodeName, ns, d, "^sd.", nil, false)
 	assert.Nil(t, err)
 	assert.Equal(t, 1, len(devices))
 	// devices should be in use now, 2nd try gets the same list
-	devices, err = GetAvailableDevices(context, nodeName, ns, d, "^sd.", false)
+	devices, err = GetAvailableDevices(context, nodeName, ns, d, "^sd.", nil, false)
 	assert.Nil(t, err)
 	assert.Equal(t, 1, len(devices))
 
 	err = FreeDevices(context, nodeName, ns)
 	assert.Nil(t, err)
 	// all devices freed
-	devices, err = GetAvailableDevices(context, nodeName, ns, nil, "^sd.", false)
+	devices, err = GetAvailableDevices(context, nodeName, ns, nil, "^sd.", nil, false)
 	assert.Nil(t, err)
 	assert.Equal(t, 4, len(devices))
 	// devices should be in use now, 2nd try gets the same list
-	devices, err = GetAvailableDevices(context, nodeName, ns, nil, "^sd.", false)
+	devices, err = GetAvailableDevices(context, nodeName, ns, nil, "^sd.", nil, false)
 	assert.Nil(t, err)
 	assert.Equal(t, 4, len(devices))
 
 	err = FreeDevices(context, nodeName, ns)
 	assert.Nil(t, err)
 
-	devices, err = GetAvailableDevices(context, nodeName, ns, nil, "", true)
+	devices, err = GetAvailableDevices(context, nodeName, ns, nil, "", nil, true)
 	assert.Nil(t, err)
 	assert.Equal(t, 5, len(devices))
 	// devices should be in use now, 2nd try gets the same list
-	devices, err = GetAvailableDevices(context, nodeName, ns, nil, "", true)
+	devices, err = GetAvailableDevices(context, nodeName, ns, nil, "", nil, true)
 	assert.Nil(t, err)
 	assert.Equal(t, 5, len(devices))
 
 	err = FreeDevices(context, nodeName, ns)
 	assert.Nil(t, err)
 }
+
+func TestDeviceMatches(t *testing.T) {
+	device := sys.LocalDisk{Name: "sdb", Serial: "ZA4A1B2C"}
+	assert.True(t, DeviceMatches(device, []rookalpha.Device{{Name: "sdc"}, {Name: "ZA4A1B2C"}}, "", nil, false))
+	assert.False(t, DeviceMatches(device, []rookalpha.Device{{Name: "sdc"}}, "^sd.", nil, true))
+	assert.True(t, DeviceMatches(device, nil, "^sd.", nil, false))
+	assert.False(t, DeviceMatches(device, nil, "^nvme", nil, true))
+	assert.True(t, DeviceMatches(device, nil, "", nil, true))
+	assert.False(t, DeviceMatches(device, nil, "", nil, false))
+}
+
+func TestProtectedDevices(t *testing.T) {
+	boot := sys.LocalDisk{Name: "sda", Serial: "ZA4A1B2C", Mountpoint: "/"}
+	assert.False(t, DeviceMatches(boot, nil, "^sd.", nil, false))
+	assert.False(t, DeviceMatches(boot, nil, "", nil, true))
+	assert.False(t, DeviceMatches(boot, []rookalpha.Device{{Name: "sda"}}, "", nil, false))
+
+	// the device must be listed and its name confirmed in the override
+	override := rookalpha.Device{Name: "sda", Config: map[string]string{osdconfig.ProtectedDeviceOverrideKey: "sda"}}
+	assert.True(t, ProtectedDeviceOverride(override))
+	assert.True(t, DeviceMatches(boot, []rookalpha.Device{override}, "", nil, false))
+	assert.False(t, ProtectedDeviceOverride(rookalpha.Device{Name: "sda", Config: map[string]string{osdconfig.ProtectedDeviceOverrideKey: "true"}}))
+	assert.False(t, ProtectedDeviceOverride(rookalpha.Device{Config: map[string]string{osdconfig.ProtectedDeviceOverrideKey: ""}}))
+}
+
+func TestMatchesAttributes(t *testing.T) {
+	hdd := sys.LocalDisk{Name: "sdb", Size: 4000787030016, Rotational: true, Model: "ST4000NM0035"}
+	ssd := sys.LocalDisk{Name: "nvme0n1", Size: 400088457216, Model: "INTEL SSDPE2MD400G4"}
+	rotational := true
+	allHDDs := &rookalpha.DeviceAttributes{Rotational: &rotational, MinSize: "4T"}
+	assert.True(t, MatchesAttributes(hdd, nil))
+	assert.True(t, MatchesAttributes(hdd, allHDDs))
+	assert.False(t, MatchesAttributes(ssd, allHDDs))
+	assert.False(t, MatchesAttributes(hdd, &rookalpha.DeviceAttributes{MinSize: "4Ti"}))
+	assert.True(t, MatchesAttributes(ssd, &rookalpha.DeviceAttributes{MaxSize: "1Ti", Model: "^INTEL"}))
+	assert.False(t, MatchesAttributes(hdd, &rookalpha.DeviceAttributes{Model: "^INTEL"}))
+	assert.False(t, MatchesAttributes(ssd, &rookalpha.DeviceAttributes{Exclude: "^nvme0"}))
+	assert.False(t, MatchesAttributes(hdd, &rookalpha.DeviceAttributes{MinSize: "4TB"}))
+
+	// the attributes apply to the devices selected by the filter or useAllDevices
+	assert.False(t, DeviceMatches(ssd, nil, "", allHDDs, true))
+	assert.True(t, DeviceMatches(hdd, nil, "^sd", allHDDs, false))
+	assert.True(t, DeviceMatches(ssd, []rookalpha.Device{{Name: "nvme0n1"}}, "", allHDDs, false))
+}
@@ -18,6 +18,8 @@ limitations under the License.
 package k8sutil
 
 import (
+	"fmt"
+
 	"k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -25,6 +27,9 @@ import (
 	"k8s.io/client-go/kubernetes"
 )
 
+// the number of times a config map is modified again when it was changed concurrently
+const configMapUpdateRetries = 5
+
 type ConfigMapKVStore struct {
 	namespace string
 	clientset kubernetes.Interface
@@ -110,3 +115,44 @@ func (kv *ConfigMapKVStore) ClearStore(storeName string) error {
 
 	return nil
 }
+
+// ModifyConfigMap modifies the config map, creating it with the owner ref if it does not exist and retrying when it was
+// changed concurrently. The data of the config map is never nil when it is modified.
+func ModifyConfigMap(clientset kubernetes.Interface, namespace, name string, ownerRef *metav1.OwnerReference, modify func(cm *v1.ConfigMap)) error {
+	configMaps := clientset.CoreV1().ConfigMaps(namespace)
+	for i := 0; i < configMapUpdateRetries; i++ {
+		cm, err := configMaps.Get(name, metav1.GetOptions{})
+		if err != nil {
+			if !errors.IsNotFound(err) {
+				return fmt.Errorf("failed to get configmap %s. %+v", name, err)
+			}
+			cm = &v1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+				Data:       map[string]string{},
+			}
+			SetOwnerRef(clientset, namespace, &cm.ObjectMeta, ownerRef)
+			modify(cm)
+			_, err = configMaps.Create(cm)
+			if err == nil {
+				return nil
+			}
+			if !errors.IsAlreadyExists(err) {
+				return fmt.Errorf("failed to create configmap %s. %+v", name, err)
+			}
+			continue
+		}
+
+		if cm.Data == nil {
+			cm.Data = map[string]string{}
+		}
+		modify(cm)
+		_, err = configMaps.Update(cm)
+		if err == nil {
+			return nil
+		}
+		if !errors.IsConflict(err) {
+			return fmt.Errorf("failed to update configmap %s. %+v", name, err)
+		}
+	}
+	return fmt.Errorf("failed to update configmap %s after %d conflicts", name, configMapUpdateRetries)
+}
@@ -18,6 +18,7 @@ limitations under the License.
 package k8sutil
 
 import (
+	"fmt"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -26,7 +27,9 @@ import (
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
 )
 
 func TestGetValueStoreNotExist(t *testing.T) {
@@ -157,6 +160,43 @@ func TestClearStore(t *testing.T) {
 	assert.True(t, errors.IsNotFound(err))
 }
 
+func TestModifyConfigMap(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	set := func(key, value string) func(cm *v1.ConfigMap) {
+		return func(cm *v1.ConfigMap) { cm.Data[key] = value }
+	}
+
+	// the config map is created if it does not exist
+	err := ModifyConfigMap(clientset, "ns", "cm1", nil, set("key1", "value1"))
+	assert.Nil(t, err)
+	cm, err := clientset.CoreV1().ConfigMaps("ns").Get("cm1", metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"key1": "value1"}, cm.Data)
+
+	// the update is retried after a conflict
+	conflicts := 0
+	clientset.PrependReactor("update", "configmaps", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if conflicts > 0 {
+			return false, nil, nil
+		}
+		conflicts++
+		return true, nil, errors.NewConflict(schema.GroupResource{Resource: "configmaps"}, "cm1", fmt.Errorf("conflict"))
+	})
+	err = ModifyConfigMap(clientset, "ns", "cm1", nil, set("key2", "value2"))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, conflicts)
+	cm, err = clientset.CoreV1().ConfigMaps("ns").Get("cm1", metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"key1": "value1", "key2": "value2"}, cm.Data)
+
+	// other errors are returned
+	clientset.PrependReactor("update", "configmaps", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, fmt.Errorf("mock failure")
+	})
+	err = ModifyConfigMap(clientset, "ns", "cm1", nil, set("key3", "value3"))
+	assert.NotNil(t, err)
+}
+
 func newKVStore(stores ...*v1.ConfigMap) (*ConfigMapKVStore, string) {
 	namespace := "kvstore_test"
 	storeName := "store1"
@@ -0,0 +1,46 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sutil
+
+import (
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/rook/rook/pkg/util/metrics"
+	k8smetrics "k8s.io/client-go/tools/metrics"
+)
+
+var registerRequestMetricsOnce sync.Once
+
+type requestLatency struct{}
+
+func (requestLatency) Observe(verb string, u url.URL, latency time.Duration) {
+	metrics.ObserveKubernetesRequest(verb, latency)
+}
+
+type requestResult struct{}
+
+func (requestResult) Increment(code string, method string, host string) {}
+
+// RegisterRequestMetrics records the latencies of the requests of the kubernetes clients in the rook metrics. The
+// client metrics are only set by the first call since setting them is not safe while the clients make requests.
+func RegisterRequestMetrics() {
+	registerRequestMetricsOnce.Do(func() {
+		k8smetrics.Register(requestLatency{}, requestResult{})
+	})
+}
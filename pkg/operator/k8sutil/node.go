@@ -26,8 +26,40 @@ import (
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/client-go/kubernetes"
 	helper "k8s.io/kubernetes/pkg/api/v1/helper"
+	"k8s.io/kubernetes/pkg/kubelet/apis"
 )
 
+// SupportedArchitectures are the architectures of the nodes the daemons can be placed on. The rook and ceph images
+// must be built for each of them, such as the multi-arch images of the releases for amd64 and arm64.
+var SupportedArchitectures = []string{"amd64", "arm64"}
+
+// NodeArchitecture returns the architecture of the node from the label of the kubelet, or an empty string if the
+// kubelet does not set it
+func NodeArchitecture(node v1.Node) string {
+	return node.Labels[apis.LabelArch]
+}
+
+// SupportedArchitecture returns whether the daemons can run on nodes of the architecture
+func SupportedArchitecture(arch string) bool {
+	for _, a := range SupportedArchitectures {
+		if a == arch {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidNewNode returns whether a new daemon can be placed on the node. Besides being valid, the node must have a
+// supported architecture so that the images of the daemons are available for it. The architecture is not checked for
+// the nodes that already run daemons, which are kept if the supported architectures change such as on an upgrade.
+func ValidNewNode(node v1.Node, placement rookalpha.Placement) (bool, error) {
+	if arch := NodeArchitecture(node); arch != "" && !SupportedArchitecture(arch) {
+		logger.Infof("node %s has architecture %s, which is not in the supported architectures %v", node.Name, arch, SupportedArchitectures)
+		return false, nil
+	}
+	return ValidNode(node, placement)
+}
+
 func ValidNode(node v1.Node, placement rookalpha.Placement) (bool, error) {
 	// a node cannot be disabled
 	if node.Spec.Unschedulable {
@@ -79,6 +111,23 @@ func ValidNode(node v1.Node, placement rookalpha.Placement) (bool, error) {
 }
 
 func GetValidNodes(rookNodes []rookalpha.Node, clientset kubernetes.Interface, placement rookalpha.Placement) []rookalpha.Node {
+	return getValidNodes(rookNodes, clientset, func(node v1.Node) (bool, error) {
+		return ValidNode(node, placement)
+	})
+}
+
+// GetValidNewNodes returns the valid nodes like GetValidNodes. The nodes that are not in use must also be valid for new
+// daemons, so that no daemon is placed on a node of an unsupported architecture.
+func GetValidNewNodes(rookNodes []rookalpha.Node, clientset kubernetes.Interface, placement rookalpha.Placement, inUse map[string]bool) []rookalpha.Node {
+	return getValidNodes(rookNodes, clientset, func(node v1.Node) (bool, error) {
+		if inUse[node.Name] {
+			return ValidNode(node, placement)
+		}
+		return ValidNewNode(node, placement)
+	})
+}
+
+func getValidNodes(rookNodes []rookalpha.Node, clientset kubernetes.Interface, validate func(v1.Node) (bool, error)) []rookalpha.Node {
 	validNodes := []rookalpha.Node{}
 
 	nodeOptions := metav1.ListOptions{}
@@ -93,7 +142,7 @@ func GetValidNodes(rookNodes []rookalpha.Node, clientset kubernetes.Interface, p
 	for _, node := range allNodes.Items {
 		for _, rookNode := range rookNodes {
 			if rookNode.Name == node.Name {
-				valid, err := ValidNode(node, placement)
+				valid, err := validate(node)
 				if err != nil {
 					logger.Warning("failed to validate node %s %v", node.Name, err)
 				} else if valid {
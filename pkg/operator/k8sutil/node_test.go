@@ -67,3 +67,62 @@ func TestValidNode(t *testing.T) {
 	validNodes := GetValidNodes(nodes, clientset, placement)
 	assert.Equal(t, len(validNodes), 1)
 }
+
+func TestValidNodeArchitecture(t *testing.T) {
+	node := v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node1", Labels: map[string]string{"beta.kubernetes.io/arch": "arm64"}},
+		Status:     v1.NodeStatus{Conditions: []v1.NodeCondition{{Type: v1.NodeReady}}},
+	}
+	valid, err := ValidNewNode(node, rookalpha.Placement{})
+	assert.Nil(t, err)
+	assert.True(t, valid)
+
+	// the nodes of an architecture without images are not valid for new daemons
+	node.Labels["beta.kubernetes.io/arch"] = "ppc64le"
+	valid, err = ValidNewNode(node, rookalpha.Placement{})
+	assert.Nil(t, err)
+	assert.False(t, valid)
+
+	// the daemons that already run on such a node are kept
+	valid, err = ValidNode(node, rookalpha.Placement{})
+	assert.Nil(t, err)
+	assert.True(t, valid)
+
+	// the nodes are valid if their architecture is not known
+	delete(node.Labels, "beta.kubernetes.io/arch")
+	valid, err = ValidNewNode(node, rookalpha.Placement{})
+	assert.Nil(t, err)
+	assert.True(t, valid)
+
+	// the supported architectures can be restricted, such as for an image built only for amd64
+	defer func() { SupportedArchitectures = []string{"amd64", "arm64"} }()
+	SupportedArchitectures = []string{"amd64"}
+	node.Labels["beta.kubernetes.io/arch"] = "arm64"
+	valid, err = ValidNewNode(node, rookalpha.Placement{})
+	assert.Nil(t, err)
+	assert.False(t, valid)
+}
+
+func TestValidNewNodes(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	for _, name := range []string{"node1", "node2", "node3"} {
+		node := &v1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{"beta.kubernetes.io/arch": "s390x"}},
+			Status:     v1.NodeStatus{Conditions: []v1.NodeCondition{{Type: v1.NodeReady}}},
+		}
+		if name == "node3" {
+			node.Labels["beta.kubernetes.io/arch"] = "amd64"
+		}
+		_, err := clientset.CoreV1().Nodes().Create(node)
+		assert.Nil(t, err)
+	}
+	nodes := []rookalpha.Node{{Name: "node1"}, {Name: "node2"}, {Name: "node3"}}
+
+	// the nodes of an unsupported architecture are only valid if they are already in use
+	validNodes := GetValidNewNodes(nodes, clientset, rookalpha.Placement{}, map[string]bool{"node1": true})
+	assert.Equal(t, []rookalpha.Node{{Name: "node1"}, {Name: "node3"}}, validNodes)
+
+	// the architecture is not checked for the existing daemons
+	validNodes = GetValidNodes(nodes, clientset, rookalpha.Placement{})
+	assert.Equal(t, 3, len(validNodes))
+}
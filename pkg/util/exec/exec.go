@@ -35,6 +35,7 @@ type Executor interface {
 	ExecuteCommandWithOutput(debug bool, actionName string, command string, arg ...string) (string, error)
 	ExecuteCommandWithCombinedOutput(debug bool, actionName string, command string, arg ...string) (string, error)
 	ExecuteCommandWithOutputFile(debug bool, actionName, command, outfileArg string, arg ...string) (string, error)
+	ExecuteCommandWithOutputFileReader(debug bool, actionName, command, outfileArg string, read func(io.Reader) error, arg ...string) error
 	ExecuteCommandWithTimeout(debug bool, timeout time.Duration, actionName string, command string, arg ...string) (string, error)
 	ExecuteStat(name string) (os.FileInfo, error)
 }
@@ -165,6 +166,31 @@ func (*CommandExecutor) ExecuteCommandWithOutputFile(debug bool, actionName stri
 	return string(fileOut), err
 }
 
+// ExecuteCommandWithOutputFileReader runs the command like ExecuteCommandWithOutputFile, but passes the output file to
+// the read function instead of loading it in memory, so that a large output can be processed as it is read
+func (*CommandExecutor) ExecuteCommandWithOutputFileReader(debug bool, actionName, command, outfileArg string, read func(io.Reader) error, arg ...string) error {
+	outFile, err := ioutil.TempFile("", "")
+	if err != nil {
+		return fmt.Errorf("failed to open output file: %+v", err)
+	}
+	defer outFile.Close()
+	defer os.Remove(outFile.Name())
+
+	arg = append(arg, outfileArg, outFile.Name())
+
+	logCommand(debug, command, arg...)
+	cmd := exec.Command(command, arg...)
+	cmdOut, err := cmd.CombinedOutput()
+	if string(cmdOut) != "" {
+		logger.Infof(string(cmdOut))
+	}
+	if err != nil {
+		return createCommandError(err, actionName)
+	}
+
+	return read(bufio.NewReader(outFile))
+}
+
 func startCommand(debug bool, command string, arg ...string) (*exec.Cmd, io.ReadCloser, io.ReadCloser, error) {
 	logCommand(debug, command, arg...)
 
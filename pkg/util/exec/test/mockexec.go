@@ -16,20 +16,23 @@ limitations under the License.
 package test
 
 import (
+	"io"
 	"os"
 	"os/exec"
+	"strings"
 	"time"
 )
 
 // ******************** MockExecutor ********************
 type MockExecutor struct {
-	MockExecuteCommand                   func(debug bool, actionName string, command string, arg ...string) error
-	MockStartExecuteCommand              func(debug bool, actionName string, command string, arg ...string) (*exec.Cmd, error)
-	MockExecuteCommandWithOutput         func(debug bool, actionName string, command string, arg ...string) (string, error)
-	MockExecuteCommandWithCombinedOutput func(debug bool, actionName string, command string, arg ...string) (string, error)
-	MockExecuteCommandWithOutputFile     func(debug bool, actionName string, command, outfileArg string, arg ...string) (string, error)
-	MockExecuteCommandWithTimeout        func(debug bool, timeout time.Duration, actionName string, command string, arg ...string) (string, error)
-	MockExecuteStat                      func(name string) (os.FileInfo, error)
+	MockExecuteCommand                     func(debug bool, actionName string, command string, arg ...string) error
+	MockStartExecuteCommand                func(debug bool, actionName string, command string, arg ...string) (*exec.Cmd, error)
+	MockExecuteCommandWithOutput           func(debug bool, actionName string, command string, arg ...string) (string, error)
+	MockExecuteCommandWithCombinedOutput   func(debug bool, actionName string, command string, arg ...string) (string, error)
+	MockExecuteCommandWithOutputFile       func(debug bool, actionName string, command, outfileArg string, arg ...string) (string, error)
+	MockExecuteCommandWithOutputFileReader func(debug bool, actionName string, command, outfileArg string, read func(io.Reader) error, arg ...string) error
+	MockExecuteCommandWithTimeout          func(debug bool, timeout time.Duration, actionName string, command string, arg ...string) (string, error)
+	MockExecuteStat                        func(name string) (os.FileInfo, error)
 }
 
 func (e *MockExecutor) ExecuteCommand(debug bool, actionName string, command string, arg ...string) error {
@@ -82,6 +85,20 @@ func (e *MockExecutor) ExecuteCommandWithOutputFile(debug bool, actionName strin
 	return "", nil
 }
 
+// ExecuteCommandWithOutputFileReader passes the output of MockExecuteCommandWithOutputFile to the read function
+// unless MockExecuteCommandWithOutputFileReader is set, so that the same mock serves both ways to read the output
+func (e *MockExecutor) ExecuteCommandWithOutputFileReader(debug bool, actionName string, command, outfileArg string, read func(io.Reader) error, arg ...string) error {
+	if e.MockExecuteCommandWithOutputFileReader != nil {
+		return e.MockExecuteCommandWithOutputFileReader(debug, actionName, command, outfileArg, read, arg...)
+	}
+
+	output, err := e.ExecuteCommandWithOutputFile(debug, actionName, command, outfileArg, arg...)
+	if err != nil {
+		return err
+	}
+	return read(strings.NewReader(output))
+}
+
 func (e *MockExecutor) ExecuteStat(name string) (os.FileInfo, error) {
 	if e.MockExecuteStat != nil {
 		return e.MockExecuteStat(name)
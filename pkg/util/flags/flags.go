@@ -69,16 +69,26 @@ func VerifyRequiredUint64Flags(cmd *cobra.Command, requiredFlags []string) error
 	return createRequiredFlagError(cmd.Name(), missingFlags)
 }
 
+// RequiredFlagsError is the error of a command whose required flags are not set
+type RequiredFlagsError struct {
+	Command string
+	Flags   []string
+}
+
+func (e *RequiredFlagsError) Error() string {
+	if len(e.Flags) == 1 {
+		return fmt.Sprintf("%s is required for %s", e.Flags[0], e.Command)
+	}
+
+	return fmt.Sprintf("%s are required for %s", strings.Join(e.Flags, ","), e.Command)
+}
+
 func createRequiredFlagError(name string, flags []string) error {
 	if len(flags) == 0 {
 		return nil
 	}
 
-	if len(flags) == 1 {
-		return fmt.Errorf("%s is required for %s", flags[0], name)
-	}
-
-	return fmt.Errorf("%s are required for %s", strings.Join(flags, ","), name)
+	return &RequiredFlagsError{Command: name, Flags: flags}
 }
 
 func SetFlagsFromEnv(flags *pflag.FlagSet, prefix string) error {
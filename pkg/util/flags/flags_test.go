@@ -19,6 +19,7 @@ import (
 	"testing"
 
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -133,3 +134,27 @@ func TestGetFlagsAndValues(t *testing.T) {
 	assert.Contains(t, flagValues, "--foo-data=1234")
 	assert.Contains(t, flagValues, "--bar-secret=*****")
 }
+
+func TestStringSliceFlags(t *testing.T) {
+	var archs []string
+	flagSet := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	StringSliceVar(flagSet, &archs, "archs", []string{"amd64"}, "architectures")
+	assert.Equal(t, "[amd64]", flagSet.Lookup("archs").DefValue)
+
+	// the values replace the default and are added to each other on the same command line
+	assert.Nil(t, flagSet.Parse([]string{"--archs", "arm64,ppc64le", "--archs=s390x"}))
+	assert.Equal(t, []string{"arm64", "ppc64le", "s390x"}, archs)
+	values, err := flagSet.GetStringSlice("archs")
+	assert.Nil(t, err)
+	assert.Equal(t, archs, values)
+
+	// the values are replaced as they were, and replaced again by the next values
+	slice := flagSet.Lookup("archs").Value.(SliceValue)
+	assert.Nil(t, slice.Replace(nil))
+	assert.Nil(t, archs)
+	assert.Nil(t, slice.GetSlice())
+	assert.Nil(t, flagSet.Set("archs", "amd64"))
+	assert.Equal(t, []string{"amd64"}, archs)
+	assert.Nil(t, flagSet.Set("archs", ""))
+	assert.Equal(t, []string{"amd64"}, archs)
+}
@@ -0,0 +1,89 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package flags
+
+import (
+	"bytes"
+	"encoding/csv"
+	"strings"
+
+	"github.com/spf13/pflag"
+)
+
+// SliceValue is a slice flag whose values can be read and replaced, like pflag.SliceValue of the newer versions of
+// pflag. The string form of a slice flag cannot be set again, since it is wrapped in brackets.
+type SliceValue interface {
+	// GetSlice returns a copy of the values
+	GetSlice() []string
+	// Replace replaces the values. The next values that are set replace them again, as they replace the default.
+	Replace(values []string) error
+}
+
+// stringSliceValue is a string slice flag with the format of the string slice flags of pflag
+type stringSliceValue struct {
+	value   *[]string
+	changed bool
+}
+
+// StringSliceVar adds a string slice flag that implements SliceValue
+func StringSliceVar(flagSet *pflag.FlagSet, p *[]string, name string, value []string, usage string) {
+	*p = value
+	flagSet.Var(&stringSliceValue{value: p}, name, usage)
+}
+
+// Set parses the comma separated values, which are added to the values set earlier on the same command line
+func (s *stringSliceValue) Set(val string) error {
+	values := []string{}
+	if val != "" {
+		var err error
+		values, err = csv.NewReader(strings.NewReader(val)).Read()
+		if err != nil {
+			return err
+		}
+	}
+	if s.changed {
+		*s.value = append(*s.value, values...)
+	} else {
+		*s.value = values
+	}
+	s.changed = true
+	return nil
+}
+
+func (s *stringSliceValue) String() string {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write(*s.value)
+	w.Flush()
+	return "[" + strings.TrimSuffix(buf.String(), "\n") + "]"
+}
+
+func (s *stringSliceValue) Type() string {
+	return "stringSlice"
+}
+
+func (s *stringSliceValue) GetSlice() []string {
+	if *s.value == nil {
+		return nil
+	}
+	return append([]string{}, *s.value...)
+}
+
+func (s *stringSliceValue) Replace(values []string) error {
+	*s.value = values
+	s.changed = false
+	return nil
+}
@@ -0,0 +1,240 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package logforward forwards the logs of the rook processes, and the output of the ceph daemons they run, to the
+// journal or the syslog of the host or to a remote syslog server, with the cluster, the node and the daemon of the
+// logs as structured fields.
+package logforward
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/coreos/pkg/capnslog"
+)
+
+const (
+	// Journald is the target of the logs forwarded to the journal of the host
+	Journald = "journald"
+	// Syslog is the target of the logs forwarded to the syslog of the host
+	Syslog = "syslog"
+	// JournalSocket is the socket of the journal of the host
+	JournalSocket = "/run/systemd/journal/socket"
+	// SyslogSocket is the socket of the syslog of the host
+	SyslogSocket = "/dev/log"
+
+	defaultFacility   = "daemon"
+	defaultSyslogPort = "514"
+	// the number of logs buffered while the target is slow, after which the logs are dropped
+	bufferSize = 1000
+	// the initial and the maximum interval between the attempts to forward to a failing target
+	minRetryInterval = time.Second
+	maxRetryInterval = time.Minute
+	// how long a flush waits for the buffered logs to be forwarded
+	flushTimeout = time.Second
+)
+
+// the syslog facilities by name
+var facilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5, "lpr": 6, "news": 7, "uucp": 8, "cron": 9,
+	"authpriv": 10, "ftp": 11, "local0": 16, "local1": 17, "local2": 18, "local3": 19, "local4": 20, "local5": 21,
+	"local6": 22, "local7": 23,
+}
+
+// Fields are the structured fields sent with each forwarded log
+type Fields struct {
+	// The namespace of the cluster of the daemon
+	Cluster string
+	// The node the daemon runs on
+	Node string
+	// The daemon of the pod, such as mon.a or osd.3
+	Daemon string
+}
+
+// writer writes a log of a package to the target of the forwarder
+type writer interface {
+	write(pkg string, level capnslog.LogLevel, message string) error
+}
+
+// a log buffered until it is forwarded
+type logEntry struct {
+	pkg     string
+	level   capnslog.LogLevel
+	message string
+}
+
+// Forwarder is a log formatter that writes the logs with the next formatter and forwards them to the target. The logs
+// are forwarded from a buffer in the background so that a slow or unreachable target does not stall the process.
+type Forwarder struct {
+	next   capnslog.Formatter
+	writer writer
+	target string
+	logs   chan logEntry
+	// the number of logs dropped since the buffer was full, reported once the logs are forwarded again
+	dropped int32
+	// whether the last log failed to be forwarded, so that the failures are reported once until a log is forwarded
+	failing bool
+	// the logs are dropped without trying the target until retryAt, which backs off while the target fails
+	retryAt       time.Time
+	retryInterval time.Duration
+	now           func() time.Time
+}
+
+// ValidTarget returns an error if the logs cannot be forwarded to the target
+func ValidTarget(target string) error {
+	_, _, err := parseTarget(target)
+	return err
+}
+
+// parseTarget returns the network and the address of the target of the syslog messages, or an empty network for
+// the journal
+func parseTarget(target string) (string, string, error) {
+	switch target {
+	case Journald:
+		return "", JournalSocket, nil
+	case Syslog:
+		return "unixgram", SyslogSocket, nil
+	}
+	u, err := url.Parse(target)
+	if err != nil || (u.Scheme != "udp" && u.Scheme != "tcp") || u.Host == "" {
+		return "", "", fmt.Errorf("invalid log forward target %s, expected %s, %s, or a udp:// or tcp:// url", target, Journald, Syslog)
+	}
+	address := u.Host
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		address = net.JoinHostPort(address, defaultSyslogPort)
+	}
+	return u.Scheme, address, nil
+}
+
+// New creates a forwarder of the logs to the target that writes them with the next formatter as well
+func New(target, facility string, fields Fields, next capnslog.Formatter) (*Forwarder, error) {
+	network, address, err := parseTarget(target)
+	if err != nil {
+		return nil, err
+	}
+	if facility == "" {
+		facility = defaultFacility
+	}
+	code, ok := facilities[facility]
+	if !ok {
+		return nil, fmt.Errorf("invalid syslog facility %s", facility)
+	}
+	if fields.Node == "" {
+		fields.Node, _ = os.Hostname()
+	}
+
+	var w writer
+	if network == "" {
+		w = newJournalWriter(code, fields)
+	} else {
+		w = newSyslogWriter(network, address, code, fields)
+	}
+	f := newForwarder(w, target, next)
+	go f.run()
+	return f, nil
+}
+
+func newForwarder(w writer, target string, next capnslog.Formatter) *Forwarder {
+	return &Forwarder{next: next, writer: w, target: target, logs: make(chan logEntry, bufferSize), now: time.Now}
+}
+
+// Start forwards the logs of the process to the target, in addition to writing them to stderr
+func Start(target, facility string, fields Fields) error {
+	f, err := New(target, facility, fields, capnslog.NewPrettyFormatter(os.Stderr, false))
+	if err != nil {
+		return err
+	}
+	capnslog.SetFormatter(f)
+	return nil
+}
+
+// Format writes the log with the next formatter and buffers it to be forwarded. The log is dropped if the buffer is
+// full.
+func (f *Forwarder) Format(pkg string, level capnslog.LogLevel, depth int, entries ...interface{}) {
+	f.next.Format(pkg, level, depth+1, entries...)
+
+	select {
+	case f.logs <- logEntry{pkg: pkg, level: level, message: strings.TrimSuffix(fmt.Sprint(entries...), "\n")}:
+	default:
+		atomic.AddInt32(&f.dropped, 1)
+	}
+}
+
+// Flush flushes the next formatter and waits briefly for the buffered logs to be forwarded, since the process may
+// exit after a fatal log
+func (f *Forwarder) Flush() {
+	f.next.Flush()
+	deadline := time.Now().Add(flushTimeout)
+	for len(f.logs) > 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// run forwards the buffered logs for the lifetime of the process
+func (f *Forwarder) run() {
+	for entry := range f.logs {
+		f.forward(entry)
+	}
+}
+
+// forward writes the log to the target, unless the target failed recently. The failures to forward are written to
+// stderr since logging them would forward them again.
+func (f *Forwarder) forward(entry logEntry) {
+	if f.failing && f.now().Before(f.retryAt) {
+		return
+	}
+	err := f.writer.write(entry.pkg, entry.level, entry.message)
+	if err != nil {
+		if !f.failing {
+			fmt.Fprintf(os.Stderr, "failed to forward the logs to %s, dropping them until the target is back. %+v\n", f.target, err)
+			f.retryInterval = minRetryInterval
+		} else if f.retryInterval *= 2; f.retryInterval > maxRetryInterval {
+			f.retryInterval = maxRetryInterval
+		}
+		f.failing = true
+		f.retryAt = f.now().Add(f.retryInterval)
+		return
+	}
+	if f.failing {
+		fmt.Fprintf(os.Stderr, "forwarding the logs to %s again\n", f.target)
+		f.failing = false
+	}
+	if dropped := atomic.SwapInt32(&f.dropped, 0); dropped > 0 {
+		fmt.Fprintf(os.Stderr, "dropped %d logs to %s since the target was too slow\n", dropped, f.target)
+	}
+}
+
+// severity returns the syslog severity of the level of a log
+func severity(level capnslog.LogLevel) int {
+	switch level {
+	case capnslog.CRITICAL:
+		return 2
+	case capnslog.ERROR:
+		return 3
+	case capnslog.WARNING:
+		return 4
+	case capnslog.NOTICE:
+		return 5
+	case capnslog.INFO:
+		return 6
+	}
+	return 7
+}
@@ -0,0 +1,220 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package logforward
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coreos/pkg/capnslog"
+	"github.com/stretchr/testify/assert"
+)
+
+type testFormatter struct {
+	logs []string
+}
+
+func (f *testFormatter) Format(pkg string, level capnslog.LogLevel, depth int, entries ...interface{}) {
+	f.logs = append(f.logs, fmt.Sprintf("%s: %s", pkg, fmt.Sprint(entries...)))
+}
+
+func (f *testFormatter) Flush() {}
+
+func TestParseTarget(t *testing.T) {
+	network, address, err := parseTarget("journald")
+	assert.Nil(t, err)
+	assert.Equal(t, "", network)
+	assert.Equal(t, JournalSocket, address)
+
+	network, address, err = parseTarget("syslog")
+	assert.Nil(t, err)
+	assert.Equal(t, "unixgram", network)
+	assert.Equal(t, SyslogSocket, address)
+
+	// the port of a remote server defaults to 514
+	network, address, err = parseTarget("udp://logs.example.com")
+	assert.Nil(t, err)
+	assert.Equal(t, "udp", network)
+	assert.Equal(t, "logs.example.com:514", address)
+	network, address, err = parseTarget("tcp://10.0.0.5:6514")
+	assert.Nil(t, err)
+	assert.Equal(t, "tcp", network)
+	assert.Equal(t, "10.0.0.5:6514", address)
+
+	for _, target := range []string{"", "file", "http://logs.example.com", "udp://"} {
+		assert.NotNil(t, ValidTarget(target), target)
+	}
+
+	_, err = New("syslog", "local9", Fields{}, &testFormatter{})
+	assert.NotNil(t, err)
+}
+
+func TestSyslogMessage(t *testing.T) {
+	w := newSyslogWriter("udp", "", facilities["local0"], Fields{Cluster: "rook-ceph", Node: "node1", Daemon: "mon.a"})
+	w.pid = 7
+	w.now = func() time.Time { return time.Date(2018, 7, 1, 10, 30, 0, 123456000, time.UTC) }
+
+	assert.Equal(t, `<132>1 2018-07-01T10:30:00.123456Z node1 rook 7 mon.a [rook@32473 cluster="rook-ceph" node="node1" daemon="mon.a"] slow request`,
+		w.message("mon.a", capnslog.WARNING, "slow request"))
+
+	// the header fields have no spaces and the values of the structured data are escaped
+	w.fields = Fields{Daemon: `osd "3"]`}
+	assert.Equal(t, `<131>1 2018-07-01T10:30:00.123456Z - rook 7 op_osd [rook@32473 daemon="osd \"3\"\]"] failed`,
+		w.message("op osd", capnslog.ERROR, "failed"))
+	w.fields = Fields{}
+	assert.Equal(t, `<135>1 2018-07-01T10:30:00.123456Z - rook 7 - - debug`, w.message("", capnslog.TRACE, "debug"))
+}
+
+func TestForwardUDP(t *testing.T) {
+	listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer listener.Close()
+
+	next := &testFormatter{}
+	f, err := New("udp://"+listener.LocalAddr().String(), "", Fields{Cluster: "rook-ceph", Node: "node1", Daemon: "osd.3"}, next)
+	assert.Nil(t, err)
+
+	// the log is written with the next formatter and forwarded
+	f.Format("osd.3", capnslog.INFO, 0, "boot\n")
+	assert.Equal(t, []string{"osd.3: boot\n"}, next.logs)
+	buf := make([]byte, 1024)
+	listener.SetReadDeadline(time.Now().Add(5 * time.Second))
+	size, _, err := listener.ReadFrom(buf)
+	assert.Nil(t, err)
+	message := string(buf[:size])
+	assert.True(t, strings.HasPrefix(message, "<30>1 "), message)
+	assert.True(t, strings.HasSuffix(message, ` osd.3 [rook@32473 cluster="rook-ceph" node="node1" daemon="osd.3"] boot`), message)
+}
+
+func TestForwardTCP(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	received := make(chan string, 2)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		for {
+			var length int
+			if _, err := fmt.Fscanf(r, "%d ", &length); err != nil {
+				return
+			}
+			m := make([]byte, length)
+			if _, err := io.ReadFull(r, m); err != nil {
+				return
+			}
+			received <- string(m)
+		}
+	}()
+
+	// the logs are forwarded by the test rather than in the background
+	w := newSyslogWriter("tcp", listener.Addr().String(), facilities["daemon"], Fields{Node: "node1"})
+	f := newForwarder(w, "tcp://"+listener.Addr().String(), &testFormatter{})
+	f.forward(logEntry{pkg: "op-mon", level: capnslog.NOTICE, message: "mon a is out of quorum"})
+	f.forward(logEntry{pkg: "op-mon", level: capnslog.INFO, message: "mon a is back"})
+	// the messages are framed with their length
+	assert.True(t, strings.HasSuffix(<-received, " mon a is out of quorum"))
+	assert.True(t, strings.HasSuffix(<-received, " mon a is back"))
+	assert.False(t, f.failing)
+
+	// the logs are dropped while the server is down
+	listener.Close()
+	w.conn.Close()
+	f.forward(logEntry{pkg: "op-mon", level: capnslog.INFO, message: "dropped"})
+	assert.True(t, f.failing)
+	assert.Nil(t, w.conn)
+}
+
+type failingWriter struct {
+	err    error
+	writes int
+}
+
+func (w *failingWriter) write(pkg string, level capnslog.LogLevel, message string) error {
+	w.writes++
+	return w.err
+}
+
+func TestForwardBackoff(t *testing.T) {
+	w := &failingWriter{err: fmt.Errorf("connection refused")}
+	f := newForwarder(w, "tcp://10.0.0.5:514", &testFormatter{})
+	now := time.Now()
+	f.now = func() time.Time { return now }
+	entry := logEntry{pkg: "op-mon", level: capnslog.INFO, message: "mon a is back"}
+
+	// the target is not tried again until the retry interval has passed
+	f.forward(entry)
+	f.forward(entry)
+	assert.Equal(t, 1, w.writes)
+	now = now.Add(minRetryInterval)
+	f.forward(entry)
+	assert.Equal(t, 2, w.writes)
+
+	// the interval doubles while the target fails, up to the maximum
+	assert.Equal(t, 2*minRetryInterval, f.retryInterval)
+	for i := 0; i < 10; i++ {
+		now = now.Add(f.retryInterval)
+		f.forward(entry)
+	}
+	assert.Equal(t, maxRetryInterval, f.retryInterval)
+
+	// the logs are forwarded again once the target is back
+	w.err = nil
+	now = now.Add(f.retryInterval)
+	f.forward(entry)
+	assert.False(t, f.failing)
+	writes := w.writes
+	f.forward(entry)
+	assert.Equal(t, writes+1, w.writes)
+}
+
+func TestForwardBufferFull(t *testing.T) {
+	next := &testFormatter{}
+	f := newForwarder(&failingWriter{}, "udp://10.0.0.5:514", next)
+	f.logs = make(chan logEntry, 2)
+
+	// the logs are written with the next formatter but dropped from the forwarding when the buffer is full
+	for i := 0; i < 3; i++ {
+		f.Format("op-mon", capnslog.INFO, 0, "log")
+	}
+	assert.Equal(t, 3, len(next.logs))
+	assert.Equal(t, 2, len(f.logs))
+	assert.Equal(t, int32(1), f.dropped)
+
+	// the count of dropped logs is reset once a log is forwarded
+	f.forward(<-f.logs)
+	assert.Equal(t, int32(0), f.dropped)
+}
+
+func TestJournalFields(t *testing.T) {
+	fields := journalFields(3, Fields{Cluster: "rook-ceph", Daemon: "mon.a"}, "mon.a")
+	assert.Equal(t, map[string]string{
+		"SYSLOG_IDENTIFIER": "rook",
+		"SYSLOG_FACILITY":   "3",
+		"ROOK_PACKAGE":      "mon.a",
+		"ROOK_CLUSTER":      "rook-ceph",
+		"ROOK_DAEMON":       "mon.a",
+	}, fields)
+}
@@ -0,0 +1,53 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package logforward
+
+import (
+	"strconv"
+
+	"github.com/coreos/pkg/capnslog"
+)
+
+// journalWriter writes the logs to the journal of the host with the fields as journal fields, so that the logs of a
+// daemon are found with journalctl ROOK_DAEMON=mon.a
+type journalWriter struct {
+	facility int
+	fields   Fields
+}
+
+func newJournalWriter(facility int, fields Fields) *journalWriter {
+	return &journalWriter{facility: facility, fields: fields}
+}
+
+func (w *journalWriter) write(pkg string, level capnslog.LogLevel, message string) error {
+	return sendJournal(message, severity(level), journalFields(w.facility, w.fields, pkg))
+}
+
+// journalFields returns the journal fields of a log of the package
+func journalFields(facility int, fields Fields, pkg string) map[string]string {
+	vars := map[string]string{
+		"SYSLOG_IDENTIFIER": appName,
+		"SYSLOG_FACILITY":   strconv.Itoa(facility),
+		"ROOK_PACKAGE":      pkg,
+	}
+	for name, value := range map[string]string{"ROOK_CLUSTER": fields.Cluster, "ROOK_NODE": fields.Node, "ROOK_DAEMON": fields.Daemon} {
+		if value != "" {
+			vars[name] = value
+		}
+	}
+	return vars
+}
@@ -0,0 +1,27 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package logforward
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// sendJournal is not supported on windows, which has no journal
+func sendJournal(message string, priority int, vars map[string]string) error {
+	return fmt.Errorf("failed to forward the logs to the journal. not supported on %s", runtime.GOOS)
+}
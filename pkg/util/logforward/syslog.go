@@ -0,0 +1,131 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package logforward
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/coreos/pkg/capnslog"
+)
+
+const (
+	appName = "rook"
+	// the id of the structured data of the fields, under the example enterprise number of rfc 5612 until rook has an
+	// enterprise number
+	structuredDataID = "rook@32473"
+	// the timestamp of rfc 5424, which allows up to microseconds
+	timestampFormat = "2006-01-02T15:04:05.000000Z07:00"
+	maxHostname     = 255
+	maxMessageID    = 32
+	dialTimeout     = 5 * time.Second
+	writeTimeout    = 5 * time.Second
+)
+
+// syslogWriter writes the logs as rfc 5424 messages to the syslog socket of the host or to a remote syslog server. The
+// connection is opened again after a failure.
+type syslogWriter struct {
+	network  string
+	address  string
+	facility int
+	fields   Fields
+	pid      int
+	conn     net.Conn
+	now      func() time.Time
+}
+
+func newSyslogWriter(network, address string, facility int, fields Fields) *syslogWriter {
+	return &syslogWriter{network: network, address: address, facility: facility, fields: fields, pid: os.Getpid(), now: time.Now}
+}
+
+func (w *syslogWriter) write(pkg string, level capnslog.LogLevel, message string) error {
+	if w.conn == nil {
+		conn, err := net.DialTimeout(w.network, w.address, dialTimeout)
+		if err != nil {
+			return err
+		}
+		w.conn = conn
+	}
+	m := w.message(pkg, level, message)
+	if w.network == "tcp" {
+		// the messages over tcp are framed with their length, as in rfc 6587
+		m = fmt.Sprintf("%d %s", len(m), m)
+	}
+	w.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	if _, err := io.WriteString(w.conn, m); err != nil {
+		w.conn.Close()
+		w.conn = nil
+		return err
+	}
+	return nil
+}
+
+// message returns the rfc 5424 message of the log, with the package of the log as the message id
+func (w *syslogWriter) message(pkg string, level capnslog.LogLevel, message string) string {
+	return fmt.Sprintf("<%d>1 %s %s %s %d %s %s %s",
+		w.facility*8+severity(level),
+		w.now().UTC().Format(timestampFormat),
+		headerField(w.fields.Node, maxHostname),
+		appName,
+		w.pid,
+		headerField(pkg, maxMessageID),
+		structuredData(w.fields),
+		message)
+}
+
+// headerField returns the value of a field of the header of a message, which is printable ascii without spaces, or
+// the nil value if empty
+func headerField(value string, max int) string {
+	field := strings.Map(func(r rune) rune {
+		if r <= ' ' || r > '~' {
+			return '_'
+		}
+		return r
+	}, value)
+	if len(field) > max {
+		field = field[:max]
+	}
+	if field == "" {
+		return "-"
+	}
+	return field
+}
+
+// structuredData returns the structured data element of the fields that are set
+func structuredData(fields Fields) string {
+	params := []string{structuredDataID}
+	for _, p := range []struct{ name, value string }{
+		{"cluster", fields.Cluster},
+		{"node", fields.Node},
+		{"daemon", fields.Daemon},
+	} {
+		if p.value != "" {
+			params = append(params, fmt.Sprintf(`%s="%s"`, p.name, paramEscaper.Replace(p.value)))
+		}
+	}
+	if len(params) == 1 {
+		return "-"
+	}
+	return "[" + strings.Join(params, " ") + "]"
+}
+
+// the characters escaped in the values of the structured data
+var paramEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`)
@@ -0,0 +1,138 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package logrotate rotates the log files of the daemons by size
+package logrotate
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Config is the settings to rotate a log file
+type Config struct {
+	// The size in bytes at which the log file is rotated
+	MaxSize int64
+	// The number of rotated files kept. The oldest file is removed when the log file is rotated again.
+	MaxFiles int
+	// Whether the rotated files are compressed with gzip
+	Compress bool
+}
+
+// rotatedPath returns the path of the rotated log file with the given index, such as mon.a.log.1 or mon.a.log.1.gz
+func rotatedPath(logPath string, index int, compress bool) string {
+	p := fmt.Sprintf("%s.%d", logPath, index)
+	if compress {
+		p += ".gz"
+	}
+	return p
+}
+
+// Rotate rotates the log file if it reached the max size and returns whether it was rotated. The log file is copied
+// and then truncated so the daemon can keep writing to the open file, which requires the daemon to append to the file.
+func Rotate(logPath string, config Config) (bool, error) {
+	if config.MaxSize <= 0 || config.MaxFiles < 1 {
+		return false, fmt.Errorf("max size and max files must be positive to rotate %s", logPath)
+	}
+	info, err := os.Stat(logPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to stat log file %s. %+v", logPath, err)
+	}
+	if info.Size() < config.MaxSize {
+		return false, nil
+	}
+
+	// shift the rotated files, which removes the oldest file
+	for i := config.MaxFiles; i >= 1; i-- {
+		for _, compressed := range []bool{false, true} {
+			p := rotatedPath(logPath, i, compressed)
+			if i == config.MaxFiles {
+				if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+					return false, fmt.Errorf("failed to remove rotated log file %s. %+v", p, err)
+				}
+				continue
+			}
+			if err := os.Rename(p, rotatedPath(logPath, i+1, compressed)); err != nil && !os.IsNotExist(err) {
+				return false, fmt.Errorf("failed to shift rotated log file %s. %+v", p, err)
+			}
+		}
+	}
+
+	if err := copyLog(logPath, rotatedPath(logPath, 1, config.Compress), config.Compress); err != nil {
+		return false, err
+	}
+	if err := os.Truncate(logPath, 0); err != nil {
+		return false, fmt.Errorf("failed to truncate log file %s. %+v", logPath, err)
+	}
+	return true, nil
+}
+
+func copyLog(src, dest string, compress bool) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("failed to open log file %s. %+v", src, err)
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dest, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to create rotated log file %s. %+v", dest, err)
+	}
+	defer out.Close()
+
+	var w io.Writer = out
+	var zw *gzip.Writer
+	if compress {
+		zw = gzip.NewWriter(out)
+		w = zw
+	}
+	if _, err := io.Copy(w, in); err != nil {
+		return fmt.Errorf("failed to copy log file %s to %s. %+v", src, dest, err)
+	}
+	if zw != nil {
+		if err := zw.Close(); err != nil {
+			return fmt.Errorf("failed to compress log file %s. %+v", dest, err)
+		}
+	}
+	return nil
+}
+
+// Usage returns the total size in bytes of the log files and rotated files in the directory and its subdirectories
+func Usage(dir string) (int64, error) {
+	var total int64
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if !info.IsDir() {
+			total += info.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to get the log usage of %s. %+v", dir, err)
+	}
+	return total, nil
+}
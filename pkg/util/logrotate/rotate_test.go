@@ -0,0 +1,100 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package logrotate
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeLog(t *testing.T, logPath, contents string) {
+	f, err := os.OpenFile(logPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	assert.Nil(t, err)
+	_, err = f.WriteString(contents)
+	assert.Nil(t, err)
+	f.Close()
+}
+
+func TestRotate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	logPath := path.Join(dir, "mon.a.log")
+	config := Config{MaxSize: 10, MaxFiles: 2}
+
+	// no log file yet
+	rotated, err := Rotate(logPath, config)
+	assert.Nil(t, err)
+	assert.False(t, rotated)
+
+	// below the max size
+	writeLog(t, logPath, "first")
+	rotated, err = Rotate(logPath, config)
+	assert.Nil(t, err)
+	assert.False(t, rotated)
+
+	// the log is copied and truncated
+	writeLog(t, logPath, " entries")
+	rotated, err = Rotate(logPath, config)
+	assert.Nil(t, err)
+	assert.True(t, rotated)
+	contents, _ := ioutil.ReadFile(logPath + ".1")
+	assert.Equal(t, "first entries", string(contents))
+	contents, _ = ioutil.ReadFile(logPath)
+	assert.Equal(t, "", string(contents))
+
+	// the rotated files are shifted and only the max files are kept
+	writeLog(t, logPath, "second entries")
+	_, err = Rotate(logPath, config)
+	assert.Nil(t, err)
+	writeLog(t, logPath, "third entries")
+	_, err = Rotate(logPath, config)
+	assert.Nil(t, err)
+	contents, _ = ioutil.ReadFile(logPath + ".1")
+	assert.Equal(t, "third entries", string(contents))
+	contents, _ = ioutil.ReadFile(logPath + ".2")
+	assert.Equal(t, "second entries", string(contents))
+	_, err = os.Stat(logPath + ".3")
+	assert.True(t, os.IsNotExist(err))
+
+	usage, err := Usage(dir)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(27), usage)
+
+	// compressed
+	config.Compress = true
+	writeLog(t, logPath, "fourth entries")
+	_, err = Rotate(logPath, config)
+	assert.Nil(t, err)
+	f, err := os.Open(logPath + ".1.gz")
+	assert.Nil(t, err)
+	defer f.Close()
+	r, err := gzip.NewReader(f)
+	assert.Nil(t, err)
+	contents, _ = ioutil.ReadAll(r)
+	assert.Equal(t, "fourth entries", string(contents))
+	contents, _ = ioutil.ReadFile(logPath + ".2")
+	assert.Equal(t, "third entries", string(contents))
+
+	// invalid settings
+	_, err = Rotate(logPath, Config{MaxFiles: 1})
+	assert.NotNil(t, err)
+}
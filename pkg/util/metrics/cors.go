@@ -0,0 +1,143 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const corsMaxAge = "600"
+
+var (
+	// CORSAllowedOrigins are the origins of the web pages that can read the metrics from a browser. "*" allows all the
+	// origins. The metrics can only be read from the pages served by another origin if the origin is allowed.
+	CORSAllowedOrigins []string
+	// CORSAllowedMethods are the methods the allowed origins can send
+	CORSAllowedMethods = []string{"GET"}
+	// CORSAllowedHeaders are the headers the allowed origins can send, besides the headers always allowed by the browsers
+	CORSAllowedHeaders []string
+	// CORSAllowCredentials allows the browsers to send the cookies and the authorization of the allowed origins. The
+	// credentials cannot be allowed for all the origins.
+	CORSAllowCredentials bool
+)
+
+// corsConfig is the cross origin resource sharing of a server
+type corsConfig struct {
+	origins     []string
+	methods     []string
+	headers     []string
+	credentials bool
+}
+
+func newCORSConfig() corsConfig {
+	return corsConfig{
+		origins:     CORSAllowedOrigins,
+		methods:     CORSAllowedMethods,
+		headers:     CORSAllowedHeaders,
+		credentials: CORSAllowCredentials,
+	}
+}
+
+// VerifyCORS returns an error if the cors settings allow the credentials for all the origins, which would let the pages
+// of any origin read the metrics with the cookies and the authorization of the user of the browser
+func VerifyCORS() error {
+	return newCORSConfig().verify()
+}
+
+func (c corsConfig) verify() error {
+	if c.credentials && contains(c.origins, "*") {
+		return fmt.Errorf("the cors credentials of the metrics cannot be allowed for all the origins. the allowed origins must be listed")
+	}
+	return nil
+}
+
+// allowCORS adds the cors headers to the responses of the requests of the allowed origins and answers their preflight
+// requests. The requests of the other origins are served without the headers, so the browsers do not let their pages
+// read the responses, and their preflight requests are forbidden.
+func allowCORS(h http.Handler, c corsConfig) http.Handler {
+	if len(c.origins) == 0 {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+		w.Header().Add("Vary", "Origin")
+		if origin == "" || !c.allowsOrigin(origin) {
+			if preflight {
+				http.Error(w, "origin not allowed", http.StatusForbidden)
+				return
+			}
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		if contains(c.origins, "*") {
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+		} else {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+		}
+		if c.credentials {
+			w.Header().Set("Access-Control-Allow-Credentials", "true")
+		}
+		if !preflight {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		if !containsFold(c.methods, r.Header.Get("Access-Control-Request-Method")) {
+			http.Error(w, "method not allowed", http.StatusForbidden)
+			return
+		}
+		for _, header := range strings.Split(r.Header.Get("Access-Control-Request-Headers"), ",") {
+			if header = strings.TrimSpace(header); header != "" && !containsFold(c.headers, header) {
+				http.Error(w, "header "+header+" not allowed", http.StatusForbidden)
+				return
+			}
+		}
+		w.Header().Set("Access-Control-Allow-Methods", strings.Join(c.methods, ", "))
+		if len(c.headers) > 0 {
+			w.Header().Set("Access-Control-Allow-Headers", strings.Join(c.headers, ", "))
+		}
+		w.Header().Set("Access-Control-Max-Age", corsMaxAge)
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+func (c corsConfig) allowsOrigin(origin string) bool {
+	return contains(c.origins, "*") || contains(c.origins, origin)
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// the methods and the headers are not case sensitive
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
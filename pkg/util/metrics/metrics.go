@@ -0,0 +1,265 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package metrics keeps the prometheus histograms of the time rook spends in the kubernetes api, in the ceph
+// commands, in the orchestration and in the agent tasks, to tell where the time of a slow operation goes
+package metrics
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/pkg/capnslog"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	namespace = "rook"
+	// the leading args of a ceph command in the command label, such as "osd pool" of "osd pool get replicapool size".
+	// The other tools are labeled with their first arg.
+	cephCommandArgs = 2
+)
+
+var (
+	logger = capnslog.NewPackageLogger("github.com/rook/rook", "metrics")
+
+	// ReadTimeout is the time the metrics server waits for a request, including its body. The idle connections are
+	// also closed after this time, so that the slow or stuck clients do not keep the connections open.
+	ReadTimeout = 30 * time.Second
+	// WriteTimeout is the time the metrics server has to write a response after the request headers are read
+	WriteTimeout = 30 * time.Second
+	// MaxHeaderBytes is the max size of the headers of a request to the metrics server
+	MaxHeaderBytes = 64 << 10
+	// MaxRequestBytes is the max size of the body of a request to the metrics server. The metrics are read with
+	// gets, so no body is expected.
+	MaxRequestBytes int64 = 1 << 20
+
+	// only the args that are words are in the command label, so the pools, images, ids and flags are not labels
+	commandWordRegex = regexp.MustCompile(`^[a-z][a-z_-]*$`)
+
+	// CommandDuration is the time of the ceph commands by tool and command
+	CommandDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "ceph_command_duration_seconds",
+		Help:      "Time of the commands of the ceph tools, including the ceph mon commands.",
+		Buckets:   prometheus.ExponentialBuckets(0.01, 2, 14),
+	}, []string{"command"})
+
+	// KubernetesRequestDuration is the time of the requests to the kubernetes api by verb. The api keeps the state of
+	// the clusters, the crds and the config maps in etcd.
+	KubernetesRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "kubernetes_request_duration_seconds",
+		Help:      "Time of the requests to the kubernetes api, which is backed by etcd.",
+		Buckets:   prometheus.ExponentialBuckets(0.001, 2, 14),
+	}, []string{"verb"})
+
+	// OrchestrationDuration is the time of the orchestration of a cluster by phase
+	OrchestrationDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "orchestration_duration_seconds",
+		Help:      "Time of the orchestration of the clusters and of its phases.",
+		Buckets:   prometheus.ExponentialBuckets(1, 2, 13),
+	}, []string{"phase"})
+
+	// AgentTaskDuration is the time of the tasks of the agent by task
+	AgentTaskDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "agent_task_duration_seconds",
+		Help:      "Time of the volume tasks of the agent, such as attaching a volume.",
+		Buckets:   prometheus.ExponentialBuckets(0.01, 2, 14),
+	}, []string{"task"})
+)
+
+var registerOnce sync.Once
+
+// Register registers the rook metrics with prometheus. The metrics are only registered by the first call, so each
+// component that records or serves the metrics can call it.
+func Register() {
+	registerOnce.Do(func() {
+		prometheus.MustRegister(CommandDuration, KubernetesRequestDuration, OrchestrationDuration, AgentTaskDuration)
+	})
+}
+
+// Server serves the metrics at /metrics on a port. Init registers the metrics and listens on the port, Start serves
+// the metrics in the background and Stop closes the listener and waits for the serving to end. The metrics are not
+// served if the port is zero. The methods can be called from several goroutines.
+type Server struct {
+	port int
+	// the limits and the cors of the requests, from the package settings when the server is created
+	readTimeout     time.Duration
+	writeTimeout    time.Duration
+	maxHeaderBytes  int
+	maxRequestBytes int64
+	cors            corsConfig
+
+	sync.Mutex
+	listener net.Listener
+	// closed when the serving of the listener ends, nil if the server is not started
+	done chan struct{}
+}
+
+// NewServer creates a server of the metrics on the port
+func NewServer(port int) *Server {
+	return &Server{
+		port:            port,
+		readTimeout:     ReadTimeout,
+		writeTimeout:    WriteTimeout,
+		maxHeaderBytes:  MaxHeaderBytes,
+		maxRequestBytes: MaxRequestBytes,
+		cors:            newCORSConfig(),
+	}
+}
+
+// Init registers the metrics and listens on the port of the server, so that a port already in use is an error of the
+// startup. Init does nothing if the server is already initialized.
+func (s *Server) Init() error {
+	Register()
+	s.Lock()
+	defer s.Unlock()
+	if s.port == 0 || s.listener != nil {
+		return nil
+	}
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", s.port))
+	if err != nil {
+		return fmt.Errorf("failed to listen on port %d for the metrics. %+v", s.port, err)
+	}
+	s.listener = listener
+	return nil
+}
+
+// Start serves the metrics in the background. The server must be initialized. Start does nothing if the server is
+// already started or if the port is zero.
+func (s *Server) Start() error {
+	s.Lock()
+	defer s.Unlock()
+	if s.port == 0 || s.done != nil {
+		return nil
+	}
+	if s.listener == nil {
+		return fmt.Errorf("the metrics server on port %d is not initialized", s.port)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", prometheus.Handler())
+	server := &http.Server{
+		Handler:        limitRequestBody(allowCORS(mux, s.cors), s.maxRequestBytes),
+		ReadTimeout:    s.readTimeout,
+		WriteTimeout:   s.writeTimeout,
+		MaxHeaderBytes: s.maxHeaderBytes,
+	}
+	listener, done := s.listener, make(chan struct{})
+	s.done = done
+	go func() {
+		defer close(done)
+		logger.Infof("serving the metrics on port %d", s.port)
+		if err := server.Serve(listener); err != nil && !isClosed(err) {
+			logger.Errorf("failed to serve the metrics on port %d. %+v", s.port, err)
+		}
+	}()
+	return nil
+}
+
+// Stop closes the listener of the server and waits for the serving to end. The server can be initialized and started
+// again after it is stopped.
+func (s *Server) Stop() {
+	s.Lock()
+	listener, done := s.listener, s.done
+	s.listener, s.done = nil, nil
+	s.Unlock()
+
+	if listener == nil {
+		return
+	}
+	if err := listener.Close(); err != nil {
+		logger.Warningf("failed to close the listener of the metrics on port %d. %+v", s.port, err)
+	}
+	if done != nil {
+		<-done
+		logger.Infof("stopped serving the metrics on port %d", s.port)
+	}
+}
+
+// limitRequestBody rejects the requests with a body larger than the max, and stops the reads of a body without a
+// length at the max
+func limitRequestBody(h http.Handler, max int64) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ContentLength > max {
+			http.Error(w, fmt.Sprintf("the request body is larger than %d bytes", max), http.StatusRequestEntityTooLarge)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, max)
+		h.ServeHTTP(w, r)
+	})
+}
+
+// the error of a closed listener is not exported by the net package
+func isClosed(err error) bool {
+	return strings.Contains(err.Error(), "use of closed network connection")
+}
+
+// Serve initializes and starts a server of the metrics on the port. The metrics are not served if the port is zero.
+func Serve(port int) (*Server, error) {
+	s := NewServer(port)
+	if err := s.Init(); err != nil {
+		return nil, err
+	}
+	if err := s.Start(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// ObserveCommand records the time of the command of the tool since the start
+func ObserveCommand(tool string, args []string, start time.Time) {
+	CommandDuration.WithLabelValues(CommandLabel(tool, args)).Observe(time.Since(start).Seconds())
+}
+
+// ObserveOrchestration records the time of the orchestration phase since the start
+func ObserveOrchestration(phase string, start time.Time) {
+	OrchestrationDuration.WithLabelValues(phase).Observe(time.Since(start).Seconds())
+}
+
+// ObserveAgentTask records the time of the agent task since the start
+func ObserveAgentTask(task string, start time.Time) {
+	AgentTaskDuration.WithLabelValues(task).Observe(time.Since(start).Seconds())
+}
+
+// ObserveKubernetesRequest records the latency of a request to the kubernetes api
+func ObserveKubernetesRequest(verb string, latency time.Duration) {
+	KubernetesRequestDuration.WithLabelValues(verb).Observe(latency.Seconds())
+}
+
+// CommandLabel returns the label of the command of the tool, which is the tool with its leading args that are words
+func CommandLabel(tool string, args []string) string {
+	max := 1
+	if tool == "ceph" {
+		max = cephCommandArgs
+	}
+	label := []string{tool}
+	for i := 0; i < len(args) && i < max; i++ {
+		if !commandWordRegex.MatchString(args[i]) {
+			break
+		}
+		label = append(label, args[i])
+	}
+	return strings.Join(label, " ")
+}
@@ -0,0 +1,200 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCommandLabel(t *testing.T) {
+	assert.Equal(t, "ceph osd pool", CommandLabel("ceph", []string{"osd", "pool", "get", "replicapool", "all"}))
+	assert.Equal(t, "ceph status", CommandLabel("ceph", []string{"status", "--cluster=rook", "--format", "json"}))
+	assert.Equal(t, "ceph osd out", CommandLabel("ceph", []string{"osd", "out", "3"}))
+	assert.Equal(t, "ceph pg", CommandLabel("ceph", []string{"pg", "2.5"}))
+	assert.Equal(t, "rbd ls", CommandLabel("rbd", []string{"ls", "replicapool"}))
+	assert.Equal(t, "rados list-inconsistent-obj", CommandLabel("rados", []string{"list-inconsistent-obj", "2.5"}))
+	assert.Equal(t, "crushtool", CommandLabel("crushtool", []string{"-d", "/tmp/map"}))
+}
+
+func TestRegister(t *testing.T) {
+	// registering the metrics twice would panic
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			Register()
+		}()
+	}
+	wg.Wait()
+}
+
+func TestServerLifecycle(t *testing.T) {
+	// the metrics are not served without a port
+	s := NewServer(0)
+	assert.Nil(t, s.Init())
+	assert.Nil(t, s.Start())
+	s.Stop()
+
+	// the server must be initialized before it is started
+	port := freePort(t)
+	s = NewServer(port)
+	assert.NotNil(t, s.Start())
+
+	// the lifecycle methods can be called concurrently and more than once
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.Nil(t, s.Init())
+			assert.Nil(t, s.Start())
+		}()
+	}
+	wg.Wait()
+
+	// a port in use is an error of the init
+	assert.NotNil(t, NewServer(port).Init())
+
+	// the client does not keep the connections open, so the requests after the stop reach the closed listener
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+	resp, err := client.Get(fmt.Sprintf("http://127.0.0.1:%d/metrics", port))
+	assert.Nil(t, err)
+	resp.Body.Close()
+
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.Stop()
+		}()
+	}
+	wg.Wait()
+	_, err = client.Get(fmt.Sprintf("http://127.0.0.1:%d/metrics", port))
+	assert.NotNil(t, err)
+
+	// the server can be started again after it is stopped
+	assert.Nil(t, s.Init())
+	assert.Nil(t, s.Start())
+	s.Stop()
+}
+
+func TestServerLimits(t *testing.T) {
+	s := NewServer(freePort(t))
+	s.readTimeout = 100 * time.Millisecond
+	s.maxRequestBytes = 10
+	assert.Nil(t, s.Init())
+	assert.Nil(t, s.Start())
+	defer s.Stop()
+	url := fmt.Sprintf("http://127.0.0.1:%d/metrics", s.port)
+
+	resp, err := http.Post(url, "text/plain", strings.NewReader("more than ten bytes"))
+	assert.Nil(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusRequestEntityTooLarge, resp.StatusCode)
+
+	// the small bodies reach the handler
+	resp, err = http.Post(url, "text/plain", strings.NewReader("small"))
+	assert.Nil(t, err)
+	resp.Body.Close()
+	assert.NotEqual(t, http.StatusRequestEntityTooLarge, resp.StatusCode)
+
+	// a connection that does not send a request is closed after the read timeout
+	conn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", s.port))
+	assert.Nil(t, err)
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, err = conn.Read(make([]byte, 1))
+	assert.Equal(t, io.EOF, err)
+}
+
+func freePort(t *testing.T) int {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+func TestAllowCORS(t *testing.T) {
+	served := 0
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { served++ })
+	request := func(h http.Handler, method, origin string, headers map[string]string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, "/metrics", nil)
+		if origin != "" {
+			r.Header.Set("Origin", origin)
+		}
+		for k, v := range headers {
+			r.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+	preflight := func(method, headers string) map[string]string {
+		return map[string]string{"Access-Control-Request-Method": method, "Access-Control-Request-Headers": headers}
+	}
+
+	// no cors headers without allowed origins
+	w := request(allowCORS(handler, corsConfig{}), "GET", "https://dashboard", nil)
+	assert.Equal(t, "", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, 1, served)
+
+	h := allowCORS(handler, corsConfig{origins: []string{"https://dashboard"}, methods: []string{"GET"}, headers: []string{"X-Requested-With"}})
+	w = request(h, "GET", "https://dashboard", nil)
+	assert.Equal(t, "https://dashboard", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "", w.Header().Get("Access-Control-Allow-Credentials"))
+	assert.Equal(t, 2, served)
+
+	// the other origins are served without the cors headers
+	w = request(h, "GET", "https://other", nil)
+	assert.Equal(t, "", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, 3, served)
+
+	// the preflight requests are answered without calling the handler
+	w = request(h, "OPTIONS", "https://dashboard", preflight("GET", "x-requested-with"))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "GET", w.Header().Get("Access-Control-Allow-Methods"))
+	assert.Equal(t, "X-Requested-With", w.Header().Get("Access-Control-Allow-Headers"))
+	assert.Equal(t, 3, served)
+	assert.Equal(t, http.StatusForbidden, request(h, "OPTIONS", "https://other", preflight("GET", "")).Code)
+	assert.Equal(t, http.StatusForbidden, request(h, "OPTIONS", "https://dashboard", preflight("DELETE", "")).Code)
+	assert.Equal(t, http.StatusForbidden, request(h, "OPTIONS", "https://dashboard", preflight("GET", "Authorization")).Code)
+	assert.Equal(t, 3, served)
+
+	// all the origins
+	h = allowCORS(handler, corsConfig{origins: []string{"*"}, methods: []string{"GET"}})
+	assert.Equal(t, "*", request(h, "GET", "https://other", nil).Header().Get("Access-Control-Allow-Origin"))
+
+	// the credentials are allowed for the listed origins, but not for all the origins
+	h = allowCORS(handler, corsConfig{origins: []string{"https://dashboard"}, methods: []string{"GET"}, credentials: true})
+	w = request(h, "GET", "https://dashboard", nil)
+	assert.Equal(t, "https://dashboard", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "true", w.Header().Get("Access-Control-Allow-Credentials"))
+	assert.Nil(t, corsConfig{origins: []string{"https://dashboard"}, credentials: true}.verify())
+	assert.Nil(t, corsConfig{origins: []string{"*"}}.verify())
+	assert.NotNil(t, corsConfig{origins: []string{"https://dashboard", "*"}, credentials: true}.verify())
+}
@@ -0,0 +1,103 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package netcheck
+
+import (
+	"fmt"
+	"sort"
+)
+
+const (
+	// a link is slow or asymmetric when it is slower than the other link by this factor
+	slowFactor = 2.0
+	// latencies that differ by less than this are not reported, since they are in the noise of the measurement
+	minLatencyDiffMs = 0.5
+)
+
+// Finding is a link between two nodes that is unreachable, slow compared to the other links, or much slower in one
+// direction than in the other
+type Finding struct {
+	From    string `json:"from"`
+	To      string `json:"to"`
+	Problem string `json:"problem"`
+}
+
+// Analyze returns the findings of the matrix of the results measured from each node to the other nodes
+func Analyze(results map[string]map[string]Result) []Finding {
+	findings := []Finding{}
+	latencies := []float64{}
+	throughputs := []float64{}
+	for _, peers := range results {
+		for _, r := range peers {
+			if r.Error == "" {
+				latencies = append(latencies, r.LatencyMs)
+				throughputs = append(throughputs, r.ThroughputMBps)
+			}
+		}
+	}
+	medianLatency := median(latencies)
+	medianThroughput := median(throughputs)
+
+	for from, peers := range results {
+		for to, r := range peers {
+			if r.Error != "" {
+				findings = append(findings, Finding{From: from, To: to, Problem: fmt.Sprintf("unreachable: %s", r.Error)})
+				continue
+			}
+			if slowerLatency(r.LatencyMs, medianLatency) {
+				findings = append(findings, Finding{From: from, To: to,
+					Problem: fmt.Sprintf("slow latency %.2fms, the median is %.2fms", r.LatencyMs, medianLatency)})
+			}
+			if slowerThroughput(r.ThroughputMBps, medianThroughput) {
+				findings = append(findings, Finding{From: from, To: to,
+					Problem: fmt.Sprintf("slow throughput %.1fMB/s, the median is %.1fMB/s", r.ThroughputMBps, medianThroughput)})
+			}
+
+			// each pair of nodes is compared once
+			back, ok := results[to][from]
+			if !ok || back.Error != "" || to < from {
+				continue
+			}
+			if slowerLatency(r.LatencyMs, back.LatencyMs) || slowerLatency(back.LatencyMs, r.LatencyMs) {
+				findings = append(findings, Finding{From: from, To: to,
+					Problem: fmt.Sprintf("asymmetric latency %.2fms, %.2fms in the other direction", r.LatencyMs, back.LatencyMs)})
+			}
+			if slowerThroughput(r.ThroughputMBps, back.ThroughputMBps) || slowerThroughput(back.ThroughputMBps, r.ThroughputMBps) {
+				findings = append(findings, Finding{From: from, To: to,
+					Problem: fmt.Sprintf("asymmetric throughput %.1fMB/s, %.1fMB/s in the other direction", r.ThroughputMBps, back.ThroughputMBps)})
+			}
+		}
+	}
+
+	sort.Slice(findings, func(i, j int) bool {
+		if findings[i].From != findings[j].From {
+			return findings[i].From < findings[j].From
+		}
+		if findings[i].To != findings[j].To {
+			return findings[i].To < findings[j].To
+		}
+		return findings[i].Problem < findings[j].Problem
+	})
+	return findings
+}
+
+func slowerLatency(latency, reference float64) bool {
+	return latency > slowFactor*reference && latency-reference > minLatencyDiffMs
+}
+
+func slowerThroughput(throughput, reference float64) bool {
+	return throughput > 0 && throughput*slowFactor < reference
+}
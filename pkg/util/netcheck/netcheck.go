@@ -0,0 +1,146 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package netcheck measures the latency and throughput of the network between two nodes
+package netcheck
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"sort"
+	"time"
+)
+
+const (
+	pingRequest = byte('p')
+	dataRequest = byte('d')
+	bufferSize  = 64 * 1024
+)
+
+// Result is the latency and throughput measured from a node to another
+type Result struct {
+	// The median round trip time of the pings in milliseconds
+	LatencyMs float64 `json:"latencyMs"`
+	// The throughput of the data sent to the other node in MB/s
+	ThroughputMBps float64 `json:"throughputMBps"`
+	Error          string  `json:"error,omitempty"`
+}
+
+// Serve answers the measurements of the other nodes on the listener until it is closed
+func Serve(listener net.Listener) error {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+		go serveConn(conn)
+	}
+}
+
+func serveConn(conn net.Conn) {
+	defer conn.Close()
+	request := make([]byte, 1)
+	for {
+		if _, err := io.ReadFull(conn, request); err != nil {
+			return
+		}
+		switch request[0] {
+		case pingRequest:
+		case dataRequest:
+			var size uint64
+			if err := binary.Read(conn, binary.BigEndian, &size); err != nil {
+				return
+			}
+			if _, err := io.CopyN(ioutil.Discard, conn, int64(size)); err != nil {
+				return
+			}
+		default:
+			return
+		}
+		// the reply is sent once the request was read entirely
+		if _, err := conn.Write(request); err != nil {
+			return
+		}
+	}
+}
+
+// Measure measures the latency with the given number of pings and the throughput by sending the given number of
+// bytes to the node at the address
+func Measure(addr string, pings int, size int64, timeout time.Duration) (*Result, error) {
+	conn, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s. %+v", addr, err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	reply := make([]byte, 1)
+	latencies := []float64{}
+	for i := 0; i < pings; i++ {
+		start := time.Now()
+		if _, err := conn.Write([]byte{pingRequest}); err != nil {
+			return nil, fmt.Errorf("failed to ping %s. %+v", addr, err)
+		}
+		if _, err := io.ReadFull(conn, reply); err != nil {
+			return nil, fmt.Errorf("failed to read the ping reply of %s. %+v", addr, err)
+		}
+		latencies = append(latencies, float64(time.Since(start))/float64(time.Millisecond))
+	}
+
+	result := &Result{LatencyMs: median(latencies)}
+	if size <= 0 {
+		return result, nil
+	}
+	start := time.Now()
+	if _, err := conn.Write([]byte{dataRequest}); err != nil {
+		return nil, fmt.Errorf("failed to send data to %s. %+v", addr, err)
+	}
+	if err := binary.Write(conn, binary.BigEndian, uint64(size)); err != nil {
+		return nil, fmt.Errorf("failed to send data to %s. %+v", addr, err)
+	}
+	buffer := make([]byte, bufferSize)
+	for remaining := size; remaining > 0; {
+		n := int64(len(buffer))
+		if remaining < n {
+			n = remaining
+		}
+		if _, err := conn.Write(buffer[:n]); err != nil {
+			return nil, fmt.Errorf("failed to send data to %s. %+v", addr, err)
+		}
+		remaining -= n
+	}
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return nil, fmt.Errorf("failed to read the data reply of %s. %+v", addr, err)
+	}
+	result.ThroughputMBps = float64(size) / (1024 * 1024) / time.Since(start).Seconds()
+	return result, nil
+}
+
+func median(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := append([]float64{}, values...)
+	sort.Float64s(sorted)
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
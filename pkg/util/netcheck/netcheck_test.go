@@ -0,0 +1,66 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package netcheck
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMeasure(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer listener.Close()
+	go Serve(listener)
+
+	result, err := Measure(listener.Addr().String(), 5, 1024*1024+1, 10*time.Second)
+	assert.Nil(t, err)
+	assert.True(t, result.LatencyMs > 0)
+	assert.True(t, result.ThroughputMBps > 0)
+
+	// only the latency
+	result, err = Measure(listener.Addr().String(), 1, 0, 10*time.Second)
+	assert.Nil(t, err)
+	assert.Equal(t, float64(0), result.ThroughputMBps)
+
+	listener.Close()
+	_, err = Measure(listener.Addr().String(), 1, 0, time.Second)
+	assert.NotNil(t, err)
+}
+
+func TestAnalyze(t *testing.T) {
+	results := map[string]map[string]Result{
+		"a": {"b": {LatencyMs: 0.2, ThroughputMBps: 1000}, "c": {LatencyMs: 0.3, ThroughputMBps: 900}},
+		"b": {"a": {LatencyMs: 0.2, ThroughputMBps: 1000}, "c": {LatencyMs: 5, ThroughputMBps: 950}},
+		"c": {"a": {LatencyMs: 0.3, ThroughputMBps: 100}, "b": {LatencyMs: 0.2, ThroughputMBps: 1000}},
+	}
+	assert.Equal(t, []Finding{
+		{From: "a", To: "c", Problem: "asymmetric throughput 900.0MB/s, 100.0MB/s in the other direction"},
+		{From: "b", To: "c", Problem: "asymmetric latency 5.00ms, 0.20ms in the other direction"},
+		{From: "b", To: "c", Problem: "slow latency 5.00ms, the median is 0.25ms"},
+		{From: "c", To: "a", Problem: "slow throughput 100.0MB/s, the median is 975.0MB/s"},
+	}, Analyze(results))
+
+	// a node that cannot be reached
+	results["a"]["c"] = Result{Error: "connection refused"}
+	findings := Analyze(results)
+	assert.Equal(t, Finding{From: "a", To: "c", Problem: "unreachable: connection refused"}, findings[0])
+
+	assert.Equal(t, []Finding{}, Analyze(map[string]map[string]Result{}))
+}
@@ -21,7 +21,6 @@ import (
 	"regexp"
 	"strings"
 	"sync"
-	"syscall"
 
 	ps "github.com/jbw976/go-ps"
 	"github.com/rook/rook/pkg/util/exec"
@@ -177,7 +176,11 @@ func (p *ProcManager) checkProcessExists(binary, procSearchPattern string, polic
 
 	// we couldn't stop the existing process through our own managed process set, try to stop the process
 	// via a direct signal to its PID
-	if err := syscall.Kill(existingProc.Pid(), syscall.SIGKILL); err != nil {
+	process, err := os.FindProcess(existingProc.Pid())
+	if err != nil {
+		return false, fmt.Errorf("failed to find child process %d: %v", existingProc.Pid(), err)
+	}
+	if err := process.Kill(); err != nil {
 		return false, fmt.Errorf("failed to stop child process %d: %v", existingProc.Pid(), err)
 	}
 
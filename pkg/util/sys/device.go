@@ -17,7 +17,9 @@ package sys
 
 import (
 	"fmt"
+	"io/ioutil"
 	"os"
+	"path"
 	"strconv"
 	"strings"
 
@@ -33,6 +35,17 @@ const (
 	LVMType   = "lvm"
 	sgdisk    = "sgdisk"
 	mountCmd  = "mount"
+
+	// the filesystems that can be created on a device
+	Ext4FS  = "ext4"
+	XfsFS   = "xfs"
+	BtrfsFS = "btrfs"
+
+	// HostMountInfoFile is the mount info of the init process, which are the mounts of the host in a pod with the pid
+	// namespace of the host
+	HostMountInfoFile = "/proc/1/mountinfo"
+	// DevBlockDir has a link to the sysfs directory of each block device, named after its major:minor number
+	DevBlockDir = "/sys/dev/block"
 )
 
 type Partition struct {
@@ -40,6 +53,8 @@ type Partition struct {
 	Size       uint64
 	Label      string
 	Filesystem string
+	// UUID is the unique guid of the partition in the partition table
+	UUID string
 }
 
 // LocalDevice contains information about an unformatted block device
@@ -78,6 +93,27 @@ type LocalDisk struct {
 	WWNVendorExtension string `json:"wwnVendorExtension"`
 	// Empty checks whether the device is completely empty
 	Empty bool `json:"empty"`
+	// Mountpoint is where a filesystem of the device or of one of its children is mounted on the host, such as / for
+	// the boot disk. The mounted devices are never formatted for an osd unless they are explicitly overridden.
+	Mountpoint string `json:"mountpoint,omitempty"`
+}
+
+// MatchesID returns whether the device is identified by the given id. The id is either the device name (e.g. sdb),
+// its path or one of its persistent paths (e.g. /dev/disk/by-id/wwn-0x5000c500a0b1c2d3), its serial or its WWN.
+// The persistent ids do not change when the device names are reordered after a reboot.
+func (d *LocalDisk) MatchesID(id string) bool {
+	if id == "" {
+		return false
+	}
+	if id == d.Name || id == "/dev/"+d.Name || id == d.Serial || id == d.WWN || id == d.WWNVendorExtension {
+		return true
+	}
+	for _, link := range strings.Fields(d.DevLinks) {
+		if id == link {
+			return true
+		}
+	}
+	return false
 }
 
 func ListDevices(executor exec.Executor) ([]string, error) {
@@ -131,6 +167,9 @@ func GetDevicePartitions(device string, executor exec.Executor) (partitions []Pa
 			if v, ok := info["ID_FS_TYPE"]; ok {
 				p.Filesystem = v
 			}
+			if v, ok := info["ID_PART_ENTRY_UUID"]; ok {
+				p.UUID = v
+			}
 
 			partitions = append(partitions, p)
 		}
@@ -202,14 +241,103 @@ func RemovePartitions(device string, executor exec.Executor) error {
 	return nil
 }
 
+// WipeDevice removes the partitions of a device and the signatures of its filesystems, of ceph, of lvm and of dm-crypt,
+// so the device is empty when the osds are provisioned again. The lvm volumes and dm-crypt mappings on the device are
+// removed first so the kernel releases its partitions.
+func WipeDevice(device string, executor exec.Executor) error {
+	devicePath := "/dev/" + device
+	cmd := fmt.Sprintf("lsblk children %s", device)
+	output, err := executor.ExecuteCommandWithOutput(false, cmd, "lsblk", "--noheadings", "--list", "--output", "NAME,TYPE", devicePath)
+	if err != nil {
+		return fmt.Errorf("failed to list the children of device %s. %+v", device, err)
+	}
+	var mappings, partitions []string
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		switch fields[1] {
+		case LVMType, CryptType:
+			mappings = append(mappings, fields[0])
+		case PartType:
+			partitions = append(partitions, fields[0])
+		}
+	}
+
+	// the children are listed after their parents, so the mappings are removed from the top of the stack down
+	for i := len(mappings) - 1; i >= 0; i-- {
+		cmd := fmt.Sprintf("remove mapping %s", mappings[i])
+		if err := executor.ExecuteCommand(false, cmd, "dmsetup", "remove", "--force", mappings[i]); err != nil {
+			return fmt.Errorf("failed to remove mapping %s of device %s. %+v", mappings[i], device, err)
+		}
+	}
+
+	for _, name := range append(partitions, device) {
+		cmd := fmt.Sprintf("wipefs %s", name)
+		if err := executor.ExecuteCommand(false, cmd, "wipefs", "--all", "--force", "/dev/"+name); err != nil {
+			return fmt.Errorf("failed to wipe the signatures of %s. %+v", name, err)
+		}
+		// the bluestore labels are at the start of the partitions
+		cmd = fmt.Sprintf("zero %s", name)
+		if err := executor.ExecuteCommand(false, cmd, "dd", "if=/dev/zero", "of=/dev/"+name, "bs=1M", "count=10", "oflag=direct"); err != nil {
+			logger.Warningf("failed to zero the start of %s. %+v", name, err)
+		}
+	}
+
+	cmd = fmt.Sprintf("zap %s", device)
+	if err := executor.ExecuteCommand(false, cmd, sgdisk, "--zap-all", devicePath); err != nil {
+		return fmt.Errorf("failed to zap partitions on %s: %+v", devicePath, err)
+	}
+
+	// the kernel forgets the removed partitions
+	cmd = fmt.Sprintf("partprobe %s", device)
+	if err := executor.ExecuteCommand(false, cmd, "partprobe", devicePath); err != nil {
+		logger.Warningf("failed to reload the partition table of %s. %+v", devicePath, err)
+	}
+
+	return nil
+}
+
 func CreatePartitions(device string, args []string, executor exec.Executor) error {
 	cmd := fmt.Sprintf("partition %s", device)
 	return executor.ExecuteCommand(false, cmd, sgdisk, args...)
 }
 
 func FormatDevice(devicePath string, executor exec.Executor) error {
-	cmd := fmt.Sprintf("mkfs.ext4 %s", devicePath)
-	if err := executor.ExecuteCommand(false, cmd, "mkfs.ext4", devicePath); err != nil {
+	return FormatDeviceWithOptions(devicePath, "", "", executor)
+}
+
+// ValidateFilesystem returns an error if the filesystem cannot be created by FormatDeviceWithOptions. An empty
+// filesystem is ext4.
+func ValidateFilesystem(fstype string) error {
+	switch fstype {
+	case "", Ext4FS, XfsFS, BtrfsFS:
+		return nil
+	}
+	return fmt.Errorf("unsupported filesystem %s, expected %s, %s or %s", fstype, Ext4FS, XfsFS, BtrfsFS)
+}
+
+// FormatDeviceWithOptions creates a filesystem of the given type (ext4 if empty) on the device, with the
+// space-separated options passed directly to the mkfs command. The xfs and btrfs filesystems are forced over any
+// leftover signature since the device was just partitioned.
+func FormatDeviceWithOptions(devicePath, fstype, options string, executor exec.Executor) error {
+	if err := ValidateFilesystem(fstype); err != nil {
+		return err
+	}
+	if fstype == "" {
+		fstype = Ext4FS
+	}
+
+	args := strings.Fields(options)
+	if fstype != Ext4FS {
+		args = append(args, "-f")
+	}
+	args = append(args, devicePath)
+
+	mkfs := "mkfs." + fstype
+	cmd := fmt.Sprintf("%s %s", mkfs, devicePath)
+	if err := executor.ExecuteCommand(false, cmd, mkfs, args...); err != nil {
 		return fmt.Errorf("command %s failed: %+v", cmd, err)
 	}
 
@@ -284,6 +412,63 @@ func UnmountDevice(devicePath string, executor exec.Executor) error {
 	return nil
 }
 
+// GetMountedDevices returns the mount point of the devices with a mounted filesystem, keyed by the device name. The
+// mounts are read from the mount info of a process (e.g. /proc/1/mountinfo for the mounts of the host), and each
+// device is found from the major:minor number of its mount under devBlockDir, since the mount source can be a name
+// such as /dev/root that does not exist. The disks and partitions under a mounted device are also returned, so the
+// disk of a mounted partition or lvm volume is found.
+func GetMountedDevices(mountInfoFile, devBlockDir string, executor exec.Executor) (map[string]string, error) {
+	contents, err := ioutil.ReadFile(mountInfoFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read mount info %s. %+v", mountInfoFile, err)
+	}
+
+	mounted := map[string]string{}
+	resolved := map[string]bool{}
+	for _, line := range strings.Split(string(contents), "\n") {
+		// the fields are: id, parent id, major:minor, root, mount point, options, optional fields, "-", fs type,
+		// source and super options
+		fields := strings.Fields(line)
+		separator := -1
+		for i := 6; i < len(fields); i++ {
+			if fields[i] == "-" {
+				separator = i
+				break
+			}
+		}
+		if len(fields) < 5 || separator == -1 || separator+2 >= len(fields) {
+			continue
+		}
+		majorMinor, mountpoint, source := fields[2], fields[4], fields[separator+2]
+		if link, err := os.Readlink(path.Join(devBlockDir, majorMinor)); err == nil {
+			source = path.Join("/dev", path.Base(link))
+		} else if !strings.HasPrefix(source, "/dev/") {
+			// not a block device, such as a tmpfs or an overlay. a btrfs filesystem has an anonymous device number
+			// though, so its disks are still found from its source.
+			continue
+		}
+		if resolved[source] {
+			continue
+		}
+		resolved[source] = true
+
+		cmd := fmt.Sprintf("lsblk inverse %s", source)
+		output, err := executor.ExecuteCommandWithOutput(false, cmd, "lsblk", "--inverse", "--noheadings", "--list", "--output", "NAME", source)
+		if err != nil {
+			// the device is still protected by its own name if its disks cannot be found
+			logger.Warningf("failed to get the disks of mounted device %s. %+v", source, err)
+			output = path.Base(source)
+		}
+		for _, name := range strings.Fields(output) {
+			if _, ok := mounted[name]; !ok {
+				mounted[name] = mountpoint
+			}
+		}
+	}
+
+	return mounted, nil
+}
+
 func CheckIfDeviceAvailable(executor exec.Executor, name string) (bool, string, error) {
 	ownPartitions := true
 	partitions, _, err := GetDevicePartitions(name, executor)
@@ -17,6 +17,9 @@ package sys
 
 import (
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
 	"testing"
 
 	exectest "github.com/rook/rook/pkg/util/exec/test"
@@ -201,3 +204,143 @@ func TestParseUdevInfo(t *testing.T) {
 	m := parseUdevInfo(udevOutput)
 	assert.Equal(t, m["ID_FS_TYPE"], "ext2")
 }
+
+func TestMatchesID(t *testing.T) {
+	disk := &LocalDisk{
+		Name:     "sdb",
+		Serial:   "ST4000NM0033_Z1Z8X7AB",
+		WWN:      "0x5000c500a0b1c2d3",
+		DevLinks: "/dev/disk/by-id/wwn-0x5000c500a0b1c2d3 /dev/disk/by-path/pci-0000:00:1f.2-ata-2",
+	}
+	assert.True(t, disk.MatchesID("sdb"))
+	assert.True(t, disk.MatchesID("/dev/sdb"))
+	assert.True(t, disk.MatchesID("ST4000NM0033_Z1Z8X7AB"))
+	assert.True(t, disk.MatchesID("0x5000c500a0b1c2d3"))
+	assert.True(t, disk.MatchesID("/dev/disk/by-id/wwn-0x5000c500a0b1c2d3"))
+	assert.True(t, disk.MatchesID("/dev/disk/by-path/pci-0000:00:1f.2-ata-2"))
+	assert.False(t, disk.MatchesID("sdc"))
+	assert.False(t, disk.MatchesID("/dev/disk/by-id/wwn-0x5000c500a0b1c2d4"))
+
+	// empty ids never match the missing properties of a device
+	assert.False(t, (&LocalDisk{Name: "sdc"}).MatchesID(""))
+}
+
+func TestGetMountedDevices(t *testing.T) {
+	mounts, err := ioutil.TempFile("", "mounts")
+	assert.Nil(t, err)
+	defer os.Remove(mounts.Name())
+	mounts.WriteString(`18 23 0:17 / /sys rw,nosuid,nodev,noexec,relatime shared:6 - sysfs sysfs rw
+23 1 253:0 / / rw,relatime shared:1 - ext4 /dev/mapper/vg0-root rw,errors=remount-ro
+26 23 8:1 / /boot rw,relatime shared:7 - ext2 /dev/sda1 rw
+27 23 8:17 / /var rw,relatime shared:8 - xfs /dev/root rw,attr2
+28 23 8:17 /images /var/lib/images rw,relatime shared:8 - xfs /dev/root rw,attr2
+29 23 0:45 / /data rw,relatime shared:9 - btrfs /dev/sdc rw,space_cache
+30 23 0:23 / /run rw,nosuid,noexec,relatime shared:10 - tmpfs tmpfs rw
+`)
+	mounts.Close()
+
+	// the devices are found from their major:minor number, the mounted /dev/root is sdb1
+	devBlockDir, err := ioutil.TempDir("", "dev-block")
+	assert.Nil(t, err)
+	defer os.RemoveAll(devBlockDir)
+	assert.Nil(t, os.Symlink("../../devices/virtual/block/dm-0", path.Join(devBlockDir, "253:0")))
+	assert.Nil(t, os.Symlink("../../devices/pci0000:00/block/sda/sda1", path.Join(devBlockDir, "8:1")))
+	assert.Nil(t, os.Symlink("../../devices/pci0000:00/block/sdb/sdb1", path.Join(devBlockDir, "8:17")))
+
+	executor := &exectest.MockExecutor{}
+	lsblkCalls := 0
+	executor.MockExecuteCommandWithOutput = func(debug bool, name string, command string, args ...string) (string, error) {
+		lsblkCalls++
+		switch name {
+		case "lsblk inverse /dev/dm-0":
+			return "vg0-root\nsda2\nsda\nsdd1\nsdd", nil
+		case "lsblk inverse /dev/sda1":
+			return "sda1\nsda", nil
+		case "lsblk inverse /dev/sdb1":
+			return "sdb1\nsdb", nil
+		case "lsblk inverse /dev/sdc":
+			return "sdc", nil
+		}
+		return "", fmt.Errorf("unknown device")
+	}
+
+	mounted, err := GetMountedDevices(mounts.Name(), devBlockDir, executor)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"vg0-root": "/", "sda2": "/", "sda": "/", "sdd1": "/", "sdd": "/", "sda1": "/boot",
+		"sdb1": "/var", "sdb": "/var", "sdc": "/data"}, mounted)
+	// the bind mount of a device is not resolved again
+	assert.Equal(t, 4, lsblkCalls)
+
+	// the devices cannot be protected without the mounts
+	_, err = GetMountedDevices("/not/a/mounts/file", devBlockDir, executor)
+	assert.NotNil(t, err)
+}
+
+func TestWipeDevice(t *testing.T) {
+	commands := []string{}
+	executor := &exectest.MockExecutor{}
+	executor.MockExecuteCommandWithOutput = func(debug bool, name string, command string, args ...string) (string, error) {
+		assert.Equal(t, "lsblk children sdb", name)
+		return `sdb                                   disk
+sdb1                                  part
+sdb2                                  part
+ceph--a1b2-osd--block--c3d4           lvm
+ceph--a1b2-osd--block--c3d4-crypt     crypt`, nil
+	}
+	executor.MockExecuteCommand = func(debug bool, name string, command string, args ...string) error {
+		commands = append(commands, name)
+		if command == "dd" && args[1] == "of=/dev/sdb2" {
+			// the partition is smaller than the zeroed size
+			return fmt.Errorf("no space left on device")
+		}
+		return nil
+	}
+
+	assert.Nil(t, WipeDevice("sdb", executor))
+	assert.Equal(t, []string{
+		"remove mapping ceph--a1b2-osd--block--c3d4-crypt",
+		"remove mapping ceph--a1b2-osd--block--c3d4",
+		"wipefs sdb1", "zero sdb1",
+		"wipefs sdb2", "zero sdb2",
+		"wipefs sdb", "zero sdb",
+		"zap sdb",
+		"partprobe sdb",
+	}, commands)
+
+	// the device is not zapped if a mapping cannot be removed
+	commands = []string{}
+	executor.MockExecuteCommand = func(debug bool, name string, command string, args ...string) error {
+		commands = append(commands, name)
+		return fmt.Errorf("device busy")
+	}
+	assert.NotNil(t, WipeDevice("sdb", executor))
+	assert.Equal(t, []string{"remove mapping ceph--a1b2-osd--block--c3d4-crypt"}, commands)
+}
+
+func TestFormatDeviceWithOptions(t *testing.T) {
+	executor := &exectest.MockExecutor{}
+	var command string
+	var args []string
+	executor.MockExecuteCommand = func(debug bool, name string, c string, a ...string) error {
+		command = c
+		args = a
+		return nil
+	}
+
+	// ext4 is the default filesystem
+	assert.Nil(t, FormatDevice("/dev/sdb1", executor))
+	assert.Equal(t, "mkfs.ext4", command)
+	assert.Equal(t, []string{"/dev/sdb1"}, args)
+
+	// the options are passed before the device and xfs is forced
+	assert.Nil(t, FormatDeviceWithOptions("/dev/sdb1", "xfs", "-i size=2048  -K", executor))
+	assert.Equal(t, "mkfs.xfs", command)
+	assert.Equal(t, []string{"-i", "size=2048", "-K", "-f", "/dev/sdb1"}, args)
+
+	// unknown filesystems are refused
+	command = ""
+	assert.NotNil(t, FormatDeviceWithOptions("/dev/sdb1", "zfs", "", executor))
+	assert.Equal(t, "", command)
+	assert.Nil(t, ValidateFilesystem("btrfs"))
+	assert.NotNil(t, ValidateFilesystem("ntfs"))
+}